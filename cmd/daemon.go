@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/daemon"
+	"github.com/dasvh/enchante/internal/probe"
+)
+
+// runDaemon runs the probe on the schedule of the configuration file until interrupted and returns the exit code
+func runDaemon(args []string) int {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	configFile := fs.String("config", "probe_config.yaml", "Path to the probe configuration file, a directory or a comma separated list of them")
+	profile := fs.String("profile", "", "Name of the profile of the configuration file to apply, e.g. staging")
+	cronExpr := fs.String("schedule", "", "Cron expression of the runs, e.g. */5 * * * * or @every 1m, overrides schedule.cron")
+	reportDir := fs.String("report-dir", "", "Directory to write the report of every run to, overrides schedule.report_dir")
+	controlAddr := fs.String("control-addr", "", "Address to serve the control API and health on, e.g. localhost:9091, overrides control.listen")
+	runNow := fs.Bool("run-now", false, "Run the probe when the daemon starts, like schedule.run_at_start")
+	loadLogger := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: enchante daemon [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	newLogger, err := loadLogger()
+	if err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadProfile(*configFile, *profile, newLogger)
+	if err != nil {
+		newLogger.Error("Failed to load config", "error", err)
+		return 1
+	}
+	if *cronExpr != "" {
+		cfg.Schedule.Cron = *cronExpr
+	}
+	if *reportDir != "" {
+		cfg.Schedule.ReportDir = *reportDir
+	}
+	if *controlAddr != "" {
+		cfg.ProbingConfig.Control.Listen = *controlAddr
+	}
+	if *runNow {
+		cfg.Schedule.RunAtStart = true
+	}
+
+	opts := daemon.Options{}
+	if cfg.ProbingConfig.Control.Listen != "" {
+		server, err := probe.NewControlServer(cfg.ProbingConfig.Control, newLogger)
+		if err != nil {
+			newLogger.Error("Failed to start control API", "error", err)
+			return 1
+		}
+		defer server.Close()
+		opts.Server = server
+		newLogger.Info("Serving control API", "url", "http://"+server.Addr()+"/v1/health")
+	}
+	if stream := cfg.ProbingConfig.ResultStream; stream.Listen != "" || stream.GRPCListen != "" {
+		server, err := probe.NewStreamServer(stream, newLogger)
+		if err != nil {
+			newLogger.Error("Failed to start result stream", "error", err)
+			return 1
+		}
+		defer server.Close()
+		opts.Stream = server
+	}
+	if cfg.History.Backend != "" {
+		configName := historyConfigName(cfg.History, *configFile, *profile)
+		opts.AfterRun = func(run daemon.Run, result *probe.ProbeResult) {
+			if result == nil {
+				return
+			}
+			if err := saveHistory(cfg.History, configName, result.Report); err != nil {
+				newLogger.Error("Failed to save run to history", "backend", cfg.History.Backend, "error", err)
+				return
+			}
+			newLogger.Info("Run saved to history", "backend", cfg.History.Backend, "run_id", run.RunID, "config", configName)
+		}
+	}
+
+	d, err := daemon.New(cfg, opts, newLogger)
+	if err != nil {
+		newLogger.Error("Failed to start daemon", "error", err)
+		return 1
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	newLogger.Info("Daemon started, press Ctrl+C to stop", "schedule", cfg.Schedule.Cron, "report_dir", cfg.Schedule.ReportDir)
+	if err := d.Run(ctx); err != nil {
+		newLogger.Error("Daemon stopped", "error", err)
+		return 1
+	}
+	newLogger.Info("Daemon stopped")
+	return 0
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// exitRegression is the exit code of a comparison finding regressions beyond the tolerances
+const exitRegression = 3
+
+// runDiff compares two JSON run reports and returns the exit code
+func runDiff(args []string) int {
+	return runCompare("diff", "Usage: enchante diff [flags] runA.json runB.json", args)
+}
+
+// runCompare compares a baseline and a current JSON run report, and fails when an endpoint regressed beyond the
+// tolerances. It returns the exit code
+func runCompare(name, usage string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	html := fs.Bool("html", false, "Render the comparison as an HTML page")
+	output := fs.String("output", "-", "Path to write the comparison to, use - for stdout")
+	var tolerances report.Tolerances
+	fs.Var(percentFlag{&tolerances.P50Increase}, "max-p50-increase", "Fail when the p50 latency of an endpoint increases by more than this percentage")
+	fs.Var(percentFlag{&tolerances.P99Increase}, "max-p99-increase", "Fail when the p99 latency of an endpoint increases by more than this percentage")
+	fs.Var(percentFlag{&tolerances.ErrorRateIncrease}, "max-error-rate-increase", "Fail when the error rate of an endpoint increases by more than this many percentage points")
+	fs.Var(percentFlag{&tolerances.ThroughputDecrease}, "max-throughput-decrease", "Fail when the requests per second of an endpoint decrease by more than this percentage")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(files) != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	before, err := report.Load(files[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	after, err := report.Load(files[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	diff := report.Compare(before, after)
+	checked := tolerances != report.Tolerances{}
+	regressions := diff.Regressions(tolerances)
+	err = writeOutput(*output, func(w io.Writer) error {
+		if *html {
+			return report.WriteHTML(w, diff)
+		}
+		if err := report.WriteText(w, diff); err != nil {
+			return err
+		}
+		if checked {
+			return report.WriteRegressions(w, regressions)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(regressions) > 0 {
+		fmt.Fprintf(os.Stderr, "%d regressions beyond the tolerances\n", len(regressions))
+		return exitRegression
+	}
+	return 0
+}
+
+// percentFlag is a flag setting an optional percentage, the percentage stays nil when the flag is not given
+type percentFlag struct {
+	value **float64
+}
+
+// String returns the percentage, or an empty string when it is not set
+func (f percentFlag) String() string {
+	if f.value == nil || *f.value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(**f.value, 'f', -1, 64)
+}
+
+// Set parses the percentage, it must not be negative
+func (f percentFlag) Set(s string) error {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || v < 0 {
+		return fmt.Errorf("must be a non-negative percentage")
+	}
+	*f.value = &v
+	return nil
+}
+
+// parseInterspersed parses flags that may appear before, between or after positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/discovery"
+	"github.com/dasvh/enchante/internal/kube"
+)
+
+// runDiscover generates a config file with health check endpoints for the services of a platform and returns the
+// exit code
+func runDiscover(args []string) int {
+	if len(args) == 0 || args[0] != "kubernetes" {
+		fmt.Fprintln(os.Stderr, "Usage: enchante discover kubernetes [flags]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("discover kubernetes", flag.ContinueOnError)
+	kubeconfig := fs.String("kubeconfig", kube.DefaultKubeconfig(), "Path to the kubeconfig file")
+	kubeContext := fs.String("context", "", "Kubeconfig context to use, defaults to the current context")
+	namespace := fs.String("namespace", "", "Namespace to discover, defaults to all namespaces")
+	selector := fs.String("selector", "", "Label selector the services and ingresses must match, e.g. app=shop")
+	resources := fs.String("resources", "services,ingresses", "Comma separated resource kinds to discover")
+	healthPath := fs.String("path", "/healthz", "Health check path probed on every discovered service")
+	output := fs.String("output", "discovered_config.yaml", "Path to write the generated config to, use - for stdout")
+	loadLogger := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: enchante discover kubernetes [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	opts := discovery.KubernetesOptions{
+		Kubeconfig: *kubeconfig,
+		Context:    *kubeContext,
+		Namespace:  *namespace,
+		Selector:   *selector,
+		HealthPath: *healthPath,
+	}
+	for _, kind := range strings.Split(*resources, ",") {
+		switch strings.TrimSpace(kind) {
+		case "services":
+			opts.Services = true
+		case "ingresses":
+			opts.Ingresses = true
+		default:
+			fmt.Fprintf(os.Stderr, "unknown resource kind %q, use services or ingresses\n", kind)
+			return 2
+		}
+	}
+
+	newLogger, err := loadLogger()
+	if err != nil {
+		return 2
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	endpoints, err := discovery.DiscoverKubernetes(ctx, opts, newLogger)
+	if err != nil {
+		newLogger.Error("Failed to discover endpoints", "error", err)
+		return 1
+	}
+	if len(endpoints) == 0 {
+		newLogger.Warn("No endpoints were discovered, no config written")
+		return 0
+	}
+	err = writeOutput(*output, func(w io.Writer) error {
+		return config.WriteEndpoints(w, endpoints)
+	})
+	if err != nil {
+		newLogger.Error("Failed to write discovered config", "file", *output, "error", err)
+		return 1
+	}
+	newLogger.Info("Discovered config written", "file", *output, "endpoints", len(endpoints))
+	return 0
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/doctor"
+)
+
+// runDoctor checks the local environment against a configuration file and returns the exit code, 1 when a check
+// failed
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	configFile := fs.String("config", "probe_config.yaml", "Path to the probe configuration file, a directory or a comma separated list of them")
+	profile := fs.String("profile", "", "Name of the profile of the configuration file to apply, e.g. staging")
+	timeout := fs.Duration("timeout", doctor.DefaultTimeout, "Timeout of every network check")
+	maxSkew := fs.Duration("max-skew", doctor.DefaultMaxSkew, "Clock skew to a server above which a warning is reported")
+	loadLogger := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: enchante doctor [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	newLogger, err := loadLogger()
+	if err != nil {
+		return 2
+	}
+	cfg, err := config.LoadProfile(*configFile, *profile, newLogger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s is invalid: %v\n", *configFile, err)
+		return 1
+	}
+
+	results := doctor.Run(context.Background(), cfg, doctor.Options{Timeout: *timeout, MaxSkew: *maxSkew})
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tCHECK\tTARGET\tDETAIL")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Status, r.Check, r.Target, r.Detail)
+	}
+	if err := tw.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if doctor.Failed(results) {
+		return 1
+	}
+	return 0
+}
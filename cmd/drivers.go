@@ -0,0 +1,7 @@
+package main
+
+// database/sql drivers of the history backends and the Timescale export
+import (
+	_ "github.com/jackc/pgx/v5/stdlib" // registers pgx for the postgres backend and Timescale
+	_ "modernc.org/sqlite"             // registers sqlite for the sqlite backend
+)
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/history"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// runHistory lists the past runs of the history configured in a configuration file and returns the exit code
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	configFile := fs.String("config", "probe_config.yaml", "Path to the probe configuration file, a directory or a comma separated list of them")
+	profile := fs.String("profile", "", "Name of the profile of the configuration file to apply, e.g. staging")
+	all := fs.Bool("all", false, "List the runs of all configs sharing the history, not only the runs of this config")
+	instance := fs.String("instance", "", "Only list the runs of this probe instance")
+	since := fs.Duration("since", 0, "Only list the runs started within this duration, e.g. 168h")
+	limit := fs.Int("limit", 20, "Maximum number of runs to list, 0 for all")
+	format := fs.String("format", formatText, "Output format: text or json")
+	slo := fs.Bool("slo", false, "Show the compliance and error budget of the probe slo over its window_days, or -since, instead of the runs")
+	loadLogger := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: enchante history [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format != formatText && *format != formatJSON {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		fs.Usage()
+		return 2
+	}
+
+	newLogger, err := loadLogger()
+	if err != nil {
+		return 2
+	}
+	cfg, err := config.LoadProfile(*configFile, *profile, newLogger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s is invalid: %v\n", *configFile, err)
+		return 1
+	}
+	if cfg.History.Backend == "" {
+		fmt.Fprintf(os.Stderr, "%s has no history configured\n", *configFile)
+		return 1
+	}
+	if *slo && !cfg.ProbingConfig.SLO.Enabled() {
+		fmt.Fprintf(os.Stderr, "%s has no slo configured\n", *configFile)
+		return 1
+	}
+
+	store, err := history.Open(cfg.History)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer store.Close()
+
+	query := history.Query{Instance: *instance, Limit: *limit}
+	if !*all {
+		query.Config = historyConfigName(cfg.History, *configFile, *profile)
+	}
+	if *since > 0 {
+		query.Since = time.Now().Add(-*since)
+	}
+	if *slo {
+		// the budget covers every run of the window
+		query.Limit = 0
+		if *since == 0 {
+			query.Since = time.Now().AddDate(0, 0, -cfg.ProbingConfig.SLO.Window())
+		}
+	}
+	runs, err := store.List(context.Background(), query)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *slo {
+		sloReport := history.SLOReport{Since: query.Since, Runs: len(runs), SLO: history.SLO(runs, cfg.ProbingConfig.SLO)}
+		err = writeOutput("-", func(w io.Writer) error {
+			if *format == formatJSON {
+				encoder := json.NewEncoder(w)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(sloReport)
+			}
+			fmt.Fprintf(w, "%d runs since %s\n\n", sloReport.Runs, sloReport.Since.Local().Format(time.DateTime))
+			return report.WriteSLO(w, sloReport.SLO)
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	entries := history.Entries(runs)
+	err = writeOutput("-", func(w io.Writer) error {
+		if *format == formatJSON {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(entries)
+		}
+		return history.WriteText(w, entries)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// historyConfigName returns the name the runs of a config are grouped by in the history, the configured name or the
+// config file path and its profile
+func historyConfigName(cfg config.HistoryConfig, configFile, profile string) string {
+	if profile != "" {
+		configFile += "#" + profile
+	}
+	return cmp.Or(cfg.Name, configFile)
+}
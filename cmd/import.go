@@ -0,0 +1,189 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/importer"
+)
+
+// importUsage lists the formats a config can be imported from
+const importUsage = `Usage: enchante import <format> [flags] <file>
+
+Formats:
+  har       a HAR file of a session recorded in the browser
+  openapi   an OpenAPI 3 or Swagger 2 spec in YAML or JSON
+  curl      curl commands, given as an argument or on stdin with -`
+
+// runImport generates a config file from recorded traffic or an API spec and returns the exit code
+func runImport(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, importUsage)
+		return 2
+	}
+	switch args[0] {
+	case "har":
+		return runImportHAR(args[1:])
+	case "openapi":
+		return runImportOpenAPI(args[1:])
+	case "curl":
+		return runImportCurl(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown import format %q\n\n%s\n", args[0], importUsage)
+		return 2
+	}
+}
+
+// runImportHAR generates a config file from the requests of a HAR file and returns the exit code
+func runImportHAR(args []string) int {
+	fs := flag.NewFlagSet("import har", flag.ContinueOnError)
+	hosts := fs.String("hosts", "", "Comma separated hosts to import the requests of, defaults to all hosts")
+	static := fs.Bool("static", false, "Also import the requests of static assets like scripts, stylesheets, images and fonts")
+	output := fs.String("output", "imported_config.yaml", "Path to write the generated config to, use - for stdout")
+	loadLogger := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: enchante import har [flags] <file.har>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	opts := importer.HAROptions{Hosts: splitList(*hosts), Static: *static}
+
+	newLogger, err := loadLogger()
+	if err != nil {
+		return 2
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		newLogger.Error("Failed to open HAR file", "error", err)
+		return 1
+	}
+	defer file.Close()
+	endpoints, err := importer.HAR(file, opts, newLogger)
+	if err != nil {
+		newLogger.Error("Failed to import HAR file", "file", fs.Arg(0), "error", err)
+		return 1
+	}
+	return writeImported(*output, endpoints, newLogger)
+}
+
+// runImportOpenAPI generates a config file from the operations of an OpenAPI spec and returns the exit code
+func runImportOpenAPI(args []string) int {
+	fs := flag.NewFlagSet("import openapi", flag.ContinueOnError)
+	baseURL := fs.String("base-url", "", "URL the paths are appended to, defaults to the first server of the spec")
+	tags := fs.String("tags", "", "Comma separated tags to import the operations of, defaults to all operations")
+	output := fs.String("output", "imported_config.yaml", "Path to write the generated config to, use - for stdout")
+	loadLogger := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: enchante import openapi [flags] <spec.yaml>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	newLogger, err := loadLogger()
+	if err != nil {
+		return 2
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		newLogger.Error("Failed to read OpenAPI spec", "error", err)
+		return 1
+	}
+	endpoints, err := importer.OpenAPI(data, importer.OpenAPIOptions{BaseURL: *baseURL, Tags: splitList(*tags)}, newLogger)
+	if err != nil {
+		newLogger.Error("Failed to import OpenAPI spec", "file", fs.Arg(0), "error", err)
+		return 1
+	}
+	return writeImported(*output, endpoints, newLogger)
+}
+
+// runImportCurl generates a config file from curl commands and returns the exit code
+func runImportCurl(args []string) int {
+	fs := flag.NewFlagSet("import curl", flag.ContinueOnError)
+	output := fs.String("output", "imported_config.yaml", "Path to write the generated config to, use - for stdout")
+	loadLogger := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), `Usage: enchante import curl [flags] "curl ..." | -`)
+		fmt.Fprintln(fs.Output(), "With - the commands are read from stdin, e.g. several commands copied from the browser.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	newLogger, err := loadLogger()
+	if err != nil {
+		return 2
+	}
+
+	command := fs.Arg(0)
+	switch {
+	case fs.NArg() == 1 && command == "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			newLogger.Error("Failed to read curl commands", "error", err)
+			return 1
+		}
+		command = string(data)
+	case fs.NArg() > 1:
+		// a command split into arguments by the shell, e.g. after --
+		command = importer.ShellJoin(fs.Args())
+	}
+	endpoints, err := importer.Curl(command, newLogger)
+	if err != nil {
+		newLogger.Error("Failed to import curl command", "error", err)
+		return 1
+	}
+	return writeImported(*output, endpoints, newLogger)
+}
+
+// writeImported writes the imported endpoints as a config file and returns the exit code
+func writeImported(output string, endpoints []config.Endpoint, newLogger *slog.Logger) int {
+	if len(endpoints) == 0 {
+		newLogger.Warn("No endpoints were imported, no config written")
+		return 0
+	}
+	err := writeOutput(output, func(w io.Writer) error {
+		return config.WriteEndpoints(w, endpoints)
+	})
+	if err != nil {
+		newLogger.Error("Failed to write imported config", "file", output, "error", err)
+		return 1
+	}
+	newLogger.Info("Imported config written", "file", output, "endpoints", len(endpoints))
+	return 0
+}
+
+// splitList returns the non-empty items of a comma separated flag value
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
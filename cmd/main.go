@@ -1,44 +1,133 @@
 package main
 
 import (
-	"context"
 	"flag"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"os/signal"
-	"syscall"
+	"runtime"
+	"runtime/debug"
+	"strings"
 
-	"github.com/dasvh/enchante/internal/config"
 	"github.com/dasvh/enchante/internal/logger"
-	"github.com/dasvh/enchante/internal/probe"
 )
 
+// version is set at build time with -ldflags "-X main.version=v1.2.3", it falls back to the module version
+var version string
+
+// usage describes the subcommands
+const usage = `Usage: enchante <command> [flags]
+
+Commands:
+  run           run the probe from a configuration file or against a single URL, the default command
+  daemon        run the probe on the schedule of a configuration file and serve its health
+  validate      check a configuration file without sending requests
+  doctor        check the local environment against a configuration file
+  sweep         check the routing, allowed methods and CORS headers of the endpoints
+  schema        print the JSON Schema of the configuration file
+  report        render a JSON run report as text, summary or benchmark results, or compare two with tolerances
+  diff          compare two JSON run reports, like report compare
+  history       list the past runs of a configuration and their latency trend
+  discover      generate a config from the services of a platform
+  import        generate a config from a HAR file, an OpenAPI spec or curl commands
+  record        record the requests passing through a forward or reverse proxy into a config
+  serve-test    run a local test server with configurable latency and errors
+  worker        run a worker generating the load of distributed runs
+  version       print the version
+
+Run 'enchante <command> -h' for the flags of a command.`
+
 func main() {
-	debug := flag.Bool("debug", false, "Enable debug logging")
-	configFile := flag.String("config", "probe_config.yaml", "Path to the probe configuration file")
-	flag.Parse()
+	os.Exit(dispatch(os.Args[1:]))
+}
 
-	newLogger := logger.NewLogger(*debug)
-	newLogger.Info("Starting probe service", "debug_enabled", *debug)
+// dispatch runs the subcommand given by the first argument and returns the exit code. Without a subcommand, e.g.
+// when the first argument is a flag or a URL, the probe is run for backwards compatibility and quick checks
+func dispatch(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") || strings.Contains(args[0], "://") {
+		return runProbe(args)
+	}
 
-	cfg, err := config.LoadConfig(*configFile, newLogger)
-	if err != nil {
-		newLogger.Error("Failed to load config", "error", err)
-		os.Exit(1)
+	switch args[0] {
+	case "run":
+		return runProbe(args[1:])
+	case "daemon":
+		return runDaemon(args[1:])
+	case "validate":
+		return runValidate(args[1:])
+	case "doctor":
+		return runDoctor(args[1:])
+	case "sweep":
+		return runSweep(args[1:])
+	case "schema":
+		return runSchema(args[1:])
+	case "report":
+		return runReport(args[1:])
+	case "diff":
+		return runDiff(args[1:])
+	case "history":
+		return runHistory(args[1:])
+	case "discover":
+		return runDiscover(args[1:])
+	case "import":
+		return runImport(args[1:])
+	case "record", "record-proxy": // record-proxy is the former name of record
+		return runRecord(args[1:])
+	case "serve-test":
+		return runServeTest(args[1:])
+	case "worker":
+		return runWorker(args[1:])
+	case "version":
+		fmt.Printf("enchante %s %s\n", buildVersion(), runtime.Version())
+		return 0
+	case "help":
+		fmt.Println(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", args[0], usage)
+		return 2
 	}
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// buildVersion returns the version set at build time, the module version for go install builds, or dev
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
 
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+// writeOutput calls write with the given file, or with stdout for "-"
+func writeOutput(filename string, write func(w io.Writer) error) error {
+	if filename == "-" {
+		return write(os.Stdout)
+	}
 
-	go func() {
-		<-signalChan
-		newLogger.Warn("Shutdown signal received, exiting gracefully...")
-		cancel()
-	}()
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	defer f.Close()
 
-	probe.RunProbe(ctx, cfg, newLogger)
+	return write(f)
+}
 
-	newLogger.Info("Probe execution completed")
+// addLogFlags adds the -debug, -log-format and -no-color flags to fs and returns the function creating the logger from
+// them once the flags are parsed, it reports an invalid flag on stderr
+func addLogFlags(fs *flag.FlagSet) func() (*slog.Logger, error) {
+	debug := fs.Bool("debug", false, "Enable debug logging")
+	logFormat := fs.String("log-format", logger.FormatText, "Log format, text or json for log collectors like Loki and ELK")
+	noColor := fs.Bool("no-color", false, "Disable the colors of the text logs, also disabled when stderr is not a terminal or NO_COLOR is set")
+	return func() (*slog.Logger, error) {
+		newLogger, err := logger.New(os.Stderr, logger.Options{Debug: *debug, Format: *logFormat, NoColor: *noColor})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return nil, err
+		}
+		return newLogger, nil
+	}
 }
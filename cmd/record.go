@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/recorder"
+)
+
+// runRecord runs a proxy recording the requests made through it until interrupted, then writes them as endpoints to
+// a new config file and returns the exit code. With a target it is also a reverse proxy for the target
+func runRecord(args []string) int {
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	listen := fs.String("listen", "localhost:8888", "Address the proxy listens on")
+	output := fs.String("output", "recorded_config.yaml", "Path to write the recorded config to, use - for stdout")
+	fs.StringVar(output, "out", *output, "Alias of -output")
+	target := fs.String("target", "", "URL the requests made to the proxy directly are forwarded to, e.g. https://api.example.com, "+
+		"records as a reverse proxy in addition to the forward proxy")
+	loadLogger := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: enchante record [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	newLogger, err := loadLogger()
+	if err != nil {
+		return 2
+	}
+	rec := recorder.New(http.DefaultTransport, newLogger)
+	if *target != "" {
+		targetURL, err := url.Parse(*target)
+		if err != nil || targetURL.Scheme == "" || targetURL.Host == "" {
+			fmt.Fprintf(os.Stderr, "invalid -target %q, expected an absolute URL like https://api.example.com\n", *target)
+			return 2
+		}
+		rec = recorder.NewReverse(targetURL, http.DefaultTransport, newLogger)
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		newLogger.Error("Failed to start proxy", "listen", *listen, "error", err)
+		return 1
+	}
+	server := &http.Server{Handler: rec}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			newLogger.Error("Proxy stopped", "error", err)
+		}
+	}()
+	attrs := []any{"proxy", "http://" + listener.Addr().String(), "output", *output}
+	if *target != "" {
+		attrs = append(attrs, "target", *target)
+	}
+	newLogger.Info("Recording requests, press Ctrl+C to write the config", attrs...)
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	<-signalChan
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		newLogger.Warn("Failed to shut down proxy", "error", err)
+	}
+
+	endpoints := rec.Endpoints()
+	if len(endpoints) == 0 {
+		newLogger.Warn("No requests were recorded, no config written")
+		return 0
+	}
+	err = writeOutput(*output, func(w io.Writer) error {
+		return config.WriteEndpoints(w, endpoints)
+	})
+	if err != nil {
+		newLogger.Error("Failed to write recorded config", "file", *output, "error", err)
+		return 1
+	}
+	newLogger.Info("Recorded config written", "file", *output, "endpoints", len(endpoints))
+	return 0
+}
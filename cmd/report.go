@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// report output formats
+const (
+	formatText    = "text"
+	formatSummary = "summary"
+	formatBench   = "bench"
+	formatJSON    = "json"
+)
+
+// runReport renders a JSON run report in another format, or compares two reports, and returns the exit code
+func runReport(args []string) int {
+	if len(args) > 0 && args[0] == "compare" {
+		return runCompare("report compare", "Usage: enchante report compare [flags] baseline.json current.json", args[1:])
+	}
+
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	format := fs.String("format", formatText, "Output format: text, summary, bench or json")
+	output := fs.String("output", "-", "Path to write the rendered report to, use - for stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: enchante report [flags] run.json\n       enchante report compare [flags] baseline.json current.json")
+		fs.PrintDefaults()
+	}
+
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(files) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var write func(w io.Writer, r *report.Report) error
+	switch *format {
+	case formatText:
+		write = report.WriteTable
+	case formatSummary:
+		write = report.WriteSummary
+	case formatBench:
+		write = report.WriteBenchmark
+	case formatJSON:
+		write = report.WriteJSON
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		fs.Usage()
+		return 2
+	}
+
+	runReport, err := report.Load(files[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	err = writeOutput(*output, func(w io.Writer) error {
+		return write(w, runReport)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/dasvh/enchante/internal/auth"
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/distributed"
+	"github.com/dasvh/enchante/internal/history"
+	"github.com/dasvh/enchante/internal/importer"
+	"github.com/dasvh/enchante/internal/kube"
+	"github.com/dasvh/enchante/internal/probe"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// exitFailed is the exit code of a run in which requests failed, errors that prevent or abort a run exit with 1
+const exitFailed = 3
+
+// runProbe runs the probe with the configuration file and returns the exit code
+func runProbe(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	loadLogger := addLogFlags(fs)
+	configFile := fs.String("config", "probe_config.yaml", "Path to the probe configuration file, a directory or a comma separated list of them")
+	profile := fs.String("profile", "", "Name of the profile of the configuration file to apply, e.g. staging")
+	reportFile := fs.String("report", "", "Path to write the JSON run report to, use - for stdout")
+	summaryFile := fs.String("summary-json", "", "Path to write a single-line JSON summary to, use - for stdout")
+	benchFile := fs.String("bench", "", "Path to append the results per endpoint to in the Go benchmark format, use - for stdout")
+	samplesFile := fs.String("samples", "", "Path to write the raw result of every request to as NDJSON, overrides samples_file")
+	auditFile := fs.String("audit", "", "Path to write the details of every request and response to as NDJSON, overrides audit.file")
+	totalRequests := fs.Int("n", 0, "Number of iterations, overrides total_requests, 1 for a single URL")
+	concurrency := fs.Int("c", 0, "Number of concurrent workers, overrides concurrent_requests, 1 for a single URL")
+	seed := fs.Int64("seed", 0, "Seed of the random delays and think times to replay a run, overrides seed")
+	controlAddr := fs.String("control-addr", "", "Address to serve the control API on during the run, e.g. localhost:9091, overrides control.listen")
+	workers := fs.String("workers", "", "Comma separated addresses of enchante workers to distribute the run to, e.g. load-1:9000,load-2:9000")
+	jobReplicas := fs.Int("k8s-replicas", 0, "Number of enchante workers to distribute the run to as the pods of a Kubernetes Job")
+	jobImage := fs.String("k8s-image", "", "Container image of enchante run by the Kubernetes workers")
+	jobNamespace := fs.String("k8s-namespace", "", "Namespace of the Kubernetes Job, defaults to the namespace of the context")
+	kubeconfig := fs.String("k8s-kubeconfig", kube.DefaultKubeconfig(), "Path to the kubeconfig file")
+	kubeContext := fs.String("k8s-context", "", "Kubeconfig context to use, defaults to the current context")
+	jobCPU := fs.String("k8s-cpu", "", "CPU request and limit of every Kubernetes worker, e.g. 500m")
+	jobMemory := fs.String("k8s-memory", "", "Memory request and limit of every Kubernetes worker, e.g. 256Mi")
+	jobServiceAccount := fs.String("k8s-service-account", "", "Service account of the Kubernetes workers")
+	jobKeep := fs.Bool("k8s-keep", false, "Keep the Kubernetes Job and its Secret after the run for inspection")
+	printCurl := fs.Bool("print-curl", false, "Print the requests of the endpoints and scenario steps as curl commands instead of running the probe")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: enchante run [flags] [url]")
+		fmt.Fprintln(fs.Output(), "With a URL it is requested with GET without a configuration file.")
+		fs.PrintDefaults()
+	}
+	targets, err := parseInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(targets) > 1 {
+		fs.Usage()
+		return 2
+	}
+	if *workers != "" && *jobReplicas > 0 {
+		fmt.Fprintln(os.Stderr, "-workers and -k8s-replicas can not be combined")
+		return 2
+	}
+
+	// logs go to stderr, so stdout stays clean for reports and summaries
+	newLogger, err := loadLogger()
+	if err != nil {
+		return 2
+	}
+	newLogger.Info("Starting probe service", "debug_enabled", newLogger.Enabled(context.Background(), slog.LevelDebug))
+
+	var cfg *config.Config
+	if len(targets) == 1 {
+		cfg, err = config.QuickConfig(targets[0], cmp.Or(*totalRequests, 1), cmp.Or(*concurrency, 1), newLogger)
+	} else {
+		cfg, err = config.LoadProfile(*configFile, *profile, newLogger)
+	}
+	if err != nil {
+		newLogger.Error("Failed to load config", "error", err)
+		return 1
+	}
+	if *totalRequests > 0 {
+		cfg.ProbingConfig.TotalRequests = *totalRequests
+	}
+	if *concurrency > 0 {
+		cfg.ProbingConfig.ConcurrentRequests = *concurrency
+	}
+	if *seed != 0 {
+		cfg.ProbingConfig.Seed = *seed
+	}
+	if *samplesFile != "" {
+		cfg.ProbingConfig.SamplesFile = *samplesFile
+	}
+	if *auditFile != "" {
+		cfg.ProbingConfig.Audit.File = *auditFile
+	}
+	if *controlAddr != "" {
+		cfg.ProbingConfig.Control.Listen = *controlAddr
+	}
+	if *printCurl {
+		return printCurlCommands(os.Stdout, cfg, newLogger)
+	}
+	if cfg.ProbingConfig.Mode == config.ModeFindMax && (*workers != "" || *jobReplicas > 0) {
+		fmt.Fprintf(os.Stderr, "mode %s can not be distributed to workers\n", config.ModeFindMax)
+		return 2
+	}
+	if cfg.ProbingConfig.Engine.Replays() && (*workers != "" || *jobReplicas > 0) {
+		fmt.Fprintf(os.Stderr, "engine model %s can not be distributed to workers\n", config.EngineReplay)
+		return 2
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signalChan
+		newLogger.Warn("Shutdown signal received, exiting gracefully...")
+		cancel()
+	}()
+
+	var result *probe.ProbeResult
+	switch {
+	case cfg.ProbingConfig.Mode == config.ModeFindMax:
+		result, err = probe.FindMax(ctx, cfg, newLogger)
+	case *workers != "":
+		result, err = distributed.Run(ctx, cfg, distributed.Options{
+			Workers: strings.Split(*workers, ","),
+			Token:   os.Getenv(distributed.TokenEnv),
+		}, newLogger)
+	case *jobReplicas > 0:
+		result, err = distributed.RunJob(ctx, cfg, distributed.JobOptions{
+			Kubeconfig:     *kubeconfig,
+			Context:        *kubeContext,
+			Namespace:      *jobNamespace,
+			Image:          *jobImage,
+			Replicas:       *jobReplicas,
+			CPU:            *jobCPU,
+			Memory:         *jobMemory,
+			ServiceAccount: *jobServiceAccount,
+			Keep:           *jobKeep,
+		}, newLogger)
+	default:
+		result, err = probe.RunProbe(ctx, cfg, newLogger)
+	}
+	if err != nil {
+		newLogger.Error("Failed to run probe", "error", err)
+		return 1
+	}
+	runReport := result.Report
+
+	if *reportFile != "" {
+		err := writeOutput(*reportFile, func(w io.Writer) error {
+			return report.WriteJSON(w, runReport)
+		})
+		if err != nil {
+			newLogger.Error("Failed to write report", "file", *reportFile, "error", err)
+			return 1
+		}
+		newLogger.Info("Report written", "file", *reportFile)
+	}
+
+	if *summaryFile != "" {
+		err := writeOutput(*summaryFile, func(w io.Writer) error {
+			return report.WriteSummary(w, runReport)
+		})
+		if err != nil {
+			newLogger.Error("Failed to write summary", "file", *summaryFile, "error", err)
+			return 1
+		}
+	}
+
+	if *benchFile != "" {
+		if err := writeBenchmark(*benchFile, runReport); err != nil {
+			newLogger.Error("Failed to write benchmark results", "file", *benchFile, "error", err)
+			return 1
+		}
+	}
+
+	if cfg.History.Backend != "" {
+		configName := historyConfigName(cfg.History, *configFile, *profile)
+		if len(targets) == 1 {
+			configName = cmp.Or(cfg.History.Name, targets[0])
+		}
+		if err := saveHistory(cfg.History, configName, runReport); err != nil {
+			newLogger.Error("Failed to save run to history", "backend", cfg.History.Backend, "error", err)
+			return 1
+		}
+		newLogger.Info("Run saved to history", "backend", cfg.History.Backend, "run_id", runReport.RunID, "config", configName)
+	}
+
+	newLogger.Info("Probe execution completed")
+	if result.Failed() {
+		return exitFailed
+	}
+	return 0
+}
+
+// saveHistory stores the run report in the configured history storage, grouped with the earlier runs of the config
+func saveHistory(cfg config.HistoryConfig, configName string, runReport *report.Report) error {
+	store, err := history.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	// the run may have been cancelled, it is saved regardless
+	return store.Save(context.Background(), history.NewRun(runReport, history.Instance(cfg), configName))
+}
+
+// writeBenchmark appends the benchmark results of the run to the file, so repeated runs collect the samples benchstat
+// compares, or writes them to stdout for "-"
+func writeBenchmark(filename string, runReport *report.Report) error {
+	if filename == "-" {
+		return report.WriteBenchmark(os.Stdout, runReport)
+	}
+
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening benchmark file: %w", err)
+	}
+	defer f.Close()
+
+	return report.WriteBenchmark(f, runReport)
+}
+
+// printCurlCommands writes a curl command for every endpoint and scenario step, with its auth header, to debug
+// configured requests outside the probe. Captured variables are left as they are configured
+func printCurlCommands(w io.Writer, cfg *config.Config, newLogger *slog.Logger) int {
+	credentials := make(map[*config.AuthConfig][2]string)
+	command := func(endpoint config.Endpoint) (string, error) {
+		headers := maps.Clone(endpoint.Headers)
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		authConfig := cmp.Or(endpoint.AuthConfig, &cfg.Auth)
+		if authConfig.Enabled {
+			credential, ok := credentials[authConfig]
+			if !ok {
+				header, value, err := auth.GetAuthHeader(authConfig, newLogger)
+				if err != nil {
+					return "", err
+				}
+				credential = [2]string{header, value}
+				credentials[authConfig] = credential
+			}
+			if credential[0] != "" {
+				headers[credential[0]] = credential[1]
+			}
+		}
+		return importer.CurlCommand(endpoint, headers), nil
+	}
+
+	for _, endpoint := range cfg.ProbingConfig.Endpoints {
+		line, err := command(endpoint)
+		if err != nil {
+			newLogger.Error("Failed to get auth header", "url", endpoint.URL, "error", err)
+			return 1
+		}
+		fmt.Fprintln(w, line)
+	}
+	for _, scenario := range cfg.ProbingConfig.Scenarios {
+		for _, step := range scenario.Steps {
+			line, err := command(step.Endpoint)
+			if err != nil {
+				newLogger.Error("Failed to get auth header", "url", step.URL, "error", err)
+				return 1
+			}
+			fmt.Fprintf(w, "# scenario %s, step %s\n%s\n", scenario.Name, step.Name, line)
+		}
+	}
+	return 0
+}
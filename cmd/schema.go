@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// runSchema writes the JSON Schema of the configuration file and returns the exit code
+func runSchema(args []string) int {
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	output := fs.String("output", "-", "Path to write the schema to, use - for stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: enchante schema [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	schema, err := config.JSONSchema()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	err = writeOutput(*output, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "%s\n", schema)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dasvh/enchante/internal/testserver"
+)
+
+// runServeTest runs a local test server with configurable latency and errors until interrupted and returns the exit
+// code
+func runServeTest(args []string) int {
+	fs := flag.NewFlagSet("serve-test", flag.ContinueOnError)
+	listen := fs.String("listen", "localhost:8080", "Address the test server listens on")
+	latency := fs.Duration("latency", 50*time.Millisecond, "Time every response takes")
+	jitter := fs.Duration("jitter", 0, "Random offset of up to +/- this duration added to the latency")
+	errorRate := fs.Float64("error-rate", 0, "Share of requests failed with the error status, between 0 and 1")
+	errorStatus := fs.Int("error-status", testserver.DefaultErrorStatus, "Status code of the failed requests")
+	seed := fs.Int64("seed", 0, "Seed of the random latencies and errors, a random seed is used when 0")
+	loadLogger := addLogFlags(fs)
+	fs.Lookup("debug").Usage = "Enable debug logging, every request is logged"
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: enchante serve-test [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *errorRate < 0 || *errorRate > 1 {
+		fmt.Fprintln(os.Stderr, "-error-rate must be between 0 and 1")
+		return 2
+	}
+
+	newLogger, err := loadLogger()
+	if err != nil {
+		return 2
+	}
+	server := testserver.New(testserver.Options{
+		Latency:     *latency,
+		Jitter:      *jitter,
+		ErrorRate:   *errorRate,
+		ErrorStatus: *errorStatus,
+		Seed:        *seed,
+	}, newLogger)
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		newLogger.Error("Failed to start test server", "listen", *listen, "error", err)
+		return 1
+	}
+	httpServer := &http.Server{Handler: server}
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			newLogger.Error("Test server stopped", "error", err)
+		}
+	}()
+	newLogger.Info("Test server running, press Ctrl+C to stop",
+		"url", "http://"+listener.Addr().String(),
+		"latency", *latency,
+		"jitter", *jitter,
+		"error_rate", *errorRate)
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	<-signalChan
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		newLogger.Warn("Failed to shut down test server", "error", err)
+	}
+	newLogger.Info("Test server stopped", "requests", server.Requests())
+	return 0
+}
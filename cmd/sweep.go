@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/probe"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// runSweep sends a HEAD and an OPTIONS request to every endpoint of a configuration file and returns the exit code,
+// 1 when an endpoint is not routed or its method is not allowed
+func runSweep(args []string) int {
+	fs := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	configFile := fs.String("config", "probe_config.yaml", "Path to the probe configuration file, a directory or a comma separated list of them")
+	profile := fs.String("profile", "", "Name of the profile of the configuration file to apply, e.g. staging")
+	origin := fs.String("origin", "", "Origin of the CORS preflight requests, without it plain OPTIONS requests are sent")
+	format := fs.String("format", formatText, "Output format: text or json")
+	loadLogger := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: enchante sweep [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format != formatText && *format != formatJSON {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		fs.Usage()
+		return 2
+	}
+
+	newLogger, err := loadLogger()
+	if err != nil {
+		return 2
+	}
+	cfg, err := config.LoadProfile(*configFile, *profile, newLogger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s is invalid: %v\n", *configFile, err)
+		return 1
+	}
+
+	results, err := probe.Sweep(context.Background(), cfg, probe.SweepOptions{Origin: *origin}, newLogger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *format == formatJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+	} else {
+		err = report.WriteSweep(os.Stdout, results)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if report.SweepFailed(results) {
+		return 1
+	}
+	return 0
+}
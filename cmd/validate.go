@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// runValidate loads and validates a configuration file without sending requests and returns the exit code
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	configFile := fs.String("config", "probe_config.yaml", "Path to the probe configuration file, a directory or a comma separated list of them")
+	profile := fs.String("profile", "", "Name of the profile of the configuration file to apply, e.g. staging")
+	loadLogger := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: enchante validate [flags] [config.yaml...]")
+		fs.PrintDefaults()
+	}
+
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	// several files are merged into one config
+	if len(files) > 0 {
+		*configFile = strings.Join(files, ",")
+	}
+
+	newLogger, err := loadLogger()
+	if err != nil {
+		return 2
+	}
+	cfg, err := config.LoadProfile(*configFile, *profile, newLogger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s is invalid: %v\n", *configFile, err)
+		return 1
+	}
+
+	fmt.Printf("%s is valid: %d endpoints, %d scenarios\n", *configFile, len(cfg.ProbingConfig.Endpoints), len(cfg.ProbingConfig.Scenarios))
+	return 0
+}
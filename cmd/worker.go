@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/distributed"
+)
+
+// runWorker runs a worker of distributed runs until interrupted and returns the exit code
+func runWorker(args []string) int {
+	fs := flag.NewFlagSet("worker", flag.ContinueOnError)
+	listen := fs.String("listen", "127.0.0.1:9000", "Address the worker listens on for the coordinator, other addresses than localhost require a token")
+	tlsCert := fs.String("tls-cert", "", "Path to the TLS certificate to serve the control protocol over HTTPS")
+	tlsKey := fs.String("tls-key", "", "Path to the private key of the TLS certificate")
+	runFile := fs.String("run-file", "", "Path to a run request to run once instead of listening, writing the result to stdout")
+	index := fs.Int("index", -1, "Index of the share of the run file, defaults to $JOB_COMPLETION_INDEX of a Kubernetes Job")
+	loadLogger := addLogFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: enchante worker [flags]")
+		fmt.Fprintf(fs.Output(), "Coordinators authenticate with the token of %s, which is required to listen on other addresses than localhost.\n", distributed.TokenEnv)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fmt.Fprintln(os.Stderr, "-tls-cert and -tls-key must be given together")
+		return 2
+	}
+
+	newLogger, err := loadLogger()
+	if err != nil {
+		return 2
+	}
+	if *runFile != "" {
+		return runWorkerOnce(*runFile, *index, newLogger)
+	}
+
+	token := os.Getenv(distributed.TokenEnv)
+	if token == "" {
+		host, _, err := net.SplitHostPort(*listen)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -listen address %q: %v\n", *listen, err)
+			return 2
+		}
+		if !config.IsLoopback(host) {
+			// anyone reaching the worker could otherwise start runs against any target
+			newLogger.Error("No worker token set, a token is required to listen on other addresses than localhost",
+				"env", distributed.TokenEnv, "listen", *listen)
+			return 2
+		}
+		newLogger.Warn("No worker token set, any local process can start runs", "env", distributed.TokenEnv)
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		newLogger.Error("Failed to start worker", "listen", *listen, "error", err)
+		return 1
+	}
+	httpServer := &http.Server{Handler: distributed.NewWorker(token, newLogger), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		var err error
+		if *tlsCert != "" {
+			err = httpServer.ServeTLS(listener, *tlsCert, *tlsKey)
+		} else {
+			err = httpServer.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			newLogger.Error("Worker stopped", "error", err)
+		}
+	}()
+	newLogger.Info("Worker waiting for runs, press Ctrl+C to stop", "listen", listener.Addr().String(), "tls", *tlsCert != "")
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	<-signalChan
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		// closing the connection of the coordinator cancels the running share
+		newLogger.Warn("Failed to shut down worker, cancelling the running share", "error", err)
+		httpServer.Close()
+	}
+	newLogger.Info("Worker stopped")
+	return 0
+}
+
+// runWorkerOnce runs the share of a run file, e.g. in the pod of a Kubernetes Job, and writes the result to stdout
+// where the coordinator reads it from the logs
+func runWorkerOnce(runFile string, index int, newLogger *slog.Logger) int {
+	data, err := os.ReadFile(runFile)
+	if err != nil {
+		newLogger.Error("Failed to read run file", "error", err)
+		return 1
+	}
+	var req distributed.RunRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		newLogger.Error("Failed to decode run file", "file", runFile, "error", err)
+		return 1
+	}
+	req.Index = index
+	if index < 0 {
+		if req.Index, err = strconv.Atoi(os.Getenv("JOB_COMPLETION_INDEX")); err != nil {
+			newLogger.Error("No share index given, use -index or run in an indexed Kubernetes Job")
+			return 2
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	newLogger.Info("Starting share of distributed run", "run_id", req.RunID, "worker", req.Index+1, "workers", req.Count)
+	part, err := distributed.RunShare(ctx, req, newLogger)
+	if err != nil {
+		newLogger.Error("Failed to run share of distributed run", "run_id", req.RunID, "error", err)
+		return 1
+	}
+	if ctx.Err() != nil {
+		newLogger.Warn("Share of distributed run cancelled", "run_id", req.RunID)
+		return 1
+	}
+	if err := distributed.WriteResult(os.Stdout, part); err != nil {
+		newLogger.Error("Failed to write result", "error", err)
+		return 1
+	}
+	newLogger.Info("Share of distributed run completed", "run_id", req.RunID,
+		"successful_requests", part.Report.SuccessfulRequests, "failed_requests", part.Report.FailedRequests)
+	return 0
+}
@@ -0,0 +1,212 @@
+// Package accesslog reads the requests of web server access logs in the common, combined and JSON formats
+package accesslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// access log formats
+const (
+	// FormatCommon is the Common Log Format of Apache and nginx
+	FormatCommon = "common"
+	// FormatCombined is the Common Log Format followed by the referer and user agent, it also reads common logs
+	FormatCombined = "combined"
+	// FormatJSON is one JSON object per line, like the JSON log formats of nginx, Caddy and Traefik
+	FormatJSON = "json"
+)
+
+// Formats are the supported access log formats
+var Formats = []string{FormatCommon, FormatCombined, FormatJSON}
+
+// clfTime is the layout of the time of the Common Log Format
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// clfLine matches a line of the Common Log Format, optionally followed by the referer and user agent
+var clfLine = regexp.MustCompile(`^\S+ \S+ \S+ \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (?:\d{3}|-) \S+`)
+
+// JSON fields read from JSON logs, the first field set is used
+var (
+	jsonTimeFields    = []string{"time", "timestamp", "@timestamp", "time_local", "time_iso8601", "ts", "start_time"}
+	jsonMethodFields  = []string{"method", "request_method", "RequestMethod"}
+	jsonPathFields    = []string{"path", "uri", "request_uri", "url", "RequestPath"}
+	jsonRequestFields = []string{"request", "request_line"}
+)
+
+// Entry is a request of an access log
+type Entry struct {
+	// Time is when the request was logged
+	Time   time.Time
+	Method string
+	// Path is the path and query of the request, e.g. /items?page=2
+	Path string
+}
+
+// Parse returns the requests of an access log in the order they were logged. Lines that can not be parsed, e.g.
+// malformed requests or lines of another format, are skipped and counted in a warning
+func Parse(r io.Reader, format string, logger *slog.Logger) ([]Entry, error) {
+	var parse func(string) (Entry, error)
+	switch format {
+	case FormatCommon, FormatCombined:
+		parse = parseCLF
+	case FormatJSON:
+		parse = parseJSON
+	default:
+		return nil, fmt.Errorf("unknown access log format %q, expected one of %s", format, strings.Join(Formats, ", "))
+	}
+
+	var entries []Entry
+	skipped := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		entry, err := parse(text)
+		if err != nil {
+			logger.Debug("Access log line skipped", "line", line, "error", err)
+			skipped++
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading access log: %w", err)
+	}
+	if skipped > 0 {
+		logger.Warn("Access log lines skipped, they could not be parsed", "format", format, "skipped", skipped, "parsed", len(entries))
+	}
+	// servers log a request when it completes, the requests are replayed in the order they arrived
+	slices.SortStableFunc(entries, func(a, b Entry) int { return a.Time.Compare(b.Time) })
+	return entries, nil
+}
+
+// parseCLF parses a line of the Common or Combined Log Format
+func parseCLF(line string) (Entry, error) {
+	match := clfLine.FindStringSubmatch(line)
+	if match == nil {
+		return Entry{}, fmt.Errorf("not in the common log format")
+	}
+	t, err := time.Parse(clfTime, match[1])
+	if err != nil {
+		return Entry{}, fmt.Errorf("invalid time %q", match[1])
+	}
+	method, path, err := parseRequestLine(match[2])
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{Time: t, Method: method, Path: path}, nil
+}
+
+// parseJSON parses a line of a JSON log
+func parseJSON(line string) (Entry, error) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return Entry{}, fmt.Errorf("not a JSON object")
+	}
+
+	var entry Entry
+	raw, ok := field(fields, jsonTimeFields)
+	if !ok {
+		return Entry{}, fmt.Errorf("no time field, expected one of %s", strings.Join(jsonTimeFields, ", "))
+	}
+	t, err := parseTime(raw)
+	if err != nil {
+		return Entry{}, err
+	}
+	entry.Time = t
+
+	method, hasMethod := field(fields, jsonMethodFields)
+	path, hasPath := field(fields, jsonPathFields)
+	if hasMethod && hasPath {
+		entry.Method, _ = method.(string)
+		rawPath, _ := path.(string)
+		if entry.Path, err = requestPath(rawPath); err != nil {
+			return Entry{}, err
+		}
+	} else if request, ok := field(fields, jsonRequestFields); ok {
+		requestLine, _ := request.(string)
+		if entry.Method, entry.Path, err = parseRequestLine(requestLine); err != nil {
+			return Entry{}, err
+		}
+	} else {
+		return Entry{}, fmt.Errorf("no method and path fields or request field")
+	}
+	if entry.Method == "" {
+		return Entry{}, fmt.Errorf("empty method")
+	}
+	entry.Method = strings.ToUpper(entry.Method)
+	return entry, nil
+}
+
+// parseRequestLine returns the method and path of a request line, e.g. GET /items HTTP/1.1
+func parseRequestLine(request string) (string, string, error) {
+	fields := strings.Fields(request)
+	if len(fields) < 2 {
+		return "", "", fmt.Errorf("invalid request line %q", request)
+	}
+	path, err := requestPath(fields[1])
+	if err != nil {
+		return "", "", err
+	}
+	return fields[0], path, nil
+}
+
+// requestPath returns the path and query of a logged request target, the target of a proxy request is an absolute URL
+func requestPath(target string) (string, error) {
+	if strings.HasPrefix(target, "/") {
+		return target, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid request target %q", target)
+	}
+	return u.RequestURI(), nil
+}
+
+// parseTime parses the time of a JSON log, an RFC 3339 or Common Log Format time, or a Unix time in seconds or
+// milliseconds
+func parseTime(raw any) (time.Time, error) {
+	switch v := raw.(type) {
+	case float64:
+		if v > 1e12 {
+			return time.UnixMilli(int64(v)), nil
+		}
+		seconds, fraction := math.Modf(v)
+		return time.Unix(int64(seconds), int64(fraction*1e9)), nil
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, nil
+		}
+		if t, err := time.Parse(clfTime, v); err == nil {
+			return t, nil
+		}
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+			return parseTime(seconds)
+		}
+		return time.Time{}, fmt.Errorf("invalid time %q", v)
+	}
+	return time.Time{}, fmt.Errorf("invalid time %v", raw)
+}
+
+// field returns the first of the fields that is set
+func field(fields map[string]any, names []string) (any, bool) {
+	for _, name := range names {
+		if value, ok := fields[name]; ok && value != nil {
+			return value, true
+		}
+	}
+	return nil, false
+}
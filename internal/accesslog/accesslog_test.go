@@ -0,0 +1,72 @@
+package accesslog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dasvh/enchante/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	start := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		format string
+		log    string
+		expect []Entry
+	}{
+		{
+			name:   "Combined",
+			format: FormatCombined,
+			log: `10.0.0.1 - ann [15/Oct/2026:12:00:01 +0200] "GET /items?page=2 HTTP/1.1" 200 512 "https://shop.example.com/" "Mozilla/5.0 (X11; Linux x86_64)"
+10.0.0.2 - - [15/Oct/2026:10:00:00 +0000] "POST /cart HTTP/2.0" 201 - "-" "curl/8.0"
+10.0.0.3 - - [15/Oct/2026:10:00:02 +0000] "\x16\x03\x01" 400 0 "-" "-"`,
+			expect: []Entry{
+				{Time: start, Method: "POST", Path: "/cart"},
+				{Time: start.Add(time.Second), Method: "GET", Path: "/items?page=2"},
+			},
+		},
+		{
+			name:   "Common",
+			format: FormatCommon,
+			log:    `10.0.0.1 - - [15/Oct/2026:10:00:00 +0000] "GET http://shop.example.com/search?q=a HTTP/1.1" 200 10`,
+			expect: []Entry{{Time: start, Method: "GET", Path: "/search?q=a"}},
+		},
+		{
+			name:   "JSON",
+			format: FormatJSON,
+			log: `{"time": "2026-10-15T10:00:00.5Z", "method": "get", "uri": "/items", "status": 200}
+{"timestamp": 1792058400, "request": "DELETE /items/1 HTTP/1.1"}
+{"@timestamp": "15/Oct/2026:10:00:01 +0000", "request_method": "PUT", "request_uri": "/items/2"}
+{"ts": 1792058401250, "method": "HEAD", "path": "/health"}
+{"message": "not an access log line"}
+not json`,
+			expect: []Entry{
+				{Time: time.Unix(1792058400, 0), Method: "DELETE", Path: "/items/1"},
+				{Time: start.Add(500 * time.Millisecond), Method: "GET", Path: "/items"},
+				{Time: start.Add(time.Second), Method: "PUT", Path: "/items/2"},
+				{Time: time.UnixMilli(1792058401250), Method: "HEAD", Path: "/health"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := Parse(strings.NewReader(tc.log), tc.format, testutil.Logger)
+			assert.NoError(t, err)
+			assert.Len(t, entries, len(tc.expect))
+			for i, entry := range entries {
+				assert.True(t, tc.expect[i].Time.Equal(entry.Time), "Expected %s, got %s", tc.expect[i].Time, entry.Time)
+				assert.Equal(t, tc.expect[i].Method+" "+tc.expect[i].Path, entry.Method+" "+entry.Path)
+			}
+		})
+	}
+}
+
+func TestParseUnknownFormat(t *testing.T) {
+	_, err := Parse(strings.NewReader(""), "w3c", testutil.Logger)
+	assert.EqualError(t, err, `unknown access log format "w3c", expected one of common, combined, json`)
+}
@@ -0,0 +1,233 @@
+// Package alert evaluates the alerts of the daemon after every run and notifies their webhook, Slack and email
+// channels when consecutive runs breach them, and optionally when they resolve
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/probe"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// notifyTimeout limits how long a channel may take to deliver a notification
+const notifyTimeout = 10 * time.Second
+
+// Statuses of an alert notification
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Run represents the outcome of a scheduled run the alerts are evaluated on
+type Run struct {
+	RunID       string
+	ScheduledAt time.Time
+	Passed      bool
+	// Error is set when the run could not be started
+	Error      string
+	ReportFile string
+	// Report is nil when the run could not be started
+	Report *report.Report
+}
+
+// Event represents an alert notification, it is the data of the templates and the default webhook payload
+type Event struct {
+	Alert    string `json:"alert"`
+	Status   string `json:"status"`
+	Instance string `json:"instance"`
+	// ConsecutiveRuns is the number of consecutive runs that breached the alert
+	ConsecutiveRuns int       `json:"consecutive_runs"`
+	RunID           string    `json:"run_id,omitempty"`
+	ScheduledAt     time.Time `json:"scheduled_at"`
+	// Error is set when the last run could not be started
+	Error string `json:"error,omitempty"`
+	// Breaches are the thresholds of the alert the last run breached
+	Breaches   []report.ThresholdResult `json:"breaches,omitempty"`
+	Summary    *report.Summary          `json:"summary,omitempty"`
+	ReportFile string                   `json:"report_file,omitempty"`
+}
+
+// notifier delivers the notifications of an alert to a channel
+type notifier interface {
+	// channel names the channel in the logs
+	channel() string
+	notify(ctx context.Context, event Event) error
+}
+
+// alert holds the state of a configured alert across runs
+type alert struct {
+	cfg       config.AlertConfig
+	notifiers []notifier
+	// breaches counts the consecutive runs that breached the alert
+	breaches int
+	firing   bool
+}
+
+// Manager evaluates the alerts after every run. It is safe for concurrent use
+type Manager struct {
+	alerts   []*alert
+	instance string
+	logger   *slog.Logger
+	mu       sync.Mutex
+}
+
+// New creates the manager of the configured alerts, instance names the probe in the notifications. It returns nil
+// without alerts
+func New(cfgs []config.AlertConfig, instance string, logger *slog.Logger) (*Manager, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	m := &Manager{instance: instance, logger: logger}
+	for _, cfg := range cfgs {
+		notifiers, err := newNotifiers(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("alert %s: %w", cfg.Name, err)
+		}
+		m.alerts = append(m.alerts, &alert{cfg: cfg, notifiers: notifiers})
+	}
+	return m, nil
+}
+
+// newNotifiers creates the notifiers of the configured channels of an alert
+func newNotifiers(cfg config.AlertConfig) ([]notifier, error) {
+	var notifiers []notifier
+	if cfg.Webhook.URL != "" {
+		n, err := newWebhook(cfg.Webhook)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	if cfg.Slack.WebhookURL != "" {
+		n, err := newSlack(cfg.Slack)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	if cfg.Email.SMTP != "" {
+		n, err := newEmail(cfg.Email)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	if len(notifiers) == 0 {
+		return nil, errors.New("no channel configured")
+	}
+	return notifiers, nil
+}
+
+// Observe evaluates the alerts on the outcome of a run. An alert fires once its consecutive_runs were breached and
+// notifies its channels, it resolves with the first run that does not breach it. Notifications are sent before
+// Observe returns, failures are logged
+func (m *Manager) Observe(ctx context.Context, run Run) {
+	if m == nil {
+		return
+	}
+	// a notification of the last run is sent also while the daemon shuts down
+	ctx = context.WithoutCancel(ctx)
+	for _, a := range m.alerts {
+		breaches, breached := evaluate(a.cfg, run)
+
+		m.mu.Lock()
+		consecutive := a.breaches
+		if breached {
+			a.breaches++
+			consecutive = a.breaches
+		} else {
+			a.breaches = 0
+		}
+		status := ""
+		switch {
+		case breached && !a.firing && a.breaches >= a.cfg.Runs():
+			a.firing = true
+			status = StatusFiring
+		case !breached && a.firing:
+			a.firing = false
+			if a.cfg.SendResolved {
+				status = StatusResolved
+			}
+		}
+		m.mu.Unlock()
+
+		if status == "" {
+			continue
+		}
+		event := Event{
+			Alert:           a.cfg.Name,
+			Status:          status,
+			Instance:        m.instance,
+			ConsecutiveRuns: consecutive,
+			RunID:           run.RunID,
+			ScheduledAt:     run.ScheduledAt,
+			Error:           run.Error,
+			Breaches:        breaches,
+			ReportFile:      run.ReportFile,
+		}
+		if run.Report != nil {
+			summary := run.Report.Summary()
+			event.Summary = &summary
+		}
+		m.notify(ctx, a, event)
+	}
+}
+
+// evaluate returns the breached thresholds of the alert and whether the run breached it. A run that could not be
+// started breaches every alert, and without thresholds a failed run does
+func evaluate(cfg config.AlertConfig, run Run) ([]report.ThresholdResult, bool) {
+	if run.Report == nil {
+		return nil, true
+	}
+	if len(cfg.Thresholds) == 0 {
+		return nil, !run.Passed
+	}
+	var breaches []report.ThresholdResult
+	for _, result := range probe.EvaluateThresholds(cfg.Thresholds, run.Report) {
+		if result.Breached {
+			breaches = append(breaches, result)
+		}
+	}
+	return breaches, len(breaches) > 0
+}
+
+// notify sends the event to every channel of the alert
+func (m *Manager) notify(ctx context.Context, a *alert, event Event) {
+	if event.Status == StatusFiring {
+		m.logger.Error("Alert firing", "alert", event.Alert, "consecutive_runs", event.ConsecutiveRuns, "run_id", event.RunID)
+	} else {
+		m.logger.Info("Alert resolved", "alert", event.Alert, "run_id", event.RunID)
+	}
+	for _, n := range a.notifiers {
+		notifyCtx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		err := n.notify(notifyCtx, event)
+		cancel()
+		if err != nil {
+			m.logger.Warn("Failed to send alert notification", "alert", event.Alert, "channel", n.channel(), "error", err)
+			continue
+		}
+		m.logger.Debug("Sent alert notification", "alert", event.Alert, "channel", n.channel(), "status", event.Status)
+	}
+}
+
+// Firing returns the names of the firing alerts
+func (m *Manager) Firing() []string {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var firing []string
+	for _, a := range m.alerts {
+		if a.firing {
+			firing = append(firing, a.cfg.Name)
+		}
+	}
+	return firing
+}
@@ -0,0 +1,209 @@
+package alert
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+	"github.com/dasvh/enchante/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder is a webhook receiving the notifications
+type recorder struct {
+	mu     sync.Mutex
+	bodies []string
+	header http.Header
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bodies = append(r.bodies, string(body))
+	r.header = req.Header
+}
+
+func (r *recorder) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.bodies...)
+}
+
+// testRun returns a passed run with the p99 latency
+func testRun(id string, p99 float64) Run {
+	return Run{
+		RunID:  id,
+		Passed: true,
+		Report: &report.Report{TotalRequests: 10, SuccessfulRequests: 10, Latency: report.Latency{P99MS: p99}},
+	}
+}
+
+func TestObserve(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	m, err := New([]config.AlertConfig{{
+		Name:            "slow",
+		Thresholds:      []config.Threshold{{Metric: "p99_ms", Max: 100}},
+		ConsecutiveRuns: 2,
+		SendResolved:    true,
+		Webhook:         config.AlertWebhook{URL: server.URL, Headers: map[string]string{"X-Team": "checkout"}},
+	}}, "probe-a", testutil.Logger)
+	assert.NoError(t, err)
+
+	m.Observe(t.Context(), testRun("run1", 150))
+	assert.Empty(t, rec.received(), "Expected no notification before the consecutive runs")
+	assert.Empty(t, m.Firing())
+
+	m.Observe(t.Context(), testRun("run2", 200))
+	m.Observe(t.Context(), testRun("run3", 180))
+	assert.Equal(t, []string{"slow"}, m.Firing())
+	assert.Len(t, rec.received(), 1, "Expected a firing alert to notify once")
+
+	m.Observe(t.Context(), testRun("run4", 50))
+	assert.Empty(t, m.Firing())
+
+	bodies := rec.received()
+	assert.Len(t, bodies, 2)
+	var fired, resolved Event
+	assert.NoError(t, json.Unmarshal([]byte(bodies[0]), &fired))
+	assert.NoError(t, json.Unmarshal([]byte(bodies[1]), &resolved))
+	assert.Equal(t, StatusFiring, fired.Status)
+	assert.Equal(t, "probe-a", fired.Instance)
+	assert.Equal(t, "run2", fired.RunID)
+	assert.Equal(t, 2, fired.ConsecutiveRuns)
+	assert.Len(t, fired.Breaches, 1)
+	assert.Equal(t, 200.0, fired.Breaches[0].Value)
+	assert.Equal(t, StatusResolved, resolved.Status)
+	assert.Equal(t, "run4", resolved.RunID)
+	assert.Equal(t, 3, resolved.ConsecutiveRuns)
+	assert.Equal(t, "checkout", rec.header.Get("X-Team"))
+}
+
+func TestObserveFailedRuns(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	m, err := New([]config.AlertConfig{{
+		Name:    "down",
+		Webhook: config.AlertWebhook{URL: server.URL, Template: `{"alert": {{ json .Alert }}, "error": {{ json .Error }}}`},
+	}}, "probe-a", testutil.Logger)
+	assert.NoError(t, err)
+
+	failed := testRun("run1", 10)
+	failed.Passed = false
+	m.Observe(t.Context(), failed)
+	m.Observe(t.Context(), testRun("run2", 10))
+	m.Observe(t.Context(), Run{Error: `dial tcp: lookup "api": no such host`})
+
+	assert.Equal(t, []string{
+		`{"alert": "down", "error": ""}`,
+		`{"alert": "down", "error": "dial tcp: lookup \"api\": no such host"}`,
+	}, rec.received(), "Expected failed runs to fire the alert and no resolved notification")
+}
+
+func TestSlack(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	m, err := New([]config.AlertConfig{{Name: "slow", Slack: config.AlertSlack{WebhookURL: server.URL}, Thresholds: []config.Threshold{{Metric: "p99_ms", Max: 100}}}}, "probe-a", testutil.Logger)
+	assert.NoError(t, err)
+	m.Observe(t.Context(), testRun("run1", 150))
+
+	bodies := rec.received()
+	assert.Len(t, bodies, 1)
+	var message map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(bodies[0]), &message))
+	assert.Equal(t, "slow is firing on probe-a after 1 breaching run(s)\n- p99_ms is 150, above 100\n"+
+		"- 0 of 10 requests failed, p99 150.0 ms\nRun run1", message["text"])
+}
+
+func TestEmail(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	received := make(chan string, 1)
+	go serveSMTP(listener, received)
+
+	m, err := New([]config.AlertConfig{{
+		Name: "down",
+		Email: config.AlertEmail{
+			SMTP:    listener.Addr().String(),
+			From:    "enchante <enchante@example.com>",
+			To:      []string{"ops@example.com"},
+			Subject: "{{ upper .Status }}: {{ .Alert }}",
+		},
+	}}, "probe-a", testutil.Logger)
+	assert.NoError(t, err)
+	m.Observe(t.Context(), Run{Error: "connection refused"})
+
+	select {
+	case msg := <-received:
+		assert.Contains(t, msg, "MAIL FROM:<enchante@example.com>")
+		assert.Contains(t, msg, "RCPT TO:<ops@example.com>")
+		assert.Contains(t, msg, "Subject: FIRING: down\r\n")
+		assert.Contains(t, msg, "- the run failed: connection refused\r\n")
+	case <-time.After(time.Second):
+		t.Fatal("Expected an email to be sent")
+	}
+}
+
+// serveSMTP accepts a single SMTP session and sends the commands and message it received
+func serveSMTP(listener net.Listener, received chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var session strings.Builder
+	r := bufio.NewReader(conn)
+	io.WriteString(conn, "220 localhost ESMTP\r\n")
+	data := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		session.WriteString(line)
+		switch {
+		case data:
+			if line == ".\r\n" {
+				data = false
+				io.WriteString(conn, "250 OK\r\n")
+			}
+		case strings.HasPrefix(line, "EHLO"):
+			io.WriteString(conn, "250 localhost\r\n")
+		case strings.HasPrefix(line, "DATA"):
+			data = true
+			io.WriteString(conn, "354 Go ahead\r\n")
+		case strings.HasPrefix(line, "QUIT"):
+			io.WriteString(conn, "221 Bye\r\n")
+			received <- session.String()
+			return
+		default:
+			io.WriteString(conn, "250 OK\r\n")
+		}
+	}
+}
+
+func TestNewWithoutAlerts(t *testing.T) {
+	m, err := New(nil, "probe-a", testutil.Logger)
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+	m.Observe(t.Context(), Run{Error: "ignored"})
+	assert.Empty(t, m.Firing())
+}
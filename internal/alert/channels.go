@@ -0,0 +1,239 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// default templates of the channels without a configured template
+const (
+	defaultSubject = `[enchante] {{ .Alert }} {{ .Status }} on {{ .Instance }}`
+	defaultText    = `{{ .Alert }} is {{ .Status }} on {{ .Instance }}{{ if eq .Status "firing" }} after {{ .ConsecutiveRuns }} breaching run(s){{ end }}
+{{ range .Breaches }}- {{ .Metric }}{{ with .URL }} of {{ . }}{{ end }} is {{ printf "%.4g" .Value }}, above {{ printf "%.4g" .Max }}
+{{ end }}{{ with .Error }}- the run failed: {{ . }}
+{{ end }}{{ with .Summary }}- {{ .FailedRequests }} of {{ .TotalRequests }} requests failed, p99 {{ printf "%.1f" .P99MS }} ms
+{{ end }}{{ with .RunID }}Run {{ . }}{{ end }}{{ with .ReportFile }}, report {{ . }}{{ end }}`
+)
+
+// render executes a template with the event
+func render(t *template.Template, event Event) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, event); err != nil {
+		return nil, fmt.Errorf("error rendering %s: %w", t.Name(), err)
+	}
+	return buf.Bytes(), nil
+}
+
+// parseTemplate parses the configured template, or the default template when none is configured
+func parseTemplate(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+	return config.ParseAlertTemplate(name, text)
+}
+
+// post sends a JSON payload to a webhook, an error status is returned as an error
+func post(ctx context.Context, client *http.Client, url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// webhook posts the event, or the payload rendered by its template, to an HTTP endpoint
+type webhook struct {
+	cfg      config.AlertWebhook
+	template *template.Template
+	client   *http.Client
+}
+
+// newWebhook creates the webhook channel, the event is posted as JSON without a template
+func newWebhook(cfg config.AlertWebhook) (*webhook, error) {
+	w := &webhook{cfg: cfg, client: &http.Client{}}
+	if cfg.Template != "" {
+		t, err := config.ParseAlertTemplate("webhook template", cfg.Template)
+		if err != nil {
+			return nil, err
+		}
+		w.template = t
+	}
+	return w, nil
+}
+
+func (w *webhook) channel() string { return "webhook" }
+
+func (w *webhook) notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if w.template != nil {
+		body, err = render(w.template, event)
+	}
+	if err != nil {
+		return err
+	}
+	return post(ctx, w.client, w.cfg.URL, w.cfg.Headers, body)
+}
+
+// slack posts the rendered message to a Slack incoming webhook
+type slack struct {
+	cfg      config.AlertSlack
+	template *template.Template
+	client   *http.Client
+}
+
+// newSlack creates the Slack channel
+func newSlack(cfg config.AlertSlack) (*slack, error) {
+	t, err := parseTemplate("slack template", cfg.Template, defaultText)
+	if err != nil {
+		return nil, err
+	}
+	return &slack{cfg: cfg, template: t, client: &http.Client{}}, nil
+}
+
+func (s *slack) channel() string { return "slack" }
+
+func (s *slack) notify(ctx context.Context, event Event) error {
+	text, err := render(s.template, event)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"text": string(text)})
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.client, s.cfg.WebhookURL, nil, body)
+}
+
+// email sends the rendered subject and plain text body through an SMTP server
+type email struct {
+	cfg      config.AlertEmail
+	subject  *template.Template
+	template *template.Template
+}
+
+// newEmail creates the email channel
+func newEmail(cfg config.AlertEmail) (*email, error) {
+	subject, err := parseTemplate("email subject", cfg.Subject, defaultSubject)
+	if err != nil {
+		return nil, err
+	}
+	body, err := parseTemplate("email template", cfg.Template, defaultText)
+	if err != nil {
+		return nil, err
+	}
+	return &email{cfg: cfg, subject: subject, template: body}, nil
+}
+
+func (e *email) channel() string { return "email" }
+
+func (e *email) notify(ctx context.Context, event Event) error {
+	subject, err := render(e.subject, event)
+	if err != nil {
+		return err
+	}
+	body, err := render(e.template, event)
+	if err != nil {
+		return err
+	}
+	return e.send(ctx, e.message(strings.TrimSpace(string(subject)), body))
+}
+
+// message returns the email with its headers, the lines of the body end with CRLF as SMTP requires
+func (e *email) message(subject string, body []byte) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	for line := range strings.Lines(string(body)) {
+		msg.WriteString(strings.TrimRight(line, "\r\n") + "\r\n")
+	}
+	return msg.Bytes()
+}
+
+// send delivers the message through the SMTP server, upgrading to TLS with STARTTLS when the server offers it and
+// authenticating when a username is configured
+func (e *email) send(ctx context.Context, msg []byte) error {
+	host, _, err := net.SplitHostPort(e.cfg.SMTP)
+	if err != nil {
+		return err
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", e.cfg.SMTP)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("error starting TLS: %w", err)
+		}
+	}
+	if e.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, host)); err != nil {
+			return fmt.Errorf("error authenticating: %w", err)
+		}
+	}
+	// the envelope takes the bare addresses of names like Ops <ops@example.com>
+	from, err := mail.ParseAddress(e.cfg.From)
+	if err != nil {
+		return err
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range e.cfg.To {
+		rcpt, err := mail.ParseAddress(to)
+		if err != nil {
+			return err
+		}
+		if err := c.Rcpt(rcpt.Address); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
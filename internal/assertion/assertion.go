@@ -0,0 +1,128 @@
+// Package assertion checks responses against the assertions configured on an endpoint. Assertion types are looked
+// up in a registry, so new types, including custom Go functions of an embedding application, are added with Register
+// without changes to the probe engine
+package assertion
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// built-in assertion types
+const (
+	TypeStatus = "status"
+	TypeBody   = "body"
+	TypeHeader = "header"
+	TypeJSON   = "json"
+	TypePlugin = "plugin"
+	TypeWasm   = "wasm"
+)
+
+// Request represents the request a response was received for, with the variables substituted
+type Request struct {
+	Method string
+	// URL is the request URL including the query parameters
+	URL    string
+	Header http.Header
+	// Body is the configured body, empty for generated, file and multipart bodies
+	Body string
+}
+
+// Response represents the parts of a response an assertion checks
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	// Body is the decoded response body, limited to the first MiB
+	Body []byte
+	// Request is the request the response was received for
+	Request Request
+}
+
+// Assertion checks a response and returns an error describing the mismatch when the response does not pass
+type Assertion interface {
+	Check(resp Response) error
+}
+
+// Func adapts a function to the Assertion interface
+type Func func(resp Response) error
+
+// Check calls the function
+func (f Func) Check(resp Response) error {
+	return f(resp)
+}
+
+// Factory creates an assertion from its configuration, it returns an error when the configuration is invalid
+type Factory func(spec config.Assertion) (Assertion, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		TypeStatus: newStatus,
+		TypeBody:   newBody,
+		TypeHeader: newHeader,
+		TypeJSON:   newJSON,
+		TypePlugin: newPlugin,
+		TypeWasm:   newWasm,
+	}
+)
+
+// the settings of the assertions are checked when the config is loaded, so validate reports them
+func init() {
+	config.RegisterAssertionValidator(func(spec config.Assertion) error {
+		_, err := New(spec)
+		return err
+	})
+}
+
+// Register adds an assertion type, registering an existing type replaces it. It is meant to be called before the
+// run starts, e.g. from an init function
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// RegisterFunc adds an assertion type implemented by a function, which receives the configuration of the assertion
+// with every response, e.g. to read its args
+func RegisterFunc(name string, fn func(resp Response, spec config.Assertion) error) {
+	Register(name, func(spec config.Assertion) (Assertion, error) {
+		return Func(func(resp Response) error { return fn(resp, spec) }), nil
+	})
+}
+
+// New creates the assertion of the configured type
+func New(spec config.Assertion) (Assertion, error) {
+	registryMu.RLock()
+	factory, ok := registry[spec.Type]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown assertion type %q", spec.Type)
+	}
+	return factory(spec)
+}
+
+// Compile creates the assertions of an endpoint in the configured order
+func Compile(specs []config.Assertion) ([]Assertion, error) {
+	assertions := make([]Assertion, 0, len(specs))
+	for i, spec := range specs {
+		a, err := New(spec)
+		if err != nil {
+			return nil, fmt.Errorf("assertion %d: %w", i+1, err)
+		}
+		assertions = append(assertions, a)
+	}
+	return assertions, nil
+}
+
+// CheckAll checks the response against the assertions and returns the first failure
+func CheckAll(assertions []Assertion, resp Response) error {
+	for _, a := range assertions {
+		if err := a.Check(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
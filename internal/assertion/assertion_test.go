@@ -0,0 +1,209 @@
+package assertion
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltinAssertions(t *testing.T) {
+	resp := Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       []byte(`{"order": {"id": 42, "state": "paid", "note": null}}`),
+	}
+
+	tests := []struct {
+		name      string
+		spec      config.Assertion
+		expectErr string
+	}{
+		{name: "Status", spec: config.Assertion{Type: TypeStatus, Status: config.StatusCodes{{Min: 200, Max: 299}}}},
+		{name: "Status Mismatch", spec: config.Assertion{Type: TypeStatus, Status: config.StatusCodes{{Min: 201, Max: 201}}}, expectErr: "status code is 200, expected 201"},
+		{name: "Body Contains", spec: config.Assertion{Type: TypeBody, Contains: `"paid"`}},
+		{name: "Body Matches", spec: config.Assertion{Type: TypeBody, Matches: `"id":\s*\d+`}},
+		{name: "Body Mismatch", spec: config.Assertion{Type: TypeBody, Contains: "refunded"}, expectErr: `body does not contain "refunded"`},
+		{name: "Header Exists", spec: config.Assertion{Type: TypeHeader, Header: "content-type"}},
+		{name: "Header Equals", spec: config.Assertion{Type: TypeHeader, Header: "Content-Type", Equals: "text/html"}, expectErr: `header Content-Type is "application/json", expected "text/html"`},
+		{name: "Header Missing", spec: config.Assertion{Type: TypeHeader, Header: "ETag"}, expectErr: "header ETag not found in response"},
+		{name: "JSON Equals", spec: config.Assertion{Type: TypeJSON, Path: "$.order.id", Equals: "42"}},
+		{name: "JSON Exists", spec: config.Assertion{Type: TypeJSON, Path: "$.order.state"}},
+		{name: "JSON Null", spec: config.Assertion{Type: TypeJSON, Path: "$.order.note", Equals: "null"}},
+		{name: "JSON Missing", spec: config.Assertion{Type: TypeJSON, Path: "$.order.total"}, expectErr: "$.order.total not found in response"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := New(tc.spec)
+			assert.NoError(t, err)
+			err = a.Check(resp)
+			if tc.expectErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectErr)
+			}
+		})
+	}
+}
+
+func TestInvalidAssertions(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      config.Assertion
+		expectErr string
+	}{
+		{name: "Unknown Type", spec: config.Assertion{Type: "checksum"}, expectErr: `unknown assertion type "checksum"`},
+		{name: "Status Without Codes", spec: config.Assertion{Type: TypeStatus}, expectErr: "status assertion requires status"},
+		{name: "Header Without Name", spec: config.Assertion{Type: TypeHeader}, expectErr: "header assertion requires header"},
+		{name: "JSON Without Path", spec: config.Assertion{Type: TypeJSON}, expectErr: "json assertion requires path"},
+		{name: "Invalid JSON Path", spec: config.Assertion{Type: TypeJSON, Path: "$.items[x]"}, expectErr: "invalid JSON path: $.items[x]"},
+		{name: "Invalid Pattern", spec: config.Assertion{Type: TypeBody, Matches: "("}, expectErr: "invalid matches pattern"},
+		{name: "Plugin Without Path", spec: config.Assertion{Type: TypePlugin}, expectErr: "plugin assertion requires plugin"},
+		{name: "Missing Plugin", spec: config.Assertion{Type: TypePlugin, Plugin: "missing.so"}, expectErr: "failed to load plugin missing.so"},
+		{name: "Wasm Without Path", spec: config.Assertion{Type: TypeWasm}, expectErr: "wasm assertion requires wasm"},
+		{name: "Missing Wasm", spec: config.Assertion{Type: TypeWasm, Wasm: "missing.wasm"}, expectErr: "failed to load wasm module missing.wasm"},
+		{name: "Invalid Wasm", spec: config.Assertion{Type: TypeWasm, Wasm: "assertion.go"}, expectErr: "failed to compile wasm module assertion.go"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(tc.spec)
+			assert.ErrorContains(t, err, tc.expectErr)
+		})
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		assertion string
+		expectErr string
+	}{
+		{name: "Valid", assertion: "{type: json, path: $.id, matches: '^[0-9]+$'}"},
+		{name: "Invalid Pattern", assertion: "{type: body, matches: '('}", expectErr: "assertion 1: invalid matches pattern"},
+		{name: "Unknown Type", assertion: "{type: checksum}", expectErr: `assertion 1: unknown assertion type "checksum"`},
+		{name: "Invalid JSON Path", assertion: "{type: json, path: '$.items[0'}", expectErr: "assertion 1: invalid JSON path: $.items[0"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			assert.NoError(t, os.WriteFile(path, []byte(`
+auth:
+  enabled: false
+probe:
+  endpoints:
+    - url: https://api.example.com/orders
+      method: GET
+      assert:
+        - `+tc.assertion+"\n"), 0o600))
+
+			_, err := config.LoadProfile(path, "", testutil.Logger)
+			if tc.expectErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, "endpoint https://api.example.com/orders: "+tc.expectErr)
+		})
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	RegisterFunc("max_body", func(resp Response, spec config.Assertion) error {
+		if len(resp.Body) > len(spec.Args["limit"]) {
+			return errors.New("body too large")
+		}
+		return nil
+	})
+
+	assertions, err := Compile([]config.Assertion{{Type: "max_body", Args: map[string]string{"limit": "xxxx"}}})
+	assert.NoError(t, err)
+	assert.NoError(t, CheckAll(assertions, Response{Body: []byte("ok")}))
+	assert.EqualError(t, CheckAll(assertions, Response{Body: []byte("too long")}), "body too large")
+}
+
+func TestPluginFunc(t *testing.T) {
+	validate := func(req *http.Request, resp *http.Response) error {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if req.Header.Get("X-Tenant") != string(body) {
+			return errors.New("response of another tenant")
+		}
+		return nil
+	}
+	request := Request{Method: "GET", URL: "https://example.com/orders?page=1", Header: http.Header{"X-Tenant": {"acme"}}}
+
+	tests := []struct {
+		name      string
+		symbol    any
+		body      string
+		expectErr string
+	}{
+		{name: "Function", symbol: validate, body: "acme"},
+		{name: "Variable", symbol: &validate, body: "acme"},
+		{name: "Failing", symbol: validate, body: "other", expectErr: "response of another tenant"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := pluginFunc(tc.symbol)
+			assert.NoError(t, err)
+			err = a.Check(Response{StatusCode: http.StatusOK, Body: []byte(tc.body), Request: request})
+			if tc.expectErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectErr)
+			}
+		})
+	}
+
+	_, err := pluginFunc(func(resp *http.Response) error { return nil })
+	assert.ErrorContains(t, err, "expected func(*http.Request, *http.Response) error")
+}
+
+func TestWasm(t *testing.T) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found to build the wasm module")
+	}
+	module := filepath.Join(t.TempDir(), "tenant.wasm")
+	build := exec.Command(goTool, "build", "-buildmode=c-shared", "-o", module, "./testdata/tenant")
+	build.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	out, err := build.CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to build wasm module: %v\n%s", err, out)
+	}
+
+	a, err := New(config.Assertion{Type: TypeWasm, Wasm: module})
+	assert.NoError(t, err)
+	request := Request{Method: "GET", URL: "https://example.com/orders", Header: http.Header{"X-Tenant": {"acme"}}}
+	assert.NoError(t, a.Check(Response{StatusCode: http.StatusOK, Body: []byte("acme"), Request: request}))
+	assert.EqualError(t, a.Check(Response{StatusCode: http.StatusOK, Body: []byte("other"), Request: request}),
+		"response of another tenant")
+
+	// workers check responses concurrently, each on its own instance
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			for range 10 {
+				assert.NoError(t, a.Check(Response{StatusCode: http.StatusOK, Body: []byte("acme"), Request: request}))
+			}
+		})
+	}
+	wg.Wait()
+
+	cached, err := New(config.Assertion{Type: TypeWasm, Wasm: module})
+	assert.NoError(t, err)
+	assert.Same(t, a, cached)
+}
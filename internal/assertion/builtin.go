@@ -0,0 +1,132 @@
+package assertion
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/jsonpath"
+)
+
+// matcher compares a value with the equals, contains and matches settings of an assertion, a value passes when it
+// satisfies all of the set ones
+type matcher struct {
+	equals   string
+	contains string
+	matches  *regexp.Regexp
+}
+
+// newMatcher creates the matcher of an assertion, it fails for an invalid matches pattern
+func newMatcher(spec config.Assertion) (matcher, error) {
+	m := matcher{equals: spec.Equals, contains: spec.Contains}
+	if spec.Matches != "" {
+		re, err := regexp.Compile(spec.Matches)
+		if err != nil {
+			return matcher{}, fmt.Errorf("invalid matches pattern: %w", err)
+		}
+		m.matches = re
+	}
+	return m, nil
+}
+
+// match returns an error naming the value when it does not pass the matcher
+func (m matcher) match(name, value string) error {
+	switch {
+	case m.equals != "" && value != m.equals:
+		return fmt.Errorf("%s is %q, expected %q", name, truncate(value), m.equals)
+	case m.contains != "" && !strings.Contains(value, m.contains):
+		return fmt.Errorf("%s does not contain %q", name, m.contains)
+	case m.matches != nil && !m.matches.MatchString(value):
+		return fmt.Errorf("%s does not match %s", name, m.matches)
+	}
+	return nil
+}
+
+// truncate shortens long values in failure messages
+func truncate(value string) string {
+	const limit = 64
+	if len(value) <= limit {
+		return value
+	}
+	return value[:limit] + "..."
+}
+
+// newStatus creates an assertion on the status code
+func newStatus(spec config.Assertion) (Assertion, error) {
+	if len(spec.Status) == 0 {
+		return nil, fmt.Errorf("status assertion requires status")
+	}
+	return Func(func(resp Response) error {
+		if !spec.Status.Expected(resp.StatusCode) {
+			return fmt.Errorf("status code is %d, expected %s", resp.StatusCode, spec.Status)
+		}
+		return nil
+	}), nil
+}
+
+// newBody creates an assertion on the response body, without a comparison the body must not be empty
+func newBody(spec config.Assertion) (Assertion, error) {
+	m, err := newMatcher(spec)
+	if err != nil {
+		return nil, err
+	}
+	return Func(func(resp Response) error {
+		if len(resp.Body) == 0 {
+			return fmt.Errorf("body is empty")
+		}
+		return m.match("body", string(resp.Body))
+	}), nil
+}
+
+// newHeader creates an assertion on a response header, without a comparison the header must be present
+func newHeader(spec config.Assertion) (Assertion, error) {
+	if spec.Header == "" {
+		return nil, fmt.Errorf("header assertion requires header")
+	}
+	m, err := newMatcher(spec)
+	if err != nil {
+		return nil, err
+	}
+	return Func(func(resp Response) error {
+		values := resp.Header.Values(spec.Header)
+		if len(values) == 0 {
+			return fmt.Errorf("header %s not found in response", spec.Header)
+		}
+		return m.match("header "+spec.Header, values[0])
+	}), nil
+}
+
+// newJSON creates an assertion on a value of the JSON response body, without a comparison the value must exist
+func newJSON(spec config.Assertion) (Assertion, error) {
+	if spec.Path == "" {
+		return nil, fmt.Errorf("json assertion requires path")
+	}
+	if err := jsonpath.Validate(spec.Path); err != nil {
+		return nil, err
+	}
+	m, err := newMatcher(spec)
+	if err != nil {
+		return nil, err
+	}
+	return Func(func(resp Response) error {
+		var doc any
+		if err := json.Unmarshal(resp.Body, &doc); err != nil {
+			return fmt.Errorf("failed to parse JSON response: %w", err)
+		}
+		value, err := jsonpath.Lookup(doc, spec.Path)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			// null only passes an existence check or an explicit comparison with null
+			return m.match(spec.Path, "null")
+		}
+		s, err := jsonpath.String(value)
+		if err != nil {
+			return err
+		}
+		return m.match(spec.Path, s)
+	}), nil
+}
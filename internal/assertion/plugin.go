@@ -0,0 +1,64 @@
+package assertion
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// PluginSymbol is the function a validation plugin exports
+const PluginSymbol = "Validate"
+
+// ValidateFunc is the signature of the Validate function of a validation plugin. It only uses types of the standard
+// library, so plugins are built without importing enchante. It is called concurrently by the workers
+type ValidateFunc func(req *http.Request, resp *http.Response) error
+
+// newPlugin loads the Validate function of the Go plugin at the configured path, built with -buildmode=plugin by the
+// same Go version as enchante. Plugins are only loaded by builds with cgo on Linux, macOS and FreeBSD
+func newPlugin(spec config.Assertion) (Assertion, error) {
+	if spec.Plugin == "" {
+		return nil, fmt.Errorf("plugin assertion requires plugin")
+	}
+	symbol, err := lookupPlugin(spec.Plugin)
+	if err != nil {
+		return nil, err
+	}
+	validate, err := pluginFunc(symbol)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", spec.Plugin, err)
+	}
+	return validate, nil
+}
+
+// pluginFunc returns the assertion calling the exported Validate symbol, which is either the function or a variable
+// holding it
+func pluginFunc(symbol any) (Func, error) {
+	var validate ValidateFunc
+	switch fn := symbol.(type) {
+	case func(*http.Request, *http.Response) error:
+		validate = fn
+	case *func(*http.Request, *http.Response) error:
+		validate = *fn
+	default:
+		return nil, fmt.Errorf("%s is %T, expected func(*http.Request, *http.Response) error", PluginSymbol, symbol)
+	}
+	return func(resp Response) error {
+		req, err := http.NewRequest(resp.Request.Method, resp.Request.URL, strings.NewReader(resp.Request.Body))
+		if err != nil {
+			return err
+		}
+		req.Header = resp.Request.Header.Clone()
+		return validate(req, &http.Response{
+			Status:        fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+			StatusCode:    resp.StatusCode,
+			Header:        resp.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(resp.Body)),
+			ContentLength: int64(len(resp.Body)),
+			Request:       req,
+		})
+	}, nil
+}
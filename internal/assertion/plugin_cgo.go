@@ -0,0 +1,21 @@
+//go:build cgo && (linux || darwin || freebsd)
+
+package assertion
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// lookupPlugin opens the Go plugin at the path and returns its Validate symbol
+func lookupPlugin(path string) (any, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load plugin %s: %w", path, err)
+	}
+	symbol, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", path, err)
+	}
+	return symbol, nil
+}
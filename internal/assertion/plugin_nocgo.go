@@ -0,0 +1,16 @@
+//go:build !cgo || !(linux || darwin || freebsd)
+
+package assertion
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// lookupPlugin reports that this build can not load Go plugins, which need cgo on Linux, macOS or FreeBSD. The
+// release binaries are built without cgo
+func lookupPlugin(path string) (any, error) {
+	return nil, fmt.Errorf("failed to load plugin %s: this build of enchante (%s/%s) can not load Go plugins, which "+
+		"require building enchante from source with CGO_ENABLED=1 on Linux, macOS or FreeBSD, use a wasm assertion "+
+		"instead", path, runtime.GOOS, runtime.GOARCH)
+}
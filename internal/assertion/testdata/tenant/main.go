@@ -0,0 +1,48 @@
+// Command tenant is the WASM validation module of the tests, it fails responses whose body is not the X-Tenant header
+// of the request. It is built with GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"unsafe"
+)
+
+// exchange is the part of the document passed to validate the module reads
+type exchange struct {
+	Request struct {
+		Header http.Header `json:"header"`
+	} `json:"request"`
+	Response struct {
+		Body string `json:"body"`
+	} `json:"response"`
+}
+
+// input and message are kept in variables, so the memory enchante reads and writes is not collected
+var input, message []byte
+
+//go:wasmexport allocate
+func allocate(size uint32) uint32 {
+	input = make([]byte, size+1)
+	return uint32(uintptr(unsafe.Pointer(&input[0])))
+}
+
+//go:wasmexport validate
+func validate(_, size uint32) uint64 {
+	var e exchange
+	if err := json.Unmarshal(input[:size], &e); err != nil {
+		return fail(err.Error())
+	}
+	if e.Request.Header.Get("X-Tenant") != e.Response.Body {
+		return fail("response of another tenant")
+	}
+	return 0
+}
+
+// fail returns the address of the message in the upper and its length in the lower 32 bits
+func fail(msg string) uint64 {
+	message = []byte(msg)
+	return uint64(uintptr(unsafe.Pointer(&message[0])))<<32 | uint64(len(message))
+}
+
+func main() {}
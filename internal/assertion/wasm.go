@@ -0,0 +1,215 @@
+package assertion
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// functions a WASM validation module exports, next to its memory
+const (
+	WasmAllocate = "allocate"
+	WasmValidate = "validate"
+)
+
+// wasmExchange is the JSON document written to the memory of a WASM module for every response
+type wasmExchange struct {
+	Request  wasmRequest  `json:"request"`
+	Response wasmResponse `json:"response"`
+}
+
+// wasmRequest represents the request a response was received for
+type wasmRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+// wasmResponse represents the response passed to a WASM module
+type wasmResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+var (
+	wasmOnce    sync.Once
+	wasmRuntime wazero.Runtime
+	wasmMu      sync.Mutex
+	// wasmModules caches the compiled modules by path, so the runs of a daemon do not compile them again
+	wasmModules = map[string]*wasmModule{}
+)
+
+// wasmModule is a compiled validation module with the instances not in use by a worker, an instance handles one
+// response at a time
+type wasmModule struct {
+	path     string
+	compiled wazero.CompiledModule
+	modTime  time.Time
+	size     int64
+
+	mu   sync.Mutex
+	idle []api.Module
+}
+
+// newWasm loads the WASM module at the configured path, which is compiled once and instantiated per concurrent
+// worker. Unlike Go plugins, modules run in any build of enchante and do not depend on its Go version
+func newWasm(spec config.Assertion) (Assertion, error) {
+	if spec.Wasm == "" {
+		return nil, fmt.Errorf("wasm assertion requires wasm")
+	}
+	module, err := loadWasm(spec.Wasm)
+	if err != nil {
+		return nil, err
+	}
+	return module, nil
+}
+
+// loadWasm returns the compiled module at the path, compiling it when it is not cached or changed since
+func loadWasm(path string) (*wasmModule, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load wasm module %s: %w", path, err)
+	}
+
+	wasmMu.Lock()
+	defer wasmMu.Unlock()
+	if m, ok := wasmModules[path]; ok && m.modTime.Equal(info.ModTime()) && m.size == info.Size() {
+		return m, nil
+	}
+
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load wasm module %s: %w", path, err)
+	}
+	ctx := context.Background()
+	wasmOnce.Do(func() {
+		wasmRuntime = wazero.NewRuntime(ctx)
+		wasi_snapshot_preview1.MustInstantiate(ctx, wasmRuntime)
+	})
+	compiled, err := wasmRuntime.CompileModule(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile wasm module %s: %w", path, err)
+	}
+	if _, ok := compiled.ExportedMemories()["memory"]; !ok {
+		return nil, fmt.Errorf("wasm module %s does not export memory", path)
+	}
+	for _, name := range []string{WasmAllocate, WasmValidate} {
+		if _, ok := compiled.ExportedFunctions()[name]; !ok {
+			return nil, fmt.Errorf("wasm module %s does not export %s", path, name)
+		}
+	}
+
+	m := &wasmModule{path: path, compiled: compiled, modTime: info.ModTime(), size: info.Size()}
+	// the first instance reports modules failing to initialize before the run starts
+	instance, err := m.instantiate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.release(instance)
+	wasmModules[path] = m
+	return m, nil
+}
+
+// instantiate creates an instance of the module, initializing reactor modules with their _initialize function
+func (m *wasmModule) instantiate(ctx context.Context) (api.Module, error) {
+	cfg := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader)
+	instance, err := wasmRuntime.InstantiateModule(ctx, m.compiled, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate wasm module %s: %w", m.path, err)
+	}
+	return instance, nil
+}
+
+// acquire returns an idle instance or creates a new one
+func (m *wasmModule) acquire(ctx context.Context) (api.Module, error) {
+	m.mu.Lock()
+	if n := len(m.idle); n > 0 {
+		instance := m.idle[n-1]
+		m.idle = m.idle[:n-1]
+		m.mu.Unlock()
+		return instance, nil
+	}
+	m.mu.Unlock()
+	return m.instantiate(ctx)
+}
+
+// release returns an instance to the idle instances
+func (m *wasmModule) release(instance api.Module) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.idle = append(m.idle, instance)
+}
+
+// Check writes the request and response as JSON to the memory of an instance and calls validate, which returns 0 when
+// the response passes, otherwise the address of the error message in the upper and its length in the lower 32 bits
+func (m *wasmModule) Check(resp Response) error {
+	data, err := json.Marshal(wasmExchange{
+		Request: wasmRequest{
+			Method: resp.Request.Method,
+			URL:    resp.Request.URL,
+			Header: resp.Request.Header,
+			Body:   resp.Request.Body,
+		},
+		Response: wasmResponse{Status: resp.StatusCode, Header: resp.Header, Body: string(resp.Body)},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	instance, err := m.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := m.validate(ctx, instance, data)
+	if err != nil {
+		// a trapped instance is in an unknown state, it is not used again
+		_ = instance.Close(ctx)
+		return fmt.Errorf("wasm module %s: %w", m.path, err)
+	}
+	m.release(instance)
+	return result
+}
+
+// validate calls the exported functions of the instance, the returned error is the validation failure and err the
+// failure of the module itself
+func (m *wasmModule) validate(ctx context.Context, instance api.Module, data []byte) (result, err error) {
+	allocated, err := instance.ExportedFunction(WasmAllocate).Call(ctx, uint64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(allocated[0])
+	if !instance.Memory().Write(ptr, data) {
+		return nil, fmt.Errorf("%s returned %d, outside of its memory", WasmAllocate, ptr)
+	}
+	validated, err := instance.ExportedFunction(WasmValidate).Call(ctx, uint64(ptr), uint64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if validated[0] == 0 {
+		return nil, nil
+	}
+	message, ok := instance.Memory().Read(uint32(validated[0]>>32), uint32(validated[0]))
+	if !ok {
+		return nil, fmt.Errorf("%s returned a message outside of its memory", WasmValidate)
+	}
+	return errors.New(string(message)), nil
+}
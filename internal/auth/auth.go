@@ -8,40 +8,97 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/logger"
 )
 
-// GetAuthHeader returns the header and value for the authentication method specified in the authConfig
+// Credential represents the header authenticating the requests of an auth config
+type Credential struct {
+	Header string
+	Value  string
+	// ExpiresAt is when the credential expires, zero when it is not known, e.g. for an OAuth2 token without expires_in
+	ExpiresAt time.Time
+}
+
+// GetAuthHeader returns the header and value for the authentication method specified in the authConfig, the value is
+// registered as a secret so it is redacted from the logs
 func GetAuthHeader(authConfig *config.AuthConfig, logger *slog.Logger) (string, string, error) {
+	credential, err := Resolve(authConfig, logger)
+	return credential.Header, credential.Value, err
+}
+
+// Resolve returns the credential for the authentication method specified in the authConfig, with its expiry when the
+// method reports one. The value is registered as a secret so it is redacted from the logs
+func Resolve(authConfig *config.AuthConfig, logger *slog.Logger) (Credential, error) {
+	credential, err := getCredential(authConfig, logger)
+	if err == nil {
+		registerCredential(credential.Header, credential.Value)
+	}
+	return credential, err
+}
+
+// registerCredential registers the value of an auth header as a secret, along with the credential after its scheme
+// or the values of its session cookies
+func registerCredential(header, value string) {
+	logger.RegisterSecret(value)
+	if strings.EqualFold(header, "Cookie") {
+		for _, cookie := range strings.Split(value, "; ") {
+			_, cookieValue, _ := strings.Cut(cookie, "=")
+			logger.RegisterSecret(cookieValue)
+		}
+		return
+	}
+	if _, credential, ok := strings.Cut(value, " "); ok {
+		logger.RegisterSecret(credential)
+	}
+}
+
+// getCredential returns the credential for the authentication method specified in the authConfig
+func getCredential(authConfig *config.AuthConfig, logger *slog.Logger) (Credential, error) {
 	if !authConfig.Enabled {
 		logger.Info("Authentication is disabled")
-		return "", "", nil
+		return Credential{}, nil
 	}
 	switch authConfig.Type {
 	case "api_key":
 		logger.Info("Using API Key authentication")
-		return authConfig.APIKey.Header, authConfig.APIKey.Value, nil
+		return Credential{Header: authConfig.APIKey.Header, Value: authConfig.APIKey.Value}, nil
 	case "basic":
 		logger.Info("Using Basic authentication")
 		encoded := base64.StdEncoding.EncodeToString([]byte(authConfig.Basic.Username + ":" + authConfig.Basic.Password))
-		return "Authorization", "Basic " + encoded, nil
+		return Credential{Header: "Authorization", Value: "Basic " + encoded}, nil
 	case "oauth2":
 		logger.Info("Using OAuth2 authentication")
-		token, err := getOAuthToken(authConfig.OAuth2, logger)
+		token, expiresIn, err := getOAuthToken(authConfig.OAuth2, logger)
 		if err != nil {
 			logger.Error("Failed to fetch OAuth token", "error", err)
-			return "", "", err
+			return Credential{}, err
+		}
+		credential := Credential{Header: "Authorization", Value: "Bearer " + token}
+		if expiresIn > 0 {
+			credential.ExpiresAt = time.Now().Add(expiresIn)
 		}
-		return "Authorization", "Bearer " + token, nil
+		return credential, nil
+	case "session":
+		logger.Info("Using session authentication")
+		header, value, err := getSessionHeader(authConfig.Session, logger)
+		if err != nil {
+			logger.Error("Failed to establish session", "error", err)
+			return Credential{}, err
+		}
+		return Credential{Header: header, Value: value}, nil
 	default:
 		logger.Error("Unsupported authentication type", "auth_type", authConfig.Type)
-		return "", "", fmt.Errorf("unsupported auth type: %s", authConfig.Type)
+		return Credential{}, fmt.Errorf("unsupported auth type: %s", authConfig.Type)
 	}
 }
 
-// getOAuthToken retrieves an OAuth2 token using the provided configuration
-func getOAuthToken(auth config.OAuth2Auth, logger *slog.Logger) (string, error) {
+// getOAuthToken retrieves an OAuth2 token using the provided configuration, along with its lifetime when the response
+// has an expires_in
+func getOAuthToken(auth config.OAuth2Auth, logger *slog.Logger) (string, time.Duration, error) {
 	logger.Debug("Requesting OAuth2 token", "url", auth.TokenURL, "client_id", auth.ClientID)
 	data := fmt.Sprintf("client_id=%s&client_secret=%s&username=%s&password=%s&grant_type=%s&scope=%s",
 		auth.ClientID, auth.ClientSecret, auth.Username, auth.Password, auth.GrantType, auth.Scope)
@@ -49,7 +106,7 @@ func getOAuthToken(auth config.OAuth2Auth, logger *slog.Logger) (string, error)
 	req, err := http.NewRequest("POST", auth.TokenURL, bytes.NewBufferString(data))
 	if err != nil {
 		logger.Error("Failed to create OAuth2 request", "error", err)
-		return "", fmt.Errorf("failed to create OAuth request: %w", err)
+		return "", 0, fmt.Errorf("failed to create OAuth request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
@@ -57,33 +114,38 @@ func getOAuthToken(auth config.OAuth2Auth, logger *slog.Logger) (string, error)
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.Error("OAuth2 request failed", "error", err)
-		return "", fmt.Errorf("OAuth request failed: %w", err)
+		return "", 0, fmt.Errorf("OAuth request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		logger.Warn("OAuth2 server returned non-200 status", "status", resp.StatusCode)
-		return "", fmt.Errorf("OAuth server returned status: %d", resp.StatusCode)
+		return "", 0, fmt.Errorf("OAuth server returned status: %d", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		logger.Error("Failed to parse OAuth2 response", "error", err)
-		return "", fmt.Errorf("failed to read OAuth response: %w", err)
+		return "", 0, fmt.Errorf("failed to read OAuth response: %w", err)
 	}
 
 	var result map[string]any
 	if err := json.Unmarshal(body, &result); err != nil {
 		logger.Error("Failed to parse OAuth2 response", "error", err)
-		return "", fmt.Errorf("failed to parse OAuth response: %w", err)
+		return "", 0, fmt.Errorf("failed to parse OAuth response: %w", err)
 	}
 
 	token, ok := result["access_token"].(string)
 	if !ok {
 		logger.Error("OAuth2 response did not contain an access_token")
-		return "", fmt.Errorf("access_token not found in response")
+		return "", 0, fmt.Errorf("access_token not found in response")
+	}
+
+	var expiresIn time.Duration
+	if seconds, ok := result["expires_in"].(float64); ok && seconds > 0 {
+		expiresIn = time.Duration(seconds * float64(time.Second))
 	}
 
-	logger.Debug("Successfully retrieved OAuth2 token")
-	return token, nil
+	logger.Debug("Successfully retrieved OAuth2 token", "expires_in", expiresIn)
+	return token, expiresIn, nil
 }
@@ -1,12 +1,15 @@
 package auth
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/logger"
 	"github.com/dasvh/enchante/internal/testutil"
 	"github.com/stretchr/testify/assert"
 )
@@ -109,6 +112,22 @@ func TestOAuth2Authentication(t *testing.T) {
 	assert.Equal(t, "Bearer mocked-token", value)
 }
 
+func TestResolveOAuth2Expiry(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token": "mocked-token", "expires_in": 3600}`))
+	}))
+	defer mockServer.Close()
+
+	credential, err := Resolve(&config.AuthConfig{Enabled: true, Type: "oauth2", OAuth2: config.OAuth2Auth{TokenURL: mockServer.URL}}, testutil.Logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer mocked-token", credential.Value)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), credential.ExpiresAt, time.Minute)
+
+	credential, err = Resolve(&config.AuthConfig{Enabled: true, Type: "api_key", APIKey: config.APIKeyAuth{Header: "X-API-Key", Value: "key"}}, testutil.Logger)
+	assert.NoError(t, err)
+	assert.True(t, credential.ExpiresAt.IsZero(), "Expected no expiry for an API key")
+}
+
 func TestOAuth2Errors(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -157,3 +176,116 @@ func TestOAuth2Errors(t *testing.T) {
 		})
 	}
 }
+
+func TestSessionAuthentication(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "csrf_session", Value: "page-session"})
+		w.Write([]byte(`<form><input type="hidden" name="csrf_token" value="csrf-123"></form>`))
+	})
+	mux.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("csrf_session"); err != nil || cookie.Value != "page-session" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		r.ParseForm()
+		if r.PostForm.Get("csrf_token") != "csrf-123" || r.PostForm.Get("username") != "user" || r.PostForm.Get("password") != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session_id", Value: "abc"})
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("POST /api/login", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["username"] != "user" || r.Header.Get("X-CSRF-Token") != "csrf-123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data": {"token": "session-token"}}`))
+	})
+	mockServer := httptest.NewServer(mux)
+	defer mockServer.Close()
+
+	tests := []struct {
+		name           string
+		session        config.SessionAuth
+		expectedHeader string
+		expectedValue  string
+		expectErr      string
+	}{
+		{
+			name: "Form Login With Cookies And CSRF Field",
+			session: config.SessionAuth{
+				LoginURL: mockServer.URL + "/login",
+				Fields:   map[string]string{"username": "user", "password": "pass"},
+				CSRF:     config.CSRFConfig{Field: "csrf_token"},
+			},
+			expectedHeader: "Cookie",
+			expectedValue:  "csrf_session=page-session; session_id=abc",
+		},
+		{
+			name: "JSON Login With Token Field And CSRF Header",
+			session: config.SessionAuth{
+				LoginURL:    mockServer.URL + "/api/login",
+				Format:      "json",
+				Fields:      map[string]string{"username": "user"},
+				CSRF:        config.CSRFConfig{PageURL: mockServer.URL + "/login", Header: "X-CSRF-Token", Pattern: `value="([^"]+)"`},
+				TokenField:  "data.token",
+				TokenPrefix: "Bearer ",
+			},
+			expectedHeader: "Authorization",
+			expectedValue:  "Bearer session-token",
+		},
+		{
+			name: "Invalid Credentials",
+			session: config.SessionAuth{
+				LoginURL: mockServer.URL + "/login",
+				Fields:   map[string]string{"username": "user", "password": "wrong"},
+				CSRF:     config.CSRFConfig{Field: "csrf_token"},
+			},
+			expectErr: "login returned status: 401",
+		},
+		{
+			name: "Missing CSRF Token",
+			session: config.SessionAuth{
+				LoginURL: mockServer.URL + "/login",
+				CSRF:     config.CSRFConfig{Field: "other_token"},
+			},
+			expectErr: "csrf token not found",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			authCfg := config.AuthConfig{Enabled: true, Type: "session", Session: tc.session}
+
+			header, value, err := GetAuthHeader(&authCfg, testutil.Logger)
+
+			if tc.expectErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedHeader, header)
+			assert.Equal(t, tc.expectedValue, value)
+		})
+	}
+}
+
+func TestGetAuthHeaderRegistersSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "fetched-access-token"})
+	}))
+	defer server.Close()
+
+	authCfg := config.AuthConfig{Enabled: true, Type: "oauth2", OAuth2: config.OAuth2Auth{TokenURL: server.URL}}
+	_, _, err := GetAuthHeader(&authCfg, testutil.Logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "token [REDACTED]", logger.RedactString("token fetched-access-token"))
+
+	registerCredential("Cookie", "session=session-cookie-value; theme=red")
+	assert.Equal(t, "[REDACTED] red", logger.RedactString("session-cookie-value red"), "short values are not registered")
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// defaultCSRFPattern matches a hidden form input, %s is replaced with the quoted field name
+const defaultCSRFPattern = `name=["']%s["'][^>]*value=["']([^"']+)["']`
+
+// getSessionHeader performs the login request and returns the header carrying the session
+func getSessionHeader(session config.SessionAuth, logger *slog.Logger) (string, string, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create cookie jar: %w", err)
+	}
+	client := &http.Client{Jar: jar}
+
+	fields := make(map[string]string, len(session.Fields)+1)
+	maps.Copy(fields, session.Fields)
+
+	var csrfToken string
+	if session.CSRF.Field != "" || session.CSRF.Header != "" {
+		csrfToken, err = fetchCSRFToken(client, session, logger)
+		if err != nil {
+			return "", "", err
+		}
+		if session.CSRF.Field != "" {
+			fields[session.CSRF.Field] = csrfToken
+		}
+	}
+
+	req, err := newLoginRequest(session, fields)
+	if err != nil {
+		logger.Error("Failed to create login request", "error", err)
+		return "", "", fmt.Errorf("failed to create login request: %w", err)
+	}
+	if session.CSRF.Header != "" {
+		req.Header.Set(session.CSRF.Header, csrfToken)
+	}
+
+	logger.Debug("Performing session login", "url", session.LoginURL, "format", session.Format)
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Error("Login request failed", "error", err)
+		return "", "", fmt.Errorf("login request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		logger.Warn("Login returned error status", "status", resp.StatusCode)
+		return "", "", fmt.Errorf("login returned status: %d", resp.StatusCode)
+	}
+
+	if session.TokenField != "" {
+		token, err := extractTokenField(resp.Body, session.TokenField)
+		if err != nil {
+			logger.Error("Failed to extract token from login response", "field", session.TokenField, "error", err)
+			return "", "", err
+		}
+		header := session.TokenHeader
+		if header == "" {
+			header = "Authorization"
+		}
+		logger.Debug("Successfully retrieved session token")
+		return header, session.TokenPrefix + token, nil
+	}
+
+	loginURL, _ := url.Parse(session.LoginURL)
+	cookies := jar.Cookies(loginURL)
+	if len(cookies) == 0 {
+		logger.Error("Login response did not set any cookies")
+		return "", "", fmt.Errorf("no session cookies set by login")
+	}
+
+	values := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		values = append(values, cookie.Name+"="+cookie.Value)
+	}
+	logger.Debug("Successfully retrieved session cookies", "count", len(cookies))
+	return "Cookie", strings.Join(values, "; "), nil
+}
+
+// fetchCSRFToken loads the login page and extracts the CSRF token from it
+func fetchCSRFToken(client *http.Client, session config.SessionAuth, logger *slog.Logger) (string, error) {
+	pageURL := session.CSRF.PageURL
+	if pageURL == "" {
+		pageURL = session.LoginURL
+	}
+
+	pattern := session.CSRF.Pattern
+	if pattern == "" {
+		if session.CSRF.Field == "" {
+			return "", fmt.Errorf("csrf pattern is required when no csrf field is configured")
+		}
+		pattern = fmt.Sprintf(defaultCSRFPattern, regexp.QuoteMeta(session.CSRF.Field))
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid csrf pattern: %w", err)
+	}
+
+	logger.Debug("Fetching CSRF token", "url", pageURL)
+	resp, err := client.Get(pageURL)
+	if err != nil {
+		logger.Error("Login page request failed", "error", err)
+		return "", fmt.Errorf("login page request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read login page: %w", err)
+	}
+
+	match := re.FindSubmatch(body)
+	if len(match) < 2 {
+		logger.Error("CSRF token not found on login page", "url", pageURL)
+		return "", fmt.Errorf("csrf token not found on login page")
+	}
+	return string(match[1]), nil
+}
+
+// newLoginRequest creates the login request with the fields encoded as form or JSON
+func newLoginRequest(session config.SessionAuth, fields map[string]string) (*http.Request, error) {
+	method := session.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	var body []byte
+	var contentType string
+	switch session.Format {
+	case "", "form":
+		form := url.Values{}
+		for key, value := range fields {
+			form.Set(key, value)
+		}
+		body = []byte(form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	case "json":
+		var err error
+		body, err = json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		contentType = "application/json"
+	default:
+		return nil, fmt.Errorf("unsupported login format: %s", session.Format)
+	}
+
+	req, err := http.NewRequest(method, session.LoginURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return req, nil
+}
+
+// extractTokenField reads a JSON body and returns the string at the dot separated field path
+func extractTokenField(body io.Reader, field string) (string, error) {
+	var value any
+	if err := json.NewDecoder(body).Decode(&value); err != nil {
+		return "", fmt.Errorf("failed to parse login response: %w", err)
+	}
+
+	for _, key := range strings.Split(field, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("%s not found in login response", field)
+		}
+		value = object[key]
+	}
+
+	token, ok := value.(string)
+	if !ok || token == "" {
+		return "", fmt.Errorf("%s not found in login response", field)
+	}
+	return token, nil
+}
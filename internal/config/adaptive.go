@@ -0,0 +1,46 @@
+package config
+
+import "fmt"
+
+// DefaultDecreaseFactor is the factor the concurrency is multiplied with when the latency target is exceeded
+const DefaultDecreaseFactor = 0.5
+
+// AdaptiveConfig represents the adaptive concurrency mode, which adjusts the number of in-flight requests between
+// min_concurrency and concurrent_requests to keep the latency under a target
+type AdaptiveConfig struct {
+	Enabled         bool    `yaml:"enabled"`
+	TargetLatencyMS int     `yaml:"target_latency_ms"`
+	MinConcurrency  int     `yaml:"min_concurrency,omitempty"`
+	DecreaseFactor  float64 `yaml:"decrease_factor,omitempty"`
+}
+
+// MinLimit returns the lowest concurrency, defaults to 1
+func (a AdaptiveConfig) MinLimit() int {
+	return max(a.MinConcurrency, 1)
+}
+
+// Factor returns the multiplicative decrease factor, defaults to DefaultDecreaseFactor
+func (a AdaptiveConfig) Factor() float64 {
+	if a.DecreaseFactor == 0 {
+		return DefaultDecreaseFactor
+	}
+	return a.DecreaseFactor
+}
+
+// validateAdaptive checks the adaptive concurrency settings against the configured concurrency
+func validateAdaptive(probing ProbingConfig) error {
+	adaptive := probing.Adaptive
+	if !adaptive.Enabled {
+		return nil
+	}
+	if adaptive.TargetLatencyMS <= 0 {
+		return fmt.Errorf("adaptive target_latency_ms must be positive")
+	}
+	if adaptive.MinConcurrency < 0 || adaptive.MinLimit() > probing.ConcurrentRequests {
+		return fmt.Errorf("adaptive min_concurrency must be between 1 and concurrent_requests (%d)", probing.ConcurrentRequests)
+	}
+	if factor := adaptive.Factor(); factor <= 0 || factor >= 1 {
+		return fmt.Errorf("adaptive decrease_factor must be between 0 and 1, got %g", factor)
+	}
+	return nil
+}
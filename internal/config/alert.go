@@ -0,0 +1,156 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// AlertConfig represents an alert of the daemon, fired when consecutive runs breach it and sent to its channels
+type AlertConfig struct {
+	// Name identifies the alert in its notifications
+	Name string `yaml:"name"`
+	// Thresholds are the limits a run breaches the alert with, without thresholds a failed run breaches it. The
+	// severity of the thresholds is ignored
+	Thresholds []Threshold `yaml:"thresholds,omitempty"`
+	// ConsecutiveRuns is the number of consecutive breaching runs that fire the alert, defaults to 1
+	ConsecutiveRuns int `yaml:"consecutive_runs,omitempty"`
+	// SendResolved also notifies the channels when a run no longer breaches the firing alert
+	SendResolved bool         `yaml:"send_resolved,omitempty"`
+	Webhook      AlertWebhook `yaml:"webhook,omitempty"`
+	Slack        AlertSlack   `yaml:"slack,omitempty"`
+	Email        AlertEmail   `yaml:"email,omitempty"`
+}
+
+// AlertWebhook represents an alert channel posting to an HTTP endpoint, e.g. of an incident management tool
+type AlertWebhook struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Template is the Go template of the request body, the alert event as JSON when empty
+	Template string `yaml:"template,omitempty"`
+}
+
+// AlertSlack represents an alert channel posting to a Slack incoming webhook
+type AlertSlack struct {
+	WebhookURL string `yaml:"webhook_url"`
+	// Template is the Go template of the message text, a summary of the alert event when empty
+	Template string `yaml:"template,omitempty"`
+}
+
+// AlertEmail represents an alert channel sending email through an SMTP server
+type AlertEmail struct {
+	// SMTP is the host and port of the SMTP server, e.g. smtp.example.com:587. STARTTLS is used when it is offered
+	SMTP     string   `yaml:"smtp"`
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	// Subject and Template are the Go templates of the subject and the plain text body, summaries when empty
+	Subject  string `yaml:"subject,omitempty"`
+	Template string `yaml:"template,omitempty"`
+}
+
+// Runs returns the number of consecutive breaching runs that fire the alert, defaults to 1
+func (a AlertConfig) Runs() int {
+	return max(a.ConsecutiveRuns, 1)
+}
+
+// alertFuncs are the functions available to the alert templates
+var alertFuncs = template.FuncMap{
+	// json encodes a value, e.g. a string quoted and escaped for a JSON payload
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+	"time": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+}
+
+// ParseAlertTemplate parses the Go template of an alert payload with the alert template functions
+func ParseAlertTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(alertFuncs).Option("missingkey=error").Parse(text)
+}
+
+// validateAlerts checks that the alerts are named, have a channel and valid templates, and that their thresholds
+// limit known metrics of configured endpoints
+func validateAlerts(schedule ScheduleConfig, probing ProbingConfig) error {
+	names := make(map[string]bool)
+	for i, alert := range schedule.Alerts {
+		if alert.Name == "" {
+			return fmt.Errorf("alert %d: name is required", i+1)
+		}
+		if names[alert.Name] {
+			return fmt.Errorf("alert %s: duplicate name", alert.Name)
+		}
+		names[alert.Name] = true
+		if err := validateAlert(alert, probing); err != nil {
+			return fmt.Errorf("alert %s: %w", alert.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateAlert checks the thresholds, channels and templates of an alert
+func validateAlert(alert AlertConfig, probing ProbingConfig) error {
+	if alert.ConsecutiveRuns < 0 {
+		return fmt.Errorf("consecutive_runs must not be negative")
+	}
+	probing.Thresholds = alert.Thresholds
+	if err := validateThresholds(probing); err != nil {
+		return err
+	}
+	if alert.Webhook.URL == "" && alert.Slack.WebhookURL == "" && alert.Email.SMTP == "" {
+		return fmt.Errorf("a webhook, slack or email channel is required")
+	}
+
+	for _, t := range []struct{ name, text string }{
+		{"webhook template", alert.Webhook.Template},
+		{"slack template", alert.Slack.Template},
+		{"email subject", alert.Email.Subject},
+		{"email template", alert.Email.Template},
+	} {
+		if _, err := ParseAlertTemplate(t.name, t.text); err != nil {
+			return fmt.Errorf("invalid %s: %w", t.name, err)
+		}
+	}
+
+	for _, target := range []struct{ name, url string }{
+		{"webhook url", alert.Webhook.URL},
+		{"slack webhook_url", alert.Slack.WebhookURL},
+	} {
+		if target.url == "" {
+			continue
+		}
+		u, err := url.Parse(target.url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid %s: %q", target.name, target.url)
+		}
+	}
+
+	email := alert.Email
+	if email.SMTP == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(email.SMTP); err != nil {
+		return fmt.Errorf("invalid email smtp address %q: %w", email.SMTP, err)
+	}
+	if _, err := mail.ParseAddress(email.From); err != nil {
+		return fmt.Errorf("invalid email from address %q: %w", email.From, err)
+	}
+	if len(email.To) == 0 {
+		return fmt.Errorf("email to requires at least one address")
+	}
+	for _, to := range email.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("invalid email to address %q: %w", to, err)
+		}
+	}
+	return nil
+}
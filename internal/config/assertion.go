@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Assertion represents a check of the response of an endpoint, the request fails when the response does not pass it
+type Assertion struct {
+	// Type selects the assertion: status, body, header, json, plugin, wasm or a custom type registered in the assertion
+	// package
+	Type string `yaml:"type"`
+	// Status lists the status codes the status type accepts, e.g. "200" or "2xx,304"
+	Status StatusCodes `yaml:"status,omitempty"`
+	// Header is the response header checked by the header type
+	Header string `yaml:"header,omitempty"`
+	// Path is the value checked by the json type, e.g. $.data.items[0].id
+	Path string `yaml:"path,omitempty"`
+	// Equals, Contains and Matches compare the checked value, without any of them the value only has to exist
+	Equals   string `yaml:"equals,omitempty"`
+	Contains string `yaml:"contains,omitempty"`
+	Matches  string `yaml:"matches,omitempty"`
+	// Args holds the settings of custom assertion types
+	Args map[string]string `yaml:"args,omitempty"`
+	// Plugin is the path of the Go plugin the plugin type validates the response with
+	Plugin string `yaml:"plugin,omitempty"`
+	// Wasm is the path of the WASM module the wasm type validates the response with
+	Wasm string `yaml:"wasm,omitempty"`
+}
+
+var (
+	assertionValidatorMu sync.RWMutex
+	// assertionValidator checks the settings of an assertion, it is registered by the assertion package
+	assertionValidator func(Assertion) error
+)
+
+// RegisterAssertionValidator sets the function checking the settings of every assertion when the config is loaded.
+// The assertion package registers one creating the assertion, as config can not import it
+func RegisterAssertionValidator(validate func(Assertion) error) {
+	assertionValidatorMu.Lock()
+	defer assertionValidatorMu.Unlock()
+	assertionValidator = validate
+}
+
+// validateAssertions checks that every assertion has a type and, with a registered validator, valid settings for
+// its type, e.g. a valid regular expression or JSONPath
+func validateAssertions(probing ProbingConfig) error {
+	assertionValidatorMu.RLock()
+	validate := assertionValidator
+	assertionValidatorMu.RUnlock()
+	for _, endpoint := range probing.endpointRefs() {
+		for i, assertion := range endpoint.Assertions {
+			if assertion.Type == "" {
+				return fmt.Errorf("endpoint %s: assertion %d has no type", endpoint.URL, i+1)
+			}
+			if validate == nil {
+				continue
+			}
+			if err := validate(assertion); err != nil {
+				return fmt.Errorf("endpoint %s: assertion %d: %w", endpoint.URL, i+1, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import "fmt"
+
+// BackpressureConfig represents the backpressure on the in-flight requests, which lowers the cap on them while the
+// target throttles with 429 and 503 responses and raises it again while it does not
+type BackpressureConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MinInFlight is the lowest the cap is lowered to, defaults to 1
+	MinInFlight int `yaml:"min_in_flight,omitempty"`
+	// DecreaseFactor is the factor the cap is multiplied with on a throttled response, defaults to
+	// DefaultDecreaseFactor
+	DecreaseFactor float64 `yaml:"decrease_factor,omitempty"`
+	// HonorRetryAfter holds all new requests for the wait requested by the Retry-After header of a throttled
+	// response, capped by retry_after max_wait_ms
+	HonorRetryAfter bool `yaml:"honor_retry_after,omitempty"`
+}
+
+// MinLimit returns the lowest cap, defaults to 1
+func (b BackpressureConfig) MinLimit() int {
+	return max(b.MinInFlight, 1)
+}
+
+// Factor returns the multiplicative decrease factor, defaults to DefaultDecreaseFactor
+func (b BackpressureConfig) Factor() float64 {
+	if b.DecreaseFactor == 0 {
+		return DefaultDecreaseFactor
+	}
+	return b.DecreaseFactor
+}
+
+// validateBackpressure checks the global in-flight cap and the backpressure settings, the cap of the backpressure is
+// max_in_flight or concurrent_requests without it
+func validateBackpressure(probing ProbingConfig) error {
+	if probing.MaxInFlight < 0 {
+		return fmt.Errorf("max_in_flight must not be negative")
+	}
+	backpressure := probing.Backpressure
+	if !backpressure.Enabled {
+		return nil
+	}
+	limit := probing.MaxInFlight
+	if limit == 0 {
+		limit = probing.ConcurrentRequests
+	}
+	if backpressure.MinInFlight < 0 || backpressure.MinLimit() > limit {
+		return fmt.Errorf("backpressure min_in_flight must be between 1 and max_in_flight or concurrent_requests (%d)", limit)
+	}
+	if factor := backpressure.Factor(); factor <= 0 || factor >= 1 {
+		return fmt.Errorf("backpressure decrease_factor must be between 0 and 1, got %g", factor)
+	}
+	return nil
+}
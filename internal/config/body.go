@@ -0,0 +1,164 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// DefaultBodyPattern is the pattern repeated by a body generator without a configured pattern
+const DefaultBodyPattern = "0123456789abcdef"
+
+// contentEncodings are the accepted values of content_encoding and expect_encoding
+var contentEncodings = []string{"gzip", "deflate", "br", "zstd", "identity"}
+
+// requestCompressions are the accepted values of compress_request
+var requestCompressions = []string{"gzip", "deflate", "br"}
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// BodyGenerator represents a request body generated by repeating a pattern, streamed without keeping it in memory
+type BodyGenerator struct {
+	Pattern string `yaml:"pattern,omitempty"`
+	SizeMB  int    `yaml:"size_mb"`
+}
+
+// Size returns the size of the generated body in bytes
+func (g BodyGenerator) Size() int64 {
+	return int64(g.SizeMB) * 1024 * 1024
+}
+
+// PatternBytes returns the repeated pattern, falling back to DefaultBodyPattern
+func (g BodyGenerator) PatternBytes() []byte {
+	if g.Pattern == "" {
+		return []byte(DefaultBodyPattern)
+	}
+	return []byte(g.Pattern)
+}
+
+// Multipart represents a multipart/form-data request body with form fields and file uploads
+type Multipart struct {
+	Fields map[string]string `yaml:"fields,omitempty"`
+	Files  []MultipartFile   `yaml:"files,omitempty"`
+}
+
+// MultipartFile represents a file uploaded in a multipart form, it is streamed from disk for every request
+type MultipartFile struct {
+	Field string `yaml:"field"`
+	Path  string `yaml:"path"`
+	// Filename is sent as the name of the file, defaults to the base name of Path
+	Filename string `yaml:"filename,omitempty"`
+	// ContentType defaults to application/octet-stream
+	ContentType string `yaml:"content_type,omitempty"`
+}
+
+// HasBody reports whether the endpoint sends a request body
+func (e Endpoint) HasBody() bool {
+	return e.Body != "" || e.BodyGenerator != nil || e.BodyFile != "" || e.Multipart != nil || e.BodyBase64 != ""
+}
+
+// validateBodies checks that every endpoint defines at most one valid body source
+func validateBodies(probing ProbingConfig) error {
+	for _, endpoint := range probing.endpointRefs() {
+		sources := 0
+		for _, set := range []bool{endpoint.Body != "", endpoint.BodyGenerator != nil, endpoint.BodyFile != "", endpoint.Multipart != nil, endpoint.BodyBase64 != ""} {
+			if set {
+				sources++
+			}
+		}
+		if sources > 1 {
+			return fmt.Errorf("endpoint %s: body, body_base64, body_generator, body_file and multipart are mutually exclusive", endpoint.URL)
+		}
+
+		if endpoint.BodyGenerator != nil && endpoint.BodyGenerator.SizeMB <= 0 {
+			return fmt.Errorf("endpoint %s: body_generator size_mb must be positive", endpoint.URL)
+		}
+		if endpoint.BodyFile != "" {
+			if err := checkFile(endpoint.BodyFile); err != nil {
+				return fmt.Errorf("endpoint %s: body_file %w", endpoint.URL, err)
+			}
+		}
+		if endpoint.Multipart != nil {
+			if err := endpoint.Multipart.validate(); err != nil {
+				return fmt.Errorf("endpoint %s: multipart %w", endpoint.URL, err)
+			}
+		}
+		if err := validateEncodings(*endpoint); err != nil {
+			return fmt.Errorf("endpoint %s: %w", endpoint.URL, err)
+		}
+	}
+	return nil
+}
+
+// validateEncodings checks that body_base64 decodes, that content_encoding declares a known encoding of the body and
+// that the compression options name supported encodings. A gzip body_base64 must start like a gzip stream so an
+// uncompressed payload is not sent as gzip
+func validateEncodings(endpoint Endpoint) error {
+	if endpoint.ExpectEncoding != "" && !slices.Contains(contentEncodings, endpoint.ExpectEncoding) {
+		return fmt.Errorf("unsupported expect_encoding %q, use one of %v", endpoint.ExpectEncoding, contentEncodings)
+	}
+	if endpoint.CompressRequest != "" {
+		if !slices.Contains(requestCompressions, endpoint.CompressRequest) {
+			return fmt.Errorf("unsupported compress_request %q, use one of %v", endpoint.CompressRequest, requestCompressions)
+		}
+		if endpoint.ContentEncoding != "" {
+			return fmt.Errorf("compress_request and content_encoding are mutually exclusive")
+		}
+		if !endpoint.HasBody() {
+			return fmt.Errorf("compress_request requires a body")
+		}
+	}
+
+	var body []byte
+	if endpoint.BodyBase64 != "" {
+		decoded, err := base64.StdEncoding.DecodeString(endpoint.BodyBase64)
+		if err != nil {
+			return fmt.Errorf("body_base64 is not valid base64: %w", err)
+		}
+		body = decoded
+	}
+	if endpoint.ContentEncoding == "" {
+		return nil
+	}
+	if !slices.Contains(contentEncodings, endpoint.ContentEncoding) {
+		return fmt.Errorf("unsupported content_encoding %q, use one of %v", endpoint.ContentEncoding, contentEncodings)
+	}
+	if !endpoint.HasBody() {
+		return fmt.Errorf("content_encoding requires a body")
+	}
+	if endpoint.ContentEncoding == "gzip" && body != nil && !bytes.HasPrefix(body, gzipMagic) {
+		return fmt.Errorf("body_base64 is not gzip data")
+	}
+	return nil
+}
+
+// validate checks that the multipart form has content and that the uploaded files can be read
+func (m Multipart) validate() error {
+	if len(m.Fields) == 0 && len(m.Files) == 0 {
+		return fmt.Errorf("requires fields or files")
+	}
+	for _, file := range m.Files {
+		if file.Field == "" || file.Path == "" {
+			return fmt.Errorf("files require a field and a path")
+		}
+		if err := checkFile(file.Path); err != nil {
+			return fmt.Errorf("file %w", err)
+		}
+	}
+	return nil
+}
+
+// checkFile checks that the path is a regular file
+func checkFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%s cannot be read: %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package config
+
+import "fmt"
+
+const (
+	// CaptureScopeRun stores a captured value for all requests of the run
+	CaptureScopeRun = "run"
+	// CaptureScopeVU stores a captured value for the later requests of the same virtual user
+	CaptureScopeVU = "vu"
+)
+
+// Capture represents a value captured from the response of an endpoint into a variable, which later requests
+// reference with {{name}}, e.g. to hand off a token or correlate IDs
+type Capture struct {
+	Extraction `yaml:",inline"`
+	// Scope is where the value is stored, run (default) or vu
+	Scope string `yaml:"scope,omitempty"`
+}
+
+// capturedVariables returns the names of the variables captured by any endpoint or step, or set by their hooks
+func capturedVariables(probing ProbingConfig) map[string]bool {
+	captured := make(map[string]bool)
+	for _, endpoint := range probing.endpointRefs() {
+		for _, capture := range endpoint.Capture {
+			captured[capture.Name] = true
+		}
+		for _, name := range endpoint.Hooks.hookVariables() {
+			captured[name] = true
+		}
+	}
+	return captured
+}
+
+// validateCaptures checks the capture rules and that endpoints only reference captured variables
+func validateCaptures(probing ProbingConfig) error {
+	for _, endpoint := range probing.endpointRefs() {
+		for _, capture := range endpoint.Capture {
+			if err := capture.validate(); err != nil {
+				return fmt.Errorf("endpoint %s: %w", endpoint.URL, err)
+			}
+			switch capture.Scope {
+			case "", CaptureScopeRun:
+			case CaptureScopeVU:
+				if !probing.VirtualUsers.Enabled {
+					return fmt.Errorf("endpoint %s: variable %s has scope vu but virtual_users are disabled", endpoint.URL, capture.Name)
+				}
+			default:
+				return fmt.Errorf("endpoint %s: invalid scope %q for variable %s", endpoint.URL, capture.Scope, capture.Name)
+			}
+		}
+	}
+
+	captured := capturedVariables(probing)
+	for _, endpoint := range probing.Endpoints {
+		for _, name := range referencedVariables(endpoint) {
+			if !captured[name] {
+				return fmt.Errorf("endpoint %s references variable %s that is not captured", endpoint.URL, name)
+			}
+		}
+	}
+	return nil
+}
@@ -1,10 +1,15 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
-	"os"
+	"net"
+	"net/url"
 	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/goccy/go-yaml"
 	"github.com/joho/godotenv"
@@ -16,6 +21,15 @@ const DefaultRequestTimeout = 2000
 type Config struct {
 	Auth          AuthConfig    `yaml:"auth"`
 	ProbingConfig ProbingConfig `yaml:"probe"`
+	History       HistoryConfig `yaml:"history,omitempty"`
+	// Profiles are the environments the config can target, one of them is selected when the config is loaded
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+	// Include lists the config files this file builds on, they are merged when the config is read
+	Include includeList `yaml:"include,omitempty"`
+	// Schema is the JSON Schema of the file for editors, it is not used by the probe
+	Schema string `yaml:"$schema,omitempty"`
+	// Schedule is when the daemon runs the probe
+	Schedule ScheduleConfig `yaml:"schedule,omitempty"`
 }
 
 // AuthConfig represents the authentication configuration
@@ -23,9 +37,13 @@ type AuthConfig struct {
 	Enabled bool   `yaml:"enabled"`
 	Type    string `yaml:"type,omitempty"`
 
-	APIKey APIKeyAuth `yaml:"api_key,omitempty"`
-	Basic  BasicAuth  `yaml:"basic,omitempty"`
-	OAuth2 OAuth2Auth `yaml:"oauth2,omitempty"`
+	APIKey  APIKeyAuth  `yaml:"api_key,omitempty"`
+	Basic   BasicAuth   `yaml:"basic,omitempty"`
+	OAuth2  OAuth2Auth  `yaml:"oauth2,omitempty"`
+	Session SessionAuth `yaml:"session,omitempty"`
+	// RefreshIntervalMS is how often the credential is fetched again during the run, e.g. a session that times out.
+	// OAuth2 tokens with an expires_in are refreshed before they expire without it
+	RefreshIntervalMS int `yaml:"refresh_interval_ms,omitempty"`
 }
 
 // APIKeyAuth represents the configuration for API Key authentication
@@ -51,22 +69,171 @@ type OAuth2Auth struct {
 	Scope        string `yaml:"scope,omitempty"`
 }
 
+// SessionAuth represents the configuration for session authentication using a login request
+type SessionAuth struct {
+	LoginURL string            `yaml:"login_url"`
+	Method   string            `yaml:"method,omitempty"`
+	Format   string            `yaml:"format,omitempty"`
+	Fields   map[string]string `yaml:"fields,omitempty"`
+	CSRF     CSRFConfig        `yaml:"csrf,omitempty"`
+	// TokenField is the field in the JSON login response holding the token, cookies are used when empty
+	TokenField  string `yaml:"token_field,omitempty"`
+	TokenHeader string `yaml:"token_header,omitempty"`
+	TokenPrefix string `yaml:"token_prefix,omitempty"`
+}
+
+// CSRFConfig represents the configuration for extracting a CSRF token from the login page
+type CSRFConfig struct {
+	PageURL string `yaml:"page_url,omitempty"`
+	Pattern string `yaml:"pattern,omitempty"`
+	Field   string `yaml:"field,omitempty"`
+	Header  string `yaml:"header,omitempty"`
+}
+
 // ProbingConfig represents the probing configuration
 type ProbingConfig struct {
-	ConcurrentRequests int        `yaml:"concurrent_requests"`
-	TotalRequests      int        `yaml:"total_requests"`
-	RequestTimeoutMS   int        `yaml:"request_timeout_ms,omitempty"`
-	DelayBetween       Delay      `yaml:"delay_between"`
-	Endpoints          []Endpoint `yaml:"endpoints"`
+	ConcurrentRequests int            `yaml:"concurrent_requests"`
+	TotalRequests      int            `yaml:"total_requests"`
+	RequestTimeoutMS   int            `yaml:"request_timeout_ms,omitempty"`
+	DelayBetween       Delay          `yaml:"delay_between"`
+	Pacing             Pacing         `yaml:"pacing,omitempty"`
+	Adaptive           AdaptiveConfig `yaml:"adaptive,omitempty"`
+	VirtualUsers       VirtualUsers   `yaml:"virtual_users,omitempty"`
+	CustomMethods      []CustomMethod `yaml:"custom_methods,omitempty"`
+	Network            NetworkConfig  `yaml:"network,omitempty"`
+	Proxy              ProxyConfig    `yaml:"proxy,omitempty"`
+	ProgressWebhook    WebhookConfig  `yaml:"progress_webhook,omitempty"`
+	ResultStream       StreamConfig   `yaml:"result_stream,omitempty"`
+	SamplesFile        string         `yaml:"samples_file,omitempty"`
+	Endpoints          []Endpoint     `yaml:"endpoints"`
+	Scenarios          []Scenario     `yaml:"scenarios,omitempty"`
+	Registry           RegistryConfig `yaml:"registry,omitempty"`
+	// Seed makes random delays reproducible across runs, a random seed is used when it is 0
+	Seed int64 `yaml:"seed,omitempty"`
+	// RetryAfter pauses an endpoint for the time requested by the Retry-After header of its 429 and 503 responses
+	RetryAfter RetryAfterConfig `yaml:"retry_after,omitempty"`
+	// MaxDurationMS ends the run after this time even when not all requests were sent, 0 means no limit
+	MaxDurationMS int `yaml:"max_duration_ms,omitempty"`
+	// DrainTimeoutMS is how long in-flight requests may take to finish when the run ends early, defaults to
+	// request_timeout_ms
+	DrainTimeoutMS int `yaml:"drain_timeout_ms,omitempty"`
+	// RunIDHeader is the header every request carries the run ID and its sequence number in, empty disables it
+	RunIDHeader string `yaml:"run_id_header,omitempty"`
+	// Thresholds limit metrics of the run, a breached fail threshold fails the run
+	Thresholds []Threshold `yaml:"thresholds,omitempty"`
+	// HealthCheck pauses the load while the health endpoint of the target reports unhealthy
+	HealthCheck HealthCheck `yaml:"health_check,omitempty"`
+	// BreakdownHeaders are response headers whose values the response times are broken down by, e.g. X-Cache
+	BreakdownHeaders []string `yaml:"breakdown_headers,omitempty"`
+	// Audit writes the details of every request and response to a file for replay analysis
+	Audit AuditConfig `yaml:"audit,omitempty"`
+	// Metrics are the monitoring systems the results are emitted to during the run
+	Metrics MetricsConfig `yaml:"metrics,omitempty"`
+	// Control serves an API to query and steer the run while it is running, e.g. a soak test
+	Control ControlConfig `yaml:"control,omitempty"`
+	// SLO are the service level objectives the compliance and error budget burn of the runs are reported for
+	SLO SLOConfig `yaml:"slo,omitempty"`
+	// MaxInFlight caps the concurrent requests across all workers and endpoints, 0 means no cap
+	MaxInFlight int `yaml:"max_in_flight,omitempty"`
+	// Backpressure lowers the cap on the in-flight requests while the target throttles with 429 and 503 responses
+	Backpressure BackpressureConfig `yaml:"backpressure,omitempty"`
+	// Mode changes how the run sends its requests, find-max searches the maximum sustainable request rate
+	Mode string `yaml:"mode,omitempty"`
+	// FindMax configures the steps of the find-max mode
+	FindMax FindMaxConfig `yaml:"find_max,omitempty"`
+	// Engine selects the load model, a closed model with a fixed concurrency or an open model with a constant
+	// arrival rate
+	Engine EngineConfig `yaml:"engine,omitempty"`
+	// Middleware runs around every request, e.g. to log, sign or count the requests
+	Middleware []Middleware `yaml:"middleware,omitempty"`
+}
+
+// AuditConfig configures the audit file, one line of JSON per request with its status, headers and bodies
+type AuditConfig struct {
+	// File is the path the audit records are written to, no audit is written when it is empty
+	File string `yaml:"file"`
+	// BodyBytes is the number of bytes of the request and response bodies kept per record, bodies are left out when 0
+	BodyBytes int `yaml:"body_bytes,omitempty"`
+}
+
+// DefaultWebhookInterval is the default interval between progress updates in milliseconds
+const DefaultWebhookInterval = 10000
+
+// WebhookConfig represents the configuration of a webhook receiving periodic progress updates during a run
+type WebhookConfig struct {
+	URL        string            `yaml:"url"`
+	IntervalMS int               `yaml:"interval_ms,omitempty"`
+	Headers    map[string]string `yaml:"headers,omitempty"`
+}
+
+// StreamConfig represents the configuration of the live result stream external consumers can subscribe to
+type StreamConfig struct {
+	// Listen is the address the stream is served on during the run, e.g. localhost:9090
+	Listen string `yaml:"listen"`
+	// GRPCListen is the address the stream is served on as a gRPC service during the run, e.g. localhost:9092
+	GRPCListen string `yaml:"grpc_listen,omitempty"`
+}
+
+// ControlConfig represents the configuration of the control API steering a running probe
+type ControlConfig struct {
+	// Listen is the address the control API is served on during the run, e.g. localhost:9091
+	Listen string `yaml:"listen"`
+	// Token is the bearer token the requests to the control API must carry, any request is accepted when empty
+	Token string `yaml:"token,omitempty"`
+	// MaxWorkers is the largest number of workers the control API can set, defaults to DefaultMaxWorkersFactor times
+	// concurrent_requests
+	MaxWorkers int `yaml:"max_workers,omitempty"`
 }
 
-// Delay represents the configuration for delay between requests
+// DefaultMaxWorkersFactor is the multiple of concurrent_requests the control API can raise the workers to by default
+const DefaultMaxWorkersFactor = 10
+
+// WorkerLimit returns the largest number of workers the control API can set for the concurrent requests of the run
+func (c ControlConfig) WorkerLimit(concurrentRequests int) int {
+	if c.MaxWorkers == 0 {
+		return DefaultMaxWorkersFactor * max(concurrentRequests, 1)
+	}
+	return c.MaxWorkers
+}
+
+// delay types, the delay is fixed when the type is empty
+const (
+	DelayFixed  = "fixed"
+	DelayRandom = "random"
+	// DelayExponential draws exponentially distributed delays around Mean, which models Poisson arrivals
+	DelayExponential = "exponential"
+	// DelayNormal draws normally distributed delays around Mean with StdDev
+	DelayNormal = "normal"
+)
+
+// Delay represents the configuration for delay between requests, all values are in milliseconds
 type Delay struct {
 	Enabled bool   `yaml:"enabled"`
 	Type    string `yaml:"type"`
-	Min     int    `yaml:"min,omitempty"`
-	Max     int    `yaml:"max,omitempty"`
-	Fixed   int    `yaml:"fixed,omitempty"`
+	// Min and Max are the range of random delays, and optional bounds of exponential and normal delays
+	Min   int `yaml:"min,omitempty"`
+	Max   int `yaml:"max,omitempty"`
+	Fixed int `yaml:"fixed,omitempty"`
+	// Mean is the average of exponential and normal delays
+	Mean int `yaml:"mean,omitempty"`
+	// StdDev is the standard deviation of normal delays
+	StdDev int `yaml:"stddev,omitempty"`
+	// Jitter adds a uniformly random offset of up to +/- Jitter to every delay, drawn per worker
+	Jitter int `yaml:"jitter,omitempty"`
+}
+
+// Pacing represents the target rate of iterations, an iteration being one pass over the endpoints
+type Pacing struct {
+	// IterationsPerMinute is the number of iterations each virtual user (worker) completes per minute, 0 disables pacing
+	IterationsPerMinute int `yaml:"iterations_per_minute"`
+}
+
+// Interval returns the time between the start of two iterations over all virtual users, 0 when pacing is disabled
+func (p Pacing) Interval(users int) time.Duration {
+	if p.IterationsPerMinute <= 0 || users <= 0 {
+		return 0
+	}
+	return time.Minute / time.Duration(p.IterationsPerMinute*users)
 }
 
 // Endpoint represents the configuration for an endpoint to probe
@@ -76,75 +243,469 @@ type Endpoint struct {
 	Body       string            `yaml:"body,omitempty"`
 	Headers    map[string]string `yaml:"headers,omitempty"`
 	AuthConfig *AuthConfig       `yaml:"auth,omitempty"`
+	Owner      string            `yaml:"owner,omitempty"`
+	SLAMS      int               `yaml:"sla_ms,omitempty"`
+	Proxy      *ProxyConfig      `yaml:"proxy,omitempty"`
+	// TimeoutMS overrides the global request timeout for this endpoint
+	TimeoutMS int `yaml:"timeout_ms,omitempty"`
+	// Weight is the relative share of requests sent to this endpoint, defaults to 1
+	Weight int `yaml:"weight,omitempty"`
+	// MaxInFlight limits the concurrent requests to this endpoint, 0 means limited by concurrent_requests only
+	MaxInFlight int `yaml:"max_in_flight,omitempty"`
+	// BodyGenerator streams a generated body instead of Body, e.g. for large upload tests
+	BodyGenerator *BodyGenerator `yaml:"body_generator,omitempty"`
+	// Capture stores values of the response in variables for later requests
+	Capture []Capture `yaml:"capture,omitempty"`
+	// Delay replaces delay_between for this endpoint, e.g. a longer pause before a checkout than between page views
+	Delay *Delay `yaml:"delay,omitempty"`
+	// ExpectedStatus lists the status codes counted as success, by default any status code below 400
+	ExpectedStatus StatusCodes `yaml:"expected_status,omitempty"`
+	// BodyFile streams the body from a file instead of Body, e.g. for large payloads
+	BodyFile string `yaml:"body_file,omitempty"`
+	// Multipart sends a multipart/form-data body with form fields and file uploads
+	Multipart *Multipart `yaml:"multipart,omitempty"`
+	// BodyBase64 is a binary body encoded as base64, e.g. a protobuf message or a compressed payload
+	BodyBase64 string `yaml:"body_base64,omitempty"`
+	// ContentEncoding declares the encoding the body is already in, e.g. gzip for a compressed body_base64 or body_file
+	ContentEncoding string `yaml:"content_encoding,omitempty"`
+	// Service is the name of a registry service, the endpoint is probed on every healthy instance of it with the host
+	// of URL replaced by the address of the instance
+	Service string `yaml:"service,omitempty"`
+	// CompressRequest compresses the body of every request with gzip, deflate or br and sets its Content-Encoding
+	CompressRequest string `yaml:"compress_request,omitempty"`
+	// ExpectEncoding fails responses not served with this content encoding, identity for uncompressed responses.
+	// It is also sent as Accept-Encoding unless the endpoint sets that header
+	ExpectEncoding string `yaml:"expect_encoding,omitempty"`
+	// QueryParams are appended to the query string of URL, escaped, after variables are substituted in their values
+	QueryParams map[string]string `yaml:"query_params,omitempty"`
+	// LatencyPerKB also reports the response time per kilobyte of response body, for download-heavy endpoints
+	LatencyPerKB bool `yaml:"latency_per_kb,omitempty"`
+	// Assertions are checked against every successful response, a failing assertion fails the request
+	Assertions []Assertion `yaml:"assert,omitempty"`
+	// Ramp gives the endpoint its own workers, ramped from start_workers to end_workers
+	Ramp *Ramp `yaml:"ramp,omitempty"`
+	// Priority is critical, normal or bulk. When adaptive concurrency exhausts its limit, bulk requests are shed and
+	// critical requests are sent before the waiting normal ones
+	Priority string `yaml:"priority,omitempty"`
+	// CORS is the CORS preflight check of the endpoint, sent once before the load
+	CORS *CORSCheck `yaml:"cors,omitempty"`
+	// Hooks are expressions run before every request and after every successful response, e.g. to sign requests
+	Hooks *Hooks `yaml:"hooks,omitempty"`
+	// Instance is the address of the registry instance the requests are sent to, set on the endpoints resolved from a
+	// service
+	Instance string `yaml:"-"`
+}
+
+// RequestURL returns the URL with the escaped query parameters appended, sorted by name. The URL is not parsed and
+// re-encoded, so its path and existing query are sent as configured
+func (e Endpoint) RequestURL() string {
+	if len(e.QueryParams) == 0 {
+		return e.URL
+	}
+	values := make(url.Values, len(e.QueryParams))
+	for key, value := range e.QueryParams {
+		values.Set(key, value)
+	}
+
+	base, fragment, hasFragment := strings.Cut(e.URL, "#")
+	switch {
+	case !strings.Contains(base, "?"):
+		base += "?"
+	case !strings.HasSuffix(base, "?") && !strings.HasSuffix(base, "&"):
+		base += "&"
+	}
+	base += values.Encode()
+	if hasFragment {
+		base += "#" + fragment
+	}
+	return base
 }
 
-// LoadConfig loads the config from YAML and environment variables
+// LoadConfig loads the config from YAML and environment variables. The filename can be a comma separated list of
+// files and directories, which are merged with the files they include
 func LoadConfig(filename string, logger *slog.Logger) (*Config, error) {
+	return LoadProfile(filename, "", logger)
+}
+
+// LoadProfile loads the config like LoadConfig and applies the named profile, no profile is applied when it is empty
+func LoadProfile(filename, profile string, logger *slog.Logger) (*Config, error) {
 	if envErr := godotenv.Load(); envErr != nil {
 		logger.Debug("No .env file found, continuing with YAML config")
 	}
 
-	data, err := os.ReadFile(filename)
+	data, err := readConfigData(filename)
 	if err != nil {
 		logger.Error("Failed to read config file", "file", filename, "error", err)
 		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
 
+	// unknown keys are rejected, a misspelled key would otherwise silently fall back to its default
 	var config Config
-	err = yaml.Unmarshal(data, &config)
+	err = yaml.UnmarshalWithOptions(data, &config, yaml.Strict())
 	if err != nil {
+		err = unknownFieldHint(err)
 		logger.Error("Failed to parse YAML", "file", filename, "error", err)
 		return nil, fmt.Errorf("error parsing YAML: %w", err)
 	}
 
-	replaceEnvVariables(&config, logger)
+	// scan before the references are resolved, only values committed in the file are a concern
+	warnSecrets(&config, filename, logger)
+	if err := applyProfile(&config, profile); err != nil {
+		logger.Error("Invalid profile", "file", filename, "profile", profile, "error", err)
+		return nil, fmt.Errorf("error applying profile: %w", err)
+	}
+	if profile != "" {
+		logger.Info("Profile applied", "profile", profile)
+	}
+	if err := prepareConfig(&config, filename, logger); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Config loaded successfully", "file", filename)
+	return &config, nil
+}
+
+// prepareConfig resolves the references of a parsed or built config, validates it and applies the defaults, source
+// names the config in the logs
+func prepareConfig(config *Config, source string, logger *slog.Logger) error {
+	if err := resolveReferences(context.Background(), config, logger); err != nil {
+		logger.Error("Failed to resolve config reference", "file", source, "error", err)
+		return fmt.Errorf("error resolving config: %w", err)
+	}
+	registerSecrets(config)
+
+	if err := validateMethods(&config.ProbingConfig, logger); err != nil {
+		logger.Error("Invalid endpoint method", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateNetwork(config.ProbingConfig); err != nil {
+		logger.Error("Invalid network config", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if config.ProbingConfig.Pacing.IterationsPerMinute < 0 {
+		logger.Error("Invalid pacing", "file", source, "iterations_per_minute", config.ProbingConfig.Pacing.IterationsPerMinute)
+		return fmt.Errorf("error validating config: iterations_per_minute must not be negative")
+	}
+
+	if slices.Contains(config.ProbingConfig.BreakdownHeaders, "") {
+		logger.Error("Invalid breakdown headers", "file", source)
+		return fmt.Errorf("error validating config: breakdown_headers must not contain empty names")
+	}
+
+	if config.ProbingConfig.Audit.BodyBytes < 0 {
+		logger.Error("Invalid audit", "file", source, "body_bytes", config.ProbingConfig.Audit.BodyBytes)
+		return fmt.Errorf("error validating config: audit body_bytes must not be negative")
+	}
+
+	if err := validateWebhook(config.ProbingConfig.ProgressWebhook); err != nil {
+		logger.Error("Invalid progress webhook", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateHealthCheck(config.ProbingConfig.HealthCheck); err != nil {
+		logger.Error("Invalid health check", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateResultStream(config.ProbingConfig.ResultStream); err != nil {
+		logger.Error("Invalid result stream", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateControl(config.ProbingConfig.Control); err != nil {
+		logger.Error("Invalid control API", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateMetrics(config.ProbingConfig.Metrics); err != nil {
+		logger.Error("Invalid metrics", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateHistory(config.History); err != nil {
+		logger.Error("Invalid history", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateSchedule(config.Schedule); err != nil {
+		logger.Error("Invalid schedule", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateAlerts(config.Schedule, config.ProbingConfig); err != nil {
+		logger.Error("Invalid alert", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateAdaptive(config.ProbingConfig); err != nil {
+		logger.Error("Invalid adaptive concurrency", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateBackpressure(config.ProbingConfig); err != nil {
+		logger.Error("Invalid backpressure", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateMode(config.ProbingConfig); err != nil {
+		logger.Error("Invalid mode", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateEngine(config.ProbingConfig); err != nil {
+		logger.Error("Invalid engine", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateRamps(config.ProbingConfig); err != nil {
+		logger.Error("Invalid endpoint ramp", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validatePriorities(config.ProbingConfig); err != nil {
+		logger.Error("Invalid endpoint priority", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateCORS(config.ProbingConfig); err != nil {
+		logger.Error("Invalid CORS check", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateMiddleware(config.ProbingConfig); err != nil {
+		logger.Error("Invalid middleware", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateHooks(config.ProbingConfig); err != nil {
+		logger.Error("Invalid hooks", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateScenarios(config.ProbingConfig); err != nil {
+		logger.Error("Invalid scenario", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateVirtualUsers(config.ProbingConfig); err != nil {
+		logger.Error("Invalid virtual users", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateCaptures(config.ProbingConfig); err != nil {
+		logger.Error("Invalid capture", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateBodies(config.ProbingConfig); err != nil {
+		logger.Error("Invalid endpoint body", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateEndpointOverrides(config.ProbingConfig); err != nil {
+		logger.Error("Invalid endpoint override", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateRegistry(config.ProbingConfig); err != nil {
+		logger.Error("Invalid service registry", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateAssertions(config.ProbingConfig); err != nil {
+		logger.Error("Invalid assertion", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateRetryAfter(config.ProbingConfig.RetryAfter); err != nil {
+		logger.Error("Invalid retry_after", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateRunDuration(config.ProbingConfig); err != nil {
+		logger.Error("Invalid run duration", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateSLO(config.ProbingConfig.SLO); err != nil {
+		logger.Error("Invalid SLO", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateThresholds(config.ProbingConfig); err != nil {
+		logger.Error("Invalid threshold", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
+
+	if err := validateRunIDHeader(config.ProbingConfig.RunIDHeader); err != nil {
+		logger.Error("Invalid run ID header", "file", source, "error", err)
+		return fmt.Errorf("error validating config: %w", err)
+	}
 
 	if config.ProbingConfig.RequestTimeoutMS == 0 {
 		config.ProbingConfig.RequestTimeoutMS = DefaultRequestTimeout
 	}
+	if config.ProbingConfig.ProgressWebhook.URL != "" && config.ProbingConfig.ProgressWebhook.IntervalMS == 0 {
+		config.ProbingConfig.ProgressWebhook.IntervalMS = DefaultWebhookInterval
+	}
+	return nil
+}
 
-	logger.Info("Config loaded successfully", "file", filename)
-	return &config, nil
+// validateRunDuration checks that the run deadline and the drain timeout are not negative
+func validateRunDuration(probing ProbingConfig) error {
+	if probing.MaxDurationMS < 0 {
+		return fmt.Errorf("max_duration_ms must not be negative")
+	}
+	if probing.DrainTimeoutMS < 0 {
+		return fmt.Errorf("drain_timeout_ms must not be negative")
+	}
+	return nil
+}
+
+// headerName matches the token characters a header name consists of
+var headerName = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// validateRunIDHeader checks that the run ID header is a valid header name when set
+func validateRunIDHeader(name string) error {
+	if name != "" && !headerName.MatchString(name) {
+		return fmt.Errorf("run_id_header %q is not a valid header name", name)
+	}
+	return nil
+}
+
+// validateEndpointOverrides checks delay_between and the per-endpoint timeout, weight, concurrency, query parameters
+// and delay
+func validateEndpointOverrides(probing ProbingConfig) error {
+	if err := probing.DelayBetween.validate(); err != nil {
+		return fmt.Errorf("delay_between %w", err)
+	}
+	for _, endpoint := range probing.endpointRefs() {
+		if endpoint.TimeoutMS < 0 {
+			return fmt.Errorf("endpoint %s: timeout_ms must not be negative", endpoint.URL)
+		}
+		if endpoint.Weight < 0 {
+			return fmt.Errorf("endpoint %s: weight must not be negative", endpoint.URL)
+		}
+		if endpoint.MaxInFlight < 0 {
+			return fmt.Errorf("endpoint %s: max_in_flight must not be negative", endpoint.URL)
+		}
+		if _, ok := endpoint.QueryParams[""]; ok {
+			return fmt.Errorf("endpoint %s: query_params names must not be empty", endpoint.URL)
+		}
+		if endpoint.Delay != nil {
+			if err := endpoint.Delay.validate(); err != nil {
+				return fmt.Errorf("endpoint %s: delay %w", endpoint.URL, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks that the delay is not negative, that a random delay has a range to pick from and that the
+// distributions have their parameters
+func (d Delay) validate() error {
+	if !d.Enabled {
+		return nil
+	}
+	if d.Min < 0 || d.Max < 0 || d.Fixed < 0 || d.Mean < 0 || d.StdDev < 0 || d.Jitter < 0 {
+		return fmt.Errorf("must not be negative")
+	}
+	switch d.Type {
+	case "", DelayFixed:
+	case DelayRandom:
+		if d.Max <= d.Min {
+			return fmt.Errorf("max must be greater than min")
+		}
+	case DelayExponential, DelayNormal:
+		if d.Mean == 0 {
+			return fmt.Errorf("mean is required for the %s type", d.Type)
+		}
+		if d.Type == DelayNormal && d.StdDev == 0 {
+			return fmt.Errorf("stddev is required for the normal type")
+		}
+		if d.Max > 0 && d.Max <= d.Min {
+			return fmt.Errorf("max must be greater than min")
+		}
+	default:
+		return fmt.Errorf("type must be fixed, random, exponential or normal, got %q", d.Type)
+	}
+	return nil
 }
 
-// replaceEnvVariables replaces environment variables for authentication configuration
-func replaceEnvVariables(config *Config, logger *slog.Logger) {
-	replaceAuthEnvVars(&config.Auth, logger)
+// validateWebhook checks the progress webhook URL and interval
+func validateWebhook(webhook WebhookConfig) error {
+	if webhook.URL == "" {
+		return nil
+	}
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid progress_webhook url: %q", webhook.URL)
+	}
+	if webhook.IntervalMS < 0 {
+		return fmt.Errorf("progress_webhook interval_ms must not be negative")
+	}
+	return nil
+}
 
-	for i := range config.ProbingConfig.Endpoints {
-		if config.ProbingConfig.Endpoints[i].AuthConfig != nil {
-			replaceAuthEnvVars(config.ProbingConfig.Endpoints[i].AuthConfig, logger)
+// validateResultStream checks that the result stream listen addresses are valid hosts and ports
+func validateResultStream(stream StreamConfig) error {
+	if stream.Listen != "" {
+		if _, _, err := net.SplitHostPort(stream.Listen); err != nil {
+			return fmt.Errorf("invalid result_stream listen address %q: %w", stream.Listen, err)
+		}
+	}
+	if stream.GRPCListen != "" {
+		if _, _, err := net.SplitHostPort(stream.GRPCListen); err != nil {
+			return fmt.Errorf("invalid result_stream grpc_listen address %q: %w", stream.GRPCListen, err)
 		}
 	}
+	if stream.Listen != "" && stream.Listen == stream.GRPCListen {
+		return fmt.Errorf("result_stream listen and grpc_listen must be different addresses")
+	}
+	return nil
+}
+
+// validateControl checks that the control API listen address is a valid host and port
+func validateControl(control ControlConfig) error {
+	if control.MaxWorkers < 0 {
+		return fmt.Errorf("control max_workers must not be negative")
+	}
+	if control.Listen == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(control.Listen); err != nil {
+		return fmt.Errorf("invalid control listen address %q: %w", control.Listen, err)
+	}
+	return control.CheckToken()
+}
+
+// CheckToken reports an error when the control API listens on another address than localhost without a token, as
+// anyone reaching it could otherwise pause, stop or scale the run
+func (c ControlConfig) CheckToken() error {
+	if c.Token != "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(c.Listen)
+	if err != nil || !IsLoopback(host) {
+		return fmt.Errorf("control listen address %q requires a token, only localhost may be served without one", c.Listen)
+	}
+	return nil
 }
 
-// replaceAuthEnvVars replaces environment variables in an AuthConfig
-func replaceAuthEnvVars(auth *AuthConfig, logger *slog.Logger) {
-	auth.Basic.Username = replaceEnv(auth.Basic.Username, logger)
-	auth.Basic.Password = replaceEnv(auth.Basic.Password, logger)
-	auth.APIKey.Header = replaceEnv(auth.APIKey.Header, logger)
-	auth.APIKey.Value = replaceEnv(auth.APIKey.Value, logger)
-	auth.OAuth2.TokenURL = replaceEnv(auth.OAuth2.TokenURL, logger)
-	auth.OAuth2.ClientID = replaceEnv(auth.OAuth2.ClientID, logger)
-	auth.OAuth2.ClientSecret = replaceEnv(auth.OAuth2.ClientSecret, logger)
-	auth.OAuth2.GrantType = replaceEnv(auth.OAuth2.GrantType, logger)
-	auth.OAuth2.Username = replaceEnv(auth.OAuth2.Username, logger)
-	auth.OAuth2.Password = replaceEnv(auth.OAuth2.Password, logger)
+// IsLoopback reports whether the host, a name or an IP address, is the local machine. Connections to it do not leave
+// the machine, so the control APIs may be served unauthenticated and unencrypted on it
+func IsLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
 
+// reference patterns of the $() and ${} syntax
 var (
 	regexCurlyBraces = regexp.MustCompile(`\$\{([^}]+)}`)
 	regexParentheses = regexp.MustCompile(`\$\(([^)]+)\)`)
 )
-
-// replaceEnv replaces environment variables in a string
-func replaceEnv(value string, logger *slog.Logger) string {
-	if match := regexCurlyBraces.FindStringSubmatch(value); match != nil {
-		logger.Debug("Replacing environment variable with value", "variable", match[1], "value", os.Getenv(match[1]))
-		return os.Getenv(match[1])
-	} else if match := regexParentheses.FindStringSubmatch(value); match != nil {
-		logger.Debug("Replacing environment variable with value", "variable", match[1], "value", os.Getenv(match[1]))
-		return os.Getenv(match[1])
-	}
-	return value
-}
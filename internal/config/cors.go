@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// CORSCheck configures the CORS preflight request sent for an endpoint before the load, the Access-Control headers
+// of the response must allow the origin, the method and the headers
+type CORSCheck struct {
+	Origin string `yaml:"origin"`
+	// Method is announced in Access-Control-Request-Method, defaults to the method of the endpoint
+	Method string `yaml:"method,omitempty"`
+	// Headers are announced in Access-Control-Request-Headers and must be allowed
+	Headers []string `yaml:"headers,omitempty"`
+	// Credentials requires Access-Control-Allow-Credentials: true, which also rules out wildcards
+	Credentials bool `yaml:"credentials,omitempty"`
+	// ExpectedStatus are the status codes of a passed preflight, defaults to any code below 400
+	ExpectedStatus StatusCodes `yaml:"expected_status,omitempty"`
+}
+
+// RequestMethod returns the method announced by the preflight of the endpoint
+func (c CORSCheck) RequestMethod(endpoint Endpoint) string {
+	if c.Method != "" {
+		return c.Method
+	}
+	return endpoint.Method
+}
+
+// validateCORS checks the CORS checks of the endpoints, the origin must be a scheme and a host like a browser sends it
+func validateCORS(probing ProbingConfig) error {
+	for _, endpoint := range probing.Endpoints {
+		if endpoint.CORS == nil {
+			continue
+		}
+		if u, err := url.Parse(endpoint.CORS.Origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			return fmt.Errorf("endpoint %s: cors origin must be a scheme and a host, got %q", endpoint.URL, endpoint.CORS.Origin)
+		}
+	}
+	for _, scenario := range probing.Scenarios {
+		for _, step := range scenario.Steps {
+			if step.CORS != nil {
+				return fmt.Errorf("scenario %s step %s: cors is only supported on endpoints", scenario.Name, step.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dasvh/enchante/internal/accesslog"
+)
+
+// load models of the engine
+const (
+	// EngineClosed is a fixed number of workers sending the next request when the previous one finished, the default
+	EngineClosed = "closed"
+	// EngineOpen sends the requests at a constant arrival rate, independent of how fast the target responds
+	EngineOpen = "open"
+	// EngineReplay sends the requests of an access log with their original timing
+	EngineReplay = "replay"
+)
+
+// EngineConfig represents the load model the requests are generated with
+type EngineConfig struct {
+	// Model is closed, open or replay, defaults to closed
+	Model string `yaml:"model,omitempty"`
+	// RateRPS is the arrival rate of the requests of the open model
+	RateRPS float64 `yaml:"rate_rps,omitempty"`
+	// QueueTimeoutMS is how long an arrival of the open and replay models may wait for a free worker before it is
+	// dropped, defaults to request_timeout_ms
+	QueueTimeoutMS int `yaml:"queue_timeout_ms,omitempty"`
+	// Replay is the access log the replay model sends the requests of
+	Replay ReplayConfig `yaml:"replay,omitempty"`
+}
+
+// ReplayConfig represents the access log replayed by the replay model and where its requests are sent
+type ReplayConfig struct {
+	// File is the path of the access log
+	File string `yaml:"file"`
+	// Format is common, combined or json, defaults to combined
+	Format string `yaml:"format,omitempty"`
+	// Target is the scheme and host the logged requests are sent to, e.g. https://staging.example.com
+	Target string `yaml:"target"`
+	// Speed scales the time between the requests, 2 replays the log twice as fast, defaults to 1
+	Speed float64 `yaml:"speed,omitempty"`
+}
+
+// LogFormat returns the format of the access log, defaults to combined
+func (r ReplayConfig) LogFormat() string {
+	if r.Format == "" {
+		return accesslog.FormatCombined
+	}
+	return r.Format
+}
+
+// Scale returns the factor the time between two logged requests is multiplied with, 1 when no speed is set
+func (r ReplayConfig) Scale() float64 {
+	if r.Speed <= 0 {
+		return 1
+	}
+	return 1 / r.Speed
+}
+
+// Open returns whether the requests are sent at a constant arrival rate
+func (e EngineConfig) Open() bool {
+	return e.Model == EngineOpen
+}
+
+// Replays returns whether the requests of an access log are replayed
+func (e EngineConfig) Replays() bool {
+	return e.Model == EngineReplay
+}
+
+// Interval returns the time between two arrivals of the open model
+func (e EngineConfig) Interval() time.Duration {
+	if e.RateRPS <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / e.RateRPS)
+}
+
+// QueueTimeout returns how long an arrival may wait for a free worker, defaults to the request timeout
+func (e EngineConfig) QueueTimeout(requestTimeoutMS int) time.Duration {
+	if e.QueueTimeoutMS == 0 {
+		return time.Duration(requestTimeoutMS) * time.Millisecond
+	}
+	return time.Duration(e.QueueTimeoutMS) * time.Millisecond
+}
+
+// validateEngine checks the load model. The open model needs an arrival rate and the replay model an access log and
+// a target, both generate the requests themselves, so they can not be combined with virtual users, pacing or the
+// find-max mode
+func validateEngine(probing ProbingConfig) error {
+	engine := probing.Engine
+	switch engine.Model {
+	case "", EngineClosed:
+		return nil
+	case EngineOpen:
+		if engine.RateRPS <= 0 {
+			return fmt.Errorf("engine model %s requires a positive rate_rps", EngineOpen)
+		}
+	case EngineReplay:
+		if err := engine.Replay.validate(probing); err != nil {
+			return fmt.Errorf("engine replay %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown engine model %q, expected %s, %s or %s", engine.Model, EngineClosed, EngineOpen, EngineReplay)
+	}
+	if engine.QueueTimeoutMS < 0 {
+		return fmt.Errorf("engine queue_timeout_ms must not be negative")
+	}
+	if probing.VirtualUsers.Enabled {
+		return fmt.Errorf("engine model %s can not be combined with virtual_users", engine.Model)
+	}
+	if probing.Pacing.IterationsPerMinute > 0 {
+		return fmt.Errorf("engine model %s sets the arrival rate, it can not be combined with pacing", engine.Model)
+	}
+	if probing.Mode == ModeFindMax {
+		return fmt.Errorf("engine model %s can not be combined with mode %s", engine.Model, ModeFindMax)
+	}
+	return nil
+}
+
+// validate checks that the access log can be read in a known format and that the target is an absolute URL. The
+// requests of the replay come from the log, so it can not be combined with endpoints or scenarios
+func (r ReplayConfig) validate(probing ProbingConfig) error {
+	if r.File == "" {
+		return fmt.Errorf("file is required")
+	}
+	if _, err := os.Stat(r.File); err != nil {
+		return fmt.Errorf("file can not be read: %w", err)
+	}
+	if !slices.Contains(accesslog.Formats, r.LogFormat()) {
+		return fmt.Errorf("format %q is unknown, expected one of %s", r.Format, strings.Join(accesslog.Formats, ", "))
+	}
+	target, err := url.Parse(r.Target)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return fmt.Errorf("target %q must be an absolute URL like https://staging.example.com", r.Target)
+	}
+	if r.Speed < 0 {
+		return fmt.Errorf("speed must not be negative")
+	}
+	if len(probing.Endpoints) > 0 || len(probing.Scenarios) > 0 {
+		return fmt.Errorf("sends the requests of the access log, it can not be combined with endpoints or scenarios")
+	}
+	return nil
+}
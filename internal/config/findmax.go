@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ModeFindMax runs steps of increasing request rates until a step breaches the thresholds, to find the maximum rate
+// the target sustains
+const ModeFindMax = "find-max"
+
+// defaults of the find-max mode
+const (
+	DefaultFindMaxStartRPS     = 10
+	DefaultFindMaxStepDuration = 30000
+)
+
+// FindMaxConfig represents the steps of the find-max mode
+type FindMaxConfig struct {
+	// StartRPS is the request rate of the first step, defaults to DefaultFindMaxStartRPS
+	StartRPS float64 `yaml:"start_rps,omitempty"`
+	// StepRPS is added to the rate for every following step, defaults to start_rps
+	StepRPS float64 `yaml:"step_rps,omitempty"`
+	// StepDurationMS is how long every step sends requests, defaults to DefaultFindMaxStepDuration
+	StepDurationMS int `yaml:"step_duration_ms,omitempty"`
+	// MaxRPS ends the search when it is reached, 0 searches until a step is not sustained
+	MaxRPS float64 `yaml:"max_rps,omitempty"`
+}
+
+// Start returns the rate of the first step
+func (f FindMaxConfig) Start() float64 {
+	if f.StartRPS == 0 {
+		return DefaultFindMaxStartRPS
+	}
+	return f.StartRPS
+}
+
+// Step returns the rate increase per step
+func (f FindMaxConfig) Step() float64 {
+	if f.StepRPS == 0 {
+		return f.Start()
+	}
+	return f.StepRPS
+}
+
+// StepDuration returns how long every step sends requests in milliseconds
+func (f FindMaxConfig) StepDuration() int {
+	if f.StepDurationMS == 0 {
+		return DefaultFindMaxStepDuration
+	}
+	return f.StepDurationMS
+}
+
+// validateMode checks the mode of the run and the settings of the find-max mode, which needs thresholds to decide
+// whether a step is sustained
+func validateMode(probing ProbingConfig) error {
+	if probing.Mode == "" {
+		return nil
+	}
+	if probing.Mode != ModeFindMax {
+		return fmt.Errorf("unknown mode %q, expected %s", probing.Mode, ModeFindMax)
+	}
+	if probing.VirtualUsers.Enabled {
+		return fmt.Errorf("mode %s can not be combined with virtual_users", ModeFindMax)
+	}
+	if !slices.ContainsFunc(probing.Thresholds, func(t Threshold) bool { return t.Level() == SeverityFail }) {
+		return fmt.Errorf("mode %s requires a threshold with severity fail", ModeFindMax)
+	}
+	f := probing.FindMax
+	if f.StartRPS < 0 || f.StepRPS < 0 || f.StepDurationMS < 0 || f.MaxRPS < 0 {
+		return fmt.Errorf("find_max settings must not be negative")
+	}
+	if f.MaxRPS > 0 && f.MaxRPS < f.Start() {
+		return fmt.Errorf("find_max max_rps must be at least start_rps (%g)", f.Start())
+	}
+	return nil
+}
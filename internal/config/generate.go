@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/goccy/go-yaml"
+)
+
+// generatedConfig is the config file written for recorded or discovered endpoints
+type generatedConfig struct {
+	Probe generatedProbe `yaml:"probe"`
+}
+
+// generatedProbe holds the probe settings of a generated config file
+type generatedProbe struct {
+	ConcurrentRequests int        `yaml:"concurrent_requests"`
+	TotalRequests      int        `yaml:"total_requests"`
+	Endpoints          []Endpoint `yaml:"endpoints"`
+}
+
+// WriteEndpoints writes a config file probing the endpoints once each, ready to be adjusted
+func WriteEndpoints(w io.Writer, endpoints []Endpoint) error {
+	data, err := yaml.Marshal(generatedConfig{Probe: generatedProbe{ConcurrentRequests: 1, TotalRequests: 1, Endpoints: endpoints}})
+	if err != nil {
+		return fmt.Errorf("error encoding config: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("error writing config: %w", err)
+	}
+	return nil
+}
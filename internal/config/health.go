@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// DefaultHealthInterval is the default interval between health checks in milliseconds
+const DefaultHealthInterval = 1000
+
+// HealthCheck represents a health endpoint of the target polled during the run. While it reports unhealthy the load
+// is paused, a safety valve for runs against shared environments
+type HealthCheck struct {
+	URL string `yaml:"url"`
+	// IntervalMS is the time between checks, defaults to DefaultHealthInterval
+	IntervalMS int `yaml:"interval_ms,omitempty"`
+	// TimeoutMS limits a single check, defaults to the interval
+	TimeoutMS int `yaml:"timeout_ms,omitempty"`
+	// ExpectedStatus lists the status codes of a healthy target, by default any status code below 400
+	ExpectedStatus StatusCodes `yaml:"expected_status,omitempty"`
+	// UnhealthyThreshold is the number of failed checks in a row that pause the load, defaults to 1
+	UnhealthyThreshold int `yaml:"unhealthy_threshold,omitempty"`
+	// HealthyThreshold is the number of passed checks in a row that resume the load, defaults to 1
+	HealthyThreshold int `yaml:"healthy_threshold,omitempty"`
+}
+
+// Interval returns the time between checks in milliseconds
+func (h HealthCheck) Interval() int {
+	if h.IntervalMS == 0 {
+		return DefaultHealthInterval
+	}
+	return h.IntervalMS
+}
+
+// Timeout returns the timeout of a single check in milliseconds
+func (h HealthCheck) Timeout() int {
+	if h.TimeoutMS == 0 {
+		return h.Interval()
+	}
+	return h.TimeoutMS
+}
+
+// Thresholds returns the number of failed checks that pause and of passed checks that resume the load
+func (h HealthCheck) Thresholds() (unhealthy, healthy int) {
+	return max(h.UnhealthyThreshold, 1), max(h.HealthyThreshold, 1)
+}
+
+// validateHealthCheck checks the health check URL and that its settings are not negative
+func validateHealthCheck(check HealthCheck) error {
+	if check.URL == "" {
+		return nil
+	}
+	u, err := url.Parse(check.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid health_check url: %q", check.URL)
+	}
+	if check.IntervalMS < 0 || check.TimeoutMS < 0 || check.UnhealthyThreshold < 0 || check.HealthyThreshold < 0 {
+		return fmt.Errorf("health_check settings must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package config
+
+import "fmt"
+
+// Supported history storage backends
+const (
+	HistoryFile     = "file"
+	HistorySQLite   = "sqlite"
+	HistoryPostgres = "postgres"
+)
+
+// database/sql drivers registered by the binary for the sqlite and postgres backends
+const (
+	defaultSQLiteDriver   = "sqlite"
+	defaultPostgresDriver = "pgx"
+)
+
+// HistoryConfig represents where the reports of past runs are stored, e.g. a shared database for probes running
+// on several instances
+type HistoryConfig struct {
+	// Backend is one of file, sqlite or postgres, history is disabled when empty
+	Backend string `yaml:"backend"`
+	// Path is the directory the file backend stores the runs in
+	Path string `yaml:"path,omitempty"`
+	// DSN is the data source name of the sqlite and postgres backends
+	DSN string `yaml:"dsn,omitempty"`
+	// Driver overrides the database/sql driver name, defaults to sqlite for the sqlite backend and pgx for the postgres
+	// backend, the drivers included in the binary
+	Driver string `yaml:"driver,omitempty"`
+	// Instance identifies the probe instance in the shared history, defaults to the hostname
+	Instance string `yaml:"instance,omitempty"`
+	// Name identifies the config in the history to list the trends of its runs, defaults to the config file path
+	Name string `yaml:"name,omitempty"`
+}
+
+// DriverName returns the database/sql driver of the sqlite and postgres backends
+func (h HistoryConfig) DriverName() string {
+	switch {
+	case h.Driver != "":
+		return h.Driver
+	case h.Backend == HistoryPostgres:
+		return defaultPostgresDriver
+	default:
+		return defaultSQLiteDriver
+	}
+}
+
+// validateHistory checks that the history backend is supported and has its location configured
+func validateHistory(history HistoryConfig) error {
+	switch history.Backend {
+	case "":
+		return nil
+	case HistoryFile:
+		if history.Path == "" {
+			return fmt.Errorf("history path is required for the file backend")
+		}
+	case HistorySQLite, HistoryPostgres:
+		if history.DSN == "" {
+			return fmt.Errorf("history dsn is required for the %s backend", history.Backend)
+		}
+	default:
+		return fmt.Errorf("unsupported history backend: %s", history.Backend)
+	}
+	return nil
+}
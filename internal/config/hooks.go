@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/dasvh/enchante/internal/script"
+)
+
+// Hooks represents the scripting hooks of an endpoint, lists of expressions of the script package run in order
+type Hooks struct {
+	// PreRequest runs before every request, with the variables substituted, and can change its headers and body
+	PreRequest []string `yaml:"pre_request,omitempty"`
+	// PostResponse runs after every successful response and fails the request with assert or fail
+	PostResponse []string `yaml:"post_response,omitempty"`
+}
+
+// Compile compiles the hooks of both phases, a phase without expressions is nil
+func (h *Hooks) Compile() (pre, post *script.Program, err error) {
+	if h == nil {
+		return nil, nil, nil
+	}
+	if len(h.PreRequest) > 0 {
+		if pre, err = script.Compile(h.PreRequest, script.PreRequest); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(h.PostResponse) > 0 {
+		if post, err = script.Compile(h.PostResponse, script.PostResponse); err != nil {
+			return nil, nil, err
+		}
+	}
+	return pre, post, nil
+}
+
+// hookVariables returns the names of the variables the hooks set, hooks that do not compile set none
+func (h *Hooks) hookVariables() []string {
+	var names []string
+	pre, post, err := h.Compile()
+	if err != nil {
+		return nil
+	}
+	for _, program := range []*script.Program{pre, post} {
+		if program != nil {
+			names = append(names, program.Variables()...)
+		}
+	}
+	return names
+}
+
+// validateHooks checks that the hooks of every endpoint compile
+func validateHooks(probing ProbingConfig) error {
+	for _, endpoint := range probing.endpointRefs() {
+		if _, _, err := endpoint.Hooks.Compile(); err != nil {
+			return fmt.Errorf("endpoint %s: hooks: %w", endpoint.URL, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// includeList holds the include directive of a config file, a single path or a list of paths
+type includeList []string
+
+// UnmarshalYAML accepts a single path as well as a list of paths
+func (l *includeList) UnmarshalYAML(unmarshal func(any) error) error {
+	var path string
+	if err := unmarshal(&path); err == nil {
+		*l = includeList{path}
+		return nil
+	}
+	var paths []string
+	if err := unmarshal(&paths); err != nil {
+		return fmt.Errorf("include must be a path or a list of paths")
+	}
+	*l = paths
+	return nil
+}
+
+// readConfigData reads the config files named by filename, a comma separated list of files and directories, and the
+// files they include, and returns them merged into a single YAML document. Files are merged in order, a file after
+// the files it includes: mappings are merged, lists are appended and other values are replaced by later files
+func readConfigData(filename string) ([]byte, error) {
+	var files []string
+	for _, path := range strings.Split(filename, ",") {
+		expanded, err := expandConfigPath(strings.TrimSpace(path))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, expanded...)
+	}
+
+	collected := make(map[string]bool)
+	var docs [][]byte
+	for _, file := range files {
+		if err := collectConfigFile(file, nil, collected, &docs); err != nil {
+			return nil, err
+		}
+	}
+	if len(docs) == 1 {
+		return docs[0], nil
+	}
+
+	merged := map[string]any{}
+	for _, doc := range docs {
+		var values map[string]any
+		if err := yaml.Unmarshal(doc, &values); err != nil {
+			return nil, err
+		}
+		merged = mergeYAML(merged, values).(map[string]any)
+	}
+	delete(merged, "include")
+	return yaml.Marshal(merged)
+}
+
+// configExtensions are the extensions of the config files loaded from a directory
+var configExtensions = []string{".yaml", ".yml", ".json", ".toml"}
+
+// expandConfigPath returns the config files of a directory in lexical order, or the path itself when it is a file
+func expandConfigPath(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && slices.Contains(configExtensions, filepath.Ext(entry.Name())) {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no config files in directory %s", path)
+	}
+	return files, nil
+}
+
+// collectConfigFile appends the documents of the files included by file, relative to its directory, followed by the
+// file itself. A file included more than once is only collected the first time, stack holds the chain of includes
+// to detect cycles
+func collectConfigFile(file string, stack []string, collected map[string]bool, docs *[][]byte) error {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(stack, abs) {
+		return fmt.Errorf("include cycle: %s", strings.Join(append(stack, abs), " -> "))
+	}
+	if collected[abs] {
+		return nil
+	}
+
+	data, err := readConfigFile(file)
+	if err != nil {
+		return err
+	}
+	var header struct {
+		Include includeList `yaml:"include"`
+	}
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	for _, include := range header.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(file), include)
+		}
+		included, err := expandConfigPath(include)
+		if err != nil {
+			return err
+		}
+		for _, path := range included {
+			if err := collectConfigFile(path, append(stack, abs), collected, docs); err != nil {
+				return err
+			}
+		}
+	}
+
+	collected[abs] = true
+	*docs = append(*docs, data)
+	return nil
+}
+
+// mergeYAML merges the value of a later document into the value of an earlier one
+func mergeYAML(base, override any) any {
+	switch o := override.(type) {
+	case map[string]any:
+		b, ok := base.(map[string]any)
+		if !ok {
+			return o
+		}
+		for key, value := range o {
+			b[key] = mergeYAML(b[key], value)
+		}
+		return b
+	case []any:
+		if b, ok := base.([]any); ok {
+			return append(b, o...)
+		}
+		return o
+	case nil:
+		return base
+	default:
+		return o
+	}
+}
+
+// readConfigFile reads a config file as YAML. The format is chosen by the extension: JSON is valid YAML and only
+// checked for syntax errors, TOML is converted, and any other extension is read as YAML
+func readConfigFile(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		var values any
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return data, nil
+	case ".toml":
+		// TOML is decoded into maps and decoded like YAML from there, so both formats share the struct tags
+		var values map[string]any
+		if err := toml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return yaml.Marshal(values)
+	default:
+		return data, nil
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strings"
+)
+
+// bodySemantics describes whether a request body may be sent with a method
+type bodySemantics int
+
+const (
+	bodyAllowed bodySemantics = iota
+	bodyDiscouraged
+	bodyForbidden
+)
+
+// knownMethods lists the supported methods and their request body semantics
+var knownMethods = map[string]bodySemantics{
+	http.MethodGet:     bodyDiscouraged,
+	http.MethodHead:    bodyForbidden,
+	http.MethodPost:    bodyAllowed,
+	http.MethodPut:     bodyAllowed,
+	http.MethodPatch:   bodyAllowed,
+	http.MethodDelete:  bodyDiscouraged,
+	http.MethodOptions: bodyAllowed,
+	http.MethodTrace:   bodyForbidden,
+	// WebDAV
+	"PROPFIND":  bodyAllowed,
+	"PROPPATCH": bodyAllowed,
+	"MKCOL":     bodyAllowed,
+	"COPY":      bodyDiscouraged,
+	"MOVE":      bodyDiscouraged,
+	"LOCK":      bodyAllowed,
+	"UNLOCK":    bodyDiscouraged,
+	"REPORT":    bodyAllowed,
+	"SEARCH":    bodyAllowed,
+	// cache invalidation (Varnish, Fastly, nginx)
+	"PURGE": bodyDiscouraged,
+	"BAN":   bodyDiscouraged,
+}
+
+// CustomMethod represents an HTTP method that is not part of the built-in method list
+type CustomMethod struct {
+	Name      string `yaml:"name"`
+	AllowBody bool   `yaml:"allow_body"`
+}
+
+// validateMethods normalizes the endpoint methods and checks them against the known and custom methods
+func validateMethods(probing *ProbingConfig, logger *slog.Logger) error {
+	methods := make(map[string]bodySemantics, len(knownMethods)+len(probing.CustomMethods))
+	maps.Copy(methods, knownMethods)
+	for _, custom := range probing.CustomMethods {
+		name := strings.ToUpper(custom.Name)
+		if !isToken(name) {
+			return fmt.Errorf("invalid custom method name: %q", custom.Name)
+		}
+		if name == http.MethodConnect {
+			return fmt.Errorf("method %s is not supported", name)
+		}
+		if custom.AllowBody {
+			methods[name] = bodyAllowed
+		} else {
+			methods[name] = bodyForbidden
+		}
+	}
+
+	for _, endpoint := range probing.endpointRefs() {
+		if endpoint.Method == "" {
+			endpoint.Method = http.MethodGet
+		}
+		endpoint.Method = strings.ToUpper(endpoint.Method)
+
+		semantics, ok := methods[endpoint.Method]
+		if !ok {
+			return fmt.Errorf("unsupported method %q for endpoint %s, declare it in custom_methods", endpoint.Method, endpoint.URL)
+		}
+
+		if !endpoint.HasBody() {
+			continue
+		}
+		switch semantics {
+		case bodyForbidden:
+			return fmt.Errorf("method %s does not allow a request body for endpoint %s", endpoint.Method, endpoint.URL)
+		case bodyDiscouraged:
+			logger.Warn("Request body has no defined semantics for method and may be ignored by the server",
+				"method", endpoint.Method, "url", endpoint.URL)
+		}
+	}
+
+	return nil
+}
+
+// isToken reports whether s is a valid HTTP token as defined in RFC 9110
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c >= 0x7f || c <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// StatsD formats, DogStatsD tags the metrics while plain StatsD has the endpoint in the metric names
+const (
+	StatsDFormatDogStatsD = "dogstatsd"
+	StatsDFormatStatsD    = "statsd"
+)
+
+// MetricsConfig configures the monitoring systems the results of a run are emitted to while it runs
+type MetricsConfig struct {
+	StatsD StatsDConfig `yaml:"statsd,omitempty"`
+	// InfluxDB and Timescale store a data point per request, for dashboards over historical runs
+	InfluxDB  InfluxDBConfig  `yaml:"influxdb,omitempty"`
+	Timescale TimescaleConfig `yaml:"timescale,omitempty"`
+}
+
+// InfluxDBConfig configures the export of the requests to InfluxDB with the line protocol
+type InfluxDBConfig struct {
+	// URL is the address of the server, e.g. http://localhost:8086, no data is exported when it is empty
+	URL string `yaml:"url"`
+	// Token authenticates the writes, e.g. ${INFLUX_TOKEN}
+	Token string `yaml:"token,omitempty"`
+	// Org and Bucket are the destination of the InfluxDB 2 write API
+	Org    string `yaml:"org,omitempty"`
+	Bucket string `yaml:"bucket,omitempty"`
+	// Database is the destination of the InfluxDB 1 write API, used instead of the bucket when set
+	Database string `yaml:"database,omitempty"`
+	// Measurement is the name of the data points, enchante_request by default
+	Measurement string `yaml:"measurement,omitempty"`
+	// FlushIntervalMS is how often the buffered data points are written, 1000 by default
+	FlushIntervalMS int `yaml:"flush_interval_ms,omitempty"`
+}
+
+// TimescaleConfig configures the export of the requests to a table of TimescaleDB or Postgres
+type TimescaleConfig struct {
+	// DSN is the data source name of the database, no data is exported when it is empty
+	DSN string `yaml:"dsn"`
+	// Driver overrides the database/sql driver name, pgx by default, the Postgres driver included in the binary
+	Driver string `yaml:"driver,omitempty"`
+	// Table is the table the requests are inserted into, enchante_requests by default
+	Table string `yaml:"table,omitempty"`
+	// Hypertable turns a new table into a TimescaleDB hypertable partitioned by time
+	Hypertable bool `yaml:"hypertable,omitempty"`
+	// FlushIntervalMS is how often the buffered rows are inserted, 1000 by default
+	FlushIntervalMS int `yaml:"flush_interval_ms,omitempty"`
+}
+
+// StatsDConfig configures the emission of the results to StatsD or the DogStatsD server of the Datadog agent
+type StatsDConfig struct {
+	// Address is the host and UDP port of the server, e.g. localhost:8125, no metrics are emitted when it is empty
+	Address string `yaml:"address"`
+	// Prefix is prepended to the metric names, enchante. by default
+	Prefix string `yaml:"prefix,omitempty"`
+	// Format is dogstatsd or statsd, dogstatsd by default
+	Format string `yaml:"format,omitempty"`
+	// Tags are added to every metric, e.g. env:staging, they are only sent in the dogstatsd format
+	Tags []string `yaml:"tags,omitempty"`
+	// FlushIntervalMS is how often the buffered metrics are sent, 1000 by default
+	FlushIntervalMS int `yaml:"flush_interval_ms,omitempty"`
+}
+
+// defaults of the metric sinks
+const (
+	defaultStatsDPrefix      = "enchante."
+	defaultFlushIntervalMS   = 1000
+	defaultInfluxMeasurement = "enchante_request"
+	defaultTimescaleDriver   = defaultPostgresDriver
+	defaultTimescaleTable    = "enchante_requests"
+)
+
+// MetricPrefix returns the prefix of the metric names
+func (c StatsDConfig) MetricPrefix() string {
+	if c.Prefix == "" {
+		return defaultStatsDPrefix
+	}
+	return c.Prefix
+}
+
+// MetricFormat returns the format of the metrics
+func (c StatsDConfig) MetricFormat() string {
+	if c.Format == "" {
+		return StatsDFormatDogStatsD
+	}
+	return c.Format
+}
+
+// FlushInterval returns how often the buffered metrics are sent in milliseconds
+func (c StatsDConfig) FlushInterval() int {
+	return flushInterval(c.FlushIntervalMS)
+}
+
+// MeasurementName returns the name of the data points
+func (c InfluxDBConfig) MeasurementName() string {
+	if c.Measurement == "" {
+		return defaultInfluxMeasurement
+	}
+	return c.Measurement
+}
+
+// FlushInterval returns how often the buffered data points are written in milliseconds
+func (c InfluxDBConfig) FlushInterval() int {
+	return flushInterval(c.FlushIntervalMS)
+}
+
+// DriverName returns the database/sql driver of the database
+func (c TimescaleConfig) DriverName() string {
+	if c.Driver == "" {
+		return defaultTimescaleDriver
+	}
+	return c.Driver
+}
+
+// TableName returns the table the requests are inserted into
+func (c TimescaleConfig) TableName() string {
+	if c.Table == "" {
+		return defaultTimescaleTable
+	}
+	return c.Table
+}
+
+// FlushInterval returns how often the buffered rows are inserted in milliseconds
+func (c TimescaleConfig) FlushInterval() int {
+	return flushInterval(c.FlushIntervalMS)
+}
+
+// flushInterval returns the configured flush interval or the default
+func flushInterval(ms int) int {
+	if ms == 0 {
+		return defaultFlushIntervalMS
+	}
+	return ms
+}
+
+// validateMetrics checks the addresses, formats and intervals of the metric sinks
+func validateMetrics(metrics MetricsConfig) error {
+	if err := validateStatsD(metrics.StatsD); err != nil {
+		return err
+	}
+	if err := validateInfluxDB(metrics.InfluxDB); err != nil {
+		return err
+	}
+	return validateTimescale(metrics.Timescale)
+}
+
+// validateStatsD checks the address, format and tags of the StatsD emission
+func validateStatsD(statsd StatsDConfig) error {
+	if statsd.Address == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(statsd.Address); err != nil {
+		return fmt.Errorf("invalid statsd address %q: %w", statsd.Address, err)
+	}
+	if !slices.Contains([]string{StatsDFormatDogStatsD, StatsDFormatStatsD}, statsd.MetricFormat()) {
+		return fmt.Errorf("invalid statsd format %q, must be %s or %s", statsd.Format, StatsDFormatDogStatsD, StatsDFormatStatsD)
+	}
+	if statsd.FlushIntervalMS < 0 {
+		return fmt.Errorf("statsd flush_interval_ms must not be negative")
+	}
+	for _, tag := range statsd.Tags {
+		if tag == "" || strings.ContainsAny(tag, ",|#\n") {
+			return fmt.Errorf("invalid statsd tag %q", tag)
+		}
+	}
+	return nil
+}
+
+// validateInfluxDB checks the URL and the destination of the InfluxDB export
+func validateInfluxDB(influx InfluxDBConfig) error {
+	if influx.URL == "" {
+		return nil
+	}
+	if u, err := url.Parse(influx.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid influxdb url %q", influx.URL)
+	}
+	if influx.Database == "" && (influx.Org == "" || influx.Bucket == "") {
+		return fmt.Errorf("influxdb requires org and bucket, or database for InfluxDB 1")
+	}
+	if influx.FlushIntervalMS < 0 {
+		return fmt.Errorf("influxdb flush_interval_ms must not be negative")
+	}
+	return nil
+}
+
+// sqlIdentifier matches the table names that can be used in statements without quoting
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// validateTimescale checks the table name and interval of the Timescale export
+func validateTimescale(timescale TimescaleConfig) error {
+	if timescale.DSN == "" {
+		return nil
+	}
+	if !sqlIdentifier.MatchString(timescale.TableName()) {
+		return fmt.Errorf("invalid timescale table %q, must be a plain or schema qualified name", timescale.Table)
+	}
+	if timescale.FlushIntervalMS < 0 {
+		return fmt.Errorf("timescale flush_interval_ms must not be negative")
+	}
+	return nil
+}
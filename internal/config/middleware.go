@@ -0,0 +1,30 @@
+package config
+
+import "fmt"
+
+// Middleware represents a middleware of the request lifecycle, run before every request is sent and after its
+// response in the configured order
+type Middleware struct {
+	// Type selects the middleware: logging, headers, signing, metrics or a custom type registered in the middleware
+	// package
+	Type string `yaml:"type"`
+	// Headers are the headers the headers type adds to every request that does not set them
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Secret is the key the signing type signs the requests with
+	Secret string `yaml:"secret,omitempty"`
+	// Header is the header the signing type sets, defaults to X-Signature
+	Header string `yaml:"header,omitempty"`
+	// Args holds the settings of custom middleware types
+	Args map[string]string `yaml:"args,omitempty"`
+}
+
+// validateMiddleware checks that every middleware has a type, the settings of each type are checked when the
+// middlewares are created at the start of the run
+func validateMiddleware(probing ProbingConfig) error {
+	for i, middleware := range probing.Middleware {
+		if middleware.Type == "" {
+			return fmt.Errorf("middleware %d has no type", i+1)
+		}
+	}
+	return nil
+}
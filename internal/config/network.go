@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// NetworkConfig represents the configuration of the outbound connections
+type NetworkConfig struct {
+	SourceIP       string `yaml:"source_ip,omitempty"`
+	LocalPortRange string `yaml:"local_port_range,omitempty"`
+	// BandwidthLimitKbps caps the egress bandwidth of the whole run in kilobits per second, 0 means unlimited
+	BandwidthLimitKbps int `yaml:"bandwidth_limit_kbps,omitempty"`
+	// PinDNS resolves the endpoint hosts once at the start of the run and connects to these addresses for the whole run
+	PinDNS bool `yaml:"pin_dns,omitempty"`
+	// ReuseConnections keeps connections open between requests and resumes TLS sessions on new connections, instead
+	// of opening a new connection with a full handshake for every request
+	ReuseConnections bool `yaml:"reuse_connections,omitempty"`
+}
+
+// LocalIP returns the parsed source IP, nil when not configured
+func (n NetworkConfig) LocalIP() (net.IP, error) {
+	if n.SourceIP == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(n.SourceIP)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid source_ip: %q", n.SourceIP)
+	}
+	return ip, nil
+}
+
+// PortRange returns the parsed local port range, 0-0 when not configured
+func (n NetworkConfig) PortRange() (int, int, error) {
+	if n.LocalPortRange == "" {
+		return 0, 0, nil
+	}
+
+	low, high, found := strings.Cut(n.LocalPortRange, "-")
+	if !found {
+		high = low
+	}
+	minPort, err := strconv.Atoi(strings.TrimSpace(low))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid local_port_range: %q", n.LocalPortRange)
+	}
+	maxPort, err := strconv.Atoi(strings.TrimSpace(high))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid local_port_range: %q", n.LocalPortRange)
+	}
+	if minPort < 1 || maxPort > 65535 || minPort > maxPort {
+		return 0, 0, fmt.Errorf("invalid local_port_range: %q, expected a range within 1-65535", n.LocalPortRange)
+	}
+	return minPort, maxPort, nil
+}
+
+// validateNetwork checks the network and proxy configuration
+func validateNetwork(probing ProbingConfig) error {
+	if _, err := probing.Network.LocalIP(); err != nil {
+		return err
+	}
+	if _, _, err := probing.Network.PortRange(); err != nil {
+		return err
+	}
+	if probing.Network.BandwidthLimitKbps < 0 {
+		return fmt.Errorf("invalid bandwidth_limit_kbps: %d, must not be negative", probing.Network.BandwidthLimitKbps)
+	}
+
+	if _, err := probing.Proxy.ProxyURL(); err != nil {
+		return err
+	}
+	for _, endpoint := range probing.endpointRefs() {
+		if endpoint.Proxy == nil {
+			continue
+		}
+		if _, err := endpoint.Proxy.ProxyURL(); err != nil {
+			return fmt.Errorf("endpoint %s: %w", endpoint.URL, err)
+		}
+	}
+	return nil
+}
+
+// ProxyConfig represents the configuration of a proxy, the URL scheme selects the proxy type
+type ProxyConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	URL      string `yaml:"url"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+}
+
+// ProxyURL returns the proxy URL including the credentials, nil when the proxy is disabled
+func (p ProxyConfig) ProxyURL() (*url.URL, error) {
+	if !p.Enabled {
+		return nil, nil
+	}
+
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https, socks5 or socks5h", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url: %q has no host", p.URL)
+	}
+
+	if p.Username != "" {
+		u.User = url.UserPassword(p.Username, p.Password)
+	}
+	return u, nil
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// endpoint priorities, deciding which requests keep running when the concurrency budget is exhausted
+const (
+	PriorityCritical = "critical"
+	PriorityNormal   = "normal"
+	PriorityBulk     = "bulk"
+)
+
+// priorities are the accepted values of priority
+var priorities = []string{PriorityCritical, PriorityNormal, PriorityBulk}
+
+// PriorityClass returns the priority of the endpoint, normal when none is configured
+func (e Endpoint) PriorityClass() string {
+	if e.Priority == "" {
+		return PriorityNormal
+	}
+	return e.Priority
+}
+
+// validatePriorities checks the priority of the endpoints, steps of a scenario depend on each other and cannot be shed
+func validatePriorities(probing ProbingConfig) error {
+	for _, endpoint := range probing.Endpoints {
+		if endpoint.Priority != "" && !slices.Contains(priorities, endpoint.Priority) {
+			return fmt.Errorf("endpoint %s: priority must be one of %v, got %q", endpoint.URL, priorities, endpoint.Priority)
+		}
+	}
+	for _, scenario := range probing.Scenarios {
+		for _, step := range scenario.Steps {
+			if step.Priority != "" {
+				return fmt.Errorf("scenario %s step %s: priority is only supported on endpoints", scenario.Name, step.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Profile represents the settings of an environment, e.g. staging, so one config can target several environments
+type Profile struct {
+	// BaseURL is prepended to the endpoint and step URLs starting with a slash
+	BaseURL string `yaml:"base_url,omitempty"`
+	// Auth replaces the global authentication
+	Auth *AuthConfig `yaml:"auth,omitempty"`
+	// Variables replace their {{name}} references anywhere in the config
+	Variables map[string]string `yaml:"variables,omitempty"`
+}
+
+// applyProfile applies the named profile to the config and drops the profiles, so the references of the other
+// profiles are not resolved. Without a name the profiles are dropped unapplied
+func applyProfile(config *Config, name string) error {
+	profiles := config.Profiles
+	config.Profiles = nil
+	if name == "" {
+		return nil
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q, the config defines %v", name, slices.Sorted(maps.Keys(profiles)))
+	}
+
+	captured := capturedVariables(config.ProbingConfig)
+	for variable := range profile.Variables {
+		if captured[variable] {
+			return fmt.Errorf("profile %s: variable %s is also captured from a response", name, variable)
+		}
+	}
+
+	if profile.Auth != nil {
+		config.Auth = *profile.Auth
+	}
+	if len(profile.Variables) > 0 {
+		// only the variables of the profile are replaced, the captured variables are substituted during the run
+		_ = rewriteStrings(reflect.ValueOf(config).Elem(), "", func(_, value string) (string, error) {
+			return variablePattern.ReplaceAllStringFunc(value, func(ref string) string {
+				if value, ok := profile.Variables[variablePattern.FindStringSubmatch(ref)[1]]; ok {
+					return value
+				}
+				return ref
+			}), nil
+		})
+	}
+	if profile.BaseURL != "" {
+		for _, endpoint := range config.ProbingConfig.endpointRefs() {
+			if strings.HasPrefix(endpoint.URL, "/") {
+				endpoint.URL = strings.TrimSuffix(profile.BaseURL, "/") + endpoint.URL
+			}
+		}
+	}
+	return nil
+}
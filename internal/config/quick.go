@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// QuickConfig builds the config of a run against a single URL without a config file, e.g. for smoke tests. The URL
+// is requested with GET, totalRequests times by concurrentRequests workers
+func QuickConfig(target string, totalRequests, concurrentRequests int, logger *slog.Logger) (*Config, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q: an http or https URL is required", target)
+	}
+	if totalRequests <= 0 {
+		return nil, fmt.Errorf("the number of requests must be positive")
+	}
+	if concurrentRequests <= 0 {
+		return nil, fmt.Errorf("the concurrency must be positive")
+	}
+
+	config := &Config{ProbingConfig: ProbingConfig{
+		ConcurrentRequests: concurrentRequests,
+		TotalRequests:      totalRequests,
+		Endpoints:          []Endpoint{{URL: target, Method: http.MethodGet}},
+	}}
+	if err := prepareConfig(config, target, logger); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Config built for a single URL", "url", target, "total_requests", totalRequests, "concurrent_requests", concurrentRequests)
+	return config, nil
+}
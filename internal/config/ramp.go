@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Ramp represents the concurrency profile of an endpoint that is probed by its own workers instead of the shared
+// workers. The number of workers changes linearly from StartWorkers to EndWorkers over DurationMS
+type Ramp struct {
+	StartWorkers int `yaml:"start_workers"`
+	EndWorkers   int `yaml:"end_workers"`
+	DurationMS   int `yaml:"duration_ms,omitempty"`
+}
+
+// Workers returns the number of workers after elapsed time since the start of the run
+func (r Ramp) Workers(elapsed time.Duration) int {
+	duration := time.Duration(r.DurationMS) * time.Millisecond
+	if elapsed >= duration {
+		return r.EndWorkers
+	}
+	if elapsed <= 0 {
+		return r.StartWorkers
+	}
+	return r.StartWorkers + int(int64(r.EndWorkers-r.StartWorkers)*int64(elapsed)/int64(duration))
+}
+
+// MaxWorkers returns the highest number of workers of the ramp
+func (r Ramp) MaxWorkers() int {
+	return max(r.StartWorkers, r.EndWorkers)
+}
+
+// validateRamps checks the ramps of the endpoints, which are only supported with the shared workers
+func validateRamps(probing ProbingConfig) error {
+	for _, endpoint := range probing.Endpoints {
+		ramp := endpoint.Ramp
+		if ramp == nil {
+			continue
+		}
+		if probing.VirtualUsers.Enabled {
+			return fmt.Errorf("endpoint %s: ramp is not supported with virtual_users", endpoint.URL)
+		}
+		if ramp.StartWorkers < 0 || ramp.EndWorkers < 0 || ramp.DurationMS < 0 {
+			return fmt.Errorf("endpoint %s: ramp start_workers, end_workers and duration_ms must not be negative", endpoint.URL)
+		}
+		if ramp.EndWorkers == 0 {
+			return fmt.Errorf("endpoint %s: ramp end_workers must be positive", endpoint.URL)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// DefaultConsulAddress is the Consul agent queried when no address is configured
+const DefaultConsulAddress = "http://localhost:8500"
+
+// RegistryConfig represents the service registry the instances of endpoints with a service are resolved from
+type RegistryConfig struct {
+	Consul ConsulConfig `yaml:"consul,omitempty"`
+}
+
+// ConsulConfig represents the connection to a Consul agent
+type ConsulConfig struct {
+	// Address is the HTTP API of the agent, defaults to DefaultConsulAddress
+	Address    string `yaml:"address,omitempty"`
+	Token      string `yaml:"token,omitempty"`
+	Datacenter string `yaml:"datacenter,omitempty"`
+	// Tag limits the instances to those registered with the tag
+	Tag string `yaml:"tag,omitempty"`
+}
+
+// validateRegistry checks the registry address and that services are only resolved for endpoints with a host
+func validateRegistry(probing ProbingConfig) error {
+	if address := probing.Registry.Consul.Address; address != "" {
+		u, err := url.Parse(address)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("registry consul address must be an http or https URL, got %q", address)
+		}
+	}
+	for _, endpoint := range probing.Endpoints {
+		if endpoint.Service == "" {
+			continue
+		}
+		u, err := url.Parse(endpoint.URL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("endpoint %s: service requires a URL with a host to replace", endpoint.URL)
+		}
+	}
+	for _, scenario := range probing.Scenarios {
+		for _, step := range scenario.Steps {
+			if step.Service != "" {
+				return fmt.Errorf("scenario %s step %s: service is only supported on endpoints", scenario.Name, step.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver resolves the references of one scheme in config values, e.g. the path of a secret in Vault. A reference
+// is written as ${scheme://ref} or $(scheme://ref), Resolve receives the part after the scheme
+type Resolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// ResolverFunc adapts a function to a Resolver
+type ResolverFunc func(ctx context.Context, ref string) (string, error)
+
+// Resolve calls f
+func (f ResolverFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+// schemes of the built-in resolvers, references without a scheme are environment variables
+const (
+	SchemeEnv     = "env"
+	SchemeFile    = "file"
+	SchemeVault   = "vault"
+	SchemeKeyring = "keyring"
+)
+
+var (
+	resolversMu sync.RWMutex
+	resolvers   = map[string]Resolver{
+		SchemeEnv:     ResolverFunc(resolveEnv),
+		SchemeFile:    ResolverFunc(resolveFile),
+		SchemeVault:   ResolverFunc(resolveVault),
+		SchemeKeyring: ResolverFunc(resolveKeyring),
+		// the cloud secret managers
+		SchemeAWSSecrets: ResolverFunc(resolveAWSSecret),
+		SchemeGCPSecrets: ResolverFunc(resolveGCPSecret),
+	}
+)
+
+// RegisterResolver adds a resolver for a scheme, registering an existing scheme replaces it. It is meant to be called
+// before the config is loaded, e.g. from an init function
+func RegisterResolver(scheme string, r Resolver) {
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+	resolvers[scheme] = r
+}
+
+// lookupResolver returns the resolver of a scheme
+func lookupResolver(scheme string) (Resolver, bool) {
+	resolversMu.RLock()
+	defer resolversMu.RUnlock()
+	r, ok := resolvers[scheme]
+	return r, ok
+}
+
+// resolveReferences replaces the references in every string of the config with their resolved values, a value can
+// contain several references and text around them. Auth fields may also hold a bare secret manager reference, e.g.
+// vault:secret/data/api#client_secret. Each reference is resolved once per load
+func resolveReferences(ctx context.Context, config *Config, logger *slog.Logger) error {
+	resolved := make(map[string]string)
+	resolve := func(field, reference string) (string, error) {
+		if value, ok := resolved[reference]; ok {
+			return value, nil
+		}
+		scheme, ref, ok := strings.Cut(reference, "://")
+		if !ok {
+			scheme, ref = SchemeEnv, reference
+		}
+		r, ok := lookupResolver(scheme)
+		if !ok {
+			return "", fmt.Errorf("%s: unknown resolver scheme %q", field, scheme)
+		}
+		// only the reference is logged, the resolved value is usually a secret
+		logger.Debug("Resolving config reference", "field", field, "reference", reference)
+		value, err := r.Resolve(ctx, ref)
+		if err != nil {
+			return "", fmt.Errorf("%s: error resolving %q: %w", field, reference, err)
+		}
+		resolved[reference] = value
+		return value, nil
+	}
+
+	return rewriteStrings(reflect.ValueOf(config).Elem(), "", func(field, value string) (string, error) {
+		if reference, ok := bareSecretReference(field, value); ok {
+			return resolve(field, reference)
+		}
+		var errs []error
+		for _, pattern := range []*regexp.Regexp{regexCurlyBraces, regexParentheses} {
+			value = pattern.ReplaceAllStringFunc(value, func(match string) string {
+				// the reference without the surrounding ${ } or $( )
+				resolvedValue, err := resolve(field, match[2:len(match)-1])
+				if err != nil {
+					errs = append(errs, err)
+					return match
+				}
+				return resolvedValue
+			})
+		}
+		return value, errors.Join(errs...)
+	})
+}
+
+// rewriteStrings replaces every string in v with the result of fn, called with the path of the string using the
+// YAML field names. Map values are copied, rewritten and stored again since they are not addressable
+func rewriteStrings(v reflect.Value, path string, fn func(field, value string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.String:
+		value, err := fn(path, v.String())
+		if err != nil {
+			return err
+		}
+		if v.CanSet() && value != v.String() {
+			v.SetString(value)
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return rewriteStrings(v.Elem(), path, fn)
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if unscannedFields[name] {
+				continue
+			}
+			if err := rewriteStrings(v.Field(i), joinField(path, name), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			if err := rewriteStrings(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := rewriteStrings(elem, joinField(path, fmt.Sprint(key.Interface())), fn); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	}
+	return nil
+}
+
+// resolveEnv resolves an environment variable, variables of the .env file are loaded into the environment without
+// overriding it. An unset variable resolves to an empty string
+func resolveEnv(_ context.Context, name string) (string, error) {
+	return os.Getenv(name), nil
+}
+
+// resolveFile resolves to the content of a file without its trailing line break, e.g. a mounted Kubernetes secret
+func resolveFile(_ context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// secretClient sends the requests to Vault and the secret managers
+var secretClient = &http.Client{Timeout: 10 * time.Second}
+
+// resolveVault resolves a field of a Vault secret, referenced as path#field, e.g. secret/data/api#client_secret.
+// Vault is addressed by VAULT_ADDR with the token of VAULT_TOKEN and the optional VAULT_NAMESPACE, both KV version 1
+// and 2 secrets are supported
+func resolveVault(ctx context.Context, ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("vault reference must be path#field")
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := secretClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("error decoding vault response: %w", err)
+	}
+	data := secret.Data
+	// KV version 2 nests the fields of the secret in data.data
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = nested
+		}
+	}
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("vault secret has no field %q", field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// resolveKeyring resolves a password of the keyring of the operating system, referenced as service/account. It uses
+// the security tool on macOS and secret-tool of libsecret on Linux
+func resolveKeyring(ctx context.Context, ref string) (string, error) {
+	service, account, ok := strings.Cut(ref, "/")
+	if !ok || service == "" || account == "" {
+		return "", fmt.Errorf("keyring reference must be service/account")
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux":
+		cmd = exec.CommandContext(ctx, "secret-tool", "lookup", "service", service, "account", account)
+	default:
+		return "", fmt.Errorf("keyring is not supported on %s", runtime.GOOS)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error reading keyring: %w", err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
@@ -0,0 +1,30 @@
+package config
+
+import "fmt"
+
+// DefaultMaxRetryAfter is the default longest pause in milliseconds an endpoint takes for a Retry-After header
+const DefaultMaxRetryAfter = 60000
+
+// RetryAfterConfig represents the handling of 429 and 503 responses with a Retry-After header, which pause the
+// traffic to their endpoint for the requested time instead of sending requests that are rejected as well
+type RetryAfterConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxWaitMS caps the pause of a single Retry-After header, defaults to DefaultMaxRetryAfter
+	MaxWaitMS int `yaml:"max_wait_ms,omitempty"`
+}
+
+// MaxWait returns the longest pause for a single Retry-After header in milliseconds
+func (r RetryAfterConfig) MaxWait() int {
+	if r.MaxWaitMS == 0 {
+		return DefaultMaxRetryAfter
+	}
+	return r.MaxWaitMS
+}
+
+// validateRetryAfter checks that the longest pause is not negative
+func validateRetryAfter(retryAfter RetryAfterConfig) error {
+	if retryAfter.MaxWaitMS < 0 {
+		return fmt.Errorf("retry_after max_wait_ms must not be negative")
+	}
+	return nil
+}
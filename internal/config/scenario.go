@@ -0,0 +1,259 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/jsonpath"
+)
+
+// variablePattern matches a variable reference like {{order_id}} in a step URL, body or header
+var variablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*}}`)
+
+// variableName matches a valid variable name
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Scenario represents an ordered sequence of steps executed by one virtual user
+type Scenario struct {
+	Name  string `yaml:"name"`
+	Steps []Step `yaml:"steps"`
+	// SLAMS is the target duration of a whole iteration, the sum of the response times of its steps
+	SLAMS int `yaml:"sla_ms,omitempty"`
+}
+
+// on_failure values of a step
+const (
+	// OnFailureAbort skips the remaining steps of the iteration when the step fails
+	OnFailureAbort = "abort"
+	// OnFailureContinue only skips the steps depending on the failed step
+	OnFailureContinue = "continue"
+)
+
+// Step represents a request of a scenario, it supports all endpoint settings and can extract values from the
+// response into variables used by the following steps
+type Step struct {
+	Name     string `yaml:"name"`
+	Endpoint `yaml:",inline"`
+	Extract  []Extraction `yaml:"extract,omitempty"`
+	// DependsOn lists earlier steps that must succeed in the same iteration, the step is skipped otherwise
+	DependsOn []string `yaml:"depends_on,omitempty"`
+	// OnFailure is abort (default) or continue
+	OnFailure string `yaml:"on_failure,omitempty"`
+}
+
+// Extraction represents a value extracted from a response, exactly one of JSON, Regex and Header must be set
+type Extraction struct {
+	// Name is the variable the value is stored in
+	Name string `yaml:"name"`
+	// JSON is a path into the JSON response body, e.g. $.data.items[0].id
+	JSON string `yaml:"json,omitempty"`
+	// Regex is matched against the response body, the first capture group (or the whole match) is extracted
+	Regex  string `yaml:"regex,omitempty"`
+	Header string `yaml:"header,omitempty"`
+}
+
+// VirtualUsers represents the virtual user execution model. Each virtual user loops over a scenario with its own
+// cookie jar and variables, instead of the workers sharing a queue of requests
+type VirtualUsers struct {
+	Enabled bool `yaml:"enabled"`
+	Count   int  `yaml:"count"`
+	// Iterations is the number of scenario iterations per virtual user, defaults to total_requests
+	Iterations int `yaml:"iterations,omitempty"`
+	// RampUpMS spreads the start of the virtual users evenly over the given duration
+	RampUpMS  int   `yaml:"ramp_up_ms,omitempty"`
+	ThinkTime Delay `yaml:"think_time,omitempty"`
+}
+
+// validateVirtualUsers checks the virtual user settings
+func validateVirtualUsers(probing ProbingConfig) error {
+	vus := probing.VirtualUsers
+	if !vus.Enabled {
+		return nil
+	}
+	if vus.Count <= 0 {
+		return fmt.Errorf("virtual_users count must be positive")
+	}
+	if vus.Iterations < 0 || vus.RampUpMS < 0 {
+		return fmt.Errorf("virtual_users iterations and ramp_up_ms must not be negative")
+	}
+	if err := vus.ThinkTime.validate(); err != nil {
+		return fmt.Errorf("virtual_users think_time %w", err)
+	}
+	if len(probing.Scenarios) == 0 && len(probing.Endpoints) == 0 {
+		return fmt.Errorf("virtual_users require scenarios or endpoints")
+	}
+	return nil
+}
+
+// ExpandVariables replaces the variable references in s with their values
+func ExpandVariables(s string, vars map[string]string) (string, error) {
+	var missing []string
+	expanded := variablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := variablePattern.FindStringSubmatch(ref)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variables: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// referencedVariables returns the names of the variables referenced in the URL, body, headers and query parameters
+// of the endpoint
+func referencedVariables(endpoint Endpoint) []string {
+	sources := []string{endpoint.URL, endpoint.Body}
+	for _, value := range endpoint.Headers {
+		sources = append(sources, value)
+	}
+	for _, value := range endpoint.QueryParams {
+		sources = append(sources, value)
+	}
+
+	var names []string
+	for _, source := range sources {
+		for _, match := range variablePattern.FindAllStringSubmatch(source, -1) {
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// endpointRefs returns pointers to all endpoints, including the steps of the scenarios
+func (p *ProbingConfig) endpointRefs() []*Endpoint {
+	refs := make([]*Endpoint, 0, len(p.Endpoints))
+	for i := range p.Endpoints {
+		refs = append(refs, &p.Endpoints[i])
+	}
+	for i := range p.Scenarios {
+		for j := range p.Scenarios[i].Steps {
+			refs = append(refs, &p.Scenarios[i].Steps[j].Endpoint)
+		}
+	}
+	return refs
+}
+
+// validateScenarios checks the scenario names, the extraction rules, the step dependencies and that steps only
+// reference variables extracted by earlier steps or captured by an endpoint
+func validateScenarios(probing ProbingConfig) error {
+	captured := capturedVariables(probing)
+	names := make(map[string]bool, len(probing.Scenarios))
+	for _, scenario := range probing.Scenarios {
+		if scenario.Name == "" {
+			return fmt.Errorf("scenario name is required")
+		}
+		if names[scenario.Name] {
+			return fmt.Errorf("duplicate scenario name: %s", scenario.Name)
+		}
+		names[scenario.Name] = true
+		if len(scenario.Steps) == 0 {
+			return fmt.Errorf("scenario %s has no steps", scenario.Name)
+		}
+		if scenario.SLAMS < 0 {
+			return fmt.Errorf("scenario %s: sla_ms must not be negative", scenario.Name)
+		}
+
+		defined := maps.Clone(captured)
+		// extractedBy is the last step extracting each variable, dependencies the transitive dependencies per step
+		extractedBy := make(map[string]string)
+		dependencies := make(map[string]map[string]bool, len(scenario.Steps))
+		for i, step := range scenario.Steps {
+			if step.Name == "" {
+				return fmt.Errorf("scenario %s: step %d has no name", scenario.Name, i+1)
+			}
+			if _, ok := dependencies[step.Name]; ok {
+				return fmt.Errorf("scenario %s: duplicate step name: %s", scenario.Name, step.Name)
+			}
+			if err := validateStepDependencies(step, dependencies); err != nil {
+				return fmt.Errorf("scenario %s: step %s: %w", scenario.Name, step.Name, err)
+			}
+			for _, name := range referencedVariables(step.Endpoint) {
+				if !defined[name] {
+					return fmt.Errorf("scenario %s: step %s references variable %s before it is extracted", scenario.Name, step.Name, name)
+				}
+				// a step continuing on failure may leave the variable unset, so the step must depend on it
+				if producer, ok := extractedBy[name]; ok && !dependencies[step.Name][producer] && continuesOnFailure(scenario, producer) {
+					return fmt.Errorf("scenario %s: step %s references variable %s of step %s, which continues on failure, without depending on it",
+						scenario.Name, step.Name, name, producer)
+				}
+			}
+			for _, extraction := range step.Extract {
+				if err := extraction.validate(); err != nil {
+					return fmt.Errorf("scenario %s: step %s: %w", scenario.Name, step.Name, err)
+				}
+				defined[extraction.Name] = true
+				extractedBy[extraction.Name] = step.Name
+			}
+		}
+	}
+	return nil
+}
+
+// validateStepDependencies checks the on_failure value and that the step only depends on earlier steps, whose
+// transitive dependencies are in dependencies. It adds the transitive dependencies of the step to dependencies
+func validateStepDependencies(step Step, dependencies map[string]map[string]bool) error {
+	switch step.OnFailure {
+	case "", OnFailureAbort, OnFailureContinue:
+	default:
+		return fmt.Errorf("on_failure must be %s or %s", OnFailureAbort, OnFailureContinue)
+	}
+
+	transitive := make(map[string]bool)
+	for _, dependency := range step.DependsOn {
+		if dependency == step.Name {
+			return fmt.Errorf("step depends on itself")
+		}
+		earlier, ok := dependencies[dependency]
+		if !ok {
+			return fmt.Errorf("depends on %s, which is not an earlier step of the scenario", dependency)
+		}
+		transitive[dependency] = true
+		maps.Copy(transitive, earlier)
+	}
+	dependencies[step.Name] = transitive
+	return nil
+}
+
+// continuesOnFailure reports whether the named step of the scenario continues the iteration when it fails
+func continuesOnFailure(scenario Scenario, name string) bool {
+	for _, step := range scenario.Steps {
+		if step.Name == name {
+			return step.OnFailure == OnFailureContinue
+		}
+	}
+	return false
+}
+
+// validate checks the variable name and that exactly one valid source is set
+func (e Extraction) validate() error {
+	if !variableName.MatchString(e.Name) {
+		return fmt.Errorf("invalid variable name: %q", e.Name)
+	}
+
+	sources := 0
+	for _, source := range []string{e.JSON, e.Regex, e.Header} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("variable %s must be extracted with exactly one of json, regex or header", e.Name)
+	}
+
+	if e.Regex != "" {
+		if _, err := regexp.Compile(e.Regex); err != nil {
+			return fmt.Errorf("invalid regex for variable %s: %w", e.Name, err)
+		}
+	}
+	if e.JSON != "" {
+		if err := jsonpath.Validate(e.JSON); err != nil {
+			return fmt.Errorf("variable %s: %w", e.Name, err)
+		}
+	}
+	return nil
+}
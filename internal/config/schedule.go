@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dasvh/enchante/internal/cron"
+)
+
+// ScheduleConfig represents when the daemon runs the probe, turning enchante into a synthetic monitoring agent
+type ScheduleConfig struct {
+	// Cron is a cron expression of five fields or a macro like @hourly or @every 5m, the daemon requires it
+	Cron string `yaml:"cron"`
+	// Timezone is the IANA time zone the expression is evaluated in, defaults to the local time zone
+	Timezone string `yaml:"timezone,omitempty"`
+	// RunAtStart runs the probe when the daemon starts instead of waiting for the first scheduled time
+	RunAtStart bool `yaml:"run_at_start,omitempty"`
+	// ReportDir is the directory the report of every run is written to, reports are not written when empty
+	ReportDir string `yaml:"report_dir,omitempty"`
+	// KeepReports is the number of reports kept in report_dir, the oldest are removed first. All are kept when 0
+	KeepReports int `yaml:"keep_reports,omitempty"`
+	// Alerts are evaluated after every run and notify their channels when consecutive runs breach them
+	Alerts []AlertConfig `yaml:"alerts,omitempty"`
+}
+
+// Parse returns the parsed cron expression and the time zone it is evaluated in
+func (s ScheduleConfig) Parse() (*cron.Schedule, *time.Location, error) {
+	schedule, err := cron.Parse(s.Cron)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc := time.Local
+	if s.Timezone != "" {
+		if loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return nil, nil, fmt.Errorf("invalid schedule timezone: %w", err)
+		}
+	}
+	return schedule, loc, nil
+}
+
+// validateSchedule checks the cron expression and time zone of a configured schedule
+func validateSchedule(schedule ScheduleConfig) error {
+	if schedule.Cron == "" {
+		if schedule.Timezone != "" || schedule.ReportDir != "" || schedule.KeepReports != 0 || schedule.RunAtStart || len(schedule.Alerts) > 0 {
+			return fmt.Errorf("schedule cron is required")
+		}
+		return nil
+	}
+	if schedule.KeepReports < 0 {
+		return fmt.Errorf("schedule keep_reports must not be negative")
+	}
+	_, _, err := schedule.Parse()
+	return err
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// SchemaURL identifies the JSON Schema dialect of the generated schema
+const SchemaURL = "https://json-schema.org/draft/2020-12/schema"
+
+// customSchemas are the schemas of the types with their own YAML decoding
+var customSchemas = map[reflect.Type]map[string]any{
+	reflect.TypeFor[StatusCodes](): {
+		"description": "status codes like 404, classes like 2xx and ranges like 200-299, as a list or comma separated",
+		"anyOf": []any{
+			map[string]any{"type": "integer"},
+			map[string]any{"type": "string"},
+			map[string]any{"type": "array", "items": map[string]any{"type": []string{"integer", "string"}}},
+		},
+	},
+	reflect.TypeFor[includeList](): {
+		"description": "a path or a list of paths of the config files to include",
+		"anyOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	},
+}
+
+// JSONSchema returns the JSON Schema of the config file, generated from the config types so it never drifts from
+// them. Unknown keys are rejected like the config loader does
+func JSONSchema() ([]byte, error) {
+	defs := make(map[string]any)
+	schema := typeSchema(reflect.TypeFor[Config](), defs)
+	schema["$schema"] = SchemaURL
+	schema["title"] = "enchante probe configuration"
+	schema["$defs"] = defs
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// typeSchema returns the schema of a config type, structs other than Config are added to defs and referenced
+func typeSchema(t reflect.Type, defs map[string]any) map[string]any {
+	if schema, ok := customSchemas[t]; ok {
+		return schema
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem(), defs)
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		if t == reflect.TypeFor[Config]() {
+			return structSchema(t, defs)
+		}
+		if _, ok := defs[t.Name()]; !ok {
+			// the placeholder ends the recursion of types referencing themselves
+			defs[t.Name()] = nil
+			defs[t.Name()] = structSchema(t, defs)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+// structSchema returns the schema of a struct with a property per YAML field, the fields of inlined structs included
+func structSchema(t reflect.Type, defs map[string]any) map[string]any {
+	properties := make(map[string]any)
+	for name, field := range yamlFields(t) {
+		properties[name] = typeSchema(field.Type, defs)
+	}
+	return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+}
+
+// yamlFields returns the exported fields of a struct by their YAML name, the fields of inlined structs included
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if options == "inline" {
+			for inlined, f := range yamlFields(field.Type) {
+				fields[inlined] = f
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// unknownFieldHint adds the closest known field name to an unknown field error, catching typos like
+// concurent_requests
+func unknownFieldHint(err error) error {
+	var unknown *yaml.UnknownFieldError
+	if !errors.As(err, &unknown) || unknown.Token == nil {
+		return err
+	}
+	if suggestion := closestField(unknown.Token.Value); suggestion != "" {
+		return fmt.Errorf("%w\ndid you mean %q?", err, suggestion)
+	}
+	return err
+}
+
+// closestField returns the known field name closest to name, empty when none is close enough to be a typo
+func closestField(name string) string {
+	names := make(map[string]bool)
+	collectFieldNames(reflect.TypeFor[Config](), names, make(map[reflect.Type]bool))
+
+	best, bestDistance := "", len(name)/3+1
+	for _, candidate := range slices.Sorted(maps.Keys(names)) {
+		if d := editDistance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// collectFieldNames adds the YAML field names of the config types reachable from t to names, visited holds the
+// structs already collected
+func collectFieldNames(t reflect.Type, names map[string]bool, visited map[reflect.Type]bool) {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		collectFieldNames(t.Elem(), names, visited)
+	case reflect.Struct:
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+		for name, field := range yamlFields(t) {
+			names[name] = true
+			collectFieldNames(field.Type, names, visited)
+		}
+	}
+}
+
+// editDistance returns the Levenshtein distance of two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// schemes of the cloud secret managers
+const (
+	SchemeAWSSecrets = "aws-sm"
+	SchemeGCPSecrets = "gcp-sm"
+)
+
+// secretManagerSchemes may also be referenced without ${ } in auth fields, e.g. vault:secret/data/api#client_secret
+var secretManagerSchemes = []string{SchemeVault, SchemeAWSSecrets, SchemeGCPSecrets}
+
+// bareSecretReference returns the reference of an auth field value written as scheme:ref with the scheme of a secret
+// manager, ok is false for any other value
+func bareSecretReference(field, value string) (reference string, ok bool) {
+	if !strings.HasPrefix(field, "auth.") && !strings.Contains(field, ".auth.") {
+		return "", false
+	}
+	scheme, ref, found := strings.Cut(value, ":")
+	if !found || ref == "" || strings.HasPrefix(ref, "//") || !slices.Contains(secretManagerSchemes, scheme) {
+		return "", false
+	}
+	return scheme + "://" + ref, true
+}
+
+// secretField returns a field of a secret holding a JSON object, or the whole secret when no field is given
+func secretField(secret, field string) (string, error) {
+	if field == "" {
+		return secret, nil
+	}
+	var values map[string]any
+	if err := json.Unmarshal([]byte(secret), &values); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, it has no field %q", field)
+	}
+	value, ok := values[field]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %q", field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// resolveAWSSecret resolves a secret of AWS Secrets Manager, referenced by its name or ARN with an optional #field of
+// a JSON secret. The credentials and the region are found like the AWS CLI does, from the environment, the shared
+// config and credentials files with AWS_PROFILE, SSO, web identity tokens and the roles of ECS tasks and EC2 instances.
+// The endpoint can be overridden with AWS_ENDPOINT_URL_SECRETS_MANAGER or AWS_ENDPOINT_URL
+func resolveAWSSecret(ctx context.Context, ref string) (string, error) {
+	id, field, _ := strings.Cut(ref, "#")
+	if id == "" {
+		return "", fmt.Errorf("aws-sm reference must be secret-id or secret-id#field")
+	}
+	// a client of the SDK, which adds the certificates of AWS_CA_BUNDLE
+	client := awshttp.NewBuildableClient().WithTimeout(secretClient.Timeout)
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithHTTPClient(client)}
+	// an ARN names its region, arn:aws:secretsmanager:eu-west-1:123456789012:secret:api
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" {
+		opts = append(opts, awsconfig.WithDefaultRegion(parts[3]))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return "", fmt.Errorf("error loading AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return "", fmt.Errorf("no AWS region configured, set AWS_REGION or the region of the AWS profile")
+	}
+
+	secret, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting secret from secrets manager: %w", err)
+	}
+	if secret.SecretString == nil && secret.SecretBinary != nil {
+		return secretField(string(secret.SecretBinary), field)
+	}
+	return secretField(aws.ToString(secret.SecretString), field)
+}
+
+var (
+	// gcpSecretManagerURL is the API of GCP Secret Manager
+	gcpSecretManagerURL = "https://secretmanager.googleapis.com"
+	// gcpMetadataTokenURL returns the access token of the service account on GCP compute, e.g. GKE and Cloud Run
+	gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// resolveGCPSecret resolves a secret version of GCP Secret Manager, referenced as project/secret, project/secret/version
+// or by its full resource name, with an optional #field of a JSON secret. The latest version is used by default. The
+// access token is read from GOOGLE_OAUTH_ACCESS_TOKEN, e.g. from gcloud auth print-access-token, or from the metadata
+// server when running on GCP
+func resolveGCPSecret(ctx context.Context, ref string) (string, error) {
+	name, field, _ := strings.Cut(ref, "#")
+	if !strings.HasPrefix(name, "projects/") {
+		parts := strings.Split(name, "/")
+		if len(parts) < 2 || len(parts) > 3 || slices.Contains(parts, "") {
+			return "", fmt.Errorf("gcp-sm reference must be project/secret or project/secret/version")
+		}
+		parts = append(parts, "latest")
+		name = fmt.Sprintf("projects/%s/secrets/%s/versions/%s", parts[0], parts[1], parts[2])
+	}
+	token, err := gcpAccessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpSecretManagerURL+"/v1/"+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := secretClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("secret manager returned status %d", resp.StatusCode)
+	}
+
+	var version struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return "", fmt.Errorf("error decoding secret manager response: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(version.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("error decoding secret payload: %w", err)
+	}
+	return secretField(string(data), field)
+}
+
+// gcpAccessToken returns the access token of GOOGLE_OAUTH_ACCESS_TOKEN, or of the service account from the metadata
+// server
+func gcpAccessToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := secretClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("GOOGLE_OAUTH_ACCESS_TOKEN is not set and the metadata server is unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&token) != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("no access token from the metadata server, status %d", resp.StatusCode)
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/logger"
+)
+
+// secretPrefixes matches the formats of well-known credentials
+var secretPrefixes = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"AWS access key", regexp.MustCompile(`^(AKIA|ASIA)[A-Z0-9]{16}$`)},
+	{"GitHub token", regexp.MustCompile(`^(gh[pousr]_[A-Za-z0-9]{30,}|github_pat_[A-Za-z0-9_]{30,})$`)},
+	{"GitLab token", regexp.MustCompile(`^glpat-[A-Za-z0-9_-]{20,}$`)},
+	{"Slack token", regexp.MustCompile(`^xox[abprs]-[A-Za-z0-9-]{10,}$`)},
+	{"Stripe key", regexp.MustCompile(`^[sr]k_live_[A-Za-z0-9]{16,}$`)},
+	{"Google API key", regexp.MustCompile(`^AIza[A-Za-z0-9_-]{35}$`)},
+	{"API secret key", regexp.MustCompile(`^sk-[A-Za-z0-9_-]{20,}$`)},
+	{"JSON web token", regexp.MustCompile(`^eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]*$`)},
+	{"private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+}
+
+var (
+	// hexValue and tokenValue match the character sets checked for high entropy
+	hexValue   = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	tokenValue = regexp.MustCompile(`^[A-Za-z0-9+/=_.-]+$`)
+	// authScheme matches the scheme in front of a credential in an Authorization header
+	authScheme = regexp.MustCompile(`^(?i)(bearer|basic|token|apikey)\s+`)
+)
+
+// unscannedFields hold payloads rather than credentials, encoded binary bodies would be reported as high-entropy strings
+var unscannedFields = map[string]bool{
+	"body_base64": true,
+}
+
+// secretFinding represents a config value that looks like a plaintext secret
+type secretFinding struct {
+	// field is the path of the value in the config, e.g. probe.endpoints[0].headers.Authorization
+	field  string
+	reason string
+}
+
+// scanSecrets returns the values of the config that look like real secrets committed in plaintext, references to
+// environment variables are not reported
+func scanSecrets(config *Config) []secretFinding {
+	var findings []secretFinding
+	walkStrings(reflect.ValueOf(config).Elem(), "", func(field, value string) {
+		if reason := secretReason(value); reason != "" {
+			findings = append(findings, secretFinding{field: field, reason: reason})
+		}
+	})
+	slices.SortFunc(findings, func(a, b secretFinding) int {
+		return strings.Compare(a.field, b.field)
+	})
+	return findings
+}
+
+// warnSecrets logs a prominent warning for every value of the config that looks like a plaintext secret
+func warnSecrets(config *Config, filename string, logger *slog.Logger) {
+	findings := scanSecrets(config)
+	if len(findings) == 0 {
+		return
+	}
+	for _, finding := range findings {
+		logger.Warn("Possible plaintext secret in config", "file", filename, "field", finding.field, "detected", finding.reason)
+	}
+	logger.Warn("SECRETS IN CONFIG: move them out of the config file and reference them as ${NAME} environment "+
+		"variables, e.g. provided from a .env file, a keyring or Vault",
+		"file", filename,
+		"findings", len(findings))
+}
+
+// forEachSecret calls fn with the resolved values of the credential fields and secret headers of the config
+func forEachSecret(config *Config, fn func(value string)) {
+	walkStrings(reflect.ValueOf(config).Elem(), "", func(field, value string) {
+		name := field[strings.LastIndex(field, ".")+1:]
+		if logger.IsSecretKey(name) || strings.HasSuffix(field, "api_key.value") {
+			fn(value)
+		}
+	})
+}
+
+// registerSecrets registers the resolved values of the credential fields and secret headers of the config with the
+// logger, so they are redacted from the logs wherever they appear
+func registerSecrets(config *Config) {
+	forEachSecret(config, func(value string) {
+		logger.RegisterSecret(value)
+		// the credential of a header like Authorization: Bearer token
+		if credential := authScheme.ReplaceAllString(value, ""); credential != value {
+			logger.RegisterSecret(credential)
+		}
+	})
+}
+
+// walkStrings calls fn with the path and value of every string in v, using the YAML field names
+func walkStrings(v reflect.Value, path string, fn func(field, value string)) {
+	switch v.Kind() {
+	case reflect.String:
+		fn(path, v.String())
+	case reflect.Pointer:
+		if !v.IsNil() {
+			walkStrings(v.Elem(), path, fn)
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if unscannedFields[name] {
+				continue
+			}
+			walkStrings(v.Field(i), joinField(path, name), fn)
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			walkStrings(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			walkStrings(v.MapIndex(key), joinField(path, fmt.Sprint(key.Interface())), fn)
+		}
+	}
+}
+
+// joinField appends a field name to a path, inlined fields without a name keep the path
+func joinField(path, name string) string {
+	switch {
+	case name == "":
+		return path
+	case path == "":
+		return name
+	default:
+		return path + "." + name
+	}
+}
+
+// secretReason returns why the value looks like a secret, empty when it does not
+func secretReason(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" || regexCurlyBraces.MatchString(value) || regexParentheses.MatchString(value) {
+		return ""
+	}
+
+	if strings.Contains(value, "://") {
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				return "password in URL"
+			}
+		}
+		return ""
+	}
+
+	value = authScheme.ReplaceAllString(value, "")
+	for _, prefix := range secretPrefixes {
+		if prefix.pattern.MatchString(value) {
+			return prefix.name
+		}
+	}
+
+	switch {
+	case len(value) >= 32 && hexValue.MatchString(value) && entropy(value) >= 3.0:
+		return "high-entropy hex string"
+	case len(value) >= 20 && tokenValue.MatchString(value) && hasLettersAndDigits(value) && entropy(value) >= 4.0:
+		return "high-entropy string"
+	}
+	return ""
+}
+
+// entropy returns the Shannon entropy of the value in bits per character
+func entropy(value string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range value {
+		counts[r]++
+	}
+	var bits float64
+	n := float64(len(value))
+	for _, count := range counts {
+		p := float64(count) / n
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
+
+// hasLettersAndDigits reports whether the value contains at least one letter and one digit
+func hasLettersAndDigits(value string) bool {
+	return strings.ContainsAny(value, "0123456789") &&
+		strings.ContainsAny(strings.ToLower(value), "abcdefghijklmnopqrstuvwxyz")
+}
+
+// HasSecrets reports whether the config holds credentials or secret headers, e.g. to only send it over encrypted
+// connections
+func HasSecrets(config *Config) bool {
+	found := false
+	forEachSecret(config, func(value string) {
+		if value != "" {
+			found = true
+		}
+	})
+	return found
+}
+
+// RegisterSecrets registers the secrets of a config that was loaded and resolved elsewhere, e.g. the config a worker of
+// a distributed run receives from the coordinator, so they are redacted from the logs
+func RegisterSecrets(config *Config) {
+	registerSecrets(config)
+}
@@ -0,0 +1,57 @@
+package config
+
+import "fmt"
+
+// DefaultSLOWindowDays is the default period of the error budget across the runs in the history
+const DefaultSLOWindowDays = 30
+
+// SLOConfig represents the service level objectives the runs are checked against, e.g. by teams verifying a service
+// continuously
+type SLOConfig struct {
+	// Availability is the target share of successful requests in percent, e.g. 99.9, no objective when 0
+	Availability float64 `yaml:"availability,omitempty"`
+	// Latency is the objective on the response times of the successful requests
+	Latency LatencyObjective `yaml:"latency,omitempty"`
+	// WindowDays is the period the error budget is tracked over across the runs in the history, defaults to 30
+	WindowDays int `yaml:"window_days,omitempty"`
+}
+
+// LatencyObjective represents the share of successful requests that must respond within a threshold
+type LatencyObjective struct {
+	ThresholdMS int `yaml:"threshold_ms"`
+	// Target is the share of the successful requests within threshold_ms in percent, e.g. 99
+	Target float64 `yaml:"target"`
+}
+
+// Enabled reports whether an objective is configured
+func (s SLOConfig) Enabled() bool {
+	return s.Availability > 0 || s.Latency.Target > 0
+}
+
+// Window returns the period the error budget is tracked over, in days
+func (s SLOConfig) Window() int {
+	if s.WindowDays == 0 {
+		return DefaultSLOWindowDays
+	}
+	return s.WindowDays
+}
+
+// validateSLO checks that the targets leave an error budget and that the latency objective has a threshold
+func validateSLO(slo SLOConfig) error {
+	if slo.Availability < 0 || slo.Availability >= 100 {
+		return fmt.Errorf("slo availability must be at least 0 and below 100, got %g", slo.Availability)
+	}
+	if slo.Latency.Target < 0 || slo.Latency.Target >= 100 {
+		return fmt.Errorf("slo latency target must be at least 0 and below 100, got %g", slo.Latency.Target)
+	}
+	if (slo.Latency.Target > 0) != (slo.Latency.ThresholdMS > 0) {
+		return fmt.Errorf("slo latency requires both threshold_ms and target")
+	}
+	if slo.Latency.ThresholdMS < 0 {
+		return fmt.Errorf("slo latency threshold_ms must not be negative")
+	}
+	if slo.WindowDays < 0 {
+		return fmt.Errorf("slo window_days must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatusRange represents an inclusive range of HTTP status codes
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+// StatusCodes represents the status codes counted as success for an endpoint. In YAML it is a single code, a list,
+// or a comma separated string of codes, classes and ranges, e.g. "2xx,404" or "200-299". Empty means any status
+// code below 400
+type StatusCodes []StatusRange
+
+// UnmarshalYAML parses a single code, a list or a comma separated string of codes
+func (s *StatusCodes) UnmarshalYAML(unmarshal func(any) error) error {
+	var value any
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	var tokens []string
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []any:
+		for _, item := range v {
+			tokens = append(tokens, strings.Split(fmt.Sprint(item), ",")...)
+		}
+	default:
+		tokens = strings.Split(fmt.Sprint(v), ",")
+	}
+
+	codes, err := parseStatusCodes(tokens)
+	if err != nil {
+		return err
+	}
+	*s = codes
+	return nil
+}
+
+// parseStatusCodes parses status codes like 404, classes like 2xx and ranges like 200-299
+func parseStatusCodes(tokens []string) (StatusCodes, error) {
+	codes := make(StatusCodes, 0, len(tokens))
+	for _, token := range tokens {
+		token = strings.ToLower(strings.TrimSpace(token))
+		if token == "" {
+			continue
+		}
+		r, err := parseStatusRange(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expected_status %q: %w", token, err)
+		}
+		codes = append(codes, r)
+	}
+	return codes, nil
+}
+
+// parseStatusRange parses a single code, class or range
+func parseStatusRange(token string) (StatusRange, error) {
+	if class, ok := strings.CutSuffix(token, "xx"); ok {
+		digit, err := strconv.Atoi(class)
+		if err != nil || digit < 1 || digit > 5 {
+			return StatusRange{}, fmt.Errorf("status class must be 1xx to 5xx")
+		}
+		return StatusRange{Min: digit * 100, Max: digit*100 + 99}, nil
+	}
+
+	low, high, isRange := strings.Cut(token, "-")
+	if !isRange {
+		high = low
+	}
+	lowCode, err := parseStatusCode(low)
+	if err != nil {
+		return StatusRange{}, err
+	}
+	highCode, err := parseStatusCode(high)
+	if err != nil {
+		return StatusRange{}, err
+	}
+	if highCode < lowCode {
+		return StatusRange{}, fmt.Errorf("range end is below its start")
+	}
+	return StatusRange{Min: lowCode, Max: highCode}, nil
+}
+
+// parseStatusCode parses a status code between 100 and 599
+func parseStatusCode(s string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || code < 100 || code > 599 {
+		return 0, fmt.Errorf("status code must be between 100 and 599")
+	}
+	return code, nil
+}
+
+// Expected reports whether the status code counts as success
+func (s StatusCodes) Expected(code int) bool {
+	if len(s) == 0 {
+		return code < 400
+	}
+	for _, r := range s {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the status codes in the YAML string form, e.g. "2xx,404"
+func (s StatusCodes) String() string {
+	parts := make([]string, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r.Min == r.Max:
+			parts = append(parts, strconv.Itoa(r.Min))
+		case r.Min%100 == 0 && r.Max == r.Min+99:
+			parts = append(parts, fmt.Sprintf("%dxx", r.Min/100))
+		default:
+			parts = append(parts, fmt.Sprintf("%d-%d", r.Min, r.Max))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// MarshalYAML writes the status codes in their string form
+func (s StatusCodes) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
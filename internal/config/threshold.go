@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// threshold severities, a breach of a warn threshold annotates the report while a breach of a fail threshold also
+// fails the run
+const (
+	SeverityWarn = "warn"
+	SeverityFail = "fail"
+)
+
+// ThresholdMetrics are the metrics of the run report a threshold can limit
+var ThresholdMetrics = []string{"error_rate", "failed_requests", "avg_ms", "p50_ms", "p90_ms", "p95_ms", "p99_ms", "max_ms"}
+
+// Threshold represents an upper limit on a metric of the run, or of the endpoints with a URL
+type Threshold struct {
+	Metric string  `yaml:"metric"`
+	Max    float64 `yaml:"max"`
+	// Endpoint limits the threshold to the endpoints with this URL, it applies to all requests of the run when empty
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// Severity is warn or fail, defaults to fail
+	Severity string `yaml:"severity,omitempty"`
+}
+
+// Level returns the severity of the threshold, defaults to SeverityFail
+func (t Threshold) Level() string {
+	if t.Severity == "" {
+		return SeverityFail
+	}
+	return t.Severity
+}
+
+// validateThresholds checks the metric, limit and severity of the thresholds, and that endpoint thresholds refer to
+// a configured endpoint
+func validateThresholds(probing ProbingConfig) error {
+	for i, threshold := range probing.Thresholds {
+		if !slices.Contains(ThresholdMetrics, threshold.Metric) {
+			return fmt.Errorf("threshold %d: unknown metric %q", i+1, threshold.Metric)
+		}
+		if threshold.Max < 0 {
+			return fmt.Errorf("threshold %d: max must not be negative", i+1)
+		}
+		if level := threshold.Level(); level != SeverityWarn && level != SeverityFail {
+			return fmt.Errorf("threshold %d: severity must be %s or %s, got %q", i+1, SeverityWarn, SeverityFail, level)
+		}
+		if threshold.Endpoint != "" && !slices.ContainsFunc(probing.endpointRefs(), func(e *Endpoint) bool { return e.URL == threshold.Endpoint }) {
+			return fmt.Errorf("threshold %d: endpoint %s is not configured", i+1, threshold.Endpoint)
+		}
+	}
+	return nil
+}
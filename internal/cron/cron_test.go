@@ -0,0 +1,84 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{name: "every minute", expr: "* * * * *"},
+		{name: "lists ranges and steps", expr: "0,30 9-17 */2 1-6/2 mon-fri"},
+		{name: "names", expr: "0 0 * JAN,Jul sun"},
+		{name: "sunday as 7", expr: "0 0 * * 7"},
+		{name: "macro", expr: "@daily"},
+		{name: "every", expr: "@every 90s"},
+		{name: "too few fields", expr: "* * * *", wantErr: "must have 5 fields"},
+		{name: "out of range", expr: "60 * * * *", wantErr: `invalid value "60" in minute field`},
+		{name: "unknown name", expr: "0 0 * * someday", wantErr: "day of week field"},
+		{name: "reversed range", expr: "0 17-9 * * *", wantErr: "invalid range"},
+		{name: "invalid step", expr: "*/0 * * * *", wantErr: "invalid step"},
+		{name: "invalid every", expr: "@every soon", wantErr: "invalid @every interval"},
+		{name: "every too short", expr: "@every 10ms", wantErr: "at least 1s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expr, s.String())
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	// a Wednesday
+	from := time.Date(2025, 1, 15, 10, 20, 30, 0, time.UTC)
+	tests := []struct {
+		name string
+		expr string
+		want time.Time
+	}{
+		{name: "every minute", expr: "* * * * *", want: time.Date(2025, 1, 15, 10, 21, 0, 0, time.UTC)},
+		{name: "every 15 minutes", expr: "*/15 * * * *", want: time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)},
+		{name: "offset step", expr: "5/15 * * * *", want: time.Date(2025, 1, 15, 10, 35, 0, 0, time.UTC)},
+		{name: "next hour", expr: "10 * * * *", want: time.Date(2025, 1, 15, 11, 10, 0, 0, time.UTC)},
+		{name: "next day", expr: "0 9 * * *", want: time.Date(2025, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{name: "weekday", expr: "0 9 * * mon", want: time.Date(2025, 1, 20, 9, 0, 0, 0, time.UTC)},
+		{name: "sunday as 7", expr: "0 0 * * 7", want: time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{name: "next month", expr: "0 0 1 * *", want: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "next year", expr: "@yearly", want: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "leap day", expr: "0 0 29 2 *", want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "either day field", expr: "0 0 20 * fri", want: time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC)},
+		{name: "never", expr: "0 0 31 2 *", want: time.Time{}},
+		{name: "every interval", expr: "@every 1m30s", want: time.Date(2025, 1, 15, 10, 22, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, s.Next(from))
+		})
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	s, err := Parse("0 9 * * *")
+	assert.NoError(t, err)
+
+	next := s.Next(time.Date(2025, 1, 15, 8, 0, 0, 0, time.UTC).In(loc))
+	assert.Equal(t, time.Date(2025, 1, 16, 9, 0, 0, 0, loc), next)
+	assert.Equal(t, loc, next.Location())
+}
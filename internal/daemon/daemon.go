@@ -0,0 +1,311 @@
+// Package daemon runs the probe repeatedly on a cron schedule, keeping the report of every run and exposing the health
+// of the target over the control API, which turns enchante into a lightweight synthetic monitoring agent
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/alert"
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/cron"
+	"github.com/dasvh/enchante/internal/history"
+	"github.com/dasvh/enchante/internal/probe"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// maxRuns is the number of recent runs kept in memory for the control API
+const maxRuns = 100
+
+// Health statuses of the daemon
+const (
+	StatusStarting = "starting"
+	StatusPassing  = "passing"
+	StatusFailing  = "failing"
+)
+
+// RunFunc runs the probe once, probe.RunProbe unless the runs are distributed
+type RunFunc func(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*probe.ProbeResult, error)
+
+// Options configures the daemon
+type Options struct {
+	// Run runs the probe, defaults to probe.RunProbe
+	Run RunFunc
+	// Server is the control API the health and runs are served on and the runs attach to, none when nil
+	Server *probe.ControlServer
+	// AfterRun is called after every run with its outcome and result, the result is nil when the run failed to start
+	AfterRun func(run Run, result *probe.ProbeResult)
+	// Stream is the result stream the runs publish their results to, so subscribers stay connected between runs, none
+	// when nil
+	Stream *probe.StreamServer
+}
+
+// Run represents the outcome of a scheduled run
+type Run struct {
+	RunID       string    `json:"run_id,omitempty"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	Passed      bool      `json:"passed"`
+	// Error is set when the run could not be started or its report not be written
+	Error string `json:"error,omitempty"`
+	// ReportFile is the path the report of the run was written to
+	ReportFile string          `json:"report_file,omitempty"`
+	Summary    *report.Summary `json:"summary,omitempty"`
+}
+
+// Health represents the state of the daemon returned by the control API
+type Health struct {
+	// Status is starting before the first run, then passing or failing after the outcome of the last run
+	Status              string    `json:"status"`
+	Runs                int       `json:"runs"`
+	Failures            int       `json:"failures"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Running             bool      `json:"running"`
+	NextRun             time.Time `json:"next_run,omitzero"`
+	LastRun             *Run      `json:"last_run,omitempty"`
+	// FiringAlerts are the names of the alerts firing after the last run
+	FiringAlerts []string `json:"firing_alerts,omitempty"`
+}
+
+// Daemon runs the probe on the schedule of the config. It is safe for concurrent use
+type Daemon struct {
+	cfg      *config.Config
+	schedule *cron.Schedule
+	loc      *time.Location
+	opts     Options
+	alerts   *alert.Manager
+	logger   *slog.Logger
+
+	mu                  sync.Mutex
+	runs                []Run
+	total               int
+	failures            int
+	consecutiveFailures int
+	running             bool
+	next                time.Time
+}
+
+// New creates a daemon running the probe on the schedule of the config and registers its health and runs on the
+// control server
+func New(cfg *config.Config, opts Options, logger *slog.Logger) (*Daemon, error) {
+	if cfg.Schedule.Cron == "" {
+		return nil, errors.New("no schedule cron configured")
+	}
+	schedule, loc, err := cfg.Schedule.Parse()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Schedule.ReportDir != "" {
+		if err := os.MkdirAll(cfg.Schedule.ReportDir, 0o755); err != nil {
+			return nil, fmt.Errorf("error creating report directory: %w", err)
+		}
+	}
+	if opts.Run == nil {
+		opts.Run = probe.RunProbe
+	}
+	alerts, err := alert.New(cfg.Schedule.Alerts, history.Instance(cfg.History), logger)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Daemon{cfg: cfg, schedule: schedule, loc: loc, opts: opts, alerts: alerts, logger: logger}
+	if opts.Server != nil {
+		opts.Server.Handle("GET /v1/health", http.HandlerFunc(d.serveHealth))
+		opts.Server.Handle("GET /v1/runs", http.HandlerFunc(d.serveRuns))
+	}
+	return d, nil
+}
+
+// Run runs the probe at every scheduled time until the context is cancelled. Runs never overlap: the times that pass
+// while a run is in progress are skipped
+func (d *Daemon) Run(ctx context.Context) error {
+	if d.opts.Server != nil {
+		ctx = probe.WithControlServer(ctx, d.opts.Server)
+	}
+	if d.opts.Stream != nil {
+		ctx = probe.WithStreamServer(ctx, d.opts.Stream)
+	}
+	if d.cfg.Schedule.RunAtStart {
+		d.runOnce(ctx, time.Now())
+	}
+	for ctx.Err() == nil {
+		next := d.schedule.Next(time.Now().In(d.loc))
+		if next.IsZero() {
+			return fmt.Errorf("schedule %q has no next run", d.schedule)
+		}
+		d.mu.Lock()
+		d.next = next
+		d.mu.Unlock()
+		d.logger.Info("Next run scheduled", "at", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+			d.runOnce(ctx, next)
+		}
+	}
+	return nil
+}
+
+// runOnce runs the probe, writes its report, records its outcome and evaluates the alerts
+func (d *Daemon) runOnce(ctx context.Context, scheduledAt time.Time) {
+	d.mu.Lock()
+	d.running = true
+	d.next = time.Time{}
+	d.mu.Unlock()
+	d.logger.Info("Starting scheduled run", "scheduled_at", scheduledAt.Format(time.RFC3339))
+
+	run := Run{ScheduledAt: scheduledAt}
+	result, err := d.opts.Run(ctx, d.cfg, d.logger)
+	if err != nil {
+		d.logger.Error("Scheduled run failed to start", "error", err)
+		run.Error = err.Error()
+	} else {
+		summary := result.Report.Summary()
+		run.RunID = result.RunID
+		run.Passed = !result.Failed()
+		run.Summary = &summary
+		if d.cfg.Schedule.ReportDir != "" {
+			if run.ReportFile, err = d.writeReport(result.Report); err != nil {
+				d.logger.Error("Failed to write report", "dir", d.cfg.Schedule.ReportDir, "error", err)
+				run.Error = err.Error()
+			}
+		}
+		d.logger.Info("Scheduled run completed",
+			"run_id", run.RunID,
+			"passed", run.Passed,
+			"successful_requests", summary.SuccessfulRequests,
+			"failed_requests", summary.FailedRequests,
+			"p99_ms", summary.P99MS)
+	}
+
+	d.record(run)
+	observed := alert.Run{RunID: run.RunID, ScheduledAt: scheduledAt, Passed: run.Passed, Error: run.Error, ReportFile: run.ReportFile}
+	if result != nil {
+		observed.Report = result.Report
+	}
+	d.alerts.Observe(ctx, observed)
+	if d.opts.AfterRun != nil {
+		d.opts.AfterRun(run, result)
+	}
+}
+
+// record adds the outcome of a run to the health of the daemon
+func (d *Daemon) record(run Run) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.running = false
+	d.total++
+	if run.Passed {
+		d.consecutiveFailures = 0
+	} else {
+		d.failures++
+		d.consecutiveFailures++
+	}
+	d.runs = append(d.runs, run)
+	if len(d.runs) > maxRuns {
+		d.runs = slices.Delete(d.runs, 0, len(d.runs)-maxRuns)
+	}
+}
+
+// writeReport writes the report of a run to the report directory and removes the oldest reports beyond keep_reports.
+// The names start with the start time, so they sort in the order of the runs
+func (d *Daemon) writeReport(r *report.Report) (string, error) {
+	dir := d.cfg.Schedule.ReportDir
+	name := filepath.Join(dir, fmt.Sprintf("run-%s-%s.json", r.StartedAt.UTC().Format("20060102T150405Z"), r.RunID))
+	f, err := os.Create(name)
+	if err != nil {
+		return "", fmt.Errorf("error creating report file: %w", err)
+	}
+	if err := report.WriteJSON(f, r); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("error writing report file: %w", err)
+	}
+
+	if keep := d.cfg.Schedule.KeepReports; keep > 0 {
+		reports, err := filepath.Glob(filepath.Join(dir, "run-*.json"))
+		if err != nil {
+			return name, err
+		}
+		slices.Sort(reports)
+		for _, old := range reports[:max(len(reports)-keep, 0)] {
+			if err := os.Remove(old); err != nil {
+				d.logger.Warn("Failed to remove old report", "file", old, "error", err)
+			}
+		}
+	}
+	return name, nil
+}
+
+// Health returns the state of the daemon
+func (d *Daemon) Health() Health {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	h := Health{
+		Status:              StatusStarting,
+		Runs:                d.total,
+		Failures:            d.failures,
+		ConsecutiveFailures: d.consecutiveFailures,
+		Running:             d.running,
+		NextRun:             d.next,
+		FiringAlerts:        d.alerts.Firing(),
+	}
+	if len(d.runs) > 0 {
+		last := d.runs[len(d.runs)-1]
+		h.LastRun = &last
+		h.Status = StatusPassing
+		if !last.Passed {
+			h.Status = StatusFailing
+		}
+	}
+	return h
+}
+
+// Runs returns the recent runs, the latest first
+func (d *Daemon) Runs() []Run {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	runs := slices.Clone(d.runs)
+	slices.Reverse(runs)
+	return runs
+}
+
+// serveHealth serves the health of the daemon, with 503 Service Unavailable when the last run failed so it can back
+// a liveness or uptime check
+func (d *Daemon) serveHealth(w http.ResponseWriter, r *http.Request) {
+	h := d.Health()
+	status := http.StatusOK
+	if h.Status == StatusFailing {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, h)
+}
+
+// serveRuns serves the recent runs, the latest first
+func (d *Daemon) serveRuns(w http.ResponseWriter, r *http.Request) {
+	runs := d.Runs()
+	if runs == nil {
+		runs = []Run{}
+	}
+	writeJSON(w, http.StatusOK, map[string][]Run{"runs": runs})
+}
+
+// writeJSON writes the value as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
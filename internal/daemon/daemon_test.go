@@ -0,0 +1,160 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/probe"
+	"github.com/dasvh/enchante/internal/report"
+	"github.com/dasvh/enchante/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRuns returns a run function returning the outcomes in order, true for a passed run and false for a run with
+// failed requests, and an error after the last outcome
+func fakeRuns(outcomes ...bool) RunFunc {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	calls := 0
+	return func(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*probe.ProbeResult, error) {
+		if calls >= len(outcomes) {
+			return nil, errors.New("target unreachable")
+		}
+		r := &report.Report{
+			StartedAt:          start.Add(time.Duration(calls) * time.Minute),
+			RunID:              fmt.Sprintf("run%d", calls),
+			TotalRequests:      10,
+			SuccessfulRequests: 10,
+		}
+		if !outcomes[calls] {
+			r.SuccessfulRequests, r.FailedRequests = 7, 3
+		}
+		calls++
+		return &probe.ProbeResult{Report: r}, nil
+	}
+}
+
+func TestDaemonRuns(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "reports")
+	cfg := &config.Config{Schedule: config.ScheduleConfig{Cron: "@hourly", ReportDir: dir, KeepReports: 2}}
+	var afterRun []Run
+	d, err := New(cfg, Options{
+		Run:      fakeRuns(true, false, false),
+		AfterRun: func(run Run, result *probe.ProbeResult) { afterRun = append(afterRun, run) },
+	}, testutil.Logger)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusStarting, d.Health().Status)
+
+	d.runOnce(t.Context(), time.Now())
+	health := d.Health()
+	assert.Equal(t, StatusPassing, health.Status)
+	assert.Equal(t, "run0", health.LastRun.RunID)
+	assert.Equal(t, 10, health.LastRun.Summary.SuccessfulRequests)
+
+	d.runOnce(t.Context(), time.Now())
+	d.runOnce(t.Context(), time.Now())
+	health = d.Health()
+	assert.Equal(t, StatusFailing, health.Status)
+	assert.Equal(t, 3, health.Runs)
+	assert.Equal(t, 2, health.Failures)
+	assert.Equal(t, 2, health.ConsecutiveFailures)
+
+	d.runOnce(t.Context(), time.Now())
+	health = d.Health()
+	assert.Equal(t, "target unreachable", health.LastRun.Error)
+	assert.Equal(t, 3, health.ConsecutiveFailures)
+	assert.Len(t, afterRun, 4)
+
+	runs := d.Runs()
+	assert.Len(t, runs, 4)
+	assert.Empty(t, runs[0].RunID, "Expected the latest run first")
+	assert.Equal(t, "run0", runs[3].RunID)
+
+	reports, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{runs[2].ReportFile, runs[1].ReportFile}, reports, "Expected only the latest 2 reports to be kept")
+	data, err := os.ReadFile(runs[1].ReportFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"run_id": "run2"`)
+}
+
+func TestDaemonControlAPI(t *testing.T) {
+	server, err := probe.NewControlServer(config.ControlConfig{Listen: "127.0.0.1:0"}, testutil.Logger)
+	assert.NoError(t, err)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	runs := fakeRuns(false)
+	cfg := &config.Config{Schedule: config.ScheduleConfig{Cron: "@daily", RunAtStart: true}}
+	d, err := New(cfg, Options{
+		Server: server,
+		Run: func(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*probe.ProbeResult, error) {
+			cancel()
+			return runs(ctx, cfg, logger)
+		},
+	}, testutil.Logger)
+	assert.NoError(t, err)
+	assert.NoError(t, d.Run(ctx))
+
+	resp, err := http.Get("http://" + server.Addr() + "/v1/health")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "Expected a failed last run to be unhealthy")
+	var health Health
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+	assert.Equal(t, StatusFailing, health.Status)
+	assert.Equal(t, 1, health.Runs)
+
+	resp, err = http.Get("http://" + server.Addr() + "/v1/runs")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	var body struct {
+		Runs []Run `json:"runs"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Len(t, body.Runs, 1)
+
+	resp, err = http.Get("http://" + server.Addr() + "/v1/stats")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode, "Expected no run in progress between runs")
+}
+
+func TestDaemonAlerts(t *testing.T) {
+	var notifications atomic.Int32
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notifications.Add(1)
+	}))
+	defer webhook.Close()
+
+	cfg := &config.Config{Schedule: config.ScheduleConfig{
+		Cron:   "@hourly",
+		Alerts: []config.AlertConfig{{Name: "down", ConsecutiveRuns: 2, Webhook: config.AlertWebhook{URL: webhook.URL}}},
+	}}
+	d, err := New(cfg, Options{Run: fakeRuns(false, false, true)}, testutil.Logger)
+	assert.NoError(t, err)
+
+	d.runOnce(t.Context(), time.Now())
+	assert.Empty(t, d.Health().FiringAlerts)
+	d.runOnce(t.Context(), time.Now())
+	assert.Equal(t, []string{"down"}, d.Health().FiringAlerts)
+	assert.Equal(t, int32(1), notifications.Load())
+	d.runOnce(t.Context(), time.Now())
+	assert.Empty(t, d.Health().FiringAlerts)
+}
+
+func TestNewWithoutSchedule(t *testing.T) {
+	_, err := New(&config.Config{}, Options{}, testutil.Logger)
+	assert.ErrorContains(t, err, "no schedule cron configured")
+}
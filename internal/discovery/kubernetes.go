@@ -0,0 +1,239 @@
+package discovery
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/kube"
+)
+
+// annotations read from Services and Ingresses to adjust the generated endpoints
+const (
+	// AnnotationProbe excludes the resource from discovery when set to "false"
+	AnnotationProbe = "enchante/probe"
+	// AnnotationHealthPath overrides the health check path of the resource
+	AnnotationHealthPath = "enchante/health-path"
+	// AnnotationOwner sets the owner of the generated endpoint
+	AnnotationOwner = "enchante/owner"
+)
+
+// listPageSize is the number of resources requested per page from the API server
+const listPageSize = 500
+
+// KubernetesOptions represents the settings of a discovery run against a cluster
+type KubernetesOptions struct {
+	// Kubeconfig is the path of the kubeconfig file
+	Kubeconfig string
+	// Context is the kubeconfig context to use, the current context when empty
+	Context string
+	// Namespace limits discovery to a single namespace, all namespaces when empty
+	Namespace string
+	// Selector is a label selector the resources must match, e.g. "app=shop,tier!=batch"
+	Selector string
+	// HealthPath is the path probed on every discovered service, unless overridden by an annotation
+	HealthPath string
+	// Services and Ingresses select the resource kinds to discover
+	Services  bool
+	Ingresses bool
+}
+
+// objectMeta holds the metadata of a Kubernetes resource
+type objectMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// listMeta holds the pagination token of a list response
+type listMeta struct {
+	Continue string `json:"continue"`
+}
+
+// service represents the fields of a Service used for discovery
+type service struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		Type  string        `json:"type"`
+		Ports []servicePort `json:"ports"`
+	} `json:"spec"`
+}
+
+// servicePort represents a port exposed by a Service
+type servicePort struct {
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// ingress represents the fields of an Ingress used for discovery
+type ingress struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		TLS []struct {
+			Hosts []string `json:"hosts"`
+		} `json:"tls"`
+		Rules []struct {
+			Host string `json:"host"`
+		} `json:"rules"`
+	} `json:"spec"`
+}
+
+// DiscoverKubernetes lists the Services and Ingresses matching the options and returns a health check endpoint for
+// each of them, sorted by URL so regenerated configs only differ where the cluster changed
+func DiscoverKubernetes(ctx context.Context, opts KubernetesOptions, logger *slog.Logger) ([]config.Endpoint, error) {
+	client, err := kube.Load(opts.Kubeconfig, opts.Context)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debug("Using Kubernetes API server", "server", client.Server())
+
+	var endpoints []config.Endpoint
+	if opts.Services {
+		services, err := listResources[service](ctx, client, "/api/v1", "services", opts)
+		if err != nil {
+			return nil, err
+		}
+		found := 0
+		for _, svc := range services {
+			if endpoint, ok := serviceEndpoint(svc, opts.HealthPath); ok {
+				endpoints = append(endpoints, endpoint)
+				found++
+			}
+		}
+		logger.Info("Discovered services", "matched", len(services), "endpoints", found)
+	}
+	if opts.Ingresses {
+		ingresses, err := listResources[ingress](ctx, client, "/apis/networking.k8s.io/v1", "ingresses", opts)
+		if err != nil {
+			return nil, err
+		}
+		found := 0
+		for _, ing := range ingresses {
+			generated := ingressEndpoints(ing, opts.HealthPath)
+			endpoints = append(endpoints, generated...)
+			found += len(generated)
+		}
+		logger.Info("Discovered ingresses", "matched", len(ingresses), "endpoints", found)
+	}
+
+	slices.SortFunc(endpoints, func(a, b config.Endpoint) int { return cmp.Compare(a.URL, b.URL) })
+	return slices.CompactFunc(endpoints, func(a, b config.Endpoint) bool { return a.URL == b.URL }), nil
+}
+
+// listResources lists all resources of a kind matching the label selector, following the pagination of the API
+func listResources[T any](ctx context.Context, client *kube.Client, group, resource string, opts KubernetesOptions) ([]T, error) {
+	path := group + "/" + resource
+	if opts.Namespace != "" {
+		path = group + "/namespaces/" + url.PathEscape(opts.Namespace) + "/" + resource
+	}
+
+	var items []T
+	next := ""
+	for {
+		query := url.Values{"limit": {strconv.Itoa(listPageSize)}}
+		if opts.Selector != "" {
+			query.Set("labelSelector", opts.Selector)
+		}
+		if next != "" {
+			query.Set("continue", next)
+		}
+
+		var page struct {
+			Metadata listMeta `json:"metadata"`
+			Items    []T      `json:"items"`
+		}
+		if err := client.Get(ctx, path+"?"+query.Encode(), &page); err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", resource, err)
+		}
+		items = append(items, page.Items...)
+		if page.Metadata.Continue == "" {
+			return items, nil
+		}
+		next = page.Metadata.Continue
+	}
+}
+
+// serviceEndpoint returns the health check endpoint of a Service on its cluster DNS name, Services without a TCP
+// port, ExternalName Services and Services opted out by annotation are skipped
+func serviceEndpoint(svc service, healthPath string) (config.Endpoint, bool) {
+	if svc.Spec.Type == "ExternalName" || svc.Metadata.Annotations[AnnotationProbe] == "false" {
+		return config.Endpoint{}, false
+	}
+	port, ok := httpPort(svc.Spec.Ports)
+	if !ok {
+		return config.Endpoint{}, false
+	}
+
+	scheme := "http"
+	if port.Name == "https" || port.Port == 443 || port.Port == 8443 {
+		scheme = "https"
+	}
+	host := svc.Metadata.Name + "." + svc.Metadata.Namespace + ".svc"
+	if (scheme == "http" && port.Port != 80) || (scheme == "https" && port.Port != 443) {
+		host += ":" + strconv.Itoa(port.Port)
+	}
+	return newEndpoint(scheme, host, svc.Metadata, healthPath), true
+}
+
+// httpPort picks the port serving HTTP: a port named http or https, then a well known HTTP port, then the first
+// TCP port
+func httpPort(ports []servicePort) (servicePort, bool) {
+	tcp := slices.DeleteFunc(slices.Clone(ports), func(p servicePort) bool {
+		return p.Protocol != "" && p.Protocol != "TCP"
+	})
+	if len(tcp) == 0 {
+		return servicePort{}, false
+	}
+	if i := slices.IndexFunc(tcp, func(p servicePort) bool { return p.Name == "http" || p.Name == "https" }); i >= 0 {
+		return tcp[i], true
+	}
+	for _, known := range []int{80, 443, 8080, 8443} {
+		if i := slices.IndexFunc(tcp, func(p servicePort) bool { return p.Port == known }); i >= 0 {
+			return tcp[i], true
+		}
+	}
+	return tcp[0], true
+}
+
+// ingressEndpoints returns a health check endpoint for every host of an Ingress, using https for hosts listed in
+// its TLS section. Rules without a host and wildcard hosts are skipped
+func ingressEndpoints(ing ingress, healthPath string) []config.Endpoint {
+	if ing.Metadata.Annotations[AnnotationProbe] == "false" {
+		return nil
+	}
+	var endpoints []config.Endpoint
+	for _, rule := range ing.Spec.Rules {
+		if rule.Host == "" || strings.HasPrefix(rule.Host, "*") {
+			continue
+		}
+		scheme := "http"
+		for _, t := range ing.Spec.TLS {
+			if slices.Contains(t.Hosts, rule.Host) {
+				scheme = "https"
+			}
+		}
+		endpoints = append(endpoints, newEndpoint(scheme, rule.Host, ing.Metadata, healthPath))
+	}
+	return endpoints
+}
+
+// newEndpoint creates a GET endpoint for the host, the annotations of the resource override the path and owner
+func newEndpoint(scheme, host string, meta objectMeta, healthPath string) config.Endpoint {
+	path := cmp.Or(meta.Annotations[AnnotationHealthPath], healthPath, "/")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return config.Endpoint{
+		URL:    scheme + "://" + host + path,
+		Method: http.MethodGet,
+		Owner:  meta.Annotations[AnnotationOwner],
+	}
+}
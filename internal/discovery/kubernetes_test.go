@@ -0,0 +1,157 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeKubeconfig writes a kubeconfig pointing at the server and returns its path
+func writeKubeconfig(t *testing.T, server, user string) string {
+	t.Helper()
+	data := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+  - name: test
+    cluster:
+      server: %s
+contexts:
+  - name: test
+    context:
+      cluster: test
+      user: test
+users:
+  - name: test
+    user:
+%s
+`, server, user)
+	filename := filepath.Join(t.TempDir(), "kubeconfig")
+	assert.NoError(t, os.WriteFile(filename, []byte(data), 0o600))
+	return filename
+}
+
+func TestDiscoverKubernetes(t *testing.T) {
+	var selectors []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		selectors = append(selectors, r.URL.Query().Get("labelSelector"))
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/api/v1/namespaces/shop/services" && r.URL.Query().Get("continue") == "":
+			fmt.Fprint(w, `{"metadata": {"continue": "page2"}, "items": [
+				{"metadata": {"name": "web", "namespace": "shop", "annotations": {"enchante/owner": "team-web"}},
+				 "spec": {"ports": [{"name": "metrics", "port": 9090, "protocol": "TCP"}, {"name": "http", "port": 80, "protocol": "TCP"}]}},
+				{"metadata": {"name": "dns", "namespace": "shop"},
+				 "spec": {"ports": [{"name": "dns", "port": 53, "protocol": "UDP"}]}}
+			]}`)
+		case r.URL.Path == "/api/v1/namespaces/shop/services":
+			fmt.Fprint(w, `{"metadata": {}, "items": [
+				{"metadata": {"name": "api", "namespace": "shop", "annotations": {"enchante/health-path": "/ready"}},
+				 "spec": {"ports": [{"port": 8080, "protocol": "TCP"}]}},
+				{"metadata": {"name": "batch", "namespace": "shop", "annotations": {"enchante/probe": "false"}},
+				 "spec": {"ports": [{"port": 80, "protocol": "TCP"}]}},
+				{"metadata": {"name": "legacy", "namespace": "shop"}, "spec": {"type": "ExternalName"}}
+			]}`)
+		case r.URL.Path == "/apis/networking.k8s.io/v1/namespaces/shop/ingresses":
+			fmt.Fprint(w, `{"metadata": {}, "items": [
+				{"metadata": {"name": "shop", "namespace": "shop"},
+				 "spec": {"tls": [{"hosts": ["shop.example.com"]}],
+				          "rules": [{"host": "shop.example.com"}, {"host": "status.example.com"}, {"host": "*.example.com"}, {}]}}
+			]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	opts := KubernetesOptions{
+		Kubeconfig: writeKubeconfig(t, server.URL, "      token: secret"),
+		Namespace:  "shop",
+		Selector:   "app=shop",
+		HealthPath: "/healthz",
+		Services:   true,
+		Ingresses:  true,
+	}
+	endpoints, err := DiscoverKubernetes(context.Background(), opts, testutil.Logger)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []config.Endpoint{
+		{URL: "http://api.shop.svc:8080/ready", Method: "GET"},
+		{URL: "http://status.example.com/healthz", Method: "GET"},
+		{URL: "http://web.shop.svc/healthz", Method: "GET", Owner: "team-web"},
+		{URL: "https://shop.example.com/healthz", Method: "GET"},
+	}, endpoints)
+	assert.Equal(t, []string{"app=shop", "app=shop", "app=shop"}, selectors, "Expected every page to be filtered by the selector")
+}
+
+func TestDiscoverKubernetesErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		user     string
+		expected string
+	}{
+		{
+			name:     "forbidden",
+			user:     "      token: secret",
+			expected: "failed to list services: API server responded with 403 Forbidden",
+		},
+		{
+			name:     "exec plugin without api version",
+			user:     "      exec:\n        command: aws",
+			expected: `exec plugin of user "test" uses apiVersion "", expected client.authentication.k8s.io/v1 or client.authentication.k8s.io/v1beta1`,
+		},
+		{
+			name:     "auth provider plugin",
+			user:     "      auth-provider:\n        name: gcp",
+			expected: `user "test" uses an auth provider plugin, which is not supported, use an exec plugin, a token or client certificate`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := KubernetesOptions{Kubeconfig: writeKubeconfig(t, server.URL, tc.user), Services: true}
+			_, err := DiscoverKubernetes(context.Background(), opts, testutil.Logger)
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestHTTPPort(t *testing.T) {
+	tests := []struct {
+		name     string
+		ports    []servicePort
+		expected int
+		ok       bool
+	}{
+		{name: "named port", ports: []servicePort{{Port: 80}, {Name: "http", Port: 3000}}, expected: 3000, ok: true},
+		{name: "well known port", ports: []servicePort{{Port: 9090}, {Port: 8080}}, expected: 8080, ok: true},
+		{name: "first port", ports: []servicePort{{Port: 9090}, {Port: 9091}}, expected: 9090, ok: true},
+		{name: "udp only", ports: []servicePort{{Port: 53, Protocol: "UDP"}}},
+		{name: "no ports"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			port, ok := httpPort(tc.ports)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.expected, port.Port)
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/probe"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// statusTimeout limits the status check of a worker before the run is fanned out
+const statusTimeout = 10 * time.Second
+
+// Options configures the coordinator of a distributed run
+type Options struct {
+	// Workers are the addresses of the workers, host:port or a URL with an http or https scheme
+	Workers []string
+	// Token authenticates the coordinator to the workers
+	Token string
+	// Client sends the requests to the workers, defaults to a client without timeout as a share lasts as long as the run
+	Client *http.Client
+}
+
+// Run fans the run out to the workers and merges their results into one result. Every worker is checked to be
+// reachable and idle first. When a worker fails, the shares of the other workers are cancelled and the run fails
+func Run(ctx context.Context, cfg *config.Config, opts Options, logger *slog.Logger) (*probe.ProbeResult, error) {
+	if len(opts.Workers) == 0 {
+		return nil, errors.New("no workers given")
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{}
+	}
+	workers := make([]string, len(opts.Workers))
+	secrets := config.HasSecrets(cfg)
+	for i, worker := range opts.Workers {
+		workers[i] = workerURL(worker)
+		if _, err := Share(cfg.ProbingConfig, i, len(workers)); err != nil {
+			return nil, err
+		}
+		if secrets && !confidential(workers[i]) {
+			return nil, fmt.Errorf("worker %s: the config holds credentials, they are only sent to workers over https",
+				workers[i])
+		}
+	}
+	for _, worker := range workers {
+		if err := checkWorker(ctx, opts, worker); err != nil {
+			return nil, fmt.Errorf("worker %s: %w", worker, err)
+		}
+	}
+
+	runID := newRunID()
+	logger.Info("Starting distributed run", "run_id", runID, "workers", len(workers))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	parts := make([]report.Part, len(workers))
+	errs := make([]error, len(workers))
+	var wg sync.WaitGroup
+	for i, worker := range workers {
+		wg.Go(func() {
+			req := RunRequest{RunID: runID, Index: i, Count: len(workers), Config: *cfg}
+			part, err := runShare(ctx, opts, worker, req)
+			if err != nil {
+				// a failed share invalidates the run, the other shares are cancelled
+				if ctx.Err() == nil {
+					logger.Error("Worker failed, cancelling the run", "worker", worker, "error", err)
+				}
+				errs[i] = fmt.Errorf("worker %s: %w", worker, err)
+				cancel()
+				return
+			}
+			logger.Info("Worker completed its share", "worker", worker,
+				"successful_requests", part.Report.SuccessfulRequests, "failed_requests", part.Report.FailedRequests)
+			parts[i] = part
+		})
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	result := probe.MergeResults(parts, cfg.ProbingConfig, logger)
+	result.RunID = runID
+	logger.Info("Distributed run completed",
+		"run_id", runID,
+		"workers", len(workers),
+		"successful_requests", result.SuccessfulRequests,
+		"failed_requests", result.FailedRequests,
+		"p99_ms", result.Latency.P99MS)
+	return result, nil
+}
+
+// workerURL returns the base URL of a worker address, http is assumed without a scheme
+func workerURL(worker string) string {
+	if !strings.Contains(worker, "://") {
+		worker = "http://" + worker
+	}
+	return strings.TrimRight(worker, "/")
+}
+
+// confidential reports whether the requests to the worker URL are encrypted or do not leave the machine
+func confidential(worker string) bool {
+	u, err := url.Parse(worker)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "https" || config.IsLoopback(u.Hostname())
+}
+
+// checkWorker checks that the worker is reachable, accepts the token and is not running another share
+func checkWorker(ctx context.Context, opts Options, worker string) error {
+	ctx, cancel := context.WithTimeout(ctx, statusTimeout)
+	defer cancel()
+	var status Status
+	if err := call(ctx, opts, http.MethodGet, worker+statusPath, nil, &status); err != nil {
+		return err
+	}
+	if status.Busy {
+		return fmt.Errorf("busy with run %s", status.RunID)
+	}
+	return nil
+}
+
+// runShare posts the share to the worker and returns its report, it returns when the worker completed the share
+func runShare(ctx context.Context, opts Options, worker string, req RunRequest) (report.Part, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return report.Part{}, fmt.Errorf("error encoding run request: %w", err)
+	}
+	var part report.Part
+	if err := call(ctx, opts, http.MethodPost, worker+runPath, body, &part); err != nil {
+		return report.Part{}, err
+	}
+	if part.Report == nil {
+		return report.Part{}, errors.New("worker returned no report")
+	}
+	return part, nil
+}
+
+// call sends a request of the control protocol and decodes the JSON response into v
+func call(ctx context.Context, opts Options, method, url string, body []byte, v any) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.Token)
+	}
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure errorResponse
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &failure) != nil || failure.Error == "" {
+			failure.Error = strings.TrimSpace(string(data))
+		}
+		return fmt.Errorf("status %d: %s", resp.StatusCode, failure.Error)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// newRunID returns a random ID identifying the distributed run in the logs of the coordinator and the workers
+func newRunID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,155 @@
+// Package distributed fans a run out to several worker nodes and merges their results, so load beyond the capacity of
+// a single machine can be generated. The coordinator and the workers talk JSON over HTTP: the coordinator posts the
+// config and the share of every worker, and each worker answers with its report and histograms when its share is done.
+// Workers can also run in the pods of a Kubernetes Job, writing their result to their logs
+package distributed
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/probe"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// TokenEnv is the environment variable holding the token the coordinator authenticates to the workers with
+const TokenEnv = "ENCHANTE_WORKER_TOKEN"
+
+// paths of the control protocol
+const (
+	runPath    = "/v1/run"
+	statusPath = "/v1/status"
+)
+
+// RunRequest represents the share of a run a coordinator sends to a worker. The config is resolved by the
+// coordinator, so the workers need no access to the secrets of the references
+type RunRequest struct {
+	// RunID identifies the distributed run in the logs of the workers
+	RunID string `json:"run_id"`
+	// Index is the position of the worker among Count workers, it selects the share of the load
+	Index  int           `json:"index"`
+	Count  int           `json:"count"`
+	Config config.Config `json:"config"`
+}
+
+// shareConfig returns the config of the share of the worker at Index
+func (req RunRequest) shareConfig() (*config.Config, error) {
+	if req.RunID == "" || req.Count < 1 || req.Index < 0 || req.Index >= req.Count {
+		return nil, errors.New("invalid run request: run_id, index and count are required")
+	}
+	probing, err := Share(req.Config.ProbingConfig, req.Index, req.Count)
+	if err != nil {
+		return nil, err
+	}
+	cfg := req.Config
+	cfg.ProbingConfig = probing
+	config.RegisterSecrets(&cfg)
+	return &cfg, nil
+}
+
+// RunShare runs the share of the request and returns its report and histograms
+func RunShare(ctx context.Context, req RunRequest, logger *slog.Logger) (report.Part, error) {
+	cfg, err := req.shareConfig()
+	if err != nil {
+		return report.Part{}, err
+	}
+	result, err := probe.RunProbe(ctx, cfg, logger)
+	if err != nil {
+		return report.Part{}, err
+	}
+	return result.Part(), nil
+}
+
+// resultPrefix starts the line a worker writes the result of its share on, the log lines around it are ignored
+const resultPrefix = "enchante-result: "
+
+// maxResultLine limits the length of the result line read from the logs of a worker
+const maxResultLine = 64 << 20
+
+// WriteResult writes the result of a share as a single line, so it can be found in the logs of a worker
+func WriteResult(w io.Writer, part report.Part) error {
+	data, err := json.Marshal(part)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", resultPrefix, data)
+	return err
+}
+
+// ReadResult finds the result of a share written by WriteResult in the logs of a worker
+func ReadResult(r io.Reader) (report.Part, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxResultLine)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), resultPrefix)
+		if !ok {
+			continue
+		}
+		var part report.Part
+		if err := json.Unmarshal([]byte(data), &part); err != nil {
+			return report.Part{}, fmt.Errorf("error decoding result: %w", err)
+		}
+		if part.Report == nil {
+			return report.Part{}, errors.New("result has no report")
+		}
+		return part, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return report.Part{}, err
+	}
+	return report.Part{}, errors.New("no result found in the logs")
+}
+
+// Status represents the state of a worker, a worker runs one share at a time
+type Status struct {
+	Busy  bool   `json:"busy"`
+	RunID string `json:"run_id,omitempty"`
+}
+
+// errorResponse is the body of a failed request to a worker
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Share returns the probing config of the worker at index among count workers. The iterations, workers and arrival
+// rate, or the virtual users, are divided between the workers, the first workers taking the remainder. The raw
+// samples, audit file, progress webhook and result stream are disabled, as they would be written on every worker
+func Share(probing config.ProbingConfig, index, count int) (config.ProbingConfig, error) {
+	if probing.VirtualUsers.Enabled {
+		if probing.VirtualUsers.Count < count {
+			return probing, fmt.Errorf("%d virtual users can not be divided between %d workers", probing.VirtualUsers.Count, count)
+		}
+		probing.VirtualUsers.Count = share(probing.VirtualUsers.Count, index, count)
+	} else {
+		if probing.TotalRequests < count || probing.ConcurrentRequests < count {
+			return probing, fmt.Errorf("%d iterations on %d concurrent workers can not be divided between %d workers",
+				probing.TotalRequests, probing.ConcurrentRequests, count)
+		}
+		// the arrival rate of the open model is divided like the iterations, so all workers finish at the same time
+		probing.Engine.RateRPS *= float64(share(probing.TotalRequests, index, count)) / float64(probing.TotalRequests)
+		probing.TotalRequests = share(probing.TotalRequests, index, count)
+		probing.ConcurrentRequests = share(probing.ConcurrentRequests, index, count)
+	}
+
+	probing.SamplesFile = ""
+	probing.Audit = config.AuditConfig{}
+	probing.ProgressWebhook = config.WebhookConfig{}
+	probing.ResultStream = config.StreamConfig{}
+	return probing, nil
+}
+
+// share returns the part of total of the worker at index among count workers
+func share(total, index, count int) int {
+	n := total / count
+	if index < total%count {
+		n++
+	}
+	return n
+}
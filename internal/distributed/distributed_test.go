@@ -0,0 +1,345 @@
+package distributed
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/probe"
+	"github.com/dasvh/enchante/internal/report"
+	"github.com/dasvh/enchante/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShare(t *testing.T) {
+	probing := config.ProbingConfig{
+		TotalRequests:      10,
+		ConcurrentRequests: 5,
+		SamplesFile:        "samples.ndjson",
+		Audit:              config.AuditConfig{File: "audit.ndjson"},
+		ResultStream:       config.StreamConfig{Listen: ":8090"},
+	}
+
+	var total, concurrent int
+	for i := range 3 {
+		s, err := Share(probing, i, 3)
+		assert.NoError(t, err)
+		total += s.TotalRequests
+		concurrent += s.ConcurrentRequests
+		assert.Empty(t, s.SamplesFile)
+		assert.Empty(t, s.Audit.File)
+		assert.Empty(t, s.ResultStream.Listen)
+	}
+	assert.Equal(t, 10, total)
+	assert.Equal(t, 5, concurrent)
+
+	first, _ := Share(probing, 0, 3)
+	last, _ := Share(probing, 2, 3)
+	assert.Equal(t, 4, first.TotalRequests, "Expected the first workers to take the remainder")
+	assert.Equal(t, 3, last.TotalRequests)
+
+	probing.Engine = config.EngineConfig{Model: config.EngineOpen, RateRPS: 100}
+	first, _ = Share(probing, 0, 3)
+	assert.InDelta(t, 40, first.Engine.RateRPS, 0.001, "Expected the arrival rate to be divided like the iterations")
+
+	_, err := Share(probing, 0, 6)
+	assert.ErrorContains(t, err, "can not be divided between 6 workers")
+
+	vus := config.ProbingConfig{TotalRequests: 10, VirtualUsers: config.VirtualUsers{Enabled: true, Count: 4}}
+	s, err := Share(vus, 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, s.VirtualUsers.Count)
+	assert.Equal(t, 10, s.TotalRequests, "Expected the iterations per virtual user to be kept")
+}
+
+func TestRun(t *testing.T) {
+	var requests atomic.Int64
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1)%5 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer target.Close()
+	first := httptest.NewServer(NewWorker("token", testutil.Logger))
+	defer first.Close()
+	second := httptest.NewServer(NewWorker("token", testutil.Logger))
+	defer second.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 2,
+			TotalRequests:      25,
+			RequestTimeoutMS:   1000,
+			Endpoints:          []config.Endpoint{{URL: target.URL, Method: "GET"}},
+			Thresholds:         []config.Threshold{{Metric: "error_rate", Max: 0.1}},
+		},
+	}
+
+	result, err := Run(t.Context(), cfg, Options{Workers: []string{first.URL, second.URL}, Token: "token"}, testutil.Logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 25, result.TotalRequests)
+	assert.Equal(t, 20, result.SuccessfulRequests)
+	assert.Equal(t, 5, result.FailedRequests)
+	assert.Len(t, result.Endpoints, 1)
+	assert.Equal(t, 25, result.Endpoints[0].SuccessfulRequests+result.Endpoints[0].FailedRequests)
+	assert.Equal(t, 5, result.Errors["status_5xx"])
+	assert.NotEmpty(t, result.RunID)
+	assert.Positive(t, result.Latency.P99MS)
+	assert.Len(t, result.Thresholds, 1)
+	assert.True(t, result.Thresholds[0].Breached, "Expected the thresholds to be evaluated against the merged report")
+	assert.True(t, result.Failed())
+}
+
+func TestRunWorkerErrors(t *testing.T) {
+	cfg := &config.Config{ProbingConfig: config.ProbingConfig{ConcurrentRequests: 1, TotalRequests: 1,
+		Endpoints: []config.Endpoint{{URL: "http://localhost/", Method: "GET"}}}}
+
+	worker := httptest.NewServer(NewWorker("token", testutil.Logger))
+	defer worker.Close()
+	_, err := Run(t.Context(), cfg, Options{Workers: []string{worker.URL}, Token: "wrong"}, testutil.Logger)
+	assert.ErrorContains(t, err, "status 401: invalid worker token")
+
+	busy := NewWorker("", testutil.Logger)
+	busy.runID = "other"
+	busyServer := httptest.NewServer(busy)
+	defer busyServer.Close()
+	_, err = Run(t.Context(), cfg, Options{Workers: []string{busyServer.URL}}, testutil.Logger)
+	assert.ErrorContains(t, err, "busy with run other")
+
+	_, err = Run(t.Context(), cfg, Options{Workers: []string{worker.URL, worker.URL}, Token: "token"}, testutil.Logger)
+	assert.ErrorContains(t, err, "can not be divided between 2 workers")
+}
+
+func TestRunCancelsOtherShares(t *testing.T) {
+	cfg := &config.Config{ProbingConfig: config.ProbingConfig{ConcurrentRequests: 2, TotalRequests: 2,
+		Endpoints: []config.Endpoint{{URL: "http://localhost/", Method: "GET"}}}}
+
+	failing := NewWorker("", testutil.Logger)
+	failing.run = func(*http.Request, *config.Config) (*probe.ProbeResult, error) {
+		return nil, assert.AnError
+	}
+	cancelled := make(chan struct{})
+	blocking := NewWorker("", testutil.Logger)
+	blocking.run = func(r *http.Request, _ *config.Config) (*probe.ProbeResult, error) {
+		<-r.Context().Done()
+		close(cancelled)
+		return nil, r.Context().Err()
+	}
+	failingServer := httptest.NewServer(failing)
+	defer failingServer.Close()
+	blockingServer := httptest.NewServer(blocking)
+	defer blockingServer.Close()
+
+	_, err := Run(t.Context(), cfg, Options{Workers: []string{failingServer.URL, blockingServer.URL}}, testutil.Logger)
+	assert.ErrorContains(t, err, assert.AnError.Error())
+	<-cancelled
+}
+
+func TestWorkerURL(t *testing.T) {
+	assert.Equal(t, "http://load-1:9000", workerURL("load-1:9000"))
+	assert.Equal(t, "https://load-1:9000", workerURL("https://load-1:9000/"))
+}
+
+func TestRunRefusesCredentialsOverHTTP(t *testing.T) {
+	cfg := &config.Config{
+		Auth: config.AuthConfig{Enabled: true, Type: "basic", Basic: config.BasicAuth{Username: "user", Password: "s3cret"}},
+		ProbingConfig: config.ProbingConfig{ConcurrentRequests: 1, TotalRequests: 1,
+			Endpoints: []config.Endpoint{{URL: "http://localhost/", Method: "GET"}}},
+	}
+	_, err := Run(t.Context(), cfg, Options{Workers: []string{"load-1:9000"}}, testutil.Logger)
+	assert.EqualError(t, err, "worker http://load-1:9000: the config holds credentials, they are only sent to workers over https")
+}
+
+func TestConfidential(t *testing.T) {
+	tests := []struct {
+		worker   string
+		expected bool
+	}{
+		{worker: "https://load-1:9000", expected: true},
+		{worker: "http://load-1:9000", expected: false},
+		{worker: "http://localhost:9000", expected: true},
+		{worker: "http://127.0.0.1:9000", expected: true},
+		{worker: "http://[::1]:9000", expected: true},
+		{worker: "http://10.0.0.1:9000", expected: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.worker, func(t *testing.T) {
+			assert.Equal(t, tc.expected, confidential(tc.worker))
+		})
+	}
+}
+
+func TestResult(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString(`{"level":"INFO","msg":"Starting share of distributed run"}` + "\n")
+	assert.NoError(t, WriteResult(&buf, report.Part{Report: &report.Report{TotalRequests: 3}}))
+	buf.WriteString(`{"level":"INFO","msg":"Share of distributed run completed"}` + "\n")
+
+	part, err := ReadResult(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, part.Report.TotalRequests)
+
+	_, err = ReadResult(strings.NewReader("no result\n"))
+	assert.EqualError(t, err, "no result found in the logs")
+}
+
+// fakeCluster serves the parts of the Kubernetes API used by RunJob, running the share of every completion index
+// when the Job is created and serving the result in the logs of its pod
+type fakeCluster struct {
+	t       *testing.T
+	fail    bool
+	mu      sync.Mutex
+	runFile []byte
+	job     map[string]any
+	logs    map[string]string
+	polls   int
+	deleted []string
+}
+
+func (c *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/namespaces/load/secrets":
+		var secret struct {
+			Data map[string][]byte `json:"data"`
+		}
+		assert.NoError(c.t, json.NewDecoder(r.Body).Decode(&secret))
+		c.runFile = secret.Data[runFileName]
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/apis/batch/v1/namespaces/load/jobs":
+		assert.NoError(c.t, json.NewDecoder(r.Body).Decode(&c.job))
+		var req RunRequest
+		assert.NoError(c.t, json.Unmarshal(c.runFile, &req))
+		c.logs = make(map[string]string)
+		for i := range req.Count {
+			req.Index = i
+			part, err := RunShare(r.Context(), req, testutil.Logger)
+			assert.NoError(c.t, err)
+			var logs bytes.Buffer
+			assert.NoError(c.t, WriteResult(&logs, part))
+			c.logs[fmt.Sprintf("worker-%d", i)] = logs.String()
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/apis/batch/v1/namespaces/load/jobs/"):
+		c.polls++
+		switch {
+		case c.polls == 1:
+			fmt.Fprint(w, `{"status": {"active": 2}}`)
+		case c.fail:
+			fmt.Fprint(w, `{"status": {"failed": 1, "conditions": [{"type": "Failed", "status": "True", "reason": "BackoffLimitExceeded", "message": "Job has reached the specified backoff limit"}]}}`)
+		default:
+			fmt.Fprint(w, `{"status": {"succeeded": 2, "conditions": [{"type": "Complete", "status": "True"}]}}`)
+		}
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/namespaces/load/pods":
+		assert.True(c.t, strings.HasPrefix(r.URL.Query().Get("labelSelector"), labelRunID+"="))
+		fmt.Fprint(w, `{"items": [
+			{"metadata": {"name": "worker-0-failed", "annotations": {"batch.kubernetes.io/job-completion-index": "0"}}, "status": {"phase": "Failed"}},
+			{"metadata": {"name": "worker-1", "annotations": {"batch.kubernetes.io/job-completion-index": "1"}}, "status": {"phase": "Succeeded"}},
+			{"metadata": {"name": "worker-0", "annotations": {"batch.kubernetes.io/job-completion-index": "0"}}, "status": {"phase": "Succeeded"}}
+		]}`)
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/log"):
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/load/pods/"), "/log")
+		assert.Equal(c.t, "worker", r.URL.Query().Get("container"))
+		fmt.Fprint(w, c.logs[name])
+	case r.Method == http.MethodDelete:
+		c.deleted = append(c.deleted, r.URL.Path)
+		fmt.Fprint(w, `{}`)
+	default:
+		c.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// writeKubeconfig writes a kubeconfig pointing at the server with the namespace load
+func writeKubeconfig(t *testing.T, server string) string {
+	t.Helper()
+	data := fmt.Sprintf(`current-context: test
+clusters:
+  - name: test
+    cluster:
+      server: %s
+contexts:
+  - name: test
+    context:
+      cluster: test
+      namespace: load
+`, server)
+	filename := filepath.Join(t.TempDir(), "kubeconfig")
+	assert.NoError(t, os.WriteFile(filename, []byte(data), 0o600))
+	return filename
+}
+
+func TestRunJob(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	cluster := &fakeCluster{t: t}
+	api := httptest.NewServer(cluster)
+	defer api.Close()
+
+	cfg := &config.Config{ProbingConfig: config.ProbingConfig{ConcurrentRequests: 2, TotalRequests: 9, RequestTimeoutMS: 1000,
+		Endpoints: []config.Endpoint{{URL: target.URL, Method: "GET"}}}}
+	opts := JobOptions{
+		Kubeconfig:   writeKubeconfig(t, api.URL),
+		Image:        "enchante:test",
+		Replicas:     2,
+		CPU:          "500m",
+		PollInterval: time.Millisecond,
+	}
+
+	result, err := RunJob(t.Context(), cfg, opts, testutil.Logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 9, result.TotalRequests)
+	assert.Equal(t, 9, result.SuccessfulRequests)
+	assert.NotEmpty(t, result.RunID)
+
+	name := "enchante-" + result.RunID
+	spec := cluster.job["spec"].(map[string]any)
+	assert.Equal(t, "Indexed", spec["completionMode"])
+	assert.Equal(t, 2.0, spec["completions"])
+	container := spec["template"].(map[string]any)["spec"].(map[string]any)["containers"].([]any)[0].(map[string]any)
+	assert.Equal(t, "enchante:test", container["image"])
+	assert.Equal(t, map[string]any{"cpu": "500m"}, container["resources"].(map[string]any)["limits"])
+	assert.Equal(t, []string{
+		"/apis/batch/v1/namespaces/load/jobs/" + name,
+		"/api/v1/namespaces/load/secrets/" + name,
+	}, cluster.deleted, "Expected the job and secret to be deleted")
+}
+
+func TestRunJobFailed(t *testing.T) {
+	cluster := &fakeCluster{t: t, fail: true}
+	api := httptest.NewServer(cluster)
+	defer api.Close()
+
+	cfg := &config.Config{ProbingConfig: config.ProbingConfig{ConcurrentRequests: 1, TotalRequests: 1, RequestTimeoutMS: 100,
+		Endpoints: []config.Endpoint{{URL: "http://127.0.0.1:1/", Method: "GET"}}}}
+	opts := JobOptions{Kubeconfig: writeKubeconfig(t, api.URL), Image: "enchante:test", Replicas: 1, PollInterval: time.Millisecond}
+
+	_, err := RunJob(t.Context(), cfg, opts, testutil.Logger)
+	assert.ErrorContains(t, err, "failed: BackoffLimitExceeded: Job has reached the specified backoff limit")
+	assert.Len(t, cluster.deleted, 2, "Expected the job and secret to be deleted after a failure")
+
+	opts.Keep = true
+	cluster.polls = 0
+	cluster.deleted = nil
+	_, err = RunJob(t.Context(), cfg, opts, testutil.Logger)
+	assert.Error(t, err)
+	assert.Empty(t, cluster.deleted, "Expected the job and secret to be kept")
+
+	_, err = RunJob(t.Context(), cfg, JobOptions{Replicas: 1}, testutil.Logger)
+	assert.EqualError(t, err, "no worker image given")
+}
@@ -0,0 +1,310 @@
+package distributed
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/kube"
+	"github.com/dasvh/enchante/internal/probe"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// labels and annotations of the Kubernetes resources of a run
+const (
+	labelName       = "app.kubernetes.io/name"
+	labelRunID      = "enchante/run-id"
+	annotationIndex = "batch.kubernetes.io/job-completion-index"
+)
+
+// paths of the run request in the worker pods, the request is mounted from a Secret as it holds the resolved config
+const (
+	runFileDir  = "/etc/enchante"
+	runFileName = "run.json"
+)
+
+// defaults of the job options
+const (
+	defaultPollInterval = 5 * time.Second
+	cleanupTimeout      = 30 * time.Second
+)
+
+// JobOptions configures a distributed run on a Kubernetes Job
+type JobOptions struct {
+	// Kubeconfig is the path of the kubeconfig file
+	Kubeconfig string
+	// Context is the kubeconfig context to use, the current context when empty
+	Context string
+	// Namespace is the namespace of the Job, defaults to the namespace of the context or default
+	Namespace string
+	// Image is the enchante container image run by the workers
+	Image string
+	// Replicas is the number of workers, each running in its own pod
+	Replicas int
+	// CPU and Memory are the resource requests and limits of every worker, e.g. 500m and 256Mi, none when empty
+	CPU    string
+	Memory string
+	// ServiceAccount is the service account of the pods, the default of the namespace when empty
+	ServiceAccount string
+	// Keep keeps the Job and its Secret after the run for inspection
+	Keep bool
+	// PollInterval is the interval the status of the Job is checked at, defaults to 5s
+	PollInterval time.Duration
+}
+
+// job represents the fields of a Job read while waiting for its completion
+type job struct {
+	Status struct {
+		Active     int `json:"active"`
+		Succeeded  int `json:"succeeded"`
+		Failed     int `json:"failed"`
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// pod represents the fields of a worker pod read to collect its result
+type pod struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+// RunJob runs the workers in the pods of an indexed Kubernetes Job, waits for its completion and merges the results
+// the workers write to their logs. The Job and the Secret holding the config are deleted afterwards unless kept, also
+// when the run fails or is cancelled
+func RunJob(ctx context.Context, cfg *config.Config, opts JobOptions, logger *slog.Logger) (*probe.ProbeResult, error) {
+	if opts.Image == "" {
+		return nil, errors.New("no worker image given")
+	}
+	if opts.Replicas < 1 {
+		return nil, errors.New("replicas must be at least 1")
+	}
+	for i := range opts.Replicas {
+		if _, err := Share(cfg.ProbingConfig, i, opts.Replicas); err != nil {
+			return nil, err
+		}
+	}
+	client, err := kube.Load(opts.Kubeconfig, opts.Context)
+	if err != nil {
+		return nil, err
+	}
+	namespace := cmp.Or(opts.Namespace, client.Namespace(), "default")
+
+	runID := newRunID()
+	name := "enchante-" + runID
+	runFile, err := json.Marshal(RunRequest{RunID: runID, Count: opts.Replicas, Config: *cfg})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding run request: %w", err)
+	}
+
+	logger.Info("Starting distributed run on Kubernetes", "run_id", runID, "job", name, "namespace", namespace,
+		"replicas", opts.Replicas, "image", opts.Image)
+	base := "/api/v1/namespaces/" + url.PathEscape(namespace)
+	jobs := "/apis/batch/v1/namespaces/" + url.PathEscape(namespace) + "/jobs"
+	if err := client.Do(ctx, http.MethodPost, base+"/secrets", renderSecret(name, runID, runFile), nil); err != nil {
+		return nil, fmt.Errorf("failed to create secret: %w", err)
+	}
+	if !opts.Keep {
+		defer cleanup(client, base+"/secrets/"+name, "secret", logger)
+	}
+	if err := client.Do(ctx, http.MethodPost, jobs, renderJob(name, runID, opts), nil); err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+	if !opts.Keep {
+		defer cleanup(client, jobs+"/"+name, "job", logger)
+	}
+
+	if err := waitForJob(ctx, client, jobs+"/"+name, opts, logger); err != nil {
+		return nil, fmt.Errorf("job %s: %w", name, err)
+	}
+	parts, err := collectResults(ctx, client, base, runID, opts.Replicas)
+	if err != nil {
+		return nil, fmt.Errorf("job %s: %w", name, err)
+	}
+
+	result := probe.MergeResults(parts, cfg.ProbingConfig, logger)
+	result.RunID = runID
+	logger.Info("Distributed run completed",
+		"run_id", runID,
+		"workers", opts.Replicas,
+		"successful_requests", result.SuccessfulRequests,
+		"failed_requests", result.FailedRequests,
+		"p99_ms", result.Latency.P99MS)
+	return result, nil
+}
+
+// renderSecret returns the Secret holding the run request mounted by the worker pods
+func renderSecret(name, runID string, runFile []byte) map[string]any {
+	return map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]any{"name": name, "labels": labels(runID)},
+		"type":       "Opaque",
+		"data":       map[string][]byte{runFileName: runFile},
+	}
+}
+
+// renderJob returns the indexed Job running a worker per completion index, the pods prefer to run on different nodes
+// so the load is generated by separate machines. A failed worker fails the Job without retries, as a retried share
+// would not overlap with the others
+func renderJob(name, runID string, opts JobOptions) map[string]any {
+	container := map[string]any{
+		"name":  "worker",
+		"image": opts.Image,
+		"args":  []string{"worker", "-run-file", runFileDir + "/" + runFileName, "-log-format", "json", "-no-color"},
+		"volumeMounts": []map[string]any{
+			{"name": "run", "mountPath": runFileDir, "readOnly": true},
+		},
+	}
+	resources := map[string]string{}
+	if opts.CPU != "" {
+		resources["cpu"] = opts.CPU
+	}
+	if opts.Memory != "" {
+		resources["memory"] = opts.Memory
+	}
+	if len(resources) > 0 {
+		container["resources"] = map[string]any{"requests": resources, "limits": resources}
+	}
+
+	podSpec := map[string]any{
+		"restartPolicy": "Never",
+		"containers":    []map[string]any{container},
+		"volumes": []map[string]any{
+			{"name": "run", "secret": map[string]any{"secretName": name}},
+		},
+		"affinity": map[string]any{
+			"podAntiAffinity": map[string]any{
+				"preferredDuringSchedulingIgnoredDuringExecution": []map[string]any{{
+					"weight": 100,
+					"podAffinityTerm": map[string]any{
+						"topologyKey":   "kubernetes.io/hostname",
+						"labelSelector": map[string]any{"matchLabels": labels(runID)},
+					},
+				}},
+			},
+		},
+	}
+	if opts.ServiceAccount != "" {
+		podSpec["serviceAccountName"] = opts.ServiceAccount
+	}
+
+	return map[string]any{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]any{"name": name, "labels": labels(runID)},
+		"spec": map[string]any{
+			"completionMode": "Indexed",
+			"completions":    opts.Replicas,
+			"parallelism":    opts.Replicas,
+			"backoffLimit":   0,
+			"template": map[string]any{
+				"metadata": map[string]any{"labels": labels(runID)},
+				"spec":     podSpec,
+			},
+		},
+	}
+}
+
+// labels returns the labels of the resources of a run
+func labels(runID string) map[string]string {
+	return map[string]string{labelName: "enchante", labelRunID: runID}
+}
+
+// waitForJob polls the Job until it completed, it returns an error when the Job failed
+func waitForJob(ctx context.Context, client *kube.Client, path string, opts JobOptions, logger *slog.Logger) error {
+	ticker := time.NewTicker(cmp.Or(opts.PollInterval, defaultPollInterval))
+	defer ticker.Stop()
+	succeeded := 0
+	for {
+		var j job
+		if err := client.Get(ctx, path, &j); err != nil {
+			return fmt.Errorf("failed to get status: %w", err)
+		}
+		for _, c := range j.Status.Conditions {
+			if c.Status != "True" {
+				continue
+			}
+			switch c.Type {
+			case "Complete":
+				return nil
+			case "Failed":
+				return fmt.Errorf("failed: %s: %s", c.Reason, c.Message)
+			}
+		}
+		if j.Status.Succeeded != succeeded {
+			succeeded = j.Status.Succeeded
+			logger.Info("Workers completed their share", "completed", succeeded, "workers", opts.Replicas)
+		}
+		logger.Debug("Waiting for job", "active", j.Status.Active, "succeeded", j.Status.Succeeded, "failed", j.Status.Failed)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectResults reads the result of every completion index from the logs of its succeeded pod
+func collectResults(ctx context.Context, client *kube.Client, base, runID string, replicas int) ([]report.Part, error) {
+	var pods struct {
+		Items []pod `json:"items"`
+	}
+	query := url.Values{"labelSelector": {labelRunID + "=" + runID}}
+	if err := client.Get(ctx, base+"/pods?"+query.Encode(), &pods); err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	parts := make([]report.Part, replicas)
+	for _, p := range pods.Items {
+		index, err := strconv.Atoi(p.Metadata.Annotations[annotationIndex])
+		if p.Status.Phase != "Succeeded" || err != nil || index < 0 || index >= replicas || parts[index].Report != nil {
+			continue
+		}
+		logs, err := client.Stream(ctx, base+"/pods/"+url.PathEscape(p.Metadata.Name)+"/log?container=worker")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read logs of pod %s: %w", p.Metadata.Name, err)
+		}
+		part, err := ReadResult(logs)
+		logs.Close()
+		if err != nil {
+			return nil, fmt.Errorf("pod %s: %w", p.Metadata.Name, err)
+		}
+		parts[index] = part
+	}
+	for i, part := range parts {
+		if part.Report == nil {
+			return nil, fmt.Errorf("no succeeded pod for worker %d", i)
+		}
+	}
+	return parts, nil
+}
+
+// cleanup deletes a resource of the run in the background, also when the run was cancelled
+func cleanup(client *kube.Client, path, kind string, logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	// without background propagation deleting a Job leaves its pods behind
+	options := map[string]any{"kind": "DeleteOptions", "apiVersion": "v1", "propagationPolicy": "Background"}
+	if err := client.Do(ctx, http.MethodDelete, path, options, nil); err != nil {
+		logger.Warn("Failed to delete resource of the run", "kind", kind, "path", path, "error", err)
+	}
+}
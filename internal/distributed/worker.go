@@ -0,0 +1,123 @@
+package distributed
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/probe"
+)
+
+// Worker runs the shares of distributed runs posted by a coordinator, one at a time. A run is cancelled when the
+// coordinator disconnects
+type Worker struct {
+	token  string
+	logger *slog.Logger
+	mu     sync.Mutex
+	runID  string
+	// run runs the probe, replaced in tests
+	run func(r *http.Request, cfg *config.Config) (*probe.ProbeResult, error)
+}
+
+// NewWorker creates a worker accepting the runs of coordinators sending the token, any coordinator is accepted
+// without a token
+func NewWorker(token string, logger *slog.Logger) *Worker {
+	w := &Worker{token: token, logger: logger}
+	w.run = func(r *http.Request, cfg *config.Config) (*probe.ProbeResult, error) {
+		return probe.RunProbe(r.Context(), cfg, logger)
+	}
+	return w
+}
+
+// ServeHTTP serves the control protocol
+func (w *Worker) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if w.token != "" {
+		token, ok := bearerToken(r)
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(w.token)) != 1 {
+			writeError(rw, http.StatusUnauthorized, "invalid worker token")
+			return
+		}
+	}
+
+	switch {
+	case r.URL.Path == statusPath && r.Method == http.MethodGet:
+		w.mu.Lock()
+		status := Status{Busy: w.runID != "", RunID: w.runID}
+		w.mu.Unlock()
+		writeJSON(rw, http.StatusOK, status)
+	case r.URL.Path == runPath && r.Method == http.MethodPost:
+		w.serveRun(rw, r)
+	default:
+		writeError(rw, http.StatusNotFound, "unknown endpoint")
+	}
+}
+
+// serveRun runs the share of the request and answers with its report and histograms
+func (w *Worker) serveRun(rw http.ResponseWriter, r *http.Request) {
+	var req RunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(rw, http.StatusBadRequest, "invalid run request: "+err.Error())
+		return
+	}
+	cfg, err := req.shareConfig()
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.mu.Lock()
+	if w.runID != "" {
+		busy := w.runID
+		w.mu.Unlock()
+		writeError(rw, http.StatusConflict, "worker is busy with run "+busy)
+		return
+	}
+	w.runID = req.RunID
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		w.runID = ""
+		w.mu.Unlock()
+	}()
+
+	w.logger.Info("Starting share of distributed run", "run_id", req.RunID, "worker", req.Index+1, "workers", req.Count,
+		"remote", r.RemoteAddr)
+	result, err := w.run(r, cfg)
+	if err != nil {
+		w.logger.Error("Failed to run share of distributed run", "run_id", req.RunID, "error", err)
+		writeError(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if r.Context().Err() != nil {
+		w.logger.Warn("Coordinator disconnected, share of distributed run cancelled", "run_id", req.RunID)
+		return
+	}
+	w.logger.Info("Share of distributed run completed", "run_id", req.RunID,
+		"successful_requests", result.SuccessfulRequests, "failed_requests", result.FailedRequests)
+	writeJSON(rw, http.StatusOK, result.Part())
+}
+
+// bearerToken returns the token of the Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return token, true
+}
+
+// writeJSON writes the value as a JSON response
+func writeJSON(rw http.ResponseWriter, status int, v any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(v)
+}
+
+// writeError writes an error response
+func writeError(rw http.ResponseWriter, status int, message string) {
+	writeJSON(rw, status, errorResponse{Error: message})
+}
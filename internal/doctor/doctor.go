@@ -0,0 +1,271 @@
+// Package doctor checks the local environment against a probe configuration, so issues like a low open file limit,
+// unresolvable hosts or an unreachable token endpoint are reported before a long run is started
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// check statuses, only failures prevent a run from working
+const (
+	StatusOK   = "ok"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// defaults of the options
+const (
+	DefaultTimeout = 5 * time.Second
+	DefaultMaxSkew = 5 * time.Second
+)
+
+// Result represents the outcome of a single check
+type Result struct {
+	Check  string `json:"check"`
+	Target string `json:"target,omitempty"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// Options configures the checks, the zero value uses the defaults
+type Options struct {
+	// Resolver resolves the hosts, defaults to net.DefaultResolver
+	Resolver *net.Resolver
+	// Client sends the reachability requests, defaults to a client honoring the proxy environment variables
+	Client *http.Client
+	// Timeout limits every network check, defaults to DefaultTimeout
+	Timeout time.Duration
+	// MaxSkew is the clock skew to a server above which a warning is reported, defaults to DefaultMaxSkew
+	MaxSkew time.Duration
+}
+
+// Run runs all checks for the configuration and returns their results
+func Run(ctx context.Context, cfg *config.Config, opts Options) []Result {
+	if opts.Resolver == nil {
+		opts.Resolver = net.DefaultResolver
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxSkew == 0 {
+		opts.MaxSkew = DefaultMaxSkew
+	}
+
+	targets := targets(cfg.ProbingConfig)
+	results := []Result{checkOpenFiles(workers(cfg.ProbingConfig))}
+	for _, host := range hosts(targets) {
+		results = append(results, checkDNS(ctx, opts, host))
+	}
+	for _, tokenURL := range tokenURLs(cfg, targets) {
+		results = append(results, checkReachable(ctx, opts, "token endpoint", tokenURL))
+	}
+	if len(targets) > 0 {
+		results = append(results, checkClockSkew(ctx, opts, targets[0].URL, time.Now))
+	}
+	results = append(results, checkProxies(ctx, opts, cfg.ProbingConfig, targets)...)
+	return results
+}
+
+// Failed reports whether any check failed
+func Failed(results []Result) bool {
+	return slices.ContainsFunc(results, func(r Result) bool { return r.Status == StatusFail })
+}
+
+// targets returns the endpoints and the scenario steps without variables in their URL, which can only be checked
+// during a run
+func targets(probing config.ProbingConfig) []config.Endpoint {
+	var targets []config.Endpoint
+	add := func(e config.Endpoint) {
+		if !strings.Contains(e.URL, "{{") {
+			targets = append(targets, e)
+		}
+	}
+	for _, e := range probing.Endpoints {
+		add(e)
+	}
+	for _, scenario := range probing.Scenarios {
+		for _, step := range scenario.Steps {
+			add(step.Endpoint)
+		}
+	}
+	return targets
+}
+
+// workers returns the highest number of concurrent requests of the run
+func workers(probing config.ProbingConfig) int {
+	workers := probing.ConcurrentRequests
+	if probing.VirtualUsers.Enabled {
+		workers = probing.VirtualUsers.Count
+	}
+	for _, e := range probing.Endpoints {
+		if e.Ramp != nil {
+			workers += e.Ramp.MaxWorkers()
+		}
+	}
+	return workers
+}
+
+// hosts returns the distinct host names of the targets, IP addresses need no resolution
+func hosts(targets []config.Endpoint) []string {
+	var hosts []string
+	for _, target := range targets {
+		u, err := url.Parse(target.URL)
+		if err != nil || u.Hostname() == "" || net.ParseIP(u.Hostname()) != nil || slices.Contains(hosts, u.Hostname()) {
+			continue
+		}
+		hosts = append(hosts, u.Hostname())
+	}
+	return hosts
+}
+
+// tokenURLs returns the distinct OAuth2 token and session login URLs of the global and the endpoint authentication
+func tokenURLs(cfg *config.Config, targets []config.Endpoint) []string {
+	var urls []string
+	add := func(auth config.AuthConfig) {
+		if !auth.Enabled {
+			return
+		}
+		var u string
+		switch auth.Type {
+		case "oauth2":
+			u = auth.OAuth2.TokenURL
+		case "session":
+			u = auth.Session.LoginURL
+		}
+		if u != "" && !slices.Contains(urls, u) {
+			urls = append(urls, u)
+		}
+	}
+	add(cfg.Auth)
+	for _, target := range targets {
+		if target.AuthConfig != nil {
+			add(*target.AuthConfig)
+		}
+	}
+	return urls
+}
+
+// checkDNS resolves a host
+func checkDNS(ctx context.Context, opts Options, host string) Result {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	addrs, err := opts.Resolver.LookupHost(ctx, host)
+	if err != nil {
+		return Result{Check: "dns", Target: host, Status: StatusFail, Detail: err.Error()}
+	}
+	return Result{Check: "dns", Target: host, Status: StatusOK, Detail: strings.Join(addrs, ", ")}
+}
+
+// head sends a HEAD request, any response proves the server is reachable regardless of its status code
+func head(ctx context.Context, opts Options, target string) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// checkReachable checks that a server answers requests to the URL
+func checkReachable(ctx context.Context, opts Options, check, target string) Result {
+	resp, err := head(ctx, opts, target)
+	if err != nil {
+		return Result{Check: check, Target: target, Status: StatusFail, Detail: err.Error()}
+	}
+	return Result{Check: check, Target: target, Status: StatusOK, Detail: fmt.Sprintf("reachable, status %d", resp.StatusCode)}
+}
+
+// checkClockSkew compares the local clock with the Date header of a server, a skewed clock invalidates time-bound
+// tokens and misaligns the run with server-side logs
+func checkClockSkew(ctx context.Context, opts Options, target string, now func() time.Time) Result {
+	sent := now()
+	resp, err := head(ctx, opts, target)
+	if err != nil {
+		return Result{Check: "clock skew", Target: target, Status: StatusWarn, Detail: fmt.Sprintf("not checked: %v", err)}
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return Result{Check: "clock skew", Target: target, Status: StatusWarn, Detail: "not checked: response has no valid Date header"}
+	}
+	// the Date header has a resolution of a second and is compared with the middle of the round trip
+	received := now()
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := local.Sub(date).Round(time.Second)
+	if skew.Abs() > opts.MaxSkew {
+		return Result{Check: "clock skew", Target: target, Status: StatusWarn, Detail: fmt.Sprintf("local clock is off by %s", skew)}
+	}
+	return Result{Check: "clock skew", Target: target, Status: StatusOK, Detail: fmt.Sprintf("off by %s", skew)}
+}
+
+// proxyEnvironment are the environment variables the HTTP client reads its proxy settings from
+var proxyEnvironment = []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy"}
+
+// checkProxies reports the proxy environment and checks that the configured proxies are valid and reachable.
+// The proxy environment is only used by endpoints without a configured proxy
+func checkProxies(ctx context.Context, opts Options, probing config.ProbingConfig, targets []config.Endpoint) []Result {
+	var results []Result
+	for _, name := range proxyEnvironment {
+		if value := os.Getenv(name); value != "" {
+			results = append(results, Result{Check: "proxy environment", Target: name, Status: StatusOK, Detail: value})
+		}
+	}
+
+	proxies := []config.ProxyConfig{probing.Proxy}
+	for _, target := range targets {
+		if target.Proxy != nil {
+			proxies = append(proxies, *target.Proxy)
+		}
+	}
+	var checked []string
+	for _, proxy := range proxies {
+		if !proxy.Enabled || slices.Contains(checked, proxy.URL) {
+			continue
+		}
+		checked = append(checked, proxy.URL)
+		results = append(results, checkProxy(ctx, opts, proxy))
+	}
+	return results
+}
+
+// checkProxy checks that a configured proxy is valid and accepts connections
+func checkProxy(ctx context.Context, opts Options, proxy config.ProxyConfig) Result {
+	u, err := proxy.ProxyURL()
+	if err != nil {
+		return Result{Check: "proxy", Target: proxy.URL, Status: StatusFail, Detail: err.Error()}
+	}
+	// the URL without credentials is reported
+	target := u.Redacted()
+
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443", "socks5": "1080", "socks5h": "1080"}[u.Scheme]
+	}
+	dialer := net.Dialer{Timeout: opts.Timeout, Resolver: opts.Resolver}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return Result{Check: "proxy", Target: target, Status: StatusFail, Detail: err.Error()}
+	}
+	conn.Close()
+	return Result{Check: "proxy", Target: target, Status: StatusOK, Detail: "accepts connections"}
+}
@@ -0,0 +1,113 @@
+package doctor
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+func TestHostsAndTokenURLs(t *testing.T) {
+	cfg := &config.Config{
+		Auth: config.AuthConfig{Enabled: true, Type: "oauth2", OAuth2: config.OAuth2Auth{TokenURL: "https://auth.example.com/token"}},
+		ProbingConfig: config.ProbingConfig{
+			Endpoints: []config.Endpoint{
+				{URL: "https://api.example.com/a"},
+				{URL: "https://api.example.com/b"},
+				{URL: "http://127.0.0.1:8080/c"},
+				{URL: "https://{{host}}/d"},
+				{URL: "https://login.example.com/e", AuthConfig: &config.AuthConfig{Enabled: true, Type: "session", Session: config.SessionAuth{LoginURL: "https://login.example.com/login"}}},
+			},
+		},
+	}
+
+	targets := targets(cfg.ProbingConfig)
+
+	assert.Len(t, targets, 4, "Expected URLs with variables to be skipped")
+	assert.Equal(t, []string{"api.example.com", "login.example.com"}, hosts(targets))
+	assert.Equal(t, []string{"https://auth.example.com/token", "https://login.example.com/login"}, tokenURLs(cfg, targets))
+}
+
+func TestCheckReachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer server.Close()
+	opts := Options{Client: server.Client(), Timeout: time.Second}
+
+	ok := checkReachable(t.Context(), opts, "token endpoint", server.URL+"/token")
+	assert.Equal(t, StatusOK, ok.Status)
+	assert.Equal(t, "reachable, status 405", ok.Detail)
+
+	server.Close()
+	failed := checkReachable(t.Context(), opts, "token endpoint", server.URL+"/token")
+	assert.Equal(t, StatusFail, failed.Status)
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	serverTime := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", serverTime.Format(http.TimeFormat))
+	}))
+	defer server.Close()
+	opts := Options{Client: server.Client(), Timeout: time.Second, MaxSkew: 5 * time.Second}
+
+	tests := []struct {
+		name     string
+		local    time.Time
+		status   string
+		expected string
+	}{
+		{name: "In Sync", local: serverTime.Add(time.Second), status: StatusOK, expected: "off by 1s"},
+		{name: "Ahead", local: serverTime.Add(time.Minute), status: StatusWarn, expected: "local clock is off by 1m0s"},
+		{name: "Behind", local: serverTime.Add(-10 * time.Second), status: StatusWarn, expected: "local clock is off by -10s"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := checkClockSkew(t.Context(), opts, server.URL, func() time.Time { return tc.local })
+			assert.Equal(t, tc.status, result.Status)
+			assert.Equal(t, tc.expected, result.Detail)
+		})
+	}
+}
+
+func TestCheckProxies(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	closed.Close()
+
+	for _, name := range proxyEnvironment {
+		t.Setenv(name, "")
+	}
+	t.Setenv("HTTPS_PROXY", "http://proxy.internal:3128")
+	probing := config.ProbingConfig{Proxy: config.ProxyConfig{Enabled: true, URL: "http://" + listener.Addr().String(), Username: "user", Password: "secret"}}
+	targets := []config.Endpoint{
+		{URL: "https://api.example.com/", Proxy: &config.ProxyConfig{Enabled: true, URL: "socks5://" + closed.Addr().String()}},
+		{URL: "https://api.example.com/", Proxy: &config.ProxyConfig{Enabled: true, URL: "ftp://proxy.internal"}},
+	}
+
+	results := checkProxies(t.Context(), Options{Timeout: time.Second}, probing, targets)
+
+	if assert.Len(t, results, 4) {
+		assert.Equal(t, Result{Check: "proxy environment", Target: "HTTPS_PROXY", Status: StatusOK, Detail: "http://proxy.internal:3128"}, results[0])
+		assert.Equal(t, StatusOK, results[1].Status)
+		assert.Equal(t, "http://user:xxxxx@"+listener.Addr().String(), results[1].Target, "Expected the password to be redacted")
+		assert.Equal(t, StatusFail, results[2].Status)
+		assert.Equal(t, StatusFail, results[3].Status)
+		assert.Contains(t, results[3].Detail, "unsupported proxy scheme")
+	}
+	assert.True(t, Failed(results))
+}
+
+func TestCheckOpenFiles(t *testing.T) {
+	assert.NotEqual(t, StatusFail, checkOpenFiles(1).Status)
+}
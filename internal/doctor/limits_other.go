@@ -0,0 +1,8 @@
+//go:build !unix
+
+package doctor
+
+// checkOpenFiles is not supported on this platform, the limit of open files is not checked
+func checkOpenFiles(workers int) Result {
+	return Result{Check: "open files", Status: StatusOK, Detail: "not checked on this platform"}
+}
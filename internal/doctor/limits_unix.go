@@ -0,0 +1,28 @@
+//go:build unix
+
+package doctor
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// checkOpenFiles checks that the open file limit leaves room for a connection per concurrent request, with headroom
+// for the connections being replaced and the files of the process
+func checkOpenFiles(workers int) Result {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return Result{Check: "open files", Status: StatusWarn, Detail: fmt.Sprintf("not checked: %v", err)}
+	}
+	// the field is signed on some platforms, where the unlimited -1 converts to the highest limit
+	current := uint64(limit.Cur)
+	needed := uint64(2*workers + 64)
+	switch {
+	case current < uint64(workers):
+		return Result{Check: "open files", Status: StatusFail, Detail: fmt.Sprintf("limit %d is below the %d concurrent requests, raise it with ulimit -n", current, workers)}
+	case current < needed:
+		return Result{Check: "open files", Status: StatusWarn, Detail: fmt.Sprintf("limit %d may be too low for %d concurrent requests, %d recommended", current, workers, needed)}
+	default:
+		return Result{Check: "open files", Status: StatusOK, Detail: fmt.Sprintf("limit %d", current)}
+	}
+}
@@ -0,0 +1,114 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// FileStorage stores every run as a JSON file in a directory, which may be a shared volume for several instances
+type FileStorage struct {
+	dir string
+}
+
+// NewFileStorage creates the storage in dir, creating the directory when it does not exist
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating history directory: %w", err)
+	}
+	return &FileStorage{dir: dir}, nil
+}
+
+// Save writes the run to its own file, replacing an earlier run with the same ID
+func (s *FileStorage) Save(_ context.Context, run Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("error encoding run: %w", err)
+	}
+
+	// write to a temporary file first, so readers never see a partial run
+	tmp, err := os.CreateTemp(s.dir, ".run-*")
+	if err != nil {
+		return fmt.Errorf("error creating history file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing history file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing history file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(run.ID)); err != nil {
+		return fmt.Errorf("error writing history file: %w", err)
+	}
+	return nil
+}
+
+// Get reads the run with the given ID
+func (s *FileStorage) Get(_ context.Context, id string) (Run, error) {
+	run, err := s.read(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Run{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return run, err
+}
+
+// List reads the runs selected by the query
+func (s *FileStorage) List(_ context.Context, query Query) ([]Run, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading history directory: %w", err)
+	}
+
+	var runs []Run
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		run, err := s.read(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if query.matches(run) {
+			runs = append(runs, run)
+		}
+	}
+
+	slices.SortFunc(runs, func(a, b Run) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
+	if query.Limit > 0 && len(runs) > query.Limit {
+		runs = runs[:query.Limit]
+	}
+	return runs, nil
+}
+
+// Close releases nothing, the files are closed after every operation
+func (s *FileStorage) Close() error {
+	return nil
+}
+
+// path returns the file of the run with the given ID
+func (s *FileStorage) path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+".json")
+}
+
+// read decodes the run stored in the given file
+func (s *FileStorage) read(path string) (Run, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Run{}, fmt.Errorf("error reading history file: %w", err)
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return Run{}, fmt.Errorf("error parsing history file %s: %w", path, err)
+	}
+	return run, nil
+}
@@ -0,0 +1,97 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// ErrNotFound is returned when a run is not in the history
+var ErrNotFound = errors.New("run not found")
+
+// Run represents a probe run stored in the history
+type Run struct {
+	ID string `json:"id"`
+	// Instance identifies the probe instance that made the run
+	Instance  string         `json:"instance"`
+	StartedAt time.Time      `json:"started_at"`
+	Report    *report.Report `json:"report"`
+	// Config identifies the config of the run, the history name or the config file path
+	Config string `json:"config,omitempty"`
+}
+
+// Query selects runs from the history, the zero value selects all runs
+type Query struct {
+	// Since excludes runs started before it
+	Since time.Time
+	// Instance only selects the runs of the given instance
+	Instance string
+	// Limit is the maximum number of runs returned, 0 means unlimited
+	Limit int
+	// Config only selects the runs of the given config
+	Config string
+}
+
+// Storage stores the runs of one or more probe instances. Implementations must be safe for concurrent use and list
+// runs ordered by start time, the most recent first
+type Storage interface {
+	Save(ctx context.Context, run Run) error
+	Get(ctx context.Context, id string) (Run, error)
+	List(ctx context.Context, query Query) ([]Run, error)
+	Close() error
+}
+
+// NewRun creates the history entry for a run report of the given instance and config. The run is stored under the
+// run ID of the report, or its start time and instance for reports without one
+func NewRun(r *report.Report, instance, config string) Run {
+	id := r.RunID
+	if id == "" {
+		id = fmt.Sprintf("%s-%s", r.StartedAt.UTC().Format("20060102T150405.000000000Z"), instance)
+	}
+	return Run{
+		ID:        id,
+		Instance:  instance,
+		StartedAt: r.StartedAt,
+		Report:    r,
+		Config:    config,
+	}
+}
+
+// Instance returns the configured instance name, falling back to the hostname
+func Instance(cfg config.HistoryConfig) string {
+	if cfg.Instance != "" {
+		return cfg.Instance
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		return hostname
+	}
+	return "unknown"
+}
+
+// Open opens the storage of the configured backend
+func Open(cfg config.HistoryConfig) (Storage, error) {
+	switch cfg.Backend {
+	case config.HistoryFile:
+		return NewFileStorage(cfg.Path)
+	case config.HistorySQLite, config.HistoryPostgres:
+		return OpenSQL(cfg.Backend, cfg.DriverName(), cfg.DSN)
+	default:
+		return nil, fmt.Errorf("unsupported history backend: %s", cfg.Backend)
+	}
+}
+
+// matches reports whether the run is selected by the query, ignoring the limit
+func (q Query) matches(run Run) bool {
+	if !q.Since.IsZero() && run.StartedAt.Before(q.Since) {
+		return false
+	}
+	if q.Config != "" && run.Config != q.Config {
+		return false
+	}
+	return q.Instance == "" || run.Instance == q.Instance
+}
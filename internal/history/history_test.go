@@ -0,0 +1,213 @@
+package history
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func newTestRun(startedAt time.Time, instance string) Run {
+	return NewRun(&report.Report{StartedAt: startedAt, TotalRequests: 10, SuccessfulRequests: 9, FailedRequests: 1}, instance, "probe_config.yaml")
+}
+
+func TestFileStorage(t *testing.T) {
+	store, err := NewFileStorage(t.TempDir())
+	assert.NoError(t, err)
+	defer store.Close()
+
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	runs := []Run{
+		newTestRun(start, "probe-a"),
+		newTestRun(start.Add(time.Hour), "probe-b"),
+		newTestRun(start.Add(2*time.Hour), "probe-a"),
+	}
+	for _, run := range runs {
+		assert.NoError(t, store.Save(t.Context(), run))
+	}
+
+	run, err := store.Get(t.Context(), runs[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "probe-b", run.Instance)
+	assert.Equal(t, 9, run.Report.SuccessfulRequests)
+	assert.True(t, runs[1].StartedAt.Equal(run.StartedAt))
+
+	_, err = store.Get(t.Context(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	tests := []struct {
+		name     string
+		query    Query
+		expected []string
+	}{
+		{name: "All Most Recent First", expected: []string{runs[2].ID, runs[1].ID, runs[0].ID}},
+		{name: "Since", query: Query{Since: start.Add(30 * time.Minute)}, expected: []string{runs[2].ID, runs[1].ID}},
+		{name: "Instance", query: Query{Instance: "probe-a"}, expected: []string{runs[2].ID, runs[0].ID}},
+		{name: "Limit", query: Query{Limit: 1}, expected: []string{runs[2].ID}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			listed, err := store.List(t.Context(), tc.query)
+			assert.NoError(t, err)
+
+			var ids []string
+			for _, run := range listed {
+				ids = append(ids, run.ID)
+			}
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	store, err := OpenSQL(config.HistorySQLite, "sqlite", filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+	defer store.Close()
+
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	runs := []Run{
+		newTestRun(start, "probe-a"),
+		newTestRun(start.Add(time.Hour), "probe-b"),
+		newTestRun(start.Add(2*time.Hour), "probe-a"),
+	}
+	for _, run := range runs {
+		assert.NoError(t, store.Save(t.Context(), run))
+	}
+	runs[0].Report.FailedRequests = 5
+	assert.NoError(t, store.Save(t.Context(), runs[0]), "Expected a run to be replaced")
+
+	run, err := store.Get(t.Context(), runs[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "probe-a", run.Instance)
+	assert.Equal(t, "probe_config.yaml", run.Config)
+	assert.Equal(t, 5, run.Report.FailedRequests)
+	assert.True(t, runs[0].StartedAt.Equal(run.StartedAt))
+
+	_, err = store.Get(t.Context(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	listed, err := store.List(t.Context(), Query{Instance: "probe-a", Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, listed, 1)
+	assert.Equal(t, runs[2].ID, listed[0].ID)
+
+	listed, err = store.List(t.Context(), Query{Since: start.Add(30 * time.Minute), Config: "probe_config.yaml"})
+	assert.NoError(t, err)
+	assert.Len(t, listed, 2)
+}
+
+func TestFileStorageReplacesRun(t *testing.T) {
+	store, err := NewFileStorage(t.TempDir())
+	assert.NoError(t, err)
+
+	run := newTestRun(time.Now(), "probe")
+	assert.NoError(t, store.Save(t.Context(), run))
+	run.Report.FailedRequests = 5
+	assert.NoError(t, store.Save(t.Context(), run))
+
+	listed, err := store.List(t.Context(), Query{})
+	assert.NoError(t, err)
+	assert.Len(t, listed, 1)
+	assert.Equal(t, 5, listed[0].Report.FailedRequests)
+}
+
+func TestNewRun(t *testing.T) {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	run := NewRun(&report.Report{StartedAt: start, RunID: "1a2b3c4d"}, "probe-a", "checkout.yaml")
+	assert.Equal(t, "1a2b3c4d", run.ID)
+	assert.Equal(t, "checkout.yaml", run.Config)
+
+	run = NewRun(&report.Report{StartedAt: start}, "probe-a", "checkout.yaml")
+	assert.Equal(t, "20250102T030405.000000000Z-probe-a", run.ID, "Expected reports without run ID to be stored by start time")
+}
+
+func TestFileStorageConfigQuery(t *testing.T) {
+	store, err := NewFileStorage(t.TempDir())
+	assert.NoError(t, err)
+
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	checkout := NewRun(&report.Report{StartedAt: start, RunID: "a"}, "probe", "checkout.yaml")
+	search := NewRun(&report.Report{StartedAt: start.Add(time.Hour), RunID: "b"}, "probe", "search.yaml")
+	assert.NoError(t, store.Save(t.Context(), checkout))
+	assert.NoError(t, store.Save(t.Context(), search))
+
+	listed, err := store.List(t.Context(), Query{Config: "checkout.yaml"})
+	assert.NoError(t, err)
+	assert.Len(t, listed, 1)
+	assert.Equal(t, "a", listed[0].ID)
+}
+
+func TestEntries(t *testing.T) {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	run := func(id, config string, offset time.Duration, p99 float64) Run {
+		return NewRun(&report.Report{StartedAt: start.Add(offset), RunID: id, TotalRequests: 10, FailedRequests: 1,
+			Latency: report.Latency{P99MS: p99}}, "probe", config)
+	}
+	// the most recent first, as listed by the storages
+	entries := Entries([]Run{
+		run("c", "checkout.yaml", 2*time.Hour, 150),
+		run("b", "search.yaml", time.Hour, 40),
+		run("a", "checkout.yaml", 0, 100),
+	})
+
+	assert.Equal(t, 50.0, *entries[0].P99ChangePct, "Expected the change to the previous run of the same config")
+	assert.Nil(t, entries[1].P99ChangePct, "Expected no change for the first run of a config")
+	assert.Nil(t, entries[2].P99ChangePct)
+	assert.Equal(t, 0.1, entries[0].ErrorRate)
+
+	var text bytes.Buffer
+	assert.NoError(t, WriteText(&text, entries))
+	assert.Contains(t, text.String(), "P99 TREND")
+	assert.Contains(t, text.String(), "+50.0%")
+}
+
+func TestSLO(t *testing.T) {
+	run := func(total, failed int, latency ...report.SLOResult) Run {
+		return Run{Report: &report.Report{TotalRequests: total, SuccessfulRequests: total - failed, FailedRequests: failed, SLO: latency}}
+	}
+	runs := []Run{
+		run(1000, 10, report.NewSLOResult(report.SLOLatency, 90, 300, 990, 900)),
+		run(1000, 0, report.NewSLOResult(report.SLOLatency, 90, 500, 1000, 1000)),
+		run(1000, 2),
+		{ID: "no report"},
+	}
+	slo := config.SLOConfig{Availability: 99, Latency: config.LatencyObjective{ThresholdMS: 300, Target: 90}}
+
+	results := SLO(runs, slo)
+
+	assert.Len(t, results, 2)
+	assert.Equal(t, int64(3000), results[0].TotalRequests)
+	assert.Equal(t, int64(2988), results[0].GoodRequests)
+	assert.InDelta(t, 0.4, results[0].BurnRate, 1e-9)
+	assert.True(t, results[0].Met)
+	assert.Equal(t, int64(990), results[1].TotalRequests, "Expected only the runs with the same latency threshold")
+	assert.InDelta(t, 9.0909, results[1].BudgetRemaining, 1e-3)
+}
+
+func TestOpen(t *testing.T) {
+	store, err := Open(config.HistoryConfig{Backend: config.HistoryFile, Path: t.TempDir()})
+	assert.NoError(t, err)
+	assert.IsType(t, &FileStorage{}, store)
+
+	_, err = Open(config.HistoryConfig{Backend: config.HistoryPostgres, DSN: "postgres://localhost/enchante"})
+	assert.ErrorContains(t, err, `database driver "pgx" is not included in this build`)
+
+	store, err = Open(config.HistoryConfig{Backend: config.HistorySQLite, DSN: filepath.Join(t.TempDir(), "history.db")})
+	assert.NoError(t, err)
+	assert.IsType(t, &SQLStorage{}, store)
+	store.Close()
+
+	_, err = Open(config.HistoryConfig{Backend: config.HistorySQLite, DSN: "history.db", Driver: "sqlite3"})
+	assert.ErrorContains(t, err, `database driver "sqlite3"`)
+}
+
+func TestSQLDialects(t *testing.T) {
+	assert.Equal(t, "$2", dialectFor(config.HistoryPostgres).placeholder(2))
+	assert.Equal(t, "?", dialectFor(config.HistorySQLite).placeholder(2))
+}
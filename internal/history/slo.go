@@ -0,0 +1,45 @@
+package history
+
+import (
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// SLOReport represents the compliance of the runs in the history with the service level objectives over a window
+type SLOReport struct {
+	Since time.Time `json:"since"`
+	Runs  int       `json:"runs"`
+	// SLO holds the compliance and error budget burn of the objectives across the runs
+	SLO []report.SLOResult `json:"slo"`
+}
+
+// SLO returns the compliance of the runs with the service level objectives, counting the requests of all runs
+// together. Latency is counted from the runs that reported the latency objective with the configured threshold
+func SLO(runs []Run, slo config.SLOConfig) []report.SLOResult {
+	var total, successful, latencyTotal, latencyGood int64
+	for _, run := range runs {
+		if run.Report == nil {
+			continue
+		}
+		total += int64(run.Report.TotalRequests)
+		successful += int64(run.Report.SuccessfulRequests)
+		for _, result := range run.Report.SLO {
+			if result.Objective == report.SLOLatency && result.ThresholdMS == slo.Latency.ThresholdMS {
+				latencyTotal += result.TotalRequests
+				latencyGood += result.GoodRequests
+			}
+		}
+	}
+
+	var results []report.SLOResult
+	if slo.Availability > 0 {
+		results = append(results, report.NewSLOResult(report.SLOAvailability, slo.Availability, 0, total, successful))
+	}
+	if slo.Latency.Target > 0 {
+		results = append(results, report.NewSLOResult(report.SLOLatency, slo.Latency.Target, slo.Latency.ThresholdMS,
+			latencyTotal, latencyGood))
+	}
+	return results
+}
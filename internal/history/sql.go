@@ -0,0 +1,195 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// dialect holds the differences between the supported databases
+type dialect struct {
+	// placeholder returns the query parameter placeholder for the n-th argument, starting at 1
+	placeholder func(n int) string
+	// upsert is the statement saving a run, replacing an earlier run with the same ID
+	upsert string
+}
+
+var (
+	sqliteDialect = dialect{
+		placeholder: func(int) string { return "?" },
+		upsert: `INSERT OR REPLACE INTO enchante_runs
+			(id, instance, started_at_ns, duration_ms, total_requests, failed_requests, p50_ms, p99_ms, report, config)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	}
+	postgresDialect = dialect{
+		placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+		upsert: `INSERT INTO enchante_runs
+			(id, instance, started_at_ns, duration_ms, total_requests, failed_requests, p50_ms, p99_ms, report, config)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (id) DO UPDATE SET instance = EXCLUDED.instance, started_at_ns = EXCLUDED.started_at_ns,
+				duration_ms = EXCLUDED.duration_ms, total_requests = EXCLUDED.total_requests,
+				failed_requests = EXCLUDED.failed_requests, p50_ms = EXCLUDED.p50_ms, p99_ms = EXCLUDED.p99_ms,
+				report = EXCLUDED.report, config = EXCLUDED.config`,
+	}
+)
+
+// schema creates the runs table, the summary columns allow querying the history without decoding the reports.
+// The start time is stored in nanoseconds since the epoch, as timestamp handling differs between drivers
+const schema = `CREATE TABLE IF NOT EXISTS enchante_runs (
+	id TEXT PRIMARY KEY,
+	instance TEXT NOT NULL,
+	started_at_ns BIGINT NOT NULL,
+	duration_ms DOUBLE PRECISION NOT NULL,
+	total_requests INTEGER NOT NULL,
+	failed_requests INTEGER NOT NULL,
+	p50_ms DOUBLE PRECISION NOT NULL,
+	p99_ms DOUBLE PRECISION NOT NULL,
+	report TEXT NOT NULL,
+	config TEXT NOT NULL DEFAULT ''
+)`
+
+// addConfigColumn adds the config column to a runs table created before runs were grouped by config
+const addConfigColumn = `ALTER TABLE enchante_runs ADD COLUMN config TEXT NOT NULL DEFAULT ''`
+
+// dialectFor returns the dialect of a backend
+func dialectFor(backend string) dialect {
+	if backend == config.HistoryPostgres {
+		return postgresDialect
+	}
+	return sqliteDialect
+}
+
+// SQLStorage stores the runs in a SQLite or Postgres database, so several instances can share their history
+type SQLStorage struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// OpenSQL opens the database of the sqlite or postgres backend with the given database/sql driver and creates the
+// runs table when needed. The driver must be registered by the binary, the enchante binary registers sqlite and pgx
+func OpenSQL(backend, driver, dsn string) (*SQLStorage, error) {
+	if !slices.Contains(sql.Drivers(), driver) {
+		return nil, fmt.Errorf("database driver %q is not included in this build", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening history database: %w", err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating history table: %w", err)
+	}
+	// selecting the column fails on a table without it
+	if _, err := db.Exec("SELECT config FROM enchante_runs WHERE 1 = 0"); err != nil {
+		if _, err := db.Exec(addConfigColumn); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error adding config column to history table: %w", err)
+		}
+	}
+	return &SQLStorage{db: db, dialect: dialectFor(backend)}, nil
+}
+
+// Save inserts the run, replacing an earlier run with the same ID
+func (s *SQLStorage) Save(ctx context.Context, run Run) error {
+	data, err := json.Marshal(run.Report)
+	if err != nil {
+		return fmt.Errorf("error encoding report: %w", err)
+	}
+
+	r := run.Report
+	_, err = s.db.ExecContext(ctx, s.dialect.upsert,
+		run.ID, run.Instance, run.StartedAt.UnixNano(), r.DurationMS, r.TotalRequests, r.FailedRequests,
+		r.Latency.P50MS, r.Latency.P99MS, string(data), run.Config)
+	if err != nil {
+		return fmt.Errorf("error saving run: %w", err)
+	}
+	return nil
+}
+
+// Get reads the run with the given ID
+func (s *SQLStorage) Get(ctx context.Context, id string) (Run, error) {
+	query := "SELECT id, instance, started_at_ns, report, config FROM enchante_runs WHERE id = " + s.dialect.placeholder(1)
+	run, err := scanRun(s.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Run{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return run, err
+}
+
+// List reads the runs selected by the query
+func (s *SQLStorage) List(ctx context.Context, query Query) ([]Run, error) {
+	var conditions []string
+	var args []any
+	if !query.Since.IsZero() {
+		args = append(args, query.Since.UnixNano())
+		conditions = append(conditions, "started_at_ns >= "+s.dialect.placeholder(len(args)))
+	}
+	if query.Instance != "" {
+		args = append(args, query.Instance)
+		conditions = append(conditions, "instance = "+s.dialect.placeholder(len(args)))
+	}
+	if query.Config != "" {
+		args = append(args, query.Config)
+		conditions = append(conditions, "config = "+s.dialect.placeholder(len(args)))
+	}
+
+	statement := "SELECT id, instance, started_at_ns, report, config FROM enchante_runs"
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	statement += " ORDER BY started_at_ns DESC"
+	if query.Limit > 0 {
+		args = append(args, query.Limit)
+		statement += " LIMIT " + s.dialect.placeholder(len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing runs: %w", err)
+	}
+	return runs, nil
+}
+
+// Close closes the database
+func (s *SQLStorage) Close() error {
+	return s.db.Close()
+}
+
+// scanRun decodes a run from a row of id, instance, started_at_ns, report and config
+func scanRun(row interface{ Scan(dest ...any) error }) (Run, error) {
+	var run Run
+	var startedAt int64
+	var data string
+	if err := row.Scan(&run.ID, &run.Instance, &startedAt, &data, &run.Config); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Run{}, err
+		}
+		return Run{}, fmt.Errorf("error reading run: %w", err)
+	}
+	run.StartedAt = time.Unix(0, startedAt)
+	if err := json.Unmarshal([]byte(data), &run.Report); err != nil {
+		return Run{}, fmt.Errorf("error parsing report of run %s: %w", run.ID, err)
+	}
+	return run, nil
+}
@@ -0,0 +1,79 @@
+package history
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// Entry represents a run in the listing of the history, with the change of its latency to the previous run of the
+// same config
+type Entry struct {
+	ID             string    `json:"id"`
+	Config         string    `json:"config,omitempty"`
+	Instance       string    `json:"instance"`
+	StartedAt      time.Time `json:"started_at"`
+	DurationMS     float64   `json:"duration_ms"`
+	TotalRequests  int       `json:"total_requests"`
+	FailedRequests int       `json:"failed_requests"`
+	ErrorRate      float64   `json:"error_rate"`
+	P50MS          float64   `json:"p50_ms"`
+	P99MS          float64   `json:"p99_ms"`
+	// P99ChangePct is the change of the p99 latency to the previous run of the config in percent, nil for its first run
+	P99ChangePct *float64 `json:"p99_change_pct,omitempty"`
+}
+
+// Entries returns the entries of the runs, listed the most recent first. The change of a run is computed against the
+// next older run of its config in the list
+func Entries(runs []Run) []Entry {
+	entries := make([]Entry, len(runs))
+	// the runs are walked from the oldest, remembering the latest p99 per config
+	previous := make(map[string]float64)
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		r := run.Report
+		if r == nil {
+			r = &report.Report{}
+		}
+		entry := Entry{
+			ID:             run.ID,
+			Config:         run.Config,
+			Instance:       run.Instance,
+			StartedAt:      run.StartedAt,
+			DurationMS:     r.DurationMS,
+			TotalRequests:  r.TotalRequests,
+			FailedRequests: r.FailedRequests,
+			P50MS:          r.Latency.P50MS,
+			P99MS:          r.Latency.P99MS,
+		}
+		if r.TotalRequests > 0 {
+			entry.ErrorRate = float64(r.FailedRequests) / float64(r.TotalRequests)
+		}
+		if p99, ok := previous[run.Config]; ok && p99 > 0 {
+			change := report.Change(p99, entry.P99MS)
+			entry.P99ChangePct = &change
+		}
+		previous[run.Config] = entry.P99MS
+		entries[i] = entry
+	}
+	return entries
+}
+
+// WriteText writes the entries as a plain text table
+func WriteText(w io.Writer, entries []Entry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN ID\tSTARTED\tCONFIG\tINSTANCE\tREQUESTS\tERROR RATE\tP50 (ms)\tP99 (ms)\tP99 TREND")
+	for _, e := range entries {
+		trend := "-"
+		if e.P99ChangePct != nil {
+			trend = fmt.Sprintf("%+.1f%%", *e.P99ChangePct)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%.2f%%\t%.2f\t%.2f\t%s\n",
+			e.ID, e.StartedAt.Local().Format(time.DateTime), e.Config, e.Instance, e.TotalRequests, e.ErrorRate*100,
+			e.P50MS, e.P99MS, trend)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,492 @@
+package importer
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// curlValueFlags are the curl options taking a value that are not imported, their value is skipped
+var curlValueFlags = map[string]bool{
+	"-o": true, "--output": true, "-w": true, "--write-out": true, "-c": true, "--cookie-jar": true,
+	"--connect-timeout": true, "--retry": true, "--retry-delay": true, "--retry-max-time": true, "-r": true,
+	"--range": true, "--cacert": true, "--capath": true, "-E": true, "--cert": true, "--key": true, "--resolve": true,
+	"--connect-to": true, "-K": true, "--config": true, "--limit-rate": true, "-U": true, "--proxy-user": true,
+	"--interface": true, "--max-redirs": true, "-D": true, "--dump-header": true, "--trace": true,
+	"--trace-ascii": true, "--unix-socket": true,
+}
+
+// curlShortValueFlags are the short curl options taking a value that can be attached, e.g. -XPOST
+const curlShortValueFlags = "XHdFuAebmxowcrEKUD"
+
+// curlCommand holds the options of a curl command while it is parsed
+type curlCommand struct {
+	endpoint config.Endpoint
+	method   string
+	data     []string
+	dataFile string
+	get      bool
+	head     bool
+}
+
+// Curl returns the endpoints of curl commands, e.g. copied from the developer tools of a browser. Several commands
+// are separated by newlines or semicolons. Credentials, from -u, -b and the Authorization and Cookie headers, are not
+// imported
+func Curl(command string, logger *slog.Logger) ([]config.Endpoint, error) {
+	commands, err := splitShell(command)
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []config.Endpoint
+	skippedCredentials := make(map[string]bool)
+	skipCredential := func(name string) {
+		if !skippedCredentials[name] {
+			skippedCredentials[name] = true
+			logger.Info("Credential header not imported, configure auth for the endpoints instead", "header", name)
+		}
+	}
+	for n, args := range commands {
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] != "curl" {
+			return nil, fmt.Errorf("command %d: expected a curl command, got %q", n+1, args[0])
+		}
+		endpoint, err := parseCurl(args[1:], skipCredential, logger)
+		if err != nil {
+			return nil, fmt.Errorf("command %d: %w", n+1, err)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, nil
+}
+
+// parseCurl returns the endpoint of the arguments of a curl command
+func parseCurl(args []string, skipCredential func(string), logger *slog.Logger) (config.Endpoint, error) {
+	cmd := &curlCommand{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if cmd.endpoint.URL != "" {
+				return config.Endpoint{}, fmt.Errorf("more than one URL: %s and %s", cmd.endpoint.URL, arg)
+			}
+			cmd.endpoint.URL = arg
+			continue
+		}
+
+		name, value, attached := arg, "", false
+		switch {
+		case strings.HasPrefix(arg, "--"):
+			name, value, attached = strings.Cut(arg, "=")
+		case len(arg) > 2 && strings.ContainsRune(curlShortValueFlags, rune(arg[1])):
+			name, value, attached = arg[:2], arg[2:], true
+		case len(arg) > 2:
+			// combined boolean flags like -sSL, a head request is the only one changing the request
+			if strings.Contains(arg, "I") {
+				cmd.head = true
+			}
+			if strings.Contains(arg, "G") {
+				cmd.get = true
+			}
+			continue
+		}
+		needsValue := (len(name) == 2 && strings.ContainsRune(curlShortValueFlags, rune(name[1]))) || curlLongValueFlag(name)
+		if needsValue && !attached {
+			if i+1 >= len(args) {
+				return config.Endpoint{}, fmt.Errorf("option %s requires a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		if err := cmd.apply(name, value, skipCredential, logger); err != nil {
+			return config.Endpoint{}, err
+		}
+	}
+	return cmd.finish()
+}
+
+// curlLongValueFlag reports whether a long curl option takes a value
+func curlLongValueFlag(name string) bool {
+	switch name {
+	case "--request", "--header", "--data", "--data-raw", "--data-ascii", "--data-binary", "--data-urlencode",
+		"--json", "--form", "--form-string", "--user", "--user-agent", "--referer", "--cookie", "--url", "--max-time",
+		"--proxy":
+		return true
+	}
+	return curlValueFlags[name]
+}
+
+// apply applies an option of the curl command
+func (c *curlCommand) apply(name, value string, skipCredential func(string), logger *slog.Logger) error {
+	endpoint := &c.endpoint
+	switch name {
+	case "-X", "--request":
+		c.method = strings.ToUpper(value)
+	case "-H", "--header":
+		header, headerValue, ok := strings.Cut(value, ":")
+		if !ok {
+			// "Name;" sends an empty header, "Name" without a colon is invalid
+			header, ok = strings.CutSuffix(value, ";")
+			if !ok {
+				return fmt.Errorf("invalid header %q", value)
+			}
+		} else if headerValue = strings.TrimSpace(headerValue); headerValue == "" {
+			// "Name:" removes a header curl sets itself
+			return nil
+		}
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+		switch {
+		case credentialHeaders[header]:
+			skipCredential(header)
+		case skippedHeaders[header]:
+		default:
+			setHeader(endpoint, header, headerValue)
+		}
+	case "-d", "--data", "--data-ascii", "--data-binary":
+		if file, ok := strings.CutPrefix(value, "@"); ok {
+			c.dataFile = file
+			return nil
+		}
+		c.data = append(c.data, value)
+	case "--data-raw":
+		c.data = append(c.data, value)
+	case "--data-urlencode":
+		if key, content, ok := strings.Cut(value, "="); ok {
+			c.data = append(c.data, key+"="+url.QueryEscape(content))
+		} else {
+			c.data = append(c.data, url.QueryEscape(value))
+		}
+	case "--json":
+		c.data = append(c.data, value)
+		setHeader(endpoint, "Content-Type", "application/json")
+		setHeader(endpoint, "Accept", "application/json")
+	case "-F", "--form", "--form-string":
+		field, content, ok := strings.Cut(value, "=")
+		if !ok {
+			return fmt.Errorf("invalid form field %q", value)
+		}
+		if endpoint.Multipart == nil {
+			endpoint.Multipart = &config.Multipart{}
+		}
+		if file, isFile := strings.CutPrefix(content, "@"); isFile && name != "--form-string" {
+			// ;type= and ;filename= follow the path
+			file, options, _ := strings.Cut(file, ";")
+			upload := config.MultipartFile{Field: field, Path: file}
+			for _, option := range strings.Split(options, ";") {
+				if key, optionValue, ok := strings.Cut(option, "="); ok {
+					switch key {
+					case "type":
+						upload.ContentType = optionValue
+					case "filename":
+						upload.Filename = optionValue
+					}
+				}
+			}
+			endpoint.Multipart.Files = append(endpoint.Multipart.Files, upload)
+		} else {
+			if endpoint.Multipart.Fields == nil {
+				endpoint.Multipart.Fields = make(map[string]string)
+			}
+			endpoint.Multipart.Fields[field] = content
+		}
+	case "-u", "--user":
+		skipCredential("Authorization")
+	case "-b", "--cookie":
+		// a value without = is a file to read the cookies from
+		if strings.Contains(value, "=") {
+			skipCredential("Cookie")
+		}
+	case "-e", "--referer":
+		setHeader(endpoint, "Referer", value)
+	case "--url":
+		endpoint.URL = value
+	case "-I", "--head":
+		c.head = true
+	case "-G", "--get":
+		c.get = true
+	case "-m", "--max-time":
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid max time %q", value)
+		}
+		endpoint.TimeoutMS = int(seconds * 1000)
+	case "-x", "--proxy":
+		endpoint.Proxy = &config.ProxyConfig{Enabled: true, URL: value}
+	default:
+		logger.Debug("Curl option not imported", "option", name)
+	}
+	return nil
+}
+
+// finish returns the endpoint with its method and body
+func (c *curlCommand) finish() (config.Endpoint, error) {
+	endpoint := c.endpoint
+	if endpoint.URL == "" {
+		return config.Endpoint{}, fmt.Errorf("no URL")
+	}
+	if !strings.Contains(endpoint.URL, "://") {
+		// curl defaults to http for URLs without a scheme
+		endpoint.URL = "http://" + endpoint.URL
+	}
+	data := strings.Join(c.data, "&")
+	hasData := len(c.data) > 0 || c.dataFile != ""
+
+	switch {
+	case c.get && data != "":
+		separator := "?"
+		if strings.Contains(endpoint.URL, "?") {
+			separator = "&"
+		}
+		endpoint.URL += separator + data
+	case c.dataFile != "":
+		if len(c.data) > 0 {
+			return config.Endpoint{}, fmt.Errorf("data from a file can not be combined with other data")
+		}
+		endpoint.BodyFile = c.dataFile
+	default:
+		endpoint.Body = data
+	}
+	if hasData && !c.get && endpoint.Multipart != nil {
+		return config.Endpoint{}, fmt.Errorf("data can not be combined with form fields")
+	}
+	if hasData && !c.get && !hasHeader(endpoint.Headers, "Content-Type") {
+		// curl sends data as a form unless a content type is set
+		setHeader(&endpoint, "Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	switch {
+	case c.method != "":
+		endpoint.Method = c.method
+	case c.head:
+		endpoint.Method = http.MethodHead
+	case (hasData && !c.get) || endpoint.Multipart != nil:
+		endpoint.Method = http.MethodPost
+	default:
+		endpoint.Method = http.MethodGet
+	}
+	return endpoint, nil
+}
+
+// CurlCommand returns a curl command sending the request of the endpoint with the headers, e.g. the headers of the
+// endpoint with its auth header, to debug a configured request outside the probe. Generated bodies and request
+// compression are not included
+func CurlCommand(endpoint config.Endpoint, headers map[string]string) string {
+	args := []string{"curl"}
+	if endpoint.Method != http.MethodGet || endpoint.HasBody() {
+		args = append(args, "-X", shellQuote(endpoint.Method))
+	}
+	for _, name := range slices.Sorted(maps.Keys(headers)) {
+		args = append(args, "-H", shellQuote(name+": "+headers[name]))
+	}
+	if endpoint.ContentEncoding != "" && !hasHeader(headers, "Content-Encoding") {
+		args = append(args, "-H", shellQuote("Content-Encoding: "+endpoint.ContentEncoding))
+	}
+
+	prefix := ""
+	switch {
+	case endpoint.Body != "":
+		args = append(args, "--data-raw", shellQuote(endpoint.Body))
+	case endpoint.BodyFile != "":
+		args = append(args, "--data-binary", shellQuote("@"+endpoint.BodyFile))
+	case endpoint.BodyBase64 != "":
+		// the binary body is piped in, so the command can be copied into a terminal
+		prefix = "echo " + shellQuote(endpoint.BodyBase64) + " | base64 -d | "
+		args = append(args, "--data-binary", "@-")
+	case endpoint.Multipart != nil:
+		for _, name := range slices.Sorted(maps.Keys(endpoint.Multipart.Fields)) {
+			args = append(args, "--form-string", shellQuote(name+"="+endpoint.Multipart.Fields[name]))
+		}
+		for _, file := range endpoint.Multipart.Files {
+			form := file.Field + "=@" + file.Path
+			if file.Filename != "" {
+				form += ";filename=" + file.Filename
+			}
+			if file.ContentType != "" {
+				form += ";type=" + file.ContentType
+			}
+			args = append(args, "-F", shellQuote(form))
+		}
+	}
+
+	if endpoint.TimeoutMS > 0 {
+		args = append(args, "--max-time", strconv.FormatFloat(float64(endpoint.TimeoutMS)/1000, 'f', -1, 64))
+	}
+	if endpoint.Proxy != nil && endpoint.Proxy.Enabled {
+		if proxyURL, err := endpoint.Proxy.ProxyURL(); err == nil && proxyURL != nil {
+			args = append(args, "--proxy", shellQuote(proxyURL.String()))
+		}
+	}
+	args = append(args, shellQuote(endpoint.RequestURL()))
+	return prefix + strings.Join(args, " ")
+}
+
+// ShellJoin joins words into a shell command, quoting them where needed
+func ShellJoin(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = shellQuote(word)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes a word for POSIX shells, words of only safe characters are kept as they are
+func shellQuote(word string) string {
+	if word != "" && strings.Trim(word, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:@%+=,") == "" {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// splitShell splits shell commands into their words, handling quotes, $'...' strings, escapes and line
+// continuations. Commands are separated by unquoted newlines, semicolons and &&
+func splitShell(input string) ([][]string, error) {
+	var (
+		commands [][]string
+		words    []string
+		word     strings.Builder
+		inWord   bool
+	)
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endCommand := func() {
+		endWord()
+		if len(words) > 0 {
+			commands = append(commands, words)
+			words = nil
+		}
+	}
+
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case c == '\\':
+			i++
+			if i >= len(input) {
+				return nil, fmt.Errorf("unexpected end after \\")
+			}
+			if input[i] == '\r' && i+1 < len(input) && input[i+1] == '\n' {
+				i++
+			}
+			if input[i] != '\n' {
+				word.WriteByte(input[i])
+				inWord = true
+			}
+		case c == '\'':
+			end := strings.IndexByte(input[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated ' quote")
+			}
+			word.WriteString(input[i+1 : i+1+end])
+			inWord = true
+			i += end + 1
+		case c == '$' && i+1 < len(input) && input[i+1] == '\'':
+			n, err := ansiCString(input[i+2:], &word)
+			if err != nil {
+				return nil, err
+			}
+			inWord = true
+			i += n + 2
+		case c == '"':
+			closed := false
+			for i++; i < len(input); i++ {
+				if input[i] == '"' {
+					closed = true
+					break
+				}
+				// a backslash only escapes the characters special within double quotes
+				if input[i] == '\\' && i+1 < len(input) && strings.IndexByte("\"\\$`\n", input[i+1]) >= 0 {
+					i++
+					if input[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(input[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated \" quote")
+			}
+			inWord = true
+		case c == '\n' || c == ';':
+			endCommand()
+		case c == '&' && i+1 < len(input) && input[i+1] == '&':
+			endCommand()
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			endWord()
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	endCommand()
+	return commands, nil
+}
+
+// ansiCString writes the content of a $'...' string up to its closing quote and returns the number of bytes read,
+// including the quote
+func ansiCString(input string, word *strings.Builder) (int, error) {
+	for i := 0; i < len(input); i++ {
+		switch c := input[i]; c {
+		case '\'':
+			return i + 1, nil
+		case '\\':
+			i++
+			if i >= len(input) {
+				return 0, fmt.Errorf("unterminated $' quote")
+			}
+			switch e := input[i]; e {
+			case 'n':
+				word.WriteByte('\n')
+			case 't':
+				word.WriteByte('\t')
+			case 'r':
+				word.WriteByte('\r')
+			case 'x', 'u', 'U':
+				digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+				end := i + 1
+				for end < len(input) && end-i-1 < digits && strings.IndexByte("0123456789abcdefABCDEF", input[end]) >= 0 {
+					end++
+				}
+				code, err := strconv.ParseUint(input[i+1:end], 16, 32)
+				if err != nil {
+					return 0, fmt.Errorf("invalid escape \\%c in $' quote", e)
+				}
+				if e == 'x' {
+					word.WriteByte(byte(code))
+				} else {
+					word.WriteString(string(rune(code)))
+				}
+				i = end - 1
+			default:
+				// \\, \', \" and unknown escapes keep the escaped character
+				word.WriteByte(e)
+			}
+		default:
+			word.WriteByte(c)
+		}
+	}
+	return 0, fmt.Errorf("unterminated $' quote")
+}
+
+// hasHeader reports whether the header is set under any casing
+func hasHeader(headers map[string]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
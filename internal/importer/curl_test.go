@@ -0,0 +1,167 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurl(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		expect  config.Endpoint
+	}{
+		{
+			name:    "Get",
+			command: "curl https://api.example.com/items",
+			expect:  config.Endpoint{URL: "https://api.example.com/items", Method: "GET"},
+		},
+		{
+			name: "Copied From Browser",
+			command: `curl 'https://api.example.com/orders' \
+  -H 'accept: application/json' \
+  -H 'authorization: Bearer secret' \
+  -H 'user-agent: Mozilla/5.0' \
+  -b 'session=abc' \
+  --data-raw $'{"note":"it\'s\\nurgent"}' \
+  --compressed`,
+			expect: config.Endpoint{
+				URL: "https://api.example.com/orders", Method: "POST", Body: "{\"note\":\"it's\\nurgent\"}",
+				Headers: map[string]string{"Accept": "application/json", "Content-Type": "application/x-www-form-urlencoded"},
+			},
+		},
+		{
+			name:    "Method And JSON",
+			command: `curl -sS -XPUT --json "{\"id\": 1}" --max-time 1.5 localhost:8080/items/1`,
+			expect: config.Endpoint{
+				URL: "http://localhost:8080/items/1", Method: "PUT", Body: `{"id": 1}`, TimeoutMS: 1500,
+				Headers: map[string]string{"Accept": "application/json", "Content-Type": "application/json"},
+			},
+		},
+		{
+			name:    "Get With Data",
+			command: "curl -G -d page=2 --data-urlencode 'q=shoes & socks' https://api.example.com/search?sort=asc",
+			expect:  config.Endpoint{URL: "https://api.example.com/search?sort=asc&page=2&q=shoes+%26+socks", Method: "GET"},
+		},
+		{
+			name:    "Data File",
+			command: "curl --data-binary @payload.bin -H 'Content-Type: application/octet-stream' https://api.example.com/upload",
+			expect: config.Endpoint{
+				URL: "https://api.example.com/upload", Method: "POST", BodyFile: "payload.bin",
+				Headers: map[string]string{"Content-Type": "application/octet-stream"},
+			},
+		},
+		{
+			name:    "Form",
+			command: "curl -F name=report -F 'file=@report.pdf;type=application/pdf' https://api.example.com/files",
+			expect: config.Endpoint{
+				URL: "https://api.example.com/files", Method: "POST",
+				Multipart: &config.Multipart{
+					Fields: map[string]string{"name": "report"},
+					Files:  []config.MultipartFile{{Field: "file", Path: "report.pdf", ContentType: "application/pdf"}},
+				},
+			},
+		},
+		{
+			name:    "Head",
+			command: "curl -sI --proxy http://proxy:3128 https://api.example.com/health",
+			expect: config.Endpoint{
+				URL: "https://api.example.com/health", Method: "HEAD",
+				Proxy: &config.ProxyConfig{Enabled: true, URL: "http://proxy:3128"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoints, err := Curl(tc.command, testutil.Logger)
+			assert.NoError(t, err)
+			assert.Equal(t, []config.Endpoint{tc.expect}, endpoints)
+		})
+	}
+}
+
+func TestCurlCommands(t *testing.T) {
+	endpoints, err := Curl("curl https://a.example.com\ncurl -X DELETE https://b.example.com; curl https://c.example.com && curl -I https://d.example.com", testutil.Logger)
+	assert.NoError(t, err)
+	var methods []string
+	for _, endpoint := range endpoints {
+		methods = append(methods, endpoint.Method+" "+endpoint.URL)
+	}
+	assert.Equal(t, []string{"GET https://a.example.com", "DELETE https://b.example.com", "GET https://c.example.com", "HEAD https://d.example.com"}, methods)
+}
+
+func TestCurlErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		command   string
+		expectErr string
+	}{
+		{name: "Not Curl", command: "wget https://api.example.com", expectErr: `command 1: expected a curl command, got "wget"`},
+		{name: "No URL", command: "curl -X POST", expectErr: "command 1: no URL"},
+		{name: "Missing Value", command: "curl https://api.example.com -H", expectErr: "option -H requires a value"},
+		{name: "Unterminated Quote", command: "curl 'https://api.example.com", expectErr: "unterminated ' quote"},
+		{name: "Two URLs", command: "curl https://a.example.com https://b.example.com", expectErr: "more than one URL"},
+		{name: "Invalid Header", command: "curl -H Accept https://api.example.com", expectErr: `invalid header "Accept"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Curl(tc.command, testutil.Logger)
+			assert.ErrorContains(t, err, tc.expectErr)
+		})
+	}
+}
+
+func TestCurlCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint config.Endpoint
+		headers  map[string]string
+		expect   string
+	}{
+		{
+			name:     "Get",
+			endpoint: config.Endpoint{URL: "https://api.example.com/items", Method: "GET", QueryParams: map[string]string{"q": "a b"}},
+			expect:   "curl 'https://api.example.com/items?q=a+b'",
+		},
+		{
+			name:     "Body And Headers",
+			endpoint: config.Endpoint{URL: "https://api.example.com/notes", Method: "POST", Body: `{"text":"it's"}`, TimeoutMS: 1500},
+			headers:  map[string]string{"Content-Type": "application/json", "Authorization": "Bearer abc"},
+			expect:   `curl -X POST -H 'Authorization: Bearer abc' -H 'Content-Type: application/json' --data-raw '{"text":"it'\''s"}' --max-time 1.5 https://api.example.com/notes`,
+		},
+		{
+			name:     "Binary Body",
+			endpoint: config.Endpoint{URL: "https://api.example.com/blob", Method: "PUT", BodyBase64: "H4sI", ContentEncoding: "gzip"},
+			expect:   "echo H4sI | base64 -d | curl -X PUT -H 'Content-Encoding: gzip' --data-binary @- https://api.example.com/blob",
+		},
+		{
+			name: "Multipart",
+			endpoint: config.Endpoint{URL: "https://api.example.com/files", Method: "POST", Multipart: &config.Multipart{
+				Fields: map[string]string{"name": "report"},
+				Files:  []config.MultipartFile{{Field: "file", Path: "report.pdf", ContentType: "application/pdf"}},
+			}},
+			expect: "curl -X POST --form-string name=report -F 'file=@report.pdf;type=application/pdf' https://api.example.com/files",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			command := CurlCommand(tc.endpoint, tc.headers)
+			assert.Equal(t, tc.expect, command)
+
+			// the command is imported back into the same request
+			if tc.endpoint.BodyBase64 == "" {
+				endpoints, err := Curl(command, testutil.Logger)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.endpoint.Method, endpoints[0].Method)
+				assert.Equal(t, tc.endpoint.RequestURL(), endpoints[0].URL)
+				assert.Equal(t, tc.endpoint.Body, endpoints[0].Body)
+			}
+		})
+	}
+}
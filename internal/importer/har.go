@@ -0,0 +1,174 @@
+// Package importer converts recorded or documented traffic, like browser sessions, into the endpoints of a config
+package importer
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// skippedHeaders are not imported, the HTTP client of the probe sets them itself
+var skippedHeaders = map[string]bool{
+	"Accept-Encoding":   true,
+	"Connection":        true,
+	"Content-Length":    true,
+	"Host":              true,
+	"Keep-Alive":        true,
+	"Proxy-Connection":  true,
+	"Te":                true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	"User-Agent":        true,
+}
+
+// credentialHeaders are not imported to keep secrets out of the config, auth is configured separately
+var credentialHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+}
+
+// staticExtensions are the file extensions of static assets, which are skipped unless requested
+var staticExtensions = []string{
+	".css", ".js", ".mjs", ".map", ".png", ".jpg", ".jpeg", ".gif", ".svg", ".ico", ".webp", ".avif",
+	".woff", ".woff2", ".ttf", ".otf", ".eot", ".mp4", ".webm", ".mp3",
+}
+
+// HAROptions selects the entries of a HAR file that are imported
+type HAROptions struct {
+	// Hosts only imports the requests to these hosts, all hosts when empty
+	Hosts []string
+	// Static also imports the requests of static assets like scripts, stylesheets, images and fonts
+	Static bool
+}
+
+// har is the part of a HAR file the import reads
+type har struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	Request struct {
+		Method   string       `json:"method"`
+		URL      string       `json:"url"`
+		Headers  []harNameVal `json:"headers"`
+		PostData *struct {
+			MimeType string       `json:"mimeType"`
+			Text     string       `json:"text"`
+			Params   []harNameVal `json:"params"`
+			// Encoding is base64 for binary bodies, written by some tools although not part of the HAR spec
+			Encoding string `json:"encoding"`
+		} `json:"postData"`
+	} `json:"request"`
+	Response struct {
+		Content struct {
+			MimeType string `json:"mimeType"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+type harNameVal struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HAR returns the endpoints of the requests of a HAR file, e.g. a session recorded by the developer tools of a
+// browser, in the order they were made. Requests with the same method, URL and body are imported once
+func HAR(r io.Reader, opts HAROptions, logger *slog.Logger) ([]config.Endpoint, error) {
+	var file har
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("error decoding HAR file: %w", err)
+	}
+
+	var endpoints []config.Endpoint
+	seen := make(map[string]bool)
+	skippedCredentials := make(map[string]bool)
+	for _, entry := range file.Log.Entries {
+		req := entry.Request
+		u, err := url.Parse(req.URL)
+		if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+			logger.Debug("Entry skipped, not an HTTP request", "url", req.URL)
+			continue
+		}
+		if len(opts.Hosts) > 0 && !slices.Contains(opts.Hosts, u.Hostname()) {
+			continue
+		}
+		if !opts.Static && isStatic(u, entry.Response.Content.MimeType) {
+			logger.Debug("Static asset skipped", "url", req.URL)
+			continue
+		}
+		// the fragment is never sent
+		u.Fragment = ""
+
+		endpoint := config.Endpoint{URL: u.String(), Method: cmp.Or(req.Method, http.MethodGet)}
+		if data := req.PostData; data != nil {
+			switch {
+			case data.Encoding == "base64":
+				endpoint.BodyBase64 = data.Text
+			case data.Text != "":
+				endpoint.Body = data.Text
+			case len(data.Params) > 0:
+				form := url.Values{}
+				for _, param := range data.Params {
+					form.Add(param.Name, param.Value)
+				}
+				endpoint.Body = form.Encode()
+			}
+		}
+
+		for _, header := range req.Headers {
+			// HTTP/2 pseudo headers like :authority are part of the URL
+			if strings.HasPrefix(header.Name, ":") {
+				continue
+			}
+			name := http.CanonicalHeaderKey(header.Name)
+			if skippedHeaders[name] {
+				continue
+			}
+			if credentialHeaders[name] {
+				if !skippedCredentials[name] {
+					skippedCredentials[name] = true
+					logger.Info("Credential header not imported, configure auth for the endpoints instead", "header", name)
+				}
+				continue
+			}
+			if endpoint.Headers == nil {
+				endpoint.Headers = make(map[string]string)
+			}
+			if _, ok := endpoint.Headers[name]; !ok {
+				endpoint.Headers[name] = header.Value
+			}
+		}
+
+		key := endpoint.Method + " " + endpoint.URL + " " + endpoint.Body + endpoint.BodyBase64
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, nil
+}
+
+// isStatic reports whether the request is for a static asset, by the type of its response or its file extension
+func isStatic(u *url.URL, mimeType string) bool {
+	mediaType, _, _ := strings.Cut(mimeType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	switch {
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "font/"),
+		strings.HasPrefix(mediaType, "video/"), strings.HasPrefix(mediaType, "audio/"),
+		mediaType == "text/css", mediaType == "text/javascript", mediaType == "application/javascript":
+		return true
+	}
+	return slices.Contains(staticExtensions, strings.ToLower(path.Ext(u.Path)))
+}
@@ -0,0 +1,101 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const session = `{"log": {"version": "1.2", "entries": [
+  {"request": {"method": "GET", "url": "https://shop.example.com/api/products?page=1#top", "headers": [
+    {"name": ":authority", "value": "shop.example.com"},
+    {"name": "accept", "value": "application/json"},
+    {"name": "accept-encoding", "value": "gzip"},
+    {"name": "cookie", "value": "session=secret"},
+    {"name": "user-agent", "value": "Mozilla/5.0"}
+  ]}, "response": {"content": {"mimeType": "application/json"}}},
+  {"request": {"method": "GET", "url": "https://shop.example.com/static/app.js", "headers": []},
+   "response": {"content": {"mimeType": "application/javascript"}}},
+  {"request": {"method": "GET", "url": "https://cdn.example.com/logo", "headers": []},
+   "response": {"content": {"mimeType": "image/png"}}},
+  {"request": {"method": "POST", "url": "https://shop.example.com/api/cart", "headers": [
+    {"name": "Content-Type", "value": "application/json"},
+    {"name": "Authorization", "value": "Bearer secret"}
+  ], "postData": {"mimeType": "application/json", "text": "{\"sku\":\"A1\"}"}},
+   "response": {"content": {"mimeType": "application/json"}}},
+  {"request": {"method": "POST", "url": "https://shop.example.com/login", "headers": [],
+   "postData": {"mimeType": "application/x-www-form-urlencoded", "params": [
+     {"name": "user", "value": "ann"}, {"name": "next", "value": "/a b"}
+   ]}}, "response": {"content": {"mimeType": "text/html"}}},
+  {"request": {"method": "GET", "url": "https://shop.example.com/api/products?page=1", "headers": []},
+   "response": {"content": {"mimeType": "application/json"}}},
+  {"request": {"method": "GET", "url": "https://analytics.example.com/collect", "headers": []},
+   "response": {"content": {"mimeType": "text/plain"}}},
+  {"request": {"method": "GET", "url": "data:image/png;base64,AAAA", "headers": []},
+   "response": {"content": {"mimeType": "image/png"}}}
+]}}`
+
+func TestHAR(t *testing.T) {
+	endpoints, err := HAR(strings.NewReader(session), HAROptions{}, testutil.Logger)
+	assert.NoError(t, err)
+	assert.Equal(t, []config.Endpoint{
+		{URL: "https://shop.example.com/api/products?page=1", Method: "GET", Headers: map[string]string{"Accept": "application/json"}},
+		{URL: "https://shop.example.com/api/cart", Method: "POST", Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"sku":"A1"}`},
+		{URL: "https://shop.example.com/login", Method: "POST", Body: "next=%2Fa+b&user=ann"},
+		{URL: "https://analytics.example.com/collect", Method: "GET"},
+	}, endpoints, "Expected static assets, credentials, duplicates and non HTTP entries to be skipped")
+}
+
+func TestHAROptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   HAROptions
+		expect []string
+	}{
+		{
+			name:   "Hosts",
+			opts:   HAROptions{Hosts: []string{"analytics.example.com"}},
+			expect: []string{"https://analytics.example.com/collect"},
+		},
+		{
+			name: "Static",
+			opts: HAROptions{Hosts: []string{"shop.example.com", "cdn.example.com"}, Static: true},
+			expect: []string{
+				"https://shop.example.com/api/products?page=1",
+				"https://shop.example.com/static/app.js",
+				"https://cdn.example.com/logo",
+				"https://shop.example.com/api/cart",
+				"https://shop.example.com/login",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoints, err := HAR(strings.NewReader(session), tc.opts, testutil.Logger)
+			assert.NoError(t, err)
+			var urls []string
+			for _, endpoint := range endpoints {
+				urls = append(urls, endpoint.URL)
+			}
+			assert.Equal(t, tc.expect, urls)
+		})
+	}
+}
+
+func TestHARBinaryBody(t *testing.T) {
+	har := `{"log": {"entries": [
+	  {"request": {"method": "PUT", "url": "http://localhost/blob", "postData": {"text": "AAEC", "encoding": "base64"}}}
+	]}}`
+	endpoints, err := HAR(strings.NewReader(har), HAROptions{}, testutil.Logger)
+	assert.NoError(t, err)
+	assert.Equal(t, []config.Endpoint{{URL: "http://localhost/blob", Method: "PUT", BodyBase64: "AAEC"}}, endpoints)
+}
+
+func TestHARInvalid(t *testing.T) {
+	_, err := HAR(strings.NewReader("<html>"), HAROptions{}, testutil.Logger)
+	assert.ErrorContains(t, err, "error decoding HAR file")
+}
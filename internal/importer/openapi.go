@@ -0,0 +1,501 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/goccy/go-yaml"
+)
+
+// maxSchemaDepth limits the nesting of generated example bodies, e.g. of recursive schemas
+const maxSchemaDepth = 8
+
+// operationMethods are the operations of a path item in the order they are imported
+var operationMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// pathParam matches the parameters of a path template, e.g. {petId}
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// nonAlphanumeric matches the characters replaced in environment variable names
+var nonAlphanumeric = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// OpenAPIOptions selects the operations of an OpenAPI spec that are imported and where they are sent
+type OpenAPIOptions struct {
+	// BaseURL replaces the server URL of the spec, required when the spec has no absolute server URL
+	BaseURL string
+	// Tags only imports the operations with one of these tags, all operations when empty
+	Tags []string
+}
+
+// openAPI is an OpenAPI 3 or Swagger 2 document, kept generic so references can be resolved anywhere in it
+type openAPI struct {
+	doc     map[string]any
+	swagger bool
+	logger  *slog.Logger
+}
+
+// OpenAPI returns an endpoint for every operation of an OpenAPI 3 or Swagger 2 spec in YAML or JSON. Path
+// parameters and bodies are filled with the examples of the spec, generated from their schemas when there are none,
+// and security schemes are mapped to auth configs with their credentials referenced from environment variables
+func OpenAPI(data []byte, opts OpenAPIOptions, logger *slog.Logger) ([]config.Endpoint, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error decoding OpenAPI spec: %w", err)
+	}
+	spec := &openAPI{doc: doc, logger: logger}
+	switch {
+	case strings.HasPrefix(str(doc["openapi"]), "3."):
+	case strings.HasPrefix(str(doc["swagger"]), "2"):
+		spec.swagger = true
+	default:
+		return nil, fmt.Errorf("unsupported spec, expected openapi 3.x or swagger 2.0")
+	}
+
+	baseURL := strings.TrimSuffix(opts.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = spec.serverURL()
+	}
+	if u, err := url.Parse(baseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("spec has no absolute server URL %q, set the base URL", baseURL)
+	}
+
+	paths := object(doc["paths"])
+	var endpoints []config.Endpoint
+	envVars := make(map[string]bool)
+	for _, path := range slices.Sorted(maps.Keys(paths)) {
+		item := spec.resolve(paths[path])
+		for _, method := range operationMethods {
+			op, ok := item[method].(map[string]any)
+			if !ok {
+				continue
+			}
+			if len(opts.Tags) > 0 && !slices.ContainsFunc(list(op["tags"]), func(tag any) bool {
+				return slices.Contains(opts.Tags, str(tag))
+			}) {
+				continue
+			}
+			endpoint := spec.endpoint(baseURL, path, strings.ToUpper(method), item, op)
+			for _, name := range spec.applySecurity(&endpoint, op) {
+				envVars[name] = true
+			}
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if len(envVars) > 0 {
+		logger.Info("Imported auth references environment variables, set them before running the config",
+			"variables", strings.Join(slices.Sorted(maps.Keys(envVars)), ","))
+	}
+	return endpoints, nil
+}
+
+// serverURL returns the URL of the first server with its variables set to their defaults
+func (s *openAPI) serverURL() string {
+	if s.swagger {
+		host := str(s.doc["host"])
+		if host == "" {
+			return ""
+		}
+		scheme := "https"
+		if schemes := list(s.doc["schemes"]); len(schemes) > 0 {
+			scheme = str(schemes[0])
+		}
+		return scheme + "://" + host + strings.TrimSuffix(str(s.doc["basePath"]), "/")
+	}
+	servers := list(s.doc["servers"])
+	if len(servers) == 0 {
+		return ""
+	}
+	server := object(servers[0])
+	serverURL := str(server["url"])
+	for name, variable := range object(server["variables"]) {
+		serverURL = strings.ReplaceAll(serverURL, "{"+name+"}", str(object(variable)["default"]))
+	}
+	return strings.TrimSuffix(serverURL, "/")
+}
+
+// endpoint returns the endpoint of an operation, with the parameters of the path item and the operation
+func (s *openAPI) endpoint(baseURL, path, method string, item, op map[string]any) config.Endpoint {
+	endpoint := config.Endpoint{Method: method}
+
+	// parameters of the operation override those of the path item with the same name and location
+	params := make(map[string]map[string]any)
+	var order []string
+	for _, raw := range append(list(item["parameters"]), list(op["parameters"])...) {
+		param := s.resolve(raw)
+		key := str(param["in"]) + ":" + str(param["name"])
+		if _, ok := params[key]; !ok {
+			order = append(order, key)
+		}
+		params[key] = param
+	}
+
+	var form url.Values
+	for _, key := range order {
+		param := params[key]
+		name := str(param["name"])
+		switch str(param["in"]) {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(s.paramValue(param)))
+		case "query":
+			if required(param) {
+				if endpoint.QueryParams == nil {
+					endpoint.QueryParams = make(map[string]string)
+				}
+				endpoint.QueryParams[name] = s.paramValue(param)
+			}
+		case "header":
+			if required(param) {
+				setHeader(&endpoint, name, s.paramValue(param))
+			}
+		case "body":
+			s.setBody(&endpoint, "application/json", s.exampleOf(param, object(param["schema"])))
+		case "formData":
+			if required(param) {
+				if form == nil {
+					form = url.Values{}
+				}
+				form.Set(name, s.paramValue(param))
+			}
+		}
+	}
+	if form != nil {
+		endpoint.Body = form.Encode()
+		setHeader(&endpoint, "Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	// path parameters without a declaration get a placeholder value rather than an invalid URL
+	path = pathParam.ReplaceAllString(path, "1")
+	endpoint.URL = baseURL + path
+
+	if body := s.resolve(op["requestBody"]); body != nil {
+		content := object(body["content"])
+		if mediaType := jsonMediaType(content); mediaType != "" {
+			media := object(content[mediaType])
+			s.setBody(&endpoint, mediaType, s.exampleOf(media, object(media["schema"])))
+		} else if media, ok := content["application/x-www-form-urlencoded"].(map[string]any); ok {
+			values := url.Values{}
+			for name, value := range object(s.exampleOf(media, object(media["schema"]))) {
+				values.Set(name, scalar(value))
+			}
+			endpoint.Body = values.Encode()
+			setHeader(&endpoint, "Content-Type", "application/x-www-form-urlencoded")
+		} else if len(content) > 0 {
+			s.logger.Debug("Request body not imported, no JSON or form media type", "method", method, "path", path)
+		}
+	}
+	return endpoint
+}
+
+// setBody sets the JSON encoded example as the body of the endpoint
+func (s *openAPI) setBody(endpoint *config.Endpoint, mediaType string, example any) {
+	if example == nil {
+		return
+	}
+	data, err := json.Marshal(example)
+	if err != nil {
+		s.logger.Debug("Example body not imported", "error", err)
+		return
+	}
+	endpoint.Body = string(data)
+	setHeader(endpoint, "Content-Type", mediaType)
+}
+
+// paramValue returns the example of a parameter as it is sent in a URL or header
+func (s *openAPI) paramValue(param map[string]any) string {
+	schema := object(param["schema"])
+	if s.swagger && schema == nil {
+		// Swagger 2 declares the type of non-body parameters on the parameter itself
+		schema = param
+	}
+	return scalar(s.exampleOf(param, schema))
+}
+
+// exampleOf returns the example of a parameter or media type, the first of its named examples, or an example
+// generated from its schema
+func (s *openAPI) exampleOf(holder map[string]any, schema map[string]any) any {
+	if example, ok := holder["example"]; ok {
+		return example
+	}
+	for _, name := range slices.Sorted(maps.Keys(object(holder["examples"]))) {
+		if example, ok := s.resolve(object(holder["examples"])[name])["value"]; ok {
+			return example
+		}
+	}
+	return s.sample(schema, 0, nil)
+}
+
+// sample generates an example value from a schema, following its references
+func (s *openAPI) sample(schema map[string]any, depth int, refs []string) any {
+	if schema == nil || depth > maxSchemaDepth {
+		return nil
+	}
+	if ref := str(schema["$ref"]); ref != "" {
+		if slices.Contains(refs, ref) {
+			// a recursive schema ends where it refers to itself
+			return nil
+		}
+		return s.sample(s.resolve(schema), depth, append(refs, ref))
+	}
+	for _, key := range []string{"example", "default"} {
+		if value, ok := schema[key]; ok {
+			return value
+		}
+	}
+	if enum := list(schema["enum"]); len(enum) > 0 {
+		return enum[0]
+	}
+	if all := list(schema["allOf"]); len(all) > 0 {
+		merged := make(map[string]any)
+		for _, part := range all {
+			maps.Copy(merged, object(s.sample(object(part), depth+1, refs)))
+		}
+		return merged
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if choices := list(schema[key]); len(choices) > 0 {
+			return s.sample(object(choices[0]), depth+1, refs)
+		}
+	}
+
+	schemaType := str(schema["type"])
+	if types := list(schema["type"]); len(types) > 0 {
+		// OpenAPI 3.1 allows a list of types, e.g. [string, "null"]
+		schemaType = str(types[0])
+	}
+	switch {
+	case schemaType == "object" || schemaType == "" && schema["properties"] != nil:
+		value := make(map[string]any)
+		for name, property := range object(schema["properties"]) {
+			if example := s.sample(object(property), depth+1, refs); example != nil {
+				value[name] = example
+			}
+		}
+		return value
+	case schemaType == "array":
+		if item := s.sample(object(schema["items"]), depth+1, refs); item != nil {
+			return []any{item}
+		}
+		return []any{}
+	case schemaType == "integer":
+		return 1
+	case schemaType == "number":
+		return 1.5
+	case schemaType == "boolean":
+		return true
+	case schemaType == "string":
+		switch str(schema["format"]) {
+		case "date":
+			return "2024-01-01"
+		case "date-time":
+			return "2024-01-01T00:00:00Z"
+		case "email":
+			return "user@example.com"
+		case "uuid":
+			return "00000000-0000-4000-8000-000000000000"
+		case "uri", "url":
+			return "https://example.com"
+		}
+		return "string"
+	}
+	return nil
+}
+
+// applySecurity maps the first security requirement of the operation, or of the spec, to the auth of the endpoint and
+// returns the environment variables its credentials are referenced from
+func (s *openAPI) applySecurity(endpoint *config.Endpoint, op map[string]any) []string {
+	requirements, ok := op["security"]
+	if !ok {
+		requirements = s.doc["security"]
+	}
+	var schemes map[string]any
+	if s.swagger {
+		schemes = object(s.doc["securityDefinitions"])
+	} else {
+		schemes = object(object(s.doc["components"])["securitySchemes"])
+	}
+
+	for _, requirement := range list(requirements) {
+		for _, name := range slices.Sorted(maps.Keys(object(requirement))) {
+			scheme := s.resolve(schemes[name])
+			if scheme == nil {
+				continue
+			}
+			prefix := envName(name)
+			scopes := list(object(requirement)[name])
+			switch schemeType := str(scheme["type"]); {
+			case schemeType == "apiKey":
+				value := "${" + prefix + "_KEY}"
+				switch str(scheme["in"]) {
+				case "header":
+					endpoint.AuthConfig = &config.AuthConfig{Enabled: true, Type: "api_key", APIKey: config.APIKeyAuth{Header: str(scheme["name"]), Value: value}}
+				case "query":
+					if endpoint.QueryParams == nil {
+						endpoint.QueryParams = make(map[string]string)
+					}
+					endpoint.QueryParams[str(scheme["name"])] = value
+				case "cookie":
+					setHeader(endpoint, "Cookie", str(scheme["name"])+"="+value)
+				default:
+					continue
+				}
+				return []string{prefix + "_KEY"}
+			case schemeType == "basic", schemeType == "http" && strings.EqualFold(str(scheme["scheme"]), "basic"):
+				endpoint.AuthConfig = &config.AuthConfig{Enabled: true, Type: "basic", Basic: config.BasicAuth{
+					Username: "${" + prefix + "_USERNAME}",
+					Password: "${" + prefix + "_PASSWORD}",
+				}}
+				return []string{prefix + "_USERNAME", prefix + "_PASSWORD"}
+			case schemeType == "oauth2":
+				if auth, vars := oauth2Auth(scheme, scopes, prefix, s.swagger); auth != nil {
+					endpoint.AuthConfig = auth
+					return vars
+				}
+				fallthrough
+			case schemeType == "http" && strings.EqualFold(str(scheme["scheme"]), "bearer"), schemeType == "openIdConnect":
+				endpoint.AuthConfig = &config.AuthConfig{Enabled: true, Type: "api_key", APIKey: config.APIKeyAuth{
+					Header: "Authorization",
+					Value:  "Bearer ${" + prefix + "_TOKEN}",
+				}}
+				return []string{prefix + "_TOKEN"}
+			}
+		}
+	}
+	return nil
+}
+
+// oauth2Auth returns the auth of an OAuth2 scheme with a client credentials or password flow, nil for flows that need
+// a browser, whose tokens are configured as bearer tokens instead
+func oauth2Auth(scheme map[string]any, scopes []any, prefix string, swagger bool) (*config.AuthConfig, []string) {
+	var grantType, tokenURL string
+	if swagger {
+		switch str(scheme["flow"]) {
+		case "application":
+			grantType = "client_credentials"
+		case "password":
+			grantType = "password"
+		}
+		tokenURL = str(scheme["tokenUrl"])
+	} else {
+		flows := object(scheme["flows"])
+		if flow, ok := flows["clientCredentials"].(map[string]any); ok {
+			grantType, tokenURL = "client_credentials", str(flow["tokenUrl"])
+		} else if flow, ok := flows["password"].(map[string]any); ok {
+			grantType, tokenURL = "password", str(flow["tokenUrl"])
+		}
+	}
+	if grantType == "" || tokenURL == "" {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		names = append(names, str(scope))
+	}
+	auth := &config.AuthConfig{Enabled: true, Type: "oauth2", OAuth2: config.OAuth2Auth{
+		TokenURL:     tokenURL,
+		ClientID:     "${" + prefix + "_CLIENT_ID}",
+		ClientSecret: "${" + prefix + "_CLIENT_SECRET}",
+		GrantType:    grantType,
+		Scope:        strings.Join(names, " "),
+	}}
+	vars := []string{prefix + "_CLIENT_ID", prefix + "_CLIENT_SECRET"}
+	if grantType == "password" {
+		auth.OAuth2.Username = "${" + prefix + "_USERNAME}"
+		auth.OAuth2.Password = "${" + prefix + "_PASSWORD}"
+		vars = append(vars, prefix+"_USERNAME", prefix+"_PASSWORD")
+	}
+	return auth, vars
+}
+
+// resolve returns the object a value refers to with $ref, or the value itself when it is not a reference. Only
+// references within the spec are followed
+func (s *openAPI) resolve(value any) map[string]any {
+	obj := object(value)
+	for range maxSchemaDepth {
+		ref, ok := obj["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return obj
+		}
+		var target any = s.doc
+		for _, token := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+			target = object(target)[token]
+		}
+		obj = object(target)
+	}
+	return obj
+}
+
+// jsonMediaType returns the JSON media type of a content map, application/json before other JSON types
+func jsonMediaType(content map[string]any) string {
+	if _, ok := content["application/json"]; ok {
+		return "application/json"
+	}
+	for _, mediaType := range slices.Sorted(maps.Keys(content)) {
+		if strings.HasSuffix(strings.Split(mediaType, ";")[0], "+json") {
+			return mediaType
+		}
+	}
+	return ""
+}
+
+// setHeader sets a header of the endpoint
+func setHeader(endpoint *config.Endpoint, name, value string) {
+	if endpoint.Headers == nil {
+		endpoint.Headers = make(map[string]string)
+	}
+	endpoint.Headers[name] = value
+}
+
+// envName returns the environment variable prefix of a security scheme, e.g. PETSTORE_AUTH for petstore-auth
+func envName(scheme string) string {
+	return strings.ToUpper(nonAlphanumeric.ReplaceAllString(scheme, "_"))
+}
+
+// required reports whether a parameter is required
+func required(param map[string]any) bool {
+	value, _ := param["required"].(bool)
+	return value
+}
+
+// scalar formats an example value for a URL, header or form field, objects and arrays as JSON
+func scalar(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]any, []any:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func object(value any) map[string]any {
+	obj, _ := value.(map[string]any)
+	return obj
+}
+
+func list(value any) []any {
+	items, _ := value.([]any)
+	return items
+}
+
+func str(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
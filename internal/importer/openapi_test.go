@@ -0,0 +1,159 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const petstore = `
+openapi: 3.0.3
+servers:
+  - url: https://{env}.example.com/v1/
+    variables:
+      env: {default: api}
+security:
+  - bearer: []
+paths:
+  /pets:
+    get:
+      tags: [pets]
+      parameters:
+        - {name: limit, in: query, schema: {type: integer}}
+        - {name: status, in: query, required: true, schema: {type: string, enum: [available, sold]}}
+    post:
+      tags: [pets]
+      security:
+        - client: [pets:write]
+      requestBody:
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/Pet'}
+  /pets/{petId}:
+    parameters:
+      - {name: petId, in: path, required: true, schema: {type: string, format: uuid}}
+    delete:
+      tags: [admin]
+      security:
+        - apiKey: []
+      parameters:
+        - {name: X-Reason, in: header, required: true, example: cleanup}
+  /login:
+    post:
+      security: []
+      requestBody:
+        content:
+          application/x-www-form-urlencoded:
+            example: {user: ann, remember: true}
+components:
+  securitySchemes:
+    bearer: {type: http, scheme: bearer}
+    apiKey: {type: apiKey, in: header, name: X-API-Key}
+    client:
+      type: oauth2
+      flows:
+        clientCredentials: {tokenUrl: 'https://auth.example.com/token', scopes: {pets:write: write}}
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        name: {type: string, example: Rex}
+        born: {type: string, format: date}
+        tags: {type: array, items: {type: string}}
+        owner: {$ref: '#/components/schemas/Owner'}
+    Owner:
+      allOf:
+        - properties: {email: {type: string, format: email}}
+        - properties: {pets: {type: array, items: {$ref: '#/components/schemas/Pet'}}}
+`
+
+func TestOpenAPI(t *testing.T) {
+	bearer := &config.AuthConfig{Enabled: true, Type: "api_key", APIKey: config.APIKeyAuth{Header: "Authorization", Value: "Bearer ${BEARER_TOKEN}"}}
+	endpoints, err := OpenAPI([]byte(petstore), OpenAPIOptions{}, testutil.Logger)
+	assert.NoError(t, err)
+	assert.Equal(t, []config.Endpoint{
+		{
+			URL: "https://api.example.com/v1/login", Method: "POST", Body: "remember=true&user=ann",
+			Headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+		},
+		{
+			URL: "https://api.example.com/v1/pets", Method: "GET", AuthConfig: bearer,
+			QueryParams: map[string]string{"status": "available"},
+		},
+		{
+			URL: "https://api.example.com/v1/pets", Method: "POST",
+			Body:    `{"born":"2024-01-01","name":"Rex","owner":{"email":"user@example.com","pets":[]},"tags":["string"]}`,
+			Headers: map[string]string{"Content-Type": "application/json"},
+			AuthConfig: &config.AuthConfig{Enabled: true, Type: "oauth2", OAuth2: config.OAuth2Auth{
+				TokenURL:     "https://auth.example.com/token",
+				ClientID:     "${CLIENT_CLIENT_ID}",
+				ClientSecret: "${CLIENT_CLIENT_SECRET}",
+				GrantType:    "client_credentials",
+				Scope:        "pets:write",
+			}},
+		},
+		{
+			URL: "https://api.example.com/v1/pets/00000000-0000-4000-8000-000000000000", Method: "DELETE",
+			Headers:    map[string]string{"X-Reason": "cleanup"},
+			AuthConfig: &config.AuthConfig{Enabled: true, Type: "api_key", APIKey: config.APIKeyAuth{Header: "X-API-Key", Value: "${APIKEY_KEY}"}},
+		},
+	}, endpoints)
+}
+
+func TestOpenAPIOptions(t *testing.T) {
+	endpoints, err := OpenAPI([]byte(petstore), OpenAPIOptions{BaseURL: "http://localhost:8080/", Tags: []string{"admin"}}, testutil.Logger)
+	assert.NoError(t, err)
+	assert.Len(t, endpoints, 1)
+	assert.Equal(t, "http://localhost:8080/pets/00000000-0000-4000-8000-000000000000", endpoints[0].URL)
+}
+
+func TestSwagger(t *testing.T) {
+	spec := `{
+	  "swagger": "2.0",
+	  "host": "api.example.com",
+	  "basePath": "/v2",
+	  "schemes": ["http"],
+	  "securityDefinitions": {"basic": {"type": "basic"}},
+	  "paths": {
+	    "/users/{id}": {
+	      "put": {
+	        "security": [{"basic": []}],
+	        "parameters": [
+	          {"name": "id", "in": "path", "required": true, "type": "integer"},
+	          {"name": "user", "in": "body", "schema": {"$ref": "#/definitions/User"}}
+	        ]
+	      }
+	    }
+	  },
+	  "definitions": {"User": {"type": "object", "properties": {"admin": {"type": "boolean", "default": false}}}}
+	}`
+	endpoints, err := OpenAPI([]byte(spec), OpenAPIOptions{}, testutil.Logger)
+	assert.NoError(t, err)
+	assert.Equal(t, []config.Endpoint{{
+		URL: "http://api.example.com/v2/users/1", Method: "PUT", Body: `{"admin":false}`,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		AuthConfig: &config.AuthConfig{Enabled: true, Type: "basic", Basic: config.BasicAuth{Username: "${BASIC_USERNAME}", Password: "${BASIC_PASSWORD}"}},
+	}}, endpoints)
+}
+
+func TestOpenAPIInvalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      string
+		expectErr string
+	}{
+		{name: "Not A Spec", spec: "name: shop", expectErr: "unsupported spec"},
+		{name: "Relative Server", spec: "openapi: 3.1.0\nservers: [{url: /api}]", expectErr: `spec has no absolute server URL "/api"`},
+		{name: "Invalid YAML", spec: "openapi: [", expectErr: "error decoding OpenAPI spec"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := OpenAPI([]byte(tc.spec), OpenAPIOptions{}, testutil.Logger)
+			assert.ErrorContains(t, err, tc.expectErr)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Package jsonpath looks up values in decoded JSON documents with simple paths like $.data.items[0].id
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Lookup returns the value at a path like $.data.items[0].id, the leading $ is optional
+func Lookup(doc any, path string) (any, error) {
+	if err := Validate(path); err != nil {
+		return nil, err
+	}
+	value := doc
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if trimmed == "" {
+		return value, nil
+	}
+
+	for _, part := range strings.Split(trimmed, ".") {
+		name, indexes, _ := strings.Cut(part, "[")
+		if name != "" {
+			object, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s not found in response", path)
+			}
+			if value, ok = object[name]; !ok {
+				return nil, fmt.Errorf("%s not found in response", path)
+			}
+		}
+
+		for indexes != "" {
+			index, rest, found := strings.Cut(indexes, "]")
+			if !found {
+				return nil, fmt.Errorf("invalid JSON path: %s", path)
+			}
+			i, err := strconv.Atoi(index)
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSON path: %s", path)
+			}
+			array, ok := value.([]any)
+			if !ok || i < 0 || i >= len(array) {
+				return nil, fmt.Errorf("%s not found in response", path)
+			}
+			value = array[i]
+			indexes = strings.TrimPrefix(rest, "[")
+		}
+	}
+	return value, nil
+}
+
+// Validate checks the syntax of a path, so an invalid path is reported before it is looked up in a response
+func Validate(path string) error {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if trimmed == "" {
+		return nil
+	}
+
+	for _, part := range strings.Split(trimmed, ".") {
+		name, indexes, hasIndex := strings.Cut(part, "[")
+		if name == "" && !hasIndex {
+			return fmt.Errorf("invalid JSON path: %s", path)
+		}
+		if strings.Contains(name, "]") {
+			return fmt.Errorf("invalid JSON path: %s", path)
+		}
+		for indexes != "" {
+			index, rest, found := strings.Cut(indexes, "]")
+			if !found {
+				return fmt.Errorf("invalid JSON path: %s", path)
+			}
+			if i, err := strconv.Atoi(index); err != nil || i < 0 {
+				return fmt.Errorf("invalid JSON path: %s", path)
+			}
+			if rest != "" && !strings.HasPrefix(rest, "[") {
+				return fmt.Errorf("invalid JSON path: %s", path)
+			}
+			indexes = strings.TrimPrefix(rest, "[")
+		}
+	}
+	return nil
+}
+
+// String converts a JSON value to its string form, e.g. to substitute it into later requests
+func String(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", fmt.Errorf("value is null")
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	}
+}
@@ -0,0 +1,103 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookup(t *testing.T) {
+	var doc any
+	assert.NoError(t, json.Unmarshal([]byte(`{"data": {"items": [{"id": 1}, {"id": 2, "tags": [["a", "b"]]}]}, "x": true}`), &doc))
+
+	tests := []struct {
+		name      string
+		path      string
+		expected  any
+		expectErr string
+	}{
+		{name: "Bare Root", path: "$", expected: doc},
+		{name: "Without Root", path: "x", expected: true},
+		{name: "Nested Field", path: "$.data.items[1].id", expected: 2.0},
+		{name: "Nested Indexes", path: "$.data.items[1].tags[0][1]", expected: "b"},
+		{name: "Root Index", path: "$.data.items[0]", expected: map[string]any{"id": 1.0}},
+		{name: "Out Of Range Index", path: "$.data.items[2].id", expectErr: "$.data.items[2].id not found in response"},
+		{name: "Missing Field", path: "$.data.total", expectErr: "$.data.total not found in response"},
+		{name: "Index Of Object", path: "$.data[0]", expectErr: "$.data[0] not found in response"},
+		{name: "Recursive Descent", path: "$..x", expectErr: "invalid JSON path: $..x"},
+		{name: "Missing Bracket", path: "$.data.items[0", expectErr: "invalid JSON path: $.data.items[0"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := Lookup(doc, tc.path)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, value)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		path  string
+		valid bool
+	}{
+		{path: "", valid: true},
+		{path: "$", valid: true},
+		{path: "$.data.items[0].id", valid: true},
+		{path: "data.items[0][12]", valid: true},
+		{path: "$[3]", valid: true},
+		{path: "$..x"},
+		{path: "$.a..b"},
+		{path: "$.items[0"},
+		{path: "$.items]"},
+		{path: "$.items[x]"},
+		{path: "$.items[-1]"},
+		{path: "$.items[0]x"},
+		{path: "$.items."},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			err := Validate(tc.path)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, "invalid JSON path: "+tc.path)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     any
+		expected  string
+		expectErr bool
+	}{
+		{name: "String", value: "a", expected: "a"},
+		{name: "Number", value: 1.5, expected: "1.5"},
+		{name: "Integer", value: 42.0, expected: "42"},
+		{name: "Bool", value: true, expected: "true"},
+		{name: "Array", value: []any{1.0, "a"}, expected: `[1,"a"]`},
+		{name: "Null", value: nil, expectErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := String(tc.value)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, s)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Client sends requests to the Kubernetes API server
+type Client struct {
+	server    string
+	token     string
+	namespace string
+	http      *http.Client
+	// exec fetches the credential of an exec plugin, nil when the kubeconfig user has none
+	exec *execCredentials
+}
+
+// Server returns the URL of the API server
+func (c *Client) Server() string {
+	return c.server
+}
+
+// Namespace returns the namespace of the kubeconfig context, empty when the context sets none
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// Get sends a GET request to the API server and decodes the JSON response into v
+func (c *Client) Get(ctx context.Context, path string, v any) error {
+	return c.Do(ctx, http.MethodGet, path, nil, v)
+}
+
+// Do sends a request with body encoded as JSON to the API server and decodes the JSON response into v. A nil body
+// sends no body and a nil v discards the response
+func (c *Client) Do(ctx context.Context, method, path string, body, v any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	resp, err := c.send(ctx, method, path, reader)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Stream sends a GET request to the API server and returns the response body, e.g. the logs of a pod. The caller
+// closes the body
+func (c *Client) Stream(ctx context.Context, path string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// send sends a request to the API server, a response with an error status is returned as an error with the message
+// of the API server
+func (c *Client) send(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.server+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	token := c.token
+	if c.exec != nil {
+		if token, _, err = c.exec.credential(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		// the API server describes the error in a Status object
+		var status struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &status) == nil && status.Message != "" {
+			return nil, fmt.Errorf("API server responded with %s: %s", resp.Status, status.Message)
+		}
+		return nil, fmt.Errorf("API server responded with %s", resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,208 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// versions of the client.authentication.k8s.io API an exec plugin may use
+const (
+	execAPIV1      = "client.authentication.k8s.io/v1"
+	execAPIV1Beta1 = "client.authentication.k8s.io/v1beta1"
+)
+
+// execExpiryDelta is how long before its expiration a credential is fetched again, so requests in flight do not
+// fail with an expired credential
+const execExpiryDelta = 30 * time.Second
+
+// execConfig represents the exec credential plugin of a user, e.g. aws eks get-token or gke-gcloud-auth-plugin
+type execConfig struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Command    string   `yaml:"command"`
+	Args       []string `yaml:"args"`
+	Env        []struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	} `yaml:"env"`
+	// InstallHint is shown when the command is not found
+	InstallHint string `yaml:"installHint"`
+	// ProvideClusterInfo passes the server and certificate authority of the cluster to the plugin
+	ProvideClusterInfo bool   `yaml:"provideClusterInfo"`
+	InteractiveMode    string `yaml:"interactiveMode"`
+}
+
+// execCredential represents the ExecCredential object passed to the plugin in $KUBERNETES_EXEC_INFO and printed by
+// the plugin to stdout
+type execCredential struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Spec       execCredentialSpec    `json:"spec"`
+	Status     *execCredentialStatus `json:"status,omitempty"`
+}
+
+// execCredentialSpec describes the request for a credential
+type execCredentialSpec struct {
+	Cluster     *execCluster `json:"cluster,omitempty"`
+	Interactive bool         `json:"interactive"`
+}
+
+// execCluster is the cluster passed to plugins with provideClusterInfo
+type execCluster struct {
+	Server                   string `json:"server"`
+	CertificateAuthorityData []byte `json:"certificate-authority-data,omitempty"`
+	InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify,omitempty"`
+}
+
+// execCredentialStatus is the credential returned by the plugin, a token or a client certificate
+type execCredentialStatus struct {
+	ExpirationTimestamp   *time.Time `json:"expirationTimestamp,omitempty"`
+	Token                 string     `json:"token,omitempty"`
+	ClientCertificateData string     `json:"clientCertificateData,omitempty"`
+	ClientKeyData         string     `json:"clientKeyData,omitempty"`
+}
+
+// execCredentials runs the exec plugin of a user and caches its credential until it expires. The plugin runs
+// without a terminal, plugins that always need one are not supported
+type execCredentials struct {
+	user    string
+	config  execConfig
+	dir     string
+	cluster *execCluster
+	// closeIdle closes the connections authenticated with a replaced client certificate
+	closeIdle func()
+
+	mu      sync.Mutex
+	fetched bool
+	token   string
+	cert    *tls.Certificate
+	// expires is when the credential expires, zero when it does not
+	expires time.Time
+}
+
+// newExecCredentials validates the exec config of the user, the plugin runs with the first request
+func newExecCredentials(user string, config execConfig, dir string, cluster *kubeCluster) (*execCredentials, error) {
+	if config.Command == "" {
+		return nil, fmt.Errorf("exec plugin of user %q has no command", user)
+	}
+	if config.APIVersion != execAPIV1 && config.APIVersion != execAPIV1Beta1 {
+		return nil, fmt.Errorf("exec plugin of user %q uses apiVersion %q, expected %s or %s", user,
+			config.APIVersion, execAPIV1, execAPIV1Beta1)
+	}
+	if config.InteractiveMode == "Always" {
+		return nil, fmt.Errorf("exec plugin of user %q requires an interactive terminal, which is not supported", user)
+	}
+	e := &execCredentials{user: user, config: config, dir: dir}
+	if config.ProvideClusterInfo {
+		ca, err := readData(cluster.CertificateAuthorityData, cluster.CertificateAuthority, dir)
+		if err != nil {
+			return nil, fmt.Errorf("error reading certificate authority: %w", err)
+		}
+		e.cluster = &execCluster{
+			Server:                   cluster.Server,
+			CertificateAuthorityData: ca,
+			InsecureSkipTLSVerify:    cluster.InsecureSkipTLSVerify,
+		}
+	}
+	return e, nil
+}
+
+// credential returns the token and client certificate of the plugin, running it when no credential was fetched yet
+// or the credential expires
+func (e *execCredentials) credential(ctx context.Context) (string, *tls.Certificate, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.fetched && (e.expires.IsZero() || time.Now().Add(execExpiryDelta).Before(e.expires)) {
+		return e.token, e.cert, nil
+	}
+
+	status, err := e.run(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	var cert *tls.Certificate
+	if status.ClientCertificateData != "" || status.ClientKeyData != "" {
+		pair, err := tls.X509KeyPair([]byte(status.ClientCertificateData), []byte(status.ClientKeyData))
+		if err != nil {
+			return "", nil, fmt.Errorf("exec plugin of user %q returned an invalid client certificate: %w", e.user, err)
+		}
+		cert = &pair
+	}
+	if e.cert != nil && e.closeIdle != nil {
+		e.closeIdle()
+	}
+	e.fetched, e.token, e.cert, e.expires = true, status.Token, cert, time.Time{}
+	if status.ExpirationTimestamp != nil {
+		e.expires = *status.ExpirationTimestamp
+	}
+	return e.token, e.cert, nil
+}
+
+// clientCertificate returns the client certificate of the plugin for the TLS handshake, an empty certificate when
+// the plugin returns a token
+func (e *execCredentials) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	_, cert, err := e.credential(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		return &tls.Certificate{}, nil
+	}
+	return cert, nil
+}
+
+// run runs the plugin and returns the credential it printed
+func (e *execCredentials) run(ctx context.Context) (*execCredentialStatus, error) {
+	info, err := json.Marshal(execCredential{
+		APIVersion: e.config.APIVersion,
+		Kind:       "ExecCredential",
+		Spec:       execCredentialSpec{Cluster: e.cluster},
+	})
+	if err != nil {
+		return nil, err
+	}
+	command := e.config.Command
+	// like kubectl, a command with a path is relative to the kubeconfig file and one without is looked up in $PATH
+	if strings.ContainsRune(command, filepath.Separator) {
+		command = resolvePath(command, e.dir)
+	}
+	cmd := exec.CommandContext(ctx, command, e.config.Args...)
+	cmd.Env = os.Environ()
+	for _, env := range e.config.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+	cmd.Env = append(cmd.Env, "KUBERNETES_EXEC_INFO="+string(info))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) && e.config.InstallHint != "" {
+			return nil, fmt.Errorf("exec plugin of user %q: %w\n%s", e.user, err, e.config.InstallHint)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("exec plugin of user %q failed: %w: %s", e.user, err, msg)
+		}
+		return nil, fmt.Errorf("exec plugin of user %q failed: %w", e.user, err)
+	}
+
+	var credential execCredential
+	if err := json.Unmarshal(stdout.Bytes(), &credential); err != nil {
+		return nil, fmt.Errorf("exec plugin of user %q printed an invalid ExecCredential: %w", e.user, err)
+	}
+	if credential.APIVersion != e.config.APIVersion || credential.Kind != "ExecCredential" {
+		return nil, fmt.Errorf("exec plugin of user %q printed %s %s, expected %s ExecCredential", e.user,
+			credential.APIVersion, credential.Kind, e.config.APIVersion)
+	}
+	if credential.Status == nil || (credential.Status.Token == "" && credential.Status.ClientCertificateData == "") {
+		return nil, fmt.Errorf("exec plugin of user %q returned neither a token nor a client certificate", e.user)
+	}
+	return credential.Status, nil
+}
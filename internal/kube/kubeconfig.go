@@ -0,0 +1,216 @@
+// Package kube is a minimal client of the Kubernetes API, configured from a kubeconfig file
+package kube
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// kubeconfig represents the parts of a kubeconfig file needed to reach the API server
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string      `yaml:"name"`
+		Cluster kubeCluster `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string   `yaml:"name"`
+		User kubeUser `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string      `yaml:"name"`
+		Context kubeContext `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// kubeCluster represents the API server of a cluster
+type kubeCluster struct {
+	Server                   string `yaml:"server"`
+	CertificateAuthority     string `yaml:"certificate-authority"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data"`
+	InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+}
+
+// kubeUser represents the credentials of a user, auth provider plugins are not supported
+type kubeUser struct {
+	Token                 string      `yaml:"token"`
+	TokenFile             string      `yaml:"tokenFile"`
+	ClientCertificate     string      `yaml:"client-certificate"`
+	ClientCertificateData string      `yaml:"client-certificate-data"`
+	ClientKey             string      `yaml:"client-key"`
+	ClientKeyData         string      `yaml:"client-key-data"`
+	Exec                  *execConfig `yaml:"exec"`
+	AuthProvider          any         `yaml:"auth-provider"`
+}
+
+// kubeContext binds a cluster to a user and a default namespace
+type kubeContext struct {
+	Cluster   string `yaml:"cluster"`
+	User      string `yaml:"user"`
+	Namespace string `yaml:"namespace"`
+}
+
+// DefaultKubeconfig returns the first file of $KUBECONFIG, or ~/.kube/config when it is not set
+func DefaultKubeconfig() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		return filepath.SplitList(env)[0]
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "config")
+}
+
+// Load reads the kubeconfig file and creates a client for the cluster of the context, the current context is used
+// when contextName is empty
+func Load(filename, contextName string) (*Client, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading kubeconfig: %w", err)
+	}
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("error parsing kubeconfig: %w", err)
+	}
+
+	if contextName == "" {
+		contextName = kc.CurrentContext
+	}
+	var kctx *kubeContext
+	for i := range kc.Contexts {
+		if kc.Contexts[i].Name == contextName {
+			kctx = &kc.Contexts[i].Context
+		}
+	}
+	if kctx == nil {
+		return nil, fmt.Errorf("context %q not found in kubeconfig", contextName)
+	}
+	var cluster *kubeCluster
+	for i := range kc.Clusters {
+		if kc.Clusters[i].Name == kctx.Cluster {
+			cluster = &kc.Clusters[i].Cluster
+		}
+	}
+	if cluster == nil || cluster.Server == "" {
+		return nil, fmt.Errorf("cluster %q of context %q not found in kubeconfig", kctx.Cluster, contextName)
+	}
+	var user kubeUser
+	for i := range kc.Users {
+		if kc.Users[i].Name == kctx.User {
+			user = kc.Users[i].User
+		}
+	}
+	if user.AuthProvider != nil {
+		return nil, fmt.Errorf("user %q uses an auth provider plugin, which is not supported, use an exec plugin, a token or client certificate", kctx.User)
+	}
+
+	// relative paths in a kubeconfig are relative to the file itself
+	dir := filepath.Dir(filename)
+	tlsConfig, err := cluster.tlsConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := user.addCertificate(tlsConfig, dir); err != nil {
+		return nil, err
+	}
+	token, err := user.token(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment}
+	client := &Client{
+		server:    strings.TrimSuffix(cluster.Server, "/"),
+		token:     token,
+		namespace: kctx.Namespace,
+		http:      &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}
+	if user.Exec != nil {
+		// the credential of the plugin replaces the token and client certificate of the user
+		if client.exec, err = newExecCredentials(kctx.User, *user.Exec, dir, cluster); err != nil {
+			return nil, err
+		}
+		client.exec.closeIdle = transport.CloseIdleConnections
+		tlsConfig.GetClientCertificate = client.exec.clientCertificate
+	}
+	return client, nil
+}
+
+// tlsConfig returns the TLS config trusting the certificate authority of the cluster
+func (c *kubeCluster) tlsConfig(dir string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipTLSVerify}
+	ca, err := readData(c.CertificateAuthorityData, c.CertificateAuthority, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading certificate authority: %w", err)
+	}
+	if ca != nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("certificate authority contains no PEM certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// addCertificate adds the client certificate of the user to the TLS config, if any
+func (u *kubeUser) addCertificate(tlsConfig *tls.Config, dir string) error {
+	cert, err := readData(u.ClientCertificateData, u.ClientCertificate, dir)
+	if err != nil {
+		return fmt.Errorf("error reading client certificate: %w", err)
+	}
+	key, err := readData(u.ClientKeyData, u.ClientKey, dir)
+	if err != nil {
+		return fmt.Errorf("error reading client key: %w", err)
+	}
+	if cert == nil && key == nil {
+		return nil
+	}
+	pair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return fmt.Errorf("invalid client certificate: %w", err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{pair}
+	return nil
+}
+
+// token returns the bearer token of the user, if any
+func (u *kubeUser) token(dir string) (string, error) {
+	if u.Token != "" || u.TokenFile == "" {
+		return u.Token, nil
+	}
+	data, err := os.ReadFile(resolvePath(u.TokenFile, dir))
+	if err != nil {
+		return "", fmt.Errorf("error reading token file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// readData returns the base64 decoded data, or the contents of the file when data is empty
+func readData(data, file, dir string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file == "" {
+		return nil, nil
+	}
+	return os.ReadFile(resolvePath(file, dir))
+}
+
+// resolvePath returns the path relative to dir, absolute paths are returned as is
+func resolvePath(path, dir string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,156 @@
+package kube
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeKubeconfig writes a kubeconfig for the server with the user and returns its path
+func writeKubeconfig(t *testing.T, dir, server, user string) string {
+	t.Helper()
+	kubeconfig := fmt.Sprintf(`current-context: test
+clusters:
+  - name: test
+    cluster:
+      server: %s
+contexts:
+  - name: test
+    context:
+      cluster: test
+      user: test
+      namespace: load
+users:
+  - name: test
+    user:
+%s`, server, user)
+	filename := filepath.Join(dir, "kubeconfig")
+	assert.NoError(t, os.WriteFile(filename, []byte(kubeconfig), 0o600))
+	return filename
+}
+
+func TestLoadExecPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the exec plugin of the test is a shell script")
+	}
+
+	tests := []struct {
+		name       string
+		expiration string
+		expectRuns int
+	}{
+		{name: "Without Expiration", expectRuns: 1},
+		{name: "Expired", expiration: `, "expirationTimestamp": "` + time.Now().UTC().Format(time.RFC3339) + `"`, expectRuns: 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var authorization []string
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				authorization = append(authorization, r.Header.Get("Authorization"))
+				rw.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			dir := t.TempDir()
+			script := `#!/bin/sh
+echo "$KUBERNETES_EXEC_INFO" >> "$(dirname "$0")/runs"
+echo '{"apiVersion": "client.authentication.k8s.io/v1", "kind": "ExecCredential",
+  "status": {"token": "'"$TOKEN"'"` + tc.expiration + `}}'
+`
+			assert.NoError(t, os.WriteFile(filepath.Join(dir, "plugin.sh"), []byte(script), 0o700))
+			filename := writeKubeconfig(t, dir, server.URL, `      exec:
+        apiVersion: client.authentication.k8s.io/v1
+        command: ./plugin.sh
+        env:
+          - name: TOKEN
+            value: exec-token
+        provideClusterInfo: true
+        interactiveMode: Never
+`)
+
+			client, err := Load(filename, "")
+			assert.NoError(t, err)
+			assert.NoError(t, client.Get(t.Context(), "/api", nil))
+			assert.NoError(t, client.Get(t.Context(), "/api", nil))
+			assert.Equal(t, []string{"Bearer exec-token", "Bearer exec-token"}, authorization)
+
+			runs, err := os.ReadFile(filepath.Join(dir, "runs"))
+			assert.NoError(t, err)
+			lines := strings.Split(strings.TrimSpace(string(runs)), "\n")
+			assert.Len(t, lines, tc.expectRuns)
+			assert.JSONEq(t, `{"apiVersion": "client.authentication.k8s.io/v1", "kind": "ExecCredential",
+				"spec": {"cluster": {"server": "`+server.URL+`"}, "interactive": false}}`, lines[0])
+		})
+	}
+}
+
+func TestLoadExecPluginErrors(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the exec plugin of the test is a shell script")
+	}
+
+	tests := []struct {
+		name      string
+		user      string
+		expectErr string
+	}{
+		{
+			name:      "Unknown API Version",
+			user:      "      exec:\n        apiVersion: client.authentication.k8s.io/v1alpha1\n        command: true\n",
+			expectErr: `exec plugin of user "test" uses apiVersion "client.authentication.k8s.io/v1alpha1"`,
+		},
+		{
+			name:      "Interactive",
+			user:      "      exec:\n        apiVersion: client.authentication.k8s.io/v1\n        command: true\n        interactiveMode: Always\n",
+			expectErr: `exec plugin of user "test" requires an interactive terminal`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(writeKubeconfig(t, t.TempDir(), "https://127.0.0.1:6443", tc.user), "")
+			assert.ErrorContains(t, err, tc.expectErr)
+		})
+	}
+
+	runErrors := []struct {
+		name      string
+		exec      string
+		expectErr string
+	}{
+		{
+			name:      "Not Found",
+			exec:      "        command: enchante-missing-plugin\n        installHint: install the plugin first\n",
+			expectErr: "install the plugin first",
+		},
+		{
+			name:      "Failing",
+			exec:      "        command: sh\n        args: [\"-c\", \"echo not logged in >&2; exit 1\"]\n",
+			expectErr: `exec plugin of user "test" failed: exit status 1: not logged in`,
+		},
+		{
+			name:      "No Credential",
+			exec:      "        command: sh\n        args: [\"-c\", \"echo '{\\\"apiVersion\\\": \\\"client.authentication.k8s.io/v1\\\", \\\"kind\\\": \\\"ExecCredential\\\", \\\"status\\\": {}}'\"]\n",
+			expectErr: `exec plugin of user "test" returned neither a token nor a client certificate`,
+		},
+	}
+
+	for _, tc := range runErrors {
+		t.Run(tc.name, func(t *testing.T) {
+			user := "      exec:\n        apiVersion: client.authentication.k8s.io/v1\n" + tc.exec
+			client, err := Load(writeKubeconfig(t, t.TempDir(), "http://127.0.0.1:1", user), "")
+			assert.NoError(t, err)
+			err = client.Get(t.Context(), "/api", nil)
+			assert.ErrorContains(t, err, tc.expectErr)
+		})
+	}
+}
@@ -5,56 +5,90 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"os"
 	"runtime"
+	"slices"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 )
 
-var (
-	timestampStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("250"))
-	infoStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("10")) // green
-	debugStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("13")) // purple
-	warnStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("11")) // yellow
-	errorStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))  // red
-	msgStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("15")) // white
-	attrStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("7"))  // grey
-	sourceStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))  // dark grey
-)
+// styles are the colors of the parts of a log line
+type styles struct {
+	timestamp lipgloss.Style
+	info      lipgloss.Style
+	debug     lipgloss.Style
+	warn      lipgloss.Style
+	error     lipgloss.Style
+	msg       lipgloss.Style
+	attr      lipgloss.Style
+	source    lipgloss.Style
+}
+
+// newStyles creates the styles for the output of the renderer
+func newStyles(r *lipgloss.Renderer) styles {
+	return styles{
+		timestamp: r.NewStyle().Foreground(lipgloss.Color("250")),
+		info:      r.NewStyle().Foreground(lipgloss.Color("10")), // green
+		debug:     r.NewStyle().Foreground(lipgloss.Color("13")), // purple
+		warn:      r.NewStyle().Foreground(lipgloss.Color("11")), // yellow
+		error:     r.NewStyle().Foreground(lipgloss.Color("9")),  // red
+		msg:       r.NewStyle().Foreground(lipgloss.Color("15")), // white
+		attr:      r.NewStyle().Foreground(lipgloss.Color("7")),  // grey
+		source:    r.NewStyle().Foreground(lipgloss.Color("8")),  // dark grey
+	}
+}
 
 // CustomHandler is a custom slog.Handler that applies colors using lipgloss
 type CustomHandler struct {
 	slog.Handler
 	writer     io.Writer
 	showSource bool
+	styles     styles
+	// attrs are the rendered attributes added with WithAttrs, qualified by the groups open when they were added
+	attrs string
+	// groups are the names of the open groups, qualifying the keys of the attributes added later
+	groups []string
 }
 
-// NewCustomHandler creates a new CustomHandler for colored logs
+// NewCustomHandler creates a new CustomHandler for colored logs, secrets are redacted from the messages and
+// attributes. Colors are disabled when out is not a terminal or NO_COLOR is set
 func NewCustomHandler(out io.Writer, opts slog.HandlerOptions, showSource bool) *CustomHandler {
+	return newCustomHandler(out, opts, showSource, false)
+}
+
+// newCustomHandler creates a new CustomHandler, noColor disables the colors regardless of the output
+func newCustomHandler(out io.Writer, opts slog.HandlerOptions, showSource, noColor bool) *CustomHandler {
+	renderer := lipgloss.NewRenderer(out)
+	if noColor {
+		renderer.SetColorProfile(termenv.Ascii)
+	}
 	return &CustomHandler{
 		Handler:    slog.NewTextHandler(out, &opts),
 		writer:     out,
 		showSource: showSource,
+		styles:     newStyles(renderer),
 	}
 }
 
 // Handle formats and prints log messages with colors
 func (h *CustomHandler) Handle(ctx context.Context, r slog.Record) error {
-	timestamp := timestampStyle.Render(r.Time.Format("15:04:05.000"))
+	timestamp := h.styles.timestamp.Render(r.Time.Format("15:04:05.000"))
 	levelStr := r.Level.String()
-	coloredLevel := formatLevel(levelStr)
-	message := msgStyle.Render(r.Message)
+	coloredLevel := h.styles.formatLevel(levelStr)
+	message := h.styles.msg.Render(RedactString(r.Message))
 	source := ""
 	if h.showSource {
-		source = sourceStyle.Render(getCallerInfo())
+		source = h.styles.source.Render(getCallerInfo())
 	}
 
-	var attrStr string
+	var attrs strings.Builder
+	attrs.WriteString(h.attrs)
 	r.Attrs(func(a slog.Attr) bool {
-		attrStr += fmt.Sprintf(" %s=%v", attrStyle.Render(a.Key), a.Value.Any())
+		h.styles.appendAttr(&attrs, h.groupPrefix(), a)
 		return true
 	})
+	attrStr := attrs.String()
 
 	if h.showSource {
 		fmt.Fprintf(h.writer, "%s %s %s %s%s\n", timestamp, coloredLevel, source, message, attrStr)
@@ -65,16 +99,68 @@ func (h *CustomHandler) Handle(ctx context.Context, r slog.Record) error {
 	return nil
 }
 
-func formatLevel(level string) string {
+// WithAttrs returns a handler rendering the attributes with every record, qualified by the open groups
+func (h *CustomHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	var rendered strings.Builder
+	rendered.WriteString(h.attrs)
+	for _, a := range attrs {
+		h.styles.appendAttr(&rendered, h.groupPrefix(), a)
+	}
+	clone := *h
+	clone.attrs = rendered.String()
+	return &clone
+}
+
+// WithGroup returns a handler qualifying the keys of the attributes added later with the name of the group
+func (h *CustomHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.groups = append(slices.Clip(h.groups), name)
+	return &clone
+}
+
+// groupPrefix returns the qualifier of the keys of the open groups, e.g. request.auth.
+func (h *CustomHandler) groupPrefix() string {
+	if len(h.groups) == 0 {
+		return ""
+	}
+	return strings.Join(h.groups, ".") + "."
+}
+
+// appendAttr renders an attribute with its key qualified by prefix, the attributes of a group are rendered
+// individually with the group name added to the prefix. Empty attributes and groups are skipped
+func (s styles) appendAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a = RedactAttr(nil, a)
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, attr := range a.Value.Group() {
+			s.appendAttr(b, prefix, attr)
+		}
+		return
+	}
+	fmt.Fprintf(b, " %s=%v", s.attr.Render(prefix+a.Key), a.Value.Any())
+}
+
+func (s styles) formatLevel(level string) string {
 	switch level {
 	case "DEBUG":
-		return debugStyle.Render("[DEBUG]")
+		return s.debug.Render("[DEBUG]")
 	case "INFO":
-		return infoStyle.Render("[INFO]")
+		return s.info.Render("[INFO]")
 	case "WARN":
-		return warnStyle.Render("[WARN]")
+		return s.warn.Render("[WARN]")
 	case "ERROR":
-		return errorStyle.Render("[ERROR]")
+		return s.error.Render("[ERROR]")
 	default:
 		return level
 	}
@@ -105,18 +191,49 @@ func getCallerInfo() string {
 	return "unknown"
 }
 
-// NewLogger initializes the logger with optional debug mode
-func NewLogger(debug bool) *slog.Logger {
+// log formats, text is colored for terminals and json is meant for log collectors like Loki and ELK
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options configures the logger, the zero value logs colored text at info level
+type Options struct {
+	// Debug enables debug logs and the source of every log line
+	Debug bool
+	// Format is text or json, text by default
+	Format string
+	// NoColor disables the colors of the text format, they are also disabled when the output is not a terminal or
+	// NO_COLOR is set
+	NoColor bool
+}
+
+// NewLogger initializes the logger writing to out with optional debug mode
+func NewLogger(out io.Writer, debug bool) *slog.Logger {
+	l, _ := New(out, Options{Debug: debug})
+	return l
+}
+
+// New initializes the logger writing to out with the options, the JSON logs include the source with debug mode like
+// the colored logs
+func New(out io.Writer, opts Options) (*slog.Logger, error) {
 	var level slog.Level
-	if debug {
+	if opts.Debug {
 		level = slog.LevelDebug
 	} else {
 		level = slog.LevelInfo
 	}
 
-	handler := NewCustomHandler(os.Stdout, slog.HandlerOptions{
-		Level: level,
-	}, debug)
-
-	return slog.New(handler)
+	switch opts.Format {
+	case FormatText, "":
+		return slog.New(newCustomHandler(out, slog.HandlerOptions{Level: level}, opts.Debug, opts.NoColor)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{
+			Level:       level,
+			AddSource:   opts.Debug,
+			ReplaceAttr: RedactAttr,
+		})), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, must be %s or %s", opts.Format, FormatText, FormatJSON)
+	}
 }
@@ -0,0 +1,127 @@
+package logger
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secrets in the logs
+const Redacted = "[REDACTED]"
+
+// minSecretLength is the length below which registered secrets are ignored, masking every occurrence of a short value
+// would garble the logs
+const minSecretLength = 4
+
+// secretKeySuffixes are the endings of attribute, header and field names holding secrets, compared in lower case
+// without separators, e.g. client_secret, X-Api-Key and Set-Cookie
+var secretKeySuffixes = []string{
+	"password", "passwd", "secret", "token", "authorization", "cookie", "apikey", "privatekey", "credential",
+	"credentials",
+}
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+	// urlPassword matches the password of the user info of a URL
+	urlPassword = regexp.MustCompile(`(://[^/@:\s]*:)[^/@\s]+@`)
+)
+
+// IsSecretKey reports whether the name of an attribute, header or field denotes a secret
+func IsSecretKey(key string) bool {
+	normalized := strings.NewReplacer("_", "", "-", "", ".", "", " ", "").Replace(strings.ToLower(key))
+	return slices.ContainsFunc(secretKeySuffixes, func(suffix string) bool {
+		return strings.HasSuffix(normalized, suffix)
+	})
+}
+
+// RegisterSecret masks every occurrence of a value in the logs, e.g. a password resolved from Vault or a token
+// fetched at run time
+func RegisterSecret(value string) {
+	if len(value) < minSecretLength {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if !slices.Contains(secrets, value) {
+		secrets = append(secrets, value)
+		// longer secrets first, so a secret containing another is masked as a whole
+		slices.SortFunc(secrets, func(a, b string) int { return len(b) - len(a) })
+	}
+}
+
+// RedactString masks the registered secrets and the password of URLs in s
+func RedactString(s string) string {
+	secretsMu.RLock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	secretsMu.RUnlock()
+	return urlPassword.ReplaceAllString(s, "${1}"+Redacted+"@")
+}
+
+// RedactAttr masks the value of an attribute named like a secret, the secret headers and fields of header and form
+// values, and the registered secrets in any other value. It can be used as slog.HandlerOptions.ReplaceAttr
+func RedactAttr(_ []string, a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		redacted := make([]slog.Attr, len(attrs))
+		for i, attr := range attrs {
+			redacted[i] = RedactAttr(nil, attr)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	}
+	if IsSecretKey(a.Key) && a.Value.String() != "" {
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch v := a.Value.Any().(type) {
+	case string:
+		return slog.String(a.Key, RedactString(v))
+	case error:
+		return slog.String(a.Key, RedactString(v.Error()))
+	case *url.URL:
+		return slog.String(a.Key, RedactString(v.Redacted()))
+	case http.Header:
+		return slog.Any(a.Key, redactValues(v))
+	case url.Values:
+		return slog.Any(a.Key, url.Values(redactValues(v)))
+	case map[string]string:
+		redacted := make(map[string]string, len(v))
+		for key, value := range v {
+			redacted[key] = redactValue(key, value)
+		}
+		return slog.Any(a.Key, redacted)
+	}
+	if a.Value.Kind() == slog.KindAny {
+		if s, ok := a.Value.Any().(interface{ String() string }); ok {
+			return slog.String(a.Key, RedactString(s.String()))
+		}
+	}
+	return a
+}
+
+// redactValues returns a copy of header or form values with the values of secret names masked
+func redactValues[M ~map[string][]string](values M) M {
+	redacted := make(M, len(values))
+	for key, list := range values {
+		redacted[key] = make([]string, len(list))
+		for i, value := range list {
+			redacted[key][i] = redactValue(key, value)
+		}
+	}
+	return redacted
+}
+
+// redactValue masks the value of a secret name and the registered secrets in any other value
+func redactValue(key, value string) string {
+	if IsSecretKey(key) {
+		return Redacted
+	}
+	return RedactString(value)
+}
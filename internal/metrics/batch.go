@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// maxBuffered limits the requests buffered between two writes, requests beyond it are dropped so a slow or
+// unreachable database cannot exhaust the memory of a run
+const maxBuffered = 100_000
+
+// batcher buffers the requests of a sink and writes them in batches at the flush interval. The writes happen on a
+// background goroutine, so Record never waits for the database
+type batcher struct {
+	mu      sync.Mutex
+	pending []Request
+	dropped int
+	write   func(batch []Request) error
+	// err is the first error of the writes, kept for close
+	err  error
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newBatcher creates a batcher calling write with the buffered requests at the interval
+func newBatcher(interval time.Duration, write func(batch []Request) error) *batcher {
+	b := &batcher{
+		write: write,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go b.flushEvery(interval)
+	return b
+}
+
+// add buffers a request, it is dropped when the buffer is full
+func (b *batcher) add(r Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pending) >= maxBuffered {
+		b.dropped++
+		return
+	}
+	b.pending = append(b.pending, r)
+}
+
+// flush writes the buffered requests, the first error is kept
+func (b *batcher) flush() {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	if err := b.write(batch); err != nil && b.err == nil {
+		b.err = err
+	}
+}
+
+// flushEvery writes the buffered requests at the interval until the batcher is closed
+func (b *batcher) flushEvery(interval time.Duration) {
+	defer close(b.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			b.flush()
+		}
+	}
+}
+
+// close writes the remaining requests and returns the first error of the writes and the number of dropped requests
+func (b *batcher) close() (dropped int, err error) {
+	close(b.stop)
+	<-b.done
+	b.flush()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped, b.err
+}
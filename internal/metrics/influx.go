@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// InfluxDB writes a data point per request to InfluxDB with the line protocol. The endpoint, method, status, success,
+// run ID, scenario, step and error category are tags, the duration and transferred bytes are fields
+type InfluxDB struct {
+	client      *http.Client
+	writeURL    string
+	token       string
+	measurement string
+	runID       string
+	batch       *batcher
+}
+
+// NewInfluxDB creates a sink writing to the configured server, the data points of a run are tagged with its ID
+func NewInfluxDB(cfg config.InfluxDBConfig, runID string) (*InfluxDB, error) {
+	writeURL, err := influxWriteURL(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &InfluxDB{
+		client:      &http.Client{Timeout: 10 * time.Second},
+		writeURL:    writeURL,
+		token:       cfg.Token,
+		measurement: cfg.MeasurementName(),
+		runID:       runID,
+	}
+	s.batch = newBatcher(time.Duration(cfg.FlushInterval())*time.Millisecond, s.write)
+	return s, nil
+}
+
+// influxWriteURL returns the URL of the write API, the InfluxDB 1 API when a database is configured
+func influxWriteURL(cfg config.InfluxDBConfig) (string, error) {
+	base, err := url.Parse(strings.TrimRight(cfg.URL, "/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid influxdb url: %w", err)
+	}
+	query := url.Values{"precision": {"ns"}}
+	if cfg.Database != "" {
+		base.Path += "/write"
+		query.Set("db", cfg.Database)
+	} else {
+		base.Path += "/api/v2/write"
+		query.Set("org", cfg.Org)
+		query.Set("bucket", cfg.Bucket)
+	}
+	base.RawQuery = query.Encode()
+	return base.String(), nil
+}
+
+// Record buffers the data point of a request
+func (s *InfluxDB) Record(r Request) {
+	s.batch.add(r)
+}
+
+// write sends a batch of data points to the write API
+func (s *InfluxDB) write(batch []Request) error {
+	var body bytes.Buffer
+	for _, r := range batch {
+		s.appendPoint(&body, r)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.writeURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("influxdb returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// appendPoint appends the line of a request, e.g.
+// enchante_request,endpoint=GET\ api.example.com/items,method=GET,run_id=1a2b,status=200,success=true duration_ms=12.5,bytes_sent=0i,bytes_received=512i 1700000000000000000
+func (s *InfluxDB) appendPoint(b *bytes.Buffer, r Request) {
+	b.WriteString(escapeInflux(s.measurement, ", "))
+	// the tags are sorted by key, as recommended for the performance of the writes
+	tag := func(key, value string) {
+		if value != "" {
+			b.WriteString("," + key + "=" + escapeInflux(value, ",= "))
+		}
+	}
+	tag("endpoint", r.Endpoint())
+	tag("error", r.ErrorCategory)
+	tag("method", r.Method)
+	tag("run_id", s.runID)
+	tag("scenario", r.Scenario)
+	if r.Status > 0 {
+		tag("status", strconv.Itoa(r.Status))
+	}
+	tag("step", r.Step)
+	tag("success", strconv.FormatBool(r.Success))
+
+	b.WriteString(" duration_ms=" + strconv.FormatFloat(float64(r.Duration)/float64(time.Millisecond), 'f', -1, 64))
+	b.WriteString(",bytes_sent=" + strconv.FormatInt(r.BytesSent, 10) + "i")
+	b.WriteString(",bytes_received=" + strconv.FormatInt(r.BytesReceived, 10) + "i")
+	b.WriteString(" " + strconv.FormatInt(r.Time.UnixNano(), 10) + "\n")
+}
+
+// escapeInflux escapes the special characters of a measurement name, tag key or tag value with backslashes, line
+// breaks cannot be escaped and are replaced with spaces
+func escapeInflux(s, special string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\n' || r == '\r' {
+			r = ' '
+		}
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Close writes the remaining data points, it returns the first error of the writes
+func (s *InfluxDB) Close() error {
+	dropped, err := s.batch.close()
+	if err != nil {
+		return fmt.Errorf("error writing influxdb points: %w", err)
+	}
+	if dropped > 0 {
+		return fmt.Errorf("influxdb points dropped: %d", dropped)
+	}
+	return nil
+}
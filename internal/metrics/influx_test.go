@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfluxDB(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	success := Request{Time: start, Method: "GET", URL: "https://api.example.com/items", Duration: 12500 * time.Microsecond, Success: true, Status: 200, BytesReceived: 512}
+	failure := Request{Time: start.Add(time.Second), Method: "POST", URL: "https://api.example.com/items", Scenario: "check out", Step: "a=b,c", ErrorCategory: "timeout", BytesSent: 64}
+
+	tests := []struct {
+		name          string
+		cfg           config.InfluxDBConfig
+		expectedPath  string
+		expectedQuery string
+		expectedAuth  string
+	}{
+		{
+			name:          "v2",
+			cfg:           config.InfluxDBConfig{Token: "secret-token", Org: "acme", Bucket: "load"},
+			expectedPath:  "/api/v2/write",
+			expectedQuery: "bucket=load&org=acme&precision=ns",
+			expectedAuth:  "Token secret-token",
+		},
+		{
+			name:          "v1",
+			cfg:           config.InfluxDBConfig{Database: "load"},
+			expectedPath:  "/write",
+			expectedQuery: "db=load&precision=ns",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, tc.expectedPath, r.URL.Path)
+				assert.Equal(t, tc.expectedQuery, r.URL.RawQuery)
+				assert.Equal(t, tc.expectedAuth, r.Header.Get("Authorization"))
+				data, _ := io.ReadAll(r.Body)
+				body += string(data)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			tc.cfg.URL = server.URL
+			sink, err := NewInfluxDB(tc.cfg, "run-1")
+			assert.NoError(t, err)
+			sink.Record(success)
+			sink.Record(failure)
+			assert.NoError(t, sink.Close())
+
+			assert.Equal(t, `enchante_request,endpoint=GET\ api.example.com/items,method=GET,run_id=run-1,status=200,success=true duration_ms=12.5,bytes_sent=0i,bytes_received=512i 1700000000000000000
+enchante_request,endpoint=POST\ api.example.com/items,error=timeout,method=POST,run_id=run-1,scenario=check\ out,step=a\=b\,c,success=false duration_ms=0,bytes_sent=64i,bytes_received=0i 1700000001000000000
+`, body)
+		})
+	}
+}
+
+func TestInfluxDBWriteError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bucket not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	sink, err := NewInfluxDB(config.InfluxDBConfig{URL: server.URL, Org: "acme", Bucket: "missing"}, "run-1")
+	assert.NoError(t, err)
+	sink.Record(Request{Time: time.Now(), Method: "GET", URL: "http://localhost/"})
+	assert.ErrorContains(t, sink.Close(), "influxdb returned status 404: bucket not found")
+}
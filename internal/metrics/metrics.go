@@ -0,0 +1,73 @@
+// Package metrics emits the results of a run to monitoring systems while it runs, so they appear next to the
+// production dashboards
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Request represents the outcome of a single request as emitted to the sinks
+type Request struct {
+	Time     time.Time
+	Method   string
+	URL      string
+	Scenario string
+	Step     string
+	Duration time.Duration
+	Success  bool
+	// Status is the status code of the response, 0 when no response was received
+	Status int
+	// ErrorCategory is the category of the error in the error taxonomy, e.g. timeout or status_5xx
+	ErrorCategory string
+	BytesSent     int64
+	BytesReceived int64
+}
+
+// Endpoint returns the method and the URL of the request without its scheme, e.g. GET api.example.com/items
+func (r Request) Endpoint() string {
+	target := r.URL
+	if _, rest, ok := strings.Cut(target, "://"); ok {
+		target = rest
+	}
+	return r.Method + " " + target
+}
+
+// Sink receives the requests of a run. Record is called from a single goroutine for every completed request and must
+// not block the run, Close sends the remaining metrics
+type Sink interface {
+	Record(r Request)
+	Close() error
+}
+
+// multiSink passes the requests on to several sinks
+type multiSink []Sink
+
+// Multi returns a sink passing the requests on to all sinks, nil without sinks
+func Multi(sinks ...Sink) Sink {
+	switch len(sinks) {
+	case 0:
+		return nil
+	case 1:
+		return sinks[0]
+	default:
+		return multiSink(sinks)
+	}
+}
+
+// Record passes the request on to all sinks
+func (m multiSink) Record(r Request) {
+	for _, sink := range m {
+		sink.Record(r)
+	}
+}
+
+// Close closes all sinks and returns their errors
+func (m multiSink) Close() error {
+	var errs []error
+	for _, sink := range m {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
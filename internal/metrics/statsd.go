@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// maxPacketSize keeps a StatsD packet within the MTU of common networks, so it is not fragmented
+const maxPacketSize = 1432
+
+// StatsD emits the requests to StatsD or DogStatsD over UDP. Every request increments the requests counter, successful
+// requests record the response_time timer and failures increment the errors counter. With DogStatsD the endpoint, method, status
+// and error category are tags, with plain StatsD the endpoint is part of the metric names
+type StatsD struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	prefix string
+	dog    bool
+	tags   []string
+	packet []byte
+	err    error
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewStatsD creates a sink sending to the configured server, the buffered metrics are sent at the flush interval
+func NewStatsD(cfg config.StatsDConfig) (*StatsD, error) {
+	conn, err := net.Dial("udp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to statsd: %w", err)
+	}
+	s := &StatsD{
+		conn:   conn,
+		prefix: cfg.MetricPrefix(),
+		dog:    cfg.MetricFormat() == config.StatsDFormatDogStatsD,
+		tags:   cfg.Tags,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.flushEvery(time.Duration(cfg.FlushInterval()) * time.Millisecond)
+	return s, nil
+}
+
+// Record buffers the metrics of a request
+func (s *StatsD) Record(r Request) {
+	var tags []string
+	name := s.prefix
+	if s.dog {
+		tags = s.requestTags(r)
+	} else {
+		name += sanitizeName(r.Endpoint()) + "."
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(name+"requests", "1|c", tags)
+	if r.Success {
+		s.add(name+"response_time", strconv.FormatFloat(float64(r.Duration)/float64(time.Millisecond), 'f', 3, 64)+"|ms", tags)
+	}
+	if r.BytesReceived > 0 {
+		s.add(name+"bytes_received", strconv.FormatInt(r.BytesReceived, 10)+"|c", tags)
+	}
+	if !r.Success {
+		errorName := name + "errors"
+		if !s.dog && r.ErrorCategory != "" {
+			errorName += "." + sanitizeName(r.ErrorCategory)
+		}
+		s.add(errorName, "1|c", tags)
+	}
+}
+
+// requestTags returns the DogStatsD tags of a request, the configured tags first
+func (s *StatsD) requestTags(r Request) []string {
+	tags := append(make([]string, 0, len(s.tags)+7), s.tags...)
+	tags = append(tags, "endpoint:"+sanitizeTag(r.Endpoint()), "method:"+sanitizeTag(r.Method), "success:"+strconv.FormatBool(r.Success))
+	if r.Status > 0 {
+		tags = append(tags, "status:"+strconv.Itoa(r.Status))
+	}
+	if r.Scenario != "" {
+		tags = append(tags, "scenario:"+sanitizeTag(r.Scenario), "step:"+sanitizeTag(r.Step))
+	}
+	if r.ErrorCategory != "" {
+		tags = append(tags, "error:"+sanitizeTag(r.ErrorCategory))
+	}
+	return tags
+}
+
+// add appends a metric line to the packet, sending the packet first when the line does not fit
+func (s *StatsD) add(name, value string, tags []string) {
+	line := name + ":" + value
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	if len(s.packet) > 0 && len(s.packet)+1+len(line) > maxPacketSize {
+		s.flush()
+	}
+	if len(s.packet) > 0 {
+		s.packet = append(s.packet, '\n')
+	}
+	s.packet = append(s.packet, line...)
+}
+
+// flush sends the buffered packet, the first error is kept for Close
+func (s *StatsD) flush() {
+	if len(s.packet) == 0 {
+		return
+	}
+	if _, err := s.conn.Write(s.packet); err != nil && s.err == nil {
+		s.err = err
+	}
+	s.packet = s.packet[:0]
+}
+
+// flushEvery sends the buffered metrics at the interval until the sink is closed
+func (s *StatsD) flushEvery(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.flush()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Close sends the remaining metrics and closes the connection, it returns the first error of the sends
+func (s *StatsD) Close() error {
+	close(s.stop)
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flush()
+	if err := s.conn.Close(); s.err == nil {
+		s.err = err
+	}
+	if s.err != nil {
+		return fmt.Errorf("error sending statsd metrics: %w", s.err)
+	}
+	return nil
+}
+
+// sanitizeName replaces the characters other than letters, digits and dashes with underscores, StatsD uses colons and
+// pipes as separators and Graphite turns dots into folders
+func sanitizeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+// sanitizeTag replaces the separators of DogStatsD tags with underscores
+func sanitizeTag(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '|', '#', '\n', ' ':
+			return '_'
+		default:
+			return r
+		}
+	}, s)
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// listenUDP returns a UDP listener on a free local port and a function reading the lines of the next packet
+func listenUDP(t *testing.T) (*net.UDPConn, func() []string) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn, func() []string {
+		buf := make([]byte, 65536)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, err := conn.Read(buf)
+		assert.NoError(t, err)
+		return strings.Split(string(buf[:n]), "\n")
+	}
+}
+
+func TestStatsD(t *testing.T) {
+	success := Request{Method: "GET", URL: "https://api.example.com/items", Duration: 12500 * time.Microsecond, Success: true, Status: 200, BytesReceived: 512}
+	failure := Request{Method: "POST", URL: "https://api.example.com/items", Scenario: "checkout", Step: "order", Status: 503, ErrorCategory: "status_5xx"}
+
+	tests := []struct {
+		name     string
+		cfg      config.StatsDConfig
+		expected []string
+	}{
+		{
+			name: "dogstatsd",
+			cfg:  config.StatsDConfig{Tags: []string{"env:staging"}},
+			expected: []string{
+				"enchante.requests:1|c|#env:staging,endpoint:GET_api.example.com/items,method:GET,success:true,status:200",
+				"enchante.response_time:12.500|ms|#env:staging,endpoint:GET_api.example.com/items,method:GET,success:true,status:200",
+				"enchante.bytes_received:512|c|#env:staging,endpoint:GET_api.example.com/items,method:GET,success:true,status:200",
+				"enchante.requests:1|c|#env:staging,endpoint:POST_api.example.com/items,method:POST,success:false,status:503,scenario:checkout,step:order,error:status_5xx",
+				"enchante.errors:1|c|#env:staging,endpoint:POST_api.example.com/items,method:POST,success:false,status:503,scenario:checkout,step:order,error:status_5xx",
+			},
+		},
+		{
+			name: "statsd",
+			cfg:  config.StatsDConfig{Prefix: "load.", Format: config.StatsDFormatStatsD, Tags: []string{"env:staging"}},
+			expected: []string{
+				"load.GET_api_example_com_items.requests:1|c",
+				"load.GET_api_example_com_items.response_time:12.500|ms",
+				"load.GET_api_example_com_items.bytes_received:512|c",
+				"load.POST_api_example_com_items.requests:1|c",
+				"load.POST_api_example_com_items.errors.status_5xx:1|c",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, read := listenUDP(t)
+			tc.cfg.Address = conn.LocalAddr().String()
+			sink, err := NewStatsD(tc.cfg)
+			assert.NoError(t, err)
+
+			sink.Record(success)
+			sink.Record(failure)
+			assert.NoError(t, sink.Close())
+			assert.Equal(t, tc.expected, read())
+		})
+	}
+}
+
+func TestStatsDPacketSize(t *testing.T) {
+	conn, read := listenUDP(t)
+	sink, err := NewStatsD(config.StatsDConfig{Address: conn.LocalAddr().String()})
+	assert.NoError(t, err)
+
+	for range 20 {
+		sink.Record(Request{Method: "GET", URL: "https://api.example.com/items", Success: true, Status: 200})
+	}
+	assert.NoError(t, sink.Close())
+
+	var lines int
+	for lines < 40 {
+		packet := read()
+		assert.LessOrEqual(t, len(strings.Join(packet, "\n")), maxPacketSize)
+		lines += len(packet)
+	}
+	assert.Equal(t, 40, lines)
+}
+
+func TestStatsDFlushInterval(t *testing.T) {
+	conn, read := listenUDP(t)
+	sink, err := NewStatsD(config.StatsDConfig{Address: conn.LocalAddr().String(), Format: config.StatsDFormatStatsD, FlushIntervalMS: 10})
+	assert.NoError(t, err)
+	defer sink.Close()
+
+	sink.Record(Request{Method: "GET", URL: "http://localhost/", Status: 500})
+	assert.Equal(t, []string{"enchante.GET_localhost_.requests:1|c", "enchante.GET_localhost_.errors:1|c"}, read(), "Expected the metrics before the sink is closed")
+}
+
+func TestMulti(t *testing.T) {
+	assert.Nil(t, Multi())
+	conn, read := listenUDP(t)
+	first, err := NewStatsD(config.StatsDConfig{Address: conn.LocalAddr().String(), Format: config.StatsDFormatStatsD})
+	assert.NoError(t, err)
+	second, err := NewStatsD(config.StatsDConfig{Address: conn.LocalAddr().String(), Format: config.StatsDFormatStatsD, Prefix: "second."})
+	assert.NoError(t, err)
+
+	sink := Multi(first, second)
+	sink.Record(Request{Method: "GET", URL: "http://localhost/", Success: true})
+	assert.NoError(t, sink.Close())
+	packets := [][]string{read(), read()}
+	assert.ElementsMatch(t, []string{"enchante.GET_localhost_.requests:1|c", "second.GET_localhost_.requests:1|c"},
+		[]string{packets[0][0], packets[1][0]})
+}
@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// timescaleColumns are the columns of the requests table in the order of the inserted values
+var timescaleColumns = []string{
+	"time", "run_id", "endpoint", "method", "url", "scenario", "step", "status", "success", "error",
+	"duration_ms", "bytes_sent", "bytes_received",
+}
+
+// maxInsertRows keeps an insert below the limit of 65535 parameters of a Postgres statement
+const maxInsertRows = 1000
+
+// Timescale inserts a row per request into a table of TimescaleDB or Postgres, the rows of a run share its ID
+type Timescale struct {
+	db    *sql.DB
+	table string
+	runID string
+	batch *batcher
+}
+
+// NewTimescale opens the configured database with its database/sql driver and creates the requests table when
+// needed. The driver must be registered by the binary, the enchante binary registers pgx
+func NewTimescale(cfg config.TimescaleConfig, runID string) (*Timescale, error) {
+	driver := cfg.DriverName()
+	if !slices.Contains(sql.Drivers(), driver) {
+		return nil, fmt.Errorf("database driver %q is not included in this build", driver)
+	}
+	db, err := sql.Open(driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("error opening timescale database: %w", err)
+	}
+	for _, statement := range timescaleSchema(cfg.TableName(), cfg.Hypertable) {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error creating timescale table: %w", err)
+		}
+	}
+
+	s := &Timescale{db: db, table: cfg.TableName(), runID: runID}
+	s.batch = newBatcher(time.Duration(cfg.FlushInterval())*time.Millisecond, s.write)
+	return s, nil
+}
+
+// timescaleSchema returns the statements creating the requests table, with the index used by dashboards filtering on
+// a run. A hypertable is partitioned by time by TimescaleDB
+func timescaleSchema(table string, hypertable bool) []string {
+	index := strings.ReplaceAll(table, ".", "_") + "_run_id_idx"
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS ` + table + ` (
+	time TIMESTAMPTZ NOT NULL,
+	run_id TEXT NOT NULL,
+	endpoint TEXT NOT NULL,
+	method TEXT NOT NULL,
+	url TEXT NOT NULL,
+	scenario TEXT,
+	step TEXT,
+	status INTEGER,
+	success BOOLEAN NOT NULL,
+	error TEXT,
+	duration_ms DOUBLE PRECISION NOT NULL,
+	bytes_sent BIGINT NOT NULL,
+	bytes_received BIGINT NOT NULL
+)`,
+		`CREATE INDEX IF NOT EXISTS ` + index + ` ON ` + table + ` (run_id, time DESC)`,
+	}
+	if hypertable {
+		statements = append(statements, `SELECT create_hypertable('`+table+`', 'time', if_not_exists => TRUE)`)
+	}
+	return statements
+}
+
+// insertStatement returns the statement inserting the given number of rows
+func insertStatement(table string, rows int) string {
+	var b strings.Builder
+	b.WriteString("INSERT INTO " + table + " (" + strings.Join(timescaleColumns, ", ") + ") VALUES ")
+	n := 0
+	for row := range rows {
+		if row > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for column := range timescaleColumns {
+			if column > 0 {
+				b.WriteString(", ")
+			}
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// Record buffers the row of a request
+func (s *Timescale) Record(r Request) {
+	s.batch.add(r)
+}
+
+// write inserts a batch of rows in chunks of maxInsertRows
+func (s *Timescale) write(batch []Request) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for chunk := range slices.Chunk(batch, maxInsertRows) {
+		args := make([]any, 0, len(chunk)*len(timescaleColumns))
+		for _, r := range chunk {
+			args = append(args, s.values(r)...)
+		}
+		if _, err := s.db.ExecContext(ctx, insertStatement(s.table, len(chunk)), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// values returns the values of the row of a request, empty optional columns are NULL
+func (s *Timescale) values(r Request) []any {
+	return []any{
+		r.Time.UTC(), s.runID, r.Endpoint(), r.Method, r.URL,
+		nullString(r.Scenario), nullString(r.Step), sql.NullInt64{Int64: int64(r.Status), Valid: r.Status > 0},
+		r.Success, nullString(r.ErrorCategory),
+		float64(r.Duration) / float64(time.Millisecond), r.BytesSent, r.BytesReceived,
+	}
+}
+
+// nullString returns NULL for an empty string
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// Close inserts the remaining rows and closes the database, it returns the first error of the inserts
+func (s *Timescale) Close() error {
+	dropped, err := s.batch.close()
+	s.db.Close()
+	if err != nil {
+		return fmt.Errorf("error inserting timescale rows: %w", err)
+	}
+	if dropped > 0 {
+		return fmt.Errorf("timescale rows dropped: %d", dropped)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/dasvh/enchante/internal/config"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTimescaleWithoutDriver(t *testing.T) {
+	_, err := NewTimescale(config.TimescaleConfig{DSN: "postgres://localhost/load", Driver: "postgres"}, "run-1")
+	assert.ErrorContains(t, err, `database driver "postgres" is not included in this build`)
+}
+
+func TestNewTimescaleUnreachable(t *testing.T) {
+	_, err := NewTimescale(config.TimescaleConfig{DSN: "postgres://enchante@127.0.0.1:1/load?connect_timeout=1"}, "run-1")
+	assert.ErrorContains(t, err, "error creating timescale table", "Expected the default pgx driver to connect to the database")
+}
+
+func TestInsertStatement(t *testing.T) {
+	assert.Equal(t, "INSERT INTO load.requests (time, run_id, endpoint, method, url, scenario, step, status, success, error, "+
+		"duration_ms, bytes_sent, bytes_received) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13), "+
+		"($14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26)", insertStatement("load.requests", 2))
+}
+
+func TestTimescaleSchema(t *testing.T) {
+	statements := timescaleSchema("load.requests", true)
+	assert.Len(t, statements, 3)
+	assert.Contains(t, statements[0], "CREATE TABLE IF NOT EXISTS load.requests (")
+	assert.Equal(t, "CREATE INDEX IF NOT EXISTS load_requests_run_id_idx ON load.requests (run_id, time DESC)", statements[1])
+	assert.Equal(t, "SELECT create_hypertable('load.requests', 'time', if_not_exists => TRUE)", statements[2])
+	assert.Len(t, timescaleSchema("requests", false), 2)
+}
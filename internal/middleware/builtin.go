@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// DefaultSignatureHeader is the header the signing middleware sets by default
+const DefaultSignatureHeader = "X-Signature"
+
+// newLogging logs every request with its outcome
+func newLogging(_ config.Middleware, logger *slog.Logger) (Middleware, error) {
+	return Funcs{After: func(_ context.Context, req *Request, resp *Response) error {
+		args := []any{"method", req.Method, "url", req.URL, "status_code", resp.StatusCode, "duration_ms", resp.Duration.Milliseconds()}
+		if resp.Err != nil {
+			logger.Warn("Request failed", append(args, "error", resp.Err)...)
+		} else {
+			logger.Info("Request completed", args...)
+		}
+		return nil
+	}}, nil
+}
+
+// newHeaders adds the configured headers to every request that does not set them
+func newHeaders(spec config.Middleware, _ *slog.Logger) (Middleware, error) {
+	if len(spec.Headers) == 0 {
+		return nil, fmt.Errorf("headers middleware requires headers")
+	}
+	return Funcs{Before: func(_ context.Context, req *Request) error {
+		for name, value := range spec.Headers {
+			if !hasHeader(req.Header, name) {
+				req.Header[name] = value
+			}
+		}
+		return nil
+	}}, nil
+}
+
+// newSigning signs every request with an HMAC-SHA256 of its method, URL, timestamp and body, set as
+// t=<unix timestamp>,v1=<hex signature>
+func newSigning(spec config.Middleware, _ *slog.Logger) (Middleware, error) {
+	if spec.Secret == "" {
+		return nil, fmt.Errorf("signing middleware requires secret")
+	}
+	header := cmp.Or(spec.Header, DefaultSignatureHeader)
+	return Funcs{Before: func(_ context.Context, req *Request) error {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header[header] = "t=" + timestamp + ",v1=" + Sign(spec.Secret, req.Method, req.URL, timestamp, req.Body)
+		return nil
+	}}, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of the method, URL, timestamp and body separated by newlines, the signature of
+// the signing middleware, e.g. to verify it on the target
+func Sign(secret, method, url, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + url + "\n" + timestamp + "\n" + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// metricsMiddleware counts the requests per status code and their total duration, logged when the run ends
+type metricsMiddleware struct {
+	logger   *slog.Logger
+	mu       sync.Mutex
+	statuses map[int]int
+	requests int
+	failed   int
+	total    time.Duration
+}
+
+// newMetrics counts the responses per status code, logged as a report at the end of the run
+func newMetrics(_ config.Middleware, logger *slog.Logger) (Middleware, error) {
+	return &metricsMiddleware{logger: logger, statuses: make(map[int]int)}, nil
+}
+
+func (m *metricsMiddleware) BeforeSend(context.Context, *Request) error {
+	return nil
+}
+
+func (m *metricsMiddleware) AfterResponse(_ context.Context, _ *Request, resp *Response) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests++
+	if resp.StatusCode > 0 {
+		m.statuses[resp.StatusCode]++
+	}
+	if resp.Err != nil {
+		m.failed++
+	}
+	m.total += resp.Duration
+	return nil
+}
+
+// Close logs the requests per status code and their mean duration
+func (m *metricsMiddleware) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.requests == 0 {
+		return
+	}
+	statuses := make([]string, 0, len(m.statuses))
+	for _, code := range slices.Sorted(maps.Keys(m.statuses)) {
+		statuses = append(statuses, fmt.Sprintf("%d=%d", code, m.statuses[code]))
+	}
+	m.logger.Info("Middleware metrics report",
+		"requests", m.requests,
+		"failed", m.failed,
+		"status_codes", strings.Join(statuses, ","),
+		"mean_ms", float64(m.total)/float64(time.Millisecond)/float64(m.requests))
+}
+
+// hasHeader reports whether the header is set under any casing
+func hasHeader(header map[string]string, name string) bool {
+	for key := range header {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+// Package middleware runs the configured middlewares around every request of a run. Middleware types are looked up
+// in a registry, so new types, including custom middlewares of an embedding application, are added with Register
+// without changes to the probe engine
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// built-in middleware types
+const (
+	TypeLogging = "logging"
+	TypeHeaders = "headers"
+	TypeSigning = "signing"
+	TypeMetrics = "metrics"
+)
+
+// Request represents a request about to be sent, with the variables substituted. BeforeSend may change its headers
+type Request struct {
+	Method string
+	// URL is the request URL including the query parameters
+	URL    string
+	Header map[string]string
+	// Body is the configured body, empty for generated, file and multipart bodies
+	Body string
+}
+
+// Response represents the outcome of a request
+type Response struct {
+	// StatusCode is 0 when no response was received
+	StatusCode int
+	// Header holds the headers of a successful response
+	Header   http.Header
+	Duration time.Duration
+	// Err is the error the request failed with, nil for a successful request
+	Err error
+}
+
+// Middleware runs around every request. An error of BeforeSend fails the request without sending it, an error of
+// AfterResponse fails a successful request. Both are called concurrently by the workers
+type Middleware interface {
+	BeforeSend(ctx context.Context, req *Request) error
+	AfterResponse(ctx context.Context, req *Request, resp *Response) error
+}
+
+// Closer is implemented by middlewares reporting at the end of the run
+type Closer interface {
+	Close()
+}
+
+// Funcs adapts functions to the Middleware interface, a nil function does nothing
+type Funcs struct {
+	Before func(ctx context.Context, req *Request) error
+	After  func(ctx context.Context, req *Request, resp *Response) error
+}
+
+// BeforeSend calls Before
+func (f Funcs) BeforeSend(ctx context.Context, req *Request) error {
+	if f.Before == nil {
+		return nil
+	}
+	return f.Before(ctx, req)
+}
+
+// AfterResponse calls After
+func (f Funcs) AfterResponse(ctx context.Context, req *Request, resp *Response) error {
+	if f.After == nil {
+		return nil
+	}
+	return f.After(ctx, req, resp)
+}
+
+// Factory creates a middleware from its configuration, it returns an error when the configuration is invalid
+type Factory func(spec config.Middleware, logger *slog.Logger) (Middleware, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		TypeLogging: newLogging,
+		TypeHeaders: newHeaders,
+		TypeSigning: newSigning,
+		TypeMetrics: newMetrics,
+	}
+)
+
+// Register adds a middleware type, registering an existing type replaces it. It is meant to be called before the run
+// starts, e.g. from an init function
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// New creates the middleware of the configured type
+func New(spec config.Middleware, logger *slog.Logger) (Middleware, error) {
+	registryMu.RLock()
+	factory, ok := registry[spec.Type]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown middleware type %q", spec.Type)
+	}
+	return factory(spec, logger)
+}
+
+// Chain is the middlewares of a run in the configured order
+type Chain []Middleware
+
+// Compile creates the middlewares of a run in the configured order
+func Compile(specs []config.Middleware, logger *slog.Logger) (Chain, error) {
+	chain := make(Chain, 0, len(specs))
+	for i, spec := range specs {
+		m, err := New(spec, logger)
+		if err != nil {
+			return nil, fmt.Errorf("middleware %d: %w", i+1, err)
+		}
+		chain = append(chain, m)
+	}
+	return chain, nil
+}
+
+// BeforeSend runs the middlewares in order and stops at the first error
+func (c Chain) BeforeSend(ctx context.Context, req *Request) error {
+	for _, m := range c {
+		if err := m.BeforeSend(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AfterResponse runs the middlewares in reverse order, so the first middleware sees the response last, and returns
+// the first error
+func (c Chain) AfterResponse(ctx context.Context, req *Request, resp *Response) error {
+	var first error
+	for i := len(c) - 1; i >= 0; i-- {
+		if err := c[i].AfterResponse(ctx, req, resp); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Close closes the middlewares reporting at the end of the run
+func (c Chain) Close() {
+	for _, m := range c {
+		if closer, ok := m.(Closer); ok {
+			closer.Close()
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return Funcs{
+			Before: func(context.Context, *Request) error {
+				calls = append(calls, "before "+name)
+				return nil
+			},
+			After: func(context.Context, *Request, *Response) error {
+				calls = append(calls, "after "+name)
+				if name == "inner" {
+					return errors.New("rejected")
+				}
+				return nil
+			},
+		}
+	}
+	chain := Chain{trace("outer"), trace("inner")}
+
+	req := &Request{Header: map[string]string{}}
+	assert.NoError(t, chain.BeforeSend(t.Context(), req))
+	assert.EqualError(t, chain.AfterResponse(t.Context(), req, &Response{}), "rejected")
+	assert.Equal(t, []string{"before outer", "before inner", "after inner", "after outer"}, calls,
+		"Expected the responses in reverse order, also after a rejection")
+}
+
+func TestBuiltinMiddleware(t *testing.T) {
+	chain, err := Compile([]config.Middleware{
+		{Type: TypeLogging},
+		{Type: TypeHeaders, Headers: map[string]string{"X-Client": "enchante", "Accept": "application/json"}},
+		{Type: TypeSigning, Secret: "key"},
+		{Type: TypeMetrics},
+	}, testutil.Logger)
+	assert.NoError(t, err)
+
+	req := &Request{Method: "POST", URL: "https://api.example.com/orders", Header: map[string]string{"accept": "text/csv"}, Body: "{}"}
+	assert.NoError(t, chain.BeforeSend(t.Context(), req))
+	assert.Equal(t, "enchante", req.Header["X-Client"])
+	assert.NotContains(t, req.Header, "Accept", "Expected headers set by the request to be kept")
+
+	signature := req.Header[DefaultSignatureHeader]
+	timestamp, digest, ok := strings.Cut(strings.TrimPrefix(signature, "t="), ",v1=")
+	assert.True(t, ok, "Expected t=<timestamp>,v1=<signature>, got %s", signature)
+	assert.Equal(t, Sign("key", "POST", "https://api.example.com/orders", timestamp, "{}"), digest)
+
+	assert.NoError(t, chain.AfterResponse(t.Context(), req, &Response{StatusCode: http.StatusOK, Duration: 20 * time.Millisecond}))
+	assert.NoError(t, chain.AfterResponse(t.Context(), req, &Response{StatusCode: http.StatusBadGateway, Err: errors.New("bad gateway")}))
+	metrics := chain[3].(*metricsMiddleware)
+	assert.Equal(t, 2, metrics.requests)
+	assert.Equal(t, 1, metrics.failed)
+	assert.Equal(t, map[int]int{http.StatusOK: 1, http.StatusBadGateway: 1}, metrics.statuses)
+	chain.Close()
+}
+
+func TestInvalidMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      config.Middleware
+		expectErr string
+	}{
+		{name: "Unknown Type", spec: config.Middleware{Type: "tracing"}, expectErr: `unknown middleware type "tracing"`},
+		{name: "Headers Without Headers", spec: config.Middleware{Type: TypeHeaders}, expectErr: "headers middleware requires headers"},
+		{name: "Signing Without Secret", spec: config.Middleware{Type: TypeSigning}, expectErr: "signing middleware requires secret"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Compile([]config.Middleware{tc.spec}, testutil.Logger)
+			assert.ErrorContains(t, err, "middleware 1: "+tc.expectErr)
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("tenant", func(spec config.Middleware, _ *slog.Logger) (Middleware, error) {
+		return Funcs{Before: func(_ context.Context, req *Request) error {
+			req.Header["X-Tenant"] = spec.Args["tenant"]
+			return nil
+		}}, nil
+	})
+
+	chain, err := Compile([]config.Middleware{{Type: "tenant", Args: map[string]string{"tenant": "acme"}}}, testutil.Logger)
+	assert.NoError(t, err)
+	req := &Request{Header: map[string]string{}}
+	assert.NoError(t, chain.BeforeSend(t.Context(), req))
+	assert.Equal(t, "acme", req.Header["X-Tenant"])
+}
@@ -0,0 +1,186 @@
+package probe
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// adaptiveLimiter adjusts the number of in-flight requests with additive increase and multiplicative decrease (AIMD).
+// Every request within the latency target grows the limit by 1/limit, i.e. by one per window of limit requests.
+// A slower or failed request multiplies the limit with the decrease factor, at most once per window, since the
+// requests started before a decrease are likely to be slow as well
+type adaptiveLimiter struct {
+	mu       sync.Mutex
+	target   time.Duration
+	minLimit float64
+	maxLimit float64
+	factor   float64
+	limit    float64
+	inFlight int
+	// criticalWaiting counts the critical requests waiting for a slot, requests of lower priorities wait behind them
+	criticalWaiting int
+	// changed is closed and replaced whenever a slot is released, waking up the waiting workers
+	changed chan struct{}
+	// sinceDecrease counts the requests since the last decrease, withinTarget the requests within the target in a row
+	sinceDecrease int
+	withinTarget  int
+	sustained     int
+	maxReached    int
+	decreases     int
+	logger        *slog.Logger
+}
+
+// newAdaptiveLimiter creates the limiter starting at the minimum concurrency, nil when the mode is disabled
+func newAdaptiveLimiter(adaptive config.AdaptiveConfig, maxConcurrency int, logger *slog.Logger) *adaptiveLimiter {
+	if !adaptive.Enabled {
+		return nil
+	}
+	minLimit := adaptive.MinLimit()
+	return &adaptiveLimiter{
+		target:     time.Duration(adaptive.TargetLatencyMS) * time.Millisecond,
+		minLimit:   float64(minLimit),
+		maxLimit:   float64(maxConcurrency),
+		factor:     adaptive.Factor(),
+		limit:      float64(minLimit),
+		changed:    make(chan struct{}),
+		maxReached: minLimit,
+		logger:     logger,
+	}
+}
+
+// acquire waits until the number of in-flight requests is below the limit, it returns false when the context
+// is cancelled first. Critical requests are admitted before the waiting requests of lower priorities
+func (l *adaptiveLimiter) acquire(ctx context.Context, priority string) bool {
+	if l == nil {
+		return true
+	}
+	critical := priority == config.PriorityCritical
+	waiting := false
+	for {
+		l.mu.Lock()
+		if l.inFlight < int(l.limit) && (critical || l.criticalWaiting == 0) {
+			l.inFlight++
+			if waiting {
+				l.criticalWaiting--
+			}
+			l.mu.Unlock()
+			return true
+		}
+		if critical && !waiting {
+			l.criticalWaiting++
+			waiting = true
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			if waiting {
+				l.mu.Lock()
+				l.criticalWaiting--
+				l.notify()
+				l.mu.Unlock()
+			}
+			return false
+		case <-changed:
+		}
+	}
+}
+
+// shed reports whether a request of the priority is shed instead of waiting for a slot, bulk requests are shed while
+// the limit is exhausted or critical requests are waiting
+func (l *adaptiveLimiter) shed(priority string) bool {
+	if l == nil || priority != config.PriorityBulk {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight >= int(l.limit) || l.criticalWaiting > 0
+}
+
+// notify wakes up the waiting workers, the caller holds the lock
+func (l *adaptiveLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// release frees the slot of a finished request and adjusts the limit to its outcome
+func (l *adaptiveLimiter) release(duration time.Duration, failed bool) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	current := int(l.limit)
+	l.sinceDecrease++
+
+	if failed || duration > l.target {
+		l.withinTarget = 0
+		if l.sinceDecrease >= current && l.limit > l.minLimit {
+			l.limit = max(l.minLimit, l.limit*l.factor)
+			l.sinceDecrease = 0
+			l.decreases++
+		}
+	} else {
+		l.withinTarget++
+		if l.withinTarget >= current {
+			l.sustained = max(l.sustained, current)
+			l.withinTarget = 0
+		}
+		l.limit = min(l.maxLimit, l.limit+1/l.limit)
+	}
+
+	if next := int(l.limit); next != current {
+		l.maxReached = max(l.maxReached, next)
+		l.logger.Debug("Adaptive concurrency changed", "from", current, "to", next)
+	}
+	l.notify()
+}
+
+// abandon frees a slot without a request being made, e.g. on cancellation
+func (l *adaptiveLimiter) abandon() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.notify()
+}
+
+// report returns the outcome of the adaptive concurrency mode, nil when the mode is disabled
+func (l *adaptiveLimiter) report() *report.Adaptive {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return &report.Adaptive{
+		TargetLatencyMS:      int(l.target / time.Millisecond),
+		SustainedConcurrency: l.sustained,
+		FinalConcurrency:     int(l.limit),
+		MaxConcurrency:       l.maxReached,
+		Decreases:            l.decreases,
+	}
+}
+
+// logAdaptiveReport logs the concurrency the latency target could sustain
+func logAdaptiveReport(l *adaptiveLimiter, logger *slog.Logger) {
+	r := l.report()
+	if r == nil {
+		return
+	}
+	logger.Info("Adaptive concurrency report",
+		"target_latency_ms", r.TargetLatencyMS,
+		"sustained_concurrency", r.SustainedConcurrency,
+		"final_concurrency", r.FinalConcurrency,
+		"max_concurrency", r.MaxConcurrency,
+		"decreases", r.Decreases)
+}
@@ -0,0 +1,44 @@
+package probe
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dasvh/enchante/internal/assertion"
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// compileAssertions creates the assertions of every target, indexed like the targets
+func compileAssertions(targets []config.Endpoint) ([][]assertion.Assertion, error) {
+	compiled := make([][]assertion.Assertion, len(targets))
+	for i, target := range targets {
+		if len(target.Assertions) == 0 {
+			continue
+		}
+		assertions, err := assertion.Compile(target.Assertions)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %s: %w", target.URL, err)
+		}
+		compiled[i] = assertions
+	}
+	return compiled, nil
+}
+
+// checkAssertions checks the captured response of the request to endpoint with the given headers against the
+// assertions, a failure wraps ErrAssertion
+func checkAssertions(assertions []assertion.Assertion, endpoint config.Endpoint, headers map[string]string, capture *responseCapture) error {
+	request := assertion.Request{
+		Method: endpoint.Method,
+		URL:    endpoint.RequestURL(),
+		Header: make(http.Header, len(headers)),
+		Body:   endpoint.Body,
+	}
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	resp := assertion.Response{StatusCode: capture.status, Header: capture.header, Body: capture.body.Bytes(), Request: request}
+	if err := assertion.CheckAll(assertions, resp); err != nil {
+		return fmt.Errorf("%w: %w", ErrAssertion, err)
+	}
+	return nil
+}
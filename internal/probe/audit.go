@@ -0,0 +1,99 @@
+package probe
+
+import (
+	"net/http"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/logger"
+)
+
+// auditDetail holds what the audit file records about a request beyond its result: the request as sent and the
+// headers and body of the response
+type auditDetail struct {
+	// RequestURL is the URL with the variables substituted and the query parameters appended
+	RequestURL      string            `json:"request_url"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	RequestBody     string            `json:"request_body,omitempty"`
+	ResponseHeaders http.Header       `json:"response_headers,omitempty"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+	// ResponseBytes is the size of the decoded response body, of which body_bytes are kept
+	ResponseBytes int64 `json:"response_bytes,omitempty"`
+	// Truncated is set when a body was cut to body_bytes
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// auditRecord is a line of the audit file, the result of a request followed by its details
+type auditRecord struct {
+	resultRecord
+	*auditDetail
+}
+
+// auditor collects the details of the requests for the audit file
+type auditor struct {
+	bodyBytes int
+}
+
+// newAuditor creates the auditor of the config, it returns nil without an audit file
+func newAuditor(cfg config.AuditConfig) *auditor {
+	if cfg.File == "" {
+		return nil
+	}
+	return &auditor{bodyBytes: cfg.BodyBytes}
+}
+
+// capture returns a response capture keeping no more of the body than the audit needs
+func (a *auditor) capture() *responseCapture {
+	if a.bodyBytes == 0 {
+		return &responseCapture{limit: -1}
+	}
+	return &responseCapture{limit: a.bodyBytes}
+}
+
+// detail returns the details of a request, nil without an audit. The values of credential headers are redacted, and
+// the bodies are cut to the configured number of bytes
+func (a *auditor) detail(endpoint config.Endpoint, headers map[string]string, capture *responseCapture) *auditDetail {
+	if a == nil {
+		return nil
+	}
+	detail := &auditDetail{RequestURL: endpoint.RequestURL()}
+	if len(headers) > 0 {
+		detail.RequestHeaders = make(map[string]string, len(headers))
+		for key, value := range headers {
+			if logger.IsSecretKey(key) {
+				value = logger.Redacted
+			}
+			detail.RequestHeaders[key] = value
+		}
+	}
+	if a.bodyBytes > 0 {
+		detail.RequestBody = endpoint.Body
+		if len(detail.RequestBody) > a.bodyBytes {
+			detail.RequestBody = detail.RequestBody[:a.bodyBytes]
+			detail.Truncated = true
+		}
+	}
+	if capture != nil {
+		detail.ResponseHeaders = redactHeader(capture.header)
+		detail.ResponseBytes = capture.size
+		if a.bodyBytes > 0 {
+			body := capture.body.Bytes()
+			detail.ResponseBody = string(body[:min(len(body), a.bodyBytes)])
+			detail.Truncated = detail.Truncated || capture.size > int64(a.bodyBytes)
+		}
+	}
+	return detail
+}
+
+// redactHeader returns a copy of the header with the values of credential headers like Set-Cookie redacted
+func redactHeader(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+	redacted := header.Clone()
+	for key := range redacted {
+		if logger.IsSecretKey(key) {
+			redacted[key] = []string{logger.Redacted}
+		}
+	}
+	return redacted
+}
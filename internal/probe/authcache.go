@@ -0,0 +1,149 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/auth"
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// authRetryInterval is how long a failed credential fetch waits before it is tried again
+const authRetryInterval = 5 * time.Second
+
+// authHeaders holds the credentials of the targets, resolved once per auth config before the load starts and
+// refreshed in the background, so the workers only make requests against the target
+type authHeaders struct {
+	// targets holds the credential of every target by index, nil for the targets without auth
+	targets []*authCredential
+}
+
+// authCredential holds the latest credential of an auth config
+type authCredential struct {
+	cfg        *config.AuthConfig
+	mu         sync.RWMutex
+	credential auth.Credential
+	// resolved is set once a credential was fetched, a failed refresh keeps the previous credential
+	resolved bool
+	err      error
+}
+
+// startAuth resolves the credentials of the auth configs of the targets, falling back to the global auth, and starts
+// refreshing the ones that expire, are configured with a refresh interval or could not be fetched. The stop function
+// ends the refreshing, a fetch in progress is left to finish
+func startAuth(ctx context.Context, targets []config.Endpoint, global *config.AuthConfig, logger *slog.Logger) (*authHeaders, func()) {
+	headers := &authHeaders{targets: make([]*authCredential, len(targets))}
+	credentials := make(map[*config.AuthConfig]*authCredential)
+	for i, target := range targets {
+		cfg := target.AuthConfig
+		if cfg == nil {
+			cfg = global
+		}
+		if cfg == nil || !cfg.Enabled {
+			continue
+		}
+		if credentials[cfg] == nil {
+			credentials[cfg] = &authCredential{cfg: cfg}
+		}
+		headers.targets[i] = credentials[cfg]
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range credentials {
+		wg.Go(func() { c.resolve(logger) })
+	}
+	wg.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	for _, c := range credentials {
+		go c.refresh(ctx, logger)
+	}
+	return headers, cancel
+}
+
+// resolve fetches the credential, keeping the previous one when the fetch fails
+func (c *authCredential) resolve(logger *slog.Logger) {
+	credential, err := auth.Resolve(c.cfg, logger)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	if err != nil {
+		if c.resolved {
+			logger.Warn("Failed to refresh credential, keeping the previous one", "auth_type", c.cfg.Type, "error", err)
+		}
+		return
+	}
+	c.credential, c.resolved = credential, true
+}
+
+// refresh fetches the credential again until the context is cancelled or it no longer needs refreshing
+func (c *authCredential) refresh(ctx context.Context, logger *slog.Logger) {
+	for {
+		delay := c.refreshDelay(time.Now())
+		if delay == 0 {
+			return
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		logger.Debug("Refreshing credential", "auth_type", c.cfg.Type)
+		c.resolve(logger)
+	}
+}
+
+// refreshDelay returns how long until the credential is fetched again, 0 when it is kept for the rest of the run. A
+// credential with an expiry is refreshed after three quarters of its remaining lifetime
+func (c *authCredential) refreshDelay(now time.Time) time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.err != nil {
+		return authRetryInterval
+	}
+	var delay time.Duration
+	if !c.credential.ExpiresAt.IsZero() {
+		delay = max(c.credential.ExpiresAt.Sub(now)*3/4, time.Second)
+	}
+	if c.cfg.RefreshIntervalMS > 0 {
+		interval := time.Duration(c.cfg.RefreshIntervalMS) * time.Millisecond
+		if delay == 0 || interval < delay {
+			delay = interval
+		}
+	}
+	return delay
+}
+
+// get returns the header and value of the credential, or the error of the fetch when none was fetched yet
+func (c *authCredential) get() (string, string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.resolved {
+		return "", "", c.err
+	}
+	return c.credential.Header, c.credential.Value, nil
+}
+
+// headers returns the headers of a request to the target at index: its configured headers, its credential and the
+// user agent
+func (a *authHeaders) headers(endpoint config.Endpoint, index int) (map[string]string, error) {
+	headers := make(map[string]string, len(endpoint.Headers)+2)
+	maps.Copy(headers, endpoint.Headers)
+	if c := a.targets[index]; c != nil {
+		header, value, err := c.get()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get auth header: %w", err)
+		}
+		if header != "" {
+			headers[header] = value
+		}
+	}
+	headers["User-Agent"] = userAgent
+	return headers, nil
+}
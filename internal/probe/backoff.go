@@ -0,0 +1,141 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// backoff pauses the traffic to the targets that answered with a Retry-After header, and accounts the time each
+// target was paused
+type backoff struct {
+	mu      sync.Mutex
+	maxWait time.Duration
+	targets []targetBackoff
+}
+
+// targetBackoff holds the pause of a single target
+type targetBackoff struct {
+	until  time.Time
+	pauses int
+	paused time.Duration
+}
+
+// newBackoff creates the backoff of the targets, nil when Retry-After headers are not honored
+func newBackoff(retryAfter config.RetryAfterConfig, targets int) *backoff {
+	if !retryAfter.Enabled {
+		return nil
+	}
+	return &backoff{
+		maxWait: time.Duration(retryAfter.MaxWait()) * time.Millisecond,
+		targets: make([]targetBackoff, targets),
+	}
+}
+
+// wait waits until the pause of the target at index is over, it returns false when the context is cancelled first
+func (b *backoff) wait(ctx context.Context, index int) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	until := b.targets[index].until
+	b.mu.Unlock()
+	return sleepContext(ctx, time.Until(until))
+}
+
+// pause pauses the target at index for the wait requested by a response, capped at the longest pause. Overlapping
+// pauses of concurrent responses are only accounted once
+func (b *backoff) pause(index int, wait time.Duration) time.Duration {
+	if b == nil || wait <= 0 {
+		return 0
+	}
+	wait = min(wait, b.maxWait)
+	now := time.Now()
+	until := now.Add(wait)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := &b.targets[index]
+	if !until.After(t.until) {
+		return wait
+	}
+	t.pauses++
+	t.paused += until.Sub(later(now, t.until))
+	t.until = until
+	return wait
+}
+
+// report returns the pauses of the target at index for the run report, nil when it was never paused. Pauses are
+// only accounted up to the end of the run
+func (b *backoff) report(index int, end time.Time, duration time.Duration) *report.Backoff {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.targets[index]
+	if t.pauses == 0 {
+		return nil
+	}
+	paused := t.paused
+	if t.until.After(end) {
+		paused -= t.until.Sub(end)
+	}
+	paused = max(paused, 0)
+	r := &report.Backoff{Pauses: t.pauses, PausedMS: float64(paused) / float64(time.Millisecond)}
+	if duration > 0 {
+		r.PausedShare = float64(paused) / float64(duration)
+	}
+	return r
+}
+
+// later returns the later of two times
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// retryAfter returns the wait requested by a 429 or 503 response in its Retry-After header, as seconds or as an HTTP
+// date. It returns 0 for other responses and missing or invalid headers
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// logBackoffReport logs how often and how long each endpoint was paused for Retry-After headers
+func logBackoffReport(b *backoff, stats []*endpointStat, end time.Time, duration time.Duration, logger *slog.Logger) {
+	for i, s := range stats {
+		r := b.report(i, end, duration)
+		if r == nil {
+			continue
+		}
+		logger.Warn("Backoff report",
+			"method", s.endpoint.Method,
+			"url", s.endpoint.URL,
+			"pauses", r.Pauses,
+			"paused", time.Duration(r.PausedMS*float64(time.Millisecond)),
+			"paused_share", fmt.Sprintf("%.2f", r.PausedShare))
+	}
+}
@@ -0,0 +1,212 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// inFlightCap caps the in-flight requests across all workers and endpoints. With backpressure, a 429 or 503 response
+// multiplies the cap with the decrease factor, at most once per window of cap requests, and every other response
+// grows it by 1/cap up to max_in_flight. Honoring Retry-After holds all new requests for the requested wait
+type inFlightCap struct {
+	mu       sync.Mutex
+	limit    float64
+	minLimit float64
+	maxLimit float64
+	factor   float64
+	inFlight int
+	// changed is closed and replaced whenever a slot is released, waking up the waiting workers
+	changed      chan struct{}
+	backpressure bool
+	// sinceDecrease counts the requests since the last decrease
+	sinceDecrease int
+	// pausedUntil is the end of the Retry-After wait of the latest throttled response, maxWait caps the wait
+	honorRetryAfter bool
+	maxWait         time.Duration
+	pausedUntil     time.Time
+	paused          time.Duration
+	lowest          int
+	throttled       int
+	decreases       int
+	logger          *slog.Logger
+}
+
+// newInFlightCap creates the cap of max_in_flight, or of the number of workers when only backpressure is enabled.
+// It returns nil without a cap
+func newInFlightCap(probing config.ProbingConfig, workers int, logger *slog.Logger) *inFlightCap {
+	if probing.MaxInFlight == 0 && !probing.Backpressure.Enabled {
+		return nil
+	}
+	limit := probing.MaxInFlight
+	if limit == 0 {
+		limit = workers
+	}
+	c := &inFlightCap{
+		limit:    float64(limit),
+		minLimit: float64(limit),
+		maxLimit: float64(limit),
+		changed:  make(chan struct{}),
+		lowest:   limit,
+		logger:   logger,
+	}
+	if bp := probing.Backpressure; bp.Enabled {
+		c.backpressure = true
+		c.minLimit = float64(min(bp.MinLimit(), limit))
+		c.factor = bp.Factor()
+		c.honorRetryAfter = bp.HonorRetryAfter
+		c.maxWait = time.Duration(probing.RetryAfter.MaxWait()) * time.Millisecond
+	}
+	return c
+}
+
+// acquire waits until the number of in-flight requests is below the cap and no Retry-After wait is pending, it
+// returns false when the context is cancelled first
+func (c *inFlightCap) acquire(ctx context.Context) bool {
+	if c == nil {
+		return true
+	}
+	for {
+		c.mu.Lock()
+		wait := time.Until(c.pausedUntil)
+		if wait <= 0 && c.inFlight < int(c.limit) {
+			c.inFlight++
+			c.mu.Unlock()
+			return true
+		}
+		changed := c.changed
+		c.mu.Unlock()
+
+		if !waitForChange(ctx, changed, wait) {
+			return false
+		}
+	}
+}
+
+// waitForChange waits until changed is closed, or for the wait when it is positive. It returns false when the
+// context is cancelled first
+func waitForChange(ctx context.Context, changed <-chan struct{}, wait time.Duration) bool {
+	var timeout <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-changed:
+	case <-timeout:
+	}
+	return true
+}
+
+// notify wakes up the waiting workers, the caller holds the lock
+func (c *inFlightCap) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// release frees the slot of a finished request and, with backpressure, adjusts the cap to whether the target
+// throttled it and the wait it requested
+func (c *inFlightCap) release(throttled bool, retryAfter time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	defer c.notify()
+	if !c.backpressure {
+		return
+	}
+
+	current := int(c.limit)
+	c.sinceDecrease++
+	if throttled {
+		c.throttled++
+		if c.sinceDecrease >= current && c.limit > c.minLimit {
+			c.limit = max(c.minLimit, c.limit*c.factor)
+			c.sinceDecrease = 0
+			c.decreases++
+		}
+		if c.honorRetryAfter && retryAfter > 0 {
+			now := time.Now()
+			if until := now.Add(min(retryAfter, c.maxWait)); until.After(c.pausedUntil) {
+				c.paused += until.Sub(later(now, c.pausedUntil))
+				c.pausedUntil = until
+			}
+		}
+	} else {
+		c.limit = min(c.maxLimit, c.limit+1/c.limit)
+	}
+
+	if next := int(c.limit); next != current {
+		c.lowest = min(c.lowest, next)
+		c.logger.Debug("Backpressure changed the in-flight cap", "from", current, "to", next)
+	}
+}
+
+// abandon frees a slot without a request being made, e.g. on cancellation
+func (c *inFlightCap) abandon() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	c.notify()
+}
+
+// throttling reports whether the request was throttled with a 429 or 503 response, along with the wait requested by
+// its Retry-After header
+func throttling(err error) (bool, time.Duration) {
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) {
+		return false, 0
+	}
+	throttled := statusErr.code == http.StatusTooManyRequests || statusErr.code == http.StatusServiceUnavailable
+	return throttled, statusErr.retryAfter
+}
+
+// report returns the adjustments of the cap for the run report, nil without backpressure. Waits are only accounted
+// up to the end of the run
+func (c *inFlightCap) report(end time.Time) *report.Backpressure {
+	if c == nil || !c.backpressure {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	paused := c.paused
+	if c.pausedUntil.After(end) {
+		paused -= c.pausedUntil.Sub(end)
+	}
+	return &report.Backpressure{
+		MaxInFlight:        int(c.maxLimit),
+		FinalInFlight:      int(c.limit),
+		MinInFlight:        c.lowest,
+		ThrottledResponses: c.throttled,
+		Decreases:          c.decreases,
+		PausedMS:           float64(max(paused, 0)) / float64(time.Millisecond),
+	}
+}
+
+// logBackpressureReport logs how the target throttled the run and how far the cap was lowered
+func logBackpressureReport(r *report.Backpressure, logger *slog.Logger) {
+	if r == nil {
+		return
+	}
+	args := []any{"throttled_responses", r.ThrottledResponses, "max_in_flight", r.MaxInFlight,
+		"min_in_flight", r.MinInFlight, "final_in_flight", r.FinalInFlight, "decreases", r.Decreases, "paused_ms", r.PausedMS}
+	if r.ThrottledResponses > 0 {
+		logger.Warn("Target throttled the run, backpressure lowered the in-flight cap", args...)
+		return
+	}
+	logger.Info("Backpressure report", args...)
+}
@@ -0,0 +1,218 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// limiterChunkSize is the largest write passed to the connection at once when the bandwidth is limited
+const limiterChunkSize = 16 * 1024
+
+// trafficCounter counts the bytes sent and received over all connections of a run
+type trafficCounter struct {
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+// bandwidthLimiter is a token bucket limiting the bytes sent per second over all connections of a run
+type bandwidthLimiter struct {
+	mu sync.Mutex
+	// rate is the number of bytes per second
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newBandwidthLimiter creates a limiter for the given rate in kilobits per second
+func newBandwidthLimiter(kbps int) *bandwidthLimiter {
+	rate := float64(kbps) * 1000 / 8
+	return &bandwidthLimiter{
+		rate:   rate,
+		burst:  max(rate/10, limiterChunkSize),
+		tokens: max(rate/10, limiterChunkSize),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes n bytes from the bucket and returns how long to wait before they may be sent
+func (l *bandwidthLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// meteredConn counts the traffic of a connection and limits the bandwidth of its writes. A write waiting for the
+// limiter ends when the connection is closed, which the transport does when the request is cancelled, or at its
+// write deadline
+type meteredConn struct {
+	net.Conn
+	traffic *trafficCounter
+	limiter *bandwidthLimiter
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	// writeDeadline is the write deadline of the connection, nil without one
+	writeDeadline atomic.Pointer[time.Time]
+}
+
+// newMeteredConn wraps conn with traffic counting and, with a limiter, bandwidth limiting
+func newMeteredConn(conn net.Conn, traffic *trafficCounter, limiter *bandwidthLimiter) *meteredConn {
+	return &meteredConn{Conn: conn, traffic: traffic, limiter: limiter, closed: make(chan struct{})}
+}
+
+func (c *meteredConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.traffic.received.Add(int64(n))
+	return n, err
+}
+
+func (c *meteredConn) Write(p []byte) (int, error) {
+	if c.limiter == nil {
+		n, err := c.Conn.Write(p)
+		c.traffic.sent.Add(int64(n))
+		return n, err
+	}
+
+	written := 0
+	for written < len(p) {
+		chunk := min(len(p)-written, limiterChunkSize)
+		if err := c.wait(c.limiter.reserve(chunk)); err != nil {
+			return written, err
+		}
+		n, err := c.Conn.Write(p[written : written+chunk])
+		written += n
+		c.traffic.sent.Add(int64(n))
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// wait waits d before a write, it returns net.ErrClosed when the connection is closed and os.ErrDeadlineExceeded
+// when the write deadline passes first
+func (c *meteredConn) wait(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	var expired <-chan time.Time
+	if deadline := c.writeDeadline.Load(); deadline != nil {
+		if time.Until(*deadline) < d {
+			timer := time.NewTimer(time.Until(*deadline))
+			defer timer.Stop()
+			expired = timer.C
+		}
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-expired:
+		return os.ErrDeadlineExceeded
+	case <-c.closed:
+		return net.ErrClosed
+	}
+}
+
+// Close closes the connection and ends the writes waiting for the limiter
+func (c *meteredConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// SetDeadline sets the read and write deadlines, the write deadline also ends the wait for the limiter
+func (c *meteredConn) SetDeadline(t time.Time) error {
+	c.setWriteDeadline(t)
+	return c.Conn.SetDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline, which also ends the wait for the limiter
+func (c *meteredConn) SetWriteDeadline(t time.Time) error {
+	c.setWriteDeadline(t)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// setWriteDeadline records the write deadline, the zero time removes it
+func (c *meteredConn) setWriteDeadline(t time.Time) {
+	if t.IsZero() {
+		c.writeDeadline.Store(nil)
+		return
+	}
+	c.writeDeadline.Store(&t)
+}
+
+// meteredDialer wraps the connections of the dial function with traffic counting and bandwidth limiting
+func meteredDialer(dial dialFunc, traffic *trafficCounter, limiter *bandwidthLimiter) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return newMeteredConn(conn, traffic, limiter), nil
+	}
+}
+
+// report returns the traffic of a run that took the given duration
+func (t *trafficCounter) report(limitKbps int, duration time.Duration) report.Traffic {
+	return report.Traffic{
+		BytesSent:     t.sent.Load(),
+		BytesReceived: t.received.Load(),
+		EgressKbps:    kbps(t.sent.Load(), duration),
+		IngressKbps:   kbps(t.received.Load(), duration),
+		LimitKbps:     limitKbps,
+		EgressMBps:    mbps(t.sent.Load(), duration),
+		IngressMBps:   mbps(t.received.Load(), duration),
+	}
+}
+
+// kbps returns the throughput in kilobits per second
+func kbps(bytes int64, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	return float64(bytes) * 8 / 1000 / duration.Seconds()
+}
+
+// mbps returns the throughput in megabytes per second
+func mbps(bytes int64, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	return float64(bytes) / 1e6 / duration.Seconds()
+}
+
+// logBandwidthReport logs the actual throughput of a run next to the configured limit
+func logBandwidthReport(traffic *trafficCounter, limitKbps int, duration time.Duration, logger *slog.Logger) {
+	t := traffic.report(limitKbps, duration)
+	attrs := []any{
+		"bytes_sent", t.BytesSent,
+		"bytes_received", t.BytesReceived,
+		"egress_kbps", fmt.Sprintf("%.1f", t.EgressKbps),
+		"ingress_kbps", fmt.Sprintf("%.1f", t.IngressKbps),
+		"egress_mbps", fmt.Sprintf("%.2f", t.EgressMBps),
+		"ingress_mbps", fmt.Sprintf("%.2f", t.IngressMBps),
+	}
+	if limitKbps > 0 {
+		attrs = append(attrs, "limit_kbps", limitKbps)
+	}
+	logger.Info("Bandwidth report", attrs...)
+}
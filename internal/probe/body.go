@@ -0,0 +1,222 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// patternReader yields a pattern repeatedly until size bytes have been read
+type patternReader struct {
+	pattern   []byte
+	offset    int
+	remaining int64
+}
+
+// newPatternReader creates a reader of size bytes repeating the pattern
+func newPatternReader(pattern []byte, size int64) *patternReader {
+	return &patternReader{pattern: pattern, remaining: size}
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	n := 0
+	for n < len(p) {
+		copied := copy(p[n:], r.pattern[r.offset:])
+		n += copied
+		r.offset = (r.offset + copied) % len(r.pattern)
+	}
+	r.remaining -= int64(n)
+	return n, nil
+}
+
+// setGeneratedBody streams the generated body into the request, setting the Content-Length up front
+func setGeneratedBody(req *http.Request, generator config.BodyGenerator) {
+	pattern := generator.PatternBytes()
+	size := generator.Size()
+
+	req.ContentLength = size
+	req.Body = io.NopCloser(newPatternReader(pattern, size))
+	// allows the transport to replay the body, e.g. on redirects
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(newPatternReader(pattern, size)), nil
+	}
+}
+
+// setBody streams the generated body, the body file, the multipart form or the decoded binary body of the endpoint
+// into the request and declares its content encoding
+func setBody(req *http.Request, endpoint config.Endpoint) error {
+	if endpoint.ContentEncoding != "" {
+		req.Header.Set("Content-Encoding", endpoint.ContentEncoding)
+	}
+	switch {
+	case endpoint.BodyGenerator != nil:
+		setGeneratedBody(req, *endpoint.BodyGenerator)
+	case endpoint.BodyFile != "":
+		return setFileBody(req, endpoint.BodyFile)
+	case endpoint.Multipart != nil:
+		return setMultipartBody(req, *endpoint.Multipart)
+	case endpoint.BodyBase64 != "":
+		return setBase64Body(req, endpoint.BodyBase64)
+	}
+	return nil
+}
+
+// setBase64Body sends the decoded bytes of a base64 body, so binary payloads are sent unchanged
+func setBase64Body(req *http.Request, encoded string) error {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid body_base64: %w", err)
+	}
+	req.ContentLength = int64(len(data))
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil
+}
+
+// setFileBody streams the file into the request, the file is opened for every request so it can change between runs
+// without being held in memory
+func setFileBody(req *http.Request, path string) error {
+	open := func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read body file: %w", err)
+	}
+	body, err := open()
+	if err != nil {
+		return fmt.Errorf("failed to read body file: %w", err)
+	}
+
+	req.ContentLength = info.Size()
+	req.Body = body
+	req.GetBody = open
+	return nil
+}
+
+// setMultipartBody streams the multipart form into the request with its Content-Type and Content-Length
+func setMultipartBody(req *http.Request, form config.Multipart) error {
+	body, contentType, size, err := newMultipartBody(form, "")
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Body = body
+	req.Header.Set("Content-Type", contentType)
+	req.GetBody = func() (io.ReadCloser, error) {
+		body, _, _, err := newMultipartBody(form, multipartBoundary(contentType))
+		return body, err
+	}
+	return nil
+}
+
+// multipartBody is a multipart form read from the encoded headers and fields and the uploaded files in turn
+type multipartBody struct {
+	io.Reader
+	files []*os.File
+}
+
+// Close closes the uploaded files
+func (b *multipartBody) Close() error {
+	var errs []error
+	for _, f := range b.files {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// newMultipartBody encodes the form fields and the part headers up front and streams the files between them, so the
+// size of the body is known without reading the files. A random boundary is used when boundary is empty
+func newMultipartBody(form config.Multipart, boundary string) (*multipartBody, string, int64, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if boundary != "" {
+		if err := w.SetBoundary(boundary); err != nil {
+			return nil, "", 0, err
+		}
+	}
+
+	body := &multipartBody{}
+	var readers []io.Reader
+	var size int64
+	for _, name := range slices.Sorted(maps.Keys(form.Fields)) {
+		if err := w.WriteField(name, form.Fields[name]); err != nil {
+			return nil, "", 0, err
+		}
+	}
+	for _, file := range form.Files {
+		f, err := os.Open(file.Path)
+		if err != nil {
+			body.Close()
+			return nil, "", 0, fmt.Errorf("failed to read multipart file: %w", err)
+		}
+		body.files = append(body.files, f)
+		info, err := f.Stat()
+		if err != nil {
+			body.Close()
+			return nil, "", 0, fmt.Errorf("failed to read multipart file: %w", err)
+		}
+
+		if _, err := w.CreatePart(multipartFileHeader(file)); err != nil {
+			body.Close()
+			return nil, "", 0, err
+		}
+		// the encoded part header precedes the file content
+		header := bytes.Clone(buf.Bytes())
+		buf.Reset()
+		readers = append(readers, bytes.NewReader(header), f)
+		size += int64(len(header)) + info.Size()
+	}
+	if err := w.Close(); err != nil {
+		body.Close()
+		return nil, "", 0, err
+	}
+	readers = append(readers, bytes.NewReader(buf.Bytes()))
+	size += int64(buf.Len())
+
+	body.Reader = io.MultiReader(readers...)
+	return body, w.FormDataContentType(), size, nil
+}
+
+// multipartFileHeader returns the part header of an uploaded file
+func multipartFileHeader(file config.MultipartFile) textproto.MIMEHeader {
+	filename := file.Filename
+	if filename == "" {
+		filename = filepath.Base(file.Path)
+	}
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": file.Field, "filename": filename}))
+	header.Set("Content-Type", contentType)
+	return header
+}
+
+// multipartBoundary returns the boundary of a multipart Content-Type
+func multipartBoundary(contentType string) string {
+	_, params, _ := mime.ParseMediaType(contentType)
+	return params["boundary"]
+}
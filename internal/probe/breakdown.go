@@ -0,0 +1,103 @@
+package probe
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// maxBreakdownValues limits the distinct values recorded per header, so a header with a value per request like a
+// request ID cannot grow the report without bound. Further values are recorded as breakdownOther
+const maxBreakdownValues = 20
+
+// values recorded for a response without the header, and for the values above maxBreakdownValues
+const (
+	breakdownMissing = "(missing)"
+	breakdownOther   = "(other)"
+)
+
+// headerBreakdown holds the response times of the successful requests of an endpoint per header and value
+type headerBreakdown map[string]map[string]*report.Histogram
+
+// setBreakdownHeaders sets the breakdown headers on the stats of every target, in their canonical form
+func setBreakdownHeaders(stats []*endpointStat, headers []string) {
+	if len(headers) == 0 {
+		return
+	}
+	canonical := make([]string, len(headers))
+	for i, header := range headers {
+		canonical[i] = http.CanonicalHeaderKey(header)
+	}
+	for _, s := range stats {
+		s.breakdownHeaders = canonical
+		s.breakdown = make(headerBreakdown)
+	}
+}
+
+// record adds the response time of a successful request to the values of its breakdown headers
+func (b headerBreakdown) record(headers []string, sample sample) {
+	for _, header := range headers {
+		value := sample.header.Get(header)
+		if value == "" {
+			value = breakdownMissing
+		}
+		values := b[header]
+		if values == nil {
+			values = make(map[string]*report.Histogram)
+			b[header] = values
+		}
+		h := values[value]
+		if h == nil {
+			if len(values) >= maxBreakdownValues {
+				value = breakdownOther
+				h = values[value]
+			}
+			if h == nil {
+				h = &report.Histogram{}
+				values[value] = h
+			}
+		}
+		h.Record(sample.duration)
+	}
+}
+
+// report returns the response times per header and value, nil without breakdown headers
+func (b headerBreakdown) report() map[string]map[string]report.HeaderValue {
+	if len(b) == 0 {
+		return nil
+	}
+	r := make(map[string]map[string]report.HeaderValue, len(b))
+	for header, values := range b {
+		r[header] = make(map[string]report.HeaderValue, len(values))
+		for value, h := range values {
+			r[header][value] = report.HeaderValue{Requests: h.Count(), Latency: h.Latency()}
+		}
+	}
+	return r
+}
+
+// logHeaderBreakdownReport logs the response times of each endpoint per value of the breakdown headers, revealing
+// differences between e.g. cache hits and misses or the backends serving the requests
+func logHeaderBreakdownReport(stats []*endpointStat, logger *slog.Logger) {
+	for _, s := range stats {
+		for _, header := range slices.Sorted(maps.Keys(s.breakdown)) {
+			values := s.breakdown[header]
+			for _, value := range slices.Sorted(maps.Keys(values)) {
+				h := values[value]
+				logger.Info("Header breakdown",
+					"method", s.endpoint.Method,
+					"url", s.endpoint.URL,
+					"header", header,
+					"value", value,
+					"requests", h.Count(),
+					"avg_response_time", h.Mean(),
+					"p95_response_time", h.Percentile(95),
+					"share", fmt.Sprintf("%.1f%%", float64(h.Count())/float64(s.successes)*100))
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// variablesKey is the context key for the variables of an iteration or virtual user
+type variablesKey struct{}
+
+// withVariables stores the variables of an iteration or virtual user in the context, values captured with the vu
+// scope are stored in them as well
+func withVariables(ctx context.Context, vars map[string]string) context.Context {
+	return context.WithValue(ctx, variablesKey{}, vars)
+}
+
+// variablesFromContext returns the variables stored in the context, nil when there are none
+func variablesFromContext(ctx context.Context) map[string]string {
+	vars, _ := ctx.Value(variablesKey{}).(map[string]string)
+	return vars
+}
+
+// runVariables holds the values captured with the run scope, shared by all workers and virtual users
+type runVariables struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+// newRunVariables creates an empty set of run variables
+func newRunVariables() *runVariables {
+	return &runVariables{values: make(map[string]string)}
+}
+
+// set stores the value of a run variable
+func (v *runVariables) set(name, value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[name] = value
+}
+
+// with returns the run variables together with the local variables, the local variables take precedence
+func (v *runVariables) with(local map[string]string) map[string]string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if len(v.values) == 0 {
+		return local
+	}
+	merged := maps.Clone(v.values)
+	maps.Copy(merged, local)
+	return merged
+}
+
+// captureVariables stores the values captured from the response in the run or local variables
+func captureVariables(captures []config.Capture, capture *responseCapture, local map[string]string, run *runVariables) error {
+	for _, c := range captures {
+		value, err := extractValue(c.Extraction, capture)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrExtraction, c.Name, err)
+		}
+		if c.Scope == config.CaptureScopeVU {
+			local[c.Name] = value
+		} else {
+			run.set(c.Name, value)
+		}
+	}
+	return nil
+}
+
+// expandEndpoint returns the endpoint with the variables substituted in its URL, body, headers and query parameters
+func expandEndpoint(endpoint config.Endpoint, vars map[string]string) (config.Endpoint, error) {
+	var err error
+	if endpoint.URL, err = config.ExpandVariables(endpoint.URL, vars); err != nil {
+		return endpoint, err
+	}
+	if endpoint.Body, err = config.ExpandVariables(endpoint.Body, vars); err != nil {
+		return endpoint, err
+	}
+	if len(endpoint.Headers) > 0 {
+		endpoint.Headers = maps.Clone(endpoint.Headers)
+		for key, value := range endpoint.Headers {
+			if endpoint.Headers[key], err = config.ExpandVariables(value, vars); err != nil {
+				return endpoint, err
+			}
+		}
+	}
+	if len(endpoint.QueryParams) > 0 {
+		endpoint.QueryParams = maps.Clone(endpoint.QueryParams)
+		for key, value := range endpoint.QueryParams {
+			if endpoint.QueryParams[key], err = config.ExpandVariables(value, vars); err != nil {
+				return endpoint, err
+			}
+		}
+	}
+	return endpoint, nil
+}
@@ -0,0 +1,205 @@
+package probe
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/dasvh/enchante/internal/metrics"
+)
+
+// resultBufferPerWorker is the capacity of the results channel per worker. Workers block when the collector falls
+// behind, so memory does not grow with the number of requests
+const resultBufferPerWorker = 4
+
+// resultRecord represents the outcome of a single request, as streamed to subscribers and written to the samples file
+type resultRecord struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Scenario   string    `json:"scenario,omitempty"`
+	Step       string    `json:"step,omitempty"`
+	Worker     int       `json:"worker"`
+	DurationMS float64   `json:"duration_ms"`
+	Success    bool      `json:"success"`
+	Skipped    bool      `json:"skipped,omitempty"`
+	Shed       bool      `json:"shed,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	// ErrorCategory is the category of the error in the error taxonomy, e.g. timeout or status_5xx
+	ErrorCategory string `json:"error_category,omitempty"`
+	// BytesSent and BytesReceived are the sizes of the request body and of the response body on the wire
+	BytesSent     int64 `json:"bytes_sent,omitempty"`
+	BytesReceived int64 `json:"bytes_received,omitempty"`
+	// Status is the status code of the response, 0 when no response was received
+	Status int `json:"status,omitempty"`
+	// RunID is the ID of the run, set on the records of the result stream whose subscriptions may outlive a run
+	RunID string `json:"run_id,omitempty"`
+}
+
+// newResultRecord creates the record of a result for the target of the given stats
+func newResultRecord(stat *endpointStat, r result, now time.Time) resultRecord {
+	record := resultRecord{
+		Time:       now,
+		Method:     stat.endpoint.Method,
+		URL:        stat.endpoint.URL,
+		Scenario:   stat.scenario,
+		Step:       stat.step,
+		Worker:     r.worker,
+		DurationMS: float64(r.sample.duration) / float64(time.Millisecond),
+		Success:    r.err == nil,
+		Skipped:    errors.Is(r.err, ErrStepSkipped),
+		Shed:       errors.Is(r.err, ErrRequestShed),
+	}
+	record.Status = r.sample.status
+	record.BytesSent = r.sample.sentBytes
+	record.BytesReceived = r.sample.wireBytes
+	if r.err != nil {
+		record.Error = r.err.Error()
+		if !notSent(r.err) {
+			record.ErrorCategory = classifyError(r.err)
+		}
+	}
+	return record
+}
+
+// recordWriter writes records as lines of JSON for offline analysis, e.g. the raw result of every request
+type recordWriter struct {
+	// name names the file in errors, e.g. samples file
+	name    string
+	file    *os.File
+	buf     *bufio.Writer
+	encoder *json.Encoder
+	err     error
+}
+
+// newRecordWriter creates the file named name in errors, it returns nil without a filename
+func newRecordWriter(filename, name string) (*recordWriter, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s: %w", name, err)
+	}
+	buf := bufio.NewWriter(f)
+	return &recordWriter{name: name, file: f, buf: buf, encoder: json.NewEncoder(buf)}, nil
+}
+
+// write appends a record, after the first error the remaining records are discarded
+func (w *recordWriter) write(record any) {
+	if w.err == nil {
+		w.err = w.encoder.Encode(record)
+	}
+}
+
+// close flushes and closes the file, it returns the first error of the writes
+func (w *recordWriter) close() error {
+	if err := w.buf.Flush(); w.err == nil {
+		w.err = err
+	}
+	if err := w.file.Close(); w.err == nil {
+		w.err = err
+	}
+	if w.err != nil {
+		return fmt.Errorf("error writing %s: %w", w.name, w.err)
+	}
+	return nil
+}
+
+// collector aggregates the results of a run in a dedicated goroutine, reading them from a bounded channel
+type collector struct {
+	results  chan result
+	done     chan struct{}
+	stats    []*endpointStat
+	progress *progressTracker
+	stream   *runStream
+	samples  *recordWriter
+	audit    *recordWriter
+	metrics  metrics.Sink
+	journeys *journeyTracker
+	// successes counts the successful requests, it may only be read after finish
+	successes int
+}
+
+// startCollector starts collecting the results sent by the given number of workers
+func startCollector(workers int, stats []*endpointStat, journeys *journeyTracker, progress *progressTracker, stream *runStream, samples, audit *recordWriter, sink metrics.Sink) *collector {
+	c := &collector{
+		results:  make(chan result, max(workers, 1)*resultBufferPerWorker),
+		done:     make(chan struct{}),
+		stats:    stats,
+		progress: progress,
+		stream:   stream,
+		samples:  samples,
+		audit:    audit,
+		metrics:  sink,
+		journeys: journeys,
+	}
+	go c.run()
+	return c
+}
+
+// run aggregates the results until the results channel is closed
+func (c *collector) run() {
+	defer close(c.done)
+	for r := range c.results {
+		if c.stream != nil || c.samples != nil || c.audit != nil || c.metrics != nil {
+			record := newResultRecord(c.stats[r.endpoint], r, time.Now())
+			if c.stream != nil {
+				c.stream.send(record)
+			}
+			if c.samples != nil {
+				c.samples.write(record)
+			}
+			if c.audit != nil {
+				c.audit.write(auditRecord{resultRecord: record, auditDetail: r.audit})
+			}
+			if c.metrics != nil && !record.Skipped && !record.Shed {
+				c.metrics.Record(record.metricsRequest(r.sample.duration))
+			}
+		}
+		c.journeys.record(r)
+
+		if errors.Is(r.err, ErrStepSkipped) {
+			c.progress.record(false)
+			c.stats[r.endpoint].skipped++
+			continue
+		}
+		if errors.Is(r.err, ErrRequestShed) {
+			c.progress.record(false)
+			c.stats[r.endpoint].shed++
+			continue
+		}
+		c.progress.record(r.err != nil)
+		if r.err != nil {
+			c.stats[r.endpoint].recordFailure(r.sample, r.err)
+			continue
+		}
+		c.successes++
+		c.stats[r.endpoint].record(r.sample)
+	}
+}
+
+// finish closes the results channel once all workers are done and waits for the remaining results to be collected
+func (c *collector) finish(logger *slog.Logger) {
+	close(c.results)
+	<-c.done
+	if c.samples != nil {
+		if err := c.samples.close(); err != nil {
+			logger.Error("Failed to write samples", "error", err)
+		}
+	}
+	if c.audit != nil {
+		if err := c.audit.close(); err != nil {
+			logger.Error("Failed to write audit", "error", err)
+		}
+	}
+	if c.metrics != nil {
+		if err := c.metrics.Close(); err != nil {
+			logger.Error("Failed to emit metrics", "error", err)
+		}
+	}
+}
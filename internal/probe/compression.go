@@ -0,0 +1,202 @@
+package probe
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// acceptEncoding is sent with every request unless the endpoint sets its own Accept-Encoding header
+const acceptEncoding = "gzip, deflate, br"
+
+// ErrContentEncoding is returned when a response is not served with the content encoding the endpoint expects
+var ErrContentEncoding = errors.New("unexpected content encoding")
+
+// countingReader counts the bytes read from the underlying reader and the time spent waiting for them
+type countingReader struct {
+	r       io.Reader
+	n       int64
+	elapsed time.Duration
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := c.r.Read(p)
+	c.elapsed += time.Since(start)
+	c.n += int64(n)
+	return n, err
+}
+
+// responseBody describes a response body that was read
+type responseBody struct {
+	// encoding is the content encoding, empty when the body was served uncompressed
+	encoding string
+	// wire is the number of bytes on the wire, decoded the number of bytes after decoding, -1 when the encoding is
+	// not supported
+	wire    int64
+	decoded int64
+	// decompress is the time spent decoding the body, without the time spent waiting for it on the network
+	decompress time.Duration
+}
+
+// readBody reads the response body into dst, decoding it when it was served compressed
+func readBody(resp *http.Response, dst io.Writer) (responseBody, error) {
+	wireReader := &countingReader{r: resp.Body}
+	body := responseBody{encoding: strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))}
+
+	var decoder io.Reader
+	switch body.encoding {
+	case "", "identity":
+		body.encoding = ""
+		decoder = wireReader
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(wireReader)
+		if errors.Is(err, io.EOF) {
+			// compressed content encoding without a body, e.g. for HEAD requests
+			return body, nil
+		}
+		if err != nil {
+			body.wire, body.decoded = wireReader.n, -1
+			return body, fmt.Errorf("failed to decode gzip response: %w", err)
+		}
+		defer gz.Close()
+		decoder = gz
+	case "deflate":
+		fl, err := newDeflateReader(wireReader)
+		if errors.Is(err, io.EOF) {
+			return body, nil
+		}
+		if err != nil {
+			body.wire, body.decoded = wireReader.n, -1
+			return body, fmt.Errorf("failed to decode deflate response: %w", err)
+		}
+		defer fl.Close()
+		decoder = fl
+	case "br":
+		br := bufio.NewReader(wireReader)
+		if _, err := br.Peek(1); errors.Is(err, io.EOF) {
+			return body, nil
+		}
+		decoder = brotli.NewReader(br)
+	default:
+		// unsupported encoding, e.g. zstd, only the bytes on the wire can be counted
+		n, err := io.Copy(io.Discard, wireReader)
+		body.wire, body.decoded = n, -1
+		return body, err
+	}
+
+	start, waited := time.Now(), wireReader.elapsed
+	decoded, err := io.Copy(dst, decoder)
+	body.wire, body.decoded = wireReader.n, decoded
+	if body.encoding != "" {
+		body.decompress = max(time.Since(start)-(wireReader.elapsed-waited), 0)
+	}
+	return body, err
+}
+
+// newDeflateReader returns a reader for a deflate encoded body. Servers send either zlib wrapped (as specified)
+// or raw deflate data, so the zlib header is checked before choosing the decoder
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// checkEncoding returns ErrContentEncoding when the response was not served with the expected content encoding,
+// identity expects an uncompressed response
+func checkEncoding(expected string, resp *http.Response) error {
+	if expected == "" {
+		return nil
+	}
+	served := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch served {
+	case "":
+		served = "identity"
+	case "x-gzip":
+		served = "gzip"
+	}
+	if served != expected {
+		return fmt.Errorf("%w: expected %s, got %s", ErrContentEncoding, expected, served)
+	}
+	return nil
+}
+
+// compressedBody counts the compressed bytes of a request body, it is safe for concurrent use as the transport
+// may write the body from its own goroutine
+type compressedBody struct {
+	sent atomic.Int64
+}
+
+// compressBody replaces the request body with its gzip, deflate or brotli compressed form. The body is compressed
+// while it is sent, so large bodies are not held in memory and the request is sent chunked
+func compressBody(req *http.Request, encoding string) *compressedBody {
+	c := &compressedBody{}
+	if req.Body == nil || req.Body == http.NoBody {
+		return c
+	}
+	req.Header.Set("Content-Encoding", encoding)
+	req.ContentLength = -1
+	req.Body = c.compress(req.Body, encoding)
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return c.compress(body, encoding), nil
+		}
+	}
+	return c
+}
+
+// compress returns a reader yielding the compressed contents of src
+func (c *compressedBody) compress(src io.ReadCloser, encoding string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		defer src.Close()
+		var w io.WriteCloser
+		switch encoding {
+		case "deflate":
+			// deflate in HTTP is zlib wrapped
+			w = zlib.NewWriter(pw)
+		case "br":
+			w = brotli.NewWriter(pw)
+		default:
+			w = gzip.NewWriter(pw)
+		}
+		_, err := io.Copy(w, src)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+	}()
+	return &sentCounter{ReadCloser: pr, sent: &c.sent}
+}
+
+// sentCounter counts the bytes read from a request body by the transport
+type sentCounter struct {
+	io.ReadCloser
+	sent *atomic.Int64
+}
+
+func (s *sentCounter) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	s.sent.Add(int64(n))
+	return n, err
+}
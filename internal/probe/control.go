@@ -0,0 +1,445 @@
+package probe
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// controlShutdownTimeout limits how long the control API waits for its requests to finish after the run
+const controlShutdownTimeout = 5 * time.Second
+
+// errStopped is the cause of a run stopped through the control API
+var errStopped = errors.New("run stopped through the control API")
+
+// errTooManyWorkers is returned when the control API sets more workers than max_workers
+var errTooManyWorkers = errors.New("too many workers")
+
+// controlStats represents the live state of a run returned by the control API
+type controlStats struct {
+	progressUpdate
+	Paused   bool    `json:"paused"`
+	PausedMS float64 `json:"paused_ms"`
+	// RPSLimit is the maximum rate requests are started at, 0 without limit
+	RPSLimit float64 `json:"rps_limit"`
+	// Workers is the number of workers sharing the job queue, 0 with virtual users
+	Workers  int  `json:"workers,omitempty"`
+	Stopping bool `json:"stopping"`
+}
+
+// controller holds the state of a run steered through the control API or signals: a pause holding the requests
+// before they are sent, a limit on the rate requests are started at, the number of workers and the stop of the run.
+// It is safe for concurrent use
+type controller struct {
+	// limited is set while the load is paused or rate limited, so requests pass without locking otherwise
+	limited atomic.Bool
+	mu      sync.Mutex
+	// resumed is closed while the load runs, and replaced by an open channel when it is paused
+	resumed  chan struct{}
+	pausedAt time.Time
+	paused   time.Duration
+	// interval is the time between the starts of two requests, 0 without rate limit
+	interval time.Duration
+	next     time.Time
+	// pool runs the workers sharing the job queue, nil with virtual users
+	pool *workerPool
+	// maxWorkers is the largest number of workers of the pool the control API can set
+	maxWorkers int
+	stop       context.CancelCauseFunc
+	stopping   bool
+	// previous and previousCompleted are the time and completed requests of the previous stats, to measure the rate
+	progress          *progressTracker
+	previous          time.Time
+	previousCompleted int64
+}
+
+// newController creates a controller of a running run, stop ends the run
+func newController(progress *progressTracker, stop context.CancelCauseFunc) *controller {
+	resumed := make(chan struct{})
+	close(resumed)
+	return &controller{resumed: resumed, stop: stop, progress: progress, previous: progress.startedAt}
+}
+
+// wait waits while the load is paused and for the next start allowed by the rate limit, it returns false when the
+// context is cancelled first
+func (c *controller) wait(ctx context.Context) bool {
+	if c == nil || !c.limited.Load() {
+		return true
+	}
+	c.mu.Lock()
+	resumed := c.resumed
+	c.mu.Unlock()
+	select {
+	case <-resumed:
+	case <-ctx.Done():
+		return false
+	}
+
+	c.mu.Lock()
+	if c.interval == 0 {
+		c.mu.Unlock()
+		return true
+	}
+	now := time.Now()
+	if c.next.Before(now) {
+		c.next = now
+	}
+	start := c.next
+	c.next = c.next.Add(c.interval)
+	c.mu.Unlock()
+	return sleepContext(ctx, start.Sub(now))
+}
+
+// pause holds the requests until resume is called, it returns false when the load is already paused
+func (c *controller) pause(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.pausedAt.IsZero() {
+		return false
+	}
+	c.pausedAt = now
+	c.resumed = make(chan struct{})
+	c.limited.Store(true)
+	return true
+}
+
+// resume lets the held requests through, it returns false when the load is not paused
+func (c *controller) resume(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pausedAt.IsZero() {
+		return false
+	}
+	c.paused += now.Sub(c.pausedAt)
+	c.pausedAt = time.Time{}
+	// the rate limit starts over instead of catching up on the paused time
+	c.next = time.Time{}
+	close(c.resumed)
+	c.limited.Store(c.interval > 0)
+	return true
+}
+
+// setRate limits the rate requests are started at, 0 removes the limit
+func (c *controller) setRate(rps float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interval = 0
+	if rps > 0 {
+		c.interval = time.Duration(float64(time.Second) / rps)
+	}
+	c.next = time.Time{}
+	c.limited.Store(c.interval > 0 || !c.pausedAt.IsZero())
+}
+
+// setPool lets the controller change the number of workers of the pool up to maxWorkers
+func (c *controller) setPool(pool *workerPool, maxWorkers int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pool, c.maxWorkers = pool, maxWorkers
+}
+
+// setWorkers changes the number of workers sharing the job queue
+func (c *controller) setWorkers(n int) error {
+	c.mu.Lock()
+	pool, maxWorkers := c.pool, c.maxWorkers
+	c.mu.Unlock()
+	if pool == nil {
+		return errors.New("the number of virtual users can not be changed")
+	}
+	if n > maxWorkers {
+		return fmt.Errorf("%w: at most %d workers, set by max_workers", errTooManyWorkers, maxWorkers)
+	}
+	if !pool.resize(n) {
+		return errors.New("the workers already finished")
+	}
+	return nil
+}
+
+// end stops scheduling new requests, the in-flight requests drain as at max_duration
+func (c *controller) end() {
+	c.mu.Lock()
+	c.stopping = true
+	c.mu.Unlock()
+	c.stop(errStopped)
+}
+
+// stats returns the live state of the run at now
+func (c *controller) stats(now time.Time) controlStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := controlStats{
+		progressUpdate: c.progress.update(now, c.previous, c.previousCompleted),
+		Paused:         !c.pausedAt.IsZero(),
+		Stopping:       c.stopping,
+	}
+	paused := c.paused
+	if s.Paused {
+		paused += now.Sub(c.pausedAt)
+	}
+	s.PausedMS = float64(paused) / float64(time.Millisecond)
+	if c.interval > 0 {
+		s.RPSLimit = float64(time.Second) / float64(c.interval)
+	}
+	if c.pool != nil {
+		s.Workers = c.pool.size()
+	}
+	c.previous, c.previousCompleted = now, s.CompletedRequests
+	return s
+}
+
+// ControlServer serves the control API. A run started with a context carrying the server through WithControlServer
+// attaches its controller for its duration, so the server can outlive the runs, e.g. those of the daemon. It is safe
+// for concurrent use
+type ControlServer struct {
+	mux     *http.ServeMux
+	handler http.Handler
+	logger  *slog.Logger
+	mu      sync.Mutex
+	// control is the controller of the run in progress, nil between runs
+	control  *controller
+	server   *http.Server
+	listener net.Listener
+}
+
+// controlServerKey is the context key of the control server runs attach to
+type controlServerKey struct{}
+
+// WithControlServer returns a context the runs started with attach to the control server
+func WithControlServer(ctx context.Context, server *ControlServer) context.Context {
+	return context.WithValue(ctx, controlServerKey{}, server)
+}
+
+// controlServerFromContext returns the control server of the context, nil when there is none
+func controlServerFromContext(ctx context.Context) *ControlServer {
+	server, _ := ctx.Value(controlServerKey{}).(*ControlServer)
+	return server
+}
+
+// NewControlServer serves the control API on the configured address until it is closed
+func NewControlServer(cfg config.ControlConfig, logger *slog.Logger) (*ControlServer, error) {
+	// checked again as -control-addr overrides the validated address
+	if err := cfg.CheckToken(); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", cfg.Listen, err)
+	}
+	s := newControlServer(cfg.Token, logger)
+	s.listener = listener
+	s.server = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Warn("Control API stopped", "error", err)
+		}
+	}()
+	return s, nil
+}
+
+// newControlServer creates the handler of the control API, requests must carry the token as a bearer token when it
+// is set
+func newControlServer(token string, logger *slog.Logger) *ControlServer {
+	s := &ControlServer{mux: http.NewServeMux(), logger: logger}
+	s.handleRun("GET /v1/stats", func(c *controller, w http.ResponseWriter, r *http.Request) {
+		writeControlJSON(w, http.StatusOK, c.stats(time.Now()))
+	})
+	s.handleRun("POST /v1/pause", func(c *controller, w http.ResponseWriter, r *http.Request) {
+		if c.pause(time.Now()) {
+			logger.Warn("Run paused through the control API", "remote", r.RemoteAddr)
+		}
+		writeControlJSON(w, http.StatusOK, c.stats(time.Now()))
+	})
+	s.handleRun("POST /v1/resume", func(c *controller, w http.ResponseWriter, r *http.Request) {
+		if c.resume(time.Now()) {
+			logger.Info("Run resumed through the control API", "remote", r.RemoteAddr)
+		}
+		writeControlJSON(w, http.StatusOK, c.stats(time.Now()))
+	})
+	s.handleRun("PUT /v1/rate", func(c *controller, w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			RPS *float64 `json:"rps"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RPS == nil || *body.RPS < 0 {
+			writeControlJSON(w, http.StatusBadRequest, map[string]string{"error": `expected {"rps": <requests per second>}, 0 removes the limit`})
+			return
+		}
+		c.setRate(*body.RPS)
+		logger.Info("Rate limit changed through the control API", "rps", *body.RPS, "remote", r.RemoteAddr)
+		writeControlJSON(w, http.StatusOK, c.stats(time.Now()))
+	})
+	s.handleRun("PUT /v1/workers", func(c *controller, w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Workers int `json:"workers"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Workers < 1 {
+			writeControlJSON(w, http.StatusBadRequest, map[string]string{"error": `expected {"workers": <number of workers>} of at least 1`})
+			return
+		}
+		if err := c.setWorkers(body.Workers); err != nil {
+			status := http.StatusConflict
+			if errors.Is(err, errTooManyWorkers) {
+				status = http.StatusBadRequest
+			}
+			writeControlJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+		logger.Info("Workers changed through the control API", "workers", body.Workers, "remote", r.RemoteAddr)
+		writeControlJSON(w, http.StatusOK, c.stats(time.Now()))
+	})
+	s.handleRun("POST /v1/stop", func(c *controller, w http.ResponseWriter, r *http.Request) {
+		logger.Warn("Run stopped through the control API", "remote", r.RemoteAddr)
+		c.end()
+		writeControlJSON(w, http.StatusOK, c.stats(time.Now()))
+	})
+
+	s.handler = s.mux
+	if token != "" {
+		s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, got, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				writeControlJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid control token"})
+				return
+			}
+			s.mux.ServeHTTP(w, r)
+		})
+	}
+	return s
+}
+
+// handleRun registers a handler of the run in progress, requests between runs are answered with a conflict
+func (s *ControlServer) handleRun(pattern string, handler func(c *controller, w http.ResponseWriter, r *http.Request)) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		c := s.control
+		s.mu.Unlock()
+		if c == nil {
+			writeControlJSON(w, http.StatusConflict, map[string]string{"error": "no run in progress"})
+			return
+		}
+		handler(c, w, r)
+	})
+}
+
+// Handle registers a handler of the control API for the pattern, e.g. GET /v1/health, behind the same token
+func (s *ControlServer) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP serves a request of the control API
+func (s *ControlServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Addr returns the address the control API listens on
+func (s *ControlServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close shuts the control API down, waiting for its requests to finish
+func (s *ControlServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), controlShutdownTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// attach lets the control API steer the controller of a run, the returned function detaches it when the run ends
+func (s *ControlServer) attach(c *controller) func() {
+	s.mu.Lock()
+	s.control = c
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.control == c {
+			s.control = nil
+		}
+	}
+}
+
+// writeControlJSON writes the value as a JSON response
+func writeControlJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleSignals pauses the run on the pause signal and resumes it on the resume signal, on platforms that have them.
+// The returned function stops the handling
+func (c *controller) handleSignals(logger *slog.Logger) func() {
+	if pauseSignal == nil {
+		return func() {}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, pauseSignal, resumeSignal)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-signals:
+				switch {
+				case sig == pauseSignal && c.pause(time.Now()):
+					logger.Warn("Run paused by signal", "signal", sig.String(), "resume_signal", resumeSignal.String())
+				case sig == resumeSignal && c.resume(time.Now()):
+					logger.Info("Run resumed by signal", "signal", sig.String())
+				}
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// startControl creates the controller of the run and handles the pause and resume signals for the duration of the
+// run. The controller attaches to the control server of the context, or else to a control API served on the
+// configured address. It returns the context the run derives from, which the controller stops. The returned stop
+// function ends the signal handling and detaches the controller or shuts the server down
+func startControl(ctx context.Context, cfg config.ControlConfig, progress *progressTracker, logger *slog.Logger) (context.Context, *controller, func()) {
+	server := controlServerFromContext(ctx)
+	ctx, stop := context.WithCancelCause(ctx)
+	control := newController(progress, stop)
+	stopSignals := control.handleSignals(logger)
+
+	owned := false
+	if server == nil && cfg.Listen != "" {
+		var err error
+		if server, err = NewControlServer(cfg, logger); err != nil {
+			logger.Error("Failed to start control API, continuing without it", "listen", cfg.Listen, "error", err)
+		} else {
+			owned = true
+			logger.Info("Serving control API", "url", "http://"+server.Addr()+"/v1/stats")
+		}
+	}
+	detach := func() {}
+	if server != nil {
+		detach = server.attach(control)
+	}
+
+	return ctx, control, func() {
+		stopSignals()
+		stop(nil)
+		detach()
+		if !owned {
+			return
+		}
+		if err := server.Close(); err != nil {
+			logger.Warn("Failed to shut down control API", "error", err)
+		}
+	}
+}
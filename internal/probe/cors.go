@@ -0,0 +1,95 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// corsSafelistedMethods are allowed by any preflight response, they need not be listed in
+// Access-Control-Allow-Methods
+var corsSafelistedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// checkCORS sends the CORS preflight of every endpoint with a CORS check and returns their outcomes. Endpoints with
+// variables in their URL are skipped, since their values are only known during the run
+func checkCORS(ctx context.Context, client *http.Client, proxies []proxySetting, probing config.ProbingConfig, logger *slog.Logger) []report.CORSResult {
+	var results []report.CORSResult
+	for i, endpoint := range probing.Endpoints {
+		if endpoint.CORS == nil {
+			continue
+		}
+		if strings.Contains(endpoint.URL, "{{") {
+			logger.Warn("CORS check skipped, the URL has variables", "url", endpoint.URL)
+			continue
+		}
+
+		check := *endpoint.CORS
+		method := check.RequestMethod(endpoint)
+		result := report.CORSResult{Method: endpoint.Method, URL: endpoint.URL, Origin: check.Origin}
+		resp, err := sweepRequest(withInstance(withProxy(ctx, proxies[i]), endpoint.Instance), client, http.MethodOptions,
+			endpoint.RequestURL(),
+			preflightHeaders(check.Origin, method, check.Headers),
+			endpointTimeout(endpoint, probing.RequestTimeoutMS))
+		if err != nil {
+			result.Error = err.Error()
+			logger.Error("CORS check failed", "url", endpoint.URL, "origin", check.Origin, "error", err)
+		} else {
+			result.Status = resp.StatusCode
+			result.Failures = evaluateCORS(check, method, resp)
+			if len(result.Failures) > 0 {
+				logger.Error("CORS check failed", "url", endpoint.URL, "origin", check.Origin, "failures", strings.Join(result.Failures, "; "))
+			} else {
+				logger.Info("CORS check passed", "url", endpoint.URL, "origin", check.Origin)
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// evaluateCORS returns the reasons the preflight response does not allow the request, like a browser evaluates it.
+// Wildcards are not accepted when credentials are required
+func evaluateCORS(check config.CORSCheck, method string, resp *http.Response) []string {
+	var failures []string
+	if !check.ExpectedStatus.Expected(resp.StatusCode) {
+		failures = append(failures, fmt.Sprintf("unexpected status code %d", resp.StatusCode))
+	}
+
+	allowOrigin := resp.Header.Get("Access-Control-Allow-Origin")
+	switch {
+	case allowOrigin == "":
+		failures = append(failures, "Access-Control-Allow-Origin is missing")
+	case allowOrigin == "*" && check.Credentials:
+		failures = append(failures, "Access-Control-Allow-Origin is * but credentials are required")
+	case allowOrigin != "*" && allowOrigin != check.Origin:
+		failures = append(failures, fmt.Sprintf("Access-Control-Allow-Origin is %q, want %q", allowOrigin, check.Origin))
+	}
+
+	if check.Credentials && resp.Header.Get("Access-Control-Allow-Credentials") != "true" {
+		failures = append(failures, "Access-Control-Allow-Credentials is not true")
+	}
+
+	// allowed reports whether a value is listed, ignoring case, or covered by a wildcard
+	allowed := func(values []string, value string) bool {
+		return slices.ContainsFunc(values, func(v string) bool {
+			return strings.EqualFold(v, value) || (v == "*" && !check.Credentials)
+		})
+	}
+	allowMethods := headerList(resp.Header.Get("Access-Control-Allow-Methods"))
+	if !slices.Contains(corsSafelistedMethods, strings.ToUpper(method)) && !allowed(allowMethods, method) {
+		failures = append(failures, fmt.Sprintf("method %s is not in Access-Control-Allow-Methods", method))
+	}
+	allowHeaders := headerList(resp.Header.Get("Access-Control-Allow-Headers"))
+	for _, header := range check.Headers {
+		if !allowed(allowHeaders, header) {
+			failures = append(failures, fmt.Sprintf("header %s is not in Access-Control-Allow-Headers", header))
+		}
+	}
+	return failures
+}
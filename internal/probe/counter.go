@@ -0,0 +1,40 @@
+package probe
+
+import "sync/atomic"
+
+// requestCounter counts the successful and failed requests in a shard per worker, so workers counting their
+// outcomes do not serialize on a shared lock or cache line. The shards are summed when the totals are read
+type requestCounter struct {
+	shards []counterShard
+}
+
+// counterShard holds the counts of a worker, padded to a cache line so neighbouring shards are not falsely shared
+type counterShard struct {
+	successes atomic.Int64
+	failures  atomic.Int64
+	_         [48]byte
+}
+
+// newRequestCounter creates a counter with a shard per worker
+func newRequestCounter(workers int) *requestCounter {
+	return &requestCounter{shards: make([]counterShard, max(workers, 1))}
+}
+
+// add counts the outcome of a request of the worker
+func (c *requestCounter) add(worker int, failed bool) {
+	shard := &c.shards[worker%len(c.shards)]
+	if failed {
+		shard.failures.Add(1)
+	} else {
+		shard.successes.Add(1)
+	}
+}
+
+// totals returns the successful and failed requests of all workers
+func (c *requestCounter) totals() (successes, failures int) {
+	for i := range c.shards {
+		successes += int(c.shards[i].successes.Load())
+		failures += int(c.shards[i].failures.Load())
+	}
+	return successes, failures
+}
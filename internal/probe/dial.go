@@ -0,0 +1,104 @@
+package probe
+
+import (
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dialAttempt represents a single connection attempt to one of the resolved addresses
+type dialAttempt struct {
+	// network is the address family of the attempt, tcp4 or tcp6
+	network  string
+	addr     string
+	duration time.Duration
+	err      error
+}
+
+// dialTrace records the connection attempts of a request. With Happy Eyeballs (RFC 6555) attempts to
+// IPv6 and IPv4 addresses run in parallel, so the trace is safe for concurrent use
+type dialTrace struct {
+	mu       sync.Mutex
+	started  map[string]time.Time
+	attempts []dialAttempt
+}
+
+// clientTrace returns the httptrace hooks recording the connection attempts
+func (d *dialTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if d.started == nil {
+				d.started = make(map[string]time.Time)
+			}
+			d.started[addr] = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.attempts = append(d.attempts, dialAttempt{
+				network:  addressFamily(addr),
+				addr:     addr,
+				duration: time.Since(d.started[addr]),
+				err:      err,
+			})
+		},
+	}
+}
+
+// failed returns the connection attempts that did not succeed
+func (d *dialTrace) failed() []dialAttempt {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var failed []dialAttempt
+	for _, attempt := range d.attempts {
+		if attempt.err != nil {
+			failed = append(failed, attempt)
+		}
+	}
+	return failed
+}
+
+// String describes all connection attempts, e.g. "tcp6 [::1]:80 failed after 1ms: connection refused"
+func (d *dialTrace) String() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	parts := make([]string, 0, len(d.attempts))
+	for _, attempt := range d.attempts {
+		if attempt.err != nil {
+			parts = append(parts, fmt.Sprintf("%s %s failed after %s: %v", attempt.network, attempt.addr, attempt.duration, unwrapOpError(attempt.err)))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s %s connected after %s", attempt.network, attempt.addr, attempt.duration))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// addressFamily returns tcp4 or tcp6 for the given host:port address
+func addressFamily(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return "tcp"
+	case ip.To4() != nil:
+		return "tcp4"
+	default:
+		return "tcp6"
+	}
+}
+
+// unwrapOpError strips the operation and address from a dial error, since they are already part of the attempt
+func unwrapOpError(err error) error {
+	if opErr, ok := err.(*net.OpError); ok && opErr.Err != nil {
+		return opErr.Err
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package probe
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// reasons a run ended before all requests were sent
+const (
+	stopMaxDuration = "max_duration"
+	stopCanceled    = "canceled"
+	stopControl     = "stopped"
+)
+
+// runContexts derives the contexts of a run from ctx. New requests are scheduled until the run context ends, at
+// max_duration or when ctx is cancelled. In-flight requests use the drain context, which ends drain_timeout after
+// the run context, so they can finish and be counted in the report
+func runContexts(ctx context.Context, probing config.ProbingConfig) (run, drain context.Context, stop context.CancelFunc) {
+	var stopRun context.CancelFunc
+	if probing.MaxDurationMS > 0 {
+		run, stopRun = context.WithTimeout(ctx, time.Duration(probing.MaxDurationMS)*time.Millisecond)
+	} else {
+		run, stopRun = context.WithCancel(ctx)
+	}
+	drain, stopDrain := context.WithCancel(context.WithoutCancel(ctx))
+	stopAfter := context.AfterFunc(run, func() { time.AfterFunc(drainTimeout(probing), stopDrain) })
+	return run, drain, func() {
+		stopAfter()
+		stopRun()
+		stopDrain()
+	}
+}
+
+// drainTimeout returns how long in-flight requests may take to finish after the run ended early, defaults to the
+// request timeout
+func drainTimeout(probing config.ProbingConfig) time.Duration {
+	return time.Duration(cmp.Or(probing.DrainTimeoutMS, probing.RequestTimeoutMS)) * time.Millisecond
+}
+
+// requestContext returns a context with the values of ctx that ends with the drain context instead of ctx, so an
+// in-flight request is not interrupted when the run stops scheduling requests
+func requestContext(ctx, drain context.Context) (context.Context, context.CancelFunc) {
+	reqCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(drain, cancel)
+	return reqCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// stopReason returns why the run ended before all requests were sent, empty when it was not stopped
+func stopReason(ctx, run context.Context) string {
+	switch {
+	case ctx.Err() != nil:
+		return stopCanceled
+	case errors.Is(context.Cause(run), errStopped):
+		return stopControl
+	case run.Err() != nil:
+		return stopMaxDuration
+	default:
+		return ""
+	}
+}
+
+// startFinalize logs as soon as the run context ends early that no new requests are started, with the progress at
+// that moment, so a cancelled run gives feedback while its in-flight requests drain. The returned function
+// unregisters the log once the workers finished
+func startFinalize(ctx, run context.Context, probing config.ProbingConfig, progress *progressTracker, logger *slog.Logger) func() bool {
+	return context.AfterFunc(run, func() {
+		logger.Warn("Run stopping, draining in-flight requests before the partial report",
+			"stop_reason", stopReason(ctx, run),
+			"completed_requests", progress.completed.Load(),
+			"failed_requests", progress.failed.Load(),
+			"drain_timeout", drainTimeout(probing))
+	})
+}
+
+// logPartialReport logs the summary of a run that ended before all requests were sent, from the results collected
+// up to the end of the drain
+func logPartialReport(r *report.Report, logger *slog.Logger) {
+	logger.Warn("Partial report",
+		"stop_reason", r.StopReason,
+		"total_requests", r.TotalRequests,
+		"successful_requests", r.SuccessfulRequests,
+		"failed_requests", r.FailedRequests,
+		"errors", r.Errors,
+		"duration", time.Duration(r.DurationMS*float64(time.Millisecond)),
+		"avg_response_time", time.Duration(r.Latency.AvgMS*float64(time.Millisecond)))
+}
@@ -0,0 +1,249 @@
+package probe
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// engine generates the load of a run, it starts the workers sending the requests and returns the counter of the
+// started iterations
+type engine interface {
+	start(ctx context.Context, wg *sync.WaitGroup, send sendFunc, publish func(result)) *atomic.Int64
+}
+
+// newEngine returns the engine of the configured load model, the virtual users when enabled. replay holds the requests
+// of the access log of the replay model
+func newEngine(probing config.ProbingConfig, offsets []int, replay []replayRequest, control *controller, logger *slog.Logger) engine {
+	switch {
+	case probing.VirtualUsers.Enabled:
+		return vuEngine{probing: probing, offsets: offsets, logger: logger}
+	case probing.Engine.Open():
+		return openEngine{probing: probing, offsets: offsets, control: control, logger: logger}
+	case probing.Engine.Replays():
+		return replayEngine{probing: probing, requests: replay, control: control, logger: logger}
+	default:
+		return closedEngine{probing: probing, offsets: offsets, control: control, logger: logger}
+	}
+}
+
+// vuEngine runs the virtual users, each looping over the endpoints and scenarios with its own state
+type vuEngine struct {
+	probing config.ProbingConfig
+	offsets []int
+	logger  *slog.Logger
+}
+
+func (e vuEngine) start(ctx context.Context, wg *sync.WaitGroup, send sendFunc, publish func(result)) *atomic.Int64 {
+	return startVirtualUsers(ctx, wg, e.probing, e.offsets, send, publish, e.logger)
+}
+
+// closedEngine is the closed load model, a fixed number of workers sharing the job queue, each sending its next
+// request when the previous one finished. When the target slows down the workers send fewer requests, so the
+// requests that would have been sent in the meantime are never measured
+type closedEngine struct {
+	probing config.ProbingConfig
+	offsets []int
+	control *controller
+	logger  *slog.Logger
+}
+
+// start fills the job queue one iteration over the endpoints and scenarios at a time, spaced by the pacing
+func (e closedEngine) start(ctx context.Context, wg *sync.WaitGroup, send sendFunc, publish func(result)) *atomic.Int64 {
+	probing := e.probing
+	jobs := make(chan job, probing.ConcurrentRequests)
+	startJobWorkers(ctx, wg, probing, jobs, send, publish, e.control, e.logger)
+	schedule := startRampedEndpoints(ctx, wg, probing, send, publish, e.logger)
+
+	pace := newPacer(probing.Pacing, probing.ConcurrentRequests)
+	go func() {
+		for range probing.TotalRequests {
+			if !pace.wait(ctx) {
+				e.logger.Warn("Job queue stopped due to cancellation")
+				return
+			}
+			if !enqueueIteration(ctx, jobs, probing, schedule, e.offsets, nil, e.logger) {
+				return
+			}
+		}
+		close(jobs)
+		e.logger.Debug("Job queue closed")
+	}()
+
+	return &pace.started
+}
+
+// openEngine is the open load model, the requests arrive at a constant rate independent of how fast the target
+// responds. An arrival waits in the job queue until a worker is free, the wait is part of its response time so a
+// slow target is not hidden by the workers sending fewer requests, and it is dropped after the queue timeout
+type openEngine struct {
+	probing config.ProbingConfig
+	offsets []int
+	control *controller
+	logger  *slog.Logger
+}
+
+// start schedules the arrivals of the jobs at the configured rate, an arrival is scheduled when it should have been
+// sent, also when the queue is full, so the time the queue was blocked counts as waiting time
+func (e openEngine) start(ctx context.Context, wg *sync.WaitGroup, send sendFunc, publish func(result)) *atomic.Int64 {
+	probing := e.probing
+	jobs := make(chan job, probing.ConcurrentRequests)
+	startJobWorkers(ctx, wg, probing, jobs, send, publish, e.control, e.logger)
+	schedule := startRampedEndpoints(ctx, wg, probing, send, publish, e.logger)
+
+	iterations := &atomic.Int64{}
+	interval := probing.Engine.Interval()
+	go func() {
+		next := time.Now()
+		arrival := func() time.Time {
+			at := next
+			next = next.Add(interval)
+			return at
+		}
+		for range probing.TotalRequests {
+			iterations.Add(1)
+			if !enqueueIteration(ctx, jobs, probing, schedule, e.offsets, arrival, e.logger) {
+				return
+			}
+		}
+		close(jobs)
+		e.logger.Debug("Job queue closed")
+	}()
+
+	return iterations
+}
+
+// startRampedEndpoints starts the workers of the endpoints with a ramp, which are sent by their own workers, and
+// returns the schedule of the other endpoints which are added to the job queue
+func startRampedEndpoints(ctx context.Context, wg *sync.WaitGroup, probing config.ProbingConfig, send sendFunc, publish func(result), logger *slog.Logger) []int {
+	schedule, ramped := splitRampedSchedule(probing.Endpoints, weightedSchedule(probing.Endpoints))
+	startRampWorkers(ctx, wg, probing, ramped, send, publish, logger)
+	return schedule
+}
+
+// enqueueIteration adds one iteration over the endpoints and scenarios to the job queue, arrival returns the time
+// the next job is scheduled at and the job is only added once it is reached, nil adds the jobs right away. It returns
+// false when the context is cancelled first
+func enqueueIteration(ctx context.Context, jobs chan<- job, probing config.ProbingConfig, schedule, offsets []int, arrival func() time.Time, logger *slog.Logger) bool {
+	enqueue := func(j job) bool {
+		if arrival != nil {
+			j.arrival = arrival()
+		}
+		return enqueueJob(ctx, jobs, j, logger)
+	}
+
+	for _, i := range schedule {
+		endpoint := probing.Endpoints[i]
+		if !enqueue(job{index: i, endpoint: endpoint}) {
+			return false
+		}
+		logger.Debug("Job added to queue", "method", endpoint.Method, "url", endpoint.URL)
+	}
+	for i := range probing.Scenarios {
+		scenario := &probing.Scenarios[i]
+		if !enqueue(job{index: offsets[i], scenario: scenario}) {
+			return false
+		}
+		logger.Debug("Job added to queue", "scenario", scenario.Name)
+	}
+	return true
+}
+
+// enqueueJob adds the job to the job queue once its arrival time is reached, it returns false when the context is
+// cancelled first
+func enqueueJob(ctx context.Context, jobs chan<- job, j job, logger *slog.Logger) bool {
+	if !sleepContext(ctx, time.Until(j.arrival)) {
+		logger.Warn("Job queue stopped due to cancellation")
+		return false
+	}
+	select {
+	case <-ctx.Done():
+		logger.Warn("Job queue stopped due to cancellation")
+		return false
+	case jobs <- j:
+		return true
+	}
+}
+
+// startJobWorkers starts the workers sharing the job queue, the controller can change the number of workers while
+// the run is in progress. A job with an arrival time that waited longer than the queue timeout is dropped, otherwise
+// its wait is added to the response time of its first request
+func startJobWorkers(ctx context.Context, wg *sync.WaitGroup, probing config.ProbingConfig, jobs <-chan job, send sendFunc, publish func(result), control *controller, logger *slog.Logger) {
+	queueTimeout := probing.Engine.QueueTimeout(probing.RequestTimeoutMS)
+
+	pool := newWorkerPool(wg, func(worker int, stop <-chan struct{}) {
+		ctx := withRand(ctx, newWorkerRand(probing.Seed, worker))
+		logger.Debug("Worker started", "worker_id", worker)
+
+		for {
+			select {
+			case <-ctx.Done(): // check if the context has been cancelled
+				logger.Warn("Worker stopped due to cancellation", "worker_id", worker)
+				return
+			case <-stop:
+				logger.Debug("Worker removed", "worker_id", worker)
+				return
+			case j, ok := <-jobs:
+				if !ok {
+					logger.Debug("Worker finished", "worker_id", worker)
+					return
+				}
+
+				send := send
+				if !j.arrival.IsZero() {
+					wait := time.Since(j.arrival)
+					if wait > queueTimeout {
+						dropJob(j, worker, publish)
+						continue
+					}
+					send = queuedSend(send, wait)
+				}
+
+				if j.scenario != nil {
+					if !runScenario(ctx, worker, j, nil, send, publish, logger) {
+						logger.Warn("Worker stopped due to cancellation", "worker_id", worker)
+						return
+					}
+					continue
+				}
+
+				r, ok := send(ctx, worker, j.index, j.endpoint)
+				if !ok {
+					logger.Warn("Worker stopped due to cancellation", "worker_id", worker)
+					return
+				}
+				publish(r)
+			}
+		}
+	})
+	// the workers added while the run is in progress get the ids following the ramp workers
+	pool.start(probing.ConcurrentRequests, probing.ConcurrentRequests+rampWorkers(probing.Endpoints))
+	control.setPool(pool, probing.Control.WorkerLimit(probing.ConcurrentRequests))
+}
+
+// dropJob reports a job that waited too long for a free worker as failed, the following steps of a dropped scenario
+// as skipped
+func dropJob(j job, worker int, publish func(result)) {
+	publish(result{endpoint: j.index, worker: worker, err: ErrQueueTimeout})
+	if j.scenario != nil {
+		skipSteps(j, worker, 1, publish)
+	}
+}
+
+// queuedSend adds the time a job waited in the queue to the response time of its first request, as a request sent
+// at its arrival would have taken that much longer from the point of view of its user
+func queuedSend(send sendFunc, wait time.Duration) sendFunc {
+	first := true
+	return func(ctx context.Context, worker, index int, endpoint config.Endpoint) (result, bool) {
+		r, ok := send(ctx, worker, index, endpoint)
+		if first {
+			r.sample.duration += wait
+			first = false
+		}
+		return r, ok
+	}
+}
@@ -0,0 +1,114 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// failure categories of the error taxonomy
+const (
+	errorTimeout           = "timeout"
+	errorDNS               = "dns"
+	errorConnectionRefused = "connection_refused"
+	errorConnectionReset   = "connection_reset"
+	errorTLS               = "tls"
+	errorStatus4xx         = "status_4xx"
+	errorStatus5xx         = "status_5xx"
+	errorStatusUnexpected  = "status_unexpected"
+	errorAssertion         = "assertion"
+	errorQueueTimeout      = "queue_timeout"
+	errorOther             = "other"
+)
+
+// statusError represents a response with an error status code, it wraps ErrStatusCode
+type statusError struct {
+	code int
+	// retryAfter is the wait requested by the Retry-After header of a 429 or 503 response
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: status code %d", ErrStatusCode, e.code)
+}
+
+func (e *statusError) Unwrap() error {
+	return ErrStatusCode
+}
+
+// classifyError returns the failure category of a request error
+func classifyError(err error) string {
+	var statusErr *statusError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+
+	switch {
+	case errors.As(err, &statusErr):
+		switch {
+		case statusErr.code >= 500:
+			return errorStatus5xx
+		case statusErr.code >= 400:
+			return errorStatus4xx
+		default:
+			// a success or redirect status code not listed in expected_status
+			return errorStatusUnexpected
+		}
+	case errors.Is(err, ErrExtraction), errors.Is(err, ErrContentEncoding), errors.Is(err, ErrAssertion):
+		// the response did not contain what the scenario or an assertion expected, or was not encoded as expected
+		return errorAssertion
+	case errors.Is(err, ErrQueueTimeout):
+		// the open load model dropped the arrival before it was sent
+		return errorQueueTimeout
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return errorTimeout
+	case errors.As(err, &dnsErr):
+		return errorDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return errorConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return errorConnectionReset
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return errorTLS
+	default:
+		return errorOther
+	}
+}
+
+// errorCounts returns the failures per category over all endpoints
+func errorCounts(stats []*endpointStat) map[string]int {
+	counts := make(map[string]int)
+	for _, s := range stats {
+		for category, count := range s.errors {
+			counts[category] += count
+		}
+	}
+	return counts
+}
+
+// logErrorReport logs the number of failed requests per category, so the cause of a failing run is visible at a glance
+func logErrorReport(stats []*endpointStat, logger *slog.Logger) {
+	counts := errorCounts(stats)
+	if len(counts) == 0 {
+		return
+	}
+	args := make([]any, 0, 2*len(counts))
+	for _, category := range slices.Sorted(maps.Keys(counts)) {
+		args = append(args, category, counts[category])
+	}
+	logger.Warn("Failure report", args...)
+}
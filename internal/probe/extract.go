@@ -0,0 +1,108 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/jsonpath"
+)
+
+// maxCaptureBytes limits how much of a response body is kept for extracting variables
+const maxCaptureBytes = 1 << 20
+
+// captureKey is the context key for the response capture of a request
+type captureKey struct{}
+
+// responseCapture holds the status, headers and the decoded body of a response for extracting variables and
+// checking assertions
+type responseCapture struct {
+	status int
+	header http.Header
+	body   bytes.Buffer
+	// limit is the number of body bytes kept, maxCaptureBytes when 0 and none when negative
+	limit int
+	// size is the size of the whole body
+	size int64
+}
+
+// Write keeps the first bytes of the body up to the limit and discards the rest
+func (c *responseCapture) Write(p []byte) (int, error) {
+	limit := maxCaptureBytes
+	if c.limit != 0 {
+		limit = max(c.limit, 0)
+	}
+	if remaining := limit - c.body.Len(); remaining > 0 {
+		c.body.Write(p[:min(len(p), remaining)])
+	}
+	c.size += int64(len(p))
+	return len(p), nil
+}
+
+// withResponseCapture requests makeRequest to keep the response in the given capture
+func withResponseCapture(ctx context.Context, capture *responseCapture) context.Context {
+	return context.WithValue(ctx, captureKey{}, capture)
+}
+
+// responseCaptureFromContext returns the response capture of a request, nil when none was requested
+func responseCaptureFromContext(ctx context.Context) *responseCapture {
+	capture, _ := ctx.Value(captureKey{}).(*responseCapture)
+	return capture
+}
+
+// regexCache holds the compiled extraction patterns, so they are compiled once per run instead of per request
+var regexCache sync.Map
+
+// extractValue returns the value of the extraction from the captured response
+func extractValue(extraction config.Extraction, capture *responseCapture) (string, error) {
+	switch {
+	case extraction.Header != "":
+		value := capture.header.Get(extraction.Header)
+		if value == "" {
+			return "", fmt.Errorf("header %s not found in response", extraction.Header)
+		}
+		return value, nil
+	case extraction.Regex != "":
+		re, err := compileCached(extraction.Regex)
+		if err != nil {
+			return "", err
+		}
+		match := re.FindSubmatch(capture.body.Bytes())
+		switch {
+		case match == nil:
+			return "", fmt.Errorf("regex %s does not match response", extraction.Regex)
+		case len(match) > 1:
+			return string(match[1]), nil
+		default:
+			return string(match[0]), nil
+		}
+	default:
+		var doc any
+		if err := json.Unmarshal(capture.body.Bytes(), &doc); err != nil {
+			return "", fmt.Errorf("failed to parse JSON response: %w", err)
+		}
+		value, err := jsonpath.Lookup(doc, extraction.JSON)
+		if err != nil {
+			return "", err
+		}
+		return jsonpath.String(value)
+	}
+}
+
+// compileCached compiles the pattern, reusing earlier compilations
+func compileCached(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
@@ -0,0 +1,119 @@
+package probe
+
+import (
+	"context"
+	"log/slog"
+	"math"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// findMaxSaturation is the share of the rate of a step that must be achieved for it to be sustained
+const findMaxSaturation = 0.9
+
+// rateKey is the context key of the request rate a run starts with
+type rateKey struct{}
+
+// withRate returns a context that starts a run with its requests limited to the rate
+func withRate(ctx context.Context, rps float64) context.Context {
+	return context.WithValue(ctx, rateKey{}, rps)
+}
+
+// rateFromContext returns the request rate a run starts with, 0 without limit
+func rateFromContext(ctx context.Context) float64 {
+	rps, _ := ctx.Value(rateKey{}).(float64)
+	return rps
+}
+
+// FindMax runs steps of increasing request rates, every step a run of step_duration_ms, until a step breaches a fail
+// threshold or can not start its requests at its rate. The result is the one of the highest sustained step, or of
+// the first step when none was sustained, with the steps in its find_max section
+func FindMax(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*ProbeResult, error) {
+	f := cfg.ProbingConfig.FindMax
+	outcome := &report.FindMax{StepDurationMS: f.StepDuration()}
+	var best, first *ProbeResult
+
+	for rps := f.Start(); f.MaxRPS == 0 || rps <= f.MaxRPS; rps += f.Step() {
+		logger.Info("Starting find-max step", "target_rps", rps, "step_duration_ms", f.StepDuration())
+		result, err := RunProbe(withRate(ctx, rps), findMaxStepConfig(cfg, rps), logger)
+		if err != nil {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			// a cancelled step says nothing about the rate
+			break
+		}
+		step := findMaxStep(rps, result.Report)
+		outcome.Steps = append(outcome.Steps, step)
+		if first == nil {
+			first = result
+		}
+		if !step.Sustained {
+			logger.Warn("Find-max step not sustained", "target_rps", rps, "achieved_rps", step.AchievedRPS, "reason", step.Reason)
+			break
+		}
+		logger.Info("Find-max step sustained", "target_rps", rps, "achieved_rps", step.AchievedRPS, "p99_ms", step.P99MS)
+		outcome.MaxSustainableRPS = rps
+		best = result
+	}
+
+	if best == nil {
+		best = first
+	}
+	if best == nil {
+		best = &ProbeResult{Report: &report.Report{}}
+	}
+	best.Report.FindMax = outcome
+	logFindMaxReport(outcome, logger)
+	return best, nil
+}
+
+// findMaxStepConfig returns the config of the step at the rate, it sends the requests of step_duration_ms at the
+// rate and ends at twice the duration when the requests can not keep up
+func findMaxStepConfig(cfg *config.Config, rps float64) *config.Config {
+	step := *cfg
+	f := cfg.ProbingConfig.FindMax
+	probing := cfg.ProbingConfig
+	probing.TotalRequests = 1
+	requests := rps * float64(f.StepDuration()) / 1000
+	step.ProbingConfig.TotalRequests = max(int(math.Ceil(requests/float64(plannedRequests(probing)))), 1)
+	step.ProbingConfig.MaxDurationMS = 2 * f.StepDuration()
+	return &step
+}
+
+// findMaxStep evaluates a step, it is sustained when it breached no fail threshold and achieved most of its rate
+func findMaxStep(rps float64, r *report.Report) report.FindMaxStep {
+	step := report.FindMaxStep{
+		TargetRPS:     rps,
+		TotalRequests: r.TotalRequests,
+		ErrorRate:     r.Summary().ErrorRate,
+		P95MS:         r.Latency.P95MS,
+		P99MS:         r.Latency.P99MS,
+		Sustained:     true,
+	}
+	if r.DurationMS > 0 {
+		step.AchievedRPS = float64(r.TotalRequests) / (r.DurationMS / 1000)
+	}
+	for _, t := range r.Thresholds {
+		if t.Breached && t.Severity == config.SeverityFail {
+			step.Breaches = append(step.Breaches, t)
+		}
+	}
+	switch {
+	case len(step.Breaches) > 0:
+		step.Sustained, step.Reason = false, report.FindMaxThresholds
+	case step.AchievedRPS < rps*findMaxSaturation:
+		step.Sustained, step.Reason = false, report.FindMaxSaturated
+	}
+	return step
+}
+
+// logFindMaxReport logs the maximum sustainable rate found by the steps
+func logFindMaxReport(r *report.FindMax, logger *slog.Logger) {
+	if r.MaxSustainableRPS == 0 {
+		logger.Error("No find-max step was sustained", "steps", len(r.Steps))
+		return
+	}
+	logger.Info("Maximum sustainable rate found", "max_rps", r.MaxSustainableRPS, "steps", len(r.Steps))
+}
@@ -0,0 +1,185 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// healthGate holds the requests while the health check of the target reports unhealthy, and accounts the time the
+// load was paused
+type healthGate struct {
+	mu sync.Mutex
+	// resumed is closed while the load runs, and replaced by an open channel when it is paused
+	resumed  chan struct{}
+	pausedAt time.Time
+	pauses   int
+	paused   time.Duration
+	checks   int
+	failed   int
+	// unhealthy and healthy count the failed and passed checks in a row
+	unhealthy int
+	healthy   int
+}
+
+// newHealthGate creates a gate letting the requests through
+func newHealthGate() *healthGate {
+	resumed := make(chan struct{})
+	close(resumed)
+	return &healthGate{resumed: resumed}
+}
+
+// wait waits while the load is paused, it returns false when the context is cancelled first
+func (g *healthGate) wait(ctx context.Context) bool {
+	if g == nil {
+		return true
+	}
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+	select {
+	case <-resumed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// observe records the outcome of a check, pausing the load after unhealthyThreshold failed checks in a row and
+// resuming it after healthyThreshold passed checks in a row. It returns whether the load was paused or resumed
+func (g *healthGate) observe(err error, check config.HealthCheck, now time.Time) (paused, resumed bool) {
+	unhealthyThreshold, healthyThreshold := check.Thresholds()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.checks++
+	if err != nil {
+		g.failed++
+		g.unhealthy++
+		g.healthy = 0
+	} else {
+		g.healthy++
+		g.unhealthy = 0
+	}
+
+	isPaused := !g.pausedAt.IsZero()
+	switch {
+	case !isPaused && g.unhealthy >= unhealthyThreshold:
+		g.pausedAt = now
+		g.pauses++
+		g.resumed = make(chan struct{})
+		return true, false
+	case isPaused && g.healthy >= healthyThreshold:
+		g.paused += now.Sub(g.pausedAt)
+		g.pausedAt = time.Time{}
+		close(g.resumed)
+		return false, true
+	}
+	return false, false
+}
+
+// report returns the outcome of the health checks for the run report, nil without a health check. A pause lasting
+// until the end of the run is accounted up to the end
+func (g *healthGate) report(url string, end time.Time) *report.HealthCheck {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	paused := g.paused
+	if !g.pausedAt.IsZero() && end.After(g.pausedAt) {
+		paused += end.Sub(g.pausedAt)
+	}
+	return &report.HealthCheck{
+		URL:          url,
+		Checks:       g.checks,
+		FailedChecks: g.failed,
+		Pauses:       g.pauses,
+		PausedMS:     float64(paused) / float64(time.Millisecond),
+	}
+}
+
+// startHealthCheck checks the health endpoint once and then polls it at the configured interval, pausing the load
+// while it reports unhealthy. The returned gate is nil without a health check, the stop function ends the polling
+func startHealthCheck(ctx context.Context, check config.HealthCheck, logger *slog.Logger) (*healthGate, func()) {
+	if check.URL == "" {
+		return nil, func() {}
+	}
+
+	gate := newHealthGate()
+	client := &http.Client{Timeout: time.Duration(check.Timeout()) * time.Millisecond}
+	ctx, cancel := context.WithCancel(ctx)
+	finished := make(chan struct{})
+
+	poll := func() {
+		err := checkHealth(ctx, client, check)
+		if ctx.Err() != nil {
+			return
+		}
+		paused, resumed := gate.observe(err, check, time.Now())
+		switch {
+		case paused:
+			logger.Warn("Target unhealthy, pausing the load", "url", check.URL, "error", err)
+		case resumed:
+			logger.Info("Target healthy, resuming the load", "url", check.URL)
+		case err != nil:
+			logger.Debug("Health check failed", "url", check.URL, "error", err)
+		}
+	}
+
+	// the first check completes before the load starts, so an unhealthy target receives no requests
+	poll()
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(time.Duration(check.Interval()) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				poll()
+			}
+		}
+	}()
+
+	return gate, func() {
+		cancel()
+		<-finished
+	}
+}
+
+// checkHealth requests the health endpoint, it returns an error when the target is unhealthy
+func checkHealth(ctx context.Context, client *http.Client, check config.HealthCheck) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, check.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if !check.ExpectedStatus.Expected(resp.StatusCode) {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// logHealthReport logs how often and how long the load was paused for the health of the target
+func logHealthReport(r *report.HealthCheck, logger *slog.Logger) {
+	if r == nil || r.Pauses == 0 {
+		return
+	}
+	logger.Warn("Health check report",
+		"url", r.URL,
+		"checks", r.Checks,
+		"failed_checks", r.FailedChecks,
+		"pauses", r.Pauses,
+		"paused_ms", fmt.Sprintf("%.0f", r.PausedMS))
+}
@@ -0,0 +1,73 @@
+package probe
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/script"
+)
+
+// endpointHooks are the compiled hooks of a target, nil for a phase without expressions
+type endpointHooks struct {
+	pre, post *script.Program
+}
+
+// compileHooks compiles the hooks of every target, indexed like the targets
+func compileHooks(targets []config.Endpoint) ([]endpointHooks, error) {
+	compiled := make([]endpointHooks, len(targets))
+	for i, target := range targets {
+		pre, post, err := target.Hooks.Compile()
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %s: %w", target.URL, err)
+		}
+		compiled[i] = endpointHooks{pre: pre, post: post}
+	}
+	return compiled, nil
+}
+
+// runPreRequest runs the pre_request hook and returns the endpoint with the body and the headers it set, the
+// variables it sets are stored in the run variables. A failure wraps ErrHook
+func runPreRequest(pre *script.Program, endpoint config.Endpoint, headers, vars map[string]string, run *runVariables) (config.Endpoint, map[string]string, error) {
+	env := &script.Env{
+		Method: endpoint.Method,
+		URL:    endpoint.RequestURL(),
+		Body:   endpoint.Body,
+		Header: headers,
+		Vars:   vars,
+	}
+	if err := pre.Run(env); err != nil {
+		return endpoint, headers, fmt.Errorf("%w: %w", ErrHook, err)
+	}
+	endpoint.Body = env.Body
+	setHookVariables(env, run)
+	return endpoint, env.Header, nil
+}
+
+// runPostResponse runs the post_response hook on the captured response, the variables it sets are stored in the run
+// variables. A failure wraps ErrAssertion
+func runPostResponse(post *script.Program, endpoint config.Endpoint, headers, vars map[string]string, capture *responseCapture, duration time.Duration, run *runVariables) error {
+	env := &script.Env{
+		Method:         endpoint.Method,
+		URL:            endpoint.RequestURL(),
+		Body:           endpoint.Body,
+		Header:         headers,
+		Vars:           vars,
+		Status:         capture.status,
+		ResponseHeader: capture.header,
+		ResponseBody:   capture.body.Bytes(),
+		Duration:       duration,
+	}
+	if err := post.Run(env); err != nil {
+		return fmt.Errorf("%w: %w", ErrAssertion, err)
+	}
+	setHookVariables(env, run)
+	return nil
+}
+
+// setHookVariables stores the variables set by a hook in the run variables
+func setHookVariables(env *script.Env, run *runVariables) {
+	for name, value := range env.SetVars {
+		run.set(name, value)
+	}
+}
@@ -0,0 +1,58 @@
+package probe
+
+import (
+	"context"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// inFlightLimiter limits the concurrent requests per endpoint, endpoints without a limit have a nil slot channel
+type inFlightLimiter []chan struct{}
+
+// newInFlightLimiter creates the limiter for the max_in_flight setting of the endpoints
+func newInFlightLimiter(endpoints []config.Endpoint) inFlightLimiter {
+	limiter := make(inFlightLimiter, len(endpoints))
+	for i, endpoint := range endpoints {
+		if endpoint.MaxInFlight > 0 {
+			limiter[i] = make(chan struct{}, endpoint.MaxInFlight)
+		}
+	}
+	return limiter
+}
+
+// acquire waits for a free slot of the endpoint, it returns false when the context is cancelled first
+func (l inFlightLimiter) acquire(ctx context.Context, index int) bool {
+	if l[index] == nil {
+		return true
+	}
+	select {
+	case l[index] <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release frees the slot of the endpoint taken by acquire
+func (l inFlightLimiter) release(index int) {
+	if l[index] != nil {
+		<-l[index]
+	}
+}
+
+// endpointTimeout returns the request timeout of the endpoint, falling back to the global timeout
+func endpointTimeout(endpoint config.Endpoint, globalTimeoutMS int) time.Duration {
+	if endpoint.TimeoutMS > 0 {
+		return time.Duration(endpoint.TimeoutMS) * time.Millisecond
+	}
+	return time.Duration(globalTimeoutMS) * time.Millisecond
+}
+
+// endpointDelay returns the delay before a request to the endpoint, the endpoint delay replaces the global delay
+func endpointDelay(endpoint config.Endpoint, global config.Delay) config.Delay {
+	if endpoint.Delay != nil {
+		return *endpoint.Delay
+	}
+	return global
+}
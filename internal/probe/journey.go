@@ -0,0 +1,146 @@
+package probe
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// journeyStat holds the aggregated iterations of a scenario, an iteration succeeds when all of its steps succeed
+type journeyStat struct {
+	scenario    config.Scenario
+	successes   int
+	failures    int
+	slaBreaches int
+	// latency records the journey durations of the successful iterations
+	latency report.Histogram
+}
+
+// stepRef identifies a scenario step by the index of its scenario and its position in the scenario
+type stepRef struct {
+	scenario int
+	step     int
+}
+
+// iterationKey identifies the iteration a worker or virtual user runs for a scenario
+type iterationKey struct {
+	worker   int
+	scenario int
+}
+
+// openIteration represents an iteration of which not all steps were collected yet
+type openIteration struct {
+	next     int
+	duration time.Duration
+	failed   bool
+}
+
+// journeyTracker assembles the step results into scenario iterations. Every iteration publishes a result for each
+// of its steps in order, sent or skipped, so an iteration is complete with the result of its last step. It is only
+// used by the collector goroutine
+type journeyTracker struct {
+	stats []*journeyStat
+	steps map[int]stepRef
+	open  map[iterationKey]*openIteration
+}
+
+// newJourneyTracker creates the tracker for the scenarios, offsets are the target indexes of their first steps
+func newJourneyTracker(scenarios []config.Scenario, offsets []int) *journeyTracker {
+	t := &journeyTracker{
+		stats: make([]*journeyStat, len(scenarios)),
+		steps: make(map[int]stepRef),
+		open:  make(map[iterationKey]*openIteration),
+	}
+	for i, scenario := range scenarios {
+		t.stats[i] = &journeyStat{scenario: scenario}
+		for j := range scenario.Steps {
+			t.steps[offsets[i]+j] = stepRef{scenario: i, step: j}
+		}
+	}
+	return t
+}
+
+// record adds the result of a request, results of endpoints outside of scenarios are ignored. An iteration that was
+// interrupted by the cancellation of the run is never completed and not counted
+func (t *journeyTracker) record(r result) {
+	ref, ok := t.steps[r.endpoint]
+	if !ok {
+		return
+	}
+	key := iterationKey{worker: r.worker, scenario: ref.scenario}
+	if ref.step == 0 {
+		t.open[key] = &openIteration{}
+	}
+	it := t.open[key]
+	if it == nil || it.next != ref.step {
+		delete(t.open, key)
+		return
+	}
+
+	it.next++
+	if r.err != nil {
+		it.failed = true
+	} else {
+		it.duration += r.sample.duration
+	}
+	stat := t.stats[ref.scenario]
+	if it.next < len(stat.scenario.Steps) {
+		return
+	}
+
+	delete(t.open, key)
+	if it.failed {
+		stat.failures++
+		return
+	}
+	stat.successes++
+	stat.latency.Record(it.duration)
+	if stat.scenario.SLAMS > 0 && it.duration > time.Duration(stat.scenario.SLAMS)*time.Millisecond {
+		stat.slaBreaches++
+	}
+}
+
+// report returns the iteration results per scenario for the run report
+func (t *journeyTracker) report() []report.ScenarioReport {
+	if len(t.stats) == 0 {
+		return nil
+	}
+	reports := make([]report.ScenarioReport, 0, len(t.stats))
+	for _, s := range t.stats {
+		reports = append(reports, report.ScenarioReport{
+			Name:                 s.scenario.Name,
+			Iterations:           s.successes + s.failures,
+			SuccessfulIterations: s.successes,
+			FailedIterations:     s.failures,
+			SLAMS:                s.scenario.SLAMS,
+			SLABreaches:          s.slaBreaches,
+			Latency:              s.latency.Latency(),
+		})
+	}
+	return reports
+}
+
+// histograms returns the journey duration histograms in the order of the scenario reports
+func (t *journeyTracker) histograms() []*report.Histogram {
+	var histograms []*report.Histogram
+	for _, s := range t.stats {
+		histograms = append(histograms, &s.latency)
+	}
+	return histograms
+}
+
+// logJourneyReport logs the iteration results of each scenario
+func logJourneyReport(t *journeyTracker, logger *slog.Logger) {
+	for _, s := range t.stats {
+		logger.Info("Scenario report",
+			"scenario", s.scenario.Name,
+			"successful_iterations", s.successes,
+			"failed_iterations", s.failures,
+			"avg_journey_time", s.latency.Mean(),
+			"p95_journey_time", s.latency.Percentile(95),
+			"sla_ms", s.scenario.SLAMS,
+			"sla_breaches", s.slaBreaches)
+	}
+}
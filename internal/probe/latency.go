@@ -0,0 +1,48 @@
+package probe
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// latencyRecorder records the response times of the successful requests in a histogram per target and worker
+// shard, so memory stays constant and workers rarely contend. The shards are merged at the end of the run
+type latencyRecorder struct {
+	shards []latencyShard
+}
+
+// latencyShard holds the histograms of the workers assigned to the shard
+type latencyShard struct {
+	mu         sync.Mutex
+	histograms []report.Histogram
+}
+
+// newLatencyRecorder creates a recorder for the targets with a shard per worker, up to the number of CPUs
+func newLatencyRecorder(workers, targets int) *latencyRecorder {
+	shards := make([]latencyShard, max(min(workers, runtime.GOMAXPROCS(0)), 1))
+	for i := range shards {
+		shards[i].histograms = make([]report.Histogram, targets)
+	}
+	return &latencyRecorder{shards: shards}
+}
+
+// record adds the response time of a successful request to the target at index
+func (l *latencyRecorder) record(worker, index int, d time.Duration) {
+	shard := &l.shards[worker%len(l.shards)]
+	shard.mu.Lock()
+	shard.histograms[index].Record(d)
+	shard.mu.Unlock()
+}
+
+// merge adds the recorded response times to the stats of the targets, it must only be called after all workers
+// finished
+func (l *latencyRecorder) merge(stats []*endpointStat) {
+	for i := range l.shards {
+		for index := range l.shards[i].histograms {
+			stats[index].latency.Merge(&l.shards[i].histograms[index])
+		}
+	}
+}
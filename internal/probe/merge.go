@@ -0,0 +1,28 @@
+package probe
+
+import (
+	"log/slog"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// Part returns the report of the result with its histograms, as sent by a worker of a distributed run
+func (r *ProbeResult) Part() report.Part {
+	return report.Part{Report: r.Report, Latencies: r.Latencies, Journeys: r.Journeys}
+}
+
+// MergeResults combines the results of the workers of a distributed run into one result, and evaluates the
+// thresholds and service level objectives against the merged report
+func MergeResults(parts []report.Part, probing config.ProbingConfig, logger *slog.Logger) *ProbeResult {
+	merged := report.Merge(parts)
+	merged.Thresholds = EvaluateThresholds(probing.Thresholds, merged)
+	logThresholdReport(merged.Thresholds, logger)
+	var latencies []*report.Histogram
+	for _, part := range parts {
+		latencies = append(latencies, part.Latencies...)
+	}
+	merged.SLO = EvaluateSLO(probing.SLO, merged, latencies)
+	logSLOReport(merged.SLO, logger)
+	return &ProbeResult{Report: merged}
+}
@@ -0,0 +1,60 @@
+package probe
+
+import (
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/metrics"
+)
+
+// newMetricsSink creates the sinks of the configured monitoring systems, it returns nil without any. The exported data
+// points are tagged with the ID of the run
+func newMetricsSink(cfg config.MetricsConfig, runID string) (metrics.Sink, error) {
+	var sinks []metrics.Sink
+	// the sinks created before a failing one are closed again
+	fail := func(err error) (metrics.Sink, error) {
+		for _, sink := range sinks {
+			sink.Close()
+		}
+		return nil, err
+	}
+	if cfg.StatsD.Address != "" {
+		statsd, err := metrics.NewStatsD(cfg.StatsD)
+		if err != nil {
+			return fail(err)
+		}
+		sinks = append(sinks, statsd)
+	}
+	if cfg.InfluxDB.URL != "" {
+		influx, err := metrics.NewInfluxDB(cfg.InfluxDB, runID)
+		if err != nil {
+			return fail(err)
+		}
+		sinks = append(sinks, influx)
+	}
+	if cfg.Timescale.DSN != "" {
+		timescale, err := metrics.NewTimescale(cfg.Timescale, runID)
+		if err != nil {
+			return fail(err)
+		}
+		sinks = append(sinks, timescale)
+	}
+	return metrics.Multi(sinks...), nil
+}
+
+// metricsRequest returns the request of the record as emitted to the metric sinks
+func (r resultRecord) metricsRequest(duration time.Duration) metrics.Request {
+	return metrics.Request{
+		Time:          r.Time,
+		Method:        r.Method,
+		URL:           r.URL,
+		Scenario:      r.Scenario,
+		Step:          r.Step,
+		Duration:      duration,
+		Success:       r.Success,
+		Status:        r.Status,
+		ErrorCategory: r.ErrorCategory,
+		BytesSent:     r.BytesSent,
+		BytesReceived: r.BytesReceived,
+	}
+}
@@ -0,0 +1,58 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// pacer spaces the start of the iterations to reach the configured iterations per minute
+type pacer struct {
+	interval time.Duration
+	next     time.Time
+	started  atomic.Int64
+}
+
+// newPacer creates the pacer for the given number of virtual users, with a zero interval when pacing is disabled
+func newPacer(pacing config.Pacing, users int) *pacer {
+	return &pacer{interval: pacing.Interval(users)}
+}
+
+// wait blocks until the next iteration may start, it returns false when the context is cancelled first
+func (p *pacer) wait(ctx context.Context) bool {
+	if p.interval > 0 {
+		now := time.Now()
+		if p.next.IsZero() {
+			p.next = now
+		}
+		if delay := p.next.Sub(now); delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return false
+			case <-timer.C:
+			}
+		}
+		p.next = p.next.Add(p.interval)
+	}
+	p.started.Add(1)
+	return true
+}
+
+// logPacingReport logs the achieved iterations per minute per virtual user next to the target
+func logPacingReport(iterations int64, pacing config.Pacing, users int, duration time.Duration, logger *slog.Logger) {
+	if pacing.Interval(users) == 0 || duration <= 0 {
+		return
+	}
+	achieved := float64(iterations) / duration.Minutes() / float64(users)
+	logger.Info("Pacing report",
+		"iterations", iterations,
+		"virtual_users", users,
+		"target_iterations_per_minute", pacing.IterationsPerMinute,
+		"achieved_iterations_per_minute", fmt.Sprintf("%.1f", achieved))
+}
@@ -0,0 +1,233 @@
+package probe
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// phaseTimings represents the time a request spent in each phase. DNS, connect and TLS are zero when the request
+// reused a pooled connection
+type phaseTimings struct {
+	dns     time.Duration
+	connect time.Duration
+	tls     time.Duration
+	// ttfb is the time from writing the request to the first response byte, the time the backend needed to respond
+	ttfb     time.Duration
+	bodyRead time.Duration
+	// reused is set when the request was sent over a pooled connection
+	reused bool
+	// decompress is the part of bodyRead spent decoding a compressed response
+	decompress time.Duration
+	// tlsHandshake is set when the request completed a TLS handshake, tlsResumed when it resumed an earlier session
+	tlsHandshake bool
+	tlsResumed   bool
+}
+
+// phaseTrace records the timestamps of the phases of a request, the hooks may be called from the transport's
+// dialing goroutines so the trace is safe for concurrent use
+type phaseTrace struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	reused       bool
+	tlsResumed   bool
+}
+
+// clientTrace returns the httptrace hooks recording the phase timestamps
+func (p *phaseTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { p.mark(&p.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { p.mark(&p.dnsDone) },
+		ConnectStart: func(string, string) {
+			// with Happy Eyeballs several attempts run in parallel, the first one started counts
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.connectStart.IsZero() {
+				p.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				p.mark(&p.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() { p.mark(&p.tlsStart) },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				return
+			}
+			p.mark(&p.tlsDone)
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.tlsResumed = state.DidResume
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.reused = info.Reused
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { p.mark(&p.wroteRequest) },
+		GotFirstResponseByte: func() { p.mark(&p.firstByte) },
+	}
+}
+
+// mark sets the timestamp to the current time
+func (p *phaseTrace) mark(t *time.Time) {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	*t = now
+}
+
+// timings returns the durations of the recorded phases, phases that did not complete are zero
+func (p *phaseTrace) timings() phaseTimings {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return phaseTimings{
+		dns:     between(p.dnsStart, p.dnsDone),
+		connect: between(p.connectStart, p.connectDone),
+		tls:     between(p.tlsStart, p.tlsDone),
+		ttfb:    between(p.wroteRequest, p.firstByte),
+		reused:  p.reused,
+		// a failed handshake fails the request, so a started handshake of a successful request completed
+		tlsHandshake: !p.tlsStart.IsZero() && !p.tlsDone.IsZero(),
+		tlsResumed:   p.tlsResumed,
+	}
+}
+
+// between returns the time from start to end, zero when either is not set
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// phaseStats aggregates the phase timings of the successful requests of an endpoint. The connection phases are
+// only recorded for requests that opened a new connection, so their averages are not diluted by pooled connections
+type phaseStats struct {
+	dns            report.Histogram
+	connect        report.Histogram
+	tls            report.Histogram
+	ttfb           report.Histogram
+	bodyRead       report.Histogram
+	newConnections int
+	// decompress is only recorded for compressed responses
+	decompress report.Histogram
+	// requests, tlsHandshakes and tlsResumptions count the connection reuse and TLS session resumption
+	requests       int
+	tlsHandshakes  int
+	tlsResumptions int
+}
+
+// record adds the phase timings of a request
+func (s *phaseStats) record(t phaseTimings) {
+	s.requests++
+	if t.tlsHandshake {
+		s.tlsHandshakes++
+		if t.tlsResumed {
+			s.tlsResumptions++
+		}
+	}
+	if !t.reused {
+		s.newConnections++
+		if t.dns > 0 {
+			s.dns.Record(t.dns)
+		}
+		s.connect.Record(t.connect)
+		if t.tls > 0 {
+			s.tls.Record(t.tls)
+		}
+	}
+	s.ttfb.Record(t.ttfb)
+	s.bodyRead.Record(t.bodyRead)
+	if t.decompress > 0 {
+		s.decompress.Record(t.decompress)
+	}
+}
+
+// report returns the phase breakdown for the run report
+func (s *phaseStats) report() report.Phases {
+	return report.Phases{
+		NewConnections: s.newConnections,
+		DNS:            s.dns.Latency(),
+		Connect:        s.connect.Latency(),
+		TLS:            s.tls.Latency(),
+		TTFB:           s.ttfb.Latency(),
+		BodyRead:       s.bodyRead.Latency(),
+		Decompress:     s.decompress.Latency(),
+	}
+}
+
+// logPhaseReport logs the average time per request phase of each endpoint, to tell network issues from slow backends
+func logPhaseReport(stats []*endpointStat, logger *slog.Logger) {
+	for _, s := range stats {
+		if s.successes == 0 {
+			continue
+		}
+		logger.Info("Latency breakdown",
+			"method", s.endpoint.Method,
+			"url", s.endpoint.URL,
+			"new_connections", s.phases.newConnections,
+			"avg_dns", s.phases.dns.Mean(),
+			"avg_connect", s.phases.connect.Mean(),
+			"avg_tls", s.phases.tls.Mean(),
+			"avg_ttfb", s.phases.ttfb.Mean(),
+			"p95_ttfb", s.phases.ttfb.Percentile(95),
+			"avg_body_read", s.phases.bodyRead.Mean(),
+			"avg_decompress", s.phases.decompress.Mean())
+	}
+}
+
+// reuse returns the connection reuse and TLS session resumption of the successful requests for the run report
+func (s *phaseStats) reuse() *report.Reuse {
+	r := &report.Reuse{
+		ReusedConnections: s.requests - s.newConnections,
+		TLSHandshakes:     s.tlsHandshakes,
+		TLSResumptions:    s.tlsResumptions,
+	}
+	if s.requests > 0 {
+		r.ConnectionReuseRate = float64(r.ReusedConnections) / float64(s.requests)
+	}
+	if s.tlsHandshakes > 0 {
+		r.TLSResumptionRate = float64(s.tlsResumptions) / float64(s.tlsHandshakes)
+	}
+	return r
+}
+
+// logReuseReport logs the connection reuse and TLS session resumption rates of each endpoint. It warns about
+// endpoints that never resumed a TLS session, which points to session tickets being disabled or not shared between
+// the servers behind a load balancer
+func logReuseReport(stats []*endpointStat, logger *slog.Logger) {
+	for _, s := range stats {
+		if s.successes == 0 {
+			continue
+		}
+		r := s.phases.reuse()
+		args := []any{
+			"method", s.endpoint.Method,
+			"url", s.endpoint.URL,
+			"reused_connections", r.ReusedConnections,
+			"connection_reuse_rate", fmt.Sprintf("%.2f", r.ConnectionReuseRate),
+			"tls_handshakes", r.TLSHandshakes,
+			"tls_resumption_rate", fmt.Sprintf("%.2f", r.TLSResumptionRate),
+		}
+		if r.TLSHandshakes > 1 && r.TLSResumptions == 0 {
+			logger.Warn("TLS sessions were never resumed", args...)
+			continue
+		}
+		logger.Info("Connection reuse report", args...)
+	}
+}
@@ -0,0 +1,78 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// hostPins maps the host names of the endpoints to the addresses resolved at the start of the run
+type hostPins map[string][]string
+
+// resolveHosts resolves the host names of the targets once, hosts that are IP addresses or contain variables are
+// not pinned
+func resolveHosts(ctx context.Context, resolver *net.Resolver, targets []config.Endpoint) (hostPins, error) {
+	pins := make(hostPins)
+	for _, target := range targets {
+		if strings.Contains(target.URL, "{{") {
+			continue
+		}
+		u, err := url.Parse(target.URL)
+		if err != nil {
+			continue
+		}
+		host := u.Hostname()
+		if _, ok := pins[host]; ok || host == "" || net.ParseIP(host) != nil {
+			continue
+		}
+
+		addrs, err := resolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+		pins[host] = addrs
+	}
+	return pins, nil
+}
+
+// pinnedDialer connects to the pinned addresses of a host instead of resolving it again, the addresses are tried in
+// the order they were resolved. Hosts without pinned addresses are dialed as usual
+func pinnedDialer(dial dialFunc, pins hostPins) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return dial(ctx, network, addr)
+		}
+		pinned, ok := pins[host]
+		if !ok {
+			return dial(ctx, network, addr)
+		}
+
+		var lastErr error
+		for _, ip := range pinned {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, lastErr
+	}
+}
+
+// logPinnedHosts logs the addresses each host is pinned to
+func logPinnedHosts(pins hostPins, logger *slog.Logger) {
+	for _, host := range slices.Sorted(maps.Keys(pins)) {
+		logger.Info("Pinned host addresses", "host", host, "addresses", pins[host])
+	}
+}
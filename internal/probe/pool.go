@@ -0,0 +1,71 @@
+package probe
+
+import "sync"
+
+// workerPool runs the workers sharing the job queue, the number of workers can change while the run is in progress
+type workerPool struct {
+	mu   sync.Mutex
+	wg   *sync.WaitGroup
+	work func(worker int, stop <-chan struct{})
+	// stops holds a channel per active worker in the order they started, closing it removes the worker
+	stops []chan struct{}
+	// running counts the started workers that did not return yet, including removed workers finishing their job
+	running int
+	nextID  int
+}
+
+// newWorkerPool creates a pool running work in every worker, work returns when stop is closed
+func newWorkerPool(wg *sync.WaitGroup, work func(worker int, stop <-chan struct{})) *workerPool {
+	return &workerPool{wg: wg, work: work}
+}
+
+// start starts the first n workers with the ids 0 to n-1, workers added later get the ids from nextID on
+func (p *workerPool) start(n, nextID int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for range n {
+		p.spawn()
+	}
+	p.nextID = nextID
+}
+
+// spawn starts a worker, it must be called with mu held. The wait group can not reach zero meanwhile, as the caller
+// checked that a worker is still running
+func (p *workerPool) spawn() {
+	id := p.nextID
+	p.nextID++
+	stop := make(chan struct{})
+	p.stops = append(p.stops, stop)
+	p.running++
+	p.wg.Go(func() {
+		p.work(id, stop)
+		p.mu.Lock()
+		p.running--
+		p.mu.Unlock()
+	})
+}
+
+// resize changes the number of active workers to n, the last started workers are removed first and finish their
+// current job. It returns false when the workers already finished
+func (p *workerPool) resize(n int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running == 0 {
+		return false
+	}
+	for len(p.stops) > n {
+		close(p.stops[len(p.stops)-1])
+		p.stops = p.stops[:len(p.stops)-1]
+	}
+	for len(p.stops) < n {
+		p.spawn()
+	}
+	return true
+}
+
+// size returns the number of active workers
+func (p *workerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.stops)
+}
@@ -0,0 +1,29 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// notSent reports whether the result is of a request that was never sent, a skipped scenario step or a shed request.
+// Such results are neither successes nor failures of the target
+func notSent(err error) bool {
+	return errors.Is(err, ErrStepSkipped) || errors.Is(err, ErrRequestShed)
+}
+
+// logShedReport warns about the endpoints with requests shed under saturation, the share is of all their requests
+func logShedReport(stats []*endpointStat, logger *slog.Logger) {
+	for _, s := range stats {
+		if s.shed == 0 {
+			continue
+		}
+		total := s.successes + s.failures + s.shed
+		logger.Warn("Requests shed under saturation",
+			"method", s.endpoint.Method,
+			"url", s.endpoint.URL,
+			"priority", s.endpoint.PriorityClass(),
+			"shed_requests", s.shed,
+			"shed_share", fmt.Sprintf("%.2f", float64(s.shed)/float64(total)))
+	}
+}
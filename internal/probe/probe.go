@@ -2,184 +2,605 @@ package probe
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"maps"
-	"math/rand"
+	"math/rand/v2"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/dasvh/enchante/internal/auth"
-
 	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/middleware"
+	"github.com/dasvh/enchante/internal/report"
 )
 
 var (
 	ErrRequestFailed = errors.New("request error")
-	ErrStatusCode    = errors.New("received non-200 status code")
+	ErrStatusCode    = errors.New("received unexpected status code")
+	ErrExtraction    = errors.New("failed to extract variable")
+	ErrStepSkipped   = errors.New("step skipped after an earlier step failed")
+	// ErrAssertion is returned when a response does not pass an assertion of its endpoint
+	ErrAssertion = errors.New("assertion failed")
+	// ErrTimeout is returned when a request exceeds its timeout, unlike ErrRequestFailed it is not a network failure
+	ErrTimeout = errors.New("request timed out")
+	// ErrCanceled is returned when the run was cancelled while a request was in flight
+	ErrCanceled = errors.New("request canceled")
+	// ErrRequestShed is reported for a bulk request not sent since the concurrency limit was exhausted
+	ErrRequestShed = errors.New("request shed under saturation")
+	// ErrHook is returned when the pre_request hook of an endpoint fails, the request is not sent
+	ErrHook = errors.New("pre_request hook failed")
+	// ErrMiddleware is returned when a middleware rejects a request before it is sent
+	ErrMiddleware = errors.New("request rejected by middleware")
+	// ErrQueueTimeout is reported for an arrival of the open load model that waited longer than the queue timeout
+	// for a free worker
+	ErrQueueTimeout = errors.New("request dropped after waiting for a free worker")
 )
 
-// RunProbe runs the probe test with the given configuration
-func RunProbe(ctx context.Context, cfg *config.Config, logger *slog.Logger) {
+// job represents a single request to be made against an endpoint, or an iteration of a scenario
+type job struct {
+	// index is the target index of the endpoint, or of the first step of the scenario
+	index    int
+	endpoint config.Endpoint
+	scenario *config.Scenario
+	// arrival is when the open load model scheduled the job, zero for the closed model
+	arrival time.Time
+}
+
+// result represents the outcome of a request against an endpoint
+type result struct {
+	endpoint int
+	// worker is the worker or virtual user that sent the request
+	worker int
+	sample sample
+	err    error
+	// audit holds the details of the request and response for the audit file, nil without an audit
+	audit *auditDetail
+}
+
+// sample represents the measurements of a single request
+type sample struct {
+	duration time.Duration
+	// encoding is the content encoding the response was served with, empty when uncompressed
+	encoding     string
+	wireBytes    int64
+	decodedBytes int64
+	// dialFailures are the failed connection attempts, also for requests that eventually succeeded
+	dialFailures []dialAttempt
+	// phases is the time spent in each phase of a successful request
+	phases phaseTimings
+	// sentBytes is the size of the request body
+	sentBytes int64
+	// header holds the response headers of a successful request
+	header http.Header
+	// status is the status code of the response, also of a request failing with an unexpected status
+	status int
+}
+
+// userAgent is the User-Agent header of the requests
+const userAgent = "Mozilla/5.0 (compatible; EnchanteBot/1.0)"
+
+// ProbeResult represents the outcome of a probe run, the counters, the stats per endpoint and the error counts are
+// those of its run report
+type ProbeResult struct {
+	*report.Report
+	// Latencies are the response time histograms of the endpoints and Journeys the journey duration histograms of
+	// the scenarios, in the order of the report
+	Latencies []*report.Histogram
+	Journeys  []*report.Histogram
+}
+
+// Failed reports whether the run failed. A failed CORS check always fails the run. With thresholds, only a breached
+// threshold of severity fail fails the run, without thresholds any failed request does
+func (r *ProbeResult) Failed() bool {
+	if slices.ContainsFunc(r.CORS, func(c report.CORSResult) bool { return !c.Passed() }) {
+		return true
+	}
+	if r.FindMax != nil && r.FindMax.MaxSustainableRPS == 0 {
+		return true
+	}
+	if len(r.Thresholds) > 0 {
+		return thresholdFailed(r.Thresholds)
+	}
+	return r.FailedRequests > 0
+}
+
+// RunProbe runs the probe test with the given configuration and returns its result. It returns an error when the run
+// could not be started, a run with failed requests is not an error
+func RunProbe(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*ProbeResult, error) {
 	var wg sync.WaitGroup
-	results := make(chan time.Duration, cfg.ProbingConfig.TotalRequests)
-	jobs := make(chan config.Endpoint, cfg.ProbingConfig.TotalRequests)
+
+	endpoints, err := resolveServiceInstances(ctx, cfg.ProbingConfig.Registry, cfg.ProbingConfig.Endpoints, logger)
+	if err != nil {
+		logger.Error("Failed to resolve service instances", "error", err)
+		return nil, fmt.Errorf("failed to resolve service instances: %w", err)
+	}
+	var replay []replayRequest
+	if cfg.ProbingConfig.Engine.Replays() {
+		if endpoints, replay, err = loadReplay(cfg.ProbingConfig.Engine.Replay, logger); err != nil {
+			logger.Error("Failed to load access log", "file", cfg.ProbingConfig.Engine.Replay.File, "error", err)
+			return nil, fmt.Errorf("failed to load access log: %w", err)
+		}
+	}
+	resolved := *cfg
+	resolved.ProbingConfig.Endpoints = endpoints
+	resolved.ProbingConfig.Seed = runSeed(cfg.ProbingConfig.Seed)
+	cfg = &resolved
+	logger.Info("Using random seed", "seed", cfg.ProbingConfig.Seed)
+	runID := newRunID()
+	logger.Info("Starting run", "run_id", runID)
+
+	// the endpoints and the scenario steps are the targets of the requests, each with its own stats
+	targets, scenarioOffsets := scenarioTargets(cfg.ProbingConfig)
+	stats := newEndpointStats(targets)
+	labelScenarioStats(stats, cfg.ProbingConfig.Scenarios, scenarioOffsets)
+	setBreakdownHeaders(stats, cfg.ProbingConfig.BreakdownHeaders)
+	assertions, err := compileAssertions(targets)
+	if err != nil {
+		logger.Error("Invalid assertion", "error", err)
+		return nil, fmt.Errorf("invalid assertion: %w", err)
+	}
+	hooks, err := compileHooks(targets)
+	if err != nil {
+		logger.Error("Invalid hooks", "error", err)
+		return nil, fmt.Errorf("invalid hooks: %w", err)
+	}
+	chain, err := middleware.Compile(cfg.ProbingConfig.Middleware, logger)
+	if err != nil {
+		logger.Error("Invalid middleware", "error", err)
+		return nil, fmt.Errorf("invalid middleware: %w", err)
+	}
 
 	startTest := time.Now()
-	var successCount, failureCount int
-	var countMutex sync.Mutex
-
-	// start worker routines
-	for worker := range cfg.ProbingConfig.ConcurrentRequests {
-		wg.Go(func() {
-			logger.Debug("Worker started", "worker_id", worker)
-
-			for {
-				select {
-				case <-ctx.Done(): // check if the context has been cancelled
-					logger.Warn("Worker stopped due to cancellation", "worker_id", worker)
-					return
-				case endpoint, ok := <-jobs:
-					if !ok {
-						logger.Debug("Worker finished", "worker_id", worker)
-						return
-					}
-
-					logger.Debug("Worker processing request", "worker_id", worker, "url", endpoint.URL)
-					headers, err := getHeadersForEndpoint(endpoint, &cfg.Auth, logger)
-					if err != nil {
-						logger.Error("Error getting headers for endpoint",
-							"url", endpoint.URL,
-							"auth_enabled", endpoint.AuthConfig != nil && endpoint.AuthConfig.Enabled,
-							"error", err)
-						countMutex.Lock()
-						failureCount++
-						countMutex.Unlock()
-						continue
-					}
-
-					err = makeRequest(ctx, endpoint, headers, cfg.ProbingConfig.DelayBetween, time.Duration(cfg.ProbingConfig.RequestTimeoutMS)*time.Millisecond, results, logger)
-					countMutex.Lock()
-					if err != nil {
-						failureCount++
-					} else {
-						successCount++
-					}
-					countMutex.Unlock()
-				}
+	traffic := &trafficCounter{}
+	var pins hostPins
+	if cfg.ProbingConfig.Network.PinDNS {
+		var err error
+		if pins, err = resolveHosts(ctx, net.DefaultResolver, targets); err != nil {
+			logger.Error("Failed to pin host addresses", "error", err)
+			return nil, fmt.Errorf("failed to pin host addresses: %w", err)
+		}
+		logPinnedHosts(pins, logger)
+	}
+	client, err := newHTTPClient(cfg.ProbingConfig.Network, pins, traffic)
+	if err != nil {
+		logger.Error("Failed to create HTTP client", "error", err)
+		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+	client = instanceClient(client, targets)
+	proxies, err := resolveProxies(cfg.ProbingConfig.Proxy, targets)
+	if err != nil {
+		logger.Error("Failed to resolve proxies", "error", err)
+		return nil, fmt.Errorf("failed to resolve proxies: %w", err)
+	}
+
+	corsResults := checkCORS(ctx, client, proxies, cfg.ProbingConfig, logger)
+
+	inFlight := newInFlightLimiter(targets)
+	pauses := newBackoff(cfg.ProbingConfig.RetryAfter, len(targets))
+	tagger := newRequestTagger(cfg.ProbingConfig.RunIDHeader, runID)
+	planned := plannedRequests(cfg.ProbingConfig)
+	if replay != nil {
+		planned = cfg.ProbingConfig.TotalRequests * len(replay)
+	}
+	progress := newProgressTracker(startTest, planned)
+	controlCtx, control, stopControl := startControl(ctx, cfg.ProbingConfig.Control, progress, logger)
+	if rps := rateFromContext(ctx); rps > 0 {
+		control.setRate(rps)
+	}
+	runCtx, drainCtx, stopRun := runContexts(controlCtx, cfg.ProbingConfig)
+	defer stopRun()
+	adaptive := newAdaptiveLimiter(cfg.ProbingConfig.Adaptive, cfg.ProbingConfig.ConcurrentRequests, logger)
+	health, stopHealth := startHealthCheck(runCtx, cfg.ProbingConfig.HealthCheck, logger)
+	authHeaders, stopAuth := startAuth(runCtx, targets, &cfg.Auth, logger)
+	defer stopAuth()
+
+	workers := cfg.ProbingConfig.ConcurrentRequests
+	if cfg.ProbingConfig.VirtualUsers.Enabled {
+		workers = cfg.ProbingConfig.VirtualUsers.Count
+	}
+	latencies := newLatencyRecorder(workers+rampWorkers(cfg.ProbingConfig.Endpoints), len(targets))
+	maxInFlight := newInFlightCap(cfg.ProbingConfig, workers+rampWorkers(cfg.ProbingConfig.Endpoints), logger)
+
+	samples, err := newRecordWriter(cfg.ProbingConfig.SamplesFile, "samples file")
+	if err != nil {
+		logger.Error("Failed to create samples file", "file", cfg.ProbingConfig.SamplesFile, "error", err)
+		return nil, err
+	}
+	auditFile, err := newRecordWriter(cfg.ProbingConfig.Audit.File, "audit file")
+	if err != nil {
+		logger.Error("Failed to create audit file", "file", cfg.ProbingConfig.Audit.File, "error", err)
+		return nil, err
+	}
+	audit := newAuditor(cfg.ProbingConfig.Audit)
+	sink, err := newMetricsSink(cfg.ProbingConfig.Metrics, runID)
+	if err != nil {
+		logger.Error("Failed to create metrics sink", "error", err)
+		return nil, err
+	}
+	stopProgress := startProgressWebhook(ctx, cfg.ProbingConfig.ProgressWebhook, progress, logger)
+	stream, stopStream := startResultStream(ctx, cfg.ProbingConfig.ResultStream, runID, logger)
+	journeys := newJourneyTracker(cfg.ProbingConfig.Scenarios, scenarioOffsets)
+	collector := startCollector(workers+rampWorkers(cfg.ProbingConfig.Endpoints), stats, journeys, progress, stream, samples, auditFile, sink)
+	stopFinalize := startFinalize(ctx, runCtx, cfg.ProbingConfig, progress, logger)
+
+	counts := newRequestCounter(workers + rampWorkers(cfg.ProbingConfig.Endpoints))
+
+	// publish counts the outcome of a request, records the response time and passes it on to the collector
+	publish := func(r result) {
+		if r.err == nil {
+			latencies.record(r.worker, r.endpoint, r.sample.duration)
+		}
+		if !notSent(r.err) {
+			counts.add(r.worker, r.err != nil)
+		}
+		collector.results <- r
+	}
+
+	runVars := newRunVariables()
+
+	// send waits for the delay of the target at index and while the load is paused, then makes the request with the
+	// variables substituted and captures the configured values of the response. The delay is waited for before the
+	// request is dispatched, so it holds no in-flight slot and is not part of the timeout or the response time. It
+	// returns false when the run was cancelled while waiting for the delay, a pause or a free in-flight slot
+	send := func(ctx context.Context, worker, index int, endpoint config.Endpoint) (result, bool) {
+		delay := endpointDelay(endpoint, cfg.ProbingConfig.DelayBetween)
+		if !sleepContext(ctx, delayDuration(delay, randFromContext(ctx))) || !pauses.wait(ctx, index) || !health.wait(ctx) || !control.wait(ctx) {
+			return result{}, false
+		}
+		logger.Debug("Worker processing request", "worker_id", worker, "url", endpoint.URL)
+		local := variablesFromContext(ctx)
+		endpoint, err := expandEndpoint(endpoint, runVars.with(local))
+		if err != nil {
+			logger.Error("Failed to substitute variables", "url", endpoint.URL, "error", err)
+			return result{endpoint: index, err: err}, true
+		}
+		capture := responseCaptureFromContext(ctx)
+		if capture == nil && (len(endpoint.Capture) > 0 || len(assertions[index]) > 0 || hooks[index].post != nil) {
+			capture = &responseCapture{}
+			ctx = withResponseCapture(ctx, capture)
+		}
+		if capture == nil && audit != nil {
+			capture = audit.capture()
+			ctx = withResponseCapture(ctx, capture)
+		}
+
+		headers, err := authHeaders.headers(endpoint, index)
+		if err != nil {
+			logger.Error("Error getting headers for endpoint",
+				"url", endpoint.URL,
+				"auth_enabled", endpoint.AuthConfig != nil && endpoint.AuthConfig.Enabled,
+				"error", err)
+			return result{endpoint: index, err: err}, true
+		}
+		if hooks[index].pre != nil {
+			if endpoint, headers, err = runPreRequest(hooks[index].pre, endpoint, headers, runVars.with(local), runVars); err != nil {
+				logger.Warn("Pre-request hook failed", "url", endpoint.URL, "error", err)
+				return result{endpoint: index, worker: worker, err: err}, true
 			}
-		})
-	}
-
-	// add jobs to the queue
-	go func() {
-		for range cfg.ProbingConfig.TotalRequests {
-			for _, endpoint := range cfg.ProbingConfig.Endpoints {
-				select {
-				case <-ctx.Done():
-					logger.Warn("Job queue stopped due to cancellation")
-					return
-				case jobs <- endpoint:
-					logger.Debug("Job added to queue", "method", endpoint.Method, "url", endpoint.URL)
-				}
+		}
+		var req *middleware.Request
+		if len(chain) > 0 {
+			req = &middleware.Request{Method: endpoint.Method, URL: endpoint.RequestURL(), Header: headers, Body: endpoint.Body}
+			if err := chain.BeforeSend(ctx, req); err != nil {
+				logger.Warn("Request rejected by middleware", "url", endpoint.URL, "error", err)
+				return result{endpoint: index, worker: worker, err: fmt.Errorf("%w: %w", ErrMiddleware, err)}, true
 			}
 		}
-		close(jobs)
-		logger.Debug("Job queue closed")
-	}()
 
-	// wait for all workers to finish before closing the results channel
-	go func() {
-		wg.Wait()
-		close(results)
-		logger.Debug("All workers finished, closing error and result channels")
-	}()
+		if adaptive.shed(endpoint.PriorityClass()) {
+			logger.Debug("Request shed", "url", endpoint.URL, "priority", endpoint.PriorityClass())
+			return result{endpoint: index, worker: worker, err: ErrRequestShed}, true
+		}
+		if !adaptive.acquire(ctx, endpoint.PriorityClass()) {
+			return result{}, false
+		}
+		if !maxInFlight.acquire(ctx) {
+			adaptive.abandon()
+			return result{}, false
+		}
+		if !inFlight.acquire(ctx, index) {
+			maxInFlight.abandon()
+			adaptive.abandon()
+			return result{}, false
+		}
+		reqCtx, release := requestContext(ctx, drainCtx)
+		headers = tagger.tag(headers)
+		s, err := makeRequest(withProxy(reqCtx, proxies[index]), clientWithJar(reqCtx, client), endpoint, headers, endpointTimeout(endpoint, cfg.ProbingConfig.RequestTimeoutMS), logger)
+		release()
+		inFlight.release(index)
+		maxInFlight.release(throttling(err))
+		adaptive.release(s.duration, err != nil)
+		if errors.Is(err, ErrCanceled) {
+			// an interrupted request is neither a success nor a failure of the target
+			return result{}, false
+		}
+		if req != nil {
+			resp := &middleware.Response{StatusCode: s.status, Header: s.header, Duration: s.duration, Err: err}
+			if mwErr := chain.AfterResponse(ctx, req, resp); mwErr != nil && err == nil {
+				err = fmt.Errorf("%w: %w", ErrAssertion, mwErr)
+				logger.Warn("Response rejected by middleware", "url", endpoint.URL, "error", err)
+			}
+		}
+		var statusErr *statusError
+		if errors.As(err, &statusErr) {
+			if wait := pauses.pause(index, statusErr.retryAfter); wait > 0 {
+				logger.Warn("Pausing endpoint for Retry-After", "url", endpoint.URL, "status_code", statusErr.code, "wait", wait)
+			}
+		}
+		if err == nil && len(assertions[index]) > 0 {
+			if err = checkAssertions(assertions[index], endpoint, headers, capture); err != nil {
+				logger.Warn("Assertion failed", "url", endpoint.URL, "error", err)
+			}
+		}
+		if err == nil && hooks[index].post != nil {
+			if err = runPostResponse(hooks[index].post, endpoint, headers, runVars.with(local), capture, s.duration, runVars); err != nil {
+				logger.Warn("Post-response hook failed", "url", endpoint.URL, "error", err)
+			}
+		}
+		if err == nil && len(endpoint.Capture) > 0 {
+			if err = captureVariables(endpoint.Capture, capture, local, runVars); err != nil {
+				logger.Error("Failed to capture variables", "url", endpoint.URL, "error", err)
+			}
+		}
+		return result{endpoint: index, worker: worker, sample: s, err: err, audit: audit.detail(endpoint, headers, capture)}, true
+	}
+
+	// start the virtual users, or the workers sharing the job queue of the closed or open load model
+	iterations := newEngine(cfg.ProbingConfig, scenarioOffsets, replay, control, logger).start(runCtx, &wg, send, publish)
 
-	var totalDuration time.Duration
-	count := 0
-	for duration := range results {
-		totalDuration += duration
-		count++
+	// wait for all workers to finish before closing the results channel
+	wg.Wait()
+	stopFinalize()
+	logger.Debug("All workers finished, closing result channel")
+	reason := stopReason(ctx, runCtx)
+	if reason == stopMaxDuration {
+		logger.Warn("Run stopped at max_duration after draining in-flight requests", "max_duration_ms", cfg.ProbingConfig.MaxDurationMS)
 	}
+	collector.finish(logger)
+	count := collector.successes
+
+	stopProgress()
+	stopStream()
+	stopControl()
+	stopHealth()
+	chain.Close()
+	latencies.merge(stats)
+	successCount, failureCount := counts.totals()
 
 	if count > 0 {
-		avgTime := totalDuration / time.Duration(count)
-		logger.Info("Test completed",
-			"total_requests", count, // TODO: this is misleading since it doesn't account for failed requests
-			"successful_requests", successCount,
-			"failed_requests", failureCount,
-			"duration", time.Since(startTest),
-			"avg_response_time", avgTime)
-	} else {
+		if reason == "" {
+			var latency report.Histogram
+			for _, s := range stats {
+				latency.Merge(&s.latency)
+			}
+			logger.Info("Test completed",
+				"total_requests", count, // TODO: this is misleading since it doesn't account for failed requests
+				"successful_requests", successCount,
+				"failed_requests", failureCount,
+				"duration", time.Since(startTest),
+				"avg_response_time", latency.Mean())
+		}
+		logOwnerReport(stats, logger)
+		logTrafficDistribution(stats, logger)
+		logCompressionReport(stats, logger)
+		logPhaseReport(stats, logger)
+		if cfg.ProbingConfig.Network.ReuseConnections {
+			logReuseReport(stats, logger)
+		}
+		logTransferReport(stats, time.Since(startTest), logger)
+		logBandwidthReport(traffic, cfg.ProbingConfig.Network.BandwidthLimitKbps, time.Since(startTest), logger)
+		logPacingReport(iterations.Load(), cfg.ProbingConfig.Pacing, workers, time.Since(startTest), logger)
+		logAdaptiveReport(adaptive, logger)
+		logShedReport(stats, logger)
+		logHeaderBreakdownReport(stats, logger)
+	} else if reason == "" {
 		logger.Warn("No requests were successful", "failed_requests", failureCount)
 	}
-}
+	// the failure reports are also logged when no request succeeded, the runs they are needed the most
+	logDialReport(stats, logger)
+	logErrorReport(stats, logger)
+	logJourneyReport(journeys, logger)
 
-// makeRequest makes an HTTP request to the given endpoint and sends the response time to the results channel
-func makeRequest(ctx context.Context, endpoint config.Endpoint, headers map[string]string, delay config.Delay, timeout time.Duration, results chan<- time.Duration, logger *slog.Logger) error {
-	if delay.Enabled {
-		if delay.Type == "random" {
-			sleepTime := rand.Intn(delay.Max-delay.Min) + delay.Min
-			time.Sleep(time.Duration(sleepTime) * time.Millisecond)
-		} else {
-			time.Sleep(time.Duration(delay.Fixed) * time.Millisecond)
+	duration := time.Since(startTest)
+	logBackoffReport(pauses, stats, startTest.Add(duration), duration, logger)
+	runReport := buildReport(stats, startTest, duration)
+	runReport.Traffic = traffic.report(cfg.ProbingConfig.Network.BandwidthLimitKbps, duration)
+	runReport.Adaptive = adaptive.report()
+	runReport.Backpressure = maxInFlight.report(startTest.Add(duration))
+	logBackpressureReport(runReport.Backpressure, logger)
+	runReport.Scenarios = journeys.report()
+	runReport.Seed = cfg.ProbingConfig.Seed
+	runReport.RunID = runID
+	runReport.StopReason = reason
+	runReport.HealthCheck = health.report(cfg.ProbingConfig.HealthCheck.URL, startTest.Add(duration))
+	logHealthReport(runReport.HealthCheck, logger)
+	runReport.CORS = corsResults
+	for i, s := range stats {
+		if cfg.ProbingConfig.Network.ReuseConnections {
+			runReport.Endpoints[i].Reuse = s.phases.reuse()
 		}
+		runReport.Endpoints[i].Backoff = pauses.report(i, startTest.Add(duration), duration)
+	}
+	if len(pins) > 0 {
+		runReport.PinnedHosts = pins
+	}
+	runReport.Thresholds = EvaluateThresholds(cfg.ProbingConfig.Thresholds, runReport)
+	logThresholdReport(runReport.Thresholds, logger)
+	if reason != "" {
+		logPartialReport(runReport, logger)
+	}
+	result := &ProbeResult{Report: runReport, Journeys: journeys.histograms()}
+	for _, s := range stats {
+		result.Latencies = append(result.Latencies, &s.latency)
 	}
+	runReport.SLO = EvaluateSLO(cfg.ProbingConfig.SLO, runReport, result.Latencies)
+	logSLOReport(runReport.SLO, logger)
+	return result, nil
+}
+
+// plannedRequests returns the number of requests the run makes when it is not cancelled
+func plannedRequests(probing config.ProbingConfig) int {
+	if probing.VirtualUsers.Enabled {
+		return vuRequests(probing)
+	}
+	requestsPerIteration := len(weightedSchedule(probing.Endpoints)) + scenarioRequests(probing.Scenarios)
+	return probing.TotalRequests * requestsPerIteration
+}
 
+// makeRequest makes an HTTP request to the given endpoint and returns its measurements
+func makeRequest(ctx context.Context, client *http.Client, endpoint config.Endpoint, headers map[string]string, timeout time.Duration, logger *slog.Logger) (sample, error) {
 	start := time.Now()
 
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	parent := ctx
+	ctx, cancel := context.WithTimeout(withInstance(ctx, endpoint.Instance), timeout)
 	defer cancel()
 
-	client := &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			DialContext: (&net.Dialer{
-				Timeout:   5 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			TLSHandshakeTimeout:   5 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
-	}
+	dials := &dialTrace{}
+	ctx = httptrace.WithClientTrace(ctx, dials.clientTrace())
+	phases := &phaseTrace{}
+	ctx = httptrace.WithClientTrace(ctx, phases.clientTrace())
 
 	var reqBody io.Reader
 	if endpoint.Body != "" {
 		reqBody = bytes.NewReader([]byte(endpoint.Body))
 	}
 
-	req, err := http.NewRequestWithContext(ctx, endpoint.Method, endpoint.URL, reqBody)
+	req, err := http.NewRequestWithContext(ctx, endpoint.Method, endpoint.RequestURL(), reqBody)
 	if err != nil {
 		logger.Error("Failed to create request", "url", endpoint.URL, "error", err)
-		return fmt.Errorf("failed to create request: %w", err)
+		return sample{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	for key, value := range headers {
 		req.Header.Set(key, value)
 	}
+	// after the headers, a multipart body sets the Content-Type with its boundary
+	if err := setBody(req, endpoint); err != nil {
+		logger.Error("Failed to create request body", "url", endpoint.URL, "error", err)
+		return sample{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	var compressed *compressedBody
+	if endpoint.CompressRequest != "" {
+		compressed = compressBody(req, endpoint.CompressRequest)
+	}
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", cmp.Or(endpoint.ExpectEncoding, acceptEncoding))
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
+		failed := sample{dialFailures: dials.failed()}
+		if ctxErr := requestContextError(parent, ctx, timeout, err); ctxErr != nil {
+			logger.Error("Request failed", "url", endpoint.URL, "error", ctxErr)
+			return failed, ctxErr
+		}
+		if len(failed.dialFailures) > 0 {
+			logger.Error("Request failed", "url", endpoint.URL, "error", err, "dial_attempts", dials.String())
+			return failed, fmt.Errorf("%w: %w (dial attempts: %s)", ErrRequestFailed, err, dials)
+		}
 		logger.Error("Request failed", "url", endpoint.URL, "error", err)
-		return fmt.Errorf("%w: %v", ErrRequestFailed, err)
+		return failed, fmt.Errorf("%w: %w", ErrRequestFailed, err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		logger.Warn("Received non-200 response", "url", endpoint.URL, "status_code", resp.StatusCode)
-		return fmt.Errorf("%w: status code %d", ErrStatusCode, resp.StatusCode)
+	if !endpoint.ExpectedStatus.Expected(resp.StatusCode) {
+		logger.Warn("Received unexpected status code", "url", endpoint.URL, "status_code", resp.StatusCode)
+		// the body of an error response is kept for the audit, it is not checked or captured
+		if capture := responseCaptureFromContext(ctx); capture != nil {
+			capture.status = resp.StatusCode
+			capture.header = resp.Header
+			_, _ = readBody(resp, capture)
+		}
+		return sample{status: resp.StatusCode}, &statusError{code: resp.StatusCode, retryAfter: retryAfter(resp, time.Now())}
+	}
+	if err := checkEncoding(endpoint.ExpectEncoding, resp); err != nil {
+		logger.Warn("Received unexpected content encoding", "url", endpoint.URL, "error", err)
+		return sample{}, err
 	}
 
 	elapsed := time.Since(start)
-	results <- elapsed
 
-	logger.Debug("Request successful", "url", endpoint.URL, "status_code", resp.StatusCode, "response_time", elapsed)
-	return nil
+	var dst io.Writer = io.Discard
+	if capture := responseCaptureFromContext(ctx); capture != nil {
+		capture.status = resp.StatusCode
+		capture.header = resp.Header
+		dst = capture
+	}
+	readStart := time.Now()
+	body, err := readBody(resp, dst)
+	if err != nil {
+		logger.Error("Failed to read response body", "url", endpoint.URL, "error", err)
+		if ctxErr := requestContextError(parent, ctx, timeout, err); ctxErr != nil {
+			return sample{}, ctxErr
+		}
+		return sample{}, fmt.Errorf("%w: %w", ErrRequestFailed, err)
+	}
+
+	logger.Debug("Request successful", "url", endpoint.URL, "status_code", resp.StatusCode, "response_time", elapsed,
+		"content_encoding", body.encoding, "wire_bytes", body.wire, "dial_attempts", dials.String())
+	timings := phases.timings()
+	timings.bodyRead = time.Since(readStart)
+	timings.decompress = body.decompress
+	sent := max(req.ContentLength, 0)
+	if compressed != nil {
+		sent = compressed.sent.Load()
+	}
+	return sample{duration: elapsed, encoding: body.encoding, wireBytes: body.wire, decodedBytes: body.decoded, dialFailures: dials.failed(),
+		phases: timings, sentBytes: sent, header: resp.Header, status: resp.StatusCode}, nil
+}
+
+// requestContextError wraps err in ErrCanceled when the run was cancelled, or in ErrTimeout when the request
+// exceeded its timeout. It returns nil when the request context did not end
+func requestContextError(parent, ctx context.Context, timeout time.Duration, err error) error {
+	switch {
+	case parent.Err() != nil:
+		return fmt.Errorf("%w: %w", ErrCanceled, err)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w after %s: %w", ErrTimeout, timeout, err)
+	default:
+		return nil
+	}
+}
+
+// delayDuration returns the time to wait for the given delay configuration, random delays and jitter are drawn from
+// rng
+func delayDuration(delay config.Delay, rng *rand.Rand) time.Duration {
+	if !delay.Enabled {
+		return 0
+	}
+	var ms float64
+	switch delay.Type {
+	case config.DelayRandom:
+		ms = float64(randIntN(rng, delay.Max-delay.Min) + delay.Min)
+	case config.DelayExponential:
+		ms = boundDelay(randExpFloat64(rng)*float64(delay.Mean), delay)
+	case config.DelayNormal:
+		ms = boundDelay(randNormFloat64(rng)*float64(delay.StdDev)+float64(delay.Mean), delay)
+	default:
+		ms = float64(delay.Fixed)
+	}
+	if delay.Jitter > 0 {
+		ms += float64(randIntN(rng, 2*delay.Jitter+1) - delay.Jitter)
+	}
+	return time.Duration(max(ms, 0) * float64(time.Millisecond))
+}
+
+// boundDelay limits a delay drawn from a distribution to min and, when it is set, max
+func boundDelay(ms float64, delay config.Delay) float64 {
+	ms = max(ms, float64(delay.Min))
+	if delay.Max > 0 {
+		ms = min(ms, float64(delay.Max))
+	}
+	return ms
 }
 
 // getHeadersForEndpoint returns the headers to be used for the given endpoint
@@ -203,7 +624,7 @@ func getHeadersForEndpoint(endpoint config.Endpoint, globalAuth *config.AuthConf
 		}
 	}
 
-	headers["User-Agent"] = "Mozilla/5.0 (compatible; EnchanteBot/1.0)"
+	headers["User-Agent"] = userAgent
 
 	return headers, nil
 }
@@ -1,9 +1,21 @@
 package probe
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -46,7 +58,8 @@ func TestProbeAgainstLocalServer(t *testing.T) {
 	}
 
 	start := time.Now()
-	RunProbe(t.Context(), cfg, testutil.Logger)
+	_, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
 	elapsed := time.Since(start)
 
 	assert.Greater(t, elapsed, time.Duration(0), "Probe should have taken > 0s")
@@ -134,10 +147,1362 @@ func TestProbeWithAuthOverrides(t *testing.T) {
 		},
 	}
 
-	RunProbe(t.Context(), cfg, testutil.Logger)
+	_, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
 
 	assert.Equal(t, 3, len(receivedHeaders), "Expected 3 requests to be made")
 	assert.Equal(t, "Bearer "+globalToken, receivedHeaders[0], "Expected first request to use global auth token")
 	assert.Equal(t, "", receivedHeaders[1], "Expected second request to send no Authorization header")
 	assert.Equal(t, "Bearer "+endpointToken, receivedHeaders[2], "Expected third request to use endpoint-specific auth token")
 }
+
+func TestProbeThroughProxy(t *testing.T) {
+	var proxiedURLs, proxyAuth []string
+	var directCount int
+	var mu sync.Mutex
+
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxiedURLs = append(proxiedURLs, r.URL.String())
+		proxyAuth = append(proxyAuth, r.Header.Get("Proxy-Authorization"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxyServer.Close()
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		directCount++
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      1,
+			RequestTimeoutMS:   1000,
+			Proxy: config.ProxyConfig{
+				Enabled:  true,
+				URL:      proxyServer.URL,
+				Username: "proxy-user",
+				Password: "proxy-pass",
+			},
+			Endpoints: []config.Endpoint{
+				// global proxy should be used
+				{URL: apiServer.URL + "/proxied", Method: "GET"},
+				// proxy disabled for this endpoint
+				{URL: apiServer.URL + "/direct", Method: "GET", Proxy: &config.ProxyConfig{Enabled: false}},
+			},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, runReport.SuccessfulRequests)
+	assert.Equal(t, []string{apiServer.URL + "/proxied"}, proxiedURLs, "Expected the request to be sent through the proxy")
+	assert.Equal(t, []string{"Basic cHJveHktdXNlcjpwcm94eS1wYXNz"}, proxyAuth, "Expected proxy credentials to be sent")
+	assert.Equal(t, 1, directCount, "Expected the endpoint without proxy to connect directly")
+}
+
+func TestProbeEndpointOverrides(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	var listCount, uploadCount atomic.Int32
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/list":
+			listCount.Add(1)
+		case "/upload":
+			uploadCount.Add(1)
+			current := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				observed := maxInFlight.Load()
+				if current <= observed || maxInFlight.CompareAndSwap(observed, current) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 8,
+			TotalRequests:      4,
+			RequestTimeoutMS:   50,
+			Endpoints: []config.Endpoint{
+				{URL: apiServer.URL + "/list", Method: "GET", Weight: 3},
+				{URL: apiServer.URL + "/upload", Method: "POST", TimeoutMS: 1000, MaxInFlight: 2},
+				// the global timeout applies to endpoints without an override
+				{URL: apiServer.URL + "/slow", Method: "GET"},
+			},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(12), listCount.Load(), "Expected the weight to triple the requests")
+	assert.Equal(t, int32(4), uploadCount.Load())
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(2), "Expected at most 2 concurrent uploads")
+	assert.Equal(t, 4, runReport.Endpoints[1].SuccessfulRequests, "Expected the endpoint timeout to allow slow uploads")
+	assert.Equal(t, 4, runReport.Endpoints[2].FailedRequests, "Expected the global timeout for the slow endpoint")
+}
+
+func TestProbeProgressWebhook(t *testing.T) {
+	var updates []progressUpdate
+	var authHeaders []string
+	var mu sync.Mutex
+
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var u progressUpdate
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&u))
+		mu.Lock()
+		updates = append(updates, u)
+		authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookServer.Close()
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      5,
+			RequestTimeoutMS:   1000,
+			ProgressWebhook: config.WebhookConfig{
+				URL:        webhookServer.URL,
+				IntervalMS: 20,
+				Headers:    map[string]string{"Authorization": "Bearer bot-token"},
+			},
+			Endpoints: []config.Endpoint{
+				{URL: apiServer.URL + "/ok", Method: "GET", Weight: 3},
+				{URL: apiServer.URL + "/fail", Method: "GET"},
+			},
+		},
+	}
+
+	_, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Greater(t, len(updates), 1, "Expected periodic updates before the final update")
+	for _, u := range updates[:len(updates)-1] {
+		assert.False(t, u.Done)
+		assert.Equal(t, int64(20), u.TotalRequests)
+	}
+
+	final := updates[len(updates)-1]
+	assert.True(t, final.Done)
+	assert.Equal(t, int64(20), final.CompletedRequests)
+	assert.Equal(t, int64(5), final.FailedRequests)
+	assert.Equal(t, 100.0, final.PercentComplete)
+	assert.Equal(t, 0.25, final.ErrorRate)
+	assert.Greater(t, final.CurrentRPS, 0.0)
+	assert.Equal(t, "Bearer bot-token", authHeaders[0])
+}
+
+func TestProbeScenario(t *testing.T) {
+	var requests []string
+	var mu sync.Mutex
+	var nextID atomic.Int32
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("X-Session"))
+		mu.Unlock()
+
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/items":
+			id := nextID.Add(1)
+			w.Header().Set("X-Session", fmt.Sprintf("session-%d", id))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"item": {"id": %d}}`, id)
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/items/"):
+			w.WriteHeader(http.StatusOK)
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/items/"):
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      2,
+			RequestTimeoutMS:   1000,
+			Scenarios: []config.Scenario{
+				{
+					Name: "crud",
+					Steps: []config.Step{
+						{
+							Name:     "create",
+							Endpoint: config.Endpoint{URL: apiServer.URL + "/items", Method: "POST"},
+							Extract: []config.Extraction{
+								{Name: "id", JSON: "$.item.id"},
+								{Name: "session", Header: "X-Session"},
+							},
+						},
+						{
+							Name:     "get",
+							Endpoint: config.Endpoint{URL: apiServer.URL + "/items/{{id}}", Method: "GET", Headers: map[string]string{"X-Session": "{{session}}"}},
+						},
+						{
+							Name:     "delete",
+							Endpoint: config.Endpoint{URL: apiServer.URL + "/items/{{id}}", Method: "DELETE"},
+						},
+					},
+				},
+				{
+					Name: "broken",
+					Steps: []config.Step{
+						{Name: "missing", Endpoint: config.Endpoint{URL: apiServer.URL + "/missing", Method: "GET"}},
+						{Name: "never", Endpoint: config.Endpoint{URL: apiServer.URL + "/items/1", Method: "GET"}},
+					},
+				},
+			},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"POST /items ", "GET /items/1 session-1", "DELETE /items/1 ",
+		"GET /missing ",
+		"POST /items ", "GET /items/2 session-2", "DELETE /items/2 ",
+		"GET /missing ",
+	}, requests)
+
+	assert.Len(t, runReport.Endpoints, 5)
+	get := runReport.Endpoints[1]
+	assert.Equal(t, "crud", get.Scenario)
+	assert.Equal(t, "get", get.Step)
+	assert.Equal(t, apiServer.URL+"/items/{{id}}", get.URL, "Expected steps to be reported by their URL template")
+	assert.Equal(t, 2, get.SuccessfulRequests)
+
+	never := runReport.Endpoints[4]
+	assert.Equal(t, 0, never.SuccessfulRequests+never.FailedRequests)
+	assert.Equal(t, 2, never.SkippedRequests, "Expected steps after a failed step to be skipped")
+	assert.Equal(t, 6, runReport.SuccessfulRequests)
+	assert.Equal(t, 2, runReport.FailedRequests)
+
+	assert.Len(t, runReport.Scenarios, 2)
+	assert.Equal(t, 2, runReport.Scenarios[0].SuccessfulIterations)
+	assert.Positive(t, runReport.Scenarios[0].Latency.AvgMS)
+	assert.Equal(t, 2, runReport.Scenarios[1].FailedIterations, "Expected an iteration with a failed step to fail")
+}
+
+func TestProbeAdaptiveConcurrency(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			observed := maxInFlight.Load()
+			if current <= observed || maxInFlight.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 4,
+			TotalRequests:      10,
+			RequestTimeoutMS:   1000,
+			Adaptive:           config.AdaptiveConfig{Enabled: true, TargetLatencyMS: 1000},
+			Endpoints:          []config.Endpoint{{URL: apiServer.URL, Method: "GET"}},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 10, runReport.SuccessfulRequests)
+	assert.NotNil(t, runReport.Adaptive)
+	assert.Equal(t, 1000, runReport.Adaptive.TargetLatencyMS)
+	assert.Greater(t, runReport.Adaptive.FinalConcurrency, 1, "Expected the concurrency to grow within the target")
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(4))
+}
+
+func TestProbeVirtualUsers(t *testing.T) {
+	var requests []string
+	var mu sync.Mutex
+	var nextUser atomic.Int32
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie := ""
+		if c, err := r.Cookie("user"); err == nil {
+			cookie = c.Value
+		}
+
+		switch r.URL.Path {
+		case "/login":
+			user := cookie
+			if user == "" {
+				user = fmt.Sprintf("%d", nextUser.Add(1))
+				http.SetCookie(w, &http.Cookie{Name: "user", Value: user})
+			}
+			fmt.Fprintf(w, `{"user": "%s"}`, user)
+		case "/profile":
+			mu.Lock()
+			requests = append(requests, cookie+" "+r.Header.Get("X-User"))
+			mu.Unlock()
+			if cookie == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      1,
+			RequestTimeoutMS:   1000,
+			VirtualUsers:       config.VirtualUsers{Enabled: true, Count: 3, Iterations: 2, RampUpMS: 90},
+			Scenarios: []config.Scenario{
+				{
+					Name: "session",
+					Steps: []config.Step{
+						{
+							Name:     "login",
+							Endpoint: config.Endpoint{URL: apiServer.URL + "/login", Method: "GET"},
+							Extract:  []config.Extraction{{Name: "user", JSON: "$.user"}},
+						},
+						{
+							Name:     "profile",
+							Endpoint: config.Endpoint{URL: apiServer.URL + "/profile", Method: "GET", Headers: map[string]string{"X-User": "{{user}}"}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	start := time.Now()
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond, "Expected the start of the virtual users to be spread over the ramp up")
+	assert.Equal(t, int32(3), nextUser.Load(), "Expected each virtual user to keep its cookie across iterations")
+	assert.Len(t, requests, 6)
+	for _, request := range requests {
+		cookie, user, _ := strings.Cut(request, " ")
+		assert.NotEmpty(t, cookie)
+		assert.Equal(t, cookie, user, "Expected each virtual user to use its own cookie jar and variables")
+	}
+	assert.Equal(t, 12, runReport.SuccessfulRequests)
+	assert.Equal(t, 0, runReport.FailedRequests)
+}
+
+func TestProbeCaptureVariables(t *testing.T) {
+	var authorized, unauthorized atomic.Int32
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token": "secret-token"}`)
+		case "/data":
+			if r.Header.Get("Authorization") != "Bearer secret-token" {
+				unauthorized.Add(1)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			authorized.Add(1)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      3,
+			RequestTimeoutMS:   1000,
+			Endpoints: []config.Endpoint{
+				{
+					URL:     apiServer.URL + "/token",
+					Method:  "POST",
+					Capture: []config.Capture{{Extraction: config.Extraction{Name: "token", JSON: "$.access_token"}}},
+				},
+				{
+					URL:     apiServer.URL + "/data",
+					Method:  "GET",
+					Headers: map[string]string{"Authorization": "Bearer {{token}}"},
+				},
+			},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(3), authorized.Load(), "Expected the captured token to be handed off to later requests")
+	assert.Equal(t, int32(0), unauthorized.Load())
+	assert.Equal(t, 6, runReport.SuccessfulRequests)
+}
+
+func TestProbeSamplesFile(t *testing.T) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer apiServer.Close()
+
+	samplesFile := filepath.Join(t.TempDir(), "samples.ndjson")
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 2,
+			TotalRequests:      50,
+			RequestTimeoutMS:   1000,
+			SamplesFile:        samplesFile,
+			Endpoints: []config.Endpoint{
+				{URL: apiServer.URL + "/ok", Method: "GET"},
+				{URL: apiServer.URL + "/fail", Method: "GET"},
+			},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	// the results channel holds far fewer results than the run makes
+	assert.Equal(t, 100, runReport.TotalRequests)
+
+	data, err := os.ReadFile(samplesFile)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 100, "Expected a sample per request")
+
+	failed := 0
+	for _, line := range lines {
+		var record resultRecord
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		if !record.Success {
+			failed++
+			assert.Equal(t, apiServer.URL+"/fail", record.URL)
+			assert.NotEmpty(t, record.Error)
+		}
+	}
+	assert.Equal(t, 50, failed)
+}
+
+func TestProbeLatencyBreakdown(t *testing.T) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      5,
+			RequestTimeoutMS:   1000,
+			Endpoints: []config.Endpoint{
+				{URL: apiServer.URL, Method: "GET"},
+			},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	phases := runReport.Endpoints[0].Phases
+	assert.Equal(t, 5, phases.NewConnections, "Expected a new connection per request without keep-alive")
+	assert.Positive(t, phases.Connect.MaxMS)
+	assert.GreaterOrEqual(t, phases.TTFB.MinMS, 20.0, "Expected the server delay in the time to first byte")
+	assert.Less(t, phases.BodyRead.MaxMS, 20.0)
+}
+
+func TestProbeExpectedStatus(t *testing.T) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 2,
+			TotalRequests:      4,
+			RequestTimeoutMS:   1000,
+			Endpoints: []config.Endpoint{
+				{URL: apiServer.URL + "/missing", Method: "GET", ExpectedStatus: config.StatusCodes{{Min: 404, Max: 404}}},
+				{URL: apiServer.URL + "/created", Method: "GET", ExpectedStatus: config.StatusCodes{{Min: 200, Max: 200}}},
+			},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 4, runReport.Endpoints[0].SuccessfulRequests, "Expected the 404 responses to count as success")
+	assert.Equal(t, 4, runReport.Endpoints[1].FailedRequests, "Expected the unlisted 201 responses to fail")
+	assert.Equal(t, map[string]int{errorStatusUnexpected: 4}, runReport.Errors)
+}
+
+func TestProbeAssertions(t *testing.T) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status": "degraded", "items": [{"id": 7}]}`)
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 2,
+			TotalRequests:      3,
+			RequestTimeoutMS:   1000,
+			Endpoints: []config.Endpoint{
+				{URL: apiServer.URL + "/ok", Method: "GET", Assertions: []config.Assertion{
+					{Type: "header", Header: "Content-Type", Contains: "json"},
+					{Type: "json", Path: "$.items[0].id", Equals: "7"},
+				}},
+				{URL: apiServer.URL + "/health", Method: "GET", Assertions: []config.Assertion{
+					{Type: "json", Path: "$.status", Equals: "ok"},
+				}},
+			},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, runReport.Endpoints[0].SuccessfulRequests)
+	assert.Equal(t, 3, runReport.Endpoints[1].FailedRequests, "Expected the degraded responses to fail the assertion")
+	assert.Equal(t, map[string]int{errorAssertion: 3}, runReport.Errors)
+}
+
+func TestProbeUnknownAssertion(t *testing.T) {
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      1,
+			Endpoints: []config.Endpoint{
+				{URL: "http://localhost/", Method: "GET", Assertions: []config.Assertion{{Type: "checksum"}}},
+			},
+		},
+	}
+
+	result, err := RunProbe(t.Context(), cfg, testutil.Logger)
+
+	assert.Nil(t, result, "Expected no requests with an unknown assertion type")
+	assert.ErrorContains(t, err, `unknown assertion type "checksum"`)
+}
+
+func TestProbeRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      3,
+			RequestTimeoutMS:   1000,
+			RetryAfter:         config.RetryAfterConfig{Enabled: true, MaxWaitMS: 200},
+			Endpoints:          []config.Endpoint{{URL: apiServer.URL, Method: "GET"}},
+		},
+	}
+
+	start := time.Now()
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond, "Expected the endpoint to be paused")
+	assert.Equal(t, 1, runReport.FailedRequests)
+	assert.Equal(t, 2, runReport.SuccessfulRequests)
+	backoff := runReport.Endpoints[0].Backoff
+	if assert.NotNil(t, backoff) {
+		assert.Equal(t, 1, backoff.Pauses)
+		assert.InDelta(t, 200, backoff.PausedMS, 10)
+		assert.Greater(t, backoff.PausedShare, 0.5)
+	}
+}
+
+func TestProbeMaxDuration(t *testing.T) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer apiServer.Close()
+
+	tests := []struct {
+		name          string
+		drainMS       int
+		minSuccessful int
+		maxElapsed    time.Duration
+	}{
+		{name: "Drained", drainMS: 1000, minSuccessful: 4, maxElapsed: 500 * time.Millisecond},
+		{name: "Drain Timeout", drainMS: 10, minSuccessful: 2, maxElapsed: 300 * time.Millisecond},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{
+				ProbingConfig: config.ProbingConfig{
+					ConcurrentRequests: 2,
+					TotalRequests:      100,
+					RequestTimeoutMS:   1000,
+					MaxDurationMS:      150,
+					DrainTimeoutMS:     tc.drainMS,
+					Endpoints:          []config.Endpoint{{URL: apiServer.URL, Method: "GET"}},
+				},
+			}
+
+			start := time.Now()
+			runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+			assert.NoError(t, err)
+
+			assert.Less(t, time.Since(start), tc.maxElapsed)
+			assert.Equal(t, "max_duration", runReport.StopReason)
+			assert.GreaterOrEqual(t, runReport.SuccessfulRequests, tc.minSuccessful)
+			assert.Less(t, runReport.SuccessfulRequests, 100)
+			assert.Zero(t, runReport.FailedRequests, "Expected requests interrupted by the drain timeout not to count as failures")
+		})
+	}
+}
+
+func TestProbeCancellationSummary(t *testing.T) {
+	var requests atomic.Int32
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 5 {
+			cancel()
+		}
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      1000,
+			RequestTimeoutMS:   1000,
+			Endpoints: []config.Endpoint{
+				{URL: apiServer.URL + "/ok", Method: "GET"},
+				{URL: apiServer.URL + "/fail", Method: "GET"},
+			},
+		},
+	}
+
+	runReport, err := RunProbe(ctx, cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "canceled", runReport.StopReason)
+	assert.Equal(t, 5, runReport.TotalRequests, "Expected the request in flight at the cancellation to be drained")
+	assert.Equal(t, 2, runReport.Errors["status_5xx"])
+	logs := testutil.GetLogs()
+	assert.Contains(t, logs, "Run stopping, draining in-flight requests before the partial report")
+	assert.Contains(t, logs, "Partial report")
+}
+
+func TestProbeResult(t *testing.T) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      2,
+			RequestTimeoutMS:   1000,
+			Endpoints: []config.Endpoint{
+				{URL: apiServer.URL + "/ok", Method: "GET"},
+				{URL: apiServer.URL + "/fail", Method: "GET"},
+			},
+		},
+	}
+
+	result, err := RunProbe(t.Context(), cfg, testutil.Logger)
+
+	assert.NoError(t, err)
+	assert.True(t, result.Failed())
+	assert.Equal(t, 2, result.SuccessfulRequests)
+	assert.Equal(t, 2, result.FailedRequests)
+	assert.Equal(t, map[string]int{"status_5xx": 2}, result.Errors)
+	if assert.Len(t, result.Endpoints, 2) {
+		assert.Equal(t, 2, result.Endpoints[0].SuccessfulRequests)
+		assert.Equal(t, 2, result.Endpoints[1].FailedRequests)
+	}
+}
+
+func TestProbeSetupError(t *testing.T) {
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      1,
+			SamplesFile:        filepath.Join(t.TempDir(), "missing", "samples.ndjson"),
+			Endpoints:          []config.Endpoint{{URL: "http://localhost/", Method: "GET"}},
+		},
+	}
+
+	result, err := RunProbe(t.Context(), cfg, testutil.Logger)
+
+	assert.Nil(t, result)
+	assert.ErrorContains(t, err, "error creating samples file")
+}
+
+func TestProbeRunIDHeader(t *testing.T) {
+	var mu sync.Mutex
+	var values []string
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		values = append(values, r.Header.Get("X-Probe-Run"))
+		mu.Unlock()
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 2,
+			TotalRequests:      5,
+			RequestTimeoutMS:   1000,
+			RunIDHeader:        "X-Probe-Run",
+			Endpoints:          []config.Endpoint{{URL: apiServer.URL, Method: "GET"}},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.NotEmpty(t, runReport.RunID)
+	var sequences []string
+	for _, v := range values {
+		runID, seq, _ := strings.Cut(v, "/")
+		assert.Equal(t, runReport.RunID, runID)
+		sequences = append(sequences, seq)
+	}
+	assert.ElementsMatch(t, []string{"1", "2", "3", "4", "5"}, sequences)
+}
+
+func TestProbeEndpointRamp(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	var mu sync.Mutex
+	requests := map[string]int{}
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Path == "/write" {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      30,
+			RequestTimeoutMS:   1000,
+			Endpoints: []config.Endpoint{
+				{URL: apiServer.URL + "/read", Method: "GET"},
+				{URL: apiServer.URL + "/write", Method: "POST", Weight: 2, Ramp: &config.Ramp{StartWorkers: 1, EndWorkers: 4, DurationMS: 150}},
+			},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 90, runReport.SuccessfulRequests)
+	assert.Equal(t, map[string]int{"/read": 30, "/write": 60}, requests)
+	assert.Equal(t, int32(4), peak.Load(), "Expected the ramp to reach its end workers")
+}
+
+func TestProbeTransfer(t *testing.T) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write(bytes.Repeat([]byte("x"), 1000))
+	}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 2,
+			TotalRequests:      4,
+			RequestTimeoutMS:   1000,
+			Endpoints: []config.Endpoint{
+				{URL: apiServer.URL, Method: "POST", Body: strings.Repeat("y", 100)},
+			},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	transfer := runReport.Endpoints[0].Transfer
+	assert.Equal(t, int64(400), transfer.RequestBytes)
+	assert.Equal(t, int64(4000), transfer.ResponseBytes)
+	assert.Equal(t, 1000.0, transfer.AvgResponseBytes)
+	assert.Positive(t, transfer.ResponseMBps)
+	assert.Positive(t, runReport.Traffic.IngressMBps)
+}
+
+func TestProbePinDNS(t *testing.T) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer apiServer.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      2,
+			RequestTimeoutMS:   1000,
+			Network:            config.NetworkConfig{PinDNS: true},
+			Endpoints: []config.Endpoint{
+				{URL: strings.Replace(apiServer.URL, "127.0.0.1", "localhost", 1), Method: "GET"},
+			},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, runReport.SuccessfulRequests)
+	assert.Contains(t, runReport.PinnedHosts, "localhost", "Expected the pinned addresses in the report")
+}
+
+func TestProbeServiceRegistry(t *testing.T) {
+	var hits [2]atomic.Int32
+	var instances []string
+	for i := range hits {
+		instance := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/health", r.URL.Path)
+			assert.Equal(t, "orders", r.Host, "Expected the host of the configured URL")
+			hits[i].Add(1)
+		}))
+		defer instance.Close()
+		instances = append(instances, instance.Listener.Addr().String())
+	}
+
+	var token, query string
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/health/service/orders", r.URL.Path)
+		token = r.Header.Get("X-Consul-Token")
+		query = r.URL.RawQuery
+		var entries []map[string]any
+		for _, addr := range instances {
+			host, port, _ := net.SplitHostPort(addr)
+			portNumber, _ := strconv.Atoi(port)
+			// the first instance has no service address and is reached on its node
+			service := map[string]any{"Address": host, "Port": portNumber}
+			if len(entries) == 0 {
+				service["Address"] = ""
+			}
+			entries = append(entries, map[string]any{"Node": map[string]any{"Address": host}, "Service": service})
+		}
+		json.NewEncoder(w).Encode(entries)
+	}))
+	defer consul.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      2,
+			RequestTimeoutMS:   1000,
+			Registry:           config.RegistryConfig{Consul: config.ConsulConfig{Address: consul.URL, Token: "secret", Datacenter: "dc1"}},
+			Endpoints: []config.Endpoint{
+				{URL: "http://orders/health", Method: "GET", Service: "orders"},
+			},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "secret", token)
+	assert.Equal(t, "dc=dc1&passing=true", query, "Expected only passing instances of the datacenter")
+	assert.Equal(t, 4, runReport.SuccessfulRequests, "Expected every instance to be probed")
+	if assert.Len(t, runReport.Endpoints, 2) {
+		for _, endpoint := range runReport.Endpoints {
+			assert.Equal(t, "orders", endpoint.Service)
+			assert.Equal(t, "http://orders/health", endpoint.URL)
+			assert.Equal(t, 2, endpoint.SuccessfulRequests)
+		}
+		slices.Sort(instances)
+		assert.Equal(t, instances, []string{runReport.Endpoints[0].Instance, runReport.Endpoints[1].Instance})
+	}
+	assert.Equal(t, int32(2), hits[0].Load())
+	assert.Equal(t, int32(2), hits[1].Load())
+}
+
+func TestProbeServiceWithoutInstances(t *testing.T) {
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	defer consul.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      1,
+			Registry:           config.RegistryConfig{Consul: config.ConsulConfig{Address: consul.URL}},
+			Endpoints:          []config.Endpoint{{URL: "http://orders/health", Method: "GET", Service: "orders"}},
+		},
+	}
+
+	result, err := RunProbe(t.Context(), cfg, testutil.Logger)
+
+	assert.Nil(t, result, "Expected the run to stop before sending requests")
+	assert.ErrorContains(t, err, "service orders has no healthy instances")
+}
+
+func TestProbeHealthCheckPause(t *testing.T) {
+	var healthy atomic.Bool
+	var unhealthyRequests atomic.Int32
+	healthServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer healthServer.Close()
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			unhealthyRequests.Add(1)
+		}
+	}))
+	defer apiServer.Close()
+	time.AfterFunc(150*time.Millisecond, func() { healthy.Store(true) })
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 2,
+			TotalRequests:      5,
+			RequestTimeoutMS:   1000,
+			HealthCheck:        config.HealthCheck{URL: healthServer.URL, IntervalMS: 20},
+			Endpoints:          []config.Endpoint{{URL: apiServer.URL, Method: "GET"}},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 5, runReport.SuccessfulRequests)
+	assert.Zero(t, unhealthyRequests.Load(), "Expected no requests while the target is unhealthy")
+	if assert.NotNil(t, runReport.HealthCheck) {
+		assert.Equal(t, 1, runReport.HealthCheck.Pauses)
+		assert.GreaterOrEqual(t, runReport.HealthCheck.FailedChecks, 1)
+		assert.GreaterOrEqual(t, runReport.HealthCheck.PausedMS, 100.0)
+	}
+	assert.Contains(t, testutil.GetLogs(), "Target healthy, resuming the load")
+}
+
+func TestSweep(t *testing.T) {
+	var preflight http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodOptions {
+			preflight = r.Header.Clone()
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			w.Header().Set("Access-Control-Allow-Headers", "x-tenant")
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			RequestTimeoutMS: 1000,
+			Endpoints: []config.Endpoint{
+				{URL: server.URL + "/users", Method: "POST", Headers: map[string]string{"X-Tenant": "a"}},
+				{URL: server.URL + "/missing", Method: "GET"},
+				{URL: server.URL + "/users/{{id}}", Method: "GET"},
+			},
+		},
+	}
+
+	results, err := Sweep(t.Context(), cfg, SweepOptions{Origin: "https://app.example.com"}, testutil.Logger)
+	assert.NoError(t, err)
+
+	if assert.Len(t, results, 2, "Expected the endpoint with a variable to be skipped") {
+		users := results[0]
+		assert.Equal(t, http.StatusOK, users.HeadStatus)
+		assert.Equal(t, http.StatusNoContent, users.OptionsStatus)
+		assert.Equal(t, []string{"GET", "HEAD", "POST"}, users.Allow)
+		assert.Equal(t, "https://app.example.com", users.AllowOrigin)
+		assert.Equal(t, []string{"GET", "POST"}, users.AllowMethods)
+		assert.Equal(t, []string{"x-tenant"}, users.AllowHeaders)
+		assert.False(t, users.Failed())
+
+		assert.Equal(t, http.StatusNotFound, results[1].HeadStatus)
+		assert.True(t, results[1].Failed())
+	}
+
+	assert.Equal(t, "https://app.example.com", preflight.Get("Origin"))
+	assert.Equal(t, "POST", preflight.Get("Access-Control-Request-Method"))
+	assert.Equal(t, "x-tenant", preflight.Get("Access-Control-Request-Headers"))
+	assert.Empty(t, preflight.Get("X-Tenant"), "Expected the preflight to carry no endpoint headers")
+}
+
+func TestProbeCORSCheck(t *testing.T) {
+	var preflights atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions {
+			return
+		}
+		preflights.Add(1)
+		if r.URL.Path == "/allowed" {
+			w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+			w.Header().Set("Access-Control-Allow-Methods", r.Header.Get("Access-Control-Request-Method"))
+			w.Header().Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	check := &config.CORSCheck{Origin: "https://app.example.com", Method: "PUT", Headers: []string{"X-Tenant"}}
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      2,
+			RequestTimeoutMS:   1000,
+			Endpoints: []config.Endpoint{
+				{URL: server.URL + "/allowed", Method: "GET", CORS: check},
+				{URL: server.URL + "/denied", Method: "GET", CORS: check},
+				{URL: server.URL + "/unchecked", Method: "GET"},
+			},
+		},
+	}
+
+	result, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(2), preflights.Load(), "Expected one preflight per checked endpoint")
+	assert.Equal(t, 6, result.SuccessfulRequests)
+	if assert.Len(t, result.CORS, 2) {
+		assert.True(t, result.CORS[0].Passed())
+		assert.Equal(t, http.StatusNoContent, result.CORS[1].Status)
+		assert.Equal(t, []string{
+			"Access-Control-Allow-Origin is missing",
+			"method PUT is not in Access-Control-Allow-Methods",
+			"header X-Tenant is not in Access-Control-Allow-Headers",
+		}, result.CORS[1].Failures)
+	}
+	assert.True(t, result.Failed(), "Expected a failed CORS check to fail the run")
+}
+
+func TestProbeHeaderBreakdown(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1)%2 == 0 {
+			w.Header().Set("X-Cache", "HIT")
+			return
+		}
+		w.Header().Set("X-Cache", "MISS")
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      6,
+			RequestTimeoutMS:   1000,
+			BreakdownHeaders:   []string{"X-Cache"},
+			Endpoints:          []config.Endpoint{{URL: server.URL, Method: "GET"}},
+		},
+	}
+
+	result, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	breakdown := result.Endpoints[0].HeaderBreakdown["X-Cache"]
+	assert.Equal(t, int64(3), breakdown["HIT"].Requests)
+	assert.Equal(t, int64(3), breakdown["MISS"].Requests)
+	assert.Greater(t, breakdown["MISS"].Latency.AvgMS, breakdown["HIT"].Latency.AvgMS)
+	assert.Contains(t, testutil.GetLogs(), "Header breakdown")
+}
+
+func TestProbeAudit(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("upstream timeout"))
+			return
+		}
+		w.Write([]byte(`{"items":[1,2,3]}`))
+	}))
+	defer server.Close()
+
+	auditFile := filepath.Join(t.TempDir(), "audit.ndjson")
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      2,
+			RequestTimeoutMS:   1000,
+			Audit:              config.AuditConfig{File: auditFile, BodyBytes: 10},
+			Endpoints: []config.Endpoint{{
+				URL:         server.URL + "/items",
+				Method:      "POST",
+				Body:        `{"name":"item"}`,
+				Headers:     map[string]string{"Authorization": "Bearer token", "X-Tenant": "acme"},
+				QueryParams: map[string]string{"page": "1"},
+			}},
+		},
+	}
+
+	_, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(auditFile)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 2)
+
+	var failed, succeeded map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &failed))
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &succeeded))
+
+	assert.Equal(t, server.URL+"/items?page=1", failed["request_url"])
+	headers := failed["request_headers"].(map[string]any)
+	assert.Equal(t, "[REDACTED]", headers["Authorization"])
+	assert.Equal(t, "acme", headers["X-Tenant"])
+	assert.Equal(t, `{"name":"i`, failed["request_body"])
+	assert.Equal(t, float64(http.StatusInternalServerError), failed["status"])
+	assert.Equal(t, "upstream t", failed["response_body"], "the body of an error response is kept")
+	assert.Equal(t, float64(16), failed["response_bytes"])
+	assert.Equal(t, true, failed["truncated"])
+	assert.Equal(t, false, failed["success"])
+	assert.NotEmpty(t, failed["error"])
+	assert.Equal(t, []any{"[REDACTED]"}, failed["response_headers"].(map[string]any)["Set-Cookie"])
+
+	assert.Equal(t, float64(http.StatusOK), succeeded["status"])
+	assert.Equal(t, `{"items":[`, succeeded["response_body"])
+	assert.Equal(t, true, succeeded["success"])
+}
+
+func TestProbeStatsD(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	statsd, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	defer statsd.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      3,
+			RequestTimeoutMS:   1000,
+			Metrics:            config.MetricsConfig{StatsD: config.StatsDConfig{Address: statsd.LocalAddr().String()}},
+			Endpoints:          []config.Endpoint{{URL: server.URL, Method: "GET"}},
+		},
+	}
+
+	_, err = RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	buf := make([]byte, 65536)
+	statsd.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := statsd.Read(buf)
+	assert.NoError(t, err)
+	packet := string(buf[:n])
+	assert.Equal(t, 3, strings.Count(packet, "enchante.requests:1|c|#endpoint:GET_"+strings.TrimPrefix(server.URL, "http://")+",method:GET,success:true,status:200"))
+	assert.Equal(t, 3, strings.Count(packet, "enchante.response_time:"))
+}
+
+func TestProbeInfluxDB(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	var points []string
+	influx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		points = append(points, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influx.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      3,
+			RequestTimeoutMS:   1000,
+			Metrics:            config.MetricsConfig{InfluxDB: config.InfluxDBConfig{URL: influx.URL, Database: "load"}},
+			Endpoints:          []config.Endpoint{{URL: server.URL, Method: "GET"}},
+		},
+	}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Len(t, points, 3)
+	for _, point := range points {
+		assert.True(t, strings.HasPrefix(point, `enchante_request,endpoint=GET\ `+strings.TrimPrefix(server.URL, "http://")+
+			",method=GET,run_id="+runReport.RunID+",status=200,success=true duration_ms="), point)
+	}
+}
+
+func TestProbeControl(t *testing.T) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer apiServer.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 2,
+			TotalRequests:      10000,
+			RequestTimeoutMS:   1000,
+			Endpoints:          []config.Endpoint{{URL: apiServer.URL, Method: "GET"}},
+			Control:            config.ControlConfig{Listen: addr},
+		},
+	}
+
+	go func() {
+		for {
+			time.Sleep(20 * time.Millisecond)
+			resp, err := http.Get("http://" + addr + "/v1/stats")
+			if err != nil {
+				continue
+			}
+			var stats controlStats
+			json.NewDecoder(resp.Body).Decode(&stats)
+			resp.Body.Close()
+			if stats.CompletedRequests >= 5 {
+				resp, err := http.Post("http://"+addr+"/v1/stop", "", nil)
+				if err == nil {
+					resp.Body.Close()
+				}
+				return
+			}
+		}
+	}()
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "stopped", runReport.StopReason)
+	assert.GreaterOrEqual(t, runReport.SuccessfulRequests, 5)
+	assert.Less(t, runReport.SuccessfulRequests, 10000)
+	assert.Zero(t, runReport.FailedRequests)
+}
+
+func TestProbeControlWorkersAndSignals(t *testing.T) {
+	if pauseSignal == nil {
+		t.Skip("pause signals are not available on this platform")
+	}
+	var current, peak atomic.Int32
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := current.Add(1)
+		defer current.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer apiServer.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      80,
+			RequestTimeoutMS:   1000,
+			Endpoints:          []config.Endpoint{{URL: apiServer.URL, Method: "GET"}},
+			Control:            config.ControlConfig{Listen: addr},
+		},
+	}
+
+	stats := func() controlStats {
+		var s controlStats
+		resp, err := http.Get("http://" + addr + "/v1/stats")
+		if err != nil {
+			return s
+		}
+		defer resp.Body.Close()
+		json.NewDecoder(resp.Body).Decode(&s)
+		return s
+	}
+	var pausedAt, resumedAt int64
+	steered := make(chan struct{})
+	go func() {
+		defer close(steered)
+		assert.Eventually(t, func() bool { return stats().CompletedRequests >= 2 }, 2*time.Second, 5*time.Millisecond)
+		req, _ := http.NewRequest(http.MethodPut, "http://"+addr+"/v1/workers", strings.NewReader(`{"workers": 4}`))
+		resp, err := http.DefaultClient.Do(req)
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+		assert.Eventually(t, func() bool { return peak.Load() >= 3 }, 2*time.Second, time.Millisecond)
+
+		process, _ := os.FindProcess(os.Getpid())
+		assert.NoError(t, process.Signal(pauseSignal))
+		assert.Eventually(t, func() bool { return stats().Paused }, 2*time.Second, time.Millisecond)
+		// the in-flight requests complete after the pause
+		time.Sleep(50 * time.Millisecond)
+		pausedAt = stats().CompletedRequests
+		time.Sleep(50 * time.Millisecond)
+		resumedAt = stats().CompletedRequests
+		assert.NoError(t, process.Signal(resumeSignal))
+	}()
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	<-steered
+	assert.NoError(t, err)
+	assert.Equal(t, 80, runReport.SuccessfulRequests)
+	assert.GreaterOrEqual(t, peak.Load(), int32(3), "Expected the added workers to send requests concurrently")
+	assert.Equal(t, pausedAt, resumedAt, "Expected no requests to complete while paused")
+}
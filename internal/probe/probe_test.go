@@ -1,22 +1,51 @@
 package probe
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/middleware"
+	"github.com/dasvh/enchante/internal/probe/streampb"
+	"github.com/dasvh/enchante/internal/report"
 	"github.com/dasvh/enchante/internal/testutil"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 var defaultTimeout = time.Duration(config.DefaultRequestTimeout) * time.Millisecond
 
+func newTestClient(t *testing.T) *http.Client {
+	client, err := newHTTPClient(config.NetworkConfig{}, nil, &trafficCounter{})
+	assert.NoError(t, err)
+	return client
+}
+
 func TestMakeRequestHandlesErrors(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -41,11 +70,9 @@ func TestMakeRequestHandlesErrors(t *testing.T) {
 				Method: "GET",
 			}
 
-			results := make(chan time.Duration, 1)
 			headers := map[string]string{"Authorization": "Bearer test-token"}
 
-			err := makeRequest(t.Context(), testEndpoint, headers, config.Delay{}, defaultTimeout, results, testutil.Logger)
-			close(results)
+			_, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, headers, defaultTimeout, testutil.Logger)
 
 			if tc.expectErr == nil {
 				assert.NoError(t, err, "Unexpected error")
@@ -70,32 +97,45 @@ func TestRequestTimeout(t *testing.T) {
 		Method: "GET",
 	}
 
-	results := make(chan time.Duration, 1)
 	timeout := 10 * time.Millisecond
 	headers := map[string]string{"Authorization": "Bearer test-token"}
 
 	start := time.Now()
-	err := makeRequest(t.Context(), testEndpoint, headers, config.Delay{}, timeout, results, testutil.Logger)
+	_, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, headers, timeout, testutil.Logger)
 	elapsed := time.Since(start).Milliseconds()
 
-	close(results)
-
 	assert.Error(t, err, "Expected a timeout error")
 	assert.Contains(t, err.Error(), "context deadline exceeded", "Expected timeout error message")
+	assert.True(t, errors.Is(err, ErrTimeout), "Expected wrapped timeout error")
+	assert.False(t, errors.Is(err, ErrRequestFailed), "Expected a timeout not to be reported as network failure")
 	assert.GreaterOrEqualf(t, elapsed, timeout.Milliseconds(), "Expected elapsed time to be at least %dms, got %dms", timeout.Milliseconds(), elapsed)
 }
 
+func TestRequestCanceled(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer mockServer.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	testEndpoint := config.Endpoint{URL: mockServer.URL, Method: "GET"}
+
+	_, err := makeRequest(ctx, newTestClient(t), testEndpoint, nil, defaultTimeout, testutil.Logger)
+
+	assert.True(t, errors.Is(err, ErrCanceled), "Expected the end of the run to be reported as cancellation")
+	assert.False(t, errors.Is(err, ErrTimeout), "Expected the cancellation not to be reported as timeout")
+}
+
 func TestNetworkFailure(t *testing.T) {
 	testEndpoint := config.Endpoint{
 		URL:    "http://invalid-url.local",
 		Method: "GET",
 	}
 
-	results := make(chan time.Duration, 1)
 	headers := map[string]string{"Authorization": "Bearer test-token"}
 
-	err := makeRequest(t.Context(), testEndpoint, headers, config.Delay{}, 100, results, testutil.Logger)
-	close(results)
+	_, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, headers, defaultTimeout, testutil.Logger)
 
 	assert.Error(t, err, "Expected a network failure error")
 	assert.True(t, errors.Is(err, ErrRequestFailed), "Expected wrapped network failure error")
@@ -117,13 +157,11 @@ func TestAuthHeaderIsSet(t *testing.T) {
 		Method: "GET",
 	}
 
-	results := make(chan time.Duration, 1)
 	headers := map[string]string{"Authorization": "Bearer test-token"}
 
-	makeRequest(t.Context(), testEndpoint, headers, config.Delay{}, defaultTimeout, results, testutil.Logger)
-	close(results)
+	_, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, headers, defaultTimeout, testutil.Logger)
 
-	assert.Len(t, results, 1)
+	assert.NoError(t, err)
 }
 
 func TestRequestDelays(t *testing.T) {
@@ -142,46 +180,128 @@ func TestRequestDelays(t *testing.T) {
 			name: "Fixed",
 			delayConfig: config.Delay{
 				Enabled: true,
-				Fixed:   500,
+				Fixed:   250,
 			},
 			expectedMinMs: 500,
-			expectedMaxMs: 510,
+			expectedMaxMs: 600,
 		},
 		{
 			name: "Random",
 			delayConfig: config.Delay{
 				Enabled: true,
 				Type:    "random",
-				Min:     200,
-				Max:     600,
+				Min:     100,
+				Max:     300,
 			},
 			expectedMinMs: 200,
-			expectedMaxMs: 610,
+			expectedMaxMs: 700,
 		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			testEndpoint := config.Endpoint{
-				URL:    mockServer.URL,
-				Method: "GET",
+			cfg := &config.Config{
+				ProbingConfig: config.ProbingConfig{
+					ConcurrentRequests: 1,
+					TotalRequests:      2,
+					RequestTimeoutMS:   50,
+					DelayBetween:       tc.delayConfig,
+					Endpoints:          []config.Endpoint{{URL: mockServer.URL, Method: "GET"}},
+				},
 			}
 
-			results := make(chan time.Duration, 1)
-			headers := map[string]string{"Authorization": "Bearer test-token"}
-
 			start := time.Now()
-			makeRequest(t.Context(), testEndpoint, headers, tc.delayConfig, defaultTimeout, results, testutil.Logger)
+			runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+			assert.NoError(t, err)
 			elapsed := time.Since(start).Milliseconds()
 
-			close(results)
-
 			assert.GreaterOrEqual(t, elapsed, tc.expectedMinMs)
 			assert.LessOrEqual(t, elapsed, tc.expectedMaxMs)
+			assert.Equal(t, 2, runReport.SuccessfulRequests, "Expected delays longer than the timeout not to time out requests")
+			assert.Less(t, runReport.Latency.MaxMS, 50.0, "Expected the delay not to be part of the response time")
 		})
 	}
 }
 
+func TestDelayCancellation(t *testing.T) {
+	cfg := &config.Config{
+		ProbingConfig: config.ProbingConfig{
+			ConcurrentRequests: 1,
+			TotalRequests:      1,
+			RequestTimeoutMS:   1000,
+			DelayBetween:       config.Delay{Enabled: true, Fixed: 10000},
+			Endpoints:          []config.Endpoint{{URL: "http://localhost/", Method: "GET"}},
+		},
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	runReport, err := RunProbe(ctx, cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	assert.Less(t, time.Since(start), time.Second, "Expected the cancellation to interrupt the delay")
+	assert.Zero(t, runReport.SuccessfulRequests+runReport.FailedRequests)
+}
+
+func TestEndpointDelay(t *testing.T) {
+	global := config.Delay{Enabled: true, Fixed: 100}
+	checkout := config.Delay{Enabled: true, Type: "random", Min: 1000, Max: 3000}
+
+	assert.Equal(t, global, endpointDelay(config.Endpoint{}, global), "Expected the global delay without an override")
+	assert.Equal(t, checkout, endpointDelay(config.Endpoint{Delay: &checkout}, global))
+	assert.Equal(t, config.Delay{}, endpointDelay(config.Endpoint{Delay: &config.Delay{}}, global), "Expected a disabled endpoint delay to replace the global delay")
+}
+
+func TestDelayDistributions(t *testing.T) {
+	const draws = 20000
+	summarize := func(delay config.Delay) (avg, low, high time.Duration) {
+		rng := newWorkerRand(1, 0)
+		low = time.Hour
+		var total time.Duration
+		for range draws {
+			d := delayDuration(delay, rng)
+			total += d
+			low, high = min(low, d), max(high, d)
+		}
+		return total / draws, low, high
+	}
+
+	avg, _, _ := summarize(config.Delay{Enabled: true, Type: config.DelayExponential, Mean: 100})
+	assert.InDelta(t, 100, avg.Milliseconds(), 5, "Expected exponential delays around the mean")
+
+	avg, low, high := summarize(config.Delay{Enabled: true, Type: config.DelayNormal, Mean: 100, StdDev: 40, Min: 50, Max: 150})
+	assert.InDelta(t, 100, avg.Milliseconds(), 5, "Expected normal delays around the mean")
+	assert.Equal(t, 50*time.Millisecond, low, "Expected normal delays bounded by min")
+	assert.Equal(t, 150*time.Millisecond, high, "Expected normal delays bounded by max")
+
+	avg, low, high = summarize(config.Delay{Enabled: true, Fixed: 100, Jitter: 20})
+	assert.InDelta(t, 100, avg.Milliseconds(), 2)
+	assert.Equal(t, 80*time.Millisecond, low, "Expected the jitter to reach -jitter")
+	assert.Equal(t, 120*time.Millisecond, high, "Expected the jitter to reach +jitter")
+
+	_, low, _ = summarize(config.Delay{Enabled: true, Fixed: 5, Jitter: 20})
+	assert.Zero(t, low, "Expected jitter to never make a delay negative")
+}
+
+func TestSeededDelays(t *testing.T) {
+	delay := config.Delay{Enabled: true, Type: "random", Min: 0, Max: 1000000}
+	draw := func(seed int64, worker int) []time.Duration {
+		ctx := withRand(t.Context(), newWorkerRand(seed, worker))
+		delays := make([]time.Duration, 5)
+		for i := range delays {
+			delays[i] = delayDuration(delay, randFromContext(ctx))
+		}
+		return delays
+	}
+
+	assert.Equal(t, draw(42, 0), draw(42, 0), "Expected the same delays for the same seed and worker")
+	assert.NotEqual(t, draw(42, 0), draw(42, 1), "Expected each worker to draw its own delays")
+	assert.NotEqual(t, draw(42, 0), draw(43, 0), "Expected other delays for another seed")
+	assert.Equal(t, int64(42), runSeed(42))
+	assert.NotZero(t, runSeed(0), "Expected a random seed when none is configured")
+}
+
 func TestConcurrentRequests(t *testing.T) {
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -199,7 +319,8 @@ func TestConcurrentRequests(t *testing.T) {
 	}
 
 	start := time.Now()
-	RunProbe(t.Context(), cfg, testutil.Logger)
+	_, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
 	elapsed := time.Since(start)
 
 	assert.Greater(t, elapsed, time.Duration(0))
@@ -228,7 +349,8 @@ func TestTotalRequestsCount(t *testing.T) {
 	}
 
 	start := time.Now()
-	RunProbe(t.Context(), cfg, testutil.Logger)
+	_, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
 	elapsed := time.Since(start)
 
 	assert.Greater(t, elapsed, time.Duration(0))
@@ -303,11 +425,9 @@ func TestEndpointUsesGlobalAuth(t *testing.T) {
 
 	headers, _ := getHeadersForEndpoint(testEndpoint, &globalAuth, testutil.Logger)
 
-	results := make(chan time.Duration, 1)
-	makeRequest(t.Context(), testEndpoint, headers, config.Delay{}, defaultTimeout, results, testutil.Logger)
-	close(results)
+	_, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, headers, defaultTimeout, testutil.Logger)
 
-	assert.Len(t, results, 1)
+	assert.NoError(t, err)
 }
 
 func TestEndpointOverridesAuth(t *testing.T) {
@@ -347,9 +467,1928 @@ func TestEndpointOverridesAuth(t *testing.T) {
 
 	headers, _ := getHeadersForEndpoint(testEndpoint, &globalAuth, testutil.Logger)
 
-	results := make(chan time.Duration, 1)
-	makeRequest(t.Context(), testEndpoint, headers, config.Delay{}, defaultTimeout, results, testutil.Logger)
-	close(results)
+	_, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, headers, defaultTimeout, testutil.Logger)
+
+	assert.NoError(t, err)
+}
+
+func TestGroupByOwner(t *testing.T) {
+	stats := newEndpointStats([]config.Endpoint{
+		{URL: "https://api.example.com/orders", Method: "GET", Owner: "checkout", SLAMS: 100},
+		{URL: "https://api.example.com/cart", Method: "POST", Owner: "checkout"},
+		{URL: "https://api.example.com/search", Method: "GET", Owner: "discovery"},
+		{URL: "https://api.example.com/health", Method: "GET"},
+	})
+
+	stats[0].record(sample{duration: 50 * time.Millisecond})
+	stats[0].record(sample{duration: 150 * time.Millisecond})
+	stats[1].record(sample{duration: 500 * time.Millisecond})
+	stats[0].latency.Record(50 * time.Millisecond)
+	stats[0].latency.Record(150 * time.Millisecond)
+
+	owners := groupByOwner(stats)
+
+	assert.Len(t, owners, 3)
+	assert.Len(t, owners["checkout"], 2)
+	assert.Len(t, owners["discovery"], 1)
+	assert.Len(t, owners[defaultOwner], 1)
+	assert.Equal(t, 1, stats[0].slaBreaches, "Expected only the request above the SLA to be a breach")
+	assert.Equal(t, 0, stats[1].slaBreaches, "Expected no breaches for an endpoint without SLA")
+	assert.Equal(t, 100*time.Millisecond, stats[0].avgResponseTime())
+}
+
+func TestResponseCompression(t *testing.T) {
+	payload := strings.Repeat(`{"key": "value"}`, 100)
+
+	tests := []struct {
+		name     string
+		encoding string
+		encode   func(w io.Writer) io.WriteCloser
+	}{
+		{"Gzip", "gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		{"Deflate", "deflate", func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }},
+		{"Brotli", "br", func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }},
+		{"Raw Deflate", "deflate", func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		}},
+		{"Uncompressed", "", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, acceptEncoding, r.Header.Get("Accept-Encoding"))
+				if tc.encode == nil {
+					w.Write([]byte(payload))
+					return
+				}
+				w.Header().Set("Content-Encoding", tc.encoding)
+				enc := tc.encode(w)
+				enc.Write([]byte(payload))
+				enc.Close()
+			}))
+			defer mockServer.Close()
+
+			testEndpoint := config.Endpoint{URL: mockServer.URL, Method: "GET"}
+
+			s, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, nil, defaultTimeout, testutil.Logger)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.encoding, s.encoding)
+			assert.Equal(t, int64(len(payload)), s.decodedBytes)
+			if tc.encode == nil {
+				assert.Equal(t, s.decodedBytes, s.wireBytes)
+				assert.Zero(t, s.phases.decompress, "Expected no decompression time for an uncompressed response")
+			} else {
+				assert.Less(t, s.wireBytes, s.decodedBytes, "Expected compressed response to be smaller on the wire")
+				assert.Positive(t, s.phases.decompress)
+			}
+		})
+	}
+}
+
+func TestCompressionStats(t *testing.T) {
+	stats := newEndpointStats([]config.Endpoint{{URL: "https://api.example.com", Method: "GET"}})
+
+	stats[0].record(sample{encoding: "gzip", wireBytes: 100, decodedBytes: 400})
+	stats[0].record(sample{encoding: "zstd", wireBytes: 50, decodedBytes: -1})
+	stats[0].record(sample{wireBytes: 400, decodedBytes: 400})
+
+	c := stats[0].compression()
+	assert.Equal(t, 2, c.CompressedResponses)
+	assert.Equal(t, map[string]int{"gzip": 1, "zstd": 1}, c.Encodings)
+	assert.Equal(t, 4.0, c.Ratio, "Expected ratio to only include decodable compressed responses")
+}
+
+func TestLatencyPerKB(t *testing.T) {
+	stats := newEndpointStats([]config.Endpoint{
+		{URL: "https://api.example.com/export", Method: "GET", LatencyPerKB: true},
+		{URL: "https://api.example.com/items", Method: "GET"},
+	})
+
+	stats[0].record(sample{duration: 100 * time.Millisecond, wireBytes: 10 * 1024, decodedBytes: 50 * 1024})
+	stats[0].record(sample{duration: 100 * time.Millisecond, encoding: "zstd", wireBytes: 20 * 1024, decodedBytes: -1})
+	stats[0].record(sample{duration: 5 * time.Millisecond})
+	stats[1].record(sample{duration: 100 * time.Millisecond, wireBytes: 1024, decodedBytes: 1024})
+
+	perKB := stats[0].transfer(time.Second).LatencyPerKB
+	if assert.NotNil(t, perKB) {
+		assert.InDelta(t, 2.0, perKB.MinMS, 0.05, "Expected the decoded size to be used")
+		assert.InDelta(t, 5.0, perKB.MaxMS, 0.05, "Expected the wire size for bodies that could not be decoded")
+	}
+	assert.Equal(t, int64(2), stats[0].latencyPerKB.Count(), "Expected responses without a body to be skipped")
+	assert.Nil(t, stats[1].transfer(time.Second).LatencyPerKB, "Expected no normalized latency unless enabled")
+}
+
+func TestCompressRequest(t *testing.T) {
+	payload := strings.Repeat(`{"key": "value"}`, 100)
+
+	tests := []struct {
+		name     string
+		encoding string
+		decode   func(r io.Reader) (io.Reader, error)
+	}{
+		{"Gzip", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"Deflate", "deflate", func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }},
+		{"Brotli", "br", func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var received, contentEncoding string
+			var wireBytes int
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentEncoding = r.Header.Get("Content-Encoding")
+				wire, _ := io.ReadAll(r.Body)
+				wireBytes = len(wire)
+				decoder, err := tc.decode(bytes.NewReader(wire))
+				if assert.NoError(t, err) {
+					decoded, _ := io.ReadAll(decoder)
+					received = string(decoded)
+				}
+			}))
+			defer mockServer.Close()
+
+			testEndpoint := config.Endpoint{URL: mockServer.URL, Method: "POST", Body: payload, CompressRequest: tc.encoding}
+			s, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, nil, defaultTimeout, testutil.Logger)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.encoding, contentEncoding)
+			assert.Equal(t, payload, received)
+			assert.Equal(t, int64(wireBytes), s.sentBytes, "Expected the compressed size to be counted as sent")
+			assert.Less(t, s.sentBytes, int64(len(payload)))
+		})
+	}
+}
+
+func TestExpectEncoding(t *testing.T) {
+	tests := []struct {
+		name           string
+		expect         string
+		headers        map[string]string
+		acceptEncoding string
+		expectErr      bool
+	}{
+		{name: "Served Encoding", expect: "gzip", acceptEncoding: "gzip"},
+		{name: "Uncompressed Expected", expect: "identity", acceptEncoding: "identity", expectErr: true},
+		{name: "Brotli Expected", expect: "br", acceptEncoding: "br", expectErr: true},
+		{name: "Accept-Encoding Header", expect: "gzip", headers: map[string]string{"Accept-Encoding": "gzip, br"}, acceptEncoding: "gzip, br"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var acceptEncoding string
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				acceptEncoding = r.Header.Get("Accept-Encoding")
+				w.Header().Set("Content-Encoding", "gzip")
+				gz := gzip.NewWriter(w)
+				gz.Write([]byte(`{"key": "value"}`))
+				gz.Close()
+			}))
+			defer mockServer.Close()
+
+			testEndpoint := config.Endpoint{URL: mockServer.URL, Method: "GET", ExpectEncoding: tc.expect}
+			_, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, tc.headers, defaultTimeout, testutil.Logger)
+
+			assert.Equal(t, tc.acceptEncoding, acceptEncoding)
+			if tc.expectErr {
+				assert.ErrorIs(t, err, ErrContentEncoding)
+				assert.Equal(t, errorAssertion, classifyError(err))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDialDiagnostics(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	testEndpoint := config.Endpoint{URL: "http://" + addr, Method: "GET"}
+
+	s, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, nil, defaultTimeout, testutil.Logger)
+
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, ErrRequestFailed), "Expected wrapped network failure error")
+	assert.Contains(t, err.Error(), "dial attempts: tcp4 "+addr+" failed after")
+	assert.Len(t, s.dialFailures, 1)
+	assert.Equal(t, "tcp4", s.dialFailures[0].network)
+
+	stats := newEndpointStats([]config.Endpoint{testEndpoint})
+	stats[0].recordFailure(s, err)
+	assert.Equal(t, map[string]int{"tcp4": 1}, stats[0].dialFailures)
+	assert.Equal(t, map[string]int{errorConnectionRefused: 1}, stats[0].errors)
+}
+
+func TestAddressFamily(t *testing.T) {
+	assert.Equal(t, "tcp4", addressFamily("127.0.0.1:80"))
+	assert.Equal(t, "tcp6", addressFamily("[::1]:443"))
+	assert.Equal(t, "tcp", addressFamily("example.com:80"))
+}
+
+func TestLocalPortBinding(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	localPort := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	var remoteAddr string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	client, err := newHTTPClient(config.NetworkConfig{
+		SourceIP:       "127.0.0.1",
+		LocalPortRange: fmt.Sprintf("%d-%d", localPort, localPort),
+	}, nil, &trafficCounter{})
+	assert.NoError(t, err)
+
+	testEndpoint := config.Endpoint{URL: mockServer.URL, Method: "GET"}
+	_, err = makeRequest(t.Context(), client, testEndpoint, nil, defaultTimeout, testutil.Logger)
+
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("127.0.0.1:%d", localPort), remoteAddr)
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	tests := []struct {
+		name        string
+		limitKbps   int
+		minDuration time.Duration
+	}{
+		{name: "Unlimited"},
+		// 64KB at 100KB/s with a 16KB burst takes about 480ms
+		{name: "Limited", limitKbps: 800, minDuration: 400 * time.Millisecond},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			traffic := &trafficCounter{}
+			client, err := newHTTPClient(config.NetworkConfig{BandwidthLimitKbps: tc.limitKbps}, nil, traffic)
+			assert.NoError(t, err)
+
+			testEndpoint := config.Endpoint{URL: mockServer.URL, Method: "POST", Body: strings.Repeat("x", 64*1024)}
+			start := time.Now()
+			_, err = makeRequest(t.Context(), client, testEndpoint, nil, defaultTimeout, testutil.Logger)
+			elapsed := time.Since(start)
+
+			assert.NoError(t, err)
+			assert.GreaterOrEqual(t, elapsed, tc.minDuration)
+			assert.Greater(t, traffic.sent.Load(), int64(64*1024))
+			assert.Greater(t, traffic.received.Load(), int64(0))
+
+			r := traffic.report(tc.limitKbps, elapsed)
+			assert.Equal(t, tc.limitKbps, r.LimitKbps)
+			if tc.limitKbps > 0 {
+				assert.LessOrEqual(t, r.EgressKbps, float64(tc.limitKbps)*1.5)
+			}
+		})
+	}
+}
+
+func TestBandwidthLimitCancel(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	// 256KB at 1KB/s would take minutes
+	client, err := newHTTPClient(config.NetworkConfig{BandwidthLimitKbps: 8}, nil, &trafficCounter{})
+	assert.NoError(t, err)
+	testEndpoint := config.Endpoint{URL: mockServer.URL, Method: "POST", Body: strings.Repeat("x", 256*1024)}
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = makeRequest(ctx, client, testEndpoint, nil, defaultTimeout, testutil.Logger)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second, "Expected the cancelled request not to wait for the bandwidth limit")
+
+	limiter := newBandwidthLimiter(8)
+	limiter.reserve(1024 * 1024)
+	client1, server1 := net.Pipe()
+	defer server1.Close()
+	conn := newMeteredConn(client1, &trafficCounter{}, limiter)
+	assert.NoError(t, conn.SetWriteDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = conn.Write([]byte("x"))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	assert.NoError(t, conn.SetWriteDeadline(time.Time{}))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		conn.Close()
+	}()
+	_, err = conn.Write([]byte("x"))
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestPatternReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		size     int64
+		bufSize  int
+		expected string
+	}{
+		{name: "Exact Multiple", pattern: "abc", size: 6, bufSize: 4, expected: "abcabc"},
+		{name: "Partial Pattern", pattern: "abc", size: 7, bufSize: 2, expected: "abcabca"},
+		{name: "Buffer Larger Than Size", pattern: "xy", size: 3, bufSize: 64, expected: "xyx"},
+		{name: "Empty", pattern: "abc", size: 0, bufSize: 4, expected: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newPatternReader([]byte(tc.pattern), tc.size)
+			var out strings.Builder
+			buf := make([]byte, tc.bufSize)
+			for {
+				n, err := r.Read(buf)
+				out.Write(buf[:n])
+				if err == io.EOF {
+					break
+				}
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+}
+
+func TestGeneratedBody(t *testing.T) {
+	var contentLength int64
+	var received []byte
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	testEndpoint := config.Endpoint{
+		URL:           mockServer.URL,
+		Method:        "PUT",
+		BodyGenerator: &config.BodyGenerator{Pattern: "enchante", SizeMB: 1},
+	}
+	_, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, nil, defaultTimeout, testutil.Logger)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024*1024), contentLength, "Expected the Content-Length of the generated body")
+	assert.Len(t, received, 1024*1024)
+	assert.Equal(t, strings.Repeat("enchante", 1024*1024/8), string(received))
+}
+
+func TestFileBody(t *testing.T) {
+	var contentLength int64
+	var received []byte
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		received, _ = io.ReadAll(r.Body)
+	}))
+	defer mockServer.Close()
+
+	payload := strings.Repeat(`{"name": "enchante"}`, 1000)
+	file := filepath.Join(t.TempDir(), "payload.json")
+	assert.NoError(t, os.WriteFile(file, []byte(payload), 0o600))
+
+	testEndpoint := config.Endpoint{URL: mockServer.URL, Method: "POST", BodyFile: file}
+	s, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, nil, defaultTimeout, testutil.Logger)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(payload)), contentLength)
+	assert.Equal(t, payload, string(received))
+	assert.Equal(t, int64(len(payload)), s.sentBytes)
+}
+
+func TestBase64Body(t *testing.T) {
+	var received []byte
+	var contentEncoding string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentEncoding = r.Header.Get("Content-Encoding")
+		received, _ = io.ReadAll(r.Body)
+	}))
+	defer mockServer.Close()
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(`{"name": "enchante"}`))
+	gz.Close()
+
+	testEndpoint := config.Endpoint{
+		URL:             mockServer.URL,
+		Method:          "POST",
+		BodyBase64:      base64.StdEncoding.EncodeToString(compressed.Bytes()),
+		ContentEncoding: "gzip",
+	}
+	s, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, nil, defaultTimeout, testutil.Logger)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", contentEncoding)
+	assert.Equal(t, compressed.Bytes(), received, "Expected the decoded bytes to be sent unchanged")
+	assert.Equal(t, int64(compressed.Len()), s.sentBytes)
+}
+
+func TestMultipartBody(t *testing.T) {
+	var contentLength int64
+	var fields map[string][]string
+	var upload, filename, contentType string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		if !assert.NoError(t, r.ParseMultipartForm(1<<20)) {
+			return
+		}
+		fields = r.MultipartForm.Value
+		f, header, err := r.FormFile("upload")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer f.Close()
+		data, _ := io.ReadAll(f)
+		upload, filename, contentType = string(data), header.Filename, header.Header.Get("Content-Type")
+	}))
+	defer mockServer.Close()
+
+	file := filepath.Join(t.TempDir(), "avatar.png")
+	assert.NoError(t, os.WriteFile(file, []byte("not really a png"), 0o600))
+
+	testEndpoint := config.Endpoint{
+		URL:    mockServer.URL,
+		Method: "POST",
+		// the Content-Type of the form replaces the configured one, it carries the boundary
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Multipart: &config.Multipart{
+			Fields: map[string]string{"title": "profile", "visibility": "public"},
+			Files:  []config.MultipartFile{{Field: "upload", Path: file, ContentType: "image/png"}},
+		},
+	}
+	s, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, testEndpoint.Headers, defaultTimeout, testutil.Logger)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"title": {"profile"}, "visibility": {"public"}}, fields)
+	assert.Equal(t, "not really a png", upload)
+	assert.Equal(t, "avatar.png", filename)
+	assert.Equal(t, "image/png", contentType)
+	assert.Positive(t, contentLength, "Expected the Content-Length to be known up front")
+	assert.Equal(t, contentLength, s.sentBytes)
+}
+
+func TestPacing(t *testing.T) {
+	tests := []struct {
+		name        string
+		pacing      config.Pacing
+		users       int
+		iterations  int
+		minDuration time.Duration
+		maxDuration time.Duration
+	}{
+		{name: "Disabled", users: 2, iterations: 5, maxDuration: 50 * time.Millisecond},
+		// 600 iterations per minute for 2 users is one iteration every 50ms
+		{name: "Paced", pacing: config.Pacing{IterationsPerMinute: 600}, users: 2, iterations: 5, minDuration: 200 * time.Millisecond, maxDuration: 400 * time.Millisecond},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newPacer(tc.pacing, tc.users)
+			start := time.Now()
+			for range tc.iterations {
+				assert.True(t, p.wait(t.Context()))
+			}
+			elapsed := time.Since(start)
+
+			assert.GreaterOrEqual(t, elapsed, tc.minDuration)
+			assert.Less(t, elapsed, tc.maxDuration)
+			assert.Equal(t, int64(tc.iterations), p.started.Load())
+		})
+	}
+}
+
+func TestPacingCancellation(t *testing.T) {
+	p := newPacer(config.Pacing{IterationsPerMinute: 1}, 1)
+	ctx, cancel := context.WithCancel(t.Context())
+
+	assert.True(t, p.wait(ctx), "Expected the first iteration to start immediately")
+	cancel()
+	assert.False(t, p.wait(ctx), "Expected the wait to stop on cancellation")
+}
+
+func TestWeightedSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		weights  []int
+		expected []int
+	}{
+		{name: "Unweighted", weights: []int{0, 0, 0}, expected: []int{0, 1, 2}},
+		{name: "Percentages Are Reduced", weights: []int{80, 20}, expected: []int{0, 0, 1, 0, 0}},
+		{name: "Interleaved", weights: []int{2, 1, 1}, expected: []int{0, 1, 2, 0}},
+		{name: "Uneven", weights: []int{5, 1, 1}, expected: []int{0, 0, 1, 0, 2, 0, 0}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoints := make([]config.Endpoint, len(tc.weights))
+			for i, weight := range tc.weights {
+				endpoints[i] = config.Endpoint{Weight: weight}
+			}
+			assert.Equal(t, tc.expected, weightedSchedule(endpoints))
+		})
+	}
+}
+
+func TestSplitRampedSchedule(t *testing.T) {
+	endpoints := []config.Endpoint{{Weight: 2}, {Weight: 1, Ramp: &config.Ramp{StartWorkers: 1, EndWorkers: 2}}, {Weight: 1}}
+
+	shared, ramped := splitRampedSchedule(endpoints, weightedSchedule(endpoints))
+
+	assert.Equal(t, []int{0, 2, 0}, shared)
+	assert.Equal(t, map[int]int{1: 1}, ramped)
+	assert.Equal(t, 2, rampWorkers(endpoints))
+}
+
+func TestRampStart(t *testing.T) {
+	ramp := config.Ramp{StartWorkers: 2, EndWorkers: 5, DurationMS: 300}
+
+	assert.Zero(t, rampStart(ramp, 1))
+	for worker, expected := range map[int]time.Duration{2: 100 * time.Millisecond, 3: 200 * time.Millisecond, 4: 300 * time.Millisecond} {
+		start := rampStart(ramp, worker)
+		assert.Equal(t, expected, start)
+		assert.Greater(t, ramp.Workers(start), worker, "Expected the worker to be part of the ramp at its start")
+	}
+}
+
+func TestEvaluateThresholds(t *testing.T) {
+	r := &report.Report{
+		TotalRequests:  10,
+		FailedRequests: 1,
+		Latency:        report.Latency{AvgMS: 80, P95MS: 200},
+		Endpoints: []report.EndpointReport{
+			{Method: "GET", URL: "http://localhost/a", SuccessfulRequests: 5, Latency: report.Latency{P95MS: 100}},
+			{Method: "POST", URL: "http://localhost/b", SuccessfulRequests: 4, FailedRequests: 1, Latency: report.Latency{P95MS: 300}},
+		},
+	}
+	thresholds := []config.Threshold{
+		{Metric: "error_rate", Max: 0.05, Severity: config.SeverityWarn},
+		{Metric: "avg_ms", Max: 100},
+		{Metric: "p95_ms", Max: 250, Endpoint: "http://localhost/b"},
+	}
+
+	results := EvaluateThresholds(thresholds, r)
+
+	assert.Equal(t, []report.ThresholdResult{
+		{Metric: "error_rate", Max: 0.05, Value: 0.1, Severity: "warn", Breached: true},
+		{Metric: "avg_ms", Max: 100, Value: 80, Severity: "fail"},
+		{Metric: "p95_ms", Method: "POST", URL: "http://localhost/b", Max: 250, Value: 300, Severity: "fail", Breached: true},
+	}, results)
+	assert.True(t, thresholdFailed(results))
+	assert.False(t, thresholdFailed(results[:2]), "Expected a warn breach not to fail the run")
+}
+
+func TestProbeResultFailed(t *testing.T) {
+	tests := []struct {
+		name     string
+		report   report.Report
+		expected bool
+	}{
+		{name: "Succeeded", report: report.Report{SuccessfulRequests: 2}},
+		{name: "Failed Requests", report: report.Report{FailedRequests: 1}, expected: true},
+		{
+			name:   "Warn Breach",
+			report: report.Report{FailedRequests: 1, Thresholds: []report.ThresholdResult{{Metric: "error_rate", Severity: "warn", Breached: true}}},
+		},
+		{
+			name:     "Fail Breach",
+			report:   report.Report{Thresholds: []report.ThresholdResult{{Metric: "p95_ms", Severity: "fail", Breached: true}}},
+			expected: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := &ProbeResult{Report: &tc.report}
+			assert.Equal(t, tc.expected, result.Failed())
+		})
+	}
+}
+
+func TestExtractValue(t *testing.T) {
+	capture := &responseCapture{header: http.Header{"Location": []string{"/items/7"}}}
+	capture.Write([]byte(`{"data": {"items": [{"id": 7, "tags": ["a", "b"]}], "token": "abc", "active": true, "none": null}}`))
+
+	tests := []struct {
+		name       string
+		extraction config.Extraction
+		expected   string
+		expectErr  bool
+	}{
+		{name: "JSON Number", extraction: config.Extraction{JSON: "$.data.items[0].id"}, expected: "7"},
+		{name: "JSON Without Root", extraction: config.Extraction{JSON: "data.token"}, expected: "abc"},
+		{name: "JSON Nested Array", extraction: config.Extraction{JSON: "$.data.items[0].tags[1]"}, expected: "b"},
+		{name: "JSON Bool", extraction: config.Extraction{JSON: "$.data.active"}, expected: "true"},
+		{name: "JSON Object", extraction: config.Extraction{JSON: "$.data.items[0].tags"}, expected: `["a","b"]`},
+		{name: "JSON Missing", extraction: config.Extraction{JSON: "$.data.missing"}, expectErr: true},
+		{name: "JSON Index Out Of Range", extraction: config.Extraction{JSON: "$.data.items[3].id"}, expectErr: true},
+		{name: "JSON Null", extraction: config.Extraction{JSON: "$.data.none"}, expectErr: true},
+		{name: "Regex Capture Group", extraction: config.Extraction{Regex: `"token": "(\w+)"`}, expected: "abc"},
+		{name: "Regex Whole Match", extraction: config.Extraction{Regex: `\d+`}, expected: "7"},
+		{name: "Regex No Match", extraction: config.Extraction{Regex: `"secret"`}, expectErr: true},
+		{name: "Header", extraction: config.Extraction{Header: "location"}, expected: "/items/7"},
+		{name: "Missing Header", extraction: config.Extraction{Header: "ETag"}, expectErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := extractValue(tc.extraction, capture)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, value)
+		})
+	}
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	l := newAdaptiveLimiter(config.AdaptiveConfig{Enabled: true, TargetLatencyMS: 100, MinConcurrency: 2}, 8, testutil.Logger)
+	fast, slow := 50*time.Millisecond, 150*time.Millisecond
+
+	// complete the given number of requests with the given duration at the current limit
+	run := func(n int, duration time.Duration, failed bool) {
+		for range n {
+			assert.True(t, l.acquire(t.Context(), config.PriorityNormal))
+			l.release(duration, failed)
+		}
+	}
+
+	assert.Equal(t, 2, int(l.limit), "Expected to start at the minimum concurrency")
+
+	run(3, fast, false)
+	assert.Equal(t, 3, int(l.limit), "Expected an increase of about one per window within the target")
+
+	run(40, fast, false)
+	assert.Equal(t, 8, int(l.limit), "Expected the limit to stop at concurrent_requests")
+
+	run(1, slow, false)
+	assert.Equal(t, 4, int(l.limit), "Expected the limit to be halved when exceeding the target")
+	run(3, slow, false)
+	assert.Equal(t, 4, int(l.limit), "Expected at most one decrease per window")
+	run(1, 0, true)
+	assert.Equal(t, 2, int(l.limit), "Expected failures to decrease the limit")
+	run(10, slow, false)
+	assert.Equal(t, 2, int(l.limit), "Expected the limit to stop at min_concurrency")
+
+	r := l.report()
+	assert.Equal(t, 100, r.TargetLatencyMS)
+	assert.Equal(t, 8, r.SustainedConcurrency)
+	assert.Equal(t, 8, r.MaxConcurrency)
+	assert.Equal(t, 2, r.FinalConcurrency)
+	assert.Equal(t, 2, r.Decreases)
+}
+
+func TestAdaptiveLimiterBlocksAtLimit(t *testing.T) {
+	l := newAdaptiveLimiter(config.AdaptiveConfig{Enabled: true, TargetLatencyMS: 100}, 4, testutil.Logger)
+	assert.True(t, l.acquire(t.Context(), config.PriorityNormal))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	assert.False(t, l.acquire(ctx, config.PriorityNormal), "Expected the second request to wait for a free slot")
+
+	l.abandon()
+	assert.True(t, l.acquire(t.Context(), config.PriorityNormal), "Expected the abandoned slot to be free")
+	assert.Nil(t, newAdaptiveLimiter(config.AdaptiveConfig{}, 4, testutil.Logger))
+}
+
+func TestVirtualUserRequests(t *testing.T) {
+	endpoints := []config.Endpoint{{URL: "a", Weight: 2}, {URL: "b"}}
+	scenarios := []config.Scenario{
+		{Name: "one", Steps: []config.Step{{Name: "a"}}},
+		{Name: "two", Steps: []config.Step{{Name: "a"}, {Name: "b"}}},
+	}
+
+	tests := []struct {
+		name     string
+		probing  config.ProbingConfig
+		expected int
+	}{
+		{
+			name:     "Endpoints",
+			probing:  config.ProbingConfig{TotalRequests: 5, Endpoints: endpoints, VirtualUsers: config.VirtualUsers{Count: 2}},
+			expected: 2 * 5 * 3,
+		},
+		{
+			name:     "Scenarios Assigned In Turn",
+			probing:  config.ProbingConfig{Endpoints: endpoints, Scenarios: scenarios, VirtualUsers: config.VirtualUsers{Count: 3, Iterations: 2}},
+			expected: 2*1 + 2*2 + 2*1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, vuRequests(tc.probing))
+		})
+	}
+}
+
+func TestSleepContext(t *testing.T) {
+	assert.True(t, sleepContext(t.Context(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	assert.False(t, sleepContext(ctx, time.Hour), "Expected cancellation to end the wait")
+	assert.False(t, sleepContext(ctx, 0))
+}
+
+func TestCaptureVariables(t *testing.T) {
+	capture := &responseCapture{header: http.Header{"X-Session": {"abc"}}}
+	capture.body.WriteString(`{"id": 42}`)
+
+	captures := []config.Capture{
+		{Extraction: config.Extraction{Name: "id", JSON: "$.id"}},
+		{Extraction: config.Extraction{Name: "session", Header: "X-Session"}, Scope: config.CaptureScopeVU},
+	}
+	local := map[string]string{"id": "local"}
+	run := newRunVariables()
+
+	assert.NoError(t, captureVariables(captures, capture, local, run))
+	assert.Equal(t, map[string]string{"id": "local", "session": "abc"}, local)
+	assert.Equal(t, map[string]string{"id": "local", "session": "abc"}, run.with(local), "Expected local variables to take precedence")
+	assert.Equal(t, map[string]string{"id": "42"}, run.with(nil))
+
+	err := captureVariables([]config.Capture{{Extraction: config.Extraction{Name: "missing", Header: "X-Missing"}}}, capture, local, run)
+	assert.ErrorIs(t, err, ErrExtraction)
+}
+
+func TestHooks(t *testing.T) {
+	var served atomic.Int32
+	var signatures []string
+	var mu sync.Mutex
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		signatures = append(signatures, r.Header.Get("X-Signature"))
+		mu.Unlock()
+		fmt.Fprintf(w, `{"n": %d}`, served.Add(1))
+	}))
+	defer mockServer.Close()
+
+	cfg := &config.Config{ProbingConfig: config.ProbingConfig{
+		ConcurrentRequests: 1,
+		TotalRequests:      5,
+		RequestTimeoutMS:   1000,
+		Endpoints: []config.Endpoint{{
+			URL:    mockServer.URL,
+			Method: "POST",
+			Body:   "order",
+			Hooks: &config.Hooks{
+				PreRequest:   []string{"set_header('X-Signature', sha256(method + body + var('last')))"},
+				PostResponse: []string{"set_var('last', json('$.n'))", "assert(json('$.n') < 3, 'too many orders')"},
+			},
+		}},
+	}}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, runReport.SuccessfulRequests)
+	assert.Equal(t, 3, runReport.Errors["assertion"], "Expected a failing post_response hook to fail the request")
+
+	sum := sha256.Sum256([]byte("POSTorder1"))
+	assert.Len(t, signatures, 5)
+	assert.Equal(t, hex.EncodeToString(sum[:]), signatures[1], "Expected the pre_request hook to sign the request with the variable set by the previous response")
+}
+
+func TestMiddleware(t *testing.T) {
+	var clients []string
+	var mu sync.Mutex
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		clients = append(clients, r.Header.Get("X-Client"))
+		mu.Unlock()
+		if r.URL.Path == "/legacy" {
+			w.Header().Set("Deprecation", "true")
+		}
+	}))
+	defer mockServer.Close()
+
+	middleware.Register("deprecation", func(_ config.Middleware, _ *slog.Logger) (middleware.Middleware, error) {
+		return middleware.Funcs{
+			Before: func(_ context.Context, req *middleware.Request) error {
+				if strings.HasSuffix(req.URL, "/blocked") {
+					return errors.New("blocked endpoint")
+				}
+				return nil
+			},
+			After: func(_ context.Context, _ *middleware.Request, resp *middleware.Response) error {
+				if resp.Header.Get("Deprecation") != "" {
+					return errors.New("deprecated endpoint")
+				}
+				return nil
+			},
+		}, nil
+	})
+
+	cfg := &config.Config{ProbingConfig: config.ProbingConfig{
+		ConcurrentRequests: 1,
+		TotalRequests:      2,
+		RequestTimeoutMS:   1000,
+		Endpoints: []config.Endpoint{
+			{URL: mockServer.URL + "/current", Method: "GET"},
+			{URL: mockServer.URL + "/legacy", Method: "GET"},
+			{URL: mockServer.URL + "/blocked", Method: "GET"},
+		},
+		Middleware: []config.Middleware{
+			{Type: middleware.TypeHeaders, Headers: map[string]string{"X-Client": "enchante"}},
+			{Type: "deprecation"},
+		},
+	}}
+
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, runReport.SuccessfulRequests)
+	assert.Equal(t, 2, runReport.Errors["assertion"], "Expected a rejected response to fail the request")
+	assert.Equal(t, 2, runReport.Errors["other"], "Expected a rejected request to fail")
+	assert.Equal(t, []string{"enchante", "enchante", "enchante", "enchante"}, clients, "Expected rejected requests not to be sent")
+}
+
+func TestQueryParams(t *testing.T) {
+	var query url.Values
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+	}))
+	defer mockServer.Close()
+
+	testEndpoint := config.Endpoint{URL: mockServer.URL + "/search", Method: "GET", QueryParams: map[string]string{"q": "{{term}}", "lang": "en/us"}}
+	testEndpoint, err := expandEndpoint(testEndpoint, map[string]string{"term": "100% cotton?"})
+	assert.NoError(t, err)
+	_, err = makeRequest(t.Context(), newTestClient(t), testEndpoint, nil, defaultTimeout, testutil.Logger)
+
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{"q": {"100% cotton?"}, "lang": {"en/us"}}, query)
+}
+
+func TestResultStream(t *testing.T) {
+	stream := newResultStream()
+	server := httptest.NewServer(http.HandlerFunc(stream.serveHTTP))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	// the subscription is registered before the response headers are sent
+	stat := &endpointStat{endpoint: config.Endpoint{URL: "http://localhost/items", Method: "GET"}}
+	stream.send(newResultRecord(stat, result{sample: sample{duration: 15 * time.Millisecond}}, time.Now()))
+	stream.send(newResultRecord(stat, result{err: ErrStatusCode}, time.Now()))
+	stream.close()
+
+	decoder := json.NewDecoder(resp.Body)
+	var records []resultRecord
+	for {
+		var record resultRecord
+		if err := decoder.Decode(&record); err != nil {
+			assert.ErrorIs(t, err, io.EOF, "Expected the stream to end when it is closed")
+			break
+		}
+		records = append(records, record)
+	}
+
+	assert.Len(t, records, 2)
+	assert.Equal(t, "http://localhost/items", records[0].URL)
+	assert.Equal(t, 15.0, records[0].DurationMS)
+	assert.True(t, records[0].Success)
+	assert.False(t, records[1].Success)
+	assert.Equal(t, ErrStatusCode.Error(), records[1].Error)
+}
+
+func TestResultStreamDropsForSlowSubscribers(t *testing.T) {
+	stream := newResultStream()
+	records, cancel := stream.subscribe()
+	defer cancel()
+
+	for range streamBuffer + 10 {
+		stream.send(resultRecord{})
+	}
+
+	assert.Len(t, records, streamBuffer)
+	assert.Equal(t, int64(10), stream.dropped.Load())
+}
+
+func TestGRPCResultStream(t *testing.T) {
+	server, err := NewStreamServer(config.StreamConfig{GRPCListen: "127.0.0.1:0"}, testutil.Logger)
+	assert.NoError(t, err)
+	conn, err := grpc.NewClient(server.grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	subscription, err := streampb.NewResultStreamClient(conn).Subscribe(t.Context(), &streampb.SubscribeRequest{FailuresOnly: true})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		server.stream.mu.Lock()
+		defer server.stream.mu.Unlock()
+		return len(server.stream.subscribers) == 1
+	}, time.Second, 5*time.Millisecond, "Expected the subscription to be registered")
+
+	// a run attached to the server leaves the subscriptions open when it ends
+	stream, stop := startResultStream(WithStreamServer(t.Context(), server), config.StreamConfig{}, "run-1", testutil.Logger)
+	stat := &endpointStat{endpoint: config.Endpoint{URL: "http://localhost/items", Method: "GET"}}
+	stream.send(newResultRecord(stat, result{sample: sample{duration: 15 * time.Millisecond}}, time.Now()))
+	stream.send(newResultRecord(stat, result{err: ErrStatusCode}, time.Now()))
+	stop()
+	stream.send(newResultRecord(stat, result{err: ErrTimeout}, time.Now()))
+	server.Close()
+
+	var results []*streampb.Result
+	for {
+		r, err := subscription.Recv()
+		if err != nil {
+			assert.ErrorIs(t, err, io.EOF, "Expected the stream to end when the server closes")
+			break
+		}
+		results = append(results, r)
+	}
+
+	if assert.Len(t, results, 2, "Expected only the failed requests") {
+		assert.Equal(t, "run-1", results[0].RunId)
+		assert.Equal(t, "http://localhost/items", results[0].Url)
+		assert.Equal(t, ErrStatusCode.Error(), results[0].Error)
+		assert.Equal(t, ErrTimeout.Error(), results[1].Error)
+	}
+}
+
+func TestLatencyRecorder(t *testing.T) {
+	stats := newEndpointStats([]config.Endpoint{{URL: "a"}, {URL: "b"}})
+	recorder := newLatencyRecorder(4, len(stats))
+
+	for worker := range 4 {
+		recorder.record(worker, 0, time.Duration(worker+1)*time.Millisecond)
+	}
+	recorder.record(3, 1, time.Second)
+	recorder.merge(stats)
+
+	assert.Equal(t, int64(4), stats[0].latency.Count(), "Expected the shards to be merged")
+	assert.Equal(t, 2500*time.Microsecond, stats[0].avgResponseTime())
+	assert.Equal(t, time.Second, stats[1].avgResponseTime())
+}
+
+func TestRecordWriter(t *testing.T) {
+	writer, err := newRecordWriter("", "samples file")
+	assert.NoError(t, err)
+	assert.Nil(t, writer, "Expected no writer without a file")
+
+	_, err = newRecordWriter(t.TempDir(), "samples file")
+	assert.ErrorContains(t, err, "error creating samples file", "Expected an error for a directory")
+}
+
+func TestPhaseStats(t *testing.T) {
+	var s phaseStats
+	s.record(phaseTimings{dns: 2 * time.Millisecond, connect: 3 * time.Millisecond, ttfb: 10 * time.Millisecond, bodyRead: time.Millisecond})
+	s.record(phaseTimings{ttfb: 20 * time.Millisecond, bodyRead: time.Millisecond, reused: true})
+
+	phases := s.report()
+	assert.Equal(t, 1, phases.NewConnections)
+	assert.Equal(t, 2.0, phases.DNS.AvgMS)
+	assert.Equal(t, 3.0, phases.Connect.AvgMS, "Expected reused connections not to dilute the connect time")
+	assert.Zero(t, phases.TLS.MaxMS)
+	assert.Equal(t, 15.0, phases.TTFB.AvgMS)
+	assert.Equal(t, 1.0, phases.BodyRead.AvgMS)
+}
+
+func TestReuseStats(t *testing.T) {
+	var s phaseStats
+	s.record(phaseTimings{tlsHandshake: true})
+	s.record(phaseTimings{tlsHandshake: true, tlsResumed: true})
+	s.record(phaseTimings{reused: true})
+	s.record(phaseTimings{reused: true})
+
+	r := s.reuse()
+	assert.Equal(t, 2, r.ReusedConnections)
+	assert.Equal(t, 0.5, r.ConnectionReuseRate)
+	assert.Equal(t, 2, r.TLSHandshakes)
+	assert.Equal(t, 1, r.TLSResumptions)
+	assert.Equal(t, 0.5, r.TLSResumptionRate)
+}
+
+func TestTLSSessionResumption(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client, err := newHTTPClient(config.NetworkConfig{ReuseConnections: true}, nil, &trafficCounter{})
+	assert.NoError(t, err)
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig.RootCAs = server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	testEndpoint := config.Endpoint{URL: server.URL, Method: "GET"}
+	first, err := makeRequest(t.Context(), client, testEndpoint, nil, defaultTimeout, testutil.Logger)
+	assert.NoError(t, err)
+	assert.True(t, first.phases.tlsHandshake)
+	assert.False(t, first.phases.tlsResumed, "Expected a full handshake on the first connection")
+
+	pooled, err := makeRequest(t.Context(), client, testEndpoint, nil, defaultTimeout, testutil.Logger)
+	assert.NoError(t, err)
+	assert.True(t, pooled.phases.reused, "Expected the second request to reuse the pooled connection")
+	assert.False(t, pooled.phases.tlsHandshake)
+
+	transport.CloseIdleConnections()
+	resumed, err := makeRequest(t.Context(), client, testEndpoint, nil, defaultTimeout, testutil.Logger)
+	assert.NoError(t, err)
+	assert.True(t, resumed.phases.tlsResumed, "Expected the new connection to resume the TLS session")
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		status   int
+		header   string
+		expected time.Duration
+	}{
+		{name: "Seconds", status: http.StatusTooManyRequests, header: "3", expected: 3 * time.Second},
+		{name: "HTTP Date", status: http.StatusServiceUnavailable, header: "Sat, 01 Mar 2025 12:00:10 GMT", expected: 10 * time.Second},
+		{name: "Date In The Past", status: http.StatusServiceUnavailable, header: "Sat, 01 Mar 2025 11:00:00 GMT"},
+		{name: "Invalid", status: http.StatusTooManyRequests, header: "soon"},
+		{name: "Missing", status: http.StatusTooManyRequests},
+		{name: "Other Status", status: http.StatusInternalServerError, header: "3"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tc.status, Header: http.Header{}}
+			if tc.header != "" {
+				resp.Header.Set("Retry-After", tc.header)
+			}
+			assert.Equal(t, tc.expected, retryAfter(resp, now))
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(config.RetryAfterConfig{Enabled: true, MaxWaitMS: 100}, 2)
+	start := time.Now()
+
+	assert.Equal(t, 100*time.Millisecond, b.pause(0, time.Minute), "Expected the pause to be capped")
+	b.pause(0, 50*time.Millisecond)
+	assert.True(t, b.wait(t.Context(), 1), "Expected other targets not to be paused")
+	assert.True(t, b.wait(t.Context(), 0))
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	r := b.report(0, time.Now(), time.Second)
+	assert.Equal(t, 1, r.Pauses, "Expected an overlapping pause not to be counted")
+	assert.InDelta(t, 100, r.PausedMS, 5)
+	assert.InDelta(t, 0.1, r.PausedShare, 0.01)
+	assert.Nil(t, b.report(1, time.Now(), time.Second))
+
+	assert.True(t, newBackoff(config.RetryAfterConfig{}, 1).wait(t.Context(), 0), "Expected no pauses when disabled")
+}
+
+func TestBetween(t *testing.T) {
+	start := time.Now()
+	assert.Equal(t, time.Second, between(start, start.Add(time.Second)))
+	assert.Zero(t, between(start, time.Time{}))
+	assert.Zero(t, between(time.Time{}, start))
+	assert.Zero(t, between(start, start.Add(-time.Second)))
+}
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"Client Error", &statusError{code: 404}, errorStatus4xx},
+		{"Server Error", &statusError{code: 503}, errorStatus5xx},
+		{"Unexpected Success", &statusError{code: 204}, errorStatusUnexpected},
+		{"Extraction", fmt.Errorf("%w: id: not found", ErrExtraction), errorAssertion},
+		{"Timeout", fmt.Errorf("%w after 1s: %w", ErrTimeout, context.DeadlineExceeded), errorTimeout},
+		{"Deadline", fmt.Errorf("%w: %w", ErrRequestFailed, context.DeadlineExceeded), errorTimeout},
+		{"DNS", fmt.Errorf("%w: %w", ErrRequestFailed, &net.DNSError{Err: "no such host", Name: "invalid.test", IsNotFound: true}), errorDNS},
+		{"DNS Timeout", &net.DNSError{Err: "i/o timeout", Name: "slow.test", IsTimeout: true}, errorTimeout},
+		{"Connection Reset", &net.OpError{Op: "read", Err: syscall.ECONNRESET}, errorConnectionReset},
+		{"Other", errors.New("boom"), errorOther},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, classifyError(tc.err))
+		})
+	}
+}
+
+func TestClassifyTLSError(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	testEndpoint := config.Endpoint{URL: server.URL, Method: "GET"}
+	_, err := makeRequest(t.Context(), newTestClient(t), testEndpoint, nil, defaultTimeout, testutil.Logger)
+
+	assert.Error(t, err)
+	assert.Equal(t, errorTLS, classifyError(err), "Expected the untrusted certificate to be classified as TLS error")
+}
+
+func TestStatusErrorMessage(t *testing.T) {
+	err := error(&statusError{code: 502})
+	assert.True(t, errors.Is(err, ErrStatusCode))
+	assert.Equal(t, "received unexpected status code: status code 502", err.Error())
+}
+
+func TestScenarioDependencies(t *testing.T) {
+	failing := errors.New("boom")
+
+	tests := []struct {
+		name     string
+		steps    []config.Step
+		fail     string
+		expected []string
+	}{
+		{
+			name:     "Failure Aborts By Default",
+			steps:    []config.Step{{Name: "login"}, {Name: "browse"}, {Name: "checkout"}},
+			fail:     "login",
+			expected: []string{"login:failed", "browse:skipped", "checkout:skipped"},
+		},
+		{
+			name: "Independent Steps Continue",
+			steps: []config.Step{
+				{Name: "recommendations", OnFailure: config.OnFailureContinue},
+				{Name: "add", DependsOn: []string{"recommendations"}, OnFailure: config.OnFailureContinue},
+				{Name: "browse"},
+			},
+			fail:     "recommendations",
+			expected: []string{"recommendations:failed", "add:skipped", "browse:ok"},
+		},
+		{
+			name: "Skipped Step Aborts",
+			steps: []config.Step{
+				{Name: "recommendations", OnFailure: config.OnFailureContinue},
+				{Name: "add", DependsOn: []string{"recommendations"}},
+				{Name: "browse"},
+			},
+			fail:     "recommendations",
+			expected: []string{"recommendations:failed", "add:skipped", "browse:skipped"},
+		},
+		{
+			name: "Dependencies Succeeded",
+			steps: []config.Step{
+				{Name: "login"},
+				{Name: "browse", DependsOn: []string{"login"}},
+			},
+			expected: []string{"login:ok", "browse:ok"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			scenario := &config.Scenario{Name: "shop", Steps: tc.steps}
+			send := func(ctx context.Context, worker, index int, endpoint config.Endpoint) (result, bool) {
+				r := result{endpoint: index}
+				if tc.steps[index].Name == tc.fail {
+					r.err = failing
+				}
+				return r, true
+			}
+
+			var outcomes []string
+			publish := func(r result) {
+				outcome := "ok"
+				switch {
+				case errors.Is(r.err, ErrStepSkipped):
+					outcome = "skipped"
+				case r.err != nil:
+					outcome = "failed"
+				}
+				outcomes = append(outcomes, tc.steps[r.endpoint].Name+":"+outcome)
+			}
+
+			assert.True(t, runScenario(t.Context(), 0, job{scenario: scenario}, nil, send, publish, testutil.Logger))
+			assert.Equal(t, tc.expected, outcomes)
+		})
+	}
+}
+
+func TestJourneyTracker(t *testing.T) {
+	scenarios := []config.Scenario{
+		{Name: "checkout", SLAMS: 250, Steps: []config.Step{{Name: "cart"}, {Name: "pay"}}},
+		{Name: "browse", Steps: []config.Step{{Name: "list"}}},
+	}
+	// target 0 is an endpoint, the scenario steps follow
+	tracker := newJourneyTracker(scenarios, []int{1, 3})
+
+	results := []result{
+		{endpoint: 0, worker: 0},
+		// the iterations of two workers interleave
+		{endpoint: 1, worker: 0, sample: sample{duration: 100 * time.Millisecond}},
+		{endpoint: 1, worker: 1, sample: sample{duration: 100 * time.Millisecond}},
+		{endpoint: 2, worker: 1, sample: sample{duration: 200 * time.Millisecond}},
+		{endpoint: 2, worker: 0, sample: sample{duration: 100 * time.Millisecond}},
+		{endpoint: 1, worker: 0, err: ErrRequestFailed},
+		{endpoint: 2, worker: 0, err: ErrStepSkipped},
+		// an iteration interrupted by a cancellation is not counted
+		{endpoint: 1, worker: 1, sample: sample{duration: 100 * time.Millisecond}},
+		{endpoint: 3, worker: 1, sample: sample{duration: 50 * time.Millisecond}},
+	}
+	for _, r := range results {
+		tracker.record(r)
+	}
+
+	reports := tracker.report()
+	assert.Len(t, reports, 2)
+	assert.Equal(t, "checkout", reports[0].Name)
+	assert.Equal(t, 3, reports[0].Iterations)
+	assert.Equal(t, 2, reports[0].SuccessfulIterations)
+	assert.Equal(t, 1, reports[0].FailedIterations)
+	assert.Equal(t, 1, reports[0].SLABreaches, "Expected the 300ms journey to breach the 250ms SLA")
+	assert.InDelta(t, 250.0, reports[0].Latency.AvgMS, 2.5)
+	assert.Equal(t, 1, reports[1].SuccessfulIterations)
+}
+
+func TestMBps(t *testing.T) {
+	assert.Equal(t, 2.0, mbps(4_000_000, 2*time.Second))
+	assert.Zero(t, mbps(1000, 0))
+}
+
+func TestResolveHosts(t *testing.T) {
+	targets := []config.Endpoint{
+		{URL: "http://localhost:8080/items"},
+		{URL: "http://localhost:8080/users"},
+		{URL: "http://127.0.0.1:8080"},
+		{URL: "http://{{host}}/items"},
+	}
+
+	pins, err := resolveHosts(t.Context(), net.DefaultResolver, targets)
+	assert.NoError(t, err)
+	assert.Len(t, pins, 1, "Expected IP addresses and templated hosts not to be pinned")
+	assert.NotEmpty(t, pins["localhost"])
+
+	_, err = resolveHosts(t.Context(), net.DefaultResolver, []config.Endpoint{{URL: "http://invalid-host.invalid"}})
+	assert.ErrorContains(t, err, "failed to resolve invalid-host.invalid")
+}
+
+func TestPinnedDialer(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "pinned.test", r.Host[:strings.Index(r.Host, ":")], "Expected the original host header")
+	}))
+	defer mockServer.Close()
+
+	_, port, err := net.SplitHostPort(mockServer.Listener.Addr().String())
+	assert.NoError(t, err)
+	// the first address refuses the connection, the second one is the server
+	pins := hostPins{"pinned.test": {"127.0.0.2", "127.0.0.1"}}
+	client, err := newHTTPClient(config.NetworkConfig{}, pins, &trafficCounter{})
+	assert.NoError(t, err)
+
+	testEndpoint := config.Endpoint{URL: "http://pinned.test:" + port, Method: "GET"}
+	_, err = makeRequest(t.Context(), client, testEndpoint, nil, defaultTimeout, testutil.Logger)
+	assert.NoError(t, err)
+}
+
+func TestAdaptiveLimiterPriorities(t *testing.T) {
+	l := newAdaptiveLimiter(config.AdaptiveConfig{Enabled: true, TargetLatencyMS: 100}, 4, testutil.Logger)
+	assert.False(t, l.shed(config.PriorityBulk), "Expected bulk requests to be sent while a slot is free")
+	assert.True(t, l.acquire(t.Context(), config.PriorityNormal))
+	assert.True(t, l.shed(config.PriorityBulk), "Expected bulk requests to be shed at the limit")
+	assert.False(t, l.shed(config.PriorityNormal), "Expected normal requests to wait instead of being shed")
+	assert.False(t, l.shed(config.PriorityCritical), "Expected critical requests to wait instead of being shed")
+
+	// a normal request waits first, the critical request waiting after it gets the released slot
+	normal := make(chan bool, 1)
+	go func() { normal <- l.acquire(t.Context(), config.PriorityNormal) }()
+	critical := make(chan bool, 1)
+	assert.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.inFlight == 1
+	}, time.Second, time.Millisecond)
+	go func() { critical <- l.acquire(t.Context(), config.PriorityCritical) }()
+	assert.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.criticalWaiting == 1
+	}, time.Second, time.Millisecond)
+
+	l.abandon()
+	assert.True(t, <-critical, "Expected the critical request to be admitted first")
+	select {
+	case <-normal:
+		t.Fatal("Expected the normal request to wait behind the critical request")
+	case <-time.After(20 * time.Millisecond):
+	}
+	l.abandon()
+	assert.True(t, <-normal)
+
+	var disabled *adaptiveLimiter
+	assert.False(t, disabled.shed(config.PriorityBulk), "Expected nothing to be shed without adaptive concurrency")
+}
+
+func TestLogShedReport(t *testing.T) {
+	stats := newEndpointStats([]config.Endpoint{
+		{Method: "GET", URL: "https://api.example.com/export", Priority: config.PriorityBulk},
+		{Method: "GET", URL: "https://api.example.com/health", Priority: config.PriorityCritical},
+	})
+	stats[0].successes, stats[0].shed = 3, 1
+	stats[1].successes = 4
+
+	logShedReport(stats, testutil.Logger)
+
+	logs := testutil.GetLogs()
+	assert.Contains(t, logs, "Requests shed under saturation")
+}
+
+func TestHealthGateThresholds(t *testing.T) {
+	check := config.HealthCheck{URL: "http://health", UnhealthyThreshold: 2, HealthyThreshold: 2}
+	gate := newHealthGate()
+	start := time.Now()
+	failed := errors.New("unexpected status code 503")
+
+	steps := []struct {
+		err     error
+		paused  bool
+		resumed bool
+	}{
+		{err: failed},
+		{err: nil},
+		{err: failed},
+		{err: failed, paused: true},
+		{err: failed},
+		{err: nil},
+		{err: nil, resumed: true},
+	}
+	for i, step := range steps {
+		paused, resumed := gate.observe(step.err, check, start.Add(time.Duration(i)*time.Second))
+		assert.Equal(t, step.paused, paused, "check %d", i)
+		assert.Equal(t, step.resumed, resumed, "check %d", i)
+	}
+
+	assert.True(t, gate.wait(t.Context()), "Expected the gate to be open after resuming")
+	r := gate.report("http://health", start.Add(time.Minute))
+	assert.Equal(t, &report.HealthCheck{URL: "http://health", Checks: 7, FailedChecks: 4, Pauses: 1, PausedMS: 3000}, r)
+
+	gate.observe(failed, check, start.Add(10*time.Second))
+	gate.observe(failed, check, start.Add(11*time.Second))
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	assert.False(t, gate.wait(ctx), "Expected the gate to hold requests while paused")
+	assert.InDelta(t, 3000+49000, gate.report("http://health", start.Add(time.Minute)).PausedMS, 1, "Expected an open pause to count up to the end")
+
+	var disabled *healthGate
+	assert.True(t, disabled.wait(t.Context()))
+	assert.Nil(t, disabled.report("", time.Now()))
+}
+
+func TestEvaluateCORS(t *testing.T) {
+	const origin = "https://app.example.com"
+	tests := []struct {
+		name     string
+		check    config.CORSCheck
+		method   string
+		status   int
+		headers  map[string]string
+		failures []string
+	}{
+		{
+			name:    "allowed",
+			check:   config.CORSCheck{Origin: origin, Headers: []string{"Authorization", "X-Tenant"}},
+			method:  "PUT",
+			status:  http.StatusNoContent,
+			headers: map[string]string{"Access-Control-Allow-Origin": origin, "Access-Control-Allow-Methods": "GET, PUT", "Access-Control-Allow-Headers": "authorization, x-tenant"},
+		},
+		{
+			name:    "safelisted method and wildcards",
+			check:   config.CORSCheck{Origin: origin, Headers: []string{"X-Tenant"}},
+			method:  "POST",
+			status:  http.StatusOK,
+			headers: map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Headers": "*"},
+		},
+		{
+			name:     "missing headers",
+			check:    config.CORSCheck{Origin: origin, Headers: []string{"X-Tenant"}},
+			method:   "DELETE",
+			status:   http.StatusForbidden,
+			failures: []string{"unexpected status code 403", "Access-Control-Allow-Origin is missing", "method DELETE is not in Access-Control-Allow-Methods", "header X-Tenant is not in Access-Control-Allow-Headers"},
+		},
+		{
+			name:     "other origin",
+			check:    config.CORSCheck{Origin: origin},
+			method:   "GET",
+			status:   http.StatusNoContent,
+			headers:  map[string]string{"Access-Control-Allow-Origin": "https://other.example.com"},
+			failures: []string{`Access-Control-Allow-Origin is "https://other.example.com", want "https://app.example.com"`},
+		},
+		{
+			name:     "wildcards with credentials",
+			check:    config.CORSCheck{Origin: origin, Credentials: true},
+			method:   "PATCH",
+			status:   http.StatusNoContent,
+			headers:  map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Methods": "*"},
+			failures: []string{"Access-Control-Allow-Origin is * but credentials are required", "Access-Control-Allow-Credentials is not true", "method PATCH is not in Access-Control-Allow-Methods"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			for key, value := range tt.headers {
+				resp.Header.Set(key, value)
+			}
+			assert.Equal(t, tt.failures, evaluateCORS(tt.check, tt.method, resp))
+		})
+	}
+}
+
+func TestHeaderBreakdown(t *testing.T) {
+	stats := newEndpointStats([]config.Endpoint{{URL: "http://a", Method: "GET"}})
+	setBreakdownHeaders(stats, []string{"x-cache", "X-Request-Id"})
+
+	for i := range 30 {
+		header := http.Header{}
+		if i%3 != 0 {
+			header.Set("X-Cache", "HIT")
+		}
+		header.Set("X-Request-Id", fmt.Sprint(i))
+		stats[0].record(sample{duration: time.Duration(i+1) * time.Millisecond, header: header})
+	}
+
+	breakdown := stats[0].breakdown.report()
+	assert.Equal(t, int64(20), breakdown["X-Cache"]["HIT"].Requests)
+	assert.Equal(t, int64(10), breakdown["X-Cache"][breakdownMissing].Requests)
+	assert.Equal(t, 1.0, breakdown["X-Cache"][breakdownMissing].Latency.MinMS)
+
+	requestIDs := breakdown["X-Request-Id"]
+	assert.Len(t, requestIDs, maxBreakdownValues+1, "Expected the values above the limit to be recorded as other")
+	assert.Equal(t, int64(30-maxBreakdownValues), requestIDs[breakdownOther].Requests)
+
+	assert.Nil(t, newEndpointStats([]config.Endpoint{{URL: "http://a"}})[0].breakdown.report())
+}
+
+func TestController(t *testing.T) {
+	ctx, stop := context.WithCancelCause(t.Context())
+	control := newController(newProgressTracker(time.Now(), 10), stop)
+	controlServer := newControlServer("secret", testutil.Logger)
+	server := httptest.NewServer(controlServer)
+	defer server.Close()
+
+	call := func(method, path, body, token string) (int, controlStats) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		var stats controlStats
+		json.NewDecoder(resp.Body).Decode(&stats)
+		return resp.StatusCode, stats
+	}
+
+	status, _ := call(http.MethodGet, "/v1/stats", "", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = call(http.MethodGet, "/v1/stats", "", "secret")
+	assert.Equal(t, http.StatusConflict, status, "Expected a conflict without a run in progress")
+	detach := controlServer.attach(control)
+
+	status, stats := call(http.MethodPost, "/v1/pause", "", "secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, stats.Paused)
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	assert.False(t, control.wait(waitCtx), "Expected requests to be held while paused")
+	cancel()
+	_, stats = call(http.MethodPost, "/v1/resume", "", "secret")
+	assert.False(t, stats.Paused)
+	assert.Positive(t, stats.PausedMS)
+	assert.True(t, control.wait(ctx))
+
+	status, _ = call(http.MethodPut, "/v1/rate", `{"rps": -1}`, "secret")
+	assert.Equal(t, http.StatusBadRequest, status)
+	_, stats = call(http.MethodPut, "/v1/rate", `{"rps": 50}`, "secret")
+	assert.Equal(t, 50.0, stats.RPSLimit)
+	start := time.Now()
+	for range 4 {
+		assert.True(t, control.wait(ctx))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 55*time.Millisecond, "Expected the starts to be spaced by the rate limit")
+
+	status, _ = call(http.MethodPut, "/v1/workers", `{"workers": 3}`, "secret")
+	assert.Equal(t, http.StatusConflict, status, "Expected the workers not to be changed without a worker pool")
+
+	var wg sync.WaitGroup
+	finish := make(chan struct{})
+	pool := newWorkerPool(&wg, func(_ int, stop <-chan struct{}) {
+		select {
+		case <-stop:
+		case <-finish:
+		}
+	})
+	pool.start(2, 2)
+	control.setPool(pool, 4)
+	status, _ = call(http.MethodPut, "/v1/workers", `{"workers": 1000000}`, "secret")
+	assert.Equal(t, http.StatusBadRequest, status, "Expected more workers than max_workers to be rejected")
+	assert.Equal(t, 2, pool.size())
+	status, _ = call(http.MethodPut, "/v1/workers", `{"workers": 4}`, "secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 4, pool.size())
+	close(finish)
+	wg.Wait()
+
+	_, stats = call(http.MethodPost, "/v1/stop", "", "secret")
+	assert.True(t, stats.Stopping)
+	assert.ErrorIs(t, context.Cause(ctx), errStopped)
+
+	detach()
+	status, _ = call(http.MethodPost, "/v1/pause", "", "secret")
+	assert.Equal(t, http.StatusConflict, status, "Expected a conflict after the run ended")
+
+	_, err := NewControlServer(config.ControlConfig{Listen: ":0"}, testutil.Logger)
+	assert.ErrorContains(t, err, "requires a token", "Expected the control API not to listen on all interfaces without a token")
+}
+
+func TestWorkerPool(t *testing.T) {
+	var wg sync.WaitGroup
+	var active atomic.Int32
+	finish := make(chan struct{})
+	var ids sync.Map
+	pool := newWorkerPool(&wg, func(worker int, stop <-chan struct{}) {
+		ids.Store(worker, true)
+		active.Add(1)
+		defer active.Add(-1)
+		select {
+		case <-stop:
+		case <-finish:
+		}
+	})
+
+	pool.start(2, 10)
+	assert.Equal(t, 2, pool.size())
+	assert.True(t, pool.resize(4))
+	assert.Equal(t, 4, pool.size())
+	assert.Eventually(t, func() bool { return active.Load() == 4 }, time.Second, time.Millisecond)
+	assert.True(t, pool.resize(1))
+	assert.Eventually(t, func() bool { return active.Load() == 1 }, time.Second, time.Millisecond,
+		"Expected the removed workers to stop")
+
+	close(finish)
+	wg.Wait()
+	assert.False(t, pool.resize(2), "Expected no workers to be started after the pool finished")
+	for _, id := range []int{0, 1, 10, 11} {
+		_, ok := ids.Load(id)
+		assert.True(t, ok, "Expected worker %d to have run", id)
+	}
+}
+
+func TestEvaluateSLO(t *testing.T) {
+	r := &report.Report{TotalRequests: 10, SuccessfulRequests: 9, FailedRequests: 1}
+	var fast, slow report.Histogram
+	for range 7 {
+		fast.Record(50 * time.Millisecond)
+	}
+	slow.Record(100 * time.Millisecond)
+	slow.Record(900 * time.Millisecond)
+	slo := config.SLOConfig{Availability: 95, Latency: config.LatencyObjective{ThresholdMS: 300, Target: 80}}
+
+	results := EvaluateSLO(slo, r, []*report.Histogram{&fast, &slow, nil})
+
+	assert.Len(t, results, 2)
+	assert.Equal(t, report.SLOAvailability, results[0].Objective)
+	assert.InDelta(t, 90, results[0].Compliance, 1e-9)
+	assert.False(t, results[0].Met)
+	assert.InDelta(t, 2, results[0].BurnRate, 1e-9)
+	assert.Equal(t, report.SLOLatency, results[1].Objective)
+	assert.Equal(t, int64(9), results[1].TotalRequests)
+	assert.Equal(t, int64(8), results[1].GoodRequests)
+	assert.True(t, results[1].Met)
+	assert.Empty(t, EvaluateSLO(config.SLOConfig{}, r, nil), "Expected no results without objectives")
+}
+
+func TestRequestCounter(t *testing.T) {
+	counter := newRequestCounter(4)
+
+	var wg sync.WaitGroup
+	for worker := range 8 {
+		wg.Go(func() {
+			for i := range 100 {
+				counter.add(worker, i%10 == 0)
+			}
+		})
+	}
+	wg.Wait()
+
+	successes, failures := counter.totals()
+	assert.Equal(t, 720, successes, "Expected the workers beyond the shards to share them")
+	assert.Equal(t, 80, failures)
+}
+
+func TestStartAuth(t *testing.T) {
+	var fetches atomic.Int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := fetches.Add(1)
+		fmt.Fprintf(w, `{"access_token": "token-%d"}`, n)
+	}))
+	defer tokenServer.Close()
+
+	global := config.AuthConfig{Enabled: true, Type: "oauth2", OAuth2: config.OAuth2Auth{TokenURL: tokenServer.URL}}
+	apiKey := config.AuthConfig{Enabled: true, Type: "api_key", APIKey: config.APIKeyAuth{Header: "X-API-Key", Value: "key"}}
+	targets := []config.Endpoint{
+		{URL: "http://localhost/a", Headers: map[string]string{"Accept": "application/json"}},
+		{URL: "http://localhost/b"},
+		{URL: "http://localhost/c", AuthConfig: &apiKey},
+		{URL: "http://localhost/d", AuthConfig: &config.AuthConfig{}},
+	}
+	headers, stop := startAuth(t.Context(), targets, &global, testutil.Logger)
+	defer stop()
+
+	for range 10 {
+		for i, target := range targets {
+			_, err := headers.headers(target, i)
+			assert.NoError(t, err)
+		}
+	}
+	assert.Equal(t, int32(1), fetches.Load(), "Expected the token to be fetched once before the requests")
+
+	a, _ := headers.headers(targets[0], 0)
+	assert.Equal(t, map[string]string{"Accept": "application/json", "Authorization": "Bearer token-1", "User-Agent": userAgent}, a)
+	c, _ := headers.headers(targets[2], 2)
+	assert.Equal(t, "key", c["X-API-Key"])
+	assert.NotContains(t, c, "Authorization")
+	d, _ := headers.headers(targets[3], 3)
+	assert.Equal(t, map[string]string{"User-Agent": userAgent}, d, "Expected disabled endpoint auth to override the global auth")
+}
+
+func TestAuthCredentialRefresh(t *testing.T) {
+	fail := false
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"access_token": "token", "expires_in": 60}`))
+	}))
+	defer tokenServer.Close()
+
+	c := &authCredential{cfg: &config.AuthConfig{Enabled: true, Type: "oauth2", OAuth2: config.OAuth2Auth{TokenURL: tokenServer.URL}}}
+	c.resolve(testutil.Logger)
+	assert.InDelta(t, 45*time.Second, c.refreshDelay(time.Now()), float64(time.Second), "Expected a refresh at three quarters of the lifetime")
+	c.cfg.RefreshIntervalMS = 10000
+	assert.Equal(t, 10*time.Second, c.refreshDelay(time.Now()), "Expected the shorter refresh interval")
+
+	fail = true
+	c.resolve(testutil.Logger)
+	assert.Equal(t, authRetryInterval, c.refreshDelay(time.Now()))
+	_, value, err := c.get()
+	assert.NoError(t, err, "Expected the previous credential to be kept")
+	assert.Equal(t, "Bearer token", value)
+
+	unresolved := &authCredential{cfg: c.cfg}
+	unresolved.resolve(testutil.Logger)
+	_, _, err = unresolved.get()
+	assert.ErrorContains(t, err, "OAuth server returned status: 500")
+
+	static := &authCredential{cfg: &config.AuthConfig{Enabled: true, Type: "basic"}}
+	static.resolve(testutil.Logger)
+	assert.Zero(t, static.refreshDelay(time.Now()), "Expected a credential without expiry to be kept")
+}
+
+func TestInFlightCap(t *testing.T) {
+	assert.Nil(t, newInFlightCap(config.ProbingConfig{}, 4, testutil.Logger), "Expected no cap by default")
+
+	c := newInFlightCap(config.ProbingConfig{MaxInFlight: 2}, 10, testutil.Logger)
+	assert.True(t, c.acquire(t.Context()))
+	assert.True(t, c.acquire(t.Context()))
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	assert.False(t, c.acquire(ctx), "Expected the third request to wait for a free slot")
+
+	c.release(throttling(&statusError{code: http.StatusTooManyRequests}))
+	assert.True(t, c.acquire(t.Context()), "Expected the released slot to be free")
+	assert.Equal(t, 2, int(c.limit), "Expected no backpressure without it being enabled")
+	assert.Nil(t, c.report(time.Now()))
+}
+
+func TestBackpressure(t *testing.T) {
+	probing := config.ProbingConfig{MaxInFlight: 8, Backpressure: config.BackpressureConfig{Enabled: true, MinInFlight: 2}}
+	c := newInFlightCap(probing, 20, testutil.Logger)
+	throttled := &statusError{code: http.StatusServiceUnavailable}
+
+	// complete the given number of requests with the given error at the current cap
+	run := func(n int, err error) {
+		for range n {
+			assert.True(t, c.acquire(t.Context()))
+			c.release(throttling(err))
+		}
+	}
+
+	run(8, throttled)
+	assert.Equal(t, 4, int(c.limit), "Expected the cap to be halved after a window of requests")
+	run(3, throttled)
+	assert.Equal(t, 4, int(c.limit), "Expected at most one decrease per window")
+	run(20, throttled)
+	assert.Equal(t, 2, int(c.limit), "Expected the cap to stop at min_in_flight")
+	run(3, errors.New("connection refused"))
+	assert.Equal(t, 3, int(c.limit), "Expected other responses to grow the cap")
+	run(100, nil)
+	assert.Equal(t, 8, int(c.limit), "Expected the cap to stop at max_in_flight")
+
+	r := c.report(time.Now())
+	assert.Equal(t, 31, r.ThrottledResponses)
+	assert.Equal(t, 2, r.MinInFlight)
+	assert.Equal(t, 8, r.FinalInFlight)
+	assert.Equal(t, 2, r.Decreases)
+}
+
+func TestBackpressureRetryAfter(t *testing.T) {
+	probing := config.ProbingConfig{
+		ConcurrentRequests: 4,
+		RetryAfter:         config.RetryAfterConfig{MaxWaitMS: 50},
+		Backpressure:       config.BackpressureConfig{Enabled: true, HonorRetryAfter: true},
+	}
+	c := newInFlightCap(probing, 4, testutil.Logger)
+	assert.Equal(t, 4, int(c.maxLimit), "Expected the cap to default to the workers")
+
+	assert.True(t, c.acquire(t.Context()))
+	start := time.Now()
+	c.release(throttling(&statusError{code: http.StatusTooManyRequests, retryAfter: time.Minute}))
+	assert.True(t, c.acquire(t.Context()))
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond, "Expected the next request to wait for the capped Retry-After")
+	assert.InDelta(t, 50, c.report(time.Now()).PausedMS, 5)
+}
+
+func TestFindMax(t *testing.T) {
+	// the target fails once it served 25 requests, during the second step
+	var served atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if served.Add(1) > 25 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer mockServer.Close()
+
+	cfg := &config.Config{ProbingConfig: config.ProbingConfig{
+		ConcurrentRequests: 4,
+		RequestTimeoutMS:   1000,
+		Endpoints:          []config.Endpoint{{URL: mockServer.URL, Method: "GET"}},
+		Thresholds:         []config.Threshold{{Metric: "error_rate", Max: 0.1}},
+		Mode:               config.ModeFindMax,
+		FindMax:            config.FindMaxConfig{StartRPS: 50, StepDurationMS: 200},
+	}}
+
+	result, err := FindMax(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+
+	findMax := result.Report.FindMax
+	assert.Len(t, findMax.Steps, 2)
+	assert.Equal(t, 50.0, findMax.MaxSustainableRPS)
+	assert.Equal(t, 10, findMax.Steps[0].TotalRequests)
+	assert.True(t, findMax.Steps[0].Sustained)
+	assert.Equal(t, 20, findMax.Steps[1].TotalRequests)
+	assert.False(t, findMax.Steps[1].Sustained)
+	assert.Equal(t, report.FindMaxThresholds, findMax.Steps[1].Reason)
+	assert.Equal(t, 10, result.Report.TotalRequests, "Expected the report of the highest sustained step")
+	assert.False(t, result.Failed())
+}
+
+func TestFindMaxStep(t *testing.T) {
+	saturated := findMaxStep(100, &report.Report{TotalRequests: 50, SuccessfulRequests: 50, DurationMS: 1000})
+	assert.False(t, saturated.Sustained)
+	assert.Equal(t, report.FindMaxSaturated, saturated.Reason)
+	assert.Equal(t, 50.0, saturated.AchievedRPS)
+
+	warned := findMaxStep(100, &report.Report{TotalRequests: 95, SuccessfulRequests: 95, DurationMS: 1000,
+		Thresholds: []report.ThresholdResult{{Metric: "p95_ms", Severity: config.SeverityWarn, Breached: true}}})
+	assert.True(t, warned.Sustained, "Expected a warn breach not to end the search")
+}
+
+func TestOpenEngine(t *testing.T) {
+	tests := []struct {
+		name           string
+		delay          time.Duration
+		workers        int
+		totalRequests  int
+		queueTimeoutMS int
+		expectDropped  bool
+		expectMinMaxMS float64
+	}{
+		{name: "Constant Arrival Rate", workers: 2, totalRequests: 10},
+		{name: "Queue Wait In Latency", delay: 50 * time.Millisecond, workers: 1, totalRequests: 4, queueTimeoutMS: 1000, expectMinMaxMS: 100},
+		{name: "Queue Timeout", delay: 50 * time.Millisecond, workers: 1, totalRequests: 5, queueTimeoutMS: 20, expectDropped: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(tc.delay)
+			}))
+			defer mockServer.Close()
+
+			cfg := &config.Config{ProbingConfig: config.ProbingConfig{
+				ConcurrentRequests: tc.workers,
+				TotalRequests:      tc.totalRequests,
+				RequestTimeoutMS:   1000,
+				Endpoints:          []config.Endpoint{{URL: mockServer.URL, Method: "GET"}},
+				Engine:             config.EngineConfig{Model: config.EngineOpen, RateRPS: 100, QueueTimeoutMS: tc.queueTimeoutMS},
+			}}
+
+			start := time.Now()
+			runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+			assert.NoError(t, err)
+
+			assert.GreaterOrEqual(t, time.Since(start), time.Duration(tc.totalRequests-1)*10*time.Millisecond, "Expected the requests to arrive at the rate")
+			assert.Equal(t, tc.totalRequests, runReport.TotalRequests)
+			if tc.expectDropped {
+				assert.Positive(t, runReport.Errors["queue_timeout"], "Expected arrivals waiting for a free worker to be dropped")
+				assert.Positive(t, runReport.SuccessfulRequests)
+			} else {
+				assert.Equal(t, tc.totalRequests, runReport.SuccessfulRequests)
+			}
+			assert.GreaterOrEqual(t, runReport.Latency.MaxMS, tc.expectMinMaxMS, "Expected the queue wait to be part of the response time")
+		})
+	}
+}
+
+func TestQueuedSend(t *testing.T) {
+	send := func(ctx context.Context, worker, index int, endpoint config.Endpoint) (result, bool) {
+		return result{endpoint: index, sample: sample{duration: 10 * time.Millisecond}}, true
+	}
+	queued := queuedSend(send, 30*time.Millisecond)
+
+	first, _ := queued(t.Context(), 0, 0, config.Endpoint{})
+	second, _ := queued(t.Context(), 0, 1, config.Endpoint{})
+	assert.Equal(t, 40*time.Millisecond, first.sample.duration, "Expected the wait to be added to the first request")
+	assert.Equal(t, 10*time.Millisecond, second.sample.duration, "Expected the following steps not to include the wait")
+}
+
+func TestReplayEngine(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+	}))
+	defer mockServer.Close()
+
+	log := filepath.Join(t.TempDir(), "access.log")
+	assert.NoError(t, os.WriteFile(log, []byte(strings.Join([]string{
+		`10.0.0.1 - - [15/Oct/2026:10:00:01 +0000] "GET /items?page=2 HTTP/1.1" 200 512 "-" "Mozilla/5.0"`,
+		`10.0.0.2 - - [15/Oct/2026:10:00:00 +0000] "GET /items HTTP/1.1" 200 1024 "-" "Mozilla/5.0"`,
+		`10.0.0.1 - - [15/Oct/2026:10:00:02 +0000] "POST /cart HTTP/1.1" 201 64 "-" "Mozilla/5.0"`,
+		`garbage`,
+		`10.0.0.2 - - [15/Oct/2026:10:00:02 +0000] "GET /items HTTP/1.1" 200 1024`,
+	}, "\n")), 0o644))
+
+	cfg := &config.Config{ProbingConfig: config.ProbingConfig{
+		ConcurrentRequests: 2,
+		TotalRequests:      2,
+		RequestTimeoutMS:   1000,
+		Engine: config.EngineConfig{Model: config.EngineReplay, Replay: config.ReplayConfig{
+			File:   log,
+			Target: mockServer.URL + "/",
+			Speed:  10,
+		}},
+	}}
+
+	start := time.Now()
+	runReport, err := RunProbe(t.Context(), cfg, testutil.Logger)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond, "Expected the logged timing scaled by the speed, for both passes")
+	assert.Equal(t, 8, runReport.TotalRequests)
+	assert.Equal(t, 8, runReport.SuccessfulRequests)
+	assert.Len(t, runReport.Endpoints, 3, "Expected an endpoint per distinct request")
+	assert.Equal(t, []string{"GET /items", "GET /items?page=2"}, requests[:2], "Expected the requests in the order they arrived")
+}
+
+func TestInstanceClient(t *testing.T) {
+	var hits [2]atomic.Int32
+	var servers [2]*httptest.Server
+	for i := range servers {
+		// the certificate of the test server is valid for example.com
+		servers[i] = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "example.com", r.Host, "Expected the host of the URL")
+			hits[i].Add(1)
+		}))
+		defer servers[i].Close()
+	}
+
+	client, err := newHTTPClient(config.NetworkConfig{ReuseConnections: true}, nil, &trafficCounter{})
+	assert.NoError(t, err)
+	client.Transport.(*http.Transport).TLSClientConfig.RootCAs = servers[0].Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	endpoints := []config.Endpoint{
+		{URL: "https://example.com/health", Method: "GET", Instance: servers[0].Listener.Addr().String()},
+		{URL: "https://example.com/health", Method: "GET", Instance: servers[1].Listener.Addr().String()},
+	}
+	client = instanceClient(client, endpoints)
+
+	for round := 1; round <= 2; round++ {
+		for i, endpoint := range endpoints {
+			_, err := makeRequest(t.Context(), client, endpoint, nil, defaultTimeout, testutil.Logger)
+			assert.NoError(t, err, "Expected the certificate to be verified for the host of the URL")
+			assert.Equal(t, int32(round), hits[i].Load(), "Expected every request to be sent to its instance")
+		}
+	}
 
-	assert.Len(t, results, 1)
+	unchanged, _ := newHTTPClient(config.NetworkConfig{}, nil, &trafficCounter{})
+	assert.Same(t, unchanged, instanceClient(unchanged, []config.Endpoint{{URL: "http://example.com"}}))
 }
@@ -0,0 +1,148 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// webhookTimeout limits how long a single progress update may take
+const webhookTimeout = 5 * time.Second
+
+// progressUpdate represents the payload posted to the progress webhook
+type progressUpdate struct {
+	StartedAt         time.Time `json:"started_at"`
+	ElapsedMS         float64   `json:"elapsed_ms"`
+	PercentComplete   float64   `json:"percent_complete"`
+	CompletedRequests int64     `json:"completed_requests"`
+	FailedRequests    int64     `json:"failed_requests"`
+	TotalRequests     int64     `json:"total_requests"`
+	// CurrentRPS is the rate of completed requests since the previous update, over the whole run when done
+	CurrentRPS float64 `json:"current_rps"`
+	ErrorRate  float64 `json:"error_rate"`
+	Done       bool    `json:"done"`
+}
+
+// progressTracker counts the completed requests of a run, it is safe for concurrent use
+type progressTracker struct {
+	startedAt time.Time
+	total     int64
+	completed atomic.Int64
+	failed    atomic.Int64
+}
+
+// newProgressTracker creates a tracker for a run of total requests
+func newProgressTracker(startedAt time.Time, total int) *progressTracker {
+	return &progressTracker{startedAt: startedAt, total: int64(total)}
+}
+
+// record counts a completed request
+func (p *progressTracker) record(failed bool) {
+	p.completed.Add(1)
+	if failed {
+		p.failed.Add(1)
+	}
+}
+
+// update returns the progress at now, with the current rate measured since the previous update
+func (p *progressTracker) update(now, previous time.Time, previousCompleted int64) progressUpdate {
+	completed := p.completed.Load()
+	failed := p.failed.Load()
+
+	u := progressUpdate{
+		StartedAt:         p.startedAt,
+		ElapsedMS:         float64(now.Sub(p.startedAt)) / float64(time.Millisecond),
+		CompletedRequests: completed,
+		FailedRequests:    failed,
+		TotalRequests:     p.total,
+	}
+	if p.total > 0 {
+		u.PercentComplete = float64(completed) / float64(p.total) * 100
+	}
+	if completed > 0 {
+		u.ErrorRate = float64(failed) / float64(completed)
+	}
+	if elapsed := now.Sub(previous); elapsed > 0 {
+		u.CurrentRPS = float64(completed-previousCompleted) / elapsed.Seconds()
+	}
+	return u
+}
+
+// startProgressWebhook posts the progress to the webhook at the configured interval. The returned stop function
+// ends the updates and posts a final update marked as done
+func startProgressWebhook(ctx context.Context, webhook config.WebhookConfig, tracker *progressTracker, logger *slog.Logger) func() {
+	if webhook.URL == "" {
+		return func() {}
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	stopped := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(time.Duration(webhook.IntervalMS) * time.Millisecond)
+		defer ticker.Stop()
+
+		previous := tracker.startedAt
+		var previousCompleted int64
+		for {
+			select {
+			case <-stopped:
+				// the run may have been cancelled, the final update is sent regardless
+				u := tracker.update(time.Now(), tracker.startedAt, 0)
+				u.Done = true
+				postProgress(context.WithoutCancel(ctx), client, webhook, u, logger)
+				return
+			case now := <-ticker.C:
+				u := tracker.update(now, previous, previousCompleted)
+				previous, previousCompleted = now, u.CompletedRequests
+				postProgress(ctx, client, webhook, u, logger)
+			}
+		}
+	}()
+
+	return func() {
+		close(stopped)
+		<-finished
+	}
+}
+
+// postProgress sends a progress update to the webhook, failures are logged but do not affect the run
+func postProgress(ctx context.Context, client *http.Client, webhook config.WebhookConfig, u progressUpdate, logger *slog.Logger) {
+	body, err := json.Marshal(u)
+	if err != nil {
+		logger.Warn("Failed to encode progress update", "error", err)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		logger.Warn("Failed to create progress webhook request", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range webhook.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Warn("Failed to post progress update", "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		logger.Warn("Progress webhook returned error status", "status", resp.StatusCode)
+		return
+	}
+	logger.Debug("Posted progress update", "percent_complete", fmt.Sprintf("%.1f", u.PercentComplete), "done", u.Done)
+}
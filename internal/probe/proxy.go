@@ -0,0 +1,56 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// proxyKey is the context key for the proxy selected for a request
+type proxyKey struct{}
+
+// proxySetting represents the proxy used for the requests of an endpoint
+type proxySetting struct {
+	// configured is false when the proxy is taken from the environment (HTTP_PROXY, HTTPS_PROXY, NO_PROXY)
+	configured bool
+	// url is the proxy to use, nil for a direct connection
+	url *url.URL
+}
+
+// resolveProxies returns the proxy setting for each endpoint, an endpoint proxy overrides the global proxy
+func resolveProxies(globalProxy config.ProxyConfig, endpoints []config.Endpoint) ([]proxySetting, error) {
+	global, err := globalProxy.ProxyURL()
+	if err != nil {
+		return nil, err
+	}
+
+	proxies := make([]proxySetting, len(endpoints))
+	for i, endpoint := range endpoints {
+		switch {
+		case endpoint.Proxy != nil:
+			u, err := endpoint.Proxy.ProxyURL()
+			if err != nil {
+				return nil, err
+			}
+			proxies[i] = proxySetting{configured: true, url: u}
+		case globalProxy.Enabled:
+			proxies[i] = proxySetting{configured: true, url: global}
+		}
+	}
+	return proxies, nil
+}
+
+// withProxy stores the proxy setting for a request in the context
+func withProxy(ctx context.Context, proxy proxySetting) context.Context {
+	return context.WithValue(ctx, proxyKey{}, proxy)
+}
+
+// proxyFromContext is the transport Proxy function selecting the proxy stored in the request context
+func proxyFromContext(req *http.Request) (*url.URL, error) {
+	if proxy, ok := req.Context().Value(proxyKey{}).(proxySetting); ok && proxy.configured {
+		return proxy.url, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
@@ -0,0 +1,96 @@
+package probe
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// splitRampedSchedule removes the endpoints with a ramp from the schedule of an iteration and returns the number of
+// requests per iteration of each of them, which are sent by their own workers instead
+func splitRampedSchedule(endpoints []config.Endpoint, schedule []int) ([]int, map[int]int) {
+	shared := make([]int, 0, len(schedule))
+	ramped := make(map[int]int)
+	for _, i := range schedule {
+		if endpoints[i].Ramp != nil {
+			ramped[i]++
+			continue
+		}
+		shared = append(shared, i)
+	}
+	return shared, ramped
+}
+
+// rampWorkers returns the number of workers of the endpoints with a ramp
+func rampWorkers(endpoints []config.Endpoint) int {
+	workers := 0
+	for _, endpoint := range endpoints {
+		if endpoint.Ramp != nil {
+			workers += endpoint.Ramp.MaxWorkers()
+		}
+	}
+	return workers
+}
+
+// rampStart returns the time since the start of the run at which the worker joins a growing ramp
+func rampStart(ramp config.Ramp, worker int) time.Duration {
+	if worker < ramp.StartWorkers {
+		return 0
+	}
+	duration := int64(ramp.DurationMS) * int64(time.Millisecond)
+	steps := int64(ramp.EndWorkers - ramp.StartWorkers)
+	// rounded up, so the worker is part of the ramp once the wait is over
+	return time.Duration((duration*int64(worker+1-ramp.StartWorkers) + steps - 1) / steps)
+}
+
+// startRampWorkers starts the workers of the endpoints with a ramp, the requests per iteration of each endpoint are
+// given by ramped. A worker sends requests while it is part of the ramp, until the endpoint sent its share of
+// total_requests iterations. The ids of the workers follow the shared workers
+func startRampWorkers(ctx context.Context, wg *sync.WaitGroup, probing config.ProbingConfig, ramped map[int]int, send sendFunc, publish func(result), logger *slog.Logger) {
+	id := probing.ConcurrentRequests
+	began := time.Now()
+	for i, endpoint := range probing.Endpoints {
+		if endpoint.Ramp == nil {
+			continue
+		}
+		ramp := *endpoint.Ramp
+		remaining := &atomic.Int64{}
+		remaining.Store(int64(probing.TotalRequests * ramped[i]))
+		logger.Debug("Ramping endpoint workers", "url", endpoint.URL, "start_workers", ramp.StartWorkers, "end_workers", ramp.EndWorkers, "duration_ms", ramp.DurationMS)
+
+		for w := range ramp.MaxWorkers() {
+			worker := id + w
+			wg.Go(func() {
+				ctx := withRand(ctx, newWorkerRand(probing.Seed, worker))
+				for {
+					if w >= ramp.Workers(time.Since(began)) {
+						if w >= ramp.EndWorkers {
+							logger.Debug("Ramp worker stopped", "worker_id", worker, "url", endpoint.URL)
+							return
+						}
+						if !sleepContext(ctx, rampStart(ramp, w)-time.Since(began)) {
+							logger.Warn("Worker stopped due to cancellation", "worker_id", worker)
+							return
+						}
+						continue
+					}
+					if remaining.Add(-1) < 0 {
+						logger.Debug("Worker finished", "worker_id", worker)
+						return
+					}
+					r, ok := send(ctx, worker, i, endpoint)
+					if !ok {
+						logger.Warn("Worker stopped due to cancellation", "worker_id", worker)
+						return
+					}
+					publish(r)
+				}
+			})
+		}
+		id += ramp.MaxWorkers()
+	}
+}
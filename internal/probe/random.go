@@ -0,0 +1,61 @@
+package probe
+
+import (
+	"context"
+	"math/rand/v2"
+)
+
+// randKey is the context key for the random number generator of a worker or virtual user
+type randKey struct{}
+
+// runSeed returns the configured seed, or a random one when it is 0 so the run can still be reproduced from the
+// logged seed
+func runSeed(seed int64) int64 {
+	for seed == 0 {
+		seed = rand.Int64()
+	}
+	return seed
+}
+
+// newWorkerRand creates the random number generator of a worker or virtual user, derived from the run seed and its
+// id so every worker draws the same sequence in each run with the same seed
+func newWorkerRand(seed int64, id int) *rand.Rand {
+	return rand.New(rand.NewPCG(uint64(seed), uint64(id)))
+}
+
+// withRand stores the random number generator of a worker or virtual user in the context
+func withRand(ctx context.Context, rng *rand.Rand) context.Context {
+	return context.WithValue(ctx, randKey{}, rng)
+}
+
+// randFromContext returns the random number generator stored in the context, or nil when there is none
+func randFromContext(ctx context.Context) *rand.Rand {
+	rng, _ := ctx.Value(randKey{}).(*rand.Rand)
+	return rng
+}
+
+// randIntN returns a random number in [0, n) drawn from rng, or from the global source when rng is nil
+func randIntN(rng *rand.Rand, n int) int {
+	if rng == nil {
+		return rand.IntN(n)
+	}
+	return rng.IntN(n)
+}
+
+// randExpFloat64 returns an exponentially distributed number with mean 1 drawn from rng, or from the global source
+// when rng is nil
+func randExpFloat64(rng *rand.Rand) float64 {
+	if rng == nil {
+		return rand.ExpFloat64()
+	}
+	return rng.ExpFloat64()
+}
+
+// randNormFloat64 returns a standard normally distributed number drawn from rng, or from the global source when rng
+// is nil
+func randNormFloat64(rng *rand.Rand) float64 {
+	if rng == nil {
+		return rand.NormFloat64()
+	}
+	return rng.NormFloat64()
+}
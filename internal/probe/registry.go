@@ -0,0 +1,189 @@
+package probe
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// registryTimeout limits how long querying the registry for the instances of a service may take
+const registryTimeout = 10 * time.Second
+
+// consulEntry represents an instance in the response of the Consul health endpoint
+type consulEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+}
+
+// resolveServiceInstances replaces every endpoint with a service by one endpoint per healthy instance of it, sent to
+// the address of the instance. The instances are resolved once at the start of the run, so every instance is probed
+// and reported individually
+func resolveServiceInstances(ctx context.Context, registry config.RegistryConfig, endpoints []config.Endpoint, logger *slog.Logger) ([]config.Endpoint, error) {
+	if !slices.ContainsFunc(endpoints, func(e config.Endpoint) bool { return e.Service != "" }) {
+		return endpoints, nil
+	}
+
+	client := &http.Client{Timeout: registryTimeout}
+	instances := make(map[string][]string)
+	resolved := make([]config.Endpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint.Service == "" {
+			resolved = append(resolved, endpoint)
+			continue
+		}
+		addrs, ok := instances[endpoint.Service]
+		if !ok {
+			var err error
+			if addrs, err = consulInstances(ctx, client, registry.Consul, endpoint.Service); err != nil {
+				return nil, fmt.Errorf("failed to resolve service %s: %w", endpoint.Service, err)
+			}
+			if len(addrs) == 0 {
+				return nil, fmt.Errorf("service %s has no healthy instances", endpoint.Service)
+			}
+			instances[endpoint.Service] = addrs
+			logger.Info("Resolved service instances", "service", endpoint.Service, "instances", addrs)
+		}
+
+		for _, addr := range addrs {
+			// the URL is kept, so TLS verification, SNI and the Host header use the host of the service
+			instance := endpoint
+			instance.Instance = addr
+			resolved = append(resolved, instance)
+		}
+	}
+	return resolved, nil
+}
+
+// instanceKey is the context key for the address of the registry instance a request is sent to
+type instanceKey struct{}
+
+// withInstance stores the address of the registry instance a request is sent to in the context, an empty address
+// sends the request to the host of its URL
+func withInstance(ctx context.Context, addr string) context.Context {
+	if addr == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, instanceKey{}, addr)
+}
+
+// instanceClient returns a client connecting the requests of registry instances to their address, the client is
+// returned as is when none of the endpoints is an instance
+func instanceClient(client *http.Client, endpoints []config.Endpoint) *http.Client {
+	if !slices.ContainsFunc(endpoints, func(e config.Endpoint) bool { return e.Instance != "" }) {
+		return client
+	}
+	base, ok := client.Transport.(*http.Transport)
+	if !ok {
+		return client
+	}
+	withInstances := *client
+	withInstances.Transport = &instanceTransport{base: base, instances: make(map[string]*http.Transport)}
+	return &withInstances
+}
+
+// instanceTransport sends the requests of each registry instance over its own transport dialing the address of the
+// instance, so the pooled connections of the instances are not mixed. The requests of other endpoints are sent over
+// the base transport
+type instanceTransport struct {
+	base *http.Transport
+
+	mu        sync.Mutex
+	instances map[string]*http.Transport
+}
+
+// RoundTrip sends the request over the transport of its instance
+func (t *instanceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	addr, ok := req.Context().Value(instanceKey{}).(string)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	return t.transport(addr).RoundTrip(req)
+}
+
+// transport returns the transport of an instance, created on its first request. The instance is connected to
+// directly, a proxy would connect to the host of the URL instead
+func (t *instanceTransport) transport(addr string) *http.Transport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if transport, ok := t.instances[addr]; ok {
+		return transport
+	}
+	dial := t.base.DialContext
+	transport := t.base.Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return dial(ctx, network, addr)
+	}
+	t.instances[addr] = transport
+	return transport
+}
+
+// CloseIdleConnections closes the idle connections of the base transport and of the instances
+func (t *instanceTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, transport := range t.instances {
+		transport.CloseIdleConnections()
+	}
+}
+
+// consulInstances returns the addresses of the instances of a service passing their health checks, sorted so the
+// endpoints are reported in the same order every run
+func consulInstances(ctx context.Context, client *http.Client, consul config.ConsulConfig, service string) ([]string, error) {
+	query := url.Values{"passing": {"true"}}
+	if consul.Datacenter != "" {
+		query.Set("dc", consul.Datacenter)
+	}
+	if consul.Tag != "" {
+		query.Set("tag", consul.Tag)
+	}
+	address := strings.TrimSuffix(cmp.Or(consul.Address, config.DefaultConsulAddress), "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		address+"/v1/health/service/"+url.PathEscape(service)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if consul.Token != "" {
+		req.Header.Set("X-Consul-Token", consul.Token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul responded with %s", resp.Status)
+	}
+	var entries []consulEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("invalid consul response: %w", err)
+	}
+
+	addrs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		// the service address is optional, instances without one are reached on the address of their node
+		host := cmp.Or(entry.Service.Address, entry.Node.Address)
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(entry.Service.Port)))
+	}
+	slices.Sort(addrs)
+	return slices.Compact(addrs), nil
+}
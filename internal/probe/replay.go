@@ -0,0 +1,94 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dasvh/enchante/internal/accesslog"
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// replayRequest is a request of the replayed access log, sent at its offset from the start of the replay
+type replayRequest struct {
+	offset time.Duration
+	index  int
+}
+
+// loadReplay reads the access log of the replay model and returns an endpoint for every distinct request, sent to
+// the target of the replay, and the requests in the order they arrived with their offsets scaled by the speed
+func loadReplay(replay config.ReplayConfig, logger *slog.Logger) ([]config.Endpoint, []replayRequest, error) {
+	file, err := os.Open(replay.File)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	entries, err := accesslog.Parse(file, replay.LogFormat(), logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("no requests in %s", replay.File)
+	}
+
+	target := strings.TrimSuffix(replay.Target, "/")
+	indexes := make(map[string]int)
+	var endpoints []config.Endpoint
+	requests := make([]replayRequest, 0, len(entries))
+	first, scale := entries[0].Time, replay.Scale()
+	for _, entry := range entries {
+		key := entry.Method + " " + entry.Path
+		index, ok := indexes[key]
+		if !ok {
+			index = len(endpoints)
+			indexes[key] = index
+			endpoints = append(endpoints, config.Endpoint{URL: target + entry.Path, Method: entry.Method})
+		}
+		offset := time.Duration(float64(entry.Time.Sub(first)) * scale)
+		requests = append(requests, replayRequest{offset: offset, index: index})
+	}
+	logger.Info("Access log loaded", "file", replay.File, "requests", len(requests), "endpoints", len(endpoints),
+		"duration", requests[len(requests)-1].offset)
+	return endpoints, requests, nil
+}
+
+// replayEngine is the replay model, it sends the requests of an access log at their logged offsets. Like with the
+// open model, a request waits in the job queue until a worker is free and the wait is part of its response time
+type replayEngine struct {
+	probing  config.ProbingConfig
+	requests []replayRequest
+	control  *controller
+	logger   *slog.Logger
+}
+
+// start schedules the requests of the log, total_requests times, each pass starting when the previous one ended
+func (e replayEngine) start(ctx context.Context, wg *sync.WaitGroup, send sendFunc, publish func(result)) *atomic.Int64 {
+	probing := e.probing
+	jobs := make(chan job, probing.ConcurrentRequests)
+	startJobWorkers(ctx, wg, probing, jobs, send, publish, e.control, e.logger)
+
+	iterations := &atomic.Int64{}
+	go func() {
+		start := time.Now()
+		length := e.requests[len(e.requests)-1].offset
+		for pass := range probing.TotalRequests {
+			iterations.Add(1)
+			passStart := start.Add(time.Duration(pass) * length)
+			for _, r := range e.requests {
+				j := job{index: r.index, endpoint: probing.Endpoints[r.index], arrival: passStart.Add(r.offset)}
+				if !enqueueJob(ctx, jobs, j, e.logger) {
+					return
+				}
+			}
+		}
+		close(jobs)
+		e.logger.Debug("Job queue closed")
+	}()
+
+	return iterations
+}
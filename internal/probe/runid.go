@@ -0,0 +1,45 @@
+package probe
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"maps"
+	"strconv"
+	"sync/atomic"
+)
+
+// newRunID returns a random ID identifying the requests of a run in the logs of the target servers
+func newRunID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestTagger numbers the requests of a run and adds the run ID and the sequence number to their headers
+type requestTagger struct {
+	header string
+	runID  string
+	seq    atomic.Int64
+}
+
+// newRequestTagger creates the tagger of the requests of a run, nil when no run ID header is configured
+func newRequestTagger(header, runID string) *requestTagger {
+	if header == "" {
+		return nil
+	}
+	return &requestTagger{header: header, runID: runID}
+}
+
+// tag returns a copy of the headers with the run ID header of the next request, formatted as <run id>/<sequence>.
+// Sequence numbers start at 1 and are assigned when the request is dispatched
+func (t *requestTagger) tag(headers map[string]string) map[string]string {
+	if t == nil {
+		return headers
+	}
+	tagged := maps.Clone(headers)
+	if tagged == nil {
+		tagged = make(map[string]string, 1)
+	}
+	tagged[t.header] = t.runID + "/" + strconv.FormatInt(t.seq.Add(1), 10)
+	return tagged
+}
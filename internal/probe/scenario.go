@@ -0,0 +1,135 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// sendFunc sends the request to the target at index and returns its result, false when the run was cancelled
+type sendFunc func(ctx context.Context, worker, index int, endpoint config.Endpoint) (result, bool)
+
+// scenarioTargets returns the endpoints followed by the steps of all scenarios, together with the index of the
+// first step of each scenario in the targets
+func scenarioTargets(probing config.ProbingConfig) ([]config.Endpoint, []int) {
+	targets := append([]config.Endpoint(nil), probing.Endpoints...)
+	offsets := make([]int, len(probing.Scenarios))
+	for i, scenario := range probing.Scenarios {
+		offsets[i] = len(targets)
+		for _, step := range scenario.Steps {
+			targets = append(targets, step.Endpoint)
+		}
+	}
+	return targets, offsets
+}
+
+// labelScenarioStats sets the scenario and step names on the stats of the scenario steps
+func labelScenarioStats(stats []*endpointStat, scenarios []config.Scenario, offsets []int) {
+	for i, scenario := range scenarios {
+		for j, step := range scenario.Steps {
+			stats[offsets[i]+j].scenario = scenario.Name
+			stats[offsets[i]+j].step = step.Name
+		}
+	}
+}
+
+// scenarioRequests returns the number of requests of one iteration over all scenarios
+func scenarioRequests(scenarios []config.Scenario) int {
+	total := 0
+	for _, scenario := range scenarios {
+		total += len(scenario.Steps)
+	}
+	return total
+}
+
+// runScenario executes one iteration of a scenario, running its steps in order and passing the extracted variables
+// on to the following steps, which are substituted when the step is sent. A step is skipped when one of the steps it
+// depends on failed or was skipped. A failed or skipped step aborts the iteration, reporting the remaining steps as
+// skipped, unless it continues on failure. A virtual user keeps its variables and cookies across iterations and
+// waits for its think time after each step, without a virtual user every iteration starts fresh. It returns false
+// when the run was cancelled
+func runScenario(ctx context.Context, worker int, j job, vu *virtualUser, send sendFunc, publish func(result), logger *slog.Logger) bool {
+	vars := make(map[string]string)
+	if vu != nil {
+		vars = vu.vars
+		ctx = withCookieJar(ctx, vu.jar)
+	}
+	ctx = withVariables(ctx, vars)
+
+	// failed holds the steps of the iteration that failed or were skipped
+	failed := make(map[string]bool)
+	for i, step := range j.scenario.Steps {
+		index := j.index + i
+
+		if dependencyFailed(step, failed) {
+			publish(result{endpoint: index, worker: worker, err: ErrStepSkipped})
+			failed[step.Name] = true
+			if step.OnFailure != config.OnFailureContinue {
+				skipSteps(j, worker, i+1, publish)
+				return true
+			}
+			continue
+		}
+
+		stepCtx := ctx
+		capture := &responseCapture{}
+		if len(step.Extract) > 0 {
+			stepCtx = withResponseCapture(ctx, capture)
+		}
+
+		r, ok := send(stepCtx, worker, index, step.Endpoint)
+		if !ok {
+			return false
+		}
+		if r.err == nil {
+			r.err = extractVariables(step, capture, vars)
+			if r.err != nil {
+				logger.Error("Failed to extract variables", "scenario", j.scenario.Name, "step", step.Name, "error", r.err)
+			}
+		}
+		publish(r)
+
+		if r.err != nil {
+			failed[step.Name] = true
+			if step.OnFailure != config.OnFailureContinue {
+				skipSteps(j, worker, i+1, publish)
+				return true
+			}
+		}
+		if vu != nil && !vu.think(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+// dependencyFailed reports whether one of the steps the step depends on failed or was skipped
+func dependencyFailed(step config.Step, failed map[string]bool) bool {
+	for _, dependency := range step.DependsOn {
+		if failed[dependency] {
+			return true
+		}
+	}
+	return false
+}
+
+// skipSteps reports the steps of the iteration starting at from as skipped
+func skipSteps(j job, worker, from int, publish func(result)) {
+	for i := from; i < len(j.scenario.Steps); i++ {
+		publish(result{endpoint: j.index + i, worker: worker, err: ErrStepSkipped})
+	}
+}
+
+// extractVariables stores the values extracted from the captured response in vars
+func extractVariables(step config.Step, capture *responseCapture, vars map[string]string) error {
+	for _, extraction := range step.Extract {
+		value, err := extractValue(extraction, capture)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrExtraction, extraction.Name, err)
+		}
+		vars[extraction.Name] = value
+	}
+	return nil
+}
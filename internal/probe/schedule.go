@@ -0,0 +1,78 @@
+package probe
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// endpointWeight returns the relative share of requests of the endpoint
+func endpointWeight(endpoint config.Endpoint) int {
+	return max(endpoint.Weight, 1)
+}
+
+// weightedSchedule returns the order of the endpoint indexes for one iteration. The weights are reduced by their
+// greatest common divisor, so 80/20 results in 4 requests to the first and 1 to the second endpoint, and the
+// requests are interleaved using smooth weighted round-robin instead of sending them in batches per endpoint
+func weightedSchedule(endpoints []config.Endpoint) []int {
+	divisor := 0
+	for _, endpoint := range endpoints {
+		divisor = gcd(divisor, endpointWeight(endpoint))
+	}
+
+	weights := make([]int, len(endpoints))
+	total := 0
+	for i, endpoint := range endpoints {
+		weights[i] = endpointWeight(endpoint) / divisor
+		total += weights[i]
+	}
+
+	schedule := make([]int, 0, total)
+	current := make([]int, len(endpoints))
+	for range total {
+		selected := 0
+		for i := range current {
+			current[i] += weights[i]
+			if current[i] > current[selected] {
+				selected = i
+			}
+		}
+		current[selected] -= total
+		schedule = append(schedule, selected)
+	}
+	return schedule
+}
+
+// gcd returns the greatest common divisor of a and b
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// logTrafficDistribution logs the configured and actual share of the requests per endpoint when weights are used
+func logTrafficDistribution(stats []*endpointStat, logger *slog.Logger) {
+	totalWeight, totalRequests := 0, 0
+	weighted := false
+	for _, s := range stats {
+		totalWeight += endpointWeight(s.endpoint)
+		totalRequests += s.successes + s.failures
+		weighted = weighted || s.endpoint.Weight > 1
+	}
+	if !weighted || totalRequests == 0 {
+		return
+	}
+
+	for _, s := range stats {
+		requests := s.successes + s.failures
+		logger.Info("Traffic distribution",
+			"method", s.endpoint.Method,
+			"url", s.endpoint.URL,
+			"weight", endpointWeight(s.endpoint),
+			"configured_share", fmt.Sprintf("%.1f%%", float64(endpointWeight(s.endpoint))/float64(totalWeight)*100),
+			"actual_share", fmt.Sprintf("%.1f%%", float64(requests)/float64(totalRequests)*100),
+			"requests", requests)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package probe
+
+import "os"
+
+// pauseSignal and resumeSignal are not available on this platform, the run is only paused through the control API
+var (
+	pauseSignal  os.Signal
+	resumeSignal os.Signal
+)
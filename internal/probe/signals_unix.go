@@ -0,0 +1,14 @@
+//go:build unix
+
+package probe
+
+import (
+	"os"
+	"syscall"
+)
+
+// pauseSignal and resumeSignal pause and resume a running probe, e.g. kill -USR1 <pid>
+var (
+	pauseSignal  os.Signal = syscall.SIGUSR1
+	resumeSignal os.Signal = syscall.SIGUSR2
+)
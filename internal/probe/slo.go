@@ -0,0 +1,46 @@
+package probe
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// EvaluateSLO returns the compliance of the run with the service level objectives. Availability covers all requests,
+// latency the successful requests in the response time histograms of the endpoints
+func EvaluateSLO(slo config.SLOConfig, r *report.Report, latencies []*report.Histogram) []report.SLOResult {
+	var results []report.SLOResult
+	if slo.Availability > 0 {
+		results = append(results, report.NewSLOResult(report.SLOAvailability, slo.Availability, 0,
+			int64(r.TotalRequests), int64(r.SuccessfulRequests)))
+	}
+	if slo.Latency.Target > 0 {
+		threshold := time.Duration(slo.Latency.ThresholdMS) * time.Millisecond
+		var total, within int64
+		for _, h := range latencies {
+			if h == nil {
+				continue
+			}
+			total += h.Count()
+			within += h.CountWithin(threshold)
+		}
+		results = append(results, report.NewSLOResult(report.SLOLatency, slo.Latency.Target, slo.Latency.ThresholdMS,
+			total, within))
+	}
+	return results
+}
+
+// logSLOReport logs the compliance of the run with the service level objectives
+func logSLOReport(results []report.SLOResult, logger *slog.Logger) {
+	for _, r := range results {
+		args := []any{"objective", r.Name(), "target", r.Target, "compliance", r.Compliance,
+			"burn_rate", r.BurnRate, "budget_remaining", r.BudgetRemaining}
+		if r.Met {
+			logger.Info("SLO met", args...)
+		} else {
+			logger.Warn("SLO missed", args...)
+		}
+	}
+}
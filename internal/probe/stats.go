@@ -0,0 +1,318 @@
+package probe
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// defaultOwner is used in the report for endpoints without an owner annotation
+const defaultOwner = "unassigned"
+
+// endpointStat holds the aggregated results for a single endpoint
+type endpointStat struct {
+	endpoint    config.Endpoint
+	successes   int
+	failures    int
+	latency     report.Histogram
+	slaBreaches int
+	// compression of the responses, the byte counts only include compressed responses that could be decoded
+	encodings        map[string]int
+	compressedWire   int64
+	compressedBodies int64
+	// dialFailures counts the failed connection attempts per address family
+	dialFailures map[string]int
+	// scenario and step are set for the steps of a scenario
+	scenario string
+	step     string
+	skipped  int
+	// shed counts the bulk requests not sent under saturation
+	shed int
+	// phases breaks the response times of the successful requests down into the phases of the request
+	phases phaseStats
+	// errors counts the failed requests per category of the error taxonomy
+	errors map[string]int
+	// the body bytes of the successful requests, responses as served on the wire
+	requestBytes  int64
+	responseBytes int64
+	// latencyPerKB records the response times divided by the response body size, when enabled for the endpoint
+	latencyPerKB report.Histogram
+	// breakdownHeaders are the response headers whose values the response times are broken down by
+	breakdownHeaders []string
+	breakdown        headerBreakdown
+}
+
+// newEndpointStats creates an empty stat entry for each endpoint
+func newEndpointStats(endpoints []config.Endpoint) []*endpointStat {
+	stats := make([]*endpointStat, len(endpoints))
+	for i, endpoint := range endpoints {
+		stats[i] = &endpointStat{endpoint: endpoint}
+	}
+	return stats
+}
+
+// record adds a successful request to the stats and checks it against the endpoint SLA, the response time itself is
+// recorded by the latencyRecorder
+func (s *endpointStat) record(sample sample) {
+	s.recordDialFailures(sample.dialFailures)
+	duration := sample.duration
+	if sample.encoding != "" {
+		if s.encodings == nil {
+			s.encodings = make(map[string]int)
+		}
+		s.encodings[sample.encoding]++
+		if sample.decodedBytes >= 0 {
+			s.compressedWire += sample.wireBytes
+			s.compressedBodies += sample.decodedBytes
+		}
+	}
+
+	s.phases.record(sample.phases)
+	s.requestBytes += sample.sentBytes
+	s.responseBytes += sample.wireBytes
+	if s.endpoint.LatencyPerKB {
+		s.recordLatencyPerKB(sample)
+	}
+	if len(s.breakdownHeaders) > 0 {
+		s.breakdown.record(s.breakdownHeaders, sample)
+	}
+
+	s.successes++
+	if s.endpoint.SLAMS > 0 && duration > time.Duration(s.endpoint.SLAMS)*time.Millisecond {
+		s.slaBreaches++
+	}
+}
+
+// recordLatencyPerKB records the response time per kilobyte of the decoded response body, or of the body on the wire
+// when its encoding could not be decoded. Responses without a body are not recorded
+func (s *endpointStat) recordLatencyPerKB(sample sample) {
+	size := sample.decodedBytes
+	if size < 0 {
+		size = sample.wireBytes
+	}
+	if size <= 0 {
+		return
+	}
+	s.latencyPerKB.Record(time.Duration(float64(sample.duration) * 1024 / float64(size)))
+}
+
+// recordFailure adds a failed request to the stats and classifies its error
+func (s *endpointStat) recordFailure(sample sample, err error) {
+	s.failures++
+	if s.errors == nil {
+		s.errors = make(map[string]int)
+	}
+	s.errors[classifyError(err)]++
+	s.recordDialFailures(sample.dialFailures)
+}
+
+// recordDialFailures counts the failed connection attempts of a request per address family
+func (s *endpointStat) recordDialFailures(attempts []dialAttempt) {
+	if len(attempts) == 0 {
+		return
+	}
+	if s.dialFailures == nil {
+		s.dialFailures = make(map[string]int)
+	}
+	for _, attempt := range attempts {
+		s.dialFailures[attempt.network]++
+	}
+}
+
+// avgResponseTime returns the average response time of the successful requests
+func (s *endpointStat) avgResponseTime() time.Duration {
+	return s.latency.Mean()
+}
+
+// transfer returns the body sizes of the successful requests, with the response throughput over the run duration
+func (s *endpointStat) transfer(duration time.Duration) report.Transfer {
+	t := report.Transfer{
+		RequestBytes:  s.requestBytes,
+		ResponseBytes: s.responseBytes,
+		ResponseMBps:  mbps(s.responseBytes, duration),
+	}
+	if s.successes > 0 {
+		t.AvgResponseBytes = float64(s.responseBytes) / float64(s.successes)
+	}
+	if s.endpoint.LatencyPerKB {
+		perKB := s.latencyPerKB.Latency()
+		t.LatencyPerKB = &perKB
+	}
+	return t
+}
+
+// logTransferReport logs the body sizes and the response throughput of each endpoint
+func logTransferReport(stats []*endpointStat, duration time.Duration, logger *slog.Logger) {
+	for _, s := range stats {
+		if s.successes == 0 {
+			continue
+		}
+		t := s.transfer(duration)
+		args := []any{
+			"method", s.endpoint.Method,
+			"url", s.endpoint.URL,
+			"request_bytes", t.RequestBytes,
+			"response_bytes", t.ResponseBytes,
+			"avg_response_bytes", fmt.Sprintf("%.0f", t.AvgResponseBytes),
+			"response_mbps", fmt.Sprintf("%.2f", t.ResponseMBps),
+		}
+		if t.LatencyPerKB != nil {
+			args = append(args,
+				"avg_latency_per_kb", s.latencyPerKB.Mean(),
+				"p95_latency_per_kb", s.latencyPerKB.Percentile(95))
+		}
+		logger.Info("Transfer report", args...)
+	}
+}
+
+// compression returns the compression summary of the responses
+func (s *endpointStat) compression() report.Compression {
+	c := report.Compression{Encodings: s.encodings}
+	for _, count := range s.encodings {
+		c.CompressedResponses += count
+	}
+	if s.compressedWire > 0 {
+		c.Ratio = float64(s.compressedBodies) / float64(s.compressedWire)
+	}
+	return c
+}
+
+// groupByOwner groups the endpoint stats by the owner annotation of their endpoint
+func groupByOwner(stats []*endpointStat) map[string][]*endpointStat {
+	owners := make(map[string][]*endpointStat)
+	for _, s := range stats {
+		owner := s.endpoint.Owner
+		if owner == "" {
+			owner = defaultOwner
+		}
+		owners[owner] = append(owners[owner], s)
+	}
+	return owners
+}
+
+// logOwnerReport logs a report section per endpoint owner, so results can be routed to the owning team
+func logOwnerReport(stats []*endpointStat, logger *slog.Logger) {
+	owners := groupByOwner(stats)
+	if _, ok := owners[defaultOwner]; ok && len(owners) == 1 {
+		// no endpoint is annotated with an owner
+		return
+	}
+
+	for _, owner := range slices.Sorted(maps.Keys(owners)) {
+		var successes, failures, slaBreaches int
+		var latency report.Histogram
+		for _, s := range owners[owner] {
+			successes += s.successes
+			failures += s.failures
+			slaBreaches += s.slaBreaches
+			latency.Merge(&s.latency)
+		}
+
+		logger.Info("Owner report",
+			"owner", owner,
+			"endpoints", len(owners[owner]),
+			"successful_requests", successes,
+			"failed_requests", failures,
+			"avg_response_time", latency.Mean(),
+			"sla_breaches", slaBreaches)
+
+		for _, s := range owners[owner] {
+			logger.Info("Endpoint report",
+				"owner", owner,
+				"method", s.endpoint.Method,
+				"url", s.endpoint.URL,
+				"successful_requests", s.successes,
+				"failed_requests", s.failures,
+				"avg_response_time", s.avgResponseTime(),
+				"sla_ms", s.endpoint.SLAMS,
+				"sla_breaches", s.slaBreaches)
+		}
+	}
+}
+
+// buildReport creates the run report from the endpoint stats
+func buildReport(stats []*endpointStat, startedAt time.Time, duration time.Duration) *report.Report {
+	r := &report.Report{
+		StartedAt:  startedAt,
+		DurationMS: float64(duration) / float64(time.Millisecond),
+		Endpoints:  make([]report.EndpointReport, 0, len(stats)),
+	}
+
+	var latency report.Histogram
+	for _, s := range stats {
+		latency.Merge(&s.latency)
+		r.SuccessfulRequests += s.successes
+		r.FailedRequests += s.failures
+		r.Endpoints = append(r.Endpoints, report.EndpointReport{
+			Method:             s.endpoint.Method,
+			URL:                s.endpoint.URL,
+			Owner:              s.endpoint.Owner,
+			SuccessfulRequests: s.successes,
+			FailedRequests:     s.failures,
+			SLABreaches:        s.slaBreaches,
+			Latency:            s.latency.Latency(),
+			Compression:        s.compression(),
+			DialFailures:       s.dialFailures,
+			Scenario:           s.scenario,
+			Step:               s.step,
+			SkippedRequests:    s.skipped,
+			ShedRequests:       s.shed,
+			Phases:             s.phases.report(),
+			Errors:             s.errors,
+			Transfer:           s.transfer(duration),
+			Service:            s.endpoint.Service,
+			Instance:           s.endpoint.Instance,
+			HeaderBreakdown:    s.breakdown.report(),
+		})
+	}
+	r.TotalRequests = r.SuccessfulRequests + r.FailedRequests
+	r.Latency = latency.Latency()
+	if counts := errorCounts(stats); len(counts) > 0 {
+		r.Errors = counts
+	}
+
+	return r
+}
+
+// logCompressionReport logs whether the responses of each endpoint were served compressed
+func logCompressionReport(stats []*endpointStat, logger *slog.Logger) {
+	for _, s := range stats {
+		if s.successes == 0 {
+			continue
+		}
+		c := s.compression()
+		if c.CompressedResponses == 0 {
+			logger.Info("Compression report", "method", s.endpoint.Method, "url", s.endpoint.URL, "compressed", false)
+			continue
+		}
+		logger.Info("Compression report",
+			"method", s.endpoint.Method,
+			"url", s.endpoint.URL,
+			"compressed", true,
+			"compressed_responses", c.CompressedResponses,
+			"successful_requests", s.successes,
+			"encodings", c.Encodings,
+			"compression_ratio", fmt.Sprintf("%.2f", c.Ratio))
+	}
+}
+
+// logDialReport warns about endpoints with failed connection attempts, e.g. due to dual-stack misconfigurations
+func logDialReport(stats []*endpointStat, logger *slog.Logger) {
+	for _, s := range stats {
+		if len(s.dialFailures) == 0 {
+			continue
+		}
+		logger.Warn("Connection attempts failed",
+			"method", s.endpoint.Method,
+			"url", s.endpoint.URL,
+			"tcp4_failures", s.dialFailures["tcp4"],
+			"tcp6_failures", s.dialFailures["tcp6"],
+			"successful_requests", s.successes,
+			"failed_requests", s.failures)
+	}
+}
@@ -0,0 +1,300 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/probe/streampb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// streamBuffer is the number of records buffered per subscriber, records are dropped for subscribers that fall
+// further behind so a slow consumer never slows down the run
+const streamBuffer = 1024
+
+// streamShutdownTimeout limits how long the stream server waits for subscribers to disconnect after the run
+const streamShutdownTimeout = 5 * time.Second
+
+// resultStream fans the results of a run out to its subscribers, it is safe for concurrent use
+type resultStream struct {
+	mu          sync.Mutex
+	subscribers map[chan resultRecord]struct{}
+	closed      bool
+	dropped     atomic.Int64
+}
+
+// newResultStream creates a stream without subscribers
+func newResultStream() *resultStream {
+	return &resultStream{subscribers: make(map[chan resultRecord]struct{})}
+}
+
+// subscribe returns a channel receiving the records from now on, it is closed when the stream closes. The returned
+// function cancels the subscription
+func (s *resultStream) subscribe() (<-chan resultRecord, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan resultRecord, streamBuffer)
+	if s.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	s.subscribers[ch] = struct{}{}
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// send passes the record on to all subscribers without blocking
+func (s *resultStream) send(record resultRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- record:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// close ends the subscriptions, subscribers receive the buffered records before their channel is closed
+func (s *resultStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for ch := range s.subscribers {
+		delete(s.subscribers, ch)
+		close(ch)
+	}
+}
+
+// serveHTTP streams the records to the client as newline-delimited JSON until the stream or the request ends
+func (s *resultStream) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	records, cancel := s.subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case record, ok := <-records:
+			if !ok {
+				return
+			}
+			if err := encoder.Encode(record); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// StreamServer serves the live result stream as newline-delimited JSON over HTTP and as a gRPC service. A run started
+// with a context carrying the server through WithStreamServer publishes its results to it, so the subscriptions can
+// outlive the runs, e.g. those of the daemon. It is safe for concurrent use
+type StreamServer struct {
+	stream *resultStream
+	http   *http.Server
+	grpc   *grpc.Server
+	logger *slog.Logger
+	// grpcAddr is the address the gRPC service listens on, empty when it is not served
+	grpcAddr string
+}
+
+// streamServerKey is the context key of the stream server runs publish to
+type streamServerKey struct{}
+
+// WithStreamServer returns a context the runs started with publish their results to the stream server
+func WithStreamServer(ctx context.Context, server *StreamServer) context.Context {
+	return context.WithValue(ctx, streamServerKey{}, server)
+}
+
+// streamServerFromContext returns the stream server of the context, nil when there is none
+func streamServerFromContext(ctx context.Context) *StreamServer {
+	server, _ := ctx.Value(streamServerKey{}).(*StreamServer)
+	return server
+}
+
+// NewStreamServer serves the result stream on the configured addresses until it is closed, over HTTP on listen and
+// over gRPC on grpc_listen
+func NewStreamServer(cfg config.StreamConfig, logger *slog.Logger) (*StreamServer, error) {
+	var httpListener, grpcListener net.Listener
+	var err error
+	if cfg.Listen != "" {
+		if httpListener, err = net.Listen("tcp", cfg.Listen); err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", cfg.Listen, err)
+		}
+	}
+	if cfg.GRPCListen != "" {
+		if grpcListener, err = net.Listen("tcp", cfg.GRPCListen); err != nil {
+			if httpListener != nil {
+				httpListener.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %s: %w", cfg.GRPCListen, err)
+		}
+	}
+
+	s := &StreamServer{stream: newResultStream(), logger: logger}
+	if httpListener != nil {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /results", s.stream.serveHTTP)
+		s.http = &http.Server{Handler: mux}
+		go func() {
+			if err := s.http.Serve(httpListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Warn("Result stream stopped", "error", err)
+			}
+		}()
+		logger.Info("Streaming results", "url", "http://"+httpListener.Addr().String()+"/results")
+	}
+	if grpcListener != nil {
+		s.grpc = grpc.NewServer()
+		s.grpcAddr = grpcListener.Addr().String()
+		streampb.RegisterResultStreamServer(s.grpc, grpcResultStream{stream: s.stream})
+		// reflection lets clients like grpcurl subscribe without the proto file
+		reflection.Register(s.grpc)
+		go func() {
+			if err := s.grpc.Serve(grpcListener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+				logger.Warn("Result stream stopped", "error", err)
+			}
+		}()
+		logger.Info("Streaming results over gRPC", "address", s.grpcAddr,
+			"method", streampb.ResultStream_Subscribe_FullMethodName)
+	}
+	return s, nil
+}
+
+// Close ends the subscriptions, once the subscribers received the buffered records, and shuts the servers down
+func (s *StreamServer) Close() {
+	s.stream.close()
+	ctx, cancel := context.WithTimeout(context.Background(), streamShutdownTimeout)
+	defer cancel()
+	if s.http != nil {
+		if err := s.http.Shutdown(ctx); err != nil {
+			s.logger.Warn("Failed to shut down result stream", "error", err)
+		}
+	}
+	if s.grpc != nil {
+		stopped := make(chan struct{})
+		go func() {
+			s.grpc.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.logger.Warn("Failed to shut down result stream", "error", ctx.Err())
+			s.grpc.Stop()
+		}
+	}
+	if dropped := s.stream.dropped.Load(); dropped > 0 {
+		s.logger.Warn("Result stream dropped records for slow subscribers", "dropped", dropped)
+	}
+}
+
+// grpcResultStream serves the records of the stream to the subscribers of the gRPC service
+type grpcResultStream struct {
+	streampb.UnimplementedResultStreamServer
+	stream *resultStream
+}
+
+// Subscribe sends the records to the subscriber until the stream or the subscription ends
+func (g grpcResultStream) Subscribe(req *streampb.SubscribeRequest, subscriber grpc.ServerStreamingServer[streampb.Result]) error {
+	records, cancel := g.stream.subscribe()
+	defer cancel()
+	for {
+		select {
+		case <-subscriber.Context().Done():
+			return nil
+		case record, ok := <-records:
+			if !ok {
+				return nil
+			}
+			if req.GetFailuresOnly() && (record.Success || record.Skipped) {
+				continue
+			}
+			if err := subscriber.Send(record.proto()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// proto returns the record as a message of the gRPC service
+func (r resultRecord) proto() *streampb.Result {
+	return &streampb.Result{
+		Time:          timestamppb.New(r.Time),
+		RunId:         r.RunID,
+		Method:        r.Method,
+		Url:           r.URL,
+		Scenario:      r.Scenario,
+		Step:          r.Step,
+		Worker:        int32(r.Worker),
+		DurationMs:    r.DurationMS,
+		Success:       r.Success,
+		Skipped:       r.Skipped,
+		Shed:          r.Shed,
+		Error:         r.Error,
+		ErrorCategory: r.ErrorCategory,
+		BytesSent:     r.BytesSent,
+		BytesReceived: r.BytesReceived,
+		Status:        int32(r.Status),
+	}
+}
+
+// runStream publishes the records of a run to the result stream, labelled with the run ID
+type runStream struct {
+	stream *resultStream
+	runID  string
+}
+
+// send passes the record of the run on to the subscribers
+func (r *runStream) send(record resultRecord) {
+	record.RunID = r.runID
+	r.stream.send(record)
+}
+
+// startResultStream publishes the results of the run to the stream server of the context, or else serves the result
+// stream on the configured addresses for the duration of the run. The returned stop function ends the subscriptions
+// and shuts the server down when it was started for the run
+func startResultStream(ctx context.Context, cfg config.StreamConfig, runID string, logger *slog.Logger) (*runStream, func()) {
+	if server := streamServerFromContext(ctx); server != nil {
+		return &runStream{stream: server.stream, runID: runID}, func() {}
+	}
+	if cfg.Listen == "" && cfg.GRPCListen == "" {
+		return nil, func() {}
+	}
+
+	server, err := NewStreamServer(cfg, logger)
+	if err != nil {
+		logger.Error("Failed to start result stream, continuing without it", "error", err)
+		return nil, func() {}
+	}
+	return &runStream{stream: server.stream, runID: runID}, server.Close
+}
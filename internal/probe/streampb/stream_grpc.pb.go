@@ -0,0 +1,134 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: stream.proto
+
+// The live result stream of enchante, external systems subscribe to it for the results of the runs in progress.
+
+package streampb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ResultStream_Subscribe_FullMethodName = "/enchante.stream.v1.ResultStream/Subscribe"
+)
+
+// ResultStreamClient is the client API for ResultStream service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ResultStream streams the result of every completed request.
+type ResultStreamClient interface {
+	// Subscribe streams the results from now on. The stream ends when the run finishes, or for a daemon when it stops,
+	// a subscriber falling more than 1024 results behind misses results rather than slowing down the run.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Result], error)
+}
+
+type resultStreamClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewResultStreamClient(cc grpc.ClientConnInterface) ResultStreamClient {
+	return &resultStreamClient{cc}
+}
+
+func (c *resultStreamClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Result], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ResultStream_ServiceDesc.Streams[0], ResultStream_Subscribe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeRequest, Result]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ResultStream_SubscribeClient = grpc.ServerStreamingClient[Result]
+
+// ResultStreamServer is the server API for ResultStream service.
+// All implementations must embed UnimplementedResultStreamServer
+// for forward compatibility.
+//
+// ResultStream streams the result of every completed request.
+type ResultStreamServer interface {
+	// Subscribe streams the results from now on. The stream ends when the run finishes, or for a daemon when it stops,
+	// a subscriber falling more than 1024 results behind misses results rather than slowing down the run.
+	Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[Result]) error
+	mustEmbedUnimplementedResultStreamServer()
+}
+
+// UnimplementedResultStreamServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedResultStreamServer struct{}
+
+func (UnimplementedResultStreamServer) Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[Result]) error {
+	return status.Error(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedResultStreamServer) mustEmbedUnimplementedResultStreamServer() {}
+func (UnimplementedResultStreamServer) testEmbeddedByValue()                      {}
+
+// UnsafeResultStreamServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ResultStreamServer will
+// result in compilation errors.
+type UnsafeResultStreamServer interface {
+	mustEmbedUnimplementedResultStreamServer()
+}
+
+func RegisterResultStreamServer(s grpc.ServiceRegistrar, srv ResultStreamServer) {
+	// If the following call panics, it indicates UnimplementedResultStreamServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ResultStream_ServiceDesc, srv)
+}
+
+func _ResultStream_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ResultStreamServer).Subscribe(m, &grpc.GenericServerStream[SubscribeRequest, Result]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ResultStream_SubscribeServer = grpc.ServerStreamingServer[Result]
+
+// ResultStream_ServiceDesc is the grpc.ServiceDesc for ResultStream service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ResultStream_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "enchante.stream.v1.ResultStream",
+	HandlerType: (*ResultStreamServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _ResultStream_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "stream.proto",
+}
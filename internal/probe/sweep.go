@@ -0,0 +1,132 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// SweepOptions configures a sweep
+type SweepOptions struct {
+	// Origin is sent with the OPTIONS requests to make them CORS preflight requests, without it they are plain
+	// OPTIONS requests carrying the headers and the authentication of the endpoint
+	Origin string
+}
+
+// Sweep sends a HEAD and an OPTIONS request to every endpoint and scenario step, instead of load, to check their
+// routing, allowed methods and CORS headers. Targets with variables in their URL are skipped, since their values are
+// only known during a run
+func Sweep(ctx context.Context, cfg *config.Config, opts SweepOptions, logger *slog.Logger) ([]report.SweepResult, error) {
+	endpoints, err := resolveServiceInstances(ctx, cfg.ProbingConfig.Registry, cfg.ProbingConfig.Endpoints, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve service instances: %w", err)
+	}
+	probing := cfg.ProbingConfig
+	probing.Endpoints = endpoints
+	targets, _ := scenarioTargets(probing)
+	targets = slices.DeleteFunc(targets, func(e config.Endpoint) bool { return strings.Contains(e.URL, "{{") })
+
+	client, err := newHTTPClient(probing.Network, nil, &trafficCounter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+	client = instanceClient(client, targets)
+	proxies, err := resolveProxies(probing.Proxy, targets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve proxies: %w", err)
+	}
+
+	results := make([]report.SweepResult, 0, len(targets))
+	for i, endpoint := range targets {
+		headers, err := getHeadersForEndpoint(endpoint, &cfg.Auth, logger)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %s: %w", endpoint.URL, err)
+		}
+		timeout := endpointTimeout(endpoint, probing.RequestTimeoutMS)
+		ctx := withInstance(withProxy(ctx, proxies[i]), endpoint.Instance)
+		target := endpoint.RequestURL()
+
+		result := report.SweepResult{Method: endpoint.Method, URL: endpoint.URL, Instance: endpoint.Instance}
+		resp, err := sweepRequest(ctx, client, http.MethodHead, target, headers, timeout)
+		if err != nil {
+			result.HeadError = err.Error()
+		} else {
+			result.HeadStatus = resp.StatusCode
+		}
+
+		if opts.Origin != "" {
+			headers = preflightHeaders(opts.Origin, endpoint.Method, slices.Collect(maps.Keys(endpoint.Headers)))
+		}
+		resp, err = sweepRequest(ctx, client, http.MethodOptions, target, headers, timeout)
+		if err != nil {
+			result.OptionsError = err.Error()
+		} else {
+			result.OptionsStatus = resp.StatusCode
+			result.Allow = headerList(resp.Header.Get("Allow"))
+			result.AllowOrigin = resp.Header.Get("Access-Control-Allow-Origin")
+			result.AllowMethods = headerList(resp.Header.Get("Access-Control-Allow-Methods"))
+			result.AllowHeaders = headerList(resp.Header.Get("Access-Control-Allow-Headers"))
+		}
+		logger.Debug("Endpoint swept", "method", endpoint.Method, "url", endpoint.URL, "head_status", result.HeadStatus, "options_status", result.OptionsStatus)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// preflightHeaders returns the headers of a CORS preflight request, which announces the method and the header names
+// of the actual request. Like a browser, the preflight carries no credentials
+func preflightHeaders(origin, method string, names []string) map[string]string {
+	headers := map[string]string{
+		"Origin":                        origin,
+		"Access-Control-Request-Method": method,
+		"User-Agent":                    userAgent,
+	}
+	if len(names) > 0 {
+		names = slices.Clone(names)
+		for i, name := range names {
+			names[i] = strings.ToLower(name)
+		}
+		slices.Sort(names)
+		headers["Access-Control-Request-Headers"] = strings.Join(names, ",")
+	}
+	return headers
+}
+
+// sweepRequest sends a request without a body and discards the response body
+func sweepRequest(ctx context.Context, client *http.Client, method, target string, headers map[string]string, timeout time.Duration) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// headerList splits a comma separated header value into its trimmed elements
+func headerList(value string) []string {
+	var values []string
+	for v := range strings.SplitSeq(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
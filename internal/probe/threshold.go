@@ -0,0 +1,89 @@
+package probe
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/report"
+)
+
+// metricValue returns the value of a threshold metric for the given request counts and latency
+func metricValue(metric string, total, failed int, latency report.Latency) float64 {
+	switch metric {
+	case "error_rate":
+		if total == 0 {
+			return 0
+		}
+		return float64(failed) / float64(total)
+	case "failed_requests":
+		return float64(failed)
+	case "avg_ms":
+		return latency.AvgMS
+	case "p50_ms":
+		return latency.P50MS
+	case "p90_ms":
+		return latency.P90MS
+	case "p95_ms":
+		return latency.P95MS
+	case "p99_ms":
+		return latency.P99MS
+	case "max_ms":
+		return latency.MaxMS
+	default:
+		return 0
+	}
+}
+
+// EvaluateThresholds checks the thresholds against the run report. A threshold of an endpoint is checked against
+// every endpoint with its URL
+func EvaluateThresholds(thresholds []config.Threshold, r *report.Report) []report.ThresholdResult {
+	var results []report.ThresholdResult
+	for _, t := range thresholds {
+		result := report.ThresholdResult{Metric: t.Metric, Max: t.Max, Severity: t.Level()}
+		if t.Endpoint == "" {
+			result.Value = metricValue(t.Metric, r.TotalRequests, r.FailedRequests, r.Latency)
+			result.Breached = result.Value > t.Max
+			results = append(results, result)
+			continue
+		}
+		for _, e := range r.Endpoints {
+			if e.URL != t.Endpoint {
+				continue
+			}
+			result.Method, result.URL = e.Method, e.URL
+			result.Value = metricValue(t.Metric, e.SuccessfulRequests+e.FailedRequests, e.FailedRequests, e.Latency)
+			result.Breached = result.Value > t.Max
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// thresholdFailed reports whether a threshold of severity fail was breached
+func thresholdFailed(results []report.ThresholdResult) bool {
+	for _, r := range results {
+		if r.Breached && r.Severity == config.SeverityFail {
+			return true
+		}
+	}
+	return false
+}
+
+// logThresholdReport logs the breached thresholds, those of severity fail as errors
+func logThresholdReport(results []report.ThresholdResult, logger *slog.Logger) {
+	for _, r := range results {
+		if !r.Breached {
+			continue
+		}
+		level := slog.LevelWarn
+		if r.Severity == config.SeverityFail {
+			level = slog.LevelError
+		}
+		args := []any{"metric", r.Metric, "value", r.Value, "max", r.Max, "severity", r.Severity}
+		if r.URL != "" {
+			args = append(args, "method", r.Method, "url", r.URL)
+		}
+		logger.Log(context.Background(), level, "Threshold breached", args...)
+	}
+}
@@ -0,0 +1,114 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+const (
+	dialTimeout   = 5 * time.Second
+	dialKeepAlive = 30 * time.Second
+	// maxPortAttempts limits how many ports of the local port range are tried for a single connection
+	maxPortAttempts = 64
+	// maxIdleConnsPerHost keeps a pooled connection per worker when connections are reused
+	maxIdleConnsPerHost = 1024
+)
+
+// dialFunc is the signature of the transport DialContext function
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newHTTPClient creates the client shared by all requests of a run, connecting to the pinned addresses of the hosts
+// and counting its traffic in the given counter
+func newHTTPClient(network config.NetworkConfig, pins hostPins, traffic *trafficCounter) (*http.Client, error) {
+	dial, err := newDialer(network)
+	if err != nil {
+		return nil, err
+	}
+	if len(pins) > 0 {
+		dial = pinnedDialer(dial, pins)
+	}
+	var limiter *bandwidthLimiter
+	if network.BandwidthLimitKbps > 0 {
+		limiter = newBandwidthLimiter(network.BandwidthLimitKbps)
+	}
+	dial = meteredDialer(dial, traffic, limiter)
+
+	transport := &http.Transport{
+		DialContext:           dial,
+		Proxy:                 proxyFromContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		// responses are decoded by readBody, so compression can be measured
+		DisableCompression: true,
+		// by default every request opens its own connection, so connection setup is part of the response time
+		DisableKeepAlives: !network.ReuseConnections,
+	}
+	if network.ReuseConnections {
+		transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+		transport.TLSClientConfig = &tls.Config{ClientSessionCache: tls.NewLRUClientSessionCache(0)}
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// newDialer creates the dial function binding outbound connections to the configured source IP and port range
+func newDialer(network config.NetworkConfig) (dialFunc, error) {
+	ip, err := network.LocalIP()
+	if err != nil {
+		return nil, err
+	}
+	minPort, maxPort, err := network.PortRange()
+	if err != nil {
+		return nil, err
+	}
+
+	if minPort == 0 {
+		dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: dialKeepAlive}
+		if ip != nil {
+			dialer.LocalAddr = &net.TCPAddr{IP: ip}
+		}
+		return dialer.DialContext, nil
+	}
+
+	d := &portRangeDialer{ip: ip, minPort: minPort, maxPort: maxPort}
+	return d.DialContext, nil
+}
+
+// portRangeDialer binds each connection to the next free port of the local port range
+type portRangeDialer struct {
+	ip      net.IP
+	minPort int
+	maxPort int
+	next    atomic.Uint32
+}
+
+// DialContext connects to addr from the next port in the range, skipping ports that are in use
+func (d *portRangeDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	size := d.maxPort - d.minPort + 1
+	var lastErr error
+	for range min(size, maxPortAttempts) {
+		port := d.minPort + int(d.next.Add(1)-1)%size
+		dialer := &net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: dialKeepAlive,
+			LocalAddr: &net.TCPAddr{IP: d.ip, Port: port},
+		}
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err == nil {
+			return conn, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("no free local port in range %d-%d: %w", d.minPort, d.maxPort, lastErr)
+}
@@ -0,0 +1,160 @@
+package probe
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// jarKey is the context key for the cookie jar of a virtual user
+type jarKey struct{}
+
+// virtualUser holds the state a virtual user keeps across its iterations
+type virtualUser struct {
+	id        int
+	vars      map[string]string
+	jar       http.CookieJar
+	thinkTime config.Delay
+}
+
+// newVirtualUser creates a virtual user with an empty cookie jar and no variables
+func newVirtualUser(id int, thinkTime config.Delay) *virtualUser {
+	// cookiejar.New only fails for invalid options
+	jar, _ := cookiejar.New(nil)
+	return &virtualUser{id: id, vars: make(map[string]string), jar: jar, thinkTime: thinkTime}
+}
+
+// think waits for the think time of the virtual user, it returns false when the context is cancelled first
+func (vu *virtualUser) think(ctx context.Context) bool {
+	return sleepContext(ctx, delayDuration(vu.thinkTime, randFromContext(ctx)))
+}
+
+// withCookieJar stores the cookie jar of a virtual user in the context
+func withCookieJar(ctx context.Context, jar http.CookieJar) context.Context {
+	return context.WithValue(ctx, jarKey{}, jar)
+}
+
+// clientWithJar returns the client using the cookie jar stored in the context, the shared client when there is none
+func clientWithJar(ctx context.Context, client *http.Client) *http.Client {
+	jar, ok := ctx.Value(jarKey{}).(http.CookieJar)
+	if !ok {
+		return client
+	}
+	withJar := *client
+	withJar.Jar = jar
+	return &withJar
+}
+
+// vuScenarios returns the scenario jobs the virtual users are assigned to in turn
+func vuScenarios(probing config.ProbingConfig, offsets []int) []job {
+	jobs := make([]job, len(probing.Scenarios))
+	for i := range probing.Scenarios {
+		jobs[i] = job{index: offsets[i], scenario: &probing.Scenarios[i]}
+	}
+	return jobs
+}
+
+// runEndpoints makes one iteration over the weighted endpoint schedule with the cookie jar and variables of the
+// virtual user. It returns false when the run was cancelled
+func runEndpoints(ctx context.Context, vu *virtualUser, endpoints []config.Endpoint, schedule []int, send sendFunc, publish func(result)) bool {
+	ctx = withVariables(withCookieJar(ctx, vu.jar), vu.vars)
+	for _, i := range schedule {
+		r, ok := send(ctx, vu.id, i, endpoints[i])
+		if !ok {
+			return false
+		}
+		publish(r)
+		if !vu.think(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+// startVirtualUsers starts the virtual users, spreading their start over the ramp up. Each virtual user runs its
+// iterations of the assigned scenario, or of the endpoints when there are no scenarios, with its own cookie jar and
+// variables. It returns the counter of the started iterations
+func startVirtualUsers(ctx context.Context, wg *sync.WaitGroup, probing config.ProbingConfig, offsets []int, send sendFunc, publish func(result), logger *slog.Logger) *atomic.Int64 {
+	vus := probing.VirtualUsers
+	iterations := vuIterations(probing)
+	scenarios := vuScenarios(probing, offsets)
+	schedule := weightedSchedule(probing.Endpoints)
+	rampUp := time.Duration(vus.RampUpMS) * time.Millisecond
+
+	started := &atomic.Int64{}
+	logger.Info("Starting virtual users", "count", vus.Count, "iterations", iterations, "ramp_up", rampUp)
+	for id := range vus.Count {
+		wg.Go(func() {
+			ctx := withRand(ctx, newWorkerRand(probing.Seed, id))
+			if !sleepContext(ctx, rampUp*time.Duration(id)/time.Duration(vus.Count)) {
+				return
+			}
+			logger.Debug("Virtual user started", "vu_id", id)
+
+			vu := newVirtualUser(id, vus.ThinkTime)
+			pace := newPacer(probing.Pacing, 1)
+			for range iterations {
+				if !pace.wait(ctx) {
+					logger.Warn("Virtual user stopped due to cancellation", "vu_id", id)
+					return
+				}
+				started.Add(1)
+				var ok bool
+				if len(scenarios) == 0 {
+					ok = runEndpoints(ctx, vu, probing.Endpoints, schedule, send, publish)
+				} else {
+					ok = runScenario(ctx, id, scenarios[id%len(scenarios)], vu, send, publish, logger)
+				}
+				if !ok {
+					logger.Warn("Virtual user stopped due to cancellation", "vu_id", id)
+					return
+				}
+			}
+			logger.Debug("Virtual user finished", "vu_id", id)
+		})
+	}
+	return started
+}
+
+// vuIterations returns the number of iterations per virtual user
+func vuIterations(probing config.ProbingConfig) int {
+	if probing.VirtualUsers.Iterations > 0 {
+		return probing.VirtualUsers.Iterations
+	}
+	return probing.TotalRequests
+}
+
+// vuRequests returns the number of requests the virtual users make in total
+func vuRequests(probing config.ProbingConfig) int {
+	iterations := vuIterations(probing)
+	scenarios := probing.Scenarios
+	if len(scenarios) == 0 {
+		return probing.VirtualUsers.Count * iterations * len(weightedSchedule(probing.Endpoints))
+	}
+	total := 0
+	for id := range probing.VirtualUsers.Count {
+		total += iterations * len(scenarios[id%len(scenarios)].Steps)
+	}
+	return total
+}
+
+// sleepContext waits for the given duration, it returns false when the context is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,229 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dasvh/enchante/internal/config"
+)
+
+// maxRecordedBody is the largest request body stored in an endpoint, larger bodies are forwarded but not recorded
+const maxRecordedBody = 64 * 1024
+
+// tunnelDialTimeout limits how long connecting to the target of a CONNECT request may take
+const tunnelDialTimeout = 10 * time.Second
+
+// hopHeaders apply to a single connection, they are neither forwarded nor recorded
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// skippedHeaders are not recorded, the HTTP client of the probe sets them itself
+var skippedHeaders = map[string]bool{
+	"Accept-Encoding": true,
+	"Content-Length":  true,
+	"Host":            true,
+	"User-Agent":      true,
+}
+
+// credentialHeaders are not recorded to keep secrets out of the config, auth is configured separately
+var credentialHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+}
+
+// Recorder is an HTTP proxy that records the requests made through it as endpoints. It is a forward proxy, and a
+// reverse proxy for the requests made to it directly when it has a target
+type Recorder struct {
+	transport http.RoundTripper
+	logger    *slog.Logger
+	// target is the URL the requests made to the recorder directly are forwarded to, nil when it is only a forward proxy
+	target *url.URL
+
+	mu        sync.Mutex
+	seen      map[string]bool
+	endpoints []config.Endpoint
+}
+
+// New creates a recorder forwarding the requests with the given transport
+func New(transport http.RoundTripper, logger *slog.Logger) *Recorder {
+	return &Recorder{transport: transport, logger: logger, seen: make(map[string]bool)}
+}
+
+// NewReverse creates a recorder that also forwards the requests made to it directly to the target, e.g.
+// http://localhost:8080/items to https://api.example.com/items, and records them with the URL of the target
+func NewReverse(target *url.URL, transport http.RoundTripper, logger *slog.Logger) *Recorder {
+	rec := New(transport, logger)
+	rec.target = target
+	return rec
+}
+
+// ServeHTTP forwards the request to its target and records it. HTTPS requests are tunnelled, their content can not
+// be recorded
+func (rec *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		rec.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		if rec.target == nil {
+			http.Error(w, "enchante record only handles proxy requests, set -target to record as a reverse proxy", http.StatusBadRequest)
+			return
+		}
+		r = rec.reverse(r)
+	}
+
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Body = http.NoBody
+	if len(body) > 0 {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	out.ContentLength = int64(len(body))
+	for _, header := range hopHeaders {
+		out.Header.Del(header)
+	}
+
+	resp, err := rec.transport.RoundTrip(out)
+	if err != nil {
+		rec.logger.Warn("Failed to forward request", "method", r.Method, "url", r.URL.String(), "error", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		rec.logger.Debug("Failed to copy response body", "url", r.URL.String(), "error", err)
+	}
+
+	rec.record(r, body)
+}
+
+// reverse returns the request made to the recorder directly with the URL and host of the target
+func (rec *Recorder) reverse(r *http.Request) *http.Request {
+	out := r.Clone(r.Context())
+	out.URL.Scheme = rec.target.Scheme
+	out.URL.Host = rec.target.Host
+	out.URL.Path = strings.TrimSuffix(rec.target.Path, "/") + r.URL.Path
+	out.URL.RawPath = ""
+	if r.URL.RawPath != "" {
+		out.URL.RawPath = strings.TrimSuffix(rec.target.EscapedPath(), "/") + r.URL.RawPath
+	}
+	if rec.target.RawQuery != "" && r.URL.RawQuery != "" {
+		out.URL.RawQuery = rec.target.RawQuery + "&" + r.URL.RawQuery
+	} else if rec.target.RawQuery != "" {
+		out.URL.RawQuery = rec.target.RawQuery
+	}
+	out.Host = rec.target.Host
+	return out
+}
+
+// record stores the request as an endpoint, requests with the same method, URL and body are recorded once
+func (rec *Recorder) record(r *http.Request, body []byte) {
+	endpoint := config.Endpoint{URL: r.URL.String(), Method: r.Method}
+	switch {
+	case len(body) > maxRecordedBody:
+		rec.logger.Warn("Request body too large to record, the endpoint is recorded without it", "url", endpoint.URL, "bytes", len(body))
+	case !utf8.Valid(body):
+		endpoint.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	default:
+		endpoint.Body = string(body)
+	}
+
+	for key, values := range r.Header {
+		if skippedHeaders[key] || slices.Contains(hopHeaders, key) || len(values) == 0 {
+			continue
+		}
+		if credentialHeaders[key] {
+			rec.logger.Info("Credential header not recorded, configure auth for the endpoint instead", "url", endpoint.URL, "header", key)
+			continue
+		}
+		if endpoint.Headers == nil {
+			endpoint.Headers = make(map[string]string)
+		}
+		endpoint.Headers[key] = values[0]
+	}
+
+	key := endpoint.Method + " " + endpoint.URL + " " + endpoint.Body + endpoint.BodyBase64
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.seen[key] {
+		return
+	}
+	rec.seen[key] = true
+	rec.endpoints = append(rec.endpoints, endpoint)
+	rec.logger.Info("Recorded endpoint", "method", endpoint.Method, "url", endpoint.URL)
+}
+
+// tunnel connects the client to the target of a CONNECT request without inspecting the traffic
+func (rec *Recorder) tunnel(w http.ResponseWriter, r *http.Request) {
+	rec.logger.Warn("HTTPS request tunnelled without recording, use plain HTTP to record it", "host", r.Host)
+
+	target, err := net.DialTimeout("tcp", r.Host, tunnelDialTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		target.Close()
+		http.Error(w, "tunnelling not supported", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	client, _, err := hijacker.Hijack()
+	if err != nil {
+		target.Close()
+		return
+	}
+
+	go func() {
+		defer target.Close()
+		defer client.Close()
+		_, _ = io.Copy(target, client)
+	}()
+	go func() {
+		defer target.Close()
+		defer client.Close()
+		_, _ = io.Copy(client, target)
+	}()
+}
+
+// Endpoints returns the recorded endpoints in the order they were first requested
+func (rec *Recorder) Endpoints() []config.Endpoint {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]config.Endpoint(nil), rec.endpoints...)
+}
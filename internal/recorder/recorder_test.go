@@ -0,0 +1,112 @@
+package recorder
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dasvh/enchante/internal/config"
+	"github.com/dasvh/enchante/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Target", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(r.Method + " " + string(body)))
+	}))
+	defer target.Close()
+
+	rec := New(http.DefaultTransport, testutil.Logger)
+	proxy := httptest.NewServer(rec)
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	req, _ := http.NewRequest(http.MethodGet, target.URL+"/items?page=2", nil)
+	req.Header.Set("X-Trace", "abc")
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Expected the response to be forwarded")
+	assert.Equal(t, "yes", resp.Header.Get("X-Target"))
+	assert.Equal(t, "GET ", string(body))
+
+	resp, err = client.Post(target.URL+"/items", "application/json", strings.NewReader(`{"name": "enchante"}`))
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, `POST {"name": "enchante"}`, string(body))
+
+	// a binary body is recorded as base64
+	resp, err = client.Post(target.URL+"/events", "application/x-protobuf", bytes.NewReader([]byte{0x08, 0x96, 0x01, 0xff}))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	// a repeated request is recorded once
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, []config.Endpoint{
+		{URL: target.URL + "/items?page=2", Method: "GET", Headers: map[string]string{"X-Trace": "abc"}},
+		{URL: target.URL + "/items", Method: "POST", Body: `{"name": "enchante"}`, Headers: map[string]string{"Content-Type": "application/json"}},
+		{URL: target.URL + "/events", Method: "POST", BodyBase64: "CJYB/w==", Headers: map[string]string{"Content-Type": "application/x-protobuf"}},
+	}, rec.Endpoints())
+}
+
+func TestRecorderRejectsDirectRequests(t *testing.T) {
+	proxy := httptest.NewServer(New(http.DefaultTransport, testutil.Logger))
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/items")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestReverseRecorder(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method + " " + r.Host + " " + r.URL.RequestURI()))
+	}))
+	defer target.Close()
+
+	targetURL, _ := url.Parse(target.URL + "/api/")
+	rec := NewReverse(targetURL, http.DefaultTransport, testutil.Logger)
+	proxy := httptest.NewServer(rec)
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/items?page=2")
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "GET "+targetURL.Host+" /api/items?page=2", string(body), "Expected the request to be forwarded to the target")
+
+	resp, err = http.Post(proxy.URL+"/items", "application/json", strings.NewReader(`{"name": "enchante"}`))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	// proxy requests are still forwarded to their own URL
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err = client.Get(target.URL + "/health")
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "GET "+targetURL.Host+" /health", string(body))
+
+	assert.Equal(t, []config.Endpoint{
+		{URL: target.URL + "/api/items?page=2", Method: "GET"},
+		{URL: target.URL + "/api/items", Method: "POST", Body: `{"name": "enchante"}`, Headers: map[string]string{"Content-Type": "application/json"}},
+		{URL: target.URL + "/health", Method: "GET"},
+	}, rec.Endpoints())
+}
@@ -0,0 +1,58 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteBenchmark writes the endpoints of the report in the Go benchmark format, one line per endpoint with successful
+// requests, so runs can be compared statistically with benchstat. The iterations are the successful requests, ns/op
+// is their mean response time, followed by the percentiles, the response body size and the error rate
+func WriteBenchmark(w io.Writer, r *Report) error {
+	for _, e := range r.Endpoints {
+		if e.SuccessfulRequests == 0 {
+			continue
+		}
+		_, err := fmt.Fprintf(w, "%s\t%d\t%.0f ns/op\t%.0f p50-ns\t%.0f p95-ns\t%.0f p99-ns\t%.0f B/op\t%.4f errors/op\n",
+			benchmarkName(e),
+			e.SuccessfulRequests,
+			e.Latency.AvgMS*1e6,
+			e.Latency.P50MS*1e6,
+			e.Latency.P95MS*1e6,
+			e.Latency.P99MS*1e6,
+			e.Transfer.AvgResponseBytes,
+			e.ErrorRate())
+		if err != nil {
+			return fmt.Errorf("error writing benchmark results: %w", err)
+		}
+	}
+	return nil
+}
+
+// benchmarkName returns the benchmark name of an endpoint, built from its key without the URL scheme. Characters
+// benchstat treats as separators are replaced with underscores, scenario steps are sub-benchmarks of their scenario
+func benchmarkName(e EndpointReport) string {
+	target := e.URL
+	if _, rest, ok := strings.Cut(target, "://"); ok {
+		target = rest
+	}
+	name := "Benchmark"
+	if e.Scenario != "" {
+		name += "Scenario_" + sanitizeBenchmarkName(e.Scenario) + "/" + sanitizeBenchmarkName(e.Step) + "/"
+	}
+	return name + sanitizeBenchmarkName(e.Method+"_"+target+instanceSuffix(e.Instance))
+}
+
+// sanitizeBenchmarkName replaces the characters other than letters, digits and dots with underscores, dashes included
+// since benchstat reads a trailing -N as the GOMAXPROCS of the benchmark
+func sanitizeBenchmarkName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -0,0 +1,113 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Diff represents the comparison between two probe runs
+type Diff struct {
+	Before    *Report
+	After     *Report
+	Endpoints []EndpointDiff
+}
+
+// EndpointDiff represents the comparison of a single endpoint between two runs,
+// Before or After is nil when the endpoint was only probed in one of the runs
+type EndpointDiff struct {
+	Key    string
+	Before *EndpointReport
+	After  *EndpointReport
+}
+
+// Compare matches the endpoints of two runs by method and URL
+func Compare(before, after *Report) *Diff {
+	diff := &Diff{Before: before, After: after}
+	index := make(map[string]int)
+
+	for i := range before.Endpoints {
+		e := &before.Endpoints[i]
+		index[e.Key()] = len(diff.Endpoints)
+		diff.Endpoints = append(diff.Endpoints, EndpointDiff{Key: e.Key(), Before: e})
+	}
+	for i := range after.Endpoints {
+		e := &after.Endpoints[i]
+		if idx, ok := index[e.Key()]; ok {
+			diff.Endpoints[idx].After = e
+			continue
+		}
+		diff.Endpoints = append(diff.Endpoints, EndpointDiff{Key: e.Key(), After: e})
+	}
+
+	return diff
+}
+
+// Change returns the relative change in percent from before to after
+func Change(before, after float64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return (after - before) / before * 100
+}
+
+// WriteText writes the comparison as a plain text table
+func WriteText(w io.Writer, d *Diff) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENDPOINT\tP50 (ms)\tP99 (ms)\tERROR RATE\tREQ/S\tP50 CHANGE\tP99 CHANGE\tREQ/S CHANGE")
+
+	for _, e := range d.Endpoints {
+		switch {
+		case e.Before == nil:
+			fmt.Fprintf(tw, "%s\t- → %.2f\t- → %.2f\t- → %.2f%%\t- → %.1f\tnew\tnew\tnew\n",
+				e.Key, e.After.Latency.P50MS, e.After.Latency.P99MS, e.After.ErrorRate()*100,
+				Throughput(e.After, d.After.DurationMS))
+		case e.After == nil:
+			fmt.Fprintf(tw, "%s\t%.2f → -\t%.2f → -\t%.2f%% → -\t%.1f → -\tremoved\tremoved\tremoved\n",
+				e.Key, e.Before.Latency.P50MS, e.Before.Latency.P99MS, e.Before.ErrorRate()*100,
+				Throughput(e.Before, d.Before.DurationMS))
+		default:
+			beforeRPS, afterRPS := Throughput(e.Before, d.Before.DurationMS), Throughput(e.After, d.After.DurationMS)
+			fmt.Fprintf(tw, "%s\t%.2f → %.2f\t%.2f → %.2f\t%.2f%% → %.2f%%\t%.1f → %.1f\t%+.1f%%\t%+.1f%%\t%+.1f%%\n",
+				e.Key,
+				e.Before.Latency.P50MS, e.After.Latency.P50MS,
+				e.Before.Latency.P99MS, e.After.Latency.P99MS,
+				e.Before.ErrorRate()*100, e.After.ErrorRate()*100,
+				beforeRPS, afterRPS,
+				Change(e.Before.Latency.P50MS, e.After.Latency.P50MS),
+				Change(e.Before.Latency.P99MS, e.After.Latency.P99MS),
+				Change(beforeRPS, afterRPS))
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	return writeLatencyPerKB(w, d)
+}
+
+// writeLatencyPerKB writes the size-normalized latency of the endpoints reporting it in both runs, nothing when no
+// endpoint does
+func writeLatencyPerKB(w io.Writer, d *Diff) error {
+	var normalized []EndpointDiff
+	for _, e := range d.Endpoints {
+		if e.Before != nil && e.After != nil && e.Before.Transfer.LatencyPerKB != nil && e.After.Transfer.LatencyPerKB != nil {
+			normalized = append(normalized, e)
+		}
+	}
+	if len(normalized) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nENDPOINT\tP50 PER KB (ms)\tAVG RESPONSE (KB)\tP50 PER KB CHANGE")
+	for _, e := range normalized {
+		before, after := e.Before.Transfer.LatencyPerKB, e.After.Transfer.LatencyPerKB
+		fmt.Fprintf(tw, "%s\t%.3f → %.3f\t%.1f → %.1f\t%+.1f%%\n",
+			e.Key,
+			before.P50MS, after.P50MS,
+			e.Before.Transfer.AvgResponseBytes/1024, e.After.Transfer.AvgResponseBytes/1024,
+			Change(before.P50MS, after.P50MS))
+	}
+	return tw.Flush()
+}
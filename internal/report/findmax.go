@@ -0,0 +1,33 @@
+package report
+
+// reasons a find-max step was not sustained
+const (
+	FindMaxThresholds = "thresholds"
+	// FindMaxSaturated is set when the requests could not be started at the rate of the step, e.g. because the
+	// responses are too slow for the workers
+	FindMaxSaturated = "saturated"
+)
+
+// FindMax represents the outcome of the find-max mode, the steps of increasing request rates and the highest rate
+// that was sustained
+type FindMax struct {
+	StepDurationMS int `json:"step_duration_ms"`
+	// MaxSustainableRPS is the rate of the last sustained step, 0 when the first step was not sustained
+	MaxSustainableRPS float64       `json:"max_sustainable_rps"`
+	Steps             []FindMaxStep `json:"steps"`
+}
+
+// FindMaxStep represents a step of the find-max mode at a request rate
+type FindMaxStep struct {
+	TargetRPS     float64 `json:"target_rps"`
+	AchievedRPS   float64 `json:"achieved_rps"`
+	TotalRequests int     `json:"total_requests"`
+	ErrorRate     float64 `json:"error_rate"`
+	P95MS         float64 `json:"p95_ms"`
+	P99MS         float64 `json:"p99_ms"`
+	Sustained     bool    `json:"sustained"`
+	// Reason is why the step was not sustained, thresholds or saturated
+	Reason string `json:"reason,omitempty"`
+	// Breaches are the thresholds of severity fail the step breached
+	Breaches []ThresholdResult `json:"breaches,omitempty"`
+}
@@ -0,0 +1,188 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"time"
+)
+
+// histogramSubBucketBits sets the precision of the histogram, each power of two is split into 2^7 linear
+// sub-buckets, so recorded values are accurate to within 1%
+const histogramSubBucketBits = 7
+
+// histogramSubBuckets is the number of linear sub-buckets per power of two
+const histogramSubBuckets = 1 << histogramSubBucketBits
+
+// Histogram records durations in log-linear buckets like an HDR histogram, so the memory used does not grow with
+// the number of requests while percentiles stay within 1% of the exact value. The zero value is ready to use, a
+// Histogram is not safe for concurrent use
+type Histogram struct {
+	counts []int64
+	count  int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+// Record adds a duration to the histogram, negative durations are recorded as zero
+func (h *Histogram) Record(d time.Duration) {
+	d = max(d, 0)
+	index := bucketIndex(uint64(d))
+	if index >= len(h.counts) {
+		h.counts = append(h.counts, make([]int64, index+1-len(h.counts))...)
+	}
+	h.counts[index]++
+
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	h.max = max(h.max, d)
+	h.count++
+	h.sum += d
+}
+
+// Merge adds all durations recorded in other to the histogram
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.count == 0 {
+		return
+	}
+	if len(other.counts) > len(h.counts) {
+		h.counts = append(h.counts, make([]int64, len(other.counts)-len(h.counts))...)
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+
+	if h.count == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	h.max = max(h.max, other.max)
+	h.count += other.count
+	h.sum += other.sum
+}
+
+// Count returns the number of recorded durations
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+// CountWithin returns the number of recorded durations up to d, to the precision of the buckets
+func (h *Histogram) CountWithin(d time.Duration) int64 {
+	if d >= h.max {
+		return h.count
+	}
+	if d < h.min {
+		return 0
+	}
+	var within int64
+	for i, c := range h.counts {
+		if low, _ := bucketRange(i); low > uint64(d) {
+			break
+		}
+		within += c
+	}
+	return within
+}
+
+// Mean returns the exact average of the recorded durations
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// Percentile returns the nearest-rank percentile of the recorded durations
+func (h *Histogram) Percentile(p int) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := max((int64(p)*h.count+99)/100, 1)
+
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			// the middle of the bucket, the exact extremes are known
+			low, high := bucketRange(i)
+			return min(max(time.Duration(low+(high-low)/2), h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+// Latency returns the latency distribution of the recorded durations
+func (h *Histogram) Latency() Latency {
+	if h.count == 0 {
+		return Latency{}
+	}
+	return Latency{
+		MinMS: toMS(h.min),
+		AvgMS: toMS(h.Mean()),
+		P50MS: toMS(h.Percentile(50)),
+		P90MS: toMS(h.Percentile(90)),
+		P95MS: toMS(h.Percentile(95)),
+		P99MS: toMS(h.Percentile(99)),
+		MaxMS: toMS(h.max),
+	}
+}
+
+// histogramJSON is the encoding of a histogram, only the buckets with durations are listed as index and count pairs
+type histogramJSON struct {
+	Count   int64      `json:"count"`
+	SumNS   int64      `json:"sum_ns"`
+	MinNS   int64      `json:"min_ns"`
+	MaxNS   int64      `json:"max_ns"`
+	Buckets [][2]int64 `json:"buckets,omitempty"`
+}
+
+// MarshalJSON encodes the histogram, so histograms recorded by several processes can be merged
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	encoded := histogramJSON{Count: h.count, SumNS: int64(h.sum), MinNS: int64(h.min), MaxNS: int64(h.max)}
+	for i, c := range h.counts {
+		if c > 0 {
+			encoded.Buckets = append(encoded.Buckets, [2]int64{int64(i), c})
+		}
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes a histogram encoded by MarshalJSON
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var encoded histogramJSON
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	*h = Histogram{count: encoded.Count, sum: time.Duration(encoded.SumNS), min: time.Duration(encoded.MinNS), max: time.Duration(encoded.MaxNS)}
+	for _, bucket := range encoded.Buckets {
+		index := int(bucket[0])
+		if index < 0 || index > bucketIndex(^uint64(0)) {
+			return fmt.Errorf("invalid histogram bucket %d", index)
+		}
+		if index >= len(h.counts) {
+			h.counts = append(h.counts, make([]int64, index+1-len(h.counts))...)
+		}
+		h.counts[index] += bucket[1]
+	}
+	return nil
+}
+
+// bucketIndex returns the bucket of a value, values below two sub-bucket ranges get a bucket each
+func bucketIndex(v uint64) int {
+	shift := bits.Len64(v) - (histogramSubBucketBits + 1)
+	if shift <= 0 {
+		return int(v)
+	}
+	return shift*histogramSubBuckets + int(v>>shift)
+}
+
+// bucketRange returns the lowest and highest value of a bucket
+func bucketRange(index int) (uint64, uint64) {
+	if index < 2*histogramSubBuckets {
+		return uint64(index), uint64(index)
+	}
+	shift := index/histogramSubBuckets - 1
+	sub := uint64(index - shift*histogramSubBuckets)
+	return sub << shift, (sub+1)<<shift - 1
+}
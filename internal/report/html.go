@@ -0,0 +1,135 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+)
+
+// latencyRow represents a single percentile row in the HTML comparison
+type latencyRow struct {
+	Name   string
+	Before float64
+	After  float64
+}
+
+var htmlFuncs = template.FuncMap{
+	"ms": func(v float64) string {
+		return fmt.Sprintf("%.2f ms", v)
+	},
+	"pct": func(v float64) string {
+		return fmt.Sprintf("%.2f%%", v*100)
+	},
+	"change": func(before, after float64) string {
+		return fmt.Sprintf("%+.1f%%", Change(before, after))
+	},
+	"trend": func(before, after float64) string {
+		switch {
+		case after > before:
+			return "worse"
+		case after < before:
+			return "better"
+		default:
+			return ""
+		}
+	},
+	"width": func(v, max float64) float64 {
+		if max == 0 {
+			return 0
+		}
+		return v / max * 100
+	},
+	"rows": latencyRows,
+	"max":  maxLatency,
+}
+
+// latencyRows returns the latency rows to render for an endpoint comparison
+func latencyRows(e EndpointDiff) []latencyRow {
+	var before, after Latency
+	if e.Before != nil {
+		before = e.Before.Latency
+	}
+	if e.After != nil {
+		after = e.After.Latency
+	}
+	return []latencyRow{
+		{"min", before.MinMS, after.MinMS},
+		{"avg", before.AvgMS, after.AvgMS},
+		{"p50", before.P50MS, after.P50MS},
+		{"p90", before.P90MS, after.P90MS},
+		{"p95", before.P95MS, after.P95MS},
+		{"p99", before.P99MS, after.P99MS},
+		{"max", before.MaxMS, after.MaxMS},
+	}
+}
+
+// maxLatency returns the highest latency of both runs, used to scale the bars
+func maxLatency(e EndpointDiff) float64 {
+	var m float64
+	if e.Before != nil {
+		m = e.Before.Latency.MaxMS
+	}
+	if e.After != nil && e.After.Latency.MaxMS > m {
+		m = e.After.Latency.MaxMS
+	}
+	return m
+}
+
+var htmlTemplate = template.Must(template.New("diff").Funcs(htmlFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Enchante run comparison</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; width: 100%; }
+th, td { padding: 4px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+.bar { height: 10px; display: inline-block; }
+.before { background: #8899aa; }
+.after { background: #3366cc; }
+.worse { color: #c0392b; }
+.better { color: #27ae60; }
+.missing { color: #888; font-style: italic; }
+</style>
+</head>
+<body>
+<h1>Run comparison</h1>
+<table>
+<tr><th></th><th>Before</th><th>After</th></tr>
+<tr><td>Started at</td><td>{{.Before.StartedAt}}</td><td>{{.After.StartedAt}}</td></tr>
+<tr><td>Duration</td><td>{{ms .Before.DurationMS}}</td><td>{{ms .After.DurationMS}}</td></tr>
+<tr><td>Successful requests</td><td>{{.Before.SuccessfulRequests}}</td><td>{{.After.SuccessfulRequests}}</td></tr>
+<tr><td>Failed requests</td><td>{{.Before.FailedRequests}}</td><td>{{.After.FailedRequests}}</td></tr>
+</table>
+{{range .Endpoints}}
+<h2>{{.Key}}</h2>
+{{if not .Before}}<p class="missing">Endpoint was not probed in the first run</p>{{end}}
+{{if not .After}}<p class="missing">Endpoint was not probed in the second run</p>{{end}}
+{{if and .Before .After}}
+<table>
+<tr><th>Error rate</th><td>{{pct .Before.ErrorRate}}</td><td>{{pct .After.ErrorRate}}</td><td></td></tr>
+</table>
+{{end}}
+{{$max := max .}}{{$both := and .Before .After}}
+<table>
+<tr><th>Latency</th><th>Before</th><th>After</th><th>Change</th><th>Distribution</th></tr>
+{{range rows .}}
+<tr>
+<td>{{.Name}}</td><td>{{ms .Before}}</td><td>{{ms .After}}</td>
+<td>{{if $both}}<span class="{{trend .Before .After}}">{{change .Before .After}}</span>{{end}}</td>
+<td>
+<div class="bar before" style="width: {{width .Before $max}}%"></div><br>
+<div class="bar after" style="width: {{width .After $max}}%"></div>
+</td>
+</tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes the comparison as a standalone HTML page
+func WriteHTML(w io.Writer, d *Diff) error {
+	return htmlTemplate.Execute(w, d)
+}
@@ -0,0 +1,284 @@
+package report
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+)
+
+// Part represents the report of one worker of a distributed run, with the response time histograms of its endpoints
+// and the journey histograms of its scenarios in the order of the report, so the percentiles of the merged report
+// are computed from all requests
+type Part struct {
+	Report    *Report      `json:"report"`
+	Latencies []*Histogram `json:"latencies"`
+	Journeys  []*Histogram `json:"journeys,omitempty"`
+}
+
+// Merge combines the reports of the workers of a distributed run into one report. Counters and bytes are summed, the
+// latencies of the endpoints, scenarios and run are computed from the merged histograms. The phases, header
+// breakdowns and normalized latencies have no histograms, their percentiles are averaged weighted by requests
+func Merge(parts []Part) *Report {
+	merged := &Report{}
+	endpoints := make(map[string]int)
+	var latencies []*Histogram
+	scenarios := make(map[string]int)
+	var journeys []*Histogram
+	var total Histogram
+
+	for i, part := range parts {
+		r := part.Report
+		if i == 0 || r.StartedAt.Before(merged.StartedAt) {
+			merged.StartedAt = r.StartedAt
+		}
+		merged.DurationMS = max(merged.DurationMS, r.DurationMS)
+		merged.SuccessfulRequests += r.SuccessfulRequests
+		merged.FailedRequests += r.FailedRequests
+		merged.Traffic = mergeTraffic(merged.Traffic, r.Traffic)
+		merged.Adaptive = mergeAdaptive(merged.Adaptive, r.Adaptive)
+		merged.Backpressure = mergeBackpressure(merged.Backpressure, r.Backpressure)
+		merged.Errors = sumCounts(merged.Errors, r.Errors)
+		merged.StopReason = cmp.Or(merged.StopReason, r.StopReason)
+		if merged.HealthCheck == nil {
+			merged.HealthCheck = r.HealthCheck
+		}
+		if merged.CORS == nil {
+			merged.CORS = r.CORS
+		}
+		for host, addrs := range r.PinnedHosts {
+			if merged.PinnedHosts == nil {
+				merged.PinnedHosts = make(map[string][]string)
+			}
+			for _, addr := range addrs {
+				if !slices.Contains(merged.PinnedHosts[host], addr) {
+					merged.PinnedHosts[host] = append(merged.PinnedHosts[host], addr)
+				}
+			}
+		}
+
+		for j, e := range r.Endpoints {
+			h := histogramAt(part.Latencies, j)
+			total.Merge(h)
+			index, ok := endpoints[e.Key()]
+			if !ok {
+				endpoints[e.Key()] = len(merged.Endpoints)
+				merged.Endpoints = append(merged.Endpoints, e)
+				latencies = append(latencies, &Histogram{})
+				latencies[len(latencies)-1].Merge(h)
+				continue
+			}
+			merged.Endpoints[index] = mergeEndpoint(merged.Endpoints[index], e)
+			latencies[index].Merge(h)
+		}
+
+		for j, s := range r.Scenarios {
+			h := histogramAt(part.Journeys, j)
+			index, ok := scenarios[s.Name]
+			if !ok {
+				scenarios[s.Name] = len(merged.Scenarios)
+				merged.Scenarios = append(merged.Scenarios, s)
+				journeys = append(journeys, &Histogram{})
+				journeys[len(journeys)-1].Merge(h)
+				continue
+			}
+			m := &merged.Scenarios[index]
+			m.Iterations += s.Iterations
+			m.SuccessfulIterations += s.SuccessfulIterations
+			m.FailedIterations += s.FailedIterations
+			m.SLABreaches += s.SLABreaches
+			journeys[index].Merge(h)
+		}
+	}
+
+	merged.TotalRequests = merged.SuccessfulRequests + merged.FailedRequests
+	merged.Latency = total.Latency()
+	for i := range merged.Endpoints {
+		merged.Endpoints[i].Latency = latencies[i].Latency()
+		transfer := &merged.Endpoints[i].Transfer
+		if successes := merged.Endpoints[i].SuccessfulRequests; successes > 0 {
+			transfer.AvgResponseBytes = float64(transfer.ResponseBytes) / float64(successes)
+		}
+	}
+	for i := range merged.Scenarios {
+		merged.Scenarios[i].Latency = journeys[i].Latency()
+	}
+	return merged
+}
+
+// histogramAt returns the histogram at index, nil when the part has none
+func histogramAt(histograms []*Histogram, index int) *Histogram {
+	if index < len(histograms) {
+		return histograms[index]
+	}
+	return nil
+}
+
+// mergeEndpoint adds the results of an endpoint reported by another worker, the latency is set from the histograms
+func mergeEndpoint(a, b EndpointReport) EndpointReport {
+	aRequests, bRequests := float64(a.SuccessfulRequests), float64(b.SuccessfulRequests)
+	a.Phases = Phases{
+		NewConnections: a.Phases.NewConnections + b.Phases.NewConnections,
+		DNS:            weightedLatency(a.Phases.DNS, b.Phases.DNS, float64(a.Phases.NewConnections), float64(b.Phases.NewConnections)),
+		Connect:        weightedLatency(a.Phases.Connect, b.Phases.Connect, float64(a.Phases.NewConnections), float64(b.Phases.NewConnections)),
+		TLS:            weightedLatency(a.Phases.TLS, b.Phases.TLS, float64(a.Phases.NewConnections), float64(b.Phases.NewConnections)),
+		TTFB:           weightedLatency(a.Phases.TTFB, b.Phases.TTFB, aRequests, bRequests),
+		BodyRead:       weightedLatency(a.Phases.BodyRead, b.Phases.BodyRead, aRequests, bRequests),
+		Decompress:     weightedLatency(a.Phases.Decompress, b.Phases.Decompress, float64(a.Compression.CompressedResponses), float64(b.Compression.CompressedResponses)),
+	}
+	if a.Transfer.LatencyPerKB != nil && b.Transfer.LatencyPerKB != nil {
+		latency := weightedLatency(*a.Transfer.LatencyPerKB, *b.Transfer.LatencyPerKB, aRequests, bRequests)
+		a.Transfer.LatencyPerKB = &latency
+	}
+	a.Transfer.RequestBytes += b.Transfer.RequestBytes
+	a.Transfer.ResponseBytes += b.Transfer.ResponseBytes
+	a.Transfer.ResponseMBps += b.Transfer.ResponseMBps
+
+	if ratio := float64(a.Compression.CompressedResponses + b.Compression.CompressedResponses); ratio > 0 {
+		a.Compression.Ratio = (a.Compression.Ratio*float64(a.Compression.CompressedResponses) +
+			b.Compression.Ratio*float64(b.Compression.CompressedResponses)) / ratio
+	}
+	a.Compression.CompressedResponses += b.Compression.CompressedResponses
+	a.Compression.Encodings = sumCounts(a.Compression.Encodings, b.Compression.Encodings)
+
+	if b.HeaderBreakdown != nil {
+		breakdown := make(map[string]map[string]HeaderValue)
+		headers := slices.Concat(slices.Collect(maps.Keys(a.HeaderBreakdown)), slices.Collect(maps.Keys(b.HeaderBreakdown)))
+		slices.Sort(headers)
+		for _, header := range slices.Compact(headers) {
+			values := make(map[string]HeaderValue)
+			for _, side := range []map[string]HeaderValue{a.HeaderBreakdown[header], b.HeaderBreakdown[header]} {
+				for value, v := range side {
+					m := values[value]
+					m.Latency = weightedLatency(m.Latency, v.Latency, float64(m.Requests), float64(v.Requests))
+					m.Requests += v.Requests
+					values[value] = m
+				}
+			}
+			breakdown[header] = values
+		}
+		a.HeaderBreakdown = breakdown
+	}
+
+	if b.Reuse != nil {
+		if a.Reuse == nil {
+			a.Reuse = &Reuse{}
+		}
+		reuse := *a.Reuse
+		reuse.ReusedConnections += b.Reuse.ReusedConnections
+		reuse.TLSHandshakes += b.Reuse.TLSHandshakes
+		reuse.TLSResumptions += b.Reuse.TLSResumptions
+		if successes := a.SuccessfulRequests + b.SuccessfulRequests; successes > 0 {
+			reuse.ConnectionReuseRate = float64(reuse.ReusedConnections) / float64(successes)
+		}
+		if reuse.TLSHandshakes > 0 {
+			reuse.TLSResumptionRate = float64(reuse.TLSResumptions) / float64(reuse.TLSHandshakes)
+		}
+		a.Reuse = &reuse
+	}
+	if b.Backoff != nil {
+		if a.Backoff == nil {
+			a.Backoff = &Backoff{}
+		}
+		// the workers pause independently, the longest pause is reported
+		a.Backoff = &Backoff{
+			Pauses:      a.Backoff.Pauses + b.Backoff.Pauses,
+			PausedMS:    max(a.Backoff.PausedMS, b.Backoff.PausedMS),
+			PausedShare: max(a.Backoff.PausedShare, b.Backoff.PausedShare),
+		}
+	}
+
+	a.SuccessfulRequests += b.SuccessfulRequests
+	a.FailedRequests += b.FailedRequests
+	a.SLABreaches += b.SLABreaches
+	a.SkippedRequests += b.SkippedRequests
+	a.ShedRequests += b.ShedRequests
+	a.DialFailures = sumCounts(a.DialFailures, b.DialFailures)
+	a.Errors = sumCounts(a.Errors, b.Errors)
+	return a
+}
+
+// weightedLatency combines two latency distributions without their histograms, the extremes are exact and the
+// average and percentiles are weighted by the number of durations recorded in each
+func weightedLatency(a, b Latency, aWeight, bWeight float64) Latency {
+	switch {
+	case bWeight <= 0:
+		return a
+	case aWeight <= 0:
+		return b
+	}
+	weighted := func(x, y float64) float64 {
+		return (x*aWeight + y*bWeight) / (aWeight + bWeight)
+	}
+	return Latency{
+		MinMS: min(a.MinMS, b.MinMS),
+		AvgMS: weighted(a.AvgMS, b.AvgMS),
+		P50MS: weighted(a.P50MS, b.P50MS),
+		P90MS: weighted(a.P90MS, b.P90MS),
+		P95MS: weighted(a.P95MS, b.P95MS),
+		P99MS: weighted(a.P99MS, b.P99MS),
+		MaxMS: max(a.MaxMS, b.MaxMS),
+	}
+}
+
+// mergeTraffic sums the traffic of the workers, their rates add up as they ran concurrently
+func mergeTraffic(a, b Traffic) Traffic {
+	return Traffic{
+		BytesSent:     a.BytesSent + b.BytesSent,
+		BytesReceived: a.BytesReceived + b.BytesReceived,
+		EgressKbps:    a.EgressKbps + b.EgressKbps,
+		IngressKbps:   a.IngressKbps + b.IngressKbps,
+		LimitKbps:     a.LimitKbps + b.LimitKbps,
+		EgressMBps:    a.EgressMBps + b.EgressMBps,
+		IngressMBps:   a.IngressMBps + b.IngressMBps,
+	}
+}
+
+// mergeAdaptive sums the concurrency of the workers adapting independently
+func mergeAdaptive(a, b *Adaptive) *Adaptive {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+	return &Adaptive{
+		TargetLatencyMS:      a.TargetLatencyMS,
+		SustainedConcurrency: a.SustainedConcurrency + b.SustainedConcurrency,
+		FinalConcurrency:     a.FinalConcurrency + b.FinalConcurrency,
+		MaxConcurrency:       a.MaxConcurrency + b.MaxConcurrency,
+		Decreases:            a.Decreases + b.Decreases,
+	}
+}
+
+// mergeBackpressure combines the backpressure of two workers, the caps of the workers add up
+func mergeBackpressure(a, b *Backpressure) *Backpressure {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+	return &Backpressure{
+		MaxInFlight:        a.MaxInFlight + b.MaxInFlight,
+		FinalInFlight:      a.FinalInFlight + b.FinalInFlight,
+		MinInFlight:        a.MinInFlight + b.MinInFlight,
+		ThrottledResponses: a.ThrottledResponses + b.ThrottledResponses,
+		Decreases:          a.Decreases + b.Decreases,
+		PausedMS:           max(a.PausedMS, b.PausedMS),
+	}
+}
+
+// sumCounts returns the sum of two count maps, nil when both are empty
+func sumCounts(a, b map[string]int) map[string]int {
+	if len(b) == 0 {
+		return a
+	}
+	sum := maps.Clone(a)
+	if sum == nil {
+		sum = make(map[string]int, len(b))
+	}
+	for key, count := range b {
+		sum[key] += count
+	}
+	return sum
+}
@@ -0,0 +1,94 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// regression metrics
+const (
+	MetricP50        = "p50"
+	MetricP99        = "p99"
+	MetricErrorRate  = "error_rate"
+	MetricThroughput = "throughput"
+)
+
+// Tolerances limits the regressions of the endpoints between two runs, a nil limit is not checked
+type Tolerances struct {
+	// P50Increase and P99Increase are the allowed latency increases in percent
+	P50Increase *float64
+	P99Increase *float64
+	// ErrorRateIncrease is the allowed error rate increase in percentage points
+	ErrorRateIncrease *float64
+	// ThroughputDecrease is the allowed decrease of the requests per second in percent
+	ThroughputDecrease *float64
+}
+
+// Regression represents a metric of an endpoint that got worse than its tolerance allows
+type Regression struct {
+	Key    string
+	Metric string
+	Before float64
+	After  float64
+	// Change is the relative change in percent, or the change in percentage points for the error rate
+	Change    float64
+	Tolerance float64
+}
+
+// Throughput returns the requests per second of an endpoint over the duration of its run
+func Throughput(e *EndpointReport, durationMS float64) float64 {
+	if durationMS <= 0 {
+		return 0
+	}
+	return float64(e.SuccessfulRequests+e.FailedRequests) / (durationMS / 1000)
+}
+
+// Regressions returns the metrics of the endpoints probed in both runs exceeding their tolerance. New and removed
+// endpoints are not regressions
+func (d *Diff) Regressions(t Tolerances) []Regression {
+	var regressions []Regression
+	check := func(key, metric string, tolerance *float64, before, after, change float64) {
+		if tolerance != nil && change > *tolerance {
+			regressions = append(regressions, Regression{Key: key, Metric: metric, Before: before, After: after, Change: change, Tolerance: *tolerance})
+		}
+	}
+
+	for _, e := range d.Endpoints {
+		if e.Before == nil || e.After == nil {
+			continue
+		}
+		before, after := e.Before.Latency, e.After.Latency
+		check(e.Key, MetricP50, t.P50Increase, before.P50MS, after.P50MS, Change(before.P50MS, after.P50MS))
+		check(e.Key, MetricP99, t.P99Increase, before.P99MS, after.P99MS, Change(before.P99MS, after.P99MS))
+		beforeRate, afterRate := e.Before.ErrorRate()*100, e.After.ErrorRate()*100
+		check(e.Key, MetricErrorRate, t.ErrorRateIncrease, beforeRate, afterRate, afterRate-beforeRate)
+		beforeRPS, afterRPS := Throughput(e.Before, d.Before.DurationMS), Throughput(e.After, d.After.DurationMS)
+		// a decrease is checked, so the change is negated
+		check(e.Key, MetricThroughput, t.ThroughputDecrease, beforeRPS, afterRPS, -Change(beforeRPS, afterRPS))
+	}
+	return regressions
+}
+
+// WriteRegressions writes the regressions as a plain text table, or a line stating there are none
+func WriteRegressions(w io.Writer, regressions []Regression) error {
+	if len(regressions) == 0 {
+		_, err := fmt.Fprintln(w, "\nNo regressions beyond the tolerances")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nREGRESSION\tMETRIC\tBEFORE\tAFTER\tCHANGE\tTOLERANCE")
+	for _, r := range regressions {
+		unit := "%"
+		if r.Metric == MetricErrorRate {
+			unit = " pp"
+		}
+		change := r.Change
+		if r.Metric == MetricThroughput {
+			change = -change
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.2f\t%.2f\t%+.1f%s\t%.1f%s\n", r.Key, r.Metric, r.Before, r.After, change, unit, r.Tolerance, unit)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,423 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// Report represents the results of a probe run
+type Report struct {
+	StartedAt          time.Time        `json:"started_at"`
+	DurationMS         float64          `json:"duration_ms"`
+	TotalRequests      int              `json:"total_requests"`
+	SuccessfulRequests int              `json:"successful_requests"`
+	FailedRequests     int              `json:"failed_requests"`
+	Latency            Latency          `json:"latency"`
+	Traffic            Traffic          `json:"traffic"`
+	Adaptive           *Adaptive        `json:"adaptive,omitempty"`
+	Endpoints          []EndpointReport `json:"endpoints"`
+	// Errors counts the failed requests per category, e.g. timeout, dns, connection_refused, tls or status_5xx
+	Errors map[string]int `json:"errors,omitempty"`
+	// Scenarios holds the iteration results per scenario
+	Scenarios []ScenarioReport `json:"scenarios,omitempty"`
+	// PinnedHosts are the addresses the endpoint hosts were pinned to for the run
+	PinnedHosts map[string][]string `json:"pinned_hosts,omitempty"`
+	// Seed is the seed of the random delays, set it in the config to reproduce the run
+	Seed int64 `json:"seed,omitempty"`
+	// StopReason is set when the run ended before all requests were sent: max_duration, canceled or stopped through
+	// the control API
+	StopReason string `json:"stop_reason,omitempty"`
+	// RunID identifies the run, it is sent in the run ID header when one is configured
+	RunID string `json:"run_id,omitempty"`
+	// Thresholds holds the outcome of every configured threshold
+	Thresholds []ThresholdResult `json:"thresholds,omitempty"`
+	// HealthCheck holds the checks of the health endpoint and the pauses of the load, set when one is configured
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+	// CORS holds the outcome of the CORS preflight checks of the endpoints
+	CORS []CORSResult `json:"cors,omitempty"`
+	// SLO holds the compliance and error budget burn of every configured service level objective
+	SLO []SLOResult `json:"slo,omitempty"`
+	// Backpressure holds the adjustments of the in-flight cap to the throttling of the target, set when enabled
+	Backpressure *Backpressure `json:"backpressure,omitempty"`
+	// FindMax holds the steps of the find-max mode, the report is the one of the highest sustained step
+	FindMax *FindMax `json:"find_max,omitempty"`
+}
+
+// CORSResult represents the outcome of the CORS preflight check of an endpoint
+type CORSResult struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Origin string `json:"origin"`
+	// Status is the status code of the preflight response, 0 when the request failed with the error
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Failures lists the Access-Control headers that do not allow the preflight
+	Failures []string `json:"failures,omitempty"`
+}
+
+// Passed reports whether the preflight got a response allowing the request
+func (c CORSResult) Passed() bool {
+	return c.Error == "" && len(c.Failures) == 0
+}
+
+// HealthCheck represents the checks of the health endpoint of the target during a run, and the pauses of the load
+// while it reported unhealthy
+type HealthCheck struct {
+	URL          string  `json:"url"`
+	Checks       int     `json:"checks"`
+	FailedChecks int     `json:"failed_checks"`
+	Pauses       int     `json:"pauses"`
+	PausedMS     float64 `json:"paused_ms"`
+}
+
+// ThresholdResult represents the value of a thresholded metric of the run, or of an endpoint, against its limit
+type ThresholdResult struct {
+	Metric string `json:"metric"`
+	// Method and URL are set for the threshold of an endpoint
+	Method   string  `json:"method,omitempty"`
+	URL      string  `json:"url,omitempty"`
+	Max      float64 `json:"max"`
+	Value    float64 `json:"value"`
+	Severity string  `json:"severity"`
+	Breached bool    `json:"breached"`
+}
+
+// Traffic represents the bytes transferred over all connections of a probe run, including headers and TLS
+type Traffic struct {
+	BytesSent     int64   `json:"bytes_sent"`
+	BytesReceived int64   `json:"bytes_received"`
+	EgressKbps    float64 `json:"egress_kbps"`
+	IngressKbps   float64 `json:"ingress_kbps"`
+	// LimitKbps is the configured egress bandwidth limit, 0 when unlimited
+	LimitKbps   int     `json:"limit_kbps,omitempty"`
+	EgressMBps  float64 `json:"egress_mbps"`
+	IngressMBps float64 `json:"ingress_mbps"`
+}
+
+// Adaptive represents the outcome of the adaptive concurrency mode
+type Adaptive struct {
+	TargetLatencyMS int `json:"target_latency_ms"`
+	// SustainedConcurrency is the highest concurrency that completed a full window of requests within the target
+	SustainedConcurrency int `json:"sustained_concurrency"`
+	FinalConcurrency     int `json:"final_concurrency"`
+	MaxConcurrency       int `json:"max_concurrency"`
+	Decreases            int `json:"decreases"`
+}
+
+// Backpressure represents how the cap on the in-flight requests followed the 429 and 503 responses of the target
+type Backpressure struct {
+	MaxInFlight   int `json:"max_in_flight"`
+	FinalInFlight int `json:"final_in_flight"`
+	// MinInFlight is the lowest the cap was lowered to during the run
+	MinInFlight        int `json:"min_in_flight"`
+	ThrottledResponses int `json:"throttled_responses"`
+	Decreases          int `json:"decreases"`
+	// PausedMS is the time all requests were held for the Retry-After of throttled responses
+	PausedMS float64 `json:"paused_ms,omitempty"`
+}
+
+// Summary represents the outcome of a probe run in a compact form
+type Summary struct {
+	StartedAt          time.Time `json:"started_at"`
+	DurationMS         float64   `json:"duration_ms"`
+	TotalRequests      int       `json:"total_requests"`
+	SuccessfulRequests int       `json:"successful_requests"`
+	FailedRequests     int       `json:"failed_requests"`
+	ErrorRate          float64   `json:"error_rate"`
+	AvgMS              float64   `json:"avg_ms"`
+	P50MS              float64   `json:"p50_ms"`
+	P99MS              float64   `json:"p99_ms"`
+	// Errors counts the failed requests per category
+	Errors map[string]int `json:"errors,omitempty"`
+}
+
+// EndpointReport represents the results of a single endpoint in a probe run
+type EndpointReport struct {
+	Method             string      `json:"method"`
+	URL                string      `json:"url"`
+	Owner              string      `json:"owner,omitempty"`
+	SuccessfulRequests int         `json:"successful_requests"`
+	FailedRequests     int         `json:"failed_requests"`
+	SLABreaches        int         `json:"sla_breaches,omitempty"`
+	Latency            Latency     `json:"latency"`
+	Compression        Compression `json:"compression"`
+	// DialFailures counts the failed connection attempts per address family (tcp4, tcp6)
+	DialFailures map[string]int `json:"dial_failures,omitempty"`
+	// Scenario and Step are set for the steps of a scenario
+	Scenario string `json:"scenario,omitempty"`
+	Step     string `json:"step,omitempty"`
+	// SkippedRequests counts the scenario steps not sent because an earlier step of the iteration failed
+	SkippedRequests int `json:"skipped_requests,omitempty"`
+	// ShedRequests counts the requests of a bulk priority endpoint not sent since the concurrency limit was exhausted
+	ShedRequests int `json:"shed_requests,omitempty"`
+	// Phases breaks the response times of the successful requests down into the phases of the request
+	Phases Phases `json:"phases"`
+	// Errors counts the failed requests per category
+	Errors map[string]int `json:"errors,omitempty"`
+	// Transfer is the size of the request and response bodies of the successful requests
+	Transfer Transfer `json:"transfer"`
+	// Service is set for the instances of a registry service, each instance being reported as its own endpoint
+	Service string `json:"service,omitempty"`
+	// Reuse is the connection reuse and TLS session resumption, set when reuse_connections is enabled
+	Reuse *Reuse `json:"reuse,omitempty"`
+	// Backoff is the time the endpoint was paused for Retry-After headers, set when it was paused at least once
+	Backoff *Backoff `json:"backoff,omitempty"`
+	// HeaderBreakdown holds the response times per breakdown header and value, e.g. X-Cache HIT and MISS
+	HeaderBreakdown map[string]map[string]HeaderValue `json:"header_breakdown,omitempty"`
+	// Instance is the address of the registry instance of the service the requests were sent to
+	Instance string `json:"instance,omitempty"`
+}
+
+// HeaderValue represents the successful requests of an endpoint answered with one value of a breakdown header
+type HeaderValue struct {
+	Requests int64   `json:"requests"`
+	Latency  Latency `json:"latency"`
+}
+
+// Backoff represents the pauses of an endpoint for the Retry-After headers of its 429 and 503 responses
+type Backoff struct {
+	Pauses   int     `json:"pauses"`
+	PausedMS float64 `json:"paused_ms"`
+	// PausedShare is the share of the run duration the endpoint was paused
+	PausedShare float64 `json:"paused_share"`
+}
+
+// Reuse represents how often the successful requests of an endpoint were sent over a pooled connection, and how often
+// the TLS handshakes of their new connections resumed an earlier session instead of a full handshake
+type Reuse struct {
+	ReusedConnections   int     `json:"reused_connections"`
+	ConnectionReuseRate float64 `json:"connection_reuse_rate"`
+	TLSHandshakes       int     `json:"tls_handshakes"`
+	TLSResumptions      int     `json:"tls_resumptions"`
+	TLSResumptionRate   float64 `json:"tls_resumption_rate"`
+}
+
+// Transfer represents the body bytes of the successful requests of an endpoint. Unlike the traffic of the run it
+// excludes headers and TLS, and response bodies are counted as served, before decoding
+type Transfer struct {
+	RequestBytes     int64   `json:"request_bytes"`
+	ResponseBytes    int64   `json:"response_bytes"`
+	AvgResponseBytes float64 `json:"avg_response_bytes"`
+	// ResponseMBps is the response body throughput over the duration of the run in megabytes per second
+	ResponseMBps float64 `json:"response_mbps"`
+	// LatencyPerKB is the response time per kilobyte of response body, set when latency_per_kb is enabled for the
+	// endpoint, so a slower run with larger payloads is not mistaken for a regression
+	LatencyPerKB *Latency `json:"latency_per_kb,omitempty"`
+}
+
+// Phases represents the time the successful requests of an endpoint spent in each phase. DNS, Connect and TLS only
+// include the requests that opened a new connection, TTFB is the time from writing the request to the first
+// response byte
+type Phases struct {
+	NewConnections int     `json:"new_connections"`
+	DNS            Latency `json:"dns"`
+	Connect        Latency `json:"connect"`
+	TLS            Latency `json:"tls"`
+	TTFB           Latency `json:"ttfb"`
+	BodyRead       Latency `json:"body_read"`
+	// Decompress is the part of BodyRead spent decoding compressed responses, only recorded for those
+	Decompress Latency `json:"decompress"`
+}
+
+// ScenarioReport represents the iterations of a scenario in a probe run. An iteration succeeds when all of its
+// steps succeed, its journey duration is the sum of the response times of its steps
+type ScenarioReport struct {
+	Name                 string `json:"name"`
+	Iterations           int    `json:"iterations"`
+	SuccessfulIterations int    `json:"successful_iterations"`
+	FailedIterations     int    `json:"failed_iterations"`
+	SLAMS                int    `json:"sla_ms,omitempty"`
+	SLABreaches          int    `json:"sla_breaches,omitempty"`
+	// Latency is the journey duration distribution of the successful iterations
+	Latency Latency `json:"latency"`
+}
+
+// Compression represents how the responses of an endpoint were compressed
+type Compression struct {
+	CompressedResponses int            `json:"compressed_responses"`
+	Encodings           map[string]int `json:"encodings,omitempty"`
+	// Ratio is the decoded size divided by the size on the wire of the compressed responses
+	Ratio float64 `json:"ratio,omitempty"`
+}
+
+// Latency represents the response time distribution of the successful requests in milliseconds
+type Latency struct {
+	MinMS float64 `json:"min_ms"`
+	AvgMS float64 `json:"avg_ms"`
+	P50MS float64 `json:"p50_ms"`
+	P90MS float64 `json:"p90_ms"`
+	P95MS float64 `json:"p95_ms"`
+	P99MS float64 `json:"p99_ms"`
+	MaxMS float64 `json:"max_ms"`
+}
+
+// Summary returns the compact summary of the report
+func (r *Report) Summary() Summary {
+	var errorRate float64
+	if r.TotalRequests > 0 {
+		errorRate = float64(r.FailedRequests) / float64(r.TotalRequests)
+	}
+	return Summary{
+		StartedAt:          r.StartedAt,
+		DurationMS:         r.DurationMS,
+		TotalRequests:      r.TotalRequests,
+		SuccessfulRequests: r.SuccessfulRequests,
+		FailedRequests:     r.FailedRequests,
+		ErrorRate:          errorRate,
+		AvgMS:              r.Latency.AvgMS,
+		P50MS:              r.Latency.P50MS,
+		P99MS:              r.Latency.P99MS,
+		Errors:             r.Errors,
+	}
+}
+
+// Key returns the key used to match endpoints across runs, the instances of a service are told apart by their address
+func (e EndpointReport) Key() string {
+	if e.Scenario != "" {
+		return e.Scenario + "/" + e.Step + " " + e.Method + " " + e.URL
+	}
+	return e.Method + " " + e.URL + instanceSuffix(e.Instance)
+}
+
+// instanceSuffix returns the address of a registry instance appended to the URL of its endpoint, e.g. @10.0.0.1:8080
+func instanceSuffix(instance string) string {
+	if instance == "" {
+		return ""
+	}
+	return " @" + instance
+}
+
+// ErrorRate returns the fraction of failed requests for the endpoint
+func (e EndpointReport) ErrorRate() float64 {
+	total := e.SuccessfulRequests + e.FailedRequests
+	if total == 0 {
+		return 0
+	}
+	return float64(e.FailedRequests) / float64(total)
+}
+
+// NewLatency calculates the latency distribution for the given response times
+func NewLatency(durations []time.Duration) Latency {
+	if len(durations) == 0 {
+		return Latency{}
+	}
+
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	return Latency{
+		MinMS: toMS(sorted[0]),
+		AvgMS: toMS(total / time.Duration(len(sorted))),
+		P50MS: toMS(percentile(sorted, 50)),
+		P90MS: toMS(percentile(sorted, 90)),
+		P95MS: toMS(percentile(sorted, 95)),
+		P99MS: toMS(percentile(sorted, 99)),
+		MaxMS: toMS(sorted[len(sorted)-1]),
+	}
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// toMS converts a duration to fractional milliseconds
+func toMS(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Write writes the report as JSON to the given file
+func Write(filename string, r *Report) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating report file: %w", err)
+	}
+	defer f.Close()
+
+	return WriteJSON(f, r)
+}
+
+// WriteJSON writes the report as indented JSON
+func WriteJSON(w io.Writer, r *Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("error writing report: %w", err)
+	}
+	return nil
+}
+
+// Load reads a JSON report from the given file
+func Load(filename string) (*Report, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading report file: %w", err)
+	}
+
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("error parsing report file %s: %w", filename, err)
+	}
+	return &r, nil
+}
+
+// WriteSummary writes the summary of the report as a single line of JSON
+func WriteSummary(w io.Writer, r *Report) error {
+	if err := json.NewEncoder(w).Encode(r.Summary()); err != nil {
+		return fmt.Errorf("error writing summary: %w", err)
+	}
+	return nil
+}
+
+// WriteTable writes the totals of the report followed by its endpoints, thresholds and service level objectives as
+// plain text tables
+func WriteTable(w io.Writer, r *Report) error {
+	s := r.Summary()
+	fmt.Fprintf(w, "Run started %s, took %s: %d requests, %d failed (%.2f%%)\n\n",
+		r.StartedAt.Format(time.RFC3339), time.Duration(r.DurationMS*float64(time.Millisecond)).Round(time.Millisecond),
+		s.TotalRequests, s.FailedRequests, s.ErrorRate*100)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENDPOINT\tREQUESTS\tERROR RATE\tAVG (ms)\tP50 (ms)\tP95 (ms)\tP99 (ms)")
+	for _, e := range r.Endpoints {
+		fmt.Fprintf(tw, "%s\t%d\t%.2f%%\t%.2f\t%.2f\t%.2f\t%.2f\n",
+			e.Key(), e.SuccessfulRequests+e.FailedRequests, e.ErrorRate()*100,
+			e.Latency.AvgMS, e.Latency.P50MS, e.Latency.P95MS, e.Latency.P99MS)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(r.Thresholds) > 0 {
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "\nTHRESHOLD\tVALUE\tMAX\tSEVERITY\tBREACHED")
+		for _, t := range r.Thresholds {
+			name := t.Metric
+			if t.URL != "" {
+				name += " " + t.Method + " " + t.URL
+			}
+			fmt.Fprintf(tw, "%s\t%.4g\t%.4g\t%s\t%t\n", name, t.Value, t.Max, t.Severity, t.Breached)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(r.SLO) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w)
+	return WriteSLO(w, r.SLO)
+}
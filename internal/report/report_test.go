@@ -0,0 +1,431 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLatency(t *testing.T) {
+	var durations []time.Duration
+	for i := 100; i >= 1; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+
+	latency := NewLatency(durations)
+
+	assert.Equal(t, 1.0, latency.MinMS)
+	assert.Equal(t, 50.5, latency.AvgMS)
+	assert.Equal(t, 50.0, latency.P50MS)
+	assert.Equal(t, 90.0, latency.P90MS)
+	assert.Equal(t, 99.0, latency.P99MS)
+	assert.Equal(t, 100.0, latency.MaxMS)
+	assert.Equal(t, time.Duration(100)*time.Millisecond, durations[0], "Expected input to be left unsorted")
+}
+
+func TestNewLatencyEmpty(t *testing.T) {
+	assert.Equal(t, Latency{}, NewLatency(nil))
+}
+
+func TestHistogram(t *testing.T) {
+	var durations []time.Duration
+	var h Histogram
+	for i := 1000; i >= 1; i-- {
+		d := time.Duration(i) * 997 * time.Microsecond
+		durations = append(durations, d)
+		h.Record(d)
+	}
+
+	exact := NewLatency(durations)
+	latency := h.Latency()
+
+	assert.Equal(t, exact.MinMS, latency.MinMS)
+	assert.Equal(t, exact.MaxMS, latency.MaxMS)
+	assert.InDelta(t, exact.AvgMS, latency.AvgMS, 1e-9, "Expected the average to be exact")
+	assert.InEpsilon(t, exact.P50MS, latency.P50MS, 0.01)
+	assert.InEpsilon(t, exact.P90MS, latency.P90MS, 0.01)
+	assert.InEpsilon(t, exact.P95MS, latency.P95MS, 0.01)
+	assert.InEpsilon(t, exact.P99MS, latency.P99MS, 0.01)
+	assert.Equal(t, int64(1000), h.Count())
+}
+
+func TestHistogramMerge(t *testing.T) {
+	var a, b, merged Histogram
+	a.Record(5 * time.Millisecond)
+	a.Record(time.Millisecond)
+	b.Record(2 * time.Second)
+
+	merged.Merge(&a)
+	merged.Merge(&b)
+	merged.Merge(&Histogram{})
+
+	assert.Equal(t, int64(3), merged.Count())
+	assert.Equal(t, 1.0, merged.Latency().MinMS)
+	assert.Equal(t, 2000.0, merged.Latency().MaxMS)
+	assert.Equal(t, 2006*time.Millisecond/3, merged.Mean())
+	assert.Equal(t, Latency{}, (&Histogram{}).Latency())
+}
+
+func TestHistogramCountWithin(t *testing.T) {
+	var h Histogram
+	for _, ms := range []int{10, 20, 30, 200, 400} {
+		h.Record(time.Duration(ms) * time.Millisecond)
+	}
+	assert.Equal(t, int64(0), h.CountWithin(5*time.Millisecond))
+	assert.Equal(t, int64(3), h.CountWithin(100*time.Millisecond))
+	assert.Equal(t, int64(4), h.CountWithin(300*time.Millisecond))
+	assert.Equal(t, int64(5), h.CountWithin(time.Second))
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 255, 256, 257, 1000, 123456, 1 << 40, 1<<62 + 12345} {
+		low, high := bucketRange(bucketIndex(v))
+		assert.LessOrEqual(t, low, v)
+		assert.GreaterOrEqual(t, high, v)
+		assert.LessOrEqual(t, float64(high-low), float64(v)/histogramSubBuckets, "Expected buckets within 1%% of %d", v)
+	}
+}
+
+func TestHistogramJSON(t *testing.T) {
+	var h Histogram
+	for _, d := range []time.Duration{0, 3 * time.Microsecond, 12 * time.Millisecond, 2 * time.Second} {
+		h.Record(d)
+	}
+
+	data, err := json.Marshal(&h)
+	assert.NoError(t, err)
+	var decoded Histogram
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, h.Latency(), decoded.Latency())
+	assert.Equal(t, h.Count(), decoded.Count())
+
+	assert.ErrorContains(t, json.Unmarshal([]byte(`{"count":1,"buckets":[[100000,1]]}`), &decoded), "invalid histogram bucket")
+}
+
+func TestMerge(t *testing.T) {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	part := func(startedAt time.Time, durations []time.Duration, failed int) Part {
+		var h, journey Histogram
+		for _, d := range durations {
+			h.Record(d)
+			journey.Record(2 * d)
+		}
+		return Part{
+			Report: &Report{
+				StartedAt: startedAt, DurationMS: float64(len(durations)) * 100,
+				SuccessfulRequests: len(durations), FailedRequests: failed,
+				Traffic: Traffic{BytesSent: 100, EgressKbps: 10},
+				Errors:  map[string]int{"timeout": failed},
+				Endpoints: []EndpointReport{{
+					Method: "GET", URL: "https://api.example.com/items",
+					SuccessfulRequests: len(durations), FailedRequests: failed, Latency: h.Latency(),
+					Errors:   map[string]int{"timeout": failed},
+					Transfer: Transfer{ResponseBytes: int64(len(durations)) * 1000},
+				}},
+				Scenarios: []ScenarioReport{{Name: "checkout", Iterations: len(durations), SuccessfulIterations: len(durations)}},
+			},
+			Latencies: []*Histogram{&h},
+			Journeys:  []*Histogram{&journey},
+		}
+	}
+
+	merged := Merge([]Part{
+		part(start.Add(time.Second), []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}, 1),
+		part(start, []time.Duration{30 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond}, 2),
+	})
+
+	assert.Equal(t, start, merged.StartedAt)
+	assert.Equal(t, 300.0, merged.DurationMS)
+	assert.Equal(t, 8, merged.TotalRequests)
+	assert.Equal(t, 5, merged.SuccessfulRequests)
+	assert.Equal(t, Traffic{BytesSent: 200, EgressKbps: 20}, merged.Traffic)
+	assert.Equal(t, map[string]int{"timeout": 3}, merged.Errors)
+
+	assert.Len(t, merged.Endpoints, 1)
+	e := merged.Endpoints[0]
+	assert.Equal(t, 5, e.SuccessfulRequests)
+	assert.Equal(t, 3, e.FailedRequests)
+	assert.Equal(t, map[string]int{"timeout": 3}, e.Errors)
+	assert.Equal(t, 1000.0, e.Transfer.AvgResponseBytes)
+	assert.InDelta(t, 10, e.Latency.MinMS, 0.1)
+	assert.InDelta(t, 30, e.Latency.P50MS, 0.3, "Expected the percentiles of the merged histograms")
+	assert.InDelta(t, 50, e.Latency.MaxMS, 0.5)
+	assert.Equal(t, e.Latency, merged.Latency)
+
+	assert.Len(t, merged.Scenarios, 1)
+	assert.Equal(t, 5, merged.Scenarios[0].Iterations)
+	assert.InDelta(t, 60, merged.Scenarios[0].Latency.P50MS, 0.6)
+}
+
+func TestWeightedLatency(t *testing.T) {
+	a := Latency{MinMS: 1, AvgMS: 10, P50MS: 10, P99MS: 20, MaxMS: 30}
+	b := Latency{MinMS: 2, AvgMS: 20, P50MS: 20, P99MS: 40, MaxMS: 50}
+	assert.Equal(t, Latency{MinMS: 1, AvgMS: 17.5, P50MS: 17.5, P99MS: 35, MaxMS: 50}, weightedLatency(a, b, 1, 3))
+	assert.Equal(t, a, weightedLatency(a, b, 1, 0))
+	assert.Equal(t, b, weightedLatency(a, b, 0, 3))
+}
+
+func TestWriteAndLoad(t *testing.T) {
+	r := &Report{
+		StartedAt:          time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		DurationMS:         1234.5,
+		TotalRequests:      3,
+		SuccessfulRequests: 2,
+		FailedRequests:     1,
+		Endpoints: []EndpointReport{
+			{Method: "GET", URL: "https://api.example.com", SuccessfulRequests: 2, FailedRequests: 1, Latency: Latency{P50MS: 12}},
+		},
+	}
+
+	filename := filepath.Join(t.TempDir(), "run.json")
+	assert.NoError(t, Write(filename, r))
+
+	loaded, err := Load(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, r, loaded)
+}
+
+func TestCompare(t *testing.T) {
+	before := &Report{Endpoints: []EndpointReport{
+		{Method: "GET", URL: "https://api.example.com/a", SuccessfulRequests: 9, FailedRequests: 1, Latency: Latency{P50MS: 10, P99MS: 20, MaxMS: 30}},
+		{Method: "GET", URL: "https://api.example.com/removed", Latency: Latency{P50MS: 5}},
+	}}
+	after := &Report{Endpoints: []EndpointReport{
+		{Method: "GET", URL: "https://api.example.com/a", SuccessfulRequests: 10, Latency: Latency{P50MS: 15, P99MS: 40, MaxMS: 50}},
+		{Method: "POST", URL: "https://api.example.com/a", Latency: Latency{P50MS: 7}},
+	}}
+
+	diff := Compare(before, after)
+
+	assert.Len(t, diff.Endpoints, 3)
+	assert.Equal(t, "GET https://api.example.com/a", diff.Endpoints[0].Key)
+	assert.NotNil(t, diff.Endpoints[0].Before)
+	assert.NotNil(t, diff.Endpoints[0].After)
+	assert.Nil(t, diff.Endpoints[1].After, "Expected removed endpoint to have no after report")
+	assert.Nil(t, diff.Endpoints[2].Before, "Expected new endpoint to have no before report")
+	assert.Equal(t, 0.1, diff.Endpoints[0].Before.ErrorRate())
+	assert.Equal(t, 50.0, Change(diff.Endpoints[0].Before.Latency.P50MS, diff.Endpoints[0].After.Latency.P50MS))
+
+	var text bytes.Buffer
+	assert.NoError(t, WriteText(&text, diff))
+	assert.Contains(t, text.String(), "+50.0%")
+	assert.Contains(t, text.String(), "removed")
+
+	var html bytes.Buffer
+	assert.NoError(t, WriteHTML(&html, diff))
+	assert.Contains(t, html.String(), "GET https://api.example.com/a")
+	assert.Contains(t, html.String(), "Endpoint was not probed in the first run")
+	assert.Contains(t, html.String(), `<span class="worse">&#43;100.0%</span>`)
+}
+
+func TestRegressions(t *testing.T) {
+	before := &Report{DurationMS: 10000, Endpoints: []EndpointReport{
+		{Method: "GET", URL: "https://api.example.com/a", SuccessfulRequests: 100, Latency: Latency{P50MS: 10, P99MS: 20}},
+		{Method: "GET", URL: "https://api.example.com/removed", SuccessfulRequests: 10, Latency: Latency{P50MS: 5}},
+	}}
+	after := &Report{DurationMS: 10000, Endpoints: []EndpointReport{
+		{Method: "GET", URL: "https://api.example.com/a", SuccessfulRequests: 76, FailedRequests: 4, Latency: Latency{P50MS: 12, P99MS: 30}},
+		{Method: "POST", URL: "https://api.example.com/new", Latency: Latency{P50MS: 500}},
+	}}
+	tolerance := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name       string
+		tolerances Tolerances
+		expected   []string
+	}{
+		{name: "Unchecked"},
+		{name: "Within Tolerances", tolerances: Tolerances{P50Increase: tolerance(20), P99Increase: tolerance(50), ErrorRateIncrease: tolerance(5), ThroughputDecrease: tolerance(20)}},
+		{name: "P99", tolerances: Tolerances{P50Increase: tolerance(25), P99Increase: tolerance(20)}, expected: []string{MetricP99}},
+		{name: "Error Rate And Throughput", tolerances: Tolerances{ErrorRateIncrease: tolerance(1), ThroughputDecrease: tolerance(10)}, expected: []string{MetricErrorRate, MetricThroughput}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var metrics []string
+			for _, r := range Compare(before, after).Regressions(tc.tolerances) {
+				assert.Equal(t, "GET https://api.example.com/a", r.Key, "Expected new and removed endpoints not to regress")
+				metrics = append(metrics, r.Metric)
+			}
+			assert.Equal(t, tc.expected, metrics)
+		})
+	}
+
+	regressions := Compare(before, after).Regressions(Tolerances{ErrorRateIncrease: tolerance(1), ThroughputDecrease: tolerance(10)})
+	assert.Equal(t, 5.0, regressions[0].Change)
+	assert.Equal(t, 20.0, regressions[1].Change)
+
+	var text bytes.Buffer
+	assert.NoError(t, WriteRegressions(&text, regressions))
+	assert.Contains(t, text.String(), "+5.0 pp")
+	assert.Contains(t, text.String(), "-20.0%")
+	text.Reset()
+	assert.NoError(t, WriteRegressions(&text, nil))
+	assert.Contains(t, text.String(), "No regressions")
+}
+
+func TestWriteTextLatencyPerKB(t *testing.T) {
+	before := &Report{Endpoints: []EndpointReport{
+		{Method: "GET", URL: "https://api.example.com/export", Latency: Latency{P50MS: 100},
+			Transfer: Transfer{AvgResponseBytes: 100 * 1024, LatencyPerKB: &Latency{P50MS: 1}}},
+		{Method: "GET", URL: "https://api.example.com/items", Latency: Latency{P50MS: 10}},
+	}}
+	after := &Report{Endpoints: []EndpointReport{
+		{Method: "GET", URL: "https://api.example.com/export", Latency: Latency{P50MS: 200},
+			Transfer: Transfer{AvgResponseBytes: 250 * 1024, LatencyPerKB: &Latency{P50MS: 0.8}}},
+		{Method: "GET", URL: "https://api.example.com/items", Latency: Latency{P50MS: 10}},
+	}}
+
+	var text bytes.Buffer
+	assert.NoError(t, WriteText(&text, Compare(before, after)))
+
+	assert.Contains(t, text.String(), "P50 PER KB (ms)")
+	assert.Contains(t, text.String(), "1.000 → 0.800")
+	assert.Contains(t, text.String(), "100.0 → 250.0")
+	assert.Contains(t, text.String(), "-20.0%", "Expected the normalized latency to improve while the raw latency doubled")
+	assert.NotContains(t, text.String(), "items  0.", "Expected endpoints without normalized latency to be left out")
+
+	text.Reset()
+	assert.NoError(t, WriteText(&text, Compare(&Report{}, &Report{})))
+	assert.NotContains(t, text.String(), "PER KB")
+}
+
+func TestWriteSummary(t *testing.T) {
+	r := &Report{
+		TotalRequests:      4,
+		SuccessfulRequests: 3,
+		FailedRequests:     1,
+		Latency:            Latency{AvgMS: 12.5, P50MS: 10, P99MS: 30},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteSummary(&buf, r))
+
+	out := buf.String()
+	assert.Equal(t, 1, strings.Count(out, "\n"), "Expected a single line of JSON")
+	assert.Contains(t, out, `"total_requests":4`)
+	assert.Contains(t, out, `"error_rate":0.25`)
+	assert.Contains(t, out, `"p99_ms":30`)
+}
+
+func TestWriteBenchmark(t *testing.T) {
+	r := &Report{
+		Endpoints: []EndpointReport{
+			{
+				Method:             "GET",
+				URL:                "https://api.example.com/v1-2/items?limit=10",
+				SuccessfulRequests: 3,
+				FailedRequests:     1,
+				Latency:            Latency{AvgMS: 12.5, P50MS: 10, P95MS: 25, P99MS: 30},
+				Transfer:           Transfer{AvgResponseBytes: 512},
+			},
+			{Method: "POST", URL: "https://api.example.com/orders", Scenario: "checkout", Step: "create order", SuccessfulRequests: 2, Latency: Latency{AvgMS: 1}},
+			{Method: "DELETE", URL: "https://api.example.com/orders", FailedRequests: 2},
+		},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteBenchmark(&buf, r))
+
+	assert.Equal(t,
+		"BenchmarkGET_api.example.com_v1_2_items_limit_10\t3\t12500000 ns/op\t10000000 p50-ns\t25000000 p95-ns\t30000000 p99-ns\t512 B/op\t0.2500 errors/op\n"+
+			"BenchmarkScenario_checkout/create_order/POST_api.example.com_orders\t2\t1000000 ns/op\t0 p50-ns\t0 p95-ns\t0 p99-ns\t0 B/op\t0.0000 errors/op\n",
+		buf.String())
+}
+
+func TestWriteTable(t *testing.T) {
+	r := &Report{
+		StartedAt:          time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC),
+		DurationMS:         1500,
+		TotalRequests:      4,
+		SuccessfulRequests: 3,
+		FailedRequests:     1,
+		Endpoints: []EndpointReport{
+			{Method: "GET", URL: "https://api.example.com/items", SuccessfulRequests: 3, FailedRequests: 1, Latency: Latency{AvgMS: 12.5, P99MS: 30}},
+		},
+		Thresholds: []ThresholdResult{{Metric: "p95_ms", Max: 250, Value: 300, Severity: "fail", Breached: true}},
+		SLO:        []SLOResult{NewSLOResult(SLOAvailability, 99, 0, 4, 3)},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteTable(&buf, r))
+
+	out := buf.String()
+	assert.Contains(t, out, "Run started 2026-10-15T09:00:00Z, took 1.5s: 4 requests, 1 failed (25.00%)")
+	assert.Contains(t, out, "GET https://api.example.com/items  4         25.00%")
+	assert.Contains(t, out, "p95_ms     300    250  fail      true")
+	assert.Contains(t, out, "availability  99%     75.000%     4         25.00      -2400.0%     false")
+}
+
+func TestNewSLOResult(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    float64
+		total     int64
+		good      int64
+		met       bool
+		burnRate  float64
+		remaining float64
+	}{
+		{name: "No Requests", target: 99, met: true, remaining: 100},
+		{name: "All Good", target: 99, total: 1000, good: 1000, met: true, remaining: 100},
+		{name: "Half Budget", target: 99, total: 1000, good: 995, met: true, burnRate: 0.5, remaining: 50},
+		{name: "Budget Spent", target: 99, total: 1000, good: 980, burnRate: 2, remaining: -100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := NewSLOResult(SLOAvailability, tt.target, 0, tt.total, tt.good)
+			assert.Equal(t, tt.met, result.Met)
+			assert.InDelta(t, tt.burnRate, result.BurnRate, 1e-9)
+			assert.InDelta(t, tt.remaining, result.BudgetRemaining, 1e-9)
+		})
+	}
+}
+
+func TestSweepResultFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		result SweepResult
+		failed bool
+	}{
+		{"allowed", SweepResult{Method: "POST", HeadStatus: 200, OptionsStatus: 204, Allow: []string{"GET", "POST"}}, false},
+		{"allowed by CORS", SweepResult{Method: "PUT", HeadStatus: 405, OptionsStatus: 204, AllowMethods: []string{"put"}}, false},
+		{"wildcard", SweepResult{Method: "DELETE", HeadStatus: 200, OptionsStatus: 204, AllowMethods: []string{"*"}}, false},
+		{"no allow headers", SweepResult{Method: "GET", HeadStatus: 200, OptionsStatus: 405}, false},
+		{"not allowed", SweepResult{Method: "DELETE", HeadStatus: 200, OptionsStatus: 204, Allow: []string{"GET"}}, true},
+		{"not routed", SweepResult{Method: "GET", HeadStatus: 404, OptionsStatus: 404}, true},
+		{"unreachable", SweepResult{Method: "GET", HeadError: "refused", OptionsError: "refused"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.failed, tt.result.Failed())
+		})
+	}
+}
+
+func TestWriteSweep(t *testing.T) {
+	results := []SweepResult{
+		{Method: "GET", URL: "http://localhost/users", HeadStatus: 200, OptionsStatus: 204, Allow: []string{"GET", "HEAD"},
+			AllowOrigin: "*", AllowMethods: []string{"GET"}},
+		{Method: "DELETE", URL: "http://localhost/users", HeadStatus: 200, OptionsStatus: 204, Allow: []string{"GET", "HEAD"}},
+		{Method: "GET", URL: "http://localhost/down", HeadError: "refused", OptionsError: "refused"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteSweep(&buf, results))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(t, lines, 4) {
+		assert.Equal(t, []string{"ENDPOINT", "HEAD", "OPTIONS", "ALLOW", "METHOD", "CORS", "ORIGIN", "CORS", "METHODS", "RESULT"}, strings.Fields(lines[0]))
+		assert.Equal(t, []string{"GET", "http://localhost/users", "200", "204", "GET,HEAD", "allowed", "*", "GET", "ok"}, strings.Fields(lines[1]))
+		assert.Equal(t, []string{"DELETE", "http://localhost/users", "200", "204", "GET,HEAD", "not", "allowed", "-", "-", "fail"}, strings.Fields(lines[2]))
+		assert.Equal(t, []string{"GET", "http://localhost/down", "error", "error", "-", "-", "-", "-", "fail"}, strings.Fields(lines[3]))
+	}
+	assert.True(t, SweepFailed(results))
+	assert.False(t, SweepFailed(results[:1]))
+}
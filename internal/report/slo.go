@@ -0,0 +1,76 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// service level objectives
+const (
+	SLOAvailability = "availability"
+	SLOLatency      = "latency"
+)
+
+// SLOResult represents the compliance of a run, or of the runs in the history, with a service level objective and
+// how much of its error budget was burned
+type SLOResult struct {
+	Objective string `json:"objective"`
+	// Target is the share of good requests the objective requires in percent
+	Target float64 `json:"target"`
+	// ThresholdMS is the response time a request must be within to be good for the latency objective
+	ThresholdMS int `json:"threshold_ms,omitempty"`
+	// TotalRequests are the requests the objective covers, all requests for availability and the successful ones
+	// for latency
+	TotalRequests int64 `json:"total_requests"`
+	GoodRequests  int64 `json:"good_requests"`
+	// Compliance is the share of good requests in percent
+	Compliance float64 `json:"compliance"`
+	Met        bool    `json:"met"`
+	// BurnRate is the share of bad requests relative to the error budget, above 1 the budget is exhausted
+	BurnRate float64 `json:"burn_rate"`
+	// BudgetRemaining is the part of the error budget left in percent, negative when it was overspent
+	BudgetRemaining float64 `json:"budget_remaining"`
+}
+
+// NewSLOResult calculates the compliance and the error budget burn of the good requests of total against the target
+func NewSLOResult(objective string, target float64, thresholdMS int, total, good int64) SLOResult {
+	result := SLOResult{
+		Objective:       objective,
+		Target:          target,
+		ThresholdMS:     thresholdMS,
+		TotalRequests:   total,
+		GoodRequests:    good,
+		Compliance:      100,
+		Met:             true,
+		BudgetRemaining: 100,
+	}
+	if total == 0 {
+		return result
+	}
+	bad := float64(total-good) / float64(total)
+	result.Compliance = (1 - bad) * 100
+	result.Met = result.Compliance >= target
+	result.BurnRate = bad / (1 - target/100)
+	result.BudgetRemaining = (1 - result.BurnRate) * 100
+	return result
+}
+
+// Name returns the objective with its threshold, e.g. latency < 300ms
+func (s SLOResult) Name() string {
+	if s.ThresholdMS > 0 {
+		return fmt.Sprintf("%s < %dms", s.Objective, s.ThresholdMS)
+	}
+	return s.Objective
+}
+
+// WriteSLO writes the compliance and error budget of the objectives as a plain text table
+func WriteSLO(w io.Writer, results []SLOResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OBJECTIVE\tTARGET\tCOMPLIANCE\tREQUESTS\tBURN RATE\tBUDGET LEFT\tMET")
+	for _, s := range results {
+		fmt.Fprintf(tw, "%s\t%.4g%%\t%.3f%%\t%d\t%.2f\t%.1f%%\t%t\n",
+			s.Name(), s.Target, s.Compliance, s.TotalRequests, s.BurnRate, s.BudgetRemaining, s.Met)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,108 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// SweepResult represents the HEAD and OPTIONS responses of an endpoint in a sweep, which checks the routing, the
+// allowed methods and the CORS headers of the endpoints without load
+type SweepResult struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// HeadStatus and OptionsStatus are the status codes of the responses, 0 when the request failed with the error
+	HeadStatus    int    `json:"head_status"`
+	HeadError     string `json:"head_error,omitempty"`
+	OptionsStatus int    `json:"options_status"`
+	OptionsError  string `json:"options_error,omitempty"`
+	// Allow lists the methods of the Allow header of the OPTIONS response
+	Allow []string `json:"allow,omitempty"`
+	// AllowOrigin, AllowMethods and AllowHeaders are the CORS headers of the OPTIONS response
+	AllowOrigin  string   `json:"allow_origin,omitempty"`
+	AllowMethods []string `json:"allow_methods,omitempty"`
+	AllowHeaders []string `json:"allow_headers,omitempty"`
+	// Instance is the address of the registry instance the requests were sent to
+	Instance string `json:"instance,omitempty"`
+}
+
+// MethodAllowed reports whether the method of the endpoint is listed in the Allow or the CORS allow methods header,
+// ok is false when the response has neither
+func (s SweepResult) MethodAllowed() (allowed, ok bool) {
+	if len(s.Allow) == 0 && len(s.AllowMethods) == 0 {
+		return false, false
+	}
+	contains := func(methods []string) bool {
+		return slices.ContainsFunc(methods, func(m string) bool { return m == "*" || strings.EqualFold(m, s.Method) })
+	}
+	return contains(s.Allow) || contains(s.AllowMethods), true
+}
+
+// Failed reports whether the sweep found a problem with the endpoint: neither request got a response, HEAD was not
+// routed, or the endpoint method is not allowed
+func (s SweepResult) Failed() bool {
+	if s.HeadError != "" && s.OptionsError != "" {
+		return true
+	}
+	if s.HeadStatus == http.StatusNotFound {
+		return true
+	}
+	allowed, ok := s.MethodAllowed()
+	return ok && !allowed
+}
+
+// SweepFailed reports whether the sweep found a problem with any endpoint
+func SweepFailed(results []SweepResult) bool {
+	return slices.ContainsFunc(results, SweepResult.Failed)
+}
+
+// WriteSweep writes the sweep results as a matrix with a row per endpoint
+func WriteSweep(w io.Writer, results []SweepResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENDPOINT\tHEAD\tOPTIONS\tALLOW\tMETHOD\tCORS ORIGIN\tCORS METHODS\tRESULT")
+	for _, s := range results {
+		method := "-"
+		if allowed, ok := s.MethodAllowed(); ok {
+			method = map[bool]string{true: "allowed", false: "not allowed"}[allowed]
+		}
+		result := "ok"
+		if s.Failed() {
+			result = "fail"
+		}
+		fmt.Fprintf(tw, "%s %s%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Method, s.URL, instanceSuffix(s.Instance),
+			sweepStatus(s.HeadStatus, s.HeadError),
+			sweepStatus(s.OptionsStatus, s.OptionsError),
+			sweepList(s.Allow),
+			method,
+			orDash(s.AllowOrigin),
+			sweepList(s.AllowMethods),
+			result)
+	}
+	return tw.Flush()
+}
+
+// sweepStatus returns the status code of a sweep request, or error when it failed
+func sweepStatus(status int, err string) string {
+	if err != "" {
+		return "error"
+	}
+	return strconv.Itoa(status)
+}
+
+// sweepList returns the comma separated values, a dash when there are none
+func sweepList(values []string) string {
+	return orDash(strings.Join(values, ","))
+}
+
+// orDash returns the value, a dash when it is empty
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
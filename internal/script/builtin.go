@@ -0,0 +1,181 @@
+package script
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dasvh/enchante/internal/jsonpath"
+	"github.com/expr-lang/expr"
+)
+
+// exprEnv is the environment the expressions run in, the values of the request and response and the functions that
+// read and change them, bound to the Env of the run
+type exprEnv struct {
+	Method       string  `expr:"method"`
+	URL          string  `expr:"url"`
+	Body         string  `expr:"body"`
+	Status       int     `expr:"status"`
+	ResponseBody string  `expr:"response_body"`
+	DurationMS   float64 `expr:"duration_ms"`
+
+	Header         func(name string) string                   `expr:"header"`
+	ResponseHeader func(name string) string                   `expr:"response_header"`
+	Var            func(name string) string                   `expr:"var"`
+	SetVar         func(name string, value any) any           `expr:"set_var"`
+	SetHeader      func(name string, value any) any           `expr:"set_header"`
+	RemoveHeader   func(name string) bool                     `expr:"remove_header"`
+	SetBody        func(value any) any                        `expr:"set_body"`
+	JSON           func(path string) (any, error)             `expr:"json"`
+	Assert         func(condition, message any) (bool, error) `expr:"assert"`
+	Fail           func(message any) (bool, error)            `expr:"fail"`
+}
+
+// phases are the names only available in one phase, the others are available in both
+var phases = map[string]Phase{
+	"status":          PostResponse,
+	"response_body":   PostResponse,
+	"duration_ms":     PostResponse,
+	"response_header": PostResponse,
+	"json":            PostResponse,
+	"assert":          PostResponse,
+	"fail":            PostResponse,
+	"set_header":      PreRequest,
+	"remove_header":   PreRequest,
+	"set_body":        PreRequest,
+}
+
+// newExprEnv returns the environment of the expressions bound to env
+func newExprEnv(env *Env) *exprEnv {
+	e := &exprEnv{
+		Method:       env.Method,
+		URL:          env.URL,
+		Body:         env.Body,
+		Status:       env.Status,
+		ResponseBody: string(env.ResponseBody),
+		DurationMS:   float64(env.Duration) / float64(time.Millisecond),
+
+		Header:         env.header,
+		ResponseHeader: env.ResponseHeader.Get,
+		Var:            env.variable,
+		SetVar: func(name string, value any) any {
+			env.setVariable(name, toString(value))
+			return value
+		},
+		SetHeader: func(name string, value any) any {
+			env.setHeader(name, toString(value))
+			return value
+		},
+		RemoveHeader: func(name string) bool {
+			env.removeHeader(name)
+			return true
+		},
+		JSON: func(path string) (any, error) {
+			value, err := env.json(path)
+			if err != nil {
+				return nil, fmt.Errorf("json: %w", err)
+			}
+			return value, nil
+		},
+		Assert: func(condition, message any) (bool, error) {
+			if !truthy(condition) {
+				return false, errors.New(toString(message))
+			}
+			return true, nil
+		},
+		Fail: func(message any) (bool, error) {
+			return false, errors.New(toString(message))
+		},
+	}
+	e.SetBody = func(value any) any {
+		env.Body = toString(value)
+		e.Body = env.Body
+		return value
+	}
+	return e
+}
+
+// functions are the built-in functions that do not depend on the request, next to the ones of expr like len, lower,
+// upper, trim and replace. now and string replace the ones of expr
+var functions = []expr.Option{
+	expr.Function("env", func(params ...any) (any, error) {
+		return os.Getenv(params[0].(string)), nil
+	}, new(func(string) string)),
+	expr.Function("string", func(params ...any) (any, error) {
+		return toString(params[0]), nil
+	}, new(func(any) string)),
+	expr.Function("number", func(params ...any) (any, error) {
+		n, ok := toNumber(params[0])
+		if !ok {
+			return nil, fmt.Errorf("number: %q is not a number", toString(params[0]))
+		}
+		return n, nil
+	}, new(func(any) float64)),
+	expr.Function("starts_with", func(params ...any) (any, error) {
+		return strings.HasPrefix(params[0].(string), params[1].(string)), nil
+	}, new(func(string, string) bool)),
+	expr.Function("ends_with", func(params ...any) (any, error) {
+		return strings.HasSuffix(params[0].(string), params[1].(string)), nil
+	}, new(func(string, string) bool)),
+	expr.Function("sha256", func(params ...any) (any, error) {
+		sum := sha256.Sum256([]byte(params[0].(string)))
+		return hex.EncodeToString(sum[:]), nil
+	}, new(func(string) string)),
+	expr.Function("hmac_sha256", func(params ...any) (any, error) {
+		mac := hmac.New(sha256.New, []byte(params[0].(string)))
+		mac.Write([]byte(params[1].(string)))
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	}, new(func(string, string) string)),
+	expr.Function("base64", func(params ...any) (any, error) {
+		return base64.StdEncoding.EncodeToString([]byte(params[0].(string))), nil
+	}, new(func(string) string)),
+	expr.Function("now", func(...any) (any, error) {
+		return int(time.Now().Unix()), nil
+	}, new(func() int)),
+	expr.Function("now_ms", func(...any) (any, error) {
+		return int(time.Now().UnixMilli()), nil
+	}, new(func() int)),
+	expr.Function("uuid", func(...any) (any, error) {
+		return newUUID(), nil
+	}, new(func() string)),
+}
+
+// json returns the value at the path of the JSON response body, objects and arrays encoded as JSON and null as an
+// empty string
+func (e *Env) json(path string) (any, error) {
+	doc, err := e.document()
+	if err != nil {
+		return nil, err
+	}
+	value, err := jsonpath.Lookup(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	switch value.(type) {
+	case string, float64, bool:
+		return value, nil
+	case nil:
+		return "", nil
+	default:
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	}
+}
+
+// newUUID returns a random version 4 UUID, e.g. for idempotency keys
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
@@ -0,0 +1,269 @@
+// Package script runs the pre_request and post_response hooks of endpoints. A hook is a list of expressions of the
+// expr language (github.com/expr-lang/expr) with built-in functions, which read the request and response and change
+// the request, set variables or fail the request
+package script
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Phase is when a hook runs, it decides which identifiers and functions are available
+type Phase int
+
+// hook phases
+const (
+	// PreRequest runs before the request is sent and can change its headers and body
+	PreRequest Phase = iota + 1
+	// PostResponse runs after a successful response and can fail the request
+	PostResponse
+)
+
+// String returns the config key of the phase
+func (p Phase) String() string {
+	switch p {
+	case PreRequest:
+		return "pre_request"
+	case PostResponse:
+		return "post_response"
+	default:
+		return "unknown"
+	}
+}
+
+// Env is the request and response a hook runs against, the changes of a pre_request hook are made to it
+type Env struct {
+	Method string
+	URL    string
+	Body   string
+	// Header holds the request headers
+	Header map[string]string
+	// Vars are the variables the var function reads, they are not changed by the hook
+	Vars map[string]string
+	// SetVars holds the variables set with set_var
+	SetVars map[string]string
+
+	// Status, ResponseHeader, ResponseBody and Duration describe the response of a post_response hook
+	Status         int
+	ResponseHeader http.Header
+	ResponseBody   []byte
+	Duration       time.Duration
+
+	// doc is the decoded response body, decoded on the first use of the json function
+	doc     any
+	decoded bool
+}
+
+// Program is a compiled hook
+type Program struct {
+	phase Phase
+	exprs []*vm.Program
+	vars  []string
+}
+
+// Compile compiles the expressions of a hook, it fails for a syntax or type error or an identifier or function that
+// is unknown or not available in the phase
+func Compile(exprs []string, phase Phase) (*Program, error) {
+	program := &Program{phase: phase}
+	for i, src := range exprs {
+		check := &phaseChecker{phase: phase}
+		options := append([]expr.Option{expr.Env(exprEnv{}), expr.Patch(check)}, functions...)
+		compiled, err := expr.Compile(src, options...)
+		if check.err != nil {
+			err = check.err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s %d: %w", phase, i+1, exprError(err))
+		}
+		program.exprs = append(program.exprs, compiled)
+		program.vars = append(program.vars, check.vars...)
+	}
+	return program, nil
+}
+
+// Variables returns the names of the variables the hook sets
+func (p *Program) Variables() []string {
+	return p.vars
+}
+
+// Run evaluates the expressions in order and stops at the first error, a failed assert or fail included
+func (p *Program) Run(env *Env) error {
+	exprEnv := newExprEnv(env)
+	for i, program := range p.exprs {
+		if _, err := expr.Run(program, exprEnv); err != nil {
+			return fmt.Errorf("%s %d: %w", p.phase, i+1, exprError(err))
+		}
+	}
+	return nil
+}
+
+// phaseChecker rejects the identifiers and functions of the other phase and collects the variables set with set_var
+type phaseChecker struct {
+	phase Phase
+	vars  []string
+	err   error
+}
+
+// Visit checks a node of the syntax tree of an expression
+func (c *phaseChecker) Visit(node *ast.Node) {
+	if c.err != nil {
+		return
+	}
+	switch n := (*node).(type) {
+	case *ast.IdentifierNode:
+		if phase, ok := phases[n.Value]; ok && phase != c.phase {
+			c.err = fmt.Errorf("%s is only available in %s", n.Value, phase)
+		}
+	case *ast.CallNode:
+		callee, ok := n.Callee.(*ast.IdentifierNode)
+		if !ok || callee.Value != "set_var" || len(n.Arguments) == 0 {
+			return
+		}
+		// the names are known before the run, so the variables can be referenced by endpoints
+		name, ok := n.Arguments[0].(*ast.StringNode)
+		if !ok {
+			c.err = errors.New("set_var requires the variable name as a string literal")
+			return
+		}
+		c.vars = append(c.vars, name.Value)
+	}
+}
+
+// exprError returns the error of a function called by an expression, e.g. the message of a failed assert, or the
+// error of expr with its position instead of the source snippet, the expression is part of the config
+func exprError(err error) error {
+	var fileErr *file.Error
+	if !errors.As(err, &fileErr) {
+		return err
+	}
+	if fileErr.Prev != nil {
+		return fileErr.Prev
+	}
+	return fmt.Errorf("%s (%d:%d)", fileErr.Message, fileErr.Line, fileErr.Column+1)
+}
+
+// header returns the value of the request header, matching its name case-insensitively
+func (e *Env) header(name string) string {
+	if value, ok := e.Header[name]; ok {
+		return value
+	}
+	for key, value := range e.Header {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// setHeader sets the request header, replacing it under any casing
+func (e *Env) setHeader(name, value string) {
+	e.removeHeader(name)
+	if e.Header == nil {
+		e.Header = make(map[string]string)
+	}
+	e.Header[name] = value
+}
+
+// removeHeader removes the request header under any casing
+func (e *Env) removeHeader(name string) {
+	for key := range e.Header {
+		if strings.EqualFold(key, name) {
+			delete(e.Header, key)
+		}
+	}
+}
+
+// variable returns the variable, the ones set by the hook first
+func (e *Env) variable(name string) string {
+	if value, ok := e.SetVars[name]; ok {
+		return value
+	}
+	return e.Vars[name]
+}
+
+// setVariable sets a variable for the var function and in SetVars
+func (e *Env) setVariable(name, value string) {
+	if e.SetVars == nil {
+		e.SetVars = make(map[string]string)
+	}
+	e.SetVars[name] = value
+}
+
+// document returns the decoded JSON response body
+func (e *Env) document() (any, error) {
+	if !e.decoded {
+		if err := json.Unmarshal(e.ResponseBody, &e.doc); err != nil {
+			return nil, fmt.Errorf("response body is not JSON: %w", err)
+		}
+		e.decoded = true
+	}
+	return e.doc, nil
+}
+
+// toString formats a value as a string, numbers without trailing zeros
+func toString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// toNumber converts a number, a numeric string or a boolean to a number
+func toNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// truthy reports whether a value counts as true, a non-empty string and a non-zero number do
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	case int:
+		return v != 0
+	case int64:
+		return v != 0
+	default:
+		return v != nil
+	}
+}
@@ -0,0 +1,148 @@
+package script
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEval(t *testing.T) {
+	env := func() *Env {
+		return &Env{
+			Method:         "POST",
+			URL:            "https://api.example.com/orders",
+			Body:           `{"id":42}`,
+			Header:         map[string]string{"X-Tenant": "acme"},
+			Vars:           map[string]string{"token": "abc"},
+			Status:         201,
+			ResponseHeader: http.Header{"Content-Type": {"application/json"}},
+			ResponseBody:   []byte(`{"order":{"id":42,"state":"paid","items":[1,2]}}`),
+			Duration:       120 * time.Millisecond,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		expr   string
+		expect any
+	}{
+		{name: "Arithmetic Precedence", expr: "1 + 2 * 3 - 4 / 2", expect: 5.0},
+		{name: "Parentheses", expr: "(1 + 2) * 3 % 4", expect: 1},
+		{name: "Concatenation", expr: "method + ' ' + url", expect: "POST https://api.example.com/orders"},
+		{name: "Number Concatenation", expr: "'v' + string(2) + string(1.5)", expect: "v21.5"},
+		{name: "Numeric Comparison", expr: "status >= 200 && status < 300", expect: true},
+		{name: "JSON Number", expr: "json('$.order.id') == 42 && string(json('$.order.id')) == '42'", expect: true},
+		{name: "String Comparison", expr: "json('$.order.state') != 'pending'", expect: true},
+		{name: "Negation", expr: "!(body contains 'id') || -duration_ms < 0", expect: true},
+		{name: "Case Insensitive Header", expr: "header('x-tenant')", expect: "acme"},
+		{name: "Response Header", expr: "response_header('content-type')", expect: "application/json"},
+		{name: "JSON Array", expr: "json('$.order.items')", expect: "[1,2]"},
+		{name: "Variable", expr: "'Bearer ' + var('token')", expect: "Bearer abc"},
+		{name: "Conditional", expr: "status == 201 ? 'created' : fail('not created')", expect: "created"},
+		{name: "Functions", expr: "upper(trim(' a ')) + lower('B') + string(len('abc')) + replace('a-b', '-', '+')", expect: "Ab3a+b"},
+		{name: "Matches", expr: "url matches '/orders$' && starts_with(url, 'https') && ends_with(body, '}')", expect: true},
+		{name: "Number", expr: "number('1.5') * 2", expect: 3.0},
+		{name: "SHA256", expr: "sha256('abc')", expect: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{name: "HMAC", expr: "hmac_sha256('key', 'The quick brown fox jumps over the lazy dog')", expect: "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+		{name: "String Of Integer", expr: "string(status) + '/' + string(now() > 0)", expect: "201/true"},
+		{name: "Number Of Integer", expr: "number(status) / 2", expect: 100.5},
+		{name: "Base64", expr: "base64('user:pass')", expect: "dXNlcjpwYXNz"},
+		{name: "Escapes", expr: `"say \"hi\"\n"`, expect: "say \"hi\"\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			program, err := expr.Compile(tc.expr, append([]expr.Option{expr.Env(exprEnv{})}, functions...)...)
+			assert.NoError(t, err)
+			value, err := expr.Run(program, newExprEnv(env()))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, value)
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		expr      string
+		phase     Phase
+		expectErr string
+	}{
+		{name: "Unknown Identifier", expr: "stauts == 200", phase: PostResponse, expectErr: "unknown name stauts (1:1)"},
+		{name: "Unknown Function", expr: "sign(body)", phase: PreRequest, expectErr: "unknown name sign (1:1)"},
+		{name: "Wrong Arguments", expr: "set_header('X-Id')", phase: PreRequest, expectErr: "not enough arguments to call set_header"},
+		{name: "Wrong Type", expr: "sha256(status)", phase: PostResponse, expectErr: "cannot use int as argument (type string) to call sha256"},
+		{name: "Response In Pre Request", expr: "status == 200", phase: PreRequest, expectErr: "status is only available in post_response"},
+		{name: "Set Header In Post Response", expr: "set_header('X', '1')", phase: PostResponse, expectErr: "set_header is only available in pre_request"},
+		{name: "Variable Name Not Literal", expr: "set_var(header('X'), '1')", phase: PreRequest, expectErr: "requires the variable name as a string literal"},
+		{name: "Invalid Pattern", expr: "url matches '('", phase: PreRequest, expectErr: "error parsing regexp"},
+		{name: "Unterminated String", expr: "'abc", phase: PreRequest, expectErr: "literal not terminated"},
+		{name: "Missing Parenthesis", expr: "(1 + 2", phase: PreRequest, expectErr: "unexpected token EOF"},
+		{name: "Trailing Tokens", expr: "1 2", phase: PreRequest, expectErr: "unexpected token Number(\"2\") (1:3)"},
+		{name: "Unexpected Character", expr: "a = 1", phase: PreRequest, expectErr: "unexpected token Operator(\"=\")"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Compile([]string{"true", tc.expr}, tc.phase)
+			assert.ErrorContains(t, err, tc.phase.String()+" 2: ")
+			assert.ErrorContains(t, err, tc.expectErr)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	pre, err := Compile([]string{
+		"set_header('X-Signature', hmac_sha256(var('secret'), method + url + body))",
+		"remove_header('x-debug')",
+		"set_body(replace(body, '${id}', '7'))",
+		"set_var('signed', 'yes')",
+		"set_header('X-Signed', var('signed'))",
+	}, PreRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"signed"}, pre.Variables())
+
+	env := &Env{
+		Method: "PUT",
+		URL:    "/items",
+		Body:   `{"id":"${id}"}`,
+		Header: map[string]string{"X-Debug": "1"},
+		Vars:   map[string]string{"secret": "key"},
+	}
+	assert.NoError(t, pre.Run(env))
+	assert.Len(t, env.Header["X-Signature"], 64)
+	assert.NotContains(t, env.Header, "X-Debug")
+	assert.Equal(t, "yes", env.Header["X-Signed"], "Expected set variables to be visible to the following expressions")
+	assert.Equal(t, `{"id":"7"}`, env.Body)
+	assert.Equal(t, map[string]string{"signed": "yes"}, env.SetVars)
+	assert.Equal(t, map[string]string{"secret": "key"}, env.Vars, "Expected the variables of the run not to be changed")
+
+	post, err := Compile([]string{
+		"assert(status == 200, 'unexpected status ' + string(status))",
+		"set_var('state', json('$.state'))",
+		"assert(var('state') == 'paid', 'order is ' + var('state'))",
+	}, PostResponse)
+	assert.NoError(t, err)
+
+	assert.NoError(t, post.Run(&Env{Status: 200, ResponseBody: []byte(`{"state":"paid"}`)}))
+	assert.EqualError(t, post.Run(&Env{Status: 500}), "post_response 1: unexpected status 500")
+	assert.EqualError(t, post.Run(&Env{Status: 200, ResponseBody: []byte(`{"state":"open"}`)}), "post_response 3: order is open")
+	assert.ErrorContains(t, post.Run(&Env{Status: 200, ResponseBody: []byte("<html>")}), "post_response 2: json: response body is not JSON")
+
+	numbers, err := Compile([]string{
+		"assert(number(status) == 200, 'status is not a number')",
+		"assert(status, 'no status')",
+		"assert(number(string(now())) > 0 && number(now_ms()) > 0, 'now is not a number')",
+	}, PostResponse)
+	assert.NoError(t, err)
+	assert.NoError(t, numbers.Run(&Env{Status: 200}))
+	assert.EqualError(t, numbers.Run(&Env{Status: 0}), "post_response 1: status is not a number")
+
+	zero, err := Compile([]string{"assert(status == 0, 'status is set')", "assert(status, 'no status')"}, PostResponse)
+	assert.NoError(t, err)
+	assert.EqualError(t, zero.Run(&Env{Status: 0}), "post_response 2: no status", "Expected a zero status not to be truthy")
+	assert.EqualError(t, zero.Run(&Env{Status: 200}), "post_response 1: status is set")
+}
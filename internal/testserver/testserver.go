@@ -0,0 +1,214 @@
+// Package testserver implements the server of serve-test, a local target with configurable latency and errors to
+// try out and demo probe configurations without a real service
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultErrorStatus is the status code of the failed requests when none is configured
+const DefaultErrorStatus = http.StatusInternalServerError
+
+// allowedMethods are allowed by the preflight and OPTIONS responses
+const allowedMethods = "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"
+
+// Options configures the behavior of every request, a request overrides it with the query parameters latency,
+// jitter, error_rate, status and size
+type Options struct {
+	// Latency is the time a response takes
+	Latency time.Duration
+	// Jitter adds a uniformly random offset of up to +/- Jitter to the latency
+	Jitter time.Duration
+	// ErrorRate is the share of requests failed with ErrorStatus, between 0 and 1
+	ErrorRate float64
+	// ErrorStatus is the status code of the failed requests, defaults to DefaultErrorStatus
+	ErrorStatus int
+	// Seed makes the latencies and errors reproducible, a random seed is used when it is 0
+	Seed int64
+}
+
+// Response is the JSON body of a response, so assertions and captures can be tried out on it
+type Response struct {
+	Request   int64   `json:"request"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Status    int     `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	BodyBytes int64   `json:"body_bytes"`
+	// Padding fills the body up to the requested size
+	Padding string `json:"padding,omitempty"`
+}
+
+// Server answers every request after the configured latency, failing the configured share of them. /health always
+// succeeds immediately and OPTIONS requests are answered as CORS preflights allowing any origin
+type Server struct {
+	opts     Options
+	logger   *slog.Logger
+	requests atomic.Int64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// New creates a server with the given options
+func New(opts Options, logger *slog.Logger) *Server {
+	if opts.ErrorStatus == 0 {
+		opts.ErrorStatus = DefaultErrorStatus
+	}
+	seed := uint64(opts.Seed)
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return &Server{opts: opts, logger: logger, rng: rand.New(rand.NewPCG(seed, 0))}
+}
+
+// Requests returns the number of requests served
+func (s *Server) Requests() int64 {
+	return s.requests.Load()
+}
+
+// ServeHTTP answers a request as configured by the options and its query parameters
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := s.requests.Add(1)
+	w.Header().Set("X-Request-Id", strconv.FormatInt(n, 10))
+
+	switch {
+	case r.URL.Path == "/health":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"status":"ok"}`)
+		return
+	case r.Method == http.MethodOptions:
+		s.preflight(w, r)
+		return
+	}
+
+	opts, err := requestOptions(s.opts, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bodyBytes, _ := io.Copy(io.Discard, r.Body)
+
+	latency, failed := s.draw(opts)
+	select {
+	case <-time.After(latency):
+	case <-r.Context().Done():
+		return
+	}
+
+	status := http.StatusOK
+	if forced := r.URL.Query().Get("status"); forced != "" {
+		status, _ = strconv.Atoi(forced)
+	} else if failed {
+		status = opts.ErrorStatus
+	}
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+
+	resp := Response{
+		Request:   n,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Status:    status,
+		LatencyMS: float64(latency) / float64(time.Millisecond),
+		BodyBytes: bodyBytes,
+	}
+	if size, err := strconv.Atoi(r.URL.Query().Get("size")); err == nil {
+		resp.Padding = padding(resp, size)
+	}
+	s.logger.Debug("Request served", "method", r.Method, "path", r.URL.Path, "status", status, "latency", latency)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Latency-Ms", strconv.FormatFloat(resp.LatencyMS, 'f', 0, 64))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// preflight answers an OPTIONS request, allowing the origin, method and headers of a CORS preflight
+func (s *Server) preflight(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", allowedMethods)
+	if origin := r.Header.Get("Origin"); origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Vary", "Origin")
+		if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// draw returns the latency of a request and whether it fails
+func (s *Server) draw(opts Options) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	latency := opts.Latency
+	if opts.Jitter > 0 {
+		latency += time.Duration(s.rng.Int64N(int64(2*opts.Jitter)+1)) - opts.Jitter
+	}
+	return max(latency, 0), opts.ErrorRate > 0 && s.rng.Float64() < opts.ErrorRate
+}
+
+// requestOptions returns the options overridden by the query parameters of the request. Durations are written like
+// 150ms, or as a number of milliseconds
+func requestOptions(opts Options, r *http.Request) (Options, error) {
+	query := r.URL.Query()
+	for name, target := range map[string]*time.Duration{"latency": &opts.Latency, "jitter": &opts.Jitter} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		d, err := parseDuration(value)
+		if err != nil || d < 0 {
+			return opts, fmt.Errorf("invalid %s %q", name, value)
+		}
+		*target = d
+	}
+	if value := query.Get("error_rate"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return opts, fmt.Errorf("invalid error_rate %q, must be between 0 and 1", value)
+		}
+		opts.ErrorRate = rate
+	}
+	if value := query.Get("status"); value != "" {
+		if status, err := strconv.Atoi(value); err != nil || status < 100 || status > 599 {
+			return opts, fmt.Errorf("invalid status %q", value)
+		}
+	}
+	return opts, nil
+}
+
+// parseDuration parses a duration like 150ms, or a number of milliseconds
+func parseDuration(value string) (time.Duration, error) {
+	if ms, err := strconv.Atoi(value); err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// padding returns the padding filling the JSON body of the response up to size bytes, capped at 10 MiB
+func padding(resp Response, size int) string {
+	size = min(size, 10<<20)
+	data, _ := json.Marshal(resp)
+	// the padding field adds its name, quotes and the trailing line break of the encoder
+	overhead := len(data) + len(`,"padding":""`) + 1
+	if size <= overhead {
+		return ""
+	}
+	return strings.Repeat("x", size-overhead)
+}
@@ -0,0 +1,91 @@
+package testserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dasvh/enchante/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer(t *testing.T) {
+	server := New(Options{Latency: 20 * time.Millisecond, Seed: 1}, testutil.Logger)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	start := time.Now()
+	resp, err := http.Post(ts.URL+"/orders", "application/json", strings.NewReader(`{"id":1}`))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("X-Request-Id"))
+
+	var body Response
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, Response{Request: 1, Method: "POST", Path: "/orders", Status: 200, LatencyMS: 20, BodyBytes: 8}, body)
+	assert.Equal(t, int64(1), server.Requests())
+}
+
+func TestServerQueryOverrides(t *testing.T) {
+	ts := httptest.NewServer(New(Options{Latency: time.Second, ErrorStatus: http.StatusServiceUnavailable}, testutil.Logger))
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		query      string
+		status     int
+		retryAfter string
+	}{
+		{"latency override", "?latency=0", http.StatusOK, ""},
+		{"error rate", "?latency=1ms&error_rate=1", http.StatusServiceUnavailable, "1"},
+		{"forced status", "?latency=0&status=404", http.StatusNotFound, ""},
+		{"invalid error rate", "?error_rate=2", http.StatusBadRequest, ""},
+		{"invalid latency", "?latency=soon", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + "/" + tt.query)
+			assert.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, tt.retryAfter, resp.Header.Get("Retry-After"))
+		})
+	}
+
+	t.Run("size", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/?latency=0&size=4096")
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		assert.Len(t, body, 4096)
+	})
+}
+
+func TestServerHealthAndPreflight(t *testing.T) {
+	ts := httptest.NewServer(New(Options{Latency: time.Second, ErrorRate: 1}, testutil.Logger))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/health")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Expected the health endpoint to ignore latency and errors")
+
+	req, _ := http.NewRequest(http.MethodOptions, ts.URL+"/orders", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "x-tenant")
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, resp.Header.Get("Access-Control-Allow-Methods"), "PUT")
+	assert.Equal(t, "x-tenant", resp.Header.Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, allowedMethods, resp.Header.Get("Allow"))
+}